@@ -0,0 +1,450 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/joho/godotenv"
+	"mycelium/internal/cache"
+	"mycelium/internal/crawler"
+	"mycelium/internal/version"
+)
+
+const usage = `usage: admin [flags] <command> [args]
+
+commands:
+  peek [n]             show the next n ingress items (default 10)
+  sessions             count ingress items per crawl session
+  count                show the size of every queue and set
+  requeue <key>        move every item from queue <key> back to ingress,
+                       unwrapping dead letters
+  remove <url>         remove all ingress items for url
+  visited <url>        check whether url is in the visited set
+  migratevisited [n]   move the visited set from n shards (default 0, the
+                       single key) to the -visitedShards layout
+  malformed [n]        show the newest n malformed ingress items (default 10)
+  requeuemalformed     move malformed items that now parse back to ingress
+  autoblacklist        list auto blacklisted domains and when they expire
+  unblacklist <domain> remove domain from the auto blacklist
+  budget               show pages crawled per domain against the domain budget
+  resetbudget          forget every domain's spend to start a new run
+  pause                pause every crawler sharing the control key
+  resume               resume crawling
+
+flags:
+`
+
+// migrateVisitedBatch is how many visited urls migratevisited moves per
+// round trip.
+const migrateVisitedBatch = 10000
+
+type keys struct {
+	ingress       string
+	fungicide     string
+	approved      string
+	overflow      string
+	malformed     string
+	blacklist     string
+	autoBlacklist string
+	control       string
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		panic(err)
+	}
+
+	var redisOptions cache.CrawlerCacheOptions
+	var k keys
+	flag.StringVar(&redisOptions.Addr, "redisAddr", envOr("REDIS_ADDR", "localhost:6379"), "redis address")
+	flag.StringVar(&redisOptions.Pass, "redisPass", os.Getenv("REDIS_PASS"), "redis password")
+	flag.IntVar(&redisOptions.DB, "redisDB", 0, "redis database (default $REDIS_DB)")
+	flag.IntVar(&redisOptions.VisitedShards, "visitedShards", 0, "keys the visited set is split across, as configured for the crawlers (default $REDIS_VISITED_SHARDS)")
+	flag.StringVar(&k.ingress, "ingressQueue", os.Getenv("REDIS_MYCELIUM_QUEUE_KEY"), "redis key of the mycelium ingress queue")
+	flag.StringVar(&k.fungicide, "fungicideQueue", os.Getenv("REDIS_FUNGICIDE_QUEUE_KEY"), "redis key of the fungicide queue")
+	flag.StringVar(&k.approved, "approvedQueue", os.Getenv("REDIS_FUNGICIDE_APPROVED_KEY"), "redis key of the fungicide approved links queue")
+	flag.StringVar(&k.overflow, "overflowQueue", os.Getenv("REDIS_MYCELIUM_OVERFLOW_KEY"), "redis key of links refused by the frontier cap")
+	flag.StringVar(&k.malformed, "malformedQueue", os.Getenv("REDIS_MYCELIUM_MALFORMED_KEY"), "redis key of ingress items that failed to parse")
+	flag.StringVar(&k.blacklist, "blacklistKey", os.Getenv("REDIS_MYCELIUM_BLACKLIST_KEY"), "redis key of the shared domain blacklist")
+	flag.StringVar(&k.control, "controlKey", envOr("REDIS_MYCELIUM_CONTROL_KEY", "mycelium:control"), "redis key of the fleet control state")
+	flag.StringVar(&k.autoBlacklist, "autoBlacklistKey", os.Getenv("REDIS_MYCELIUM_AUTOBLACKLIST_KEY"), "redis key of the crawler managed auto blacklist")
+	if rawRedisDB := os.Getenv("REDIS_DB"); rawRedisDB != "" {
+		redisDB, err := strconv.Atoi(rawRedisDB)
+		if err != nil {
+			panic(fmt.Errorf("invalid REDIS_DB: %w", err))
+		}
+		redisOptions.DB = redisDB
+	}
+	if rawShards := os.Getenv("REDIS_VISITED_SHARDS"); rawShards != "" {
+		shards, err := strconv.Atoi(rawShards)
+		if err != nil {
+			panic(fmt.Errorf("invalid REDIS_VISITED_SHARDS: %w", err))
+		}
+		redisOptions.VisitedShards = shards
+	}
+	printVersion := flag.Bool("version", false, "print version information and exit")
+	flag.Parse()
+
+	if *printVersion {
+		fmt.Println(version.String())
+		return
+	}
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	rc, err := cache.NewRedisCache(ctx, &redisOptions)
+	if err != nil {
+		panic(err)
+	}
+	defer rc.Close()
+
+	if err := run(ctx, rc, k, args[0], args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", args[0], err.Error())
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, rc *cache.CrawlerCache, k keys, command string, args []string) error {
+	switch command {
+	case "peek":
+		n := int64(10)
+		if len(args) > 0 {
+			parsed, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil || parsed < 1 {
+				return fmt.Errorf("invalid count %q", args[0])
+			}
+			n = parsed
+		}
+		return peek(ctx, rc, k.ingress, n)
+	case "count":
+		return count(ctx, rc, k)
+	case "sessions":
+		return countSessions(ctx, rc, k.ingress)
+	case "requeue":
+		if len(args) != 1 {
+			return fmt.Errorf("expected a source queue key")
+		}
+		moved, err := rc.MoveQueue(ctx, args[0], requireKey(k.ingress, "ingressQueue"), unwrapDeadLetter)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("moved %d items from %s to %s\n", moved, args[0], k.ingress)
+		return nil
+	case "remove":
+		if len(args) != 1 {
+			return fmt.Errorf("expected a url")
+		}
+		removed, err := rc.RemoveFromQueue(ctx, requireKey(k.ingress, "ingressQueue"), func(itemJSON string) bool {
+			var item crawler.IngressItem
+			return json.Unmarshal([]byte(itemJSON), &item) == nil && item.Location == args[0]
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("removed %d items\n", removed)
+		return nil
+	case "visited":
+		if len(args) != 1 {
+			return fmt.Errorf("expected a url")
+		}
+		visited, err := rc.IsVisited(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Println(visited)
+		return nil
+	case "migratevisited":
+		from := 0
+		if len(args) > 0 {
+			parsed, err := strconv.Atoi(args[0])
+			if err != nil || parsed < 0 {
+				return fmt.Errorf("invalid shard count %q", args[0])
+			}
+			from = parsed
+		}
+		moved, err := rc.MigrateVisited(ctx, from, migrateVisitedBatch)
+		if err != nil {
+			return fmt.Errorf("moved %d urls before failing: %w", moved, err)
+		}
+		fmt.Printf("moved %d visited urls\n", moved)
+		return nil
+	case "malformed":
+		n := int64(10)
+		if len(args) > 0 {
+			parsed, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil || parsed < 1 {
+				return fmt.Errorf("invalid count %q", args[0])
+			}
+			n = parsed
+		}
+		return showMalformed(ctx, rc, k.malformed, n)
+	case "requeuemalformed":
+		return requeueMalformed(ctx, rc, k)
+	case "autoblacklist":
+		if k.autoBlacklist == "" {
+			return fmt.Errorf("auto blacklist key not configured")
+		}
+		domains, err := rc.AutoBlacklisted(ctx, k.autoBlacklist, time.Now())
+		if err != nil {
+			return err
+		}
+		names := make([]string, 0, len(domains))
+		for domain := range domains {
+			names = append(names, domain)
+		}
+		sort.Strings(names)
+		for _, domain := range names {
+			fmt.Printf("%s\tuntil %s\n", domain, domains[domain].Format(time.RFC3339))
+		}
+		return nil
+	case "unblacklist":
+		if len(args) != 1 {
+			return fmt.Errorf("expected a domain")
+		}
+		if k.autoBlacklist == "" {
+			return fmt.Errorf("auto blacklist key not configured")
+		}
+		removed, err := rc.RemoveFromAutoBlacklist(ctx, k.autoBlacklist, args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Println(removed)
+		return nil
+	case "budget":
+		spent, err := rc.DomainBudgetSpent(ctx)
+		if err != nil {
+			return err
+		}
+		domains := make([]string, 0, len(spent))
+		for domain := range spent {
+			domains = append(domains, domain)
+		}
+		sort.Strings(domains)
+		for _, domain := range domains {
+			fmt.Printf("%s\t%s\n", domain, spent[domain])
+		}
+		return nil
+	case "resetbudget":
+		return rc.ResetDomainBudget(ctx)
+	case "pause":
+		return rc.SetControlState(ctx, k.control, crawler.ControlPaused)
+	case "resume":
+		return rc.SetControlState(ctx, k.control, "")
+	default:
+		return fmt.Errorf("unknown command")
+	}
+}
+
+func peek(ctx context.Context, rc *cache.CrawlerCache, ingressKey string, n int64) error {
+	items, err := rc.PeekQueue(ctx, requireKey(ingressKey, "ingressQueue"), n)
+	if err != nil {
+		return err
+	}
+	for i, itemJSON := range items {
+		var item crawler.IngressItem
+		if err := json.Unmarshal([]byte(itemJSON), &item); err != nil {
+			fmt.Printf("%d\tinvalid item %q: %s\n", i, itemJSON, err.Error())
+			continue
+		}
+		fmt.Printf("%d\tretries=%d\t%s", i, item.Retries, item.Location)
+		if item.Parent != "" {
+			fmt.Printf("\tparent=%s", item.Parent)
+		}
+		if item.Session != "" {
+			fmt.Printf("\tsession=%s", item.Session)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+// countSessions prints how many ingress items each session has queued.
+// Items from producers that predate sessions count under "-".
+func countSessions(ctx context.Context, rc *cache.CrawlerCache, ingressKey string) error {
+	items, err := rc.PeekQueue(ctx, requireKey(ingressKey, "ingressQueue"), 0)
+	if err != nil {
+		return err
+	}
+	counts := map[string]int{}
+	invalid := 0
+	for _, itemJSON := range items {
+		var item crawler.IngressItem
+		if err := json.Unmarshal([]byte(itemJSON), &item); err != nil {
+			invalid++
+			continue
+		}
+		session := item.Session
+		if session == "" {
+			session = "-"
+		}
+		counts[session]++
+	}
+
+	sessions := make([]string, 0, len(counts))
+	for session := range counts {
+		sessions = append(sessions, session)
+	}
+	sort.Strings(sessions)
+	for _, session := range sessions {
+		fmt.Printf("%s\t%d\n", session, counts[session])
+	}
+	if invalid > 0 {
+		fmt.Printf("invalid\t%d\n", invalid)
+	}
+	return nil
+}
+
+func showMalformed(ctx context.Context, rc *cache.CrawlerCache, malformedKey string, n int64) error {
+	// the list is capped by the crawlers, so read it whole; an n of 0 ends
+	// the range at the tail, where the newest entries are
+	items, err := rc.PeekQueue(ctx, requireKey(malformedKey, "malformedQueue"), 0)
+	if err != nil {
+		return err
+	}
+	if int64(len(items)) > n {
+		items = items[int64(len(items))-n:]
+	}
+	for _, itemJSON := range items {
+		var letter crawler.DeadLetter
+		if err := json.Unmarshal([]byte(itemJSON), &letter); err != nil {
+			fmt.Printf("invalid record %q\n", itemJSON)
+			continue
+		}
+		fmt.Printf("%s\t%s\t%q\n", time.Unix(letter.At, 0).Format(time.RFC3339), letter.Reason, letter.Payload)
+	}
+	return nil
+}
+
+// requeueMalformed pushes the payload of every malformed record that parses
+// as an ingress item, e.g. after a consumer fix, back to ingress. Records
+// that still fail stay where they are.
+func requeueMalformed(ctx context.Context, rc *cache.CrawlerCache, k keys) error {
+	ingressKey := requireKey(k.ingress, "ingressQueue")
+	var requeued int
+	removed, err := rc.RemoveFromQueue(ctx, requireKey(k.malformed, "malformedQueue"), func(itemJSON string) bool {
+		var letter crawler.DeadLetter
+		var item crawler.IngressItem
+		if json.Unmarshal([]byte(itemJSON), &letter) != nil || json.Unmarshal([]byte(letter.Payload), &item) != nil {
+			return false
+		}
+		if err := rc.PushToMyceliumIngress(ctx, letter.Payload, ingressKey); err != nil {
+			return false
+		}
+		requeued++
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("requeued %d items, removed %d records\n", requeued, removed)
+	return nil
+}
+
+func count(ctx context.Context, rc *cache.CrawlerCache, k keys) error {
+	for _, queue := range []struct {
+		name string
+		key  string
+	}{
+		{"ingress", k.ingress},
+		{"fungicide", k.fungicide},
+		{"approved", k.approved},
+		{"overflow", k.overflow},
+		{"malformed", k.malformed},
+	} {
+		if queue.key == "" {
+			continue
+		}
+		size, err := rc.IngressQueueSize(ctx, queue.key)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s (%s)\t%d\n", queue.name, queue.key, size)
+	}
+
+	if k.blacklist != "" {
+		size, err := rc.BlacklistSize(ctx, k.blacklist)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("blacklist (%s)\t%d\n", k.blacklist, size)
+	}
+
+	if k.autoBlacklist != "" {
+		domains, err := rc.AutoBlacklisted(ctx, k.autoBlacklist, time.Now())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("auto blacklist (%s)\t%d\n", k.autoBlacklist, len(domains))
+	}
+
+	state, err := rc.ControlState(ctx, k.control)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("paused\t%t\n", state == crawler.ControlPaused)
+
+	visited, err := rc.VisitedCount(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("visited\t%d\n", visited)
+
+	recrawls, err := rc.RecrawlsScheduled(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("recrawls scheduled\t%d\n", recrawls)
+
+	delayed, err := rc.DelayedItems(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("delayed for politeness windows\t%d\n", delayed)
+	return nil
+}
+
+// requireKey exits with a usage error naming the flag when a key the
+// command needs is not configured.
+// unwrapDeadLetter returns the original message of a dead letter, so items
+// requeued from the dead letter queue reach ingress as they were first
+// pushed. Anything else is returned unchanged.
+func unwrapDeadLetter(item string) string {
+	var letter crawler.DeadLetter
+	if err := json.Unmarshal([]byte(item), &letter); err != nil || letter.Payload == "" {
+		return item
+	}
+	return letter.Payload
+}
+
+func requireKey(key string, flagName string) string {
+	if key == "" {
+		fmt.Fprintf(os.Stderr, "-%s not configured\n", flagName)
+		os.Exit(2)
+	}
+	return key
+}
+
+func envOr(name string, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"mycelium/internal/cache"
+	"mycelium/internal/crawler"
+)
+
+// newTestCache connects a cache to a fresh miniredis server.
+func newTestCache(t *testing.T) (*cache.CrawlerCache, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rc, err := cache.NewRedisCache(context.Background(), &cache.CrawlerCacheOptions{Addr: mr.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rc.Close() })
+	return rc, mr
+}
+
+// runCommand runs an admin command and returns what it printed.
+func runCommand(t *testing.T, rc *cache.CrawlerCache, k keys, command string, args ...string) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- string(data)
+	}()
+	runErr := run(context.Background(), rc, k, command, args)
+	w.Close()
+	return <-out, runErr
+}
+
+var testKeys = keys{ingress: "ingress", fungicide: "fungicide", approved: "approved", blacklist: "blacklist", autoBlacklist: "autoblacklist", control: "control"}
+
+func TestPeek(t *testing.T) {
+	rc, mr := newTestCache(t)
+	mr.RPush("ingress", `{"location": "https://example.com/a", "retries": 2}`, `not json`, `{"location": "https://example.com/b", "parent": "https://example.com/a"}`)
+
+	out, err := runCommand(t, rc, testKeys, "peek", "3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "0\tretries=2\thttps://example.com/a\n" +
+		"1\tinvalid item \"not json\": invalid character 'o' in literal null (expecting 'u')\n" +
+		"2\tretries=0\thttps://example.com/b\tparent=https://example.com/a\n"
+	if out != want {
+		t.Errorf("peek printed %q, want %q", out, want)
+	}
+	if n, _ := mr.List("ingress"); len(n) != 3 {
+		t.Errorf("peek removed items, %d left", len(n))
+	}
+
+	if _, err := runCommand(t, rc, testKeys, "peek", "0"); err == nil {
+		t.Error("peek 0 accepted")
+	}
+}
+
+func TestSessions(t *testing.T) {
+	rc, mr := newTestCache(t)
+	mr.RPush("ingress",
+		`{"location": "https://example.com/a", "session": "run-b"}`,
+		`{"location": "https://example.com/b", "session": "run-a"}`,
+		`{"location": "https://example.com/c"}`,
+		`not json`,
+		`{"location": "https://example.com/d", "session": "run-b"}`)
+
+	out, err := runCommand(t, rc, testKeys, "sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "-\t1\nrun-a\t1\nrun-b\t2\ninvalid\t1\n"; out != want {
+		t.Errorf("sessions printed %q, want %q", out, want)
+	}
+}
+
+func TestCount(t *testing.T) {
+	rc, mr := newTestCache(t)
+	mr.RPush("ingress", "a", "b")
+	mr.RPush("approved", "c")
+	mr.SAdd("blacklist", "spam.example", "ads.example", "junk.example")
+	mr.SAdd("visited", "https://example.com/")
+	mr.ZAdd("autoblacklist", float64(time.Now().Add(time.Hour).Unix()), "bad.example")
+	mr.ZAdd("autoblacklist", float64(time.Now().Add(-time.Hour).Unix()), "forgiven.example")
+	mr.ZAdd("recrawl", 1, "https://example.com/")
+	mr.ZAdd("delayed", 1, `{"location":"https://night.example/"}`)
+	mr.ZAdd("delayed", 2, `{"location":"https://night.example/a"}`)
+
+	out, err := runCommand(t, rc, testKeys, "count")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "ingress (ingress)\t2\n" +
+		"fungicide (fungicide)\t0\n" +
+		"approved (approved)\t1\n" +
+		"blacklist (blacklist)\t3\n" +
+		"auto blacklist (autoblacklist)\t1\n" +
+		"paused\tfalse\n" +
+		"visited\t1\n" +
+		"recrawls scheduled\t1\n" +
+		"delayed for politeness windows\t2\n"
+	if out != want {
+		t.Errorf("count printed %q, want %q", out, want)
+	}
+}
+
+func TestRequeue(t *testing.T) {
+	rc, mr := newTestCache(t)
+	mr.RPush("ingress", "queued")
+	mr.RPush("dead", "first", "second")
+
+	out, err := runCommand(t, rc, testKeys, "requeue", "dead")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "moved 2 items from dead to ingress\n" {
+		t.Errorf("requeue printed %q", out)
+	}
+	got, _ := mr.List("ingress")
+	if len(got) != 3 || got[0] != "queued" || got[1] != "first" || got[2] != "second" {
+		t.Errorf("ingress = %q, want the dead items appended in order", got)
+	}
+	if mr.Exists("dead") {
+		t.Error("dead letter queue not emptied")
+	}
+}
+
+func TestRequeueUnwrapsDeadLetters(t *testing.T) {
+	rc, mr := newTestCache(t)
+	mr.RPush("dead",
+		`{"source":"approved","reason":"bad","payload":"{\"location\":\"https://example.com/a\"}","at":1}`,
+		`{"location":"https://example.com/b"}`,
+		`{"source":"verdict","reason":"bad","payload":"{\"location\":\"https://example.com/a\"}","at":2}`)
+
+	out, err := runCommand(t, rc, testKeys, "requeue", "dead")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "moved 3 items from dead to ingress\n" {
+		t.Errorf("requeue printed %q", out)
+	}
+	got, _ := mr.List("ingress")
+	want := []string{`{"location":"https://example.com/a"}`, `{"location":"https://example.com/b"}`, `{"location":"https://example.com/a"}`}
+	if len(got) != len(want) {
+		t.Fatalf("ingress = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("ingress[%d] = %s, want %s", i, got[i], want[i])
+		}
+	}
+	if mr.Exists("dead") {
+		t.Error("dead letter queue not emptied")
+	}
+}
+
+func TestRemove(t *testing.T) {
+	rc, mr := newTestCache(t)
+	mr.RPush("ingress",
+		`{"location": "https://example.com/a"}`,
+		`{"location": "https://example.com/b"}`,
+		`{"location": "https://example.com/a", "retries": 1}`,
+		`{"location": "https://example.com/a"}`)
+
+	out, err := runCommand(t, rc, testKeys, "remove", "https://example.com/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "removed 3 items\n" {
+		t.Errorf("remove printed %q", out)
+	}
+	got, _ := mr.List("ingress")
+	if len(got) != 1 || got[0] != `{"location": "https://example.com/b"}` {
+		t.Errorf("ingress = %q, want only the other url", got)
+	}
+}
+
+func TestVisited(t *testing.T) {
+	rc, mr := newTestCache(t)
+	mr.SAdd("visited", "https://example.com/")
+
+	for url, want := range map[string]string{
+		"https://example.com/":      "true\n",
+		"https://example.com/other": "false\n",
+	} {
+		out, err := runCommand(t, rc, testKeys, "visited", url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != want {
+			t.Errorf("visited %s printed %q, want %q", url, out, want)
+		}
+	}
+}
+
+func TestRunRejectsBadArguments(t *testing.T) {
+	rc, _ := newTestCache(t)
+	for _, args := range [][]string{
+		{"requeue"},
+		{"remove"},
+		{"visited", "a", "b"},
+		{"peek", "many"},
+		{"frobnicate"},
+	} {
+		if _, err := runCommand(t, rc, testKeys, args[0], args[1:]...); err == nil {
+			t.Errorf("%q accepted", args)
+		}
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	rc, mr := newTestCache(t)
+	k := testKeys
+	k.malformed = "malformed"
+	mr.RPush("malformed",
+		`{"source":"ingress","reason":"unexpected end of JSON input","payload":"{\"location\":\"https://exa","at":1700000000}`,
+		`{"source":"ingress","reason":"invalid character 'n'","payload":"not json","at":1700000060}`,
+		`{"source":"ingress","reason":"json: cannot unmarshal string into Go struct field IngressItem.retries of type int32","payload":"{\"location\":\"https://example.com/\",\"retries\":\"1\"}","at":1700000120}`)
+
+	out, err := runCommand(t, rc, k, "malformed", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"not json"`) || !strings.Contains(lines[1], "retries") {
+		t.Errorf("malformed 2 printed %q, want the newest two records", out)
+	}
+	if _, err := runCommand(t, rc, k, "malformed", "0"); err == nil {
+		t.Error("malformed 0 accepted")
+	}
+}
+
+func TestRequeueMalformed(t *testing.T) {
+	rc, mr := newTestCache(t)
+	k := testKeys
+	k.malformed = "malformed"
+	fixed := `{"location":"https://example.com/fixed"}`
+	broken := `{"source":"ingress","reason":"bad","payload":"not json","at":1}`
+	mr.RPush("malformed",
+		broken,
+		`{"source":"ingress","reason":"bad","payload":"{\"location\":\"https://example.com/fixed\"}","at":2}`)
+
+	out, err := runCommand(t, rc, k, "requeuemalformed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "requeued 1 items, removed 1 records\n" {
+		t.Errorf("requeuemalformed printed %q", out)
+	}
+	if got, _ := mr.List("ingress"); len(got) != 1 || got[0] != fixed {
+		t.Errorf("ingress = %q, want the payload that now parses", got)
+	}
+	if got, _ := mr.List("malformed"); len(got) != 1 || got[0] != broken {
+		t.Errorf("malformed = %q, want the still broken record kept", got)
+	}
+}
+
+func TestAutoBlacklist(t *testing.T) {
+	rc, mr := newTestCache(t)
+	until := time.Now().Add(time.Hour).Truncate(time.Second)
+	mr.ZAdd("autoblacklist", float64(until.Unix()), "bad.example")
+	mr.ZAdd("autoblacklist", float64(until.Unix()), "awful.example")
+	mr.ZAdd("autoblacklist", float64(time.Now().Add(-time.Minute).Unix()), "forgiven.example")
+
+	out, err := runCommand(t, rc, testKeys, "autoblacklist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stamp := until.Format(time.RFC3339)
+	if want := "awful.example\tuntil " + stamp + "\nbad.example\tuntil " + stamp + "\n"; out != want {
+		t.Errorf("autoblacklist printed %q, want %q", out, want)
+	}
+	if members, _ := mr.ZMembers("autoblacklist"); len(members) != 2 {
+		t.Errorf("expired entries not pruned: %v", members)
+	}
+
+	out, err = runCommand(t, rc, testKeys, "unblacklist", "bad.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "true\n" {
+		t.Errorf("unblacklist printed %q", out)
+	}
+	if out, _ := runCommand(t, rc, testKeys, "unblacklist", "bad.example"); out != "false\n" {
+		t.Errorf("second unblacklist printed %q", out)
+	}
+
+	noKey := testKeys
+	noKey.autoBlacklist = ""
+	if _, err := runCommand(t, rc, noKey, "autoblacklist"); err == nil {
+		t.Error("autoblacklist without a key succeeded")
+	}
+}
+
+func TestDomainBudget(t *testing.T) {
+	rc, mr := newTestCache(t)
+	mr.HSet("domainbudget", "b.example", "3")
+	mr.HSet("domainbudget", "a.example", "12")
+
+	out, err := runCommand(t, rc, testKeys, "budget")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "a.example\t12\nb.example\t3\n"; out != want {
+		t.Errorf("budget printed %q, want %q", out, want)
+	}
+
+	if _, err := runCommand(t, rc, testKeys, "resetbudget"); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists("domainbudget") {
+		t.Error("resetbudget left the domain budget behind")
+	}
+	if out, _ := runCommand(t, rc, testKeys, "budget"); out != "" {
+		t.Errorf("budget after reset printed %q", out)
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	rc, mr := newTestCache(t)
+
+	if _, err := runCommand(t, rc, testKeys, "pause"); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := mr.Get("control"); state != crawler.ControlPaused {
+		t.Errorf("control state = %q after pause, want %q", state, crawler.ControlPaused)
+	}
+	if out, _ := runCommand(t, rc, testKeys, "count"); !strings.Contains(out, "paused\ttrue\n") {
+		t.Errorf("count printed %q, want it paused", out)
+	}
+
+	if _, err := runCommand(t, rc, testKeys, "resume"); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists("control") {
+		t.Error("resume left the control state behind")
+	}
+}
+
+func TestMigrateVisited(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.SAdd("visited", "https://example.com/", "https://example.org/", "https://example.net/")
+	rc, err := cache.NewRedisCache(context.Background(), &cache.CrawlerCacheOptions{Addr: mr.Addr(), VisitedShards: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rc.Close() })
+
+	out, err := runCommand(t, rc, testKeys, "migratevisited")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "moved 3 visited urls\n" {
+		t.Errorf("migratevisited printed %q", out)
+	}
+	if mr.Exists("visited") {
+		t.Error("monolithic visited set left behind")
+	}
+	out, err = runCommand(t, rc, testKeys, "count")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "visited\t3\n") {
+		t.Errorf("count printed %q, want 3 visited across shards", out)
+	}
+
+	if _, err := runCommand(t, rc, testKeys, "migratevisited", "-1"); err == nil {
+		t.Error("migratevisited accepted a negative shard count")
+	}
+}
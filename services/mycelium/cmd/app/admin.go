@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"mycelium/internal/crawler"
+	"mycelium/internal/version"
+)
+
+const adminShutdownTimeout = 5 * time.Second
+
+// serveAdmin runs the admin http server until ctx is cancelled.
+func (app *Mycelium) serveAdmin(ctx context.Context) {
+	server := &http.Server{
+		Addr:              app.config.adminAddr,
+		Handler:           app.adminHandler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), adminShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			app.logger.Error("failed to shut down admin server", "error", err)
+		}
+	}()
+
+	app.logger.Info("admin server listening", "addr", app.config.adminAddr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		app.logger.Error("admin server failed", "error", err)
+	}
+}
+
+func (app *Mycelium) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"status":  "ok",
+			"version": version.Version,
+			"commit":  version.Commit,
+			"date":    version.Date,
+		})
+	})
+
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		if err := app.cache.Ping(r.Context()); err != nil {
+			http.Error(w, fmt.Sprintf("redis unreachable: %s", err.Error()), http.StatusServiceUnavailable)
+			return
+		}
+		if app.crawler.Paused() {
+			http.Error(w, "crawling paused", http.StatusServiceUnavailable)
+			return
+		}
+		if len(app.crawler.Workers()) == 0 {
+			http.Error(w, "no crawler workers running", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+
+	mux.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
+		stats := app.collectProgress(r.Context())
+		if uptime := time.Since(app.startedAt).Seconds(); uptime > 0 {
+			stats.PagesPerSec = float64(stats.Fetched) / uptime
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stats)
+	})
+
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		var counters map[string]int64
+		var labeled map[crawler.LabeledCounter]int64
+		if app.metrics != nil {
+			counters = app.metrics.Snapshot()
+			labeled = app.metrics.LabeledSnapshot()
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w, counters, labeled, app.crawler.Paused())
+	})
+
+	mux.HandleFunc("GET /workers", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"target":  app.workers.size(),
+			"workers": app.crawler.Workers(),
+		})
+	})
+
+	// POST /workers?n=N sets the worker count, up to -maxRoutines when it
+	// is set. With autoscaling enabled the next check may move it again
+	// within the configured bounds.
+	mux.HandleFunc("POST /workers", func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.Atoi(r.URL.Query().Get("n"))
+		if err != nil || n < 1 {
+			http.Error(w, "n must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		if limit := app.config.maxCrawlers; limit > 0 && n > limit {
+			http.Error(w, fmt.Sprintf("n must not exceed maxRoutines (%d)", limit), http.StatusBadRequest)
+			return
+		}
+		app.logger.Info("scaling crawlers via admin endpoint", "target", n)
+		app.workers.scale(n)
+		fmt.Fprintln(w, "ok")
+	})
+
+	// POST /pause and /resume set the control state for every crawler
+	// sharing the control key, not just this process.
+	mux.HandleFunc("POST /pause", func(w http.ResponseWriter, r *http.Request) {
+		app.setControlState(w, r, crawler.ControlPaused)
+	})
+	mux.HandleFunc("POST /resume", func(w http.ResponseWriter, r *http.Request) {
+		app.setControlState(w, r, "")
+	})
+
+	if app.config.adminPprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+
+	return mux
+}
+
+// labelEscaper escapes label values for the prometheus text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writeMetrics writes the build_info and paused gauges and the crawl
+// counters in the prometheus text format, labeled counters with their label.
+func writeMetrics(w io.Writer, counters map[string]int64, labeled map[crawler.LabeledCounter]int64, paused bool) {
+	fmt.Fprintln(w, "# HELP mycelium_build_info Build version of the running binary.")
+	fmt.Fprintln(w, "# TYPE mycelium_build_info gauge")
+	fmt.Fprintf(w, "mycelium_build_info{version=\"%s\",commit=\"%s\",date=\"%s\"} 1\n",
+		labelEscaper.Replace(version.Version), labelEscaper.Replace(version.Commit), labelEscaper.Replace(version.Date))
+
+	fmt.Fprintln(w, "# HELP mycelium_paused Whether crawling is paused by the control key.")
+	fmt.Fprintln(w, "# TYPE mycelium_paused gauge")
+	pausedValue := 0
+	if paused {
+		pausedValue = 1
+	}
+	fmt.Fprintf(w, "mycelium_paused %d\n", pausedValue)
+
+	names := make([]string, 0, len(counters))
+	for name := range counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "# TYPE mycelium_%s_total counter\n", name)
+		fmt.Fprintf(w, "mycelium_%s_total %d\n", name, counters[name])
+	}
+
+	keys := make([]crawler.LabeledCounter, 0, len(labeled))
+	for key := range labeled {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Name != keys[j].Name {
+			return keys[i].Name < keys[j].Name
+		}
+		return keys[i].Value < keys[j].Value
+	})
+	for i, key := range keys {
+		if i == 0 || keys[i-1].Name != key.Name {
+			fmt.Fprintf(w, "# TYPE mycelium_%s_total counter\n", key.Name)
+		}
+		fmt.Fprintf(w, "mycelium_%s_total{%s=\"%s\"} %d\n", key.Name, key.Label, labelEscaper.Replace(key.Value), labeled[key])
+	}
+}
+
+func (app *Mycelium) setControlState(w http.ResponseWriter, r *http.Request, state string) {
+	if err := app.cache.SetControlState(r.Context(), app.controlKey, state); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	app.logger.Info("control state set via admin endpoint", "key", app.controlKey, "state", state)
+	fmt.Fprintln(w, "ok")
+}
@@ -2,71 +2,709 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"sync"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
-	"mycelium/internal/cache"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"mycelium/internal/chooser"
 	"mycelium/internal/crawler"
+	"mycelium/internal/filter"
 )
 
 type Environment struct {
 	RedisAddr            string
 	RedisPass            string
 	RedisDB              int
+	RedisVisitedShards   int
 	FilestoreOutDir      string
 	FungicideQueueKey    string
 	MyceliumIngressKey   string
 	MyceliumBlacklistKey string
+	FungicideApprovedKey string
+	FungicideVerdictKey  string
+	DeadLetterKey        string
+	AutoBlacklistKey     string
+	OtlpEndpoint         string
+	ControlKey           string
+	OverflowKey          string
+	MalformedKey         string
 }
 
 type MyceliumConfig struct {
-	seedFile            string
-	agentsFile          string
-	proxyFile           string
-	domainBlacklistFile string
-	numCrawlers         int
-	maxIdleSeconds      int
+	printVersion         bool
+	configFile           string
+	seedFile             string
+	seedUrls             stringList
+	seedMode             string
+	confirm              bool
+	agentsFile           string
+	proxyFile            string
+	proxyStrategy        string
+	proxyEpsilon         float64
+	proxyBypass          string
+	allowEmptyEnv        bool
+	domainOverrides      map[string]crawler.DomainOverride
+	stickyUserAgents     bool
+	noRotateUserAgents   bool
+	domainBlacklistFile  string
+	pushBlacklist        bool
+	blockedExtensions    string
+	blockedPathPrefixes  string
+	strippedParams       string
+	rewriteFile          string
+	allowedSchemes       string
+	allowedPorts         string
+	blockIPLiterals      bool
+	trapFilter           bool
+	minWords             int
+	titleBlockPattern    string
+	queueDroppedLinks    bool
+	linkQueueing         string
+	softErrors           string
+	scriptMaxBytes       int
+	scriptsMaxBytes      int
+	keepMinifiedScripts  bool
+	cacheBusting         bool
+	sampleRate           int
+	sampleDir            string
+	hashRoutes           bool
+	hostFolding          time.Duration
+	verifyExternalLinks  bool
+	maxUrlLength         int
+	maxSegmentRepeats    int
+	maxQueryParams       int
+	numCrawlers          int
+	minCrawlers          int
+	maxCrawlers          int
+	scaleUpDepth         int
+	scaleInterval        int
+	maxIdleSeconds       int
+	statsInterval        int
+	daemon               bool
+	maxWorkerFailures    int
+	redisWait            time.Duration
+	logLevel             string
+	logFormat            string
+	logDedupWindow       time.Duration
+	fungicideQueueKey    string
+	ingressQueueKey      string
+	blacklistKey         string
+	approvedQueueKey     string
+	verdictQueueKey      string
+	deadLetterQueueKey   string
+	malformedQueueKey    string
+	malformedMax         int
+	rejectVerdictDomains bool
+	autoBlacklistKey     string
+	controlKey           string
+	errorBudgetRatio     float64
+	errorBudgetSamples   int
+	errorBudgetWindow    time.Duration
+	autoBlacklistTTL     time.Duration
+	domainBudget         int
+	hostSlots            int
+	otlpEndpoint         string
+	traceRatio           float64
+	lookahead            int
+	feedParsing          bool
+	maxLinksPerPage      int
+	linkSelection        string
+	frontierCap          int
+	overflowQueueKey     string
+	overflowInterval     time.Duration
+	recrawlAfter         time.Duration
+	recrawlDomains       string
+	recrawlInterval      time.Duration
+	changeDetection      bool
+	fungicideCodec       string
+	fungicideEnvelope    bool
+	crawlerID            string
+	sessionID            string
+	fungicideBatch       int
+	fungicideMaxBytes    int
+	fungicideFlush       time.Duration
+	fungicideSpoolDir    string
+	maxRetries           int
+	maxRedirects         int
+	maxHostRedirects     int
+	requestTimeout       time.Duration
+	maxBodyBytes         int64
+	bandwidthBudget      int64
+	captureFailures      int
+	captureFailureBytes  int
+	pageTimeout          time.Duration
+	maxIdleConns         int
+	maxIdleConnsPerHost  int
+	idleConnTimeout      time.Duration
+	forceHTTP2           bool
+	tlsSessionCache      int
+	domainRps            float64
+	maxRps               float64
+	maxRpsBurst          int
+	politenessFile       string
+	adminAddr            string
+	adminPprof           bool
+	shutdownGraceSeconds int
+
+	// cliFlags are the flags given on the command line, as opposed to
+	// those the config file set
+	cliFlags map[string]bool
+}
+
+// appCache is the part of the redis cache the app uses directly, on top of
+// what the crawler needs.
+type appCache interface {
+	crawler.CrawlerCache
+	Ping(ctx context.Context) error
+	AddToBlacklist(ctx context.Context, domains []string, blacklistKey string) error
+	VisitedCount(ctx context.Context) (int64, error)
+	PushToDeadLetter(ctx context.Context, letter string, queueKey string) error
+	ControlState(ctx context.Context, key string) (string, error)
+	SetControlState(ctx context.Context, key string, state string) error
+	Close() error
 }
 
 type Mycelium struct {
-	config  MyceliumConfig
-	cache   cache.CrawlerCache
-	crawler crawler.Crawler
+	config           MyceliumConfig
+	cache            appCache
+	crawler          crawler.Crawler
+	proxyChooser     *chooser.ProxyChooser
+	userAgentChooser *chooser.UserAgentChooser
+	urlFilters       *filter.Chain
+	rewriteFilter    *filter.RewriteFilter
+	politeness       *crawler.Politeness
+	domainFilter     *filter.DomainFilter
+	domainBlacklist  []string
+	blacklistKey     string
+	ingressKey       string
+	fungicideKey     string
+	controlKey       string
+	metrics          *crawler.CounterMetrics
+	startedAt        time.Time
+	workers          *workerPool
+	tracerProvider   *sdktrace.TracerProvider
+	logger           *slog.Logger
+	logDedup         *crawler.DedupHandler
 }
 
 func (app *Mycelium) seed(ctx context.Context) {
-	urls, err := initSeedUrls(app.config.seedFile)
+	urls, err := initSeedUrls(app.config.seedFile, app.config.seedUrls)
 	if err != nil {
 		panic(err)
 	}
 
-	var seed []string
-	for _, seedUrl := range urls {
-		seed = append(seed, seedUrl.String())
+	err = app.crawler.Seed(ctx, urls, crawler.SeedMode(app.config.seedMode))
+	if err != nil && ctx.Err() == nil {
+		panic(err)
+	}
+}
+
+// crawl runs the worker pool until every worker has exited or ctx is done,
+// returning the error that stopped the pool, if any.
+func (app *Mycelium) crawl(ctx context.Context) error {
+	app.workers.scale(app.config.numCrawlers)
+
+	// all workers exiting on their own ends the crawl
+	done := make(chan struct{})
+	go func() {
+		app.workers.waitEmpty(ctx.Done())
+		close(done)
+	}()
+
+	var scaleTicks <-chan time.Time
+	if app.config.maxCrawlers > 0 {
+		ticker := time.NewTicker(time.Duration(app.config.scaleInterval) * time.Second)
+		defer ticker.Stop()
+		scaleTicks = ticker.C
 	}
 
-	err = app.crawler.Seed(ctx, seed)
+wait:
+	for {
+		select {
+		case <-done:
+			if ctx.Err() == nil {
+				return app.workers.err()
+			}
+			break wait
+		case <-ctx.Done():
+			break wait
+		case <-scaleTicks:
+			app.autoscale(ctx)
+		}
+	}
+
+	app.logger.Info("shutting down, waiting for crawlers to finish", "graceSeconds", app.config.shutdownGraceSeconds)
+	grace := make(chan struct{})
+	timer := time.AfterFunc(time.Duration(app.config.shutdownGraceSeconds)*time.Second, func() { close(grace) })
+	defer timer.Stop()
+	if !app.workers.waitEmpty(grace) {
+		app.logger.Warn("crawlers did not finish within grace period, forcing exit")
+	}
+	return app.workers.err()
+}
+
+func (app *Mycelium) runCrawler(ctx context.Context, i int) error {
+	app.logger.Info("crawler starting", "worker", i)
+	defer app.logger.Info("crawler stopped", "worker", i)
+
+	err := app.crawler.Crawl(ctx)
+	if errors.Is(err, crawler.ErrBandwidthBudgetExhausted) {
+		app.logger.Info("bandwidth budget exhausted", "worker", i, "budget", app.config.bandwidthBudget)
+		return nil
+	}
+	if err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
+
+// consumeIngress moves links approved by fungicide into the crawler's ingress
+// queue, normalizing and filtering them on the way.
+func (app *Mycelium) consumeIngress(ctx context.Context, approvedKey string) {
+	backoff := time.Second
+	idleSince := time.Now()
+	idleReported := false
+
+	for ctx.Err() == nil {
+		itemJSON, err := app.cache.PopFromMyceliumIngress(ctx, approvedKey)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if errors.Is(err, crawler.ErrQueueEmpty) {
+				idle := time.Since(idleSince)
+				if !idleReported && idle > time.Duration(app.config.maxIdleSeconds)*time.Second {
+					app.logger.Info("no approved links received", "idle", idle.Round(time.Second))
+					idleReported = true
+				}
+				continue
+			}
+
+			app.logger.Error("failed to pop from approved queue", "error", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, 30*time.Second)
+			continue
+		}
+		backoff = time.Second
+		idleSince = time.Now()
+		idleReported = false
+
+		item, err := parseApprovedItem(itemJSON)
+		if err != nil {
+			app.logger.Error("malformed approved item", "item", itemJSON, "error", err)
+			app.crawler.DeadLetter(context.WithoutCancel(ctx), "approved", itemJSON, err.Error())
+			continue
+		}
+
+		// the item is ours now, finish handling it even during shutdown
+		if err := app.crawler.Enqueue(context.WithoutCancel(ctx), item); err != nil {
+			app.logger.Error("failed to enqueue approved link", "url", item.Location, "error", err)
+		}
+	}
+}
+
+// parseApprovedItem decodes an approved link pushed by fungicide. Its
+// location must be an absolute url; the retry count starts over.
+func parseApprovedItem(itemJSON string) (crawler.IngressItem, error) {
+	var item crawler.IngressItem
+	if err := json.Unmarshal([]byte(itemJSON), &item); err != nil {
+		return item, fmt.Errorf("failed to parse approved item: %w", err)
+	}
+	loc, err := url.Parse(strings.TrimSpace(item.Location))
 	if err != nil {
-		panic(err)
+		return item, fmt.Errorf("malformed url %q: %w", item.Location, err)
+	}
+	if loc.Scheme == "" || loc.Host == "" {
+		return item, fmt.Errorf("url %q is not absolute", item.Location)
+	}
+	item.Retries = 0
+	return item, nil
+}
+
+// consumeVerdicts reads fungicide's verdicts and queues the links it
+// approved. Messages that cannot be parsed go to the dead letter queue.
+func (app *Mycelium) consumeVerdicts(ctx context.Context, verdictKey string) {
+	backoff := time.Second
+
+	for ctx.Err() == nil {
+		message, err := app.cache.PopFromMyceliumIngress(ctx, verdictKey)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if errors.Is(err, crawler.ErrQueueEmpty) {
+				continue
+			}
+
+			app.logger.Error("failed to pop from verdict queue", "error", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, 30*time.Second)
+			continue
+		}
+		backoff = time.Second
+
+		// the message is ours now, finish handling it even during shutdown
+		msgCtx := context.WithoutCancel(ctx)
+
+		verdict, err := crawler.ParseVerdict([]byte(message))
+		if err != nil {
+			app.logger.Error("malformed verdict", "message", message, "error", err)
+			app.crawler.DeadLetter(msgCtx, "verdict", message, err.Error())
+			continue
+		}
+
+		if verdict.Verdict == crawler.VerdictRejected && app.config.rejectVerdictDomains {
+			app.crawler.RejectDomain(verdict.Location)
+		}
+		queued, err := app.crawler.ApplyVerdict(msgCtx, verdict)
+		if err != nil {
+			app.logger.Error("failed to apply verdict", "url", verdict.Location, "error", err)
+			continue
+		}
+		app.logger.Debug("applied verdict", "url", verdict.Location, "verdict", verdict.Verdict, "queued", queued)
 	}
 }
 
-func (app *Mycelium) crawl(ctx context.Context) {
-	var wg sync.WaitGroup
+// promoteRecrawls periodically moves pages that are due for a recrawl back
+// to the ingress queue.
+func (app *Mycelium) promoteRecrawls(ctx context.Context) {
+	ticker := time.NewTicker(app.config.recrawlInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// drain everything that is due before waiting for the next tick
+		for ctx.Err() == nil {
+			promoted, err := app.crawler.PromoteRecrawls(ctx, recrawlBatch)
+			if err != nil {
+				app.logger.Error("failed to promote recrawls", "error", err)
+				break
+			}
+			if promoted > 0 {
+				app.logger.Info("promoted recrawls", "count", promoted)
+			}
+			if promoted < recrawlBatch {
+				break
+			}
+		}
+	}
+}
+
+// promoteDelayed periodically moves items held for a politeness window that
+// has opened back to the ingress queue.
+func (app *Mycelium) promoteDelayed(ctx context.Context) {
+	ticker := time.NewTicker(delayedInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for ctx.Err() == nil {
+			promoted, err := app.crawler.PromoteDelayed(ctx, delayedBatch)
+			if err != nil {
+				app.logger.Error("failed to promote delayed items", "error", err)
+				break
+			}
+			if promoted > 0 {
+				app.logger.Info("promoted delayed items", "count", promoted)
+			}
+			if promoted < delayedBatch {
+				break
+			}
+		}
+	}
+}
+
+// drainOverflow periodically moves links spilled past the frontier cap back
+// to the ingress queue as it empties.
+func (app *Mycelium) drainOverflow(ctx context.Context) {
+	ticker := time.NewTicker(app.config.overflowInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 
-	crawlRoutine := func(wg *sync.WaitGroup, i int) {
-		defer wg.Done()
-		fmt.Printf("Crawler %d starting\n", i)
-		err := app.crawler.Crawl(ctx)
+		moved, err := app.crawler.DrainOverflow(ctx)
 		if err != nil {
-			panic(fmt.Errorf("crawler %d failed with error: %w", i, err))
+			app.logger.Error("failed to drain overflow", "error", err)
+			continue
+		}
+		if moved > 0 {
+			app.logger.Info("drained overflow", "count", moved)
+		}
+	}
+}
+
+func (app *Mycelium) close() {
+	app.crawler.Close(context.Background())
+	if err := app.cache.Close(); err != nil {
+		app.logger.Error("failed to close cache", "error", err)
+	}
+	if app.tracerProvider != nil {
+		// flush the spans of the last items before exiting
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := app.tracerProvider.Shutdown(ctx); err != nil {
+			app.logger.Error("failed to flush traces", "error", err)
+		}
+	}
+	if app.logDedup != nil {
+		app.logDedup.Close(context.Background())
+	}
+}
+
+// flushLogs logs the counts of repeated errors whose window has closed
+// even when they stopped repeating.
+func (app *Mycelium) flushLogs(ctx context.Context) {
+	ticker := time.NewTicker(app.config.logDedupWindow)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.logDedup.Flush(ctx)
+		}
+	}
+}
+
+func (app *Mycelium) handleReload(ctx context.Context) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sighup:
+			app.reload()
+			app.reloadBlacklist(ctx)
+		}
+	}
+}
+
+func (app *Mycelium) reload() {
+	if app.proxyChooser != nil {
+		if err := app.proxyChooser.Reload(app.config.proxyFile); err != nil {
+			app.logger.Error("failed to reload proxy file, keeping previous proxies", "error", err)
+		} else {
+			app.logger.Info("reloaded proxies", "loadedAt", app.proxyChooser.LoadedAt())
+		}
+	}
+	if app.userAgentChooser != nil && app.config.agentsFile != "" {
+		if err := app.userAgentChooser.Reload(app.config.agentsFile); err != nil {
+			app.logger.Error("failed to reload agents file, keeping previous user agents", "error", err)
+		} else {
+			app.logger.Info("reloaded user agents", "loadedAt", app.userAgentChooser.LoadedAt())
+		}
+	}
+	if app.rewriteFilter != nil {
+		if rules, err := filter.LoadRewriteRules(app.config.rewriteFile); err != nil {
+			app.logger.Error("failed to reload rewrite file, keeping previous rules", "error", err)
+		} else {
+			app.rewriteFilter.Reload(rules)
+			app.logger.Info("reloaded rewrite rules", "rules", len(rules))
+		}
+	}
+	if app.politeness != nil {
+		if profiles, err := loadPolitenessProfiles(app.config.politenessFile); err != nil {
+			app.logger.Error("failed to reload politeness file, keeping previous profiles", "error", err)
+		} else {
+			app.politeness.Reload(profiles)
+			app.logger.Info("reloaded politeness profiles", "domains", len(profiles))
+		}
+	}
+}
+
+func (app *Mycelium) reloadBlacklist(ctx context.Context) {
+	if app.domainFilter == nil {
+		return
+	}
+
+	domains, err := initDomainBlacklist(app.config.domainBlacklistFile)
+	if err == nil {
+		err = app.domainFilter.Reload(domains)
+	}
+	if err != nil {
+		app.logger.Error("failed to reload blacklist file, keeping previous entries", "error", err)
+		return
+	}
+
+	previous := map[string]bool{}
+	for _, d := range app.domainBlacklist {
+		previous[d] = true
+	}
+	var added []string
+	for _, d := range domains {
+		if !previous[d] && !strings.Contains(d, "*") {
+			added = append(added, d)
 		}
 	}
+	app.domainBlacklist = domains
+	app.logger.Info("reloaded blacklist", "entries", len(domains), "new", len(added))
+
+	if app.config.pushBlacklist && app.blacklistKey != "" {
+		if err := app.cache.AddToBlacklist(ctx, added, app.blacklistKey); err != nil {
+			app.logger.Error("failed to push new blacklist entries", "error", err)
+		}
+	}
+}
 
-	wg.Add(app.config.numCrawlers)
-	for i := 0; i < app.config.numCrawlers; i++ {
-		go crawlRoutine(&wg, i)
+func (app *Mycelium) reportStats(ctx context.Context) {
+	if app.config.statsInterval <= 0 {
+		return
 	}
 
-	wg.Wait()
+	ticker := time.NewTicker(time.Duration(app.config.statsInterval) * time.Second)
+	defer ticker.Stop()
+	app.reportStatsOn(ctx, ticker.C, time.Now())
+}
+
+// reportStatsOn reports on every tick, measuring rates over the time between
+// ticks.
+func (app *Mycelium) reportStatsOn(ctx context.Context, ticks <-chan time.Time, start time.Time) {
+	last := start
+	var lastFetched int64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticks:
+			lastFetched = app.reportProgress(ctx, now.Sub(last), lastFetched)
+			last = now
+			if app.proxyChooser != nil {
+				app.logger.Info("proxy picks", "picks", app.proxyChooser.Stats())
+			}
+			if app.userAgentChooser != nil {
+				app.logger.Info("user agent picks", "picks", app.userAgentChooser.Stats())
+			}
+			if app.urlFilters != nil {
+				app.logger.Info("filter hits", "hits", app.urlFilters.Hits())
+			}
+		}
+	}
+}
+
+type progressStats struct {
+	Fetched     int64   `json:"fetched"`
+	FetchErrors int64   `json:"fetchErrors"`
+	Bytes       int64   `json:"bytes"`
+	InFlight    int64   `json:"inFlight"`
+	ErrorRate   float64 `json:"errorRate"`
+	PagesPerSec float64 `json:"pagesPerSec"`
+	Ingress     int64   `json:"ingress"`
+	Fungicide   int64   `json:"fungicide"`
+	Visited     int64   `json:"visited"`
+	Workers     int     `json:"workers"`
+	IdleWorkers int     `json:"idleWorkers"`
+	Paused      bool    `json:"paused"`
+	Session     string  `json:"session"`
+	// QueueLatencyP50 and QueueLatencyP95 are how long recently popped
+	// items waited in the ingress queue.
+	QueueLatencyP50 time.Duration `json:"queueLatencyP50"`
+	QueueLatencyP95 time.Duration `json:"queueLatencyP95"`
+
+	Timings map[string]crawler.Histogram `json:"timings,omitempty"`
+}
+
+// collectProgress gathers the crawl counters and queue depths. PagesPerSec is
+// left for the caller since it depends on the window being reported.
+func (app *Mycelium) collectProgress(ctx context.Context) progressStats {
+	var stats progressStats
+	crawlStats := app.crawler.Stats()
+	stats.Bytes = crawlStats.BytesDownloaded
+	stats.InFlight = crawlStats.InFlight
+	stats.QueueLatencyP50 = crawlStats.QueueLatencyP50
+	stats.QueueLatencyP95 = crawlStats.QueueLatencyP95
+	stats.Session = app.config.sessionID
+	if app.metrics != nil {
+		stats.Fetched = app.metrics.Get(crawler.MetricPagesFetched)
+		stats.FetchErrors = app.metrics.Get(crawler.MetricFetchErrors)
+		stats.Timings = app.metrics.Histograms()
+	}
+	if attempts := stats.Fetched + stats.FetchErrors; attempts > 0 {
+		stats.ErrorRate = float64(stats.FetchErrors) / float64(attempts) * 100
+	}
+
+	// queue depths are best effort, -1 means the lookup failed
+	stats.Ingress, stats.Fungicide, stats.Visited = -1, -1, -1
+	if app.ingressKey != "" {
+		if size, err := app.cache.IngressQueueSize(ctx, app.ingressKey); err == nil {
+			stats.Ingress = int64(size)
+		}
+	}
+	if app.fungicideKey != "" {
+		if size, err := app.cache.IngressQueueSize(ctx, app.fungicideKey); err == nil {
+			stats.Fungicide = int64(size)
+		}
+	}
+	if count, err := app.cache.VisitedCount(ctx); err == nil {
+		stats.Visited = count
+	}
+
+	stats.Paused = app.crawler.Paused()
+	workers := app.crawler.Workers()
+	stats.Workers = len(workers)
+	for _, w := range workers {
+		if w.Idle {
+			stats.IdleWorkers++
+		}
+	}
+	return stats
+}
+
+// reportProgress prints a single summary line and returns the number of
+// pages fetched so far, so the next call can compute the rate.
+func (app *Mycelium) reportProgress(ctx context.Context, interval time.Duration, lastFetched int64) int64 {
+	stats := app.collectProgress(ctx)
+	stats.PagesPerSec = float64(stats.Fetched-lastFetched) / interval.Seconds()
+
+	app.logger.Info("progress",
+		"fetched", stats.Fetched,
+		"errors", stats.FetchErrors,
+		"errorRate", fmt.Sprintf("%.1f%%", stats.ErrorRate),
+		"bytes", stats.Bytes,
+		"inFlight", stats.InFlight,
+		"pagesPerSec", fmt.Sprintf("%.2f", stats.PagesPerSec),
+		"ingress", stats.Ingress,
+		"fungicide", stats.Fungicide,
+		"visited", stats.Visited,
+		"workers", stats.Workers,
+		"idle", stats.IdleWorkers,
+		"queueLatencyP50", stats.QueueLatencyP50,
+		"queueLatencyP95", stats.QueueLatencyP95,
+		"paused", stats.Paused)
+
+	return stats.Fetched
 }
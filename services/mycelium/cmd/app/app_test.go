@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"mycelium/internal/crawler"
+)
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// newTestApp wires an app to an in-memory cache with an ingress queue.
+func newTestApp(t *testing.T, opt ...crawler.CrawlerOption) (*Mycelium, *memCache) {
+	t.Helper()
+	cache := newMemCache()
+	opt = append([]crawler.CrawlerOption{
+		crawler.WithMyceliumIngressKey("ingress"),
+		crawler.WithLogger(discardLogger),
+	}, opt...)
+	app := &Mycelium{
+		config:  MyceliumConfig{maxIdleSeconds: 60},
+		cache:   cache,
+		crawler: *crawler.NewCrawler(cache, nil, opt...),
+		logger:  discardLogger,
+	}
+	return app, cache
+}
+
+// logRecords returns a JSON logger and a function decoding every record
+// written to it so far.
+func logRecords(t *testing.T) (*slog.Logger, func() []map[string]any) {
+	t.Helper()
+	var mu sync.Mutex
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(lockedWriter{&mu, &buf}, nil))
+	return logger, func() []map[string]any {
+		mu.Lock()
+		defer mu.Unlock()
+		var records []map[string]any
+		dec := json.NewDecoder(bytes.NewReader(buf.Bytes()))
+		for dec.More() {
+			var record map[string]any
+			if err := dec.Decode(&record); err != nil {
+				t.Fatalf("malformed log record: %s", err)
+			}
+			records = append(records, record)
+		}
+		return records
+	}
+}
+
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (w lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+// waitFor polls cond until it holds or a second passes.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func runConsumeIngress(t *testing.T, app *Mycelium) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		app.consumeIngress(ctx, "approved")
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestConsumeIngressQueuesApprovedLinks(t *testing.T) {
+	app, cache := newTestApp(t)
+	cache.push("approved", `{"location": "https://example.com/a", "retries": 3}`)
+	cache.push("approved", `{"location": " https://example.org/b "}`)
+	runConsumeIngress(t, app)
+
+	waitFor(t, "approved links to be queued", func() bool { return len(cache.queue("ingress")) == 2 })
+
+	var items []crawler.IngressItem
+	for _, itemJSON := range cache.queue("ingress") {
+		var item crawler.IngressItem
+		if err := json.Unmarshal([]byte(itemJSON), &item); err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, item)
+	}
+	if items[0].Location != "https://example.com/a" || items[1].Location != "https://example.org/b" {
+		t.Errorf("queued %s and %s, want the approved links in order", items[0].Location, items[1].Location)
+	}
+	if items[0].Retries != 0 {
+		t.Errorf("retries = %d, want the count to start over", items[0].Retries)
+	}
+}
+
+func TestConsumeIngressSkipsMalformedItems(t *testing.T) {
+	app, cache := newTestApp(t)
+	for _, itemJSON := range []string{
+		`not json`,
+		`{"location": ""}`,
+		`{"location": "/relative/path"}`,
+		`{"location": "http://%zz"}`,
+	} {
+		cache.push("approved", itemJSON)
+	}
+	cache.push("approved", `{"location": "https://example.com/ok"}`)
+	runConsumeIngress(t, app)
+
+	waitFor(t, "the approved queue to drain", func() bool { return len(cache.queue("approved")) == 0 })
+	waitFor(t, "the valid link to be queued", func() bool { return len(cache.queue("ingress")) == 1 })
+	var item crawler.IngressItem
+	if err := json.Unmarshal([]byte(cache.queue("ingress")[0]), &item); err != nil {
+		t.Fatal(err)
+	}
+	if item.Location != "https://example.com/ok" || item.Retries != 0 {
+		t.Errorf("queued %+v, want only the valid link", item)
+	}
+}
+
+func TestConsumeIngressDeadLettersMalformedItems(t *testing.T) {
+	app, cache := newTestApp(t, crawler.WithDeadLetterKey("dead"))
+	cache.push("approved", `not json`)
+	runConsumeIngress(t, app)
+
+	waitFor(t, "the malformed item to be dead lettered", func() bool { return len(cache.queue("dead")) == 1 })
+	var letter crawler.DeadLetter
+	if err := json.Unmarshal([]byte(cache.queue("dead")[0]), &letter); err != nil {
+		t.Fatal(err)
+	}
+	if letter.Source != "approved" || letter.Payload != "not json" || letter.Reason == "" || letter.At == 0 {
+		t.Errorf("dead letter = %+v", letter)
+	}
+}
+
+func TestConsumeIngressDeadLettersRecordParent(t *testing.T) {
+	app, cache := newTestApp(t, crawler.WithDeadLetterKey("dead"))
+	cache.push("approved", `{"location": "/relative", "parent": "https://example.com/"}`)
+	runConsumeIngress(t, app)
+
+	waitFor(t, "the malformed item to be dead lettered", func() bool { return len(cache.queue("dead")) == 1 })
+	var letter crawler.DeadLetter
+	if err := json.Unmarshal([]byte(cache.queue("dead")[0]), &letter); err != nil {
+		t.Fatal(err)
+	}
+	if letter.Parent != "https://example.com/" {
+		t.Errorf("dead letter parent = %q, want the linking page", letter.Parent)
+	}
+}
+
+func runConsumeVerdicts(t *testing.T, app *Mycelium) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		app.consumeVerdicts(ctx, "verdicts")
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestConsumeVerdictsQueuesApprovedLinks(t *testing.T) {
+	app, cache := newTestApp(t, crawler.WithDeadLetterKey("dead"))
+	cache.push("verdicts", `{"location": "https://example.com/", "verdict": "approved", "approved_links": ["https://example.com/a", "https://example.org/b"], "depth": 1}`)
+	cache.push("verdicts", `{"location": "https://example.net/", "verdict": "rejected", "approved_links": ["https://example.net/c"]}`)
+	runConsumeVerdicts(t, app)
+
+	waitFor(t, "the verdict queue to drain", func() bool { return len(cache.queue("verdicts")) == 0 })
+	waitFor(t, "approved links to be queued", func() bool { return len(cache.queue("ingress")) == 2 })
+	for _, itemJSON := range cache.queue("ingress") {
+		var item crawler.IngressItem
+		if err := json.Unmarshal([]byte(itemJSON), &item); err != nil {
+			t.Fatal(err)
+		}
+		if item.Depth != 2 {
+			t.Errorf("%s depth = %d, want one deeper than the classified page", item.Location, item.Depth)
+		}
+	}
+	if got := cache.queue("dead"); len(got) != 0 {
+		t.Errorf("dead letters = %v, want none", got)
+	}
+}
+
+func TestConsumeVerdictsRejectsDomains(t *testing.T) {
+	app, cache := newTestApp(t)
+	app.config.rejectVerdictDomains = true
+	cache.push("verdicts", `{"location": "https://spam.test/", "verdict": "rejected"}`)
+	cache.push("verdicts", `{"location": "https://example.org/", "verdict": "approved", "approved_links": ["https://www.spam.test/a", "https://example.org/ok"]}`)
+	runConsumeVerdicts(t, app)
+
+	waitFor(t, "the approved link to be queued", func() bool { return len(cache.queue("ingress")) > 0 })
+	if got := cache.queue("ingress"); len(got) != 1 || !strings.Contains(got[0], "https://example.org/ok") {
+		t.Errorf("ingress = %v, want only the link off the rejected domain", got)
+	}
+}
+
+func TestConsumeVerdictsDeadLettersMalformedMessages(t *testing.T) {
+	app, cache := newTestApp(t, crawler.WithDeadLetterKey("dead"))
+	for _, message := range []string{`not json`, `{"verdict": "approved"}`, `{"location": "https://example.com/", "verdict": "maybe"}`} {
+		cache.push("verdicts", message)
+	}
+	runConsumeVerdicts(t, app)
+
+	waitFor(t, "malformed verdicts to be dead lettered", func() bool { return len(cache.queue("dead")) == 3 })
+	for i, letterJSON := range cache.queue("dead") {
+		var letter crawler.DeadLetter
+		if err := json.Unmarshal([]byte(letterJSON), &letter); err != nil {
+			t.Fatal(err)
+		}
+		if letter.Source != "verdict" || letter.Reason == "" {
+			t.Errorf("dead letter %d = %+v", i, letter)
+		}
+	}
+}
+
+func TestParseApprovedItem(t *testing.T) {
+	for _, itemJSON := range []string{`not json`, `{"location": ""}`, `{"location": "example.com/a"}`, `{"location": "http://%zz"}`} {
+		if _, err := parseApprovedItem(itemJSON); err == nil {
+			t.Errorf("parseApprovedItem(%s) accepted a malformed item", itemJSON)
+		}
+	}
+	item, err := parseApprovedItem(`{"location": "https://example.com/a", "retries": 2}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Location != "https://example.com/a" || item.Retries != 0 {
+		t.Errorf("parseApprovedItem = %+v", item)
+	}
+}
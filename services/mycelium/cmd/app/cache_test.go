@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"mycelium/internal/crawler"
+)
+
+// memCache is an in-memory appCache for tests. Popping an empty queue waits
+// briefly and reports no items, like the blocking redis pop timing out.
+type memCache struct {
+	mu        sync.Mutex
+	visited   map[string]bool
+	queues    map[string][]string
+	blacklist map[string]map[string]bool
+	control   map[string]string
+	pingErr   error
+}
+
+func newMemCache() *memCache {
+	return &memCache{
+		visited:   map[string]bool{},
+		queues:    map[string][]string{},
+		blacklist: map[string]map[string]bool{},
+		control:   map[string]string{},
+	}
+}
+
+func (m *memCache) Visit(_ context.Context, location string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.visited[location] = true
+	return nil
+}
+
+func (m *memCache) Unvisit(_ context.Context, location string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.visited, location)
+	return nil
+}
+
+func (m *memCache) IsVisited(_ context.Context, location string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.visited[location], nil
+}
+
+func (m *memCache) push(key string, item string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queues[key] = append(m.queues[key], item)
+}
+
+func (m *memCache) PushToFungicide(_ context.Context, item string, key string) error {
+	m.push(key, item)
+	return nil
+}
+
+func (m *memCache) PushToMyceliumIngress(_ context.Context, item string, key string) error {
+	m.push(key, item)
+	return nil
+}
+
+func (m *memCache) PushToDeadLetter(_ context.Context, item string, key string) error {
+	m.push(key, item)
+	return nil
+}
+
+func (m *memCache) PopFromMyceliumIngress(ctx context.Context, key string) (string, error) {
+	m.mu.Lock()
+	if len(m.queues[key]) > 0 {
+		item := m.queues[key][0]
+		m.queues[key] = m.queues[key][1:]
+		m.mu.Unlock()
+		return item, nil
+	}
+	m.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-time.After(5 * time.Millisecond):
+		return "", crawler.ErrQueueEmpty
+	}
+}
+
+func (m *memCache) IsBlacklisted(_ context.Context, host string, key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.blacklist[key][host], nil
+}
+
+func (m *memCache) AddToBlacklist(_ context.Context, domains []string, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.blacklist[key] == nil {
+		m.blacklist[key] = map[string]bool{}
+	}
+	for _, domain := range domains {
+		m.blacklist[key][domain] = true
+	}
+	return nil
+}
+
+func (m *memCache) IngressQueueSize(_ context.Context, key string) (int32, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return int32(len(m.queues[key])), nil
+}
+
+func (m *memCache) QueuedLocations(_ context.Context, key string) (map[string]bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	locations := map[string]bool{}
+	for _, queued := range m.queues[key] {
+		var item crawler.IngressItem
+		if json.Unmarshal([]byte(queued), &item) == nil {
+			locations[item.Location] = true
+		}
+	}
+	return locations, nil
+}
+
+func (m *memCache) ClearQueue(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.queues, key)
+	return nil
+}
+
+func (m *memCache) Ping(context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.pingErr
+}
+
+func (m *memCache) VisitedCount(context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return int64(len(m.visited)), nil
+}
+
+func (m *memCache) ControlState(_ context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.control[key], nil
+}
+
+func (m *memCache) SetControlState(_ context.Context, key string, state string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.control[key] = state
+	return nil
+}
+
+func (m *memCache) Close() error {
+	return nil
+}
+
+// queue returns a copy of the items waiting in key.
+func (m *memCache) queue(key string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.queues[key]...)
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"mycelium/internal/chooser"
+	"mycelium/internal/crawler"
+	"mycelium/internal/filter"
+)
+
+// fileConfig is the layout of the -config yaml file. The crawler section
+// accepts any command line flag by name so the file and flags never drift.
+type fileConfig struct {
+	Redis struct {
+		Addr *string `yaml:"addr"`
+		Pass *string `yaml:"pass"`
+		DB   *int    `yaml:"db"`
+		// VisitedShards splits the visited set across keys; every
+		// process sharing redis must use the same value
+		VisitedShards *int `yaml:"visitedShards"`
+	} `yaml:"redis"`
+	FilestoreOutDir *string `yaml:"filestoreOutDir"`
+	Queues          struct {
+		Fungicide     *string `yaml:"fungicide"`
+		Ingress       *string `yaml:"ingress"`
+		Blacklist     *string `yaml:"blacklist"`
+		Approved      *string `yaml:"approved"`
+		Verdict       *string `yaml:"verdict"`
+		DeadLetter    *string `yaml:"deadLetter"`
+		AutoBlacklist *string `yaml:"autoBlacklist"`
+		Control       *string `yaml:"control"`
+		Overflow      *string `yaml:"overflow"`
+		Malformed     *string `yaml:"malformed"`
+	} `yaml:"queues"`
+	Crawler map[string]interface{} `yaml:"crawler"`
+	// Domains holds per domain fetch overrides. Header values and proxies
+	// may refer to environment variables as ${VAR}, e.g. for api keys.
+	Domains map[string]struct {
+		Headers map[string]string `yaml:"headers"`
+		Timeout time.Duration     `yaml:"timeout"`
+		Rps     float64           `yaml:"rps"`
+		Proxy   string            `yaml:"proxy"`
+		// HashRoutes crawls "#/route" and "#!route" fragments as pages
+		HashRoutes bool `yaml:"hashRoutes"`
+	} `yaml:"domains"`
+}
+
+// applyConfigFile fills in settings from the yaml file at path. Values only
+// apply where no flag was given on the command line and no environment
+// variable is set, giving flags > env > file > defaults.
+func applyConfigFile(path string, conf *MyceliumConfig, env *Environment) error {
+	if path == "" {
+		return nil
+	}
+
+	configFile, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config file %s: %w", path, err)
+	}
+	defer configFile.Close()
+
+	var fc fileConfig
+	decoder := yaml.NewDecoder(configFile)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&fc); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	for name, value := range fc.Crawler {
+		if flag.Lookup(name) == nil {
+			return fmt.Errorf("crawler.%s: unknown option", name)
+		}
+		if conf.cliFlags[name] {
+			continue
+		}
+		if err := flag.Set(name, configValueString(value)); err != nil {
+			return fmt.Errorf("crawler.%s: %w", name, err)
+		}
+	}
+
+	for domain, d := range fc.Domains {
+		override := crawler.DomainOverride{
+			Headers:    map[string]string{},
+			Timeout:    d.Timeout,
+			RateLimit:  d.Rps,
+			HashRoutes: d.HashRoutes,
+		}
+		for name, value := range d.Headers {
+			expanded, err := chooser.ExpandEnv(value, conf.allowEmptyEnv)
+			if err != nil {
+				return fmt.Errorf("domains.%s.headers.%s: %w", domain, name, err)
+			}
+			override.Headers[name] = expanded
+		}
+		proxy, err := chooser.ExpandEnvInURL(d.Proxy, conf.allowEmptyEnv)
+		if err != nil {
+			return fmt.Errorf("domains.%s.proxy: %w", domain, err)
+		}
+		override.Proxy = proxy
+		if conf.domainOverrides == nil {
+			conf.domainOverrides = map[string]crawler.DomainOverride{}
+		}
+		conf.domainOverrides[domain] = override
+	}
+
+	applyEnvString(&env.RedisAddr, "REDIS_ADDR", fc.Redis.Addr)
+	applyEnvString(&env.RedisPass, "REDIS_PASS", fc.Redis.Pass)
+	if _, found := os.LookupEnv("REDIS_DB"); !found && fc.Redis.DB != nil {
+		env.RedisDB = *fc.Redis.DB
+	}
+	if _, found := os.LookupEnv("REDIS_VISITED_SHARDS"); !found && fc.Redis.VisitedShards != nil {
+		env.RedisVisitedShards = *fc.Redis.VisitedShards
+	}
+	applyEnvString(&env.FilestoreOutDir, "FILESTORE_OUT_DIR", fc.FilestoreOutDir)
+	applyEnvString(&env.FungicideQueueKey, "REDIS_FUNGICIDE_QUEUE_KEY", fc.Queues.Fungicide)
+	applyEnvString(&env.MyceliumIngressKey, "REDIS_MYCELIUM_QUEUE_KEY", fc.Queues.Ingress)
+	applyEnvString(&env.MyceliumBlacklistKey, "REDIS_MYCELIUM_BLACKLIST_KEY", fc.Queues.Blacklist)
+	applyEnvString(&env.FungicideApprovedKey, "REDIS_FUNGICIDE_APPROVED_KEY", fc.Queues.Approved)
+	applyEnvString(&env.FungicideVerdictKey, "REDIS_FUNGICIDE_VERDICT_KEY", fc.Queues.Verdict)
+	applyEnvString(&env.DeadLetterKey, "REDIS_MYCELIUM_DEADLETTER_KEY", fc.Queues.DeadLetter)
+	applyEnvString(&env.AutoBlacklistKey, "REDIS_MYCELIUM_AUTOBLACKLIST_KEY", fc.Queues.AutoBlacklist)
+	applyEnvString(&env.ControlKey, "REDIS_MYCELIUM_CONTROL_KEY", fc.Queues.Control)
+	applyEnvString(&env.OverflowKey, "REDIS_MYCELIUM_OVERFLOW_KEY", fc.Queues.Overflow)
+	applyEnvString(&env.MalformedKey, "REDIS_MYCELIUM_MALFORMED_KEY", fc.Queues.Malformed)
+
+	return nil
+}
+
+func applyEnvString(dst *string, envKey string, value *string) {
+	if _, found := os.LookupEnv(envKey); found || value == nil {
+		return
+	}
+	*dst = *value
+}
+
+// configValueString converts a yaml value to flag syntax; lists become the
+// comma separated form the list flags expect.
+func configValueString(value interface{}) string {
+	if list, ok := value.([]interface{}); ok {
+		var items []string
+		for _, item := range list {
+			items = append(items, fmt.Sprint(item))
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(value)
+}
+
+func validateConfig(conf *MyceliumConfig, env *Environment) error {
+	if conf.numCrawlers < 1 {
+		return fmt.Errorf("routines: must be at least 1, got %d", conf.numCrawlers)
+	}
+	if conf.maxCrawlers > 0 {
+		if conf.minCrawlers < 1 || conf.minCrawlers > conf.maxCrawlers {
+			return fmt.Errorf("minRoutines: must be between 1 and maxRoutines (%d), got %d", conf.maxCrawlers, conf.minCrawlers)
+		}
+		if conf.numCrawlers > conf.maxCrawlers {
+			return fmt.Errorf("routines: must not exceed maxRoutines (%d), got %d", conf.maxCrawlers, conf.numCrawlers)
+		}
+		if conf.scaleInterval < 1 {
+			return fmt.Errorf("scaleInterval: must be at least 1, got %d", conf.scaleInterval)
+		}
+	}
+	if conf.maxIdleSeconds < 0 {
+		return fmt.Errorf("maxIdleSeconds: must not be negative, got %d", conf.maxIdleSeconds)
+	}
+	if conf.proxyEpsilon < 0 || conf.proxyEpsilon > 1 {
+		return fmt.Errorf("proxyEpsilon: must be between 0 and 1, got %g", conf.proxyEpsilon)
+	}
+	for domain, override := range conf.domainOverrides {
+		if err := filter.ValidateDomainEntry(domain); err != nil || strings.Contains(domain, "*") {
+			return fmt.Errorf("domains: invalid domain %q", domain)
+		}
+		if override.Timeout < 0 {
+			return fmt.Errorf("domains.%s.timeout: must not be negative, got %s", domain, override.Timeout)
+		}
+		if override.RateLimit < 0 {
+			return fmt.Errorf("domains.%s.rps: must not be negative, got %g", domain, override.RateLimit)
+		}
+		if override.Proxy != "" {
+			if proxy, err := url.Parse(override.Proxy); err != nil || proxy.Scheme == "" || proxy.Host == "" {
+				return fmt.Errorf("domains.%s.proxy: must be a url with a scheme and host", domain)
+			}
+		}
+	}
+	for _, domain := range splitList(conf.proxyBypass) {
+		if err := filter.ValidateDomainEntry(domain); err != nil {
+			return fmt.Errorf("proxyBypass: %w", err)
+		}
+	}
+	switch crawler.SeedMode(conf.seedMode) {
+	case crawler.SeedSkip, crawler.SeedMerge:
+	case crawler.SeedReplace:
+		if !conf.confirm {
+			return fmt.Errorf("seedmode: replace clears the ingress queue, pass -yes to confirm")
+		}
+	default:
+		return fmt.Errorf("seedmode: must be skip, merge or replace, got %q", conf.seedMode)
+	}
+	if conf.maxWorkerFailures < 0 {
+		return fmt.Errorf("maxWorkerFailures: must not be negative, got %d", conf.maxWorkerFailures)
+	}
+	switch crawler.FungicideCodec(conf.fungicideCodec) {
+	case crawler.CodecJSON, crawler.CodecProto:
+	default:
+		return fmt.Errorf("fungicideCodec: must be json or proto, got %q", conf.fungicideCodec)
+	}
+	switch crawler.LinkQueueingMode(conf.linkQueueing) {
+	case crawler.LinkQueueingNone, crawler.LinkQueueingAlways, crawler.LinkQueueingOnlyWhenNoFungicide:
+	default:
+		return fmt.Errorf("linkQueueing: must be none, always or onlyWhenNoFungicide, got %q", conf.linkQueueing)
+	}
+	switch crawler.SoftErrorPolicy(conf.softErrors) {
+	case crawler.SoftErrorOff, crawler.SoftErrorMark, crawler.SoftErrorDrop:
+	default:
+		return fmt.Errorf("softErrors: must be off, mark or drop, got %q", conf.softErrors)
+	}
+	if conf.sampleRate < 0 {
+		return fmt.Errorf("sampleRate: must not be negative, got %d", conf.sampleRate)
+	}
+	if conf.sampleRate > 0 && conf.sampleDir == "" {
+		return fmt.Errorf("sampleDir: must be set when sampleRate is")
+	}
+	if conf.scriptMaxBytes < 0 {
+		return fmt.Errorf("scriptMaxBytes: must not be negative, got %d", conf.scriptMaxBytes)
+	}
+	if conf.scriptsMaxBytes < 0 {
+		return fmt.Errorf("scriptsMaxBytes: must not be negative, got %d", conf.scriptsMaxBytes)
+	}
+	if conf.fungicideMaxBytes < 0 {
+		return fmt.Errorf("fungicideMaxBytes: must not be negative, got %d", conf.fungicideMaxBytes)
+	}
+	if conf.fungicideBatch < 1 {
+		return fmt.Errorf("fungicideBatch: must be at least 1, got %d", conf.fungicideBatch)
+	}
+	if conf.fungicideBatch > 1 && conf.fungicideFlush <= 0 {
+		return fmt.Errorf("fungicideFlush: must be positive, got %s", conf.fungicideFlush)
+	}
+	if conf.maxRetries < 0 {
+		return fmt.Errorf("maxRetries: must not be negative, got %d", conf.maxRetries)
+	}
+	if conf.maxRedirects < 0 {
+		return fmt.Errorf("maxRedirects: must not be negative, got %d", conf.maxRedirects)
+	}
+	if conf.maxHostRedirects < 0 {
+		return fmt.Errorf("maxHostRedirects: must not be negative, got %d", conf.maxHostRedirects)
+	}
+	if conf.requestTimeout <= 0 {
+		return fmt.Errorf("requestTimeout: must be positive, got %s", conf.requestTimeout)
+	}
+	if conf.pageTimeout < 0 {
+		return fmt.Errorf("pageTimeout: must not be negative, got %s", conf.pageTimeout)
+	}
+	if conf.maxBodyBytes < 0 {
+		return fmt.Errorf("maxBodyBytes: must not be negative, got %d", conf.maxBodyBytes)
+	}
+	if conf.captureFailures < 0 {
+		return fmt.Errorf("captureFailures: must not be negative, got %d", conf.captureFailures)
+	}
+	if conf.captureFailureBytes < 0 {
+		return fmt.Errorf("captureFailureBytes: must not be negative, got %d", conf.captureFailureBytes)
+	}
+	if conf.bandwidthBudget < 0 {
+		return fmt.Errorf("bandwidthBudget: must not be negative, got %d", conf.bandwidthBudget)
+	}
+	if conf.maxIdleConns < 0 {
+		return fmt.Errorf("maxIdleConns: must not be negative, got %d", conf.maxIdleConns)
+	}
+	if conf.maxIdleConnsPerHost < 0 {
+		return fmt.Errorf("maxIdleConnsPerHost: must not be negative, got %d", conf.maxIdleConnsPerHost)
+	}
+	if conf.tlsSessionCache < 0 {
+		return fmt.Errorf("tlsSessionCache: must not be negative, got %d", conf.tlsSessionCache)
+	}
+	if conf.idleConnTimeout < 0 {
+		return fmt.Errorf("idleConnTimeout: must not be negative, got %s", conf.idleConnTimeout)
+	}
+	if conf.domainRps < 0 {
+		return fmt.Errorf("domainRps: must not be negative, got %g", conf.domainRps)
+	}
+	if conf.maxRps < 0 {
+		return fmt.Errorf("maxRps: must not be negative, got %g", conf.maxRps)
+	}
+	if conf.maxRpsBurst < 1 {
+		return fmt.Errorf("maxRpsBurst: must be at least 1, got %d", conf.maxRpsBurst)
+	}
+	if env.AutoBlacklistKey != "" {
+		if conf.errorBudgetRatio <= 0 || conf.errorBudgetRatio > 1 {
+			return fmt.Errorf("errorBudgetRatio: must be in (0, 1], got %g", conf.errorBudgetRatio)
+		}
+		if conf.errorBudgetSamples < 1 {
+			return fmt.Errorf("errorBudgetSamples: must be at least 1, got %d", conf.errorBudgetSamples)
+		}
+		if conf.errorBudgetWindow < time.Second {
+			return fmt.Errorf("errorBudgetWindow: must be at least 1s, got %s", conf.errorBudgetWindow)
+		}
+		if conf.autoBlacklistTTL <= 0 {
+			return fmt.Errorf("autoBlacklistTTL: must be positive, got %s", conf.autoBlacklistTTL)
+		}
+	}
+	if conf.domainBudget < 0 {
+		return fmt.Errorf("domainBudget: must not be negative, got %d", conf.domainBudget)
+	}
+	if env.OtlpEndpoint != "" {
+		if u, err := url.Parse(env.OtlpEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("otlpEndpoint: must be an http or https url, got %q", env.OtlpEndpoint)
+		}
+		if conf.traceRatio < 0 || conf.traceRatio > 1 {
+			return fmt.Errorf("traceRatio: must be between 0 and 1, got %g", conf.traceRatio)
+		}
+	}
+	if conf.lookahead < 1 {
+		return fmt.Errorf("lookahead: must be at least 1, got %d", conf.lookahead)
+	}
+	if conf.malformedMax < 1 {
+		return fmt.Errorf("malformedMax: must be at least 1, got %d", conf.malformedMax)
+	}
+	if conf.maxLinksPerPage < 0 {
+		return fmt.Errorf("maxLinksPerPage: must not be negative, got %d", conf.maxLinksPerPage)
+	}
+	switch crawler.LinkSelection(conf.linkSelection) {
+	case crawler.LinkSelectionDocument, crawler.LinkSelectionRandom:
+	default:
+		return fmt.Errorf("linkSelection: must be document or random, got %q", conf.linkSelection)
+	}
+	if conf.frontierCap < 0 {
+		return fmt.Errorf("frontierCap: must not be negative, got %d", conf.frontierCap)
+	}
+	if conf.frontierCap > 0 && env.OverflowKey != "" && conf.overflowInterval <= 0 {
+		return fmt.Errorf("overflowInterval: must be positive, got %s", conf.overflowInterval)
+	}
+	if conf.hostSlots < 0 {
+		return fmt.Errorf("hostSlots: must not be negative, got %d", conf.hostSlots)
+	}
+	if conf.hostFolding < 0 {
+		return fmt.Errorf("hostFolding: must not be negative, got %s", conf.hostFolding)
+	}
+	if conf.recrawlAfter < 0 {
+		return fmt.Errorf("recrawlAfter: must not be negative, got %s", conf.recrawlAfter)
+	}
+	if conf.recrawlAfter > 0 && conf.recrawlInterval <= 0 {
+		return fmt.Errorf("recrawlInterval: must be positive, got %s", conf.recrawlInterval)
+	}
+	if _, err := parseRecrawlDomains(conf.recrawlDomains); err != nil {
+		return fmt.Errorf("recrawlDomains: %w", err)
+	}
+	if conf.logDedupWindow < 0 {
+		return fmt.Errorf("logDedupWindow: must not be negative, got %s", conf.logDedupWindow)
+	}
+	if env.RedisDB < 0 {
+		return fmt.Errorf("redis.db: must not be negative, got %d", env.RedisDB)
+	}
+	if env.RedisVisitedShards < 0 {
+		return fmt.Errorf("redis.visitedShards: must not be negative, got %d", env.RedisVisitedShards)
+	}
+	if env.MyceliumIngressKey == "" {
+		return fmt.Errorf("queues.ingress: required (REDIS_MYCELIUM_QUEUE_KEY or -ingressQueue)")
+	}
+	return nil
+}
+
+func dumpConfig(env *Environment, logger *slog.Logger) {
+	var attrs []any
+	flag.VisitAll(func(f *flag.Flag) {
+		attrs = append(attrs, f.Name, f.Value.String())
+	})
+
+	pass := ""
+	if env.RedisPass != "" {
+		pass = "[REDACTED]"
+	}
+	attrs = append(attrs,
+		"redis.addr", env.RedisAddr,
+		"redis.pass", pass,
+		"redis.db", env.RedisDB,
+		"redis.visitedShards", env.RedisVisitedShards,
+		"filestoreOutDir", env.FilestoreOutDir,
+		"queues.fungicide", env.FungicideQueueKey,
+		"queues.ingress", env.MyceliumIngressKey,
+		"queues.blacklist", env.MyceliumBlacklistKey,
+		"queues.approved", env.FungicideApprovedKey,
+		"queues.verdict", env.FungicideVerdictKey,
+		"queues.deadLetter", env.DeadLetterKey,
+		"queues.autoBlacklist", env.AutoBlacklistKey,
+		"tracing.otlpEndpoint", env.OtlpEndpoint,
+		"queues.control", env.ControlKey,
+		"queues.overflow", env.OverflowKey,
+		"queues.malformed", env.MalformedKey,
+	)
+	logger.Info("effective configuration", attrs...)
+}
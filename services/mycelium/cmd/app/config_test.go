@@ -0,0 +1,436 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"mycelium/internal/crawler"
+)
+
+// parseTestFlags registers the command line flags on a fresh flag set and
+// parses args, restoring the real command line afterwards.
+func parseTestFlags(t *testing.T, args ...string) *MyceliumConfig {
+	t.Helper()
+	commandLine, osArgs := flag.CommandLine, os.Args
+	t.Cleanup(func() {
+		flag.CommandLine, os.Args = commandLine, osArgs
+	})
+	flag.CommandLine = flag.NewFlagSet("mycelium", flag.ContinueOnError)
+	os.Args = append([]string{"mycelium"}, args...)
+
+	var conf MyceliumConfig
+	initCliFlags(&conf)
+	return &conf
+}
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "mycelium.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// clearEnv unsets the environment variables the app reads for the test.
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, key := range []string{
+		"REDIS_ADDR", "REDIS_PASS", "REDIS_DB", "REDIS_VISITED_SHARDS", "FILESTORE_OUT_DIR",
+		"REDIS_FUNGICIDE_QUEUE_KEY", "REDIS_MYCELIUM_QUEUE_KEY",
+		"REDIS_MYCELIUM_BLACKLIST_KEY", "REDIS_FUNGICIDE_APPROVED_KEY",
+	} {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+}
+
+const testConfig = `
+redis:
+  addr: file-redis:6379
+  pass: file-secret
+  db: 2
+  visitedShards: 8
+filestoreOutDir: /data/pages
+queues:
+  ingress: file-ingress
+  fungicide: file-fungicide
+crawler:
+  routines: 3
+  maxIdleSeconds: 20
+  blockedPaths: [/admin, /login]
+  stickyagents: true
+`
+
+func TestApplyConfigFile(t *testing.T) {
+	clearEnv(t)
+	conf := parseTestFlags(t)
+
+	var env Environment
+	if err := applyConfigFile(writeConfig(t, testConfig), conf, &env); err != nil {
+		t.Fatal(err)
+	}
+
+	if conf.numCrawlers != 3 || conf.maxIdleSeconds != 20 || !conf.stickyUserAgents {
+		t.Errorf("crawler options = routines %d, maxIdleSeconds %d, stickyagents %t, want 3, 20, true",
+			conf.numCrawlers, conf.maxIdleSeconds, conf.stickyUserAgents)
+	}
+	if conf.blockedPathPrefixes != "/admin,/login" {
+		t.Errorf("blockedPaths = %q, want the list comma separated", conf.blockedPathPrefixes)
+	}
+	if env.RedisAddr != "file-redis:6379" || env.RedisPass != "file-secret" || env.RedisDB != 2 || env.RedisVisitedShards != 8 {
+		t.Errorf("redis = %s %s %d %d, want the file's settings", env.RedisAddr, env.RedisPass, env.RedisDB, env.RedisVisitedShards)
+	}
+	if env.FilestoreOutDir != "/data/pages" || env.MyceliumIngressKey != "file-ingress" || env.FungicideQueueKey != "file-fungicide" {
+		t.Errorf("env = %+v, want the file's paths and queues", env)
+	}
+	// defaults stay where the file is silent
+	if conf.shutdownGraceSeconds != 30 {
+		t.Errorf("shutdownGrace = %d, want the default 30", conf.shutdownGraceSeconds)
+	}
+}
+
+func TestApplyConfigFilePrecedence(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("REDIS_ADDR", "env-redis:6379")
+	t.Setenv("REDIS_DB", "5")
+	t.Setenv("REDIS_VISITED_SHARDS", "16")
+	t.Setenv("REDIS_MYCELIUM_QUEUE_KEY", "env-ingress")
+	conf := parseTestFlags(t, "-routines", "7")
+
+	var env Environment
+	if err := initEnvironment(&env); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfigFile(writeConfig(t, testConfig), conf, &env); err != nil {
+		t.Fatal(err)
+	}
+
+	// flags beat the file
+	if conf.numCrawlers != 7 {
+		t.Errorf("routines = %d, want 7 from the command line", conf.numCrawlers)
+	}
+	if conf.maxIdleSeconds != 20 {
+		t.Errorf("maxIdleSeconds = %d, want 20 from the file", conf.maxIdleSeconds)
+	}
+	// env beats the file
+	if env.RedisAddr != "env-redis:6379" || env.RedisDB != 5 || env.RedisVisitedShards != 16 || env.MyceliumIngressKey != "env-ingress" {
+		t.Errorf("env = %s %d %d %s, want the environment's values", env.RedisAddr, env.RedisDB, env.RedisVisitedShards, env.MyceliumIngressKey)
+	}
+	if env.RedisPass != "file-secret" {
+		t.Errorf("redis pass = %q, want the file's value where env is unset", env.RedisPass)
+	}
+}
+
+func TestApplyConfigFileQueueFlagsKeepPrecedence(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("REDIS_MYCELIUM_QUEUE_KEY", "env-ingress")
+	conf := parseTestFlags(t, "-fungicideQueue", "flag-fungicide")
+
+	var env Environment
+	if err := initEnvironment(&env); err != nil {
+		t.Fatal(err)
+	}
+	// the queue flags set through the file must not pass for command line
+	// flags and beat the environment
+	if err := applyConfigFile(writeConfig(t, `
+crawler:
+  fungicideQueue: file-fungicide
+  ingressQueue: file-ingress
+  approvedQueue: file-approved
+`), conf, &env); err != nil {
+		t.Fatal(err)
+	}
+	applyFlagOverrides(conf, &env)
+
+	if env.FungicideQueueKey != "flag-fungicide" {
+		t.Errorf("fungicide queue = %q, want the flag's", env.FungicideQueueKey)
+	}
+	if env.MyceliumIngressKey != "env-ingress" {
+		t.Errorf("ingress queue = %q, want the environment's", env.MyceliumIngressKey)
+	}
+	if env.FungicideApprovedKey != "file-approved" {
+		t.Errorf("approved queue = %q, want the file's where flag and env are unset", env.FungicideApprovedKey)
+	}
+}
+
+func TestApplyConfigFileDomains(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("PARTNER_KEY", "s3cret")
+	conf := parseTestFlags(t)
+
+	content := `
+domains:
+  partner.example.com:
+    headers:
+      X-Api-Key: ${PARTNER_KEY}
+    proxy: http://partner-proxy.test:3128
+  slow.example.org:
+    timeout: 45s
+    rps: 0.5
+  spa.example.net:
+    hashRoutes: true
+`
+	var env Environment
+	if err := applyConfigFile(writeConfig(t, content), conf, &env); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]crawler.DomainOverride{
+		"partner.example.com": {Headers: map[string]string{"X-Api-Key": "s3cret"}, Proxy: "http://partner-proxy.test:3128"},
+		"slow.example.org":    {Headers: map[string]string{}, Timeout: 45 * time.Second, RateLimit: 0.5},
+		"spa.example.net":     {Headers: map[string]string{}, HashRoutes: true},
+	}
+	if !reflect.DeepEqual(conf.domainOverrides, want) {
+		t.Errorf("domain overrides = %+v, want %+v", conf.domainOverrides, want)
+	}
+}
+
+func TestApplyConfigFileErrorsNameField(t *testing.T) {
+	clearEnv(t)
+
+	tests := []struct {
+		content string
+		field   string
+	}{
+		{"crawler:\n  bogus: 1\n", "crawler.bogus"},
+		{"crawler:\n  routines: many\n", "crawler.routines"},
+		{"crawler:\n  stickyagents: maybe\n", "crawler.stickyagents"},
+		{"redis:\n  host: localhost\n", "host"},
+		{"redis:\n  db: zero\n", "zero"},
+		{"domains:\n  a.example:\n    headers:\n      X-Key: ${UNSET_KEY}\n", "domains.a.example.headers.X-Key"},
+		{"domains:\n  a.example:\n    timeout: soon\n", "soon"},
+	}
+	for _, tt := range tests {
+		conf := parseTestFlags(t)
+		var env Environment
+		err := applyConfigFile(writeConfig(t, tt.content), conf, &env)
+		if err == nil {
+			t.Errorf("config %q accepted", tt.content)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.field) {
+			t.Errorf("error %q does not name %s", err, tt.field)
+		}
+	}
+
+	if err := applyConfigFile(filepath.Join(t.TempDir(), "missing.yaml"), &MyceliumConfig{}, &Environment{}); err == nil {
+		t.Error("missing config file accepted")
+	}
+}
+
+// autoBlacklist enables the domain error budget with valid settings.
+func autoBlacklist(c *MyceliumConfig, e *Environment) {
+	e.AutoBlacklistKey = "autoblacklist"
+	c.errorBudgetRatio, c.errorBudgetSamples = 0.5, 20
+	c.errorBudgetWindow, c.autoBlacklistTTL = time.Minute, time.Hour
+}
+
+func TestValidateConfig(t *testing.T) {
+	valid := func() (*MyceliumConfig, *Environment) {
+		return &MyceliumConfig{numCrawlers: 1, proxyEpsilon: 0.1, seedMode: "skip", requestTimeout: time.Second, maxRpsBurst: 1, fungicideCodec: "json", fungicideBatch: 1, linkQueueing: "onlyWhenNoFungicide", softErrors: "drop", lookahead: 1, malformedMax: 1, linkSelection: "document"},
+			&Environment{RedisAddr: "localhost:6379", MyceliumIngressKey: "ingress"}
+	}
+	if err := validateConfig(valid()); err != nil {
+		t.Fatalf("valid config rejected: %s", err)
+	}
+
+	tests := []struct {
+		field  string
+		modify func(*MyceliumConfig, *Environment)
+	}{
+		{"routines", func(c *MyceliumConfig, _ *Environment) { c.numCrawlers = 0 }},
+		{"minRoutines", func(c *MyceliumConfig, _ *Environment) { c.maxCrawlers, c.scaleInterval = 4, 1 }},
+		{"minRoutines", func(c *MyceliumConfig, _ *Environment) { c.minCrawlers, c.maxCrawlers, c.scaleInterval = 5, 4, 1 }},
+		{"routines", func(c *MyceliumConfig, _ *Environment) {
+			c.numCrawlers, c.minCrawlers, c.maxCrawlers, c.scaleInterval = 5, 1, 4, 1
+		}},
+		{"scaleInterval", func(c *MyceliumConfig, _ *Environment) { c.minCrawlers, c.maxCrawlers = 1, 4 }},
+		{"maxIdleSeconds", func(c *MyceliumConfig, _ *Environment) { c.maxIdleSeconds = -1 }},
+		{"proxyEpsilon", func(c *MyceliumConfig, _ *Environment) { c.proxyEpsilon = 1.5 }},
+		{"proxyBypass", func(c *MyceliumConfig, _ *Environment) { c.proxyBypass = "internal.example,*.co.uk" }},
+		{"domains", func(c *MyceliumConfig, _ *Environment) {
+			c.domainOverrides = map[string]crawler.DomainOverride{"*.example.com": {}}
+		}},
+		{"domains.example.com.timeout", func(c *MyceliumConfig, _ *Environment) {
+			c.domainOverrides = map[string]crawler.DomainOverride{"example.com": {Timeout: -time.Second}}
+		}},
+		{"domains.example.com.rps", func(c *MyceliumConfig, _ *Environment) {
+			c.domainOverrides = map[string]crawler.DomainOverride{"example.com": {RateLimit: -1}}
+		}},
+		{"domains.example.com.proxy", func(c *MyceliumConfig, _ *Environment) {
+			c.domainOverrides = map[string]crawler.DomainOverride{"example.com": {Proxy: "proxy.test:3128"}}
+		}},
+		{"seedmode", func(c *MyceliumConfig, _ *Environment) { c.seedMode = "append" }},
+		{"seedmode", func(c *MyceliumConfig, _ *Environment) { c.seedMode = "replace" }},
+		{"maxWorkerFailures", func(c *MyceliumConfig, _ *Environment) { c.maxWorkerFailures = -1 }},
+		{"fungicideCodec", func(c *MyceliumConfig, _ *Environment) { c.fungicideCodec = "xml" }},
+		{"linkQueueing", func(c *MyceliumConfig, _ *Environment) { c.linkQueueing = "sometimes" }},
+		{"softErrors", func(c *MyceliumConfig, _ *Environment) { c.softErrors = "hide" }},
+		{"scriptMaxBytes", func(c *MyceliumConfig, _ *Environment) { c.scriptMaxBytes = -1 }},
+		{"scriptsMaxBytes", func(c *MyceliumConfig, _ *Environment) { c.scriptsMaxBytes = -1 }},
+		{"sampleRate", func(c *MyceliumConfig, _ *Environment) { c.sampleRate = -1 }},
+		{"sampleDir", func(c *MyceliumConfig, _ *Environment) { c.sampleRate, c.sampleDir = 10, "" }},
+		{"hostFolding", func(c *MyceliumConfig, _ *Environment) { c.hostFolding = -time.Hour }},
+		{"fungicideMaxBytes", func(c *MyceliumConfig, _ *Environment) { c.fungicideMaxBytes = -1 }},
+		{"fungicideBatch", func(c *MyceliumConfig, _ *Environment) { c.fungicideBatch = 0 }},
+		{"fungicideFlush", func(c *MyceliumConfig, _ *Environment) { c.fungicideBatch = 10; c.fungicideFlush = 0 }},
+		{"maxLinksPerPage", func(c *MyceliumConfig, _ *Environment) { c.maxLinksPerPage = -1 }},
+		{"linkSelection", func(c *MyceliumConfig, _ *Environment) { c.linkSelection = "first" }},
+		{"frontierCap", func(c *MyceliumConfig, _ *Environment) { c.frontierCap = -1 }},
+		{"overflowInterval", func(c *MyceliumConfig, e *Environment) { c.frontierCap, e.OverflowKey = 10, "overflow" }},
+		{"lookahead", func(c *MyceliumConfig, _ *Environment) { c.lookahead = 0 }},
+		{"malformedMax", func(c *MyceliumConfig, _ *Environment) { c.malformedMax = 0 }},
+		{"maxRetries", func(c *MyceliumConfig, _ *Environment) { c.maxRetries = -1 }},
+		{"recrawlAfter", func(c *MyceliumConfig, _ *Environment) { c.recrawlAfter = -time.Hour }},
+		{"recrawlInterval", func(c *MyceliumConfig, _ *Environment) { c.recrawlAfter = time.Hour }},
+		{"recrawlDomains", func(c *MyceliumConfig, _ *Environment) { c.recrawlDomains = "news.example.com" }},
+		{"errorBudgetRatio", func(c *MyceliumConfig, e *Environment) { autoBlacklist(c, e); c.errorBudgetRatio = 1.5 }},
+		{"errorBudgetSamples", func(c *MyceliumConfig, e *Environment) { autoBlacklist(c, e); c.errorBudgetSamples = 0 }},
+		{"errorBudgetWindow", func(c *MyceliumConfig, e *Environment) { autoBlacklist(c, e); c.errorBudgetWindow = time.Millisecond }},
+		{"domainBudget", func(c *MyceliumConfig, _ *Environment) { c.domainBudget = -1 }},
+		{"hostSlots", func(c *MyceliumConfig, _ *Environment) { c.hostSlots = -1 }},
+		{"otlpEndpoint", func(_ *MyceliumConfig, e *Environment) { e.OtlpEndpoint = "localhost:4318" }},
+		{"traceRatio", func(c *MyceliumConfig, e *Environment) { e.OtlpEndpoint = "http://localhost:4318"; c.traceRatio = 2 }},
+		{"logDedupWindow", func(c *MyceliumConfig, _ *Environment) { c.logDedupWindow = -time.Second }},
+		{"autoBlacklistTTL", func(c *MyceliumConfig, e *Environment) { autoBlacklist(c, e); c.autoBlacklistTTL = 0 }},
+		{"requestTimeout", func(c *MyceliumConfig, _ *Environment) { c.requestTimeout = 0 }},
+		{"bandwidthBudget", func(c *MyceliumConfig, _ *Environment) { c.bandwidthBudget = -1 }},
+		{"captureFailures", func(c *MyceliumConfig, _ *Environment) { c.captureFailures = -1 }},
+		{"captureFailureBytes", func(c *MyceliumConfig, _ *Environment) { c.captureFailureBytes = -1 }},
+		{"maxRedirects", func(c *MyceliumConfig, _ *Environment) { c.maxRedirects = -1 }},
+		{"maxHostRedirects", func(c *MyceliumConfig, _ *Environment) { c.maxHostRedirects = -1 }},
+		{"domainRps", func(c *MyceliumConfig, _ *Environment) { c.domainRps = -2 }},
+		{"maxRps", func(c *MyceliumConfig, _ *Environment) { c.maxRps = -1 }},
+		{"maxRpsBurst", func(c *MyceliumConfig, _ *Environment) { c.maxRpsBurst = 0 }},
+		{"redis.db", func(_ *MyceliumConfig, e *Environment) { e.RedisDB = -1 }},
+		{"redis.visitedShards", func(_ *MyceliumConfig, e *Environment) { e.RedisVisitedShards = -1 }},
+		{"queues.ingress", func(_ *MyceliumConfig, e *Environment) { e.MyceliumIngressKey = "" }},
+	}
+	for _, tt := range tests {
+		conf, env := valid()
+		tt.modify(conf, env)
+		if err := validateConfig(conf, env); err == nil || !strings.HasPrefix(err.Error(), tt.field+":") {
+			t.Errorf("validateConfig error = %v, want one naming %s", err, tt.field)
+		}
+	}
+
+	conf, env := valid()
+	conf.seedMode, conf.confirm = "replace", true
+	if err := validateConfig(conf, env); err != nil {
+		t.Errorf("confirmed replace seeding rejected: %s", err)
+	}
+
+	conf, env = valid()
+	autoBlacklist(conf, env)
+	if err := validateConfig(conf, env); err != nil {
+		t.Errorf("valid error budget rejected: %s", err)
+	}
+}
+
+func TestDumpConfigRedactsSecrets(t *testing.T) {
+	parseTestFlags(t)
+	env := Environment{RedisAddr: "localhost:6379", RedisPass: "hunter2", MyceliumIngressKey: "ingress"}
+
+	var buf bytes.Buffer
+	dumpConfig(&env, slog.New(slog.NewTextHandler(&buf, nil)))
+
+	out := buf.String()
+	if strings.Contains(out, "hunter2") {
+		t.Errorf("config dump leaks the redis password:\n%s", out)
+	}
+	for _, want := range []string{"redis.pass=[REDACTED]", "redis.addr=localhost:6379", "routines=1"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("config dump missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestApplyFlagOverrides(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  Environment
+		want Environment
+	}{
+		{
+			name: "defaults fill optional settings",
+			env:  Environment{MyceliumIngressKey: "env-ingress"},
+			want: Environment{RedisAddr: defaultRedisAddr, FilestoreOutDir: defaultFilestoreOutDir, MyceliumIngressKey: "env-ingress", ControlKey: defaultControlKey},
+		},
+		{
+			name: "environment kept without flags",
+			env:  Environment{RedisAddr: "redis:6379", FilestoreOutDir: "/pages", FungicideQueueKey: "env-fungicide", MyceliumIngressKey: "env-ingress", MyceliumBlacklistKey: "env-blacklist", FungicideApprovedKey: "env-approved"},
+			want: Environment{RedisAddr: "redis:6379", FilestoreOutDir: "/pages", FungicideQueueKey: "env-fungicide", MyceliumIngressKey: "env-ingress", MyceliumBlacklistKey: "env-blacklist", FungicideApprovedKey: "env-approved", ControlKey: defaultControlKey},
+		},
+		{
+			name: "flags beat the environment",
+			args: []string{"-fungicideQueue", "flag-fungicide", "-ingressQueue", "flag-ingress", "-blacklistKey", "flag-blacklist", "-approvedQueue", "flag-approved"},
+			env:  Environment{RedisAddr: "redis:6379", FilestoreOutDir: "/pages", FungicideQueueKey: "env-fungicide", MyceliumIngressKey: "env-ingress", MyceliumBlacklistKey: "env-blacklist", FungicideApprovedKey: "env-approved"},
+			want: Environment{RedisAddr: "redis:6379", FilestoreOutDir: "/pages", FungicideQueueKey: "flag-fungicide", MyceliumIngressKey: "flag-ingress", MyceliumBlacklistKey: "flag-blacklist", FungicideApprovedKey: "flag-approved", ControlKey: defaultControlKey},
+		},
+		{
+			name: "verdict and dead letter queues",
+			args: []string{"-verdictQueue", "flag-verdict", "-deadLetterQueue", "flag-dead"},
+			env:  Environment{RedisAddr: "redis:6379", FilestoreOutDir: "/pages", MyceliumIngressKey: "env-ingress", DeadLetterKey: "env-dead"},
+			want: Environment{RedisAddr: "redis:6379", FilestoreOutDir: "/pages", MyceliumIngressKey: "env-ingress", FungicideVerdictKey: "flag-verdict", DeadLetterKey: "flag-dead", ControlKey: defaultControlKey},
+		},
+		{
+			name: "control key flag",
+			args: []string{"-controlKey", "flag-control"},
+			env:  Environment{RedisAddr: "redis:6379", FilestoreOutDir: "/pages", MyceliumIngressKey: "env-ingress", ControlKey: "env-control"},
+			want: Environment{RedisAddr: "redis:6379", FilestoreOutDir: "/pages", MyceliumIngressKey: "env-ingress", ControlKey: "flag-control"},
+		},
+		{
+			name: "an empty flag clears an optional key",
+			args: []string{"-fungicideQueue="},
+			env:  Environment{RedisAddr: "redis:6379", FilestoreOutDir: "/pages", FungicideQueueKey: "env-fungicide", MyceliumIngressKey: "env-ingress"},
+			want: Environment{RedisAddr: "redis:6379", FilestoreOutDir: "/pages", MyceliumIngressKey: "env-ingress", ControlKey: defaultControlKey},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := parseTestFlags(t, tt.args...)
+			env := tt.env
+			applyFlagOverrides(conf, &env)
+			if env != tt.want {
+				t.Errorf("env = %+v, want %+v", env, tt.want)
+			}
+		})
+	}
+}
+
+func TestInitEnvironmentDefaults(t *testing.T) {
+	tests := []struct {
+		name    string
+		redisDB string
+		want    int
+		wantErr bool
+	}{
+		{"unset", "", 0, false},
+		{"set", "4", 4, false},
+		{"invalid", "four", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			if tt.redisDB != "" {
+				t.Setenv("REDIS_DB", tt.redisDB)
+			}
+			var env Environment
+			err := initEnvironment(&env)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("initEnvironment error = %v, want error %t", err, tt.wantErr)
+			}
+			if env.RedisDB != tt.want {
+				t.Errorf("redis db = %d, want %d", env.RedisDB, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+func (app *Mycelium) handleDiagnostics(ctx context.Context) {
+	sigusr1 := make(chan os.Signal, 1)
+	signal.Notify(sigusr1, syscall.SIGUSR1)
+	defer signal.Stop(sigusr1)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigusr1:
+			app.dumpDiagnostics(ctx)
+		}
+	}
+}
+
+// dumpDiagnostics logs a snapshot of what every worker is doing along with
+// limiter and queue state. It only reads state that is safe to access
+// concurrently, so it can be triggered at any time.
+func (app *Mycelium) dumpDiagnostics(ctx context.Context) {
+	now := time.Now()
+	for _, w := range app.crawler.Workers() {
+		if w.Idle {
+			app.logger.Info("diagnostics worker", "worker", w.ID, "idle", true, "for", now.Sub(w.Since).Round(time.Millisecond))
+		} else {
+			app.logger.Info("diagnostics worker", "worker", w.ID, "url", w.Location, "for", now.Sub(w.Since).Round(time.Millisecond))
+		}
+	}
+
+	stats := app.collectProgress(ctx)
+	app.logger.Info("diagnostics",
+		"goroutines", runtime.NumGoroutine(),
+		"workers", stats.Workers,
+		"idleWorkers", stats.IdleWorkers,
+		"targetWorkers", app.workers.size(),
+		"rateLimitedDomains", app.crawler.RateLimitedDomains(),
+		"fetched", stats.Fetched,
+		"fetchErrors", stats.FetchErrors,
+		"ingress", stats.Ingress,
+		"fungicide", stats.Fungicide,
+		"visited", stats.Visited)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"mycelium/internal/crawler"
+)
+
+func TestDumpDiagnostics(t *testing.T) {
+	release := make(chan struct{})
+	fetching := make(chan struct{}, 1)
+	srv := newBlockingServer(t, fetching, release)
+
+	app, cache := newTestApp(t, crawler.WithDomainRateLimit(0.1))
+	app.ingressKey = "ingress"
+	app.metrics = crawler.NewCounterMetrics()
+	app.metrics.Incr(crawler.MetricPagesFetched, 4)
+	logger, records := logRecords(t)
+	app.logger = logger
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app.workers = newWorkerPool(ctx, app.runCrawler, discardLogger)
+	cache.push("ingress", fmt.Sprintf(`{"location":"%s/slow"}`, srv))
+	app.workers.scale(2)
+	<-fetching
+	waitFor(t, "the second worker to idle", func() bool { return len(app.crawler.Workers()) == 2 })
+
+	app.dumpDiagnostics(context.Background())
+	close(release)
+
+	var busy, idle, summary map[string]any
+	for _, record := range records() {
+		switch {
+		case record["msg"] == "diagnostics":
+			summary = record
+		case record["msg"] == "diagnostics worker" && record["idle"] == true:
+			idle = record
+		case record["msg"] == "diagnostics worker":
+			busy = record
+		}
+	}
+	if busy == nil || busy["url"] != srv+"/slow" || busy["for"] == nil {
+		t.Errorf("busy worker record = %v, want its url and how long it has been on it", busy)
+	}
+	if idle == nil || idle["for"] == nil {
+		t.Errorf("idle worker record = %v", idle)
+	}
+	if summary == nil {
+		t.Fatal("no diagnostics summary logged")
+	}
+	for key, want := range map[string]any{
+		"workers":            float64(2),
+		"idleWorkers":        float64(1),
+		"targetWorkers":      float64(2),
+		"rateLimitedDomains": float64(1),
+		"fetched":            float64(4),
+		"ingress":            float64(0),
+	} {
+		if summary[key] != want {
+			t.Errorf("diagnostics %s = %v, want %v", key, summary[key], want)
+		}
+	}
+	if n, _ := summary["goroutines"].(float64); n < 1 {
+		t.Errorf("diagnostics goroutines = %v", summary["goroutines"])
+	}
+}
+
+// TestDumpDiagnosticsUnderLoad triggers dumps repeatedly while workers churn
+// through a queue. Run it with -race.
+func TestDumpDiagnosticsUnderLoad(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<html><head><title>%s</title></head></html>", r.URL.Path)
+	}))
+	defer srv.Close()
+	app, cache := newTestApp(t)
+	app.ingressKey = "ingress"
+	app.metrics = crawler.NewCounterMetrics()
+	for i := 0; i < 50; i++ {
+		cache.push("ingress", fmt.Sprintf(`{"location":"%s/page/%d"}`, srv.URL, i))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app.workers = newWorkerPool(ctx, app.runCrawler, discardLogger)
+	app.workers.scale(4)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				app.dumpDiagnostics(ctx)
+				time.Sleep(time.Millisecond)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -2,48 +2,262 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
 	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+	"mycelium/internal/cache"
 	"mycelium/internal/chooser"
+	"mycelium/internal/crawler"
+	"mycelium/internal/filter"
+)
+
+const (
+	defaultRedisAddr       = "localhost:6379"
+	defaultFilestoreOutDir = "out"
+	recrawlBatch           = 1000
+	delayedBatch           = 1000
+	delayedInterval        = 30 * time.Second
+	defaultControlKey      = "mycelium:control"
 )
 
 func initCliFlags(conf *MyceliumConfig) {
-	flag.StringVar(&conf.seedFile, "seedfile", "", "newline delimited list of seed urls")
+	flag.BoolVar(&conf.printVersion, "version", false, "print version information and exit")
+	flag.StringVar(&conf.configFile, "config", "", "yaml config file, overridden by environment variables and flags")
+	flag.StringVar(&conf.seedFile, "seedfile", "", "seed urls, one per line as \"url [priority [maxDepth]]\" or JSON (- reads stdin)")
+	flag.Var(&conf.seedUrls, "seedurl", "seed url, may be repeated")
+	flag.StringVar(&conf.seedMode, "seedmode", string(crawler.SeedSkip), "how to seed a non-empty ingress queue (skip, merge, replace)")
+	flag.BoolVar(&conf.confirm, "yes", false, "confirm destructive options such as -seedmode=replace")
 	flag.StringVar(&conf.agentsFile, "agentsfile", "", "user agents json")
 	flag.StringVar(&conf.proxyFile, "proxyfile", "", "proxy list json")
+	flag.StringVar(&conf.proxyStrategy, "proxystrategy", string(chooser.RoundRobin), "proxy selection strategy (roundrobin, random, weighted, latency)")
+	flag.Float64Var(&conf.proxyEpsilon, "proxyEpsilon", 0.1, "fraction of picks that explore a random proxy with the latency strategy")
+	flag.BoolVar(&conf.allowEmptyEnv, "allowEmptyEnv", false, "expand unset ${VAR} placeholders in the proxy, agents and config files to the empty string instead of failing")
+	flag.StringVar(&conf.proxyBypass, "proxyBypass", "", "comma separated list of domains fetched without a proxy (default NO_PROXY)")
+	flag.BoolVar(&conf.noRotateUserAgents, "norotate", false, "always use the first user agent instead of rotating (for debugging)")
+	flag.BoolVar(&conf.stickyUserAgents, "stickyagents", false, "reuse the same user agent for every request to a domain")
 	flag.StringVar(&conf.domainBlacklistFile, "domainsblacklist", "", "newline delimited list of blacklisted domains")
+	flag.BoolVar(&conf.pushBlacklist, "pushBlacklist", false, "push domains added to the blacklist file on reload into the shared redis blacklist")
+	flag.StringVar(&conf.blockedExtensions, "blockedExtensions", strings.Join(filter.DefaultBlockedExtensions, ","), "comma separated list of file extensions to skip (empty disables)")
+	flag.StringVar(&conf.blockedPathPrefixes, "blockedPaths", "", "comma separated list of url path prefixes to skip")
+	flag.StringVar(&conf.strippedParams, "stripParams", strings.Join(filter.DefaultStrippedParams, ","), "comma separated list of query parameters to strip from urls, trailing * matches a prefix (empty disables)")
+	flag.StringVar(&conf.rewriteFile, "rewritefile", "", "url rewrite rules applied before visited checks and link queueing")
+	flag.StringVar(&conf.allowedSchemes, "allowedSchemes", strings.Join(filter.DefaultAllowedSchemes, ","), "comma separated list of url schemes to crawl (empty allows all)")
+	flag.StringVar(&conf.allowedPorts, "allowedPorts", "", "comma separated list of non-default ports to crawl")
+	flag.BoolVar(&conf.blockIPLiterals, "blockIPs", true, "skip urls whose host is a bare ip address")
+	flag.BoolVar(&conf.trapFilter, "trapfilter", true, "skip urls that look like crawler traps")
+	flag.IntVar(&conf.maxUrlLength, "maxUrlLength", filter.DefaultMaxUrlLength, "max url length before the trap filter blocks it")
+	flag.IntVar(&conf.maxSegmentRepeats, "maxSegmentRepeats", filter.DefaultMaxSegmentRepeats, "max times a path segment may repeat before the trap filter blocks it")
+	flag.IntVar(&conf.maxQueryParams, "maxQueryParams", filter.DefaultMaxQueryParams, "max query parameters before the trap filter blocks it")
+	flag.IntVar(&conf.minWords, "minWords", 0, "drop pages with fewer content words than this (0 disables)")
+	flag.StringVar(&conf.titleBlockPattern, "titleBlockPattern", "", "drop pages whose title matches this regular expression")
+	flag.BoolVar(&conf.queueDroppedLinks, "queueDroppedLinks", true, "queue the links of pages dropped by page filters")
+	flag.StringVar(&conf.linkQueueing, "linkQueueing", string(crawler.LinkQueueingOnlyWhenNoFungicide), "when to queue extracted links (none, always, onlyWhenNoFungicide)")
+	flag.StringVar(&conf.softErrors, "softErrors", string(crawler.SoftErrorDrop), "what to do with pages that look like a 404 despite a success status (off, mark, drop)")
+	flag.IntVar(&conf.scriptMaxBytes, "scriptMaxBytes", crawler.DefaultScriptPolicy.MaxBytes, "skip inline scripts larger than this many bytes (0 is unlimited)")
+	flag.IntVar(&conf.scriptsMaxBytes, "scriptsMaxBytes", crawler.DefaultScriptPolicy.MaxTotalBytes, "inline script bytes kept per page (0 is unlimited)")
+	flag.BoolVar(&conf.keepMinifiedScripts, "keepMinifiedScripts", false, "keep inline scripts that look like minified bundles")
+	flag.BoolVar(&conf.cacheBusting, "cacheBusting", false, "ask caching proxies to revalidate every page instead of serving a stored copy")
+	flag.IntVar(&conf.sampleRate, "sampleRate", 0, "copy 1 in this many kept pages to sampleDir for review, chosen by url hash (0 disables)")
+	flag.StringVar(&conf.sampleDir, "sampleDir", "samples", "directory for sampled pages")
+	flag.BoolVar(&conf.hashRoutes, "hashRoutes", false, "crawl \"#/route\" and \"#!route\" fragments of single page apps as pages of their own instead of stripping them")
+	flag.DurationVar(&conf.hostFolding, "hostFolding", 0, "crawl the www and apex hosts of a domain as the variant it redirects or canonicalizes to, remembering it this long (0 disables)")
+	flag.BoolVar(&conf.verifyExternalLinks, "verifyExternalLinks", false, "HEAD check links that leave their seed's domain instead of queueing them, storing the results")
 	flag.IntVar(&conf.numCrawlers, "routines", 1, "number of crawler routines to spawn")
+	flag.IntVar(&conf.minCrawlers, "minRoutines", 1, "lower bound on crawler routines when autoscaling")
+	flag.IntVar(&conf.maxCrawlers, "maxRoutines", 0, "upper bound on crawler routines, enables autoscaling from queue depth (0 disables)")
+	flag.IntVar(&conf.scaleUpDepth, "scaleUpDepth", 1000, "ingress queue depth above which autoscaling adds routines")
+	flag.IntVar(&conf.scaleInterval, "scaleInterval", 30, "seconds between autoscaling checks")
 	flag.IntVar(&conf.maxIdleSeconds, "maxIdleSeconds", 100, "max seconds to wait for queue items before crawler exits")
+	flag.IntVar(&conf.shutdownGraceSeconds, "shutdownGrace", 30, "seconds to wait for crawlers to finish after a shutdown signal")
+	flag.IntVar(&conf.statsInterval, "statsInterval", 60, "seconds between periodic stats reports (0 disables)")
+	flag.StringVar(&conf.fungicideQueueKey, "fungicideQueue", "", "redis key of the fungicide queue (default $REDIS_FUNGICIDE_QUEUE_KEY)")
+	flag.StringVar(&conf.ingressQueueKey, "ingressQueue", "", "redis key of the mycelium ingress queue (default $REDIS_MYCELIUM_QUEUE_KEY)")
+	flag.StringVar(&conf.blacklistKey, "blacklistKey", "", "redis key of the shared domain blacklist (default $REDIS_MYCELIUM_BLACKLIST_KEY)")
+	flag.StringVar(&conf.approvedQueueKey, "approvedQueue", "", "redis key of the fungicide approved links queue (default $REDIS_FUNGICIDE_APPROVED_KEY)")
+	flag.StringVar(&conf.verdictQueueKey, "verdictQueue", "", "redis key of the fungicide verdict queue (default $REDIS_FUNGICIDE_VERDICT_KEY)")
+	flag.StringVar(&conf.deadLetterQueueKey, "deadLetterQueue", "", "redis key for messages that could not be processed (default $REDIS_MYCELIUM_DEADLETTER_KEY)")
+	flag.StringVar(&conf.malformedQueueKey, "malformedQueue", "", "redis key for ingress items that fail to parse (default $REDIS_MYCELIUM_MALFORMED_KEY)")
+	flag.IntVar(&conf.malformedMax, "malformedMax", 10000, "newest malformed ingress items kept for inspection")
+	flag.BoolVar(&conf.rejectVerdictDomains, "rejectVerdictDomains", false, "skip the domains of pages fungicide rejected for the rest of the run")
+	flag.StringVar(&conf.controlKey, "controlKey", "", "redis key of the fleet control state used to pause crawling (default $REDIS_MYCELIUM_CONTROL_KEY or "+defaultControlKey+")")
+	flag.StringVar(&conf.autoBlacklistKey, "autoBlacklistKey", "", "redis key of the crawler managed auto blacklist, enables the domain error budget (default $REDIS_MYCELIUM_AUTOBLACKLIST_KEY)")
+	flag.Float64Var(&conf.errorBudgetRatio, "errorBudgetRatio", 0.8, "share of failed fetches that auto blacklists a domain")
+	flag.IntVar(&conf.errorBudgetSamples, "errorBudgetSamples", 20, "fetches within the window before a domain can be auto blacklisted")
+	flag.DurationVar(&conf.errorBudgetWindow, "errorBudgetWindow", 10*time.Minute, "sliding window for the domain error budget")
+	flag.DurationVar(&conf.autoBlacklistTTL, "autoBlacklistTTL", 24*time.Hour, "how long an auto blacklisted domain is skipped")
+	flag.IntVar(&conf.domainBudget, "domainBudget", 0, "most pages crawled per registrable domain in a run, shared by all crawlers (0 is unlimited)")
+	flag.IntVar(&conf.lookahead, "lookahead", 1, "items each crawler buffers to interleave hosts and skip rate limited domains")
+	flag.BoolVar(&conf.feedParsing, "feedParsing", false, "crawl RSS and Atom feeds and queue the entries they link to")
+	flag.IntVar(&conf.maxLinksPerPage, "maxLinksPerPage", 0, "most links queued from a single page (0 is unlimited)")
+	flag.StringVar(&conf.linkSelection, "linkSelection", string(crawler.LinkSelectionDocument), "which links to keep when a page exceeds maxLinksPerPage (document, random)")
+	flag.IntVar(&conf.frontierCap, "frontierCap", 0, "stop queueing links once the ingress queue holds this many items (0 is unlimited)")
+	flag.StringVar(&conf.overflowQueueKey, "overflowQueue", "", "redis key that holds links refused by the frontier cap, dropped if unset (default $REDIS_MYCELIUM_OVERFLOW_KEY)")
+	flag.DurationVar(&conf.overflowInterval, "overflowInterval", 30*time.Second, "how often to move overflow links back to the ingress queue")
+	flag.IntVar(&conf.hostSlots, "hostSlots", 0, "most requests in flight to a host across every crawler sharing redis (0 is unlimited)")
+	flag.DurationVar(&conf.recrawlAfter, "recrawlAfter", 0, "crawl pages again once they are this old (0 disables recrawling)")
+	flag.StringVar(&conf.recrawlDomains, "recrawlDomains", "", "comma separated domain=duration recrawl overrides (e.g. news.example.com=1h)")
+	flag.DurationVar(&conf.recrawlInterval, "recrawlInterval", time.Minute, "how often to queue pages that are due for a recrawl")
+	flag.BoolVar(&conf.changeDetection, "changeDetection", false, "skip recrawled pages whose content hashes the same as last time")
+	flag.StringVar(&conf.fungicideCodec, "fungicideCodec", string(crawler.CodecJSON), "encoding of pages pushed to fungicide (json, proto)")
+	flag.BoolVar(&conf.fungicideEnvelope, "fungicideEnvelope", false, "wrap pages pushed to fungicide in a versioned envelope")
+	flag.StringVar(&conf.crawlerID, "crawlerId", "", "crawler id recorded in fungicide envelopes (default hostname-pid)")
+	flag.StringVar(&conf.sessionID, "sessionId", "", "id of this crawl run, stamped on seeded items and fetched pages (default generated)")
+	flag.IntVar(&conf.fungicideMaxBytes, "fungicideMaxBytes", 2<<20, "trim pages pushed to fungicide down to this many bytes (0 disables)")
+	flag.IntVar(&conf.fungicideBatch, "fungicideBatch", 1, "pages pushed to fungicide per batch (1 pushes every page immediately)")
+	flag.DurationVar(&conf.fungicideFlush, "fungicideFlush", 500*time.Millisecond, "longest a page waits in a partial fungicide batch")
+	flag.StringVar(&conf.fungicideSpoolDir, "fungicideSpoolDir", "spool", "directory for fungicide batches that failed to push")
+	flag.IntVar(&conf.maxRetries, "maxRetries", 3, "times a failing item is retried before it goes to the dead letter queue")
+	flag.IntVar(&conf.maxRedirects, "maxRedirects", 10, "redirects a request may follow (0 follows none)")
+	flag.IntVar(&conf.maxHostRedirects, "maxHostRedirects", 0, "redirects in a chain that may move to another host (0 is unlimited)")
+	flag.Int64Var(&conf.maxBodyBytes, "maxBodyBytes", 16<<20, "skip pages whose decoded body is larger than this many bytes (0 is unlimited)")
+	flag.IntVar(&conf.captureFailures, "captureFailures", 0, "store headers and the start of the body of up to this many rejected responses under failures/ (0 disables)")
+	flag.IntVar(&conf.captureFailureBytes, "captureFailureBytes", 64<<10, "bytes of body kept per captured failure")
+	flag.Int64Var(&conf.bandwidthBudget, "bandwidthBudget", 0, "stop crawling after receiving this many response bytes (0 is unlimited)")
+	flag.DurationVar(&conf.requestTimeout, "requestTimeout", 10*time.Second, "timeout for each page request")
+	flag.DurationVar(&conf.pageTimeout, "pageTimeout", 0, "budget for fetching and parsing each page, requeued as retryable when exceeded (0 disables)")
+	flag.IntVar(&conf.maxIdleConns, "maxIdleConns", 0, "idle connections kept open across all hosts (0 keeps the transport default)")
+	flag.IntVar(&conf.maxIdleConnsPerHost, "maxIdleConnsPerHost", 0, "idle connections kept open to each host (0 keeps the transport default)")
+	flag.DurationVar(&conf.idleConnTimeout, "idleConnTimeout", 0, "how long idle connections are kept open (0 keeps the transport default)")
+	flag.BoolVar(&conf.forceHTTP2, "http2", false, "attempt HTTP/2 even on transports with custom TLS settings")
+	flag.IntVar(&conf.tlsSessionCache, "tlsSessionCache", 0, "TLS sessions cached for resumption (0 disables the cache)")
+	flag.Float64Var(&conf.domainRps, "domainRps", 0, "max requests per second to each registrable domain (0 disables)")
+	flag.Float64Var(&conf.maxRps, "maxRps", 0, "max requests per second across all domains and workers, e.g. to stay within a proxy plan (0 disables)")
+	flag.IntVar(&conf.maxRpsBurst, "maxRpsBurst", 1, "requests that may go out at once under -maxRps after a quiet spell")
+	flag.StringVar(&conf.politenessFile, "politenessFile", "", "yaml or json politeness profiles per registrable domain (rps, concurrency, time windows, user agent), reloaded on SIGHUP")
+	flag.BoolVar(&conf.daemon, "daemon", false, "restart failed crawler routines with backoff instead of exiting")
+	flag.IntVar(&conf.maxWorkerFailures, "maxWorkerFailures", 10, "in daemon mode, exit non-zero after this many crawler failures (0 never exits)")
+	flag.DurationVar(&conf.redisWait, "redisWait", 0, "keep retrying the initial redis connection for this long")
+	flag.StringVar(&conf.logLevel, "loglevel", "info", "minimum log level (debug, info, warn, error)")
+	flag.StringVar(&conf.logFormat, "logformat", "text", "log output format (text, json)")
+	flag.StringVar(&conf.otlpEndpoint, "otlpEndpoint", "", "otlp/http collector url crawl traces are exported to, e.g. http://localhost:4318 (default $OTEL_EXPORTER_OTLP_ENDPOINT, empty disables tracing)")
+	flag.Float64Var(&conf.traceRatio, "traceRatio", 1, "share of crawled items traced when exporting traces")
+	flag.DurationVar(&conf.logDedupWindow, "logDedupWindow", time.Minute, "log repeats of an error with the same class and host once per window, with a count (0 logs every one)")
+	flag.StringVar(&conf.adminAddr, "adminAddr", "", "address for the admin http server serving /healthz, /readyz and /stats (empty disables)")
+	flag.BoolVar(&conf.adminPprof, "adminPprof", false, "expose /debug/pprof on the admin http server")
 	flag.Parse()
+
+	// recorded before the config file sets flags too, so flag.Visit can no
+	// longer tell them apart
+	conf.cliFlags = map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		conf.cliFlags[f.Name] = true
+	})
 }
 
 func initEnvironment(env *Environment) error {
-	err := godotenv.Load()
-	if err != nil {
+	// a .env file is optional when settings come from a config file
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
 		return err
 	}
 
-	redisDB, err := strconv.ParseInt(os.Getenv("REDIS_DB"), 10, 0)
-	if err != nil {
-		return err
+	if rawRedisDB := os.Getenv("REDIS_DB"); rawRedisDB != "" {
+		redisDB, err := strconv.ParseInt(rawRedisDB, 10, 0)
+		if err != nil {
+			return fmt.Errorf("invalid REDIS_DB: %w", err)
+		}
+		env.RedisDB = int(redisDB)
+	}
+	if rawShards := os.Getenv("REDIS_VISITED_SHARDS"); rawShards != "" {
+		shards, err := strconv.ParseInt(rawShards, 10, 0)
+		if err != nil {
+			return fmt.Errorf("invalid REDIS_VISITED_SHARDS: %w", err)
+		}
+		env.RedisVisitedShards = int(shards)
 	}
 
 	env.RedisAddr = os.Getenv("REDIS_ADDR")
-	env.RedisDB = int(redisDB)
 	env.RedisPass = os.Getenv("REDIS_PASS")
 	env.FilestoreOutDir = os.Getenv("FILESTORE_OUT_DIR")
 	env.FungicideQueueKey = os.Getenv("REDIS_FUNGICIDE_QUEUE_KEY")
 	env.MyceliumIngressKey = os.Getenv("REDIS_MYCELIUM_QUEUE_KEY")
 	env.MyceliumBlacklistKey = os.Getenv("REDIS_MYCELIUM_BLACKLIST_KEY")
+	env.FungicideApprovedKey = os.Getenv("REDIS_FUNGICIDE_APPROVED_KEY")
+	env.FungicideVerdictKey = os.Getenv("REDIS_FUNGICIDE_VERDICT_KEY")
+	env.DeadLetterKey = os.Getenv("REDIS_MYCELIUM_DEADLETTER_KEY")
+	env.AutoBlacklistKey = os.Getenv("REDIS_MYCELIUM_AUTOBLACKLIST_KEY")
+	env.OtlpEndpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	env.ControlKey = os.Getenv("REDIS_MYCELIUM_CONTROL_KEY")
+	env.OverflowKey = os.Getenv("REDIS_MYCELIUM_OVERFLOW_KEY")
+	env.MalformedKey = os.Getenv("REDIS_MYCELIUM_MALFORMED_KEY")
 
 	return nil
 }
 
+// applyFlagOverrides gives queue key flags from the command line precedence
+// over the environment and config file. The same flags set in the config
+// file's crawler section only fill in what is still unset. Defaults for
+// optional settings still unset come last.
+func applyFlagOverrides(conf *MyceliumConfig, env *Environment) {
+	overrides := []struct {
+		flag  string
+		value string
+		dest  *string
+	}{
+		{"fungicideQueue", conf.fungicideQueueKey, &env.FungicideQueueKey},
+		{"ingressQueue", conf.ingressQueueKey, &env.MyceliumIngressKey},
+		{"blacklistKey", conf.blacklistKey, &env.MyceliumBlacklistKey},
+		{"approvedQueue", conf.approvedQueueKey, &env.FungicideApprovedKey},
+		{"verdictQueue", conf.verdictQueueKey, &env.FungicideVerdictKey},
+		{"deadLetterQueue", conf.deadLetterQueueKey, &env.DeadLetterKey},
+		{"autoBlacklistKey", conf.autoBlacklistKey, &env.AutoBlacklistKey},
+		{"otlpEndpoint", conf.otlpEndpoint, &env.OtlpEndpoint},
+		{"controlKey", conf.controlKey, &env.ControlKey},
+		{"overflowQueue", conf.overflowQueueKey, &env.OverflowKey},
+		{"malformedQueue", conf.malformedQueueKey, &env.MalformedKey},
+	}
+	for _, o := range overrides {
+		if conf.cliFlags[o.flag] || (*o.dest == "" && o.value != "") {
+			*o.dest = o.value
+		}
+	}
+
+	if env.RedisAddr == "" {
+		env.RedisAddr = defaultRedisAddr
+	}
+	if env.ControlKey == "" {
+		env.ControlKey = defaultControlKey
+	}
+	if env.FilestoreOutDir == "" {
+		env.FilestoreOutDir = defaultFilestoreOutDir
+	}
+}
+
+// connectCache connects to redis, retrying with backoff for up to wait so
+// the crawler can start before redis is ready.
+func connectCache(ctx context.Context, options *cache.CrawlerCacheOptions, wait time.Duration, logger *slog.Logger) (*cache.CrawlerCache, error) {
+	deadline := time.Now().Add(wait)
+	backoff := time.Second
+	for {
+		rc, err := cache.NewRedisCache(ctx, options)
+		if err == nil {
+			return rc, nil
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			return nil, err
+		}
+
+		logger.Warn("redis unavailable, retrying", "backoff", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, 30*time.Second)
+	}
+}
+
 func initDomainBlacklist(path string) ([]string, error) {
 	if path == "" {
 		return nil, nil
@@ -56,61 +270,291 @@ func initDomainBlacklist(path string) ([]string, error) {
 
 	var res []string
 	scanner := bufio.NewScanner(domainfile)
-	line := 1
+	line := 0
 
 	for scanner.Scan() {
-		domain := scanner.Text()
-		res = append(res, domain)
 		line++
+		domain := strings.TrimSpace(scanner.Text())
+		if domain == "" || strings.HasPrefix(domain, "#") {
+			continue
+		}
+		if err := filter.ValidateDomainEntry(domain); err != nil {
+			return nil, fmt.Errorf("failed to parse blacklist file line %d: %w", line, err)
+		}
+		res = append(res, domain)
 	}
 
 	return res, nil
 }
 
-func initSeedUrls(path string) ([]*url.URL, error) {
-	seedfile, err := os.Open(path)
+// stringList is a flag.Value collecting every use of a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// initSeedUrls combines the seed file (or stdin when path is "-") with urls
+// given on the command line, dropping duplicates across both sources.
+func initSeedUrls(path string, urls []string) ([]crawler.SeedItem, error) {
+	var res []crawler.SeedItem
+	seen := map[string]bool{}
+
+	switch path {
+	case "":
+	case "-":
+		seeds, err := parseSeedUrls(os.Stdin, "stdin", seen)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, seeds...)
+	default:
+		seedfile, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open seed file %s: %w", path, err)
+		}
+		defer seedfile.Close()
+
+		seeds, err := parseSeedUrls(seedfile, "seed file", seen)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, seeds...)
+	}
+
+	seeds, err := parseSeedUrls(strings.NewReader(strings.Join(urls, "\n")), "seedurl", seen)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open seed file %s: %w", path, err)
+		return nil, err
 	}
-	defer seedfile.Close()
+	return append(res, seeds...), nil
+}
 
-	var res []*url.URL
-	scanner := bufio.NewScanner(seedfile)
-	line := 1
+// seedLine is the JSON form of a seed file line.
+type seedLine struct {
+	URL      string `json:"url"`
+	Priority int32  `json:"priority"`
+	MaxDepth int32  `json:"max_depth"`
+}
+
+// parseSeedUrls reads seeds from r, skipping blank lines, comments and
+// anything already in seen. Each line is either a url optionally followed by
+// a priority and a max depth, e.g.
+//
+//	https://example.com/ 10 3
+//
+// or a JSON object such as {"url": "https://example.com/", "priority": 10,
+// "max_depth": 3}. A source must stick to one of the two forms. Errors name
+// the source and line.
+func parseSeedUrls(r io.Reader, source string, seen map[string]bool) ([]crawler.SeedItem, error) {
+	var res []crawler.SeedItem
+	scanner := bufio.NewScanner(r)
+	line := 0
+	jsonLine, textLine := 0, 0
 
 	for scanner.Scan() {
-		rawUrl := scanner.Text()
-		url, err := url.Parse(rawUrl)
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		var seed seedLine
+		if strings.HasPrefix(text, "{") {
+			if textLine > 0 {
+				return nil, fmt.Errorf("invalid %s line %d: JSON seed mixed with the plain seed on line %d", source, line, textLine)
+			}
+			jsonLine = line
+			decoder := json.NewDecoder(strings.NewReader(text))
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(&seed); err != nil {
+				return nil, fmt.Errorf("invalid %s line %d: %w", source, line, err)
+			}
+			if decoder.More() {
+				return nil, fmt.Errorf("invalid %s line %d: trailing data after the JSON seed", source, line)
+			}
+		} else {
+			if jsonLine > 0 {
+				return nil, fmt.Errorf("invalid %s line %d: plain seed mixed with the JSON seed on line %d", source, line, jsonLine)
+			}
+			textLine = line
+			var err error
+			if seed, err = parseSeedColumns(text); err != nil {
+				return nil, fmt.Errorf("invalid %s line %d: %w", source, line, err)
+			}
+		}
 
+		url, err := url.Parse(seed.URL)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse seed file line %d: %s", line, rawUrl)
+			return nil, fmt.Errorf("failed to parse %s line %d: %s", source, line, seed.URL)
+		}
+		if url.Scheme == "" || url.Host == "" {
+			return nil, fmt.Errorf("invalid %s line %d: %q is not an absolute url", source, line, seed.URL)
+		}
+		if seed.MaxDepth < 0 {
+			return nil, fmt.Errorf("invalid %s line %d: max depth must not be negative, got %d", source, line, seed.MaxDepth)
 		}
 
-		res = append(res, url)
-		line++
+		if seen[url.String()] {
+			continue
+		}
+		seen[url.String()] = true
+		res = append(res, crawler.SeedItem{Location: url.String(), Priority: seed.Priority, MaxDepth: seed.MaxDepth})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", source, err)
 	}
 
 	return res, nil
 }
 
-func initProxyChooser(path string) (*chooser.ProxyChooser, error) {
+// parseSeedColumns parses "url [priority [max depth]]".
+func parseSeedColumns(text string) (seedLine, error) {
+	fields := strings.Fields(text)
+	if len(fields) > 3 {
+		return seedLine{}, fmt.Errorf("expected a url, priority and max depth, got %d columns", len(fields))
+	}
+	seed := seedLine{URL: fields[0]}
+	if len(fields) > 1 {
+		priority, err := strconv.ParseInt(fields[1], 10, 32)
+		if err != nil {
+			return seedLine{}, fmt.Errorf("priority %q is not an integer", fields[1])
+		}
+		seed.Priority = int32(priority)
+	}
+	if len(fields) > 2 {
+		depth, err := strconv.ParseInt(fields[2], 10, 32)
+		if err != nil {
+			return seedLine{}, fmt.Errorf("max depth %q is not an integer", fields[2])
+		}
+		seed.MaxDepth = int32(depth)
+	}
+	return seed, nil
+}
+
+// envLoadOptions returns the options the proxy and agents files are loaded
+// with, on startup and on reload.
+func envLoadOptions(allowEmptyEnv bool) []chooser.LoadOption {
+	if allowEmptyEnv {
+		return []chooser.LoadOption{chooser.WithAllowEmptyEnv()}
+	}
+	return nil
+}
+
+func initProxyChooser(path string, strategy string, epsilon float64, allowEmptyEnv bool) (*chooser.ProxyChooser, error) {
 	if path == "" {
 		return nil, nil
 	}
-	options, err := chooser.LoadProxyOptions(path)
+	load := envLoadOptions(allowEmptyEnv)
+	options, err := chooser.LoadProxyOptions(path, load...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load proxy file %s: %w", path, err)
 	}
-	return chooser.NewProxyChooser(options), nil
+	return chooser.NewProxyChooser(options,
+		chooser.WithProxyStrategy(chooser.ProxyStrategy(strategy)),
+		chooser.WithEpsilon(epsilon),
+		chooser.WithLoadOptions(load...),
+	)
 }
 
-func initUserAgentChooser(path string) (*chooser.UserAgentChooser, error) {
+func initUserAgentChooser(path string, noRotate bool, allowEmptyEnv bool) (*chooser.UserAgentChooser, error) {
+	var profiles []chooser.HeaderProfile
+	var err error
+	load := envLoadOptions(allowEmptyEnv)
 	if path == "" {
-		return nil, nil
+		profiles, err = chooser.DefaultHeaderProfiles()
+	} else {
+		profiles, err = chooser.LoadHeaderProfiles(path, load...)
 	}
-	userAgentOptions, err := chooser.LoadUserAgentOptions(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load agent file %s: %w", path, err)
 	}
-	return chooser.NewUserAgentChooser(userAgentOptions)
+
+	options := []chooser.UserAgentChooserOption{chooser.WithAgentLoadOptions(load...)}
+	if noRotate {
+		options = append(options, chooser.WithoutRotation())
+	}
+	return chooser.NewUserAgentChooser(profiles, options...)
+}
+
+func splitList(list string) []string {
+	var res []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+func splitIntList(list string) ([]int, error) {
+	var res []int
+	for _, item := range splitList(list) {
+		n, err := strconv.Atoi(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %s: %w", item, err)
+		}
+		res = append(res, n)
+	}
+	return res, nil
+}
+
+func initUrlFilters(conf *MyceliumConfig, domainFilter *filter.DomainFilter) (*filter.Chain, error) {
+	ports, err := splitIntList(conf.allowedPorts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid allowedPorts: %w", err)
+	}
+	return filter.NewConfiguredChain(filter.ChainConfig{
+		Domains:             domainFilter,
+		BlockedExtensions:   splitList(conf.blockedExtensions),
+		BlockedPathPrefixes: splitList(conf.blockedPathPrefixes),
+		AllowedSchemes:      splitList(conf.allowedSchemes),
+		AllowedPorts:        ports,
+		BlockIPLiterals:     conf.blockIPLiterals,
+		TrapFilter:          conf.trapFilter,
+		MaxUrlLength:        conf.maxUrlLength,
+		MaxSegmentRepeats:   conf.maxSegmentRepeats,
+		MaxQueryParams:      conf.maxQueryParams,
+	}), nil
+}
+
+func initPageFilters(conf *MyceliumConfig) ([]crawler.PageFilter, error) {
+	var filters []crawler.PageFilter
+	if conf.minWords > 0 {
+		filters = append(filters, crawler.NewMinWordCountFilter(conf.minWords))
+	}
+	if conf.titleBlockPattern != "" {
+		regexFilter, err := crawler.NewRegexPageFilter([]string{conf.titleBlockPattern}, nil)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, regexFilter)
+	}
+	return filters, nil
+}
+
+// parseRecrawlDomains parses comma separated domain=duration pairs, keyed by
+// registrable domain.
+func parseRecrawlDomains(raw string) (map[string]time.Duration, error) {
+	domains := map[string]time.Duration{}
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		domain, rawTTL, found := strings.Cut(pair, "=")
+		if !found {
+			return nil, fmt.Errorf("expected domain=duration, got %q", pair)
+		}
+		ttl, err := time.ParseDuration(rawTTL)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("invalid duration for %s: %q", domain, rawTTL)
+		}
+		domains[filter.RegistrableDomain(strings.ToLower(domain))] = ttl
+	}
+	return domains, nil
 }
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"mycelium/internal/crawler"
+)
+
+// initLogger builds the process logger writing to w from the -loglevel and
+// -logformat flags. Text output stays the default so the console remains
+// readable. With a positive dedupWindow repeated errors are collapsed by the
+// returned DedupHandler, which is nil otherwise.
+func initLogger(w io.Writer, level string, format string, dedupWindow time.Duration) (*slog.Logger, *crawler.DedupHandler, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, nil, fmt.Errorf("loglevel: %w", err)
+	}
+	options := &slog.HandlerOptions{Level: lvl}
+
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "text":
+		handler = slog.NewTextHandler(w, options)
+	case "json":
+		handler = slog.NewJSONHandler(w, options)
+	default:
+		return nil, nil, fmt.Errorf("logformat: must be text or json, got %q", format)
+	}
+	if dedupWindow <= 0 {
+		return slog.New(handler), nil, nil
+	}
+	dedup := crawler.NewDedupHandler(handler, dedupWindow, nil)
+	return slog.New(dedup), dedup, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"mycelium/internal/crawler"
+)
+
+func TestInitLogger(t *testing.T) {
+	for _, tt := range []struct {
+		level, format string
+		wantErr       string
+	}{
+		{level: "info", format: "text"},
+		{level: "DEBUG", format: "JSON"},
+		{level: "loud", format: "text", wantErr: "loglevel:"},
+		{level: "info", format: "xml", wantErr: "logformat:"},
+	} {
+		_, _, err := initLogger(io.Discard, tt.level, tt.format, 0)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("initLogger(%q, %q) = %s", tt.level, tt.format, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.wantErr)) {
+			t.Errorf("initLogger(%q, %q) error = %v, want one naming %s", tt.level, tt.format, err, tt.wantErr)
+		}
+	}
+}
+
+func TestInitLoggerDedup(t *testing.T) {
+	var out strings.Builder
+	logger, dedup, err := initLogger(&out, "info", "text", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dedup == nil {
+		t.Fatal("no dedup handler with a positive window")
+	}
+	for range 3 {
+		logger.Error("failed to get page", "url", "https://down.example.com/", "error", "connection refused")
+	}
+	if n := strings.Count(out.String(), "failed to get page"); n != 1 {
+		t.Errorf("logged %d of 3 repeats within the window, want 1:\n%s", n, out.String())
+	}
+
+	if _, dedup, _ := initLogger(io.Discard, "info", "text", 0); dedup != nil {
+		t.Error("dedup handler with a zero window")
+	}
+}
+
+func TestJSONLogsFetchErrors(t *testing.T) {
+	var mu sync.Mutex
+	var out strings.Builder
+	logger, _, err := initLogger(lockedWriter{&mu, &out}, "warn", "json", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, cache := newTestApp(t, crawler.WithLogger(logger))
+
+	// nothing listens on a closed server, every fetch fails
+	srv := httptest.NewServer(nil)
+	srv.Close()
+	cache.push("ingress", `{"location": "`+srv.URL+`/gone"}`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		app.crawler.Crawl(crawler.WithWorkerID(ctx, 3))
+	}()
+	records := func() []map[string]any {
+		mu.Lock()
+		defer mu.Unlock()
+		var records []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+			if line == "" {
+				continue
+			}
+			var record map[string]any
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatalf("log line %q is not JSON: %s", line, err)
+			}
+			records = append(records, record)
+		}
+		return records
+	}
+	waitFor(t, "the fetch error to be logged", func() bool { return len(records()) > 0 })
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("crawler did not stop")
+	}
+
+	// the info records before the fetch are below the level
+	record := records()[0]
+	for key, want := range map[string]any{
+		"level":     "ERROR",
+		"msg":       "failed to get page",
+		"component": "crawler",
+		"worker":    float64(3),
+		"url":       srv.URL + "/gone",
+	} {
+		if record[key] != want {
+			t.Errorf("record %s = %v, want %v", key, record[key], want)
+		}
+	}
+	if msg, _ := record["error"].(string); msg == "" {
+		t.Errorf("record has no error: %v", record)
+	}
+	if _, ok := record["time"]; !ok {
+		t.Errorf("record has no time: %v", record)
+	}
+}
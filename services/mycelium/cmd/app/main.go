@@ -2,58 +2,223 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"mycelium/internal/cache"
 	"mycelium/internal/crawler"
 	"mycelium/internal/filter"
 	"mycelium/internal/store"
+	"mycelium/internal/version"
 )
 
 func main() {
 	var app Mycelium
+	app.startedAt = time.Now()
 	var env Environment
 
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	initCliFlags(&app.config)
+	if app.config.printVersion {
+		fmt.Println(version.String())
+		return
+	}
 	if err := initEnvironment(&env); err != nil {
 		panic(err)
 	}
+	if err := applyConfigFile(app.config.configFile, &app.config, &env); err != nil {
+		panic(err)
+	}
+	applyFlagOverrides(&app.config, &env)
+	if err := validateConfig(&app.config, &env); err != nil {
+		panic(fmt.Errorf("invalid configuration: %w", err))
+	}
+	logger, logDedup, err := initLogger(os.Stdout, app.config.logLevel, app.config.logFormat, app.config.logDedupWindow)
+	if err != nil {
+		panic(fmt.Errorf("invalid configuration: %w", err))
+	}
+	if app.config.sessionID == "" {
+		app.config.sessionID = crawler.NewSessionID()
+	}
+	app.logDedup = logDedup
+	logger = logger.With("session", app.config.sessionID)
+	slog.SetDefault(logger)
+	app.logger = logger.With("component", "app")
+	app.logger.Info("starting mycelium", "version", version.Version, "commit", version.Commit, "built", version.Date)
+	dumpConfig(&env, app.logger)
 
 	// create redis cache
 	redisCacheOptions := cache.CrawlerCacheOptions{
-		Addr: env.RedisAddr,
-		Pass: env.RedisPass,
-		DB:   env.RedisDB,
+		Addr:          env.RedisAddr,
+		Pass:          env.RedisPass,
+		DB:            env.RedisDB,
+		VisitedShards: env.RedisVisitedShards,
 	}
-	if cache, err := cache.NewRedisCache(ctx, &redisCacheOptions); err != nil {
+	if cache, err := connectCache(ctx, &redisCacheOptions, app.config.redisWait, app.logger); err != nil {
 		panic(err)
 	} else {
-		app.cache = *cache
+		app.cache = cache
 	}
+	defer app.close()
 
 	// create crawler options
 	options := []crawler.CrawlerOption{}
 	options = append(options, crawler.WithMaxIdle(app.config.maxIdleSeconds))
-	if proxyChooser, err := initProxyChooser(app.config.proxyFile); err != nil {
+	options = append(options, crawler.WithLinkQueueingMode(crawler.LinkQueueingMode(app.config.linkQueueing)))
+	options = append(options, crawler.WithSoftErrorPolicy(crawler.SoftErrorPolicy(app.config.softErrors)))
+	options = append(options, crawler.WithScriptPolicy(crawler.ScriptPolicy{
+		MaxBytes:      app.config.scriptMaxBytes,
+		MaxTotalBytes: app.config.scriptsMaxBytes,
+		KeepMinified:  app.config.keepMinifiedScripts,
+	}))
+	options = append(options, crawler.WithCacheBusting(app.config.cacheBusting))
+	options = append(options, crawler.WithHashRoutes(app.config.hashRoutes))
+	options = append(options, crawler.WithHostFolding(app.config.hostFolding))
+	options = append(options, crawler.WithExternalLinkVerification(app.config.verifyExternalLinks))
+	options = append(options, crawler.WithStickyUserAgents(app.config.stickyUserAgents))
+	options = append(options, crawler.WithLogger(logger))
+	options = append(options, crawler.WithMaxRetries(app.config.maxRetries))
+	options = append(options, crawler.WithMaxRedirects(app.config.maxRedirects))
+	options = append(options, crawler.WithMaxCrossHostRedirects(app.config.maxHostRedirects))
+	options = append(options, crawler.WithRequestTimeout(app.config.requestTimeout))
+	options = append(options, crawler.WithMaxBodyBytes(app.config.maxBodyBytes))
+	options = append(options, crawler.WithBandwidthBudget(app.config.bandwidthBudget))
+	options = append(options, crawler.WithFailureCapture(app.config.captureFailureBytes, app.config.captureFailures))
+	options = append(options, crawler.WithPageTimeout(app.config.pageTimeout))
+	options = append(options, crawler.WithTransportTuning(crawler.TransportTuning{
+		MaxIdleConns:        app.config.maxIdleConns,
+		MaxIdleConnsPerHost: app.config.maxIdleConnsPerHost,
+		IdleConnTimeout:     app.config.idleConnTimeout,
+		ForceAttemptHTTP2:   app.config.forceHTTP2,
+		TLSSessionCacheSize: app.config.tlsSessionCache,
+	}))
+	options = append(options, crawler.WithDomainRateLimit(app.config.domainRps))
+	options = append(options, crawler.WithGlobalRateLimit(app.config.maxRps, app.config.maxRpsBurst))
+	if len(app.config.domainOverrides) > 0 {
+		options = append(options, crawler.WithDomainOverrides(app.config.domainOverrides))
+	}
+	if app.config.politenessFile != "" {
+		profiles, err := loadPolitenessProfiles(app.config.politenessFile)
+		if err != nil {
+			panic(err)
+		}
+		app.politeness = crawler.NewPoliteness(profiles)
+		options = append(options, crawler.WithPoliteness(app.politeness))
+	}
+	app.metrics = crawler.NewCounterMetrics()
+	options = append(options, crawler.WithMetrics(app.metrics))
+	if proxyChooser, err := initProxyChooser(app.config.proxyFile, app.config.proxyStrategy, app.config.proxyEpsilon, app.config.allowEmptyEnv); err != nil {
 		panic(err)
 	} else if proxyChooser != nil {
+		app.proxyChooser = proxyChooser
 		options = append(options, crawler.WithProxyChooser(proxyChooser))
+		if bypass := splitList(app.config.proxyBypass); len(bypass) > 0 {
+			options = append(options, crawler.WithProxyBypass(bypass))
+		}
 	}
-	if uaChooser, err := initUserAgentChooser(app.config.agentsFile); err != nil {
+	if uaChooser, err := initUserAgentChooser(app.config.agentsFile, app.config.noRotateUserAgents, app.config.allowEmptyEnv); err != nil {
 		panic(err)
 	} else if uaChooser != nil {
-		options = append(options, crawler.WithUserAgentChooser(uaChooser))
+		app.userAgentChooser = uaChooser
+		options = append(options, crawler.WithHeaderChooser(uaChooser))
 	}
 	if domainBlacklist, err := initDomainBlacklist(app.config.domainBlacklistFile); err != nil {
 		panic(err)
 	} else if domainBlacklist != nil {
-		filter := filter.NewDomainFilter(domainBlacklist)
-		options = append(options, crawler.WithUrlFilters([]crawler.UrlFilter{filter}))
+		domainFilter, err := filter.NewDomainFilter(domainBlacklist)
+		if err != nil {
+			panic(err)
+		}
+		app.domainBlacklist = domainBlacklist
+		app.domainFilter = domainFilter
+	}
+	if urlFilters, err := initUrlFilters(&app.config, app.domainFilter); err != nil {
+		panic(err)
+	} else {
+		app.urlFilters = urlFilters
+		options = append(options, crawler.WithUrlFilters([]crawler.UrlFilter{urlFilters}))
+	}
+	if pageFilters, err := initPageFilters(&app.config); err != nil {
+		panic(err)
+	} else {
+		options = append(options, crawler.WithPageFilters(pageFilters))
+		options = append(options, crawler.WithQueueDroppedLinks(app.config.queueDroppedLinks))
+	}
+	var rewriters []crawler.UrlRewriter
+	if app.config.rewriteFile != "" {
+		rules, err := filter.LoadRewriteRules(app.config.rewriteFile)
+		if err != nil {
+			panic(err)
+		}
+		app.rewriteFilter = filter.NewRewriteFilter(rules)
+		rewriters = append(rewriters, app.rewriteFilter)
+	}
+	if params := splitList(app.config.strippedParams); len(params) > 0 {
+		rewriters = append(rewriters, filter.NewQueryParamStripper(params))
+	}
+	if len(rewriters) > 0 {
+		options = append(options, crawler.WithUrlRewriters(rewriters))
 	}
 
 	// Add fungicide integration options
 	if env.FungicideQueueKey != "" {
 		options = append(options, crawler.WithFungicideQueueKey(env.FungicideQueueKey))
+		options = append(options, crawler.WithFungicideCodec(crawler.FungicideCodec(app.config.fungicideCodec)))
+		options = append(options, crawler.WithFungicidePayloadBudget(app.config.fungicideMaxBytes))
+		options = append(options, crawler.WithFungicideBatching(app.config.fungicideBatch, app.config.fungicideFlush, app.config.fungicideSpoolDir))
+		if app.config.fungicideEnvelope {
+			crawlerID := app.config.crawlerID
+			if crawlerID == "" {
+				crawlerID = crawler.DefaultCrawlerID()
+			}
+			options = append(options, crawler.WithEnvelope(crawlerID))
+		}
+	}
+	options = append(options, crawler.WithSessionID(app.config.sessionID))
+	if env.DeadLetterKey != "" {
+		options = append(options, crawler.WithDeadLetterKey(env.DeadLetterKey))
+	}
+	if env.MalformedKey != "" {
+		options = append(options, crawler.WithMalformedKey(env.MalformedKey, app.config.malformedMax))
+	}
+	options = append(options, crawler.WithPerDomainBudget(app.config.domainBudget))
+	options = append(options, crawler.WithHostSlots(app.config.hostSlots, 0))
+	options = append(options, crawler.WithControlKey(env.ControlKey))
+	options = append(options, crawler.WithLookahead(app.config.lookahead))
+	options = append(options, crawler.WithFeedParsing(app.config.feedParsing))
+	options = append(options, crawler.WithMaxLinksPerPage(app.config.maxLinksPerPage, crawler.LinkSelection(app.config.linkSelection)))
+	options = append(options, crawler.WithFrontierCap(app.config.frontierCap, env.OverflowKey))
+	if env.OtlpEndpoint != "" {
+		if tp, err := initTracerProvider(ctx, env.OtlpEndpoint, app.config.traceRatio); err != nil {
+			panic(err)
+		} else {
+			app.tracerProvider = tp
+			options = append(options, crawler.WithTracerProvider(tp))
+		}
+	}
+	if app.config.recrawlAfter > 0 {
+		// already validated
+		domains, _ := parseRecrawlDomains(app.config.recrawlDomains)
+		options = append(options, crawler.WithRecrawl(crawler.RecrawlPolicy{
+			After:   app.config.recrawlAfter,
+			Domains: domains,
+		}))
+		options = append(options, crawler.WithChangeDetection(app.config.changeDetection))
+	}
+	if env.AutoBlacklistKey != "" {
+		options = append(options, crawler.WithDomainErrorBudget(crawler.DomainErrorBudget{
+			Key:        env.AutoBlacklistKey,
+			Threshold:  app.config.errorBudgetRatio,
+			MinSamples: int64(app.config.errorBudgetSamples),
+			Window:     app.config.errorBudgetWindow,
+			TTL:        app.config.autoBlacklistTTL,
+		}))
 	}
 	if env.MyceliumIngressKey != "" {
 		options = append(options, crawler.WithMyceliumIngressKey(env.MyceliumIngressKey))
@@ -62,9 +227,50 @@ func main() {
 		options = append(options, crawler.WithMyceliumBlacklistKey(env.MyceliumBlacklistKey))
 	}
 
+	if app.config.sampleRate > 0 {
+		options = append(options, crawler.WithSampling(crawler.NewSamplingStore(store.NewFileStore(app.config.sampleDir), app.config.sampleRate)))
+	}
+
 	filestore := store.NewFileStore(env.FilestoreOutDir)
-	app.crawler = *crawler.NewCrawler(&app.cache, filestore, options...)
+	app.crawler = *crawler.NewCrawler(app.cache, filestore, options...)
+
+	app.workers = newWorkerPool(ctx, app.runCrawler, app.logger)
+	if app.config.daemon {
+		app.workers.supervised(app.config.maxWorkerFailures)
+	}
+	app.blacklistKey = env.MyceliumBlacklistKey
+	app.ingressKey = env.MyceliumIngressKey
+	app.fungicideKey = env.FungicideQueueKey
+	app.controlKey = env.ControlKey
+	go app.handleReload(ctx)
+	go app.reportStats(ctx)
+	go app.handleDiagnostics(ctx)
+	if app.logDedup != nil {
+		go app.flushLogs(ctx)
+	}
+	if app.config.recrawlAfter > 0 {
+		go app.promoteRecrawls(ctx)
+	}
+	if app.politeness != nil {
+		go app.promoteDelayed(ctx)
+	}
+	if app.config.frontierCap > 0 && env.OverflowKey != "" {
+		go app.drainOverflow(ctx)
+	}
+	if app.config.adminAddr != "" {
+		go app.serveAdmin(ctx)
+	}
+	if env.FungicideApprovedKey != "" && env.MyceliumIngressKey != "" {
+		go app.consumeIngress(ctx, env.FungicideApprovedKey)
+	}
+	if env.FungicideVerdictKey != "" && env.MyceliumIngressKey != "" {
+		go app.consumeVerdicts(ctx, env.FungicideVerdictKey)
+	}
 
 	app.seed(ctx)
-	app.crawl(ctx)
+	if err := app.crawl(ctx); err != nil {
+		app.logger.Error("crawl failed", "error", err)
+		app.close()
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"mycelium/internal/crawler"
+	"mycelium/internal/filter"
+)
+
+// politenessEntry is the layout of one domain in the -politenessFile, which
+// may be yaml or json:
+//
+//	example.com:
+//	  rps: 0.1
+//	  concurrency: 1
+//	  windows: ["22:00-06:00"]
+//	  timezone: Europe/Berlin
+//	  userAgent: "ExampleBot/1.0 (+https://example.org/bot)"
+type politenessEntry struct {
+	Rps         float64  `yaml:"rps"`
+	Concurrency int      `yaml:"concurrency"`
+	Windows     []string `yaml:"windows"`
+	Timezone    string   `yaml:"timezone"`
+	UserAgent   string   `yaml:"userAgent"`
+}
+
+// loadPolitenessProfiles reads the profiles at path, keyed by registrable
+// domain. Errors name the domain and field at fault.
+func loadPolitenessProfiles(path string) (map[string]crawler.PolitenessProfile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open politeness file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	var entries map[string]politenessEntry
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&entries); err != nil {
+		return nil, fmt.Errorf("failed to parse politeness file %s: %w", path, err)
+	}
+
+	profiles := make(map[string]crawler.PolitenessProfile, len(entries))
+	for domain, entry := range entries {
+		profile, err := politenessProfile(domain, entry)
+		if err != nil {
+			return nil, fmt.Errorf("politeness file %s: %w", path, err)
+		}
+		profiles[strings.ToLower(strings.TrimSpace(domain))] = profile
+	}
+	return profiles, nil
+}
+
+func politenessProfile(domain string, entry politenessEntry) (crawler.PolitenessProfile, error) {
+	normalized := strings.ToLower(strings.TrimSpace(domain))
+	if registrable := filter.RegistrableDomain(normalized); registrable != normalized {
+		return crawler.PolitenessProfile{}, fmt.Errorf("%s: must be a registrable domain, e.g. %s", domain, registrable)
+	}
+	if entry.Rps < 0 {
+		return crawler.PolitenessProfile{}, fmt.Errorf("%s.rps: must not be negative, got %g", domain, entry.Rps)
+	}
+	if entry.Concurrency < 0 {
+		return crawler.PolitenessProfile{}, fmt.Errorf("%s.concurrency: must not be negative, got %d", domain, entry.Concurrency)
+	}
+	if strings.ContainsAny(entry.UserAgent, "\r\n") {
+		return crawler.PolitenessProfile{}, fmt.Errorf("%s.userAgent: must be a single line", domain)
+	}
+
+	profile := crawler.PolitenessProfile{
+		RPS:         entry.Rps,
+		Concurrency: entry.Concurrency,
+		UserAgent:   entry.UserAgent,
+		Location:    time.UTC,
+	}
+	if entry.Timezone != "" {
+		loc, err := time.LoadLocation(entry.Timezone)
+		if err != nil {
+			return crawler.PolitenessProfile{}, fmt.Errorf("%s.timezone: %w", domain, err)
+		}
+		profile.Location = loc
+	}
+	for i, raw := range entry.Windows {
+		window, err := parseTimeWindow(raw)
+		if err != nil {
+			return crawler.PolitenessProfile{}, fmt.Errorf("%s.windows[%d]: %w", domain, i, err)
+		}
+		profile.Windows = append(profile.Windows, window)
+	}
+	return profile, nil
+}
+
+// parseTimeWindow parses "HH:MM-HH:MM". The end may be before the start for
+// a window past midnight, and 24:00 ends a window at midnight.
+func parseTimeWindow(raw string) (crawler.TimeWindow, error) {
+	start, end, found := strings.Cut(raw, "-")
+	if !found {
+		return crawler.TimeWindow{}, fmt.Errorf("expected HH:MM-HH:MM, got %q", raw)
+	}
+	var window crawler.TimeWindow
+	var err error
+	if window.Start, err = parseTimeOfDay(strings.TrimSpace(start)); err != nil {
+		return crawler.TimeWindow{}, fmt.Errorf("expected HH:MM-HH:MM, got %q: %w", raw, err)
+	}
+	if window.End, err = parseTimeOfDay(strings.TrimSpace(end)); err != nil {
+		return crawler.TimeWindow{}, fmt.Errorf("expected HH:MM-HH:MM, got %q: %w", raw, err)
+	}
+	if window.End == 24*time.Hour {
+		window.End = 0
+		if window.Start == 0 {
+			// all day
+			window.End = 24 * time.Hour
+		}
+	}
+	if window.Start == window.End {
+		return crawler.TimeWindow{}, fmt.Errorf("window %q is empty", raw)
+	}
+	return window, nil
+}
+
+func parseTimeOfDay(raw string) (time.Duration, error) {
+	if raw == "24:00" {
+		return 24 * time.Hour, nil
+	}
+	t, err := time.Parse("15:04", raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", raw)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"mycelium/internal/crawler"
+)
+
+func TestLoadPolitenessProfiles(t *testing.T) {
+	path := writeConfig(t, `
+Example.com:
+  rps: 0.5
+  concurrency: 2
+  windows: ["22:00-06:00", "12:00-13:30"]
+  timezone: UTC
+  userAgent: "ExampleBot/1.0 (+https://example.org/bot)"
+example.org:
+  rps: 1
+`)
+	profiles, err := loadPolitenessProfiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile, found := profiles["example.com"]
+	if !found {
+		t.Fatalf("profiles %v lack example.com", profiles)
+	}
+	want := []crawler.TimeWindow{
+		{Start: 22 * time.Hour, End: 6 * time.Hour},
+		{Start: 12 * time.Hour, End: 13*time.Hour + 30*time.Minute},
+	}
+	if profile.RPS != 0.5 || profile.Concurrency != 2 || profile.UserAgent != "ExampleBot/1.0 (+https://example.org/bot)" {
+		t.Errorf("profile = %+v", profile)
+	}
+	if len(profile.Windows) != len(want) || profile.Windows[0] != want[0] || profile.Windows[1] != want[1] {
+		t.Errorf("windows = %v, want %v", profile.Windows, want)
+	}
+	if other := profiles["example.org"]; other.RPS != 1 || other.Location != time.UTC || other.Windows != nil {
+		t.Errorf("example.org profile = %+v", other)
+	}
+}
+
+func TestLoadPolitenessProfilesNamesField(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"negative rps", "example.com:\n  rps: -1\n", "example.com.rps"},
+		{"negative concurrency", "example.com:\n  concurrency: -2\n", "example.com.concurrency"},
+		{"bad window", "example.com:\n  windows: [\"09:00-17:00\", \"late\"]\n", "example.com.windows[1]"},
+		{"unknown timezone", "example.com:\n  timezone: Mars/Olympus\n", "example.com.timezone"},
+		{"subdomain", "www.example.com:\n  rps: 1\n", "www.example.com: must be a registrable domain, e.g. example.com"},
+		{"multi-line user agent", "example.com:\n  userAgent: \"Bot\\r\\nX-Evil: 1\"\n", "example.com.userAgent"},
+		{"unknown field", "example.com:\n  qps: 1\n", "qps"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := loadPolitenessProfiles(writeConfig(t, test.content))
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("error = %v, want it to name %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestParseTimeWindow(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    crawler.TimeWindow
+		wantErr bool
+	}{
+		{raw: "09:00-17:00", want: crawler.TimeWindow{Start: 9 * time.Hour, End: 17 * time.Hour}},
+		{raw: " 22:30 - 06:15 ", want: crawler.TimeWindow{Start: 22*time.Hour + 30*time.Minute, End: 6*time.Hour + 15*time.Minute}},
+		{raw: "18:00-24:00", want: crawler.TimeWindow{Start: 18 * time.Hour, End: 0}},
+		{raw: "00:00-24:00", want: crawler.TimeWindow{Start: 0, End: 24 * time.Hour}},
+		{raw: "09:00", wantErr: true},
+		{raw: "09:00-25:00", wantErr: true},
+		{raw: "9am-5pm", wantErr: true},
+		{raw: "10:00-10:00", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := parseTimeWindow(test.raw)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseTimeWindow(%q) error = %v, want error %t", test.raw, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parseTimeWindow(%q) = %+v, want %+v", test.raw, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mycelium/internal/crawler"
+)
+
+// TestShutdownLosesNoItems cancels a crawl while workers are mid-request
+// and checks that every seeded url either reached fungicide or is back in
+// the ingress queue.
+func TestShutdownLosesNoItems(t *testing.T) {
+	const seeds = 40
+
+	var served atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// slow enough that shutdown catches requests in flight
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(20 * time.Millisecond):
+		}
+		served.Add(1)
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<html><head><title>%s</title></head></html>", r.URL.Path)
+	}))
+	defer srv.Close()
+
+	app, cache := newTestApp(t, crawler.WithFungicideQueueKey("fungicide"))
+	app.config.numCrawlers = 4
+	app.config.shutdownGraceSeconds = 5
+
+	want := map[string]bool{}
+	for i := 0; i < seeds; i++ {
+		loc := fmt.Sprintf("%s/page/%d", srv.URL, i)
+		want[loc] = true
+		itemJSON, _ := json.Marshal(crawler.IngressItem{Location: loc})
+		cache.push("ingress", string(itemJSON))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app.workers = newWorkerPool(ctx, app.runCrawler, app.logger)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		app.crawl(ctx)
+	}()
+
+	waitFor(t, "some pages to be fetched", func() bool { return served.Load() >= 8 })
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("crawl did not return after shutdown")
+	}
+
+	got := map[string]int{}
+	for _, pageJSON := range cache.queue("fungicide") {
+		var page struct {
+			Location string `json:"location"`
+		}
+		if err := json.Unmarshal([]byte(pageJSON), &page); err != nil {
+			t.Fatal(err)
+		}
+		got[page.Location]++
+	}
+	sent := len(got)
+	for _, itemJSON := range cache.queue("ingress") {
+		var item crawler.IngressItem
+		if err := json.Unmarshal([]byte(itemJSON), &item); err != nil {
+			t.Fatal(err)
+		}
+		got[item.Location]++
+		if visited, _ := cache.IsVisited(context.Background(), item.Location); visited {
+			t.Errorf("%s requeued but still marked visited", item.Location)
+		}
+	}
+
+	for loc := range want {
+		switch got[loc] {
+		case 0:
+			t.Errorf("%s lost on shutdown", loc)
+		case 1:
+		default:
+			t.Errorf("%s both sent and requeued, or requeued twice", loc)
+		}
+	}
+	if sent == 0 || sent == seeds {
+		t.Errorf("%d of %d pages sent, want shutdown to land mid-crawl", sent, seeds)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"mycelium/internal/crawler"
+)
+
+func TestReportStatsOnFakeClock(t *testing.T) {
+	app, cache := newTestApp(t)
+	app.ingressKey = "ingress"
+	app.fungicideKey = "fungicide"
+	app.metrics = crawler.NewCounterMetrics()
+	cache.push("ingress", "a")
+	cache.push("ingress", "b")
+	cache.push("fungicide", "c")
+	cache.Visit(context.Background(), "https://example.com/")
+
+	logger, records := logRecords(t)
+	app.logger = logger
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ticks := make(chan time.Time)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		app.reportStatsOn(ctx, ticks, start)
+	}()
+
+	app.metrics.Incr(crawler.MetricPagesFetched, 30)
+	app.metrics.Incr(crawler.MetricFetchErrors, 10)
+	ticks <- start.Add(10 * time.Second)
+
+	// the next tick comes 20s later, the rate covers only the new pages
+	app.metrics.Incr(crawler.MetricPagesFetched, 20)
+	ticks <- start.Add(30 * time.Second)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("reporter did not stop on shutdown")
+	}
+
+	reports := records()
+	if len(reports) != 2 {
+		t.Fatalf("got %d reports, want one per tick: %v", len(reports), reports)
+	}
+	for i, want := range []string{
+		"fetched=30 errors=10 errorRate=25.0% pagesPerSec=3.00 ingress=2 fungicide=1 visited=1 workers=0 idle=0",
+		"fetched=50 errors=10 errorRate=16.7% pagesPerSec=1.00 ingress=2 fungicide=1 visited=1 workers=0 idle=0",
+	} {
+		if got := progressLine(reports[i]); got != want {
+			t.Errorf("report %d = %q, want %q", i, got, want)
+		}
+	}
+}
+
+// progressLine flattens a progress record into key=value pairs in the order
+// they are logged.
+func progressLine(record map[string]any) string {
+	var fields []string
+	for _, key := range []string{"fetched", "errors", "errorRate", "pagesPerSec", "ingress", "fungicide", "visited", "workers", "idle"} {
+		fields = append(fields, fmt.Sprintf("%s=%v", key, record[key]))
+	}
+	return strings.Join(fields, " ")
+}
+
+func TestReportProgressWithoutQueues(t *testing.T) {
+	app, _ := newTestApp(t)
+	app.metrics = crawler.NewCounterMetrics()
+
+	logger, records := logRecords(t)
+	app.logger = logger
+
+	if fetched := app.reportProgress(context.Background(), time.Second, 0); fetched != 0 {
+		t.Errorf("reportProgress = %d, want 0 pages fetched", fetched)
+	}
+	// unknown queue depths are reported as -1
+	reports := records()
+	if len(reports) != 1 {
+		t.Fatalf("got %d reports, want 1", len(reports))
+	}
+	if got := progressLine(reports[0]); !strings.Contains(got, "errorRate=0.0%") || !strings.Contains(got, "ingress=-1 fungicide=-1") {
+		t.Errorf("report = %q", got)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"mycelium/internal/crawler"
+)
+
+const (
+	workerRestartBackoff    = time.Second
+	workerMaxRestartBackoff = time.Minute
+)
+
+// workerPool keeps a target number of crawl workers running. Workers removed
+// by scaling down finish their current item before exiting.
+//
+// When supervised, a worker that fails or panics is restarted with backoff
+// until maxFailures failures have happened across the pool. Unsupervised,
+// the first failure stops the whole pool. Either way the error is available
+// from err once the pool has drained.
+type workerPool struct {
+	mu          sync.Mutex
+	ctx         context.Context
+	cancel      context.CancelFunc
+	run         func(ctx context.Context, id int) error
+	logger      *slog.Logger
+	supervise   bool
+	maxFailures int
+	// restartBackoff is the first delay before restarting a failed worker
+	restartBackoff time.Duration
+	failures       int
+	fatal          error
+	stops          map[int]chan struct{}
+	nextID         int
+	running        int
+	changed        chan struct{}
+}
+
+func newWorkerPool(ctx context.Context, run func(ctx context.Context, id int) error, logger *slog.Logger) *workerPool {
+	ctx, cancel := context.WithCancel(ctx)
+	return &workerPool{
+		ctx:            ctx,
+		cancel:         cancel,
+		run:            run,
+		logger:         logger,
+		restartBackoff: workerRestartBackoff,
+		stops:          map[int]chan struct{}{},
+		changed:        make(chan struct{}),
+	}
+}
+
+// supervised restarts failed workers, giving up once maxFailures failures
+// have been seen (0 means never give up).
+func (p *workerPool) supervised(maxFailures int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.supervise = true
+	p.maxFailures = maxFailures
+}
+
+// scale starts or stops workers until target are running.
+func (p *workerPool) scale(target int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for len(p.stops) < target {
+		id := p.nextID
+		p.nextID++
+		stop := make(chan struct{})
+		p.stops[id] = stop
+		p.running++
+
+		workerCtx := crawler.WithWorkerStop(crawler.WithWorkerID(p.ctx, id), stop)
+		go func() {
+			defer p.exited(id)
+			p.supervisor(workerCtx, id, stop)
+		}()
+	}
+
+	if len(p.stops) > target {
+		// stop the newest workers first
+		ids := make([]int, 0, len(p.stops))
+		for id := range p.stops {
+			ids = append(ids, id)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(ids)))
+		for _, id := range ids[:len(p.stops)-target] {
+			close(p.stops[id])
+			delete(p.stops, id)
+		}
+	}
+}
+
+func (p *workerPool) supervisor(ctx context.Context, id int, stop <-chan struct{}) {
+	backoff := p.restartBackoff
+	for {
+		err := p.runSafe(ctx, id)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		if !p.recordFailure(id, err) {
+			return
+		}
+
+		p.logger.Info("restarting crawler", "worker", id, "backoff", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-stop:
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, workerMaxRestartBackoff)
+	}
+}
+
+// runSafe turns a panicking worker into an error so one bad page cannot take
+// down the process.
+func (p *workerPool) runSafe(ctx context.Context, id int) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return p.run(ctx, id)
+}
+
+// recordFailure logs a worker failure and reports whether the worker should
+// be restarted. When it should not, the pool is cancelled.
+func (p *workerPool) recordFailure(id int, err error) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.failures++
+	p.logger.Error("crawler failed", "worker", id, "failures", p.failures, "error", err)
+	if p.supervise && (p.maxFailures == 0 || p.failures < p.maxFailures) {
+		return true
+	}
+
+	if p.fatal == nil {
+		if p.supervise {
+			p.fatal = fmt.Errorf("crawler failures reached limit of %d, last: %w", p.maxFailures, err)
+		} else {
+			p.fatal = fmt.Errorf("crawler %d failed: %w", id, err)
+		}
+	}
+	p.cancel()
+	return false
+}
+
+// err returns the error that stopped the pool, if any.
+func (p *workerPool) err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.fatal
+}
+
+func (p *workerPool) exited(id int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// a worker that exited on its own (e.g. max idle) no longer counts
+	// towards the target
+	delete(p.stops, id)
+	p.running--
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// size returns the target worker count.
+func (p *workerPool) size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.stops)
+}
+
+// waitEmpty blocks until no workers are running, returning false if abort
+// fires first.
+func (p *workerPool) waitEmpty(abort <-chan struct{}) bool {
+	for {
+		p.mu.Lock()
+		running := p.running
+		changed := p.changed
+		p.mu.Unlock()
+
+		if running == 0 {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-abort:
+			return false
+		}
+	}
+}
+
+// autoscale adjusts the pool from the ingress queue depth: one step up when
+// the backlog exceeds the threshold and nobody is idle, down by the number of
+// idle workers once the queue is empty.
+func (app *Mycelium) autoscale(ctx context.Context) {
+	size, err := app.cache.IngressQueueSize(ctx, app.ingressKey)
+	if err != nil {
+		app.logger.Error("failed to get ingress queue size for autoscaling", "error", err)
+		return
+	}
+
+	idle := 0
+	for _, w := range app.crawler.Workers() {
+		if w.Idle {
+			idle++
+		}
+	}
+
+	current := app.workers.size()
+	target := current
+	switch {
+	case int(size) > app.config.scaleUpDepth && idle == 0:
+		target = current + max(1, current/4)
+	case size == 0 && idle > 0:
+		target = current - idle
+	}
+	target = min(max(target, app.config.minCrawlers), app.config.maxCrawlers)
+
+	if target != current {
+		app.logger.Info("scaling crawlers", "from", current, "to", target, "queueDepth", size, "idle", idle)
+		app.workers.scale(target)
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mycelium/internal/crawler"
+)
+
+// fakeWorkers is a run func for a workerPool whose workers run until
+// cancelled, counting how many are live.
+type fakeWorkers struct {
+	live atomic.Int32
+}
+
+func (f *fakeWorkers) run(ctx context.Context, id int) error {
+	f.live.Add(1)
+	defer f.live.Add(-1)
+	<-ctx.Done()
+	return nil
+}
+
+// newBlockingServer serves pages that signal fetching when a request arrives
+// and only answer once release is closed.
+func newBlockingServer(t *testing.T, fetching chan<- struct{}, release <-chan struct{}) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetching <- struct{}{}
+		<-release
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><head><title>slow</title></head></html>")
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestWorkerPoolScale(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// run the real crawl loop on an empty queue so a stop request is seen
+	// between items
+	cache := newMemCache()
+	c := crawler.NewCrawler(cache, nil, crawler.WithMyceliumIngressKey("ingress"), crawler.WithLogger(discardLogger))
+	var live atomic.Int32
+	pool := newWorkerPool(ctx, func(ctx context.Context, id int) error {
+		live.Add(1)
+		defer live.Add(-1)
+		return c.Crawl(ctx)
+	}, discardLogger)
+
+	pool.scale(4)
+	waitFor(t, "four workers", func() bool { return live.Load() == 4 && len(c.Workers()) == 4 })
+	if pool.size() != 4 {
+		t.Errorf("size = %d, want 4", pool.size())
+	}
+
+	pool.scale(1)
+	waitFor(t, "scale down to one worker", func() bool { return live.Load() == 1 })
+	// the oldest worker is the one kept
+	if states := c.Workers(); len(states) != 1 || states[0].ID != 0 {
+		t.Errorf("workers = %+v, want only worker 0", states)
+	}
+
+	pool.scale(3)
+	waitFor(t, "scale back up", func() bool { return live.Load() == 3 })
+	if pool.size() != 3 {
+		t.Errorf("size = %d, want 3", pool.size())
+	}
+
+	cancel()
+	if !pool.waitEmpty(nil) {
+		t.Fatal("waitEmpty gave up without an abort channel")
+	}
+	if pool.size() != 0 {
+		t.Errorf("size = %d after every worker exited, want 0", pool.size())
+	}
+}
+
+func TestWorkerPoolWaitEmptyAborts(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool := newWorkerPool(ctx, func(ctx context.Context, id int) error {
+		<-ctx.Done()
+		return nil
+	}, discardLogger)
+	pool.scale(2)
+
+	abort := make(chan struct{})
+	close(abort)
+	if pool.waitEmpty(abort) {
+		t.Error("waitEmpty reported no workers while two were running")
+	}
+}
+
+// TestWorkerPoolScaleDownFinishesItem stops a worker in the middle of a
+// fetch and checks the page is still sent, not lost or requeued.
+func TestWorkerPoolScaleDownFinishesItem(t *testing.T) {
+	release := make(chan struct{})
+	fetching := make(chan struct{}, 1)
+	srv := newBlockingServer(t, fetching, release)
+
+	app, cache := newTestApp(t, crawler.WithFungicideQueueKey("fungicide"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app.workers = newWorkerPool(ctx, app.runCrawler, app.logger)
+	cache.push("ingress", fmt.Sprintf(`{"location":"%s/slow","retries":0}`, srv))
+
+	app.workers.scale(1)
+	<-fetching
+	app.workers.scale(0)
+	close(release)
+
+	if !app.workers.waitEmpty(nil) {
+		t.Fatal("worker did not exit")
+	}
+	if sent := cache.queue("fungicide"); len(sent) != 1 {
+		t.Errorf("sent %d pages, want the in-flight page finished", len(sent))
+	}
+	if queued := cache.queue("ingress"); len(queued) != 0 {
+		t.Errorf("ingress = %v, want the item consumed", queued)
+	}
+}
+
+func TestAutoscale(t *testing.T) {
+	app, cache := newTestApp(t)
+	app.ingressKey = "ingress"
+	app.config.minCrawlers = 1
+	app.config.maxCrawlers = 6
+	app.config.scaleUpDepth = 10
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var fake fakeWorkers
+	app.workers = newWorkerPool(ctx, fake.run, app.logger)
+	app.workers.scale(2)
+
+	// a backlog with nobody idle adds workers, up to the maximum
+	for i := 0; i < 20; i++ {
+		cache.push("ingress", fmt.Sprintf(`{"location":"https://example.com/%d"}`, i))
+	}
+	app.autoscale(ctx)
+	if got := app.workers.size(); got != 3 {
+		t.Errorf("after one backlog check: %d workers, want 3", got)
+	}
+	for i := 0; i < 5; i++ {
+		app.autoscale(ctx)
+	}
+	if got := app.workers.size(); got != 6 {
+		t.Errorf("after repeated backlog checks: %d workers, want the maximum 6", got)
+	}
+
+	// a queue below the threshold leaves the pool alone
+	cache.ClearQueue(ctx, "ingress")
+	cache.push("ingress", `{"location":"https://example.com/"}`)
+	app.autoscale(ctx)
+	if got := app.workers.size(); got != 6 {
+		t.Errorf("small backlog: %d workers, want 6", got)
+	}
+}
+
+func TestAutoscaleDownOnIdle(t *testing.T) {
+	app, _ := newTestApp(t)
+	app.ingressKey = "ingress"
+	app.config.minCrawlers = 2
+	app.config.maxCrawlers = 8
+	app.config.scaleUpDepth = 10
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app.workers = newWorkerPool(ctx, app.runCrawler, app.logger)
+	app.workers.scale(5)
+	waitFor(t, "idle workers", func() bool {
+		idle := 0
+		for _, w := range app.crawler.Workers() {
+			if w.Idle {
+				idle++
+			}
+		}
+		return idle == 5
+	})
+
+	// an empty queue drops the idle workers, but not below the minimum
+	app.autoscale(ctx)
+	if got := app.workers.size(); got != 2 {
+		t.Errorf("%d workers after an idle check, want the minimum 2", got)
+	}
+	waitFor(t, "workers to exit", func() bool { return len(app.crawler.Workers()) == 2 })
+}
+
+func TestAdminWorkers(t *testing.T) {
+	app, _ := newTestApp(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var fake fakeWorkers
+	app.workers = newWorkerPool(ctx, fake.run, app.logger)
+
+	if rec := adminRequest(t, app, http.MethodPost, "/workers?n=3"); rec.Code != http.StatusOK {
+		t.Fatalf("POST /workers: %d %q", rec.Code, rec.Body.String())
+	}
+	waitFor(t, "three workers", func() bool { return fake.live.Load() == 3 })
+
+	for _, target := range []string{"/workers", "/workers?n=0", "/workers?n=abc"} {
+		if rec := adminRequest(t, app, http.MethodPost, target); rec.Code != http.StatusBadRequest {
+			t.Errorf("POST %s = %d, want 400", target, rec.Code)
+		}
+	}
+	if rec := adminRequest(t, app, http.MethodGet, "/workers"); rec.Code != http.StatusOK {
+		t.Errorf("GET /workers = %d", rec.Code)
+	}
+}
+
+// drained waits up to a second for every worker in the pool to exit.
+func drained(pool *workerPool) bool {
+	abort := make(chan struct{})
+	timer := time.AfterFunc(time.Second, func() { close(abort) })
+	defer timer.Stop()
+	return pool.waitEmpty(abort)
+}
+
+// failingWorkers is a run func for a workerPool whose workers fail, or
+// panic, right away until healthy is set.
+type failingWorkers struct {
+	runs    atomic.Int32
+	panics  bool
+	healthy atomic.Bool
+}
+
+func (f *failingWorkers) run(ctx context.Context, id int) error {
+	f.runs.Add(1)
+	if f.healthy.Load() {
+		<-ctx.Done()
+		return nil
+	}
+	if f.panics {
+		panic("bad page")
+	}
+	return errors.New("redis went away")
+}
+
+func TestWorkerPoolFailureStopsUnsupervised(t *testing.T) {
+	fail := &failingWorkers{}
+	pool := newWorkerPool(context.Background(), fail.run, discardLogger)
+	pool.restartBackoff = time.Millisecond
+	pool.scale(2)
+
+	if !drained(pool) {
+		t.Fatal("pool kept running after a worker failed")
+	}
+	if err := pool.err(); err == nil || !strings.Contains(err.Error(), "redis went away") {
+		t.Errorf("err = %v, want the worker's error", err)
+	}
+	if runs := fail.runs.Load(); runs > 2 {
+		t.Errorf("workers ran %d times, want no restarts", runs)
+	}
+}
+
+func TestWorkerPoolSupervisedRestartsWorkers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fail := &failingWorkers{panics: true}
+	pool := newWorkerPool(ctx, fail.run, discardLogger)
+	pool.restartBackoff = time.Millisecond
+	pool.supervised(0)
+	pool.scale(1)
+
+	// a panicking worker is caught and restarted until it recovers
+	waitFor(t, "restarts", func() bool { return fail.runs.Load() >= 3 })
+	fail.healthy.Store(true)
+	runs := fail.runs.Load()
+	waitFor(t, "a healthy run", func() bool { return fail.runs.Load() > runs })
+	if pool.size() != 1 {
+		t.Errorf("size = %d, want the worker still running", pool.size())
+	}
+	if err := pool.err(); err != nil {
+		t.Errorf("err = %v, want none without a failure limit", err)
+	}
+
+	cancel()
+	if !drained(pool) {
+		t.Fatal("pool did not stop on cancel")
+	}
+}
+
+func TestWorkerPoolSupervisedGivesUp(t *testing.T) {
+	fail := &failingWorkers{}
+	pool := newWorkerPool(context.Background(), fail.run, discardLogger)
+	pool.restartBackoff = time.Millisecond
+	pool.supervised(5)
+	pool.scale(2)
+
+	if !drained(pool) {
+		t.Fatal("pool kept running past the failure limit")
+	}
+	if err := pool.err(); err == nil || !strings.Contains(err.Error(), "limit of 5") {
+		t.Errorf("err = %v, want the failure limit", err)
+	}
+	if runs := fail.runs.Load(); runs < 5 {
+		t.Errorf("workers ran %d times, want restarts up to the limit", runs)
+	}
+}
+
+func TestCrawlReturnsWorkerFailure(t *testing.T) {
+	app, _ := newTestApp(t)
+	app.config.numCrawlers = 2
+	fail := &failingWorkers{}
+	app.workers = newWorkerPool(context.Background(), fail.run, app.logger)
+
+	done := make(chan error)
+	go func() { done <- app.crawl(context.Background()) }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("crawl = nil, want the worker failure")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("crawl did not return after a worker failed")
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"container/heap"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+
+	"mycelium/pkg/mycelium"
+)
+
+const (
+	exportScanBatch     = 10000
+	exportChunkSize     = 1000000
+	exportProgressEvery = 1000000
+)
+
+// exportCheckpoint records how far an export got. Chunks hold everything
+// scanned before cursor, so a resumed export continues from cursor and only
+// rescans what was buffered but not yet flushed.
+type exportCheckpoint struct {
+	Cursor  uint64   `json:"cursor"`
+	Scanned int64    `json:"scanned"`
+	Chunks  []string `json:"chunks"`
+}
+
+// exportVisited streams the visited set into out as a sorted newline list,
+// or as per registrable domain counts when summary is set. Memory is bounded
+// by spilling sorted chunks to disk and merging them at the end. Output is
+// gzipped when out ends in .gz.
+//
+// Summary chunks hold "domain\turl" lines rather than running counts, so a
+// url SSCAN returns twice is still only counted once by the merge.
+func exportVisited(ctx context.Context, rc *mycelium.RedisCache, out string, summary bool) error {
+	checkpointPath := out + ".checkpoint"
+	cp, err := loadCheckpoint(checkpointPath)
+	if err != nil {
+		return err
+	}
+	if cp.Scanned > 0 {
+		fmt.Fprintf(os.Stderr, "resuming export at cursor %d (%d scanned)\n", cp.Cursor, cp.Scanned)
+	}
+
+	var lines []string
+
+	flush := func(cursor uint64) error {
+		if len(lines) == 0 {
+			cp.Cursor = cursor
+			return saveCheckpoint(checkpointPath, cp)
+		}
+		chunk, err := writeChunk(out, len(cp.Chunks), lines)
+		if err != nil {
+			return err
+		}
+		lines = lines[:0]
+		cp.Chunks = append(cp.Chunks, chunk)
+		cp.Cursor = cursor
+		return saveCheckpoint(checkpointPath, cp)
+	}
+
+	cursor := cp.Cursor
+	for {
+		members, next, err := rc.ScanVisited(ctx, cursor, exportScanBatch)
+		if err != nil {
+			return fmt.Errorf("failed to scan visited set: %w", err)
+		}
+
+		for _, member := range members {
+			if summary {
+				lines = append(lines, registrableDomainOf(member)+"\t"+member)
+			} else {
+				lines = append(lines, member)
+			}
+			cp.Scanned++
+			if cp.Scanned%exportProgressEvery == 0 {
+				fmt.Fprintf(os.Stderr, "scanned %d\n", cp.Scanned)
+			}
+		}
+
+		if next == 0 {
+			if err := flush(0); err != nil {
+				return err
+			}
+			break
+		}
+		if len(lines) >= exportChunkSize {
+			if err := flush(next); err != nil {
+				return err
+			}
+		}
+		cursor = next
+	}
+
+	fmt.Fprintf(os.Stderr, "scanned %d, merging %d chunks\n", cp.Scanned, len(cp.Chunks))
+	if err := mergeChunks(out, cp.Chunks, summary); err != nil {
+		return err
+	}
+
+	for _, chunk := range cp.Chunks {
+		os.Remove(chunk)
+	}
+	return os.Remove(checkpointPath)
+}
+
+func registrableDomainOf(rawUrl string) string {
+	// cheap host extraction, the visited set only holds absolute urls
+	host := rawUrl
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	if i := strings.IndexAny(host, "/?#"); i >= 0 {
+		host = host[:i]
+	}
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		host = host[i+1:]
+	}
+	if i := strings.LastIndex(host, ":"); i >= 0 && !strings.HasSuffix(host, "]") {
+		host = host[:i]
+	}
+	return mycelium.RegistrableDomain(host)
+}
+
+func loadCheckpoint(path string) (*exportCheckpoint, error) {
+	var cp exportCheckpoint
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &cp, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint %s: %w", path, err)
+	}
+	return &cp, nil
+}
+
+func saveCheckpoint(path string, cp *exportCheckpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	// write then rename so a crash never leaves a truncated checkpoint
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+func writeChunk(out string, n int, lines []string) (string, error) {
+	sort.Strings(lines)
+	path := fmt.Sprintf("%s.chunk%04d", out, n)
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create chunk: %w", err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for _, line := range lines {
+		w.WriteString(line)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		return "", fmt.Errorf("failed to write chunk: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("failed to write chunk: %w", err)
+	}
+	return path, nil
+}
+
+type chunkLine struct {
+	line  string
+	chunk int
+}
+
+type chunkHeap []chunkLine
+
+func (h chunkHeap) Len() int           { return len(h) }
+func (h chunkHeap) Less(i, j int) bool { return h[i].line < h[j].line }
+func (h chunkHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *chunkHeap) Push(x any)        { *h = append(*h, x.(chunkLine)) }
+func (h *chunkHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// mergeChunks k-way merges the sorted chunks into out, dropping duplicate
+// lines (SSCAN may return a member twice). Summaries count the urls of each
+// domain. It only returns nil once out is completely written, since the
+// chunks are removed after.
+func mergeChunks(out string, chunks []string, summary bool) error {
+	f, err := os.Create(out)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", out, err)
+	}
+	// only for the error returns, the close that completes out is checked
+	defer f.Close()
+
+	var gz *gzip.Writer
+	var dst io.Writer = f
+	if strings.HasSuffix(out, ".gz") {
+		gz = gzip.NewWriter(f)
+		dst = gz
+	}
+	w := bufio.NewWriter(dst)
+
+	scanners := make([]*bufio.Scanner, len(chunks))
+	h := &chunkHeap{}
+	for i, chunk := range chunks {
+		cf, err := os.Open(chunk)
+		if err != nil {
+			return fmt.Errorf("failed to open chunk: %w", err)
+		}
+		defer cf.Close()
+		scanners[i] = bufio.NewScanner(cf)
+		scanners[i].Buffer(make([]byte, 64*1024), 1024*1024)
+		if scanners[i].Scan() {
+			heap.Push(h, chunkLine{line: scanners[i].Text(), chunk: i})
+		}
+	}
+
+	prev, prevLine := "", ""
+	var total int64
+	emit := func() {
+		if prev == "" {
+			return
+		}
+		if summary {
+			fmt.Fprintf(w, "%s\t%d\n", prev, total)
+		} else {
+			w.WriteString(prev)
+			w.WriteByte('\n')
+		}
+	}
+
+	for h.Len() > 0 {
+		next := heap.Pop(h).(chunkLine)
+		if next.line != prevLine {
+			prevLine = next.line
+			key := next.line
+			if summary {
+				key, _, _ = strings.Cut(next.line, "\t")
+			}
+			if key != prev {
+				emit()
+				prev, total = key, 0
+			}
+			total++
+		}
+
+		if s := scanners[next.chunk]; s.Scan() {
+			heap.Push(h, chunkLine{line: s.Text(), chunk: next.chunk})
+		}
+	}
+	emit()
+
+	for i, s := range scanners {
+		if err := s.Err(); err != nil {
+			return fmt.Errorf("failed to read chunk %s: %w", chunks[i], err)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", out, err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return fmt.Errorf("failed to write %s: %w", out, err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", out, err)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"mycelium/internal/cache"
+)
+
+func newVisitedCache(t *testing.T, members ...string) *cache.CrawlerCache {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	if len(members) > 0 {
+		mr.SAdd("visited", members...)
+	}
+	rc, err := cache.NewRedisCache(context.Background(), &cache.CrawlerCacheOptions{Addr: mr.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rc.Close() })
+	return rc
+}
+
+func readExport(t *testing.T, path string) string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = gz
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+var visitedMembers = []string{
+	"https://www.example.com/b",
+	"https://example.com/a",
+	"http://blog.example.co.uk:8080/post",
+	"https://example.org/",
+	"https://shop.example.com/cart?id=1",
+}
+
+func TestExportVisited(t *testing.T) {
+	for _, name := range []string{"visited.txt", "visited.txt.gz"} {
+		t.Run(name, func(t *testing.T) {
+			rc := newVisitedCache(t, visitedMembers...)
+			out := filepath.Join(t.TempDir(), name)
+			if err := exportVisited(context.Background(), rc, out, false); err != nil {
+				t.Fatal(err)
+			}
+
+			want := "http://blog.example.co.uk:8080/post\n" +
+				"https://example.com/a\n" +
+				"https://example.org/\n" +
+				"https://shop.example.com/cart?id=1\n" +
+				"https://www.example.com/b\n"
+			if got := readExport(t, out); got != want {
+				t.Errorf("export = %q, want %q", got, want)
+			}
+			// chunks and the checkpoint are cleaned up
+			if entries, _ := os.ReadDir(filepath.Dir(out)); len(entries) != 1 {
+				t.Errorf("left %d files behind, want only the export", len(entries)-1)
+			}
+		})
+	}
+}
+
+func TestExportVisitedSummary(t *testing.T) {
+	rc := newVisitedCache(t, visitedMembers...)
+	out := filepath.Join(t.TempDir(), "summary.txt")
+	if err := exportVisited(context.Background(), rc, out, true); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "example.co.uk\t1\n" +
+		"example.com\t3\n" +
+		"example.org\t1\n"
+	if got := readExport(t, out); got != want {
+		t.Errorf("summary = %q, want %q", got, want)
+	}
+}
+
+func TestExportVisitedEmpty(t *testing.T) {
+	rc := newVisitedCache(t)
+	out := filepath.Join(t.TempDir(), "visited.txt")
+	if err := exportVisited(context.Background(), rc, out, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := readExport(t, out); got != "" {
+		t.Errorf("export = %q, want nothing", got)
+	}
+}
+
+// TestMergeChunksDropsDuplicates covers a member SSCAN returned twice, once
+// on each side of a chunk flush.
+func TestMergeChunksDropsDuplicates(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		summary bool
+		chunks  [][]string
+		want    string
+	}{
+		{
+			name:   "list",
+			chunks: [][]string{{"https://a.example/", "https://b.example/"}, {"https://b.example/", "https://c.example/"}},
+			want:   "https://a.example/\nhttps://b.example/\nhttps://c.example/\n",
+		},
+		{
+			name:    "summary",
+			summary: true,
+			chunks: [][]string{
+				{"a.example\thttps://a.example/1", "a.example\thttps://a.example/2", "b.example\thttps://b.example/"},
+				{"a.example\thttps://a.example/2", "a.example\thttps://a.example/3", "b.example\thttps://b.example/"},
+			},
+			want: "a.example\t3\nb.example\t1\n",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			out := filepath.Join(t.TempDir(), "out.txt")
+			var paths []string
+			for i, lines := range tt.chunks {
+				path, err := writeChunk(out, i, lines)
+				if err != nil {
+					t.Fatal(err)
+				}
+				paths = append(paths, path)
+			}
+			if err := mergeChunks(out, paths, tt.summary); err != nil {
+				t.Fatal(err)
+			}
+			if got := readExport(t, out); got != tt.want {
+				t.Errorf("merged %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeChunksReportsWriteErrors(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("no /dev/full:", err)
+	}
+	chunk, err := writeChunk(filepath.Join(t.TempDir(), "out.txt"), 0, []string{"https://a.example/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the few bytes stay buffered until the final flush, which must fail
+	if err := mergeChunks("/dev/full", []string{chunk}, false); err == nil {
+		t.Error("mergeChunks into a full disk = nil, want the write error")
+	}
+}
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.txt.checkpoint")
+	cp, err := loadCheckpoint(path)
+	if err != nil || cp.Cursor != 0 || cp.Scanned != 0 {
+		t.Fatalf("missing checkpoint = %+v, %v, want a fresh start", cp, err)
+	}
+
+	want := &exportCheckpoint{Cursor: 42, Scanned: 1000, Chunks: []string{"out.txt.chunk0000"}}
+	if err := saveCheckpoint(path, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Cursor != want.Cursor || got.Scanned != want.Scanned || len(got.Chunks) != 1 || got.Chunks[0] != want.Chunks[0] {
+		t.Errorf("checkpoint = %+v, want %+v", got, want)
+	}
+}
+
+func TestRegistrableDomainOf(t *testing.T) {
+	for rawUrl, want := range map[string]string{
+		"https://www.example.com/a":          "example.com",
+		"http://user@blog.example.co.uk:80/": "example.co.uk",
+		"https://example.org?q=1":            "example.org",
+	} {
+		if got := registrableDomainOf(rawUrl); got != want {
+			t.Errorf("registrableDomainOf(%q) = %q, want %q", rawUrl, got, want)
+		}
+	}
+}
+
+func TestEnvInt(t *testing.T) {
+	t.Setenv("REDIS_DB", "")
+	if db, err := envInt("REDIS_DB", 0); err != nil || db != 0 {
+		t.Errorf("unset REDIS_DB = %d, %v, want 0", db, err)
+	}
+	t.Setenv("REDIS_DB", "3")
+	if db, err := envInt("REDIS_DB", 0); err != nil || db != 3 {
+		t.Errorf("REDIS_DB=3 = %d, %v, want 3", db, err)
+	}
+	t.Setenv("REDIS_DB", "three")
+	if _, err := envInt("REDIS_DB", 0); err == nil || !strings.Contains(err.Error(), "REDIS_DB") {
+		t.Errorf("REDIS_DB=three error = %v, want one naming the variable", err)
+	}
+}
@@ -3,39 +3,217 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
+	"net/http"
 	"net/url"
 	"os"
+	"strconv"
+	"strings"
 
-	"mycelium/internal/crawler"
+	"mycelium/internal/version"
+	"mycelium/pkg/mycelium"
 )
 
+type queued struct {
+	loc   *url.URL
+	depth int
+}
+
 func main() {
 	var location string
 	var output string
+	var depth int
+	var maxPages int
+	var format string
 
 	flag.StringVar(&location, "url", "", "url to crawl")
-	flag.StringVar(&output, "out", "./out.json", "output file")
-	flag.Parse()
+	flag.StringVar(&output, "out", "./out.json", "output file, - for stdout (json files are numbered per page when following links)")
+	flag.StringVar(&format, "format", formatJSON, "output format (json, text, jsonl)")
+	flag.IntVar(&depth, "depth", 0, "follow links this many hops from the starting url")
+	flag.IntVar(&maxPages, "max-pages", 50, "stop after fetching this many pages when following links")
+	printVersion := flag.Bool("version", false, "print version information and exit")
 
-	parsedUrl, err := url.Parse(location)
+	var method string
+	var body string
+	header := http.Header{}
+	flag.StringVar(&method, "method", "", "request the url with this method and write the raw response body to -out instead of a parsed page")
+	flag.StringVar(&body, "body", "", "request body to send, implies -method POST when -method is not set")
+	flag.Func("header", "extra request header as \"Name: value\", may be repeated", func(value string) error {
+		name, val, ok := strings.Cut(value, ":")
+		if !ok {
+			return fmt.Errorf("expected \"Name: value\", got %q", value)
+		}
+		header.Add(strings.TrimSpace(name), strings.TrimSpace(val))
+		return nil
+	})
+
+	var exportPath string
+	var summary bool
+	var redisOptions mycelium.RedisOptions
+	flag.StringVar(&exportPath, "export-visited", "", "write the sorted visited set to this file (gzipped if it ends in .gz) instead of fetching")
+	flag.BoolVar(&summary, "summary", false, "with -export-visited, write counts per registrable domain instead of urls")
+	flag.StringVar(&redisOptions.Addr, "redisAddr", envOr("REDIS_ADDR", "localhost:6379"), "redis address for -export-visited")
+	flag.StringVar(&redisOptions.Pass, "redisPass", os.Getenv("REDIS_PASS"), "redis password for -export-visited")
+	redisDB, err := envInt("REDIS_DB", 0)
 	if err != nil {
 		panic(err)
 	}
+	flag.IntVar(&redisOptions.DB, "redisDB", redisDB, "redis database for -export-visited")
+	visitedShards, err := envInt("REDIS_VISITED_SHARDS", 0)
+	if err != nil {
+		panic(err)
+	}
+	flag.IntVar(&redisOptions.VisitedShards, "visitedShards", visitedShards, "keys the visited set is split across, for -export-visited")
+	flag.Parse()
+
+	if *printVersion {
+		fmt.Println(version.String())
+		return
+	}
 
-	c := *crawler.NewCrawler(nil, nil)
+	if exportPath != "" {
+		ctx := context.Background()
+		rc, err := mycelium.NewRedisCache(ctx, &redisOptions)
+		if err != nil {
+			panic(err)
+		}
+		defer rc.Close()
+		if err := exportVisited(ctx, rc, exportPath, summary); err != nil {
+			panic(err)
+		}
+		return
+	}
 
-	page, err := c.GetPage(context.Background(), parsedUrl)
+	parsedUrl, err := url.Parse(location)
 	if err != nil {
 		panic(err)
 	}
 
-	data, err := page.Marshal()
+	uaChooser, err := mycelium.NewDefaultHeaderChooser()
 	if err != nil {
 		panic(err)
 	}
 
-	err = os.WriteFile(output, data, 0755)
+	// no cache or store: pages are fetched directly and written to disk here
+	c := mycelium.NewCrawler(nil, nil,
+		mycelium.WithHeaderChooser(uaChooser),
+		mycelium.WithUrlFilters(mycelium.NewDefaultFilterChain()),
+		mycelium.WithUrlRewriters(mycelium.NewQueryParamStripper(mycelium.DefaultStrippedParams)),
+	)
+
+	if method != "" || body != "" || len(header) > 0 {
+		if method == "" && body != "" {
+			method = http.MethodPost
+		}
+		req := mycelium.FetchRequest{Method: method, URL: parsedUrl, Header: header}
+		if body != "" {
+			req.Body = []byte(body)
+		}
+		if err := fetch(c, req, output); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	pw, err := newPageWriter(format, output, depth > 0)
 	if err != nil {
 		panic(err)
 	}
+
+	if depth <= 0 {
+		page, err := c.GetPage(context.Background(), parsedUrl)
+		if err != nil {
+			panic(err)
+		}
+		err = pw.write(page)
+		if err != nil {
+			panic(err)
+		}
+	} else if err := crawl(c, parsedUrl, depth, maxPages, pw); err != nil {
+		panic(err)
+	}
+
+	if err := pw.close(); err != nil {
+		panic(err)
+	}
+}
+
+// fetch makes a single request with Fetch and writes the response body to
+// out as is.
+func fetch(c *mycelium.Crawler, req mycelium.FetchRequest, out string) error {
+	res, err := c.Fetch(context.Background(), req)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%d %s (%d bytes)\n", res.StatusCode, res.URL, len(res.Body))
+	if out == "-" {
+		_, err = os.Stdout.Write(res.Body)
+		return err
+	}
+	return os.WriteFile(out, res.Body, 0644)
+}
+
+// crawl does a breadth first walk from start using GetPage directly, with an
+// in-memory visited set instead of redis. Urls are rewritten like the
+// crawler does before they are deduped.
+func crawl(c *mycelium.Crawler, start *url.URL, maxDepth int, maxPages int, pw *pageWriter) error {
+	start = c.Rewrite(start)
+	visited := map[string]bool{start.String(): true}
+	queue := []queued{{loc: start}}
+	fetched := 0
+
+	for len(queue) > 0 && fetched < maxPages {
+		curr := queue[0]
+		queue = queue[1:]
+
+		page, err := c.GetPage(context.Background(), curr.loc)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to get page %s: %s\n", curr.loc, err.Error())
+			continue
+		}
+		fetched++
+
+		if err := pw.write(page); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "[%d] depth %d %s\n", fetched, curr.depth, curr.loc)
+
+		if curr.depth >= maxDepth {
+			continue
+		}
+		for i := range page.Links {
+			link := c.Rewrite(&page.Links[i])
+			if visited[link.String()] {
+				continue
+			}
+			visited[link.String()] = true
+			if blocked, _ := c.Blocked(link); blocked {
+				continue
+			}
+			queue = append(queue, queued{loc: link, depth: curr.depth + 1})
+		}
+	}
+
+	return nil
+}
+
+func envOr(name string, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// envInt returns the integer in the environment variable name, or fallback
+// when it is unset.
+func envInt(name string, fallback int) (int, error) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return value, nil
 }
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"mycelium/pkg/mycelium"
+)
+
+func TestCrawlDedupesRewrittenUrls(t *testing.T) {
+	var mu sync.Mutex
+	fetched := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched[r.URL.Path]++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<html><body><a href="http://%[1]s/?utm_medium=x">home</a><a href="http://%[1]s/b">b</a></body></html>`, r.Host)
+	}))
+	defer srv.Close()
+
+	c := mycelium.NewCrawler(nil, nil, mycelium.WithUrlRewriters(mycelium.NewQueryParamStripper(mycelium.DefaultStrippedParams)))
+	start, err := url.Parse(srv.URL + "/?utm_source=y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw, err := newPageWriter(formatJSONL, filepath.Join(t.TempDir(), "pages.jsonl"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crawl(c, start, 2, 10, pw); err != nil {
+		t.Fatal(err)
+	}
+	if err := pw.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if fetched["/"] != 1 || fetched["/b"] != 1 {
+		t.Errorf("fetched %v, want each page once", fetched)
+	}
+}
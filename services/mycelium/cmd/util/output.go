@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"mycelium/pkg/mycelium"
+)
+
+const (
+	formatJSON  = "json"
+	formatText  = "text"
+	formatJSONL = "jsonl"
+)
+
+// pageWriter writes fetched pages in the selected format. An out of "-"
+// means stdout. json output to a file gets one file per page, numbered when
+// more than one page may be written; text and jsonl share a single output.
+type pageWriter struct {
+	format   string
+	out      string
+	numbered bool
+	count    int
+	file     *os.File
+	w        *bufio.Writer
+}
+
+func newPageWriter(format string, out string, numbered bool) (*pageWriter, error) {
+	pw := &pageWriter{format: format, out: out, numbered: numbered}
+	switch format {
+	case formatJSON:
+		if out != "-" {
+			return pw, nil
+		}
+	case formatText, formatJSONL:
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected json, text or jsonl", format)
+	}
+
+	if out == "-" {
+		pw.w = bufio.NewWriter(os.Stdout)
+		return pw, nil
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return nil, err
+	}
+	pw.file = f
+	pw.w = bufio.NewWriter(f)
+	return pw, nil
+}
+
+func (pw *pageWriter) write(page *mycelium.Page) error {
+	pw.count++
+
+	if pw.format == formatText {
+		_, err := io.WriteString(pw.w, page.String())
+		return err
+	}
+
+	data, err := page.Marshal()
+	if err != nil {
+		return err
+	}
+	if pw.w == nil {
+		path := pw.out
+		if pw.numbered {
+			path = numberedPath(path, pw.count)
+		}
+		return os.WriteFile(path, data, 0755)
+	}
+	if _, err := pw.w.Write(data); err != nil {
+		return err
+	}
+	return pw.w.WriteByte('\n')
+}
+
+func (pw *pageWriter) close() error {
+	if pw.w == nil {
+		return nil
+	}
+	if err := pw.w.Flush(); err != nil {
+		return err
+	}
+	if pw.file != nil {
+		return pw.file.Close()
+	}
+	return nil
+}
+
+// numberedPath turns out.json into out-0001.json.
+func numberedPath(path string, n int) string {
+	ext := ""
+	if i := strings.LastIndex(path, "."); i > strings.LastIndex(path, "/") {
+		path, ext = path[:i], path[i:]
+	}
+	return fmt.Sprintf("%s-%04d%s", path, n, ext)
+}
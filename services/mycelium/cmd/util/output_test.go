@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mycelium/internal/crawler"
+)
+
+func testPage(t *testing.T, loc string) *crawler.Page {
+	t.Helper()
+	location, err := url.Parse(loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link, err := url.Parse(loc + "next")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &crawler.Page{
+		Title:    "Title",
+		Keywords: []string{"one", "two"},
+		Content:  []string{"Some text"},
+		Links:    []url.URL{*link},
+		Location: location,
+	}
+}
+
+func writePages(t *testing.T, format string, out string, numbered bool, pages ...*crawler.Page) {
+	t.Helper()
+	pw, err := newPageWriter(format, out, numbered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, page := range pages {
+		if err := pw.write(page); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pw.close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func unmarshalFile(t *testing.T, path string) *crawler.Page {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := crawler.UnmarshalPage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return page
+}
+
+func TestJSONOutputRoundTrips(t *testing.T) {
+	page := testPage(t, "https://example.com/")
+	out := filepath.Join(t.TempDir(), "out.json")
+	writePages(t, formatJSON, out, false, page)
+
+	if got := unmarshalFile(t, out); !reflect.DeepEqual(got, page) {
+		t.Errorf("round trip = %+v, want %+v", got, page)
+	}
+}
+
+func TestJSONOutputNumbersPages(t *testing.T) {
+	dir := t.TempDir()
+	first, second := testPage(t, "https://example.com/"), testPage(t, "https://example.org/")
+	writePages(t, formatJSON, filepath.Join(dir, "out.json"), true, first, second)
+
+	if got := unmarshalFile(t, filepath.Join(dir, "out-0001.json")); !reflect.DeepEqual(got, first) {
+		t.Errorf("first page = %+v, want %+v", got, first)
+	}
+	if got := unmarshalFile(t, filepath.Join(dir, "out-0002.json")); !reflect.DeepEqual(got, second) {
+		t.Errorf("second page = %+v, want %+v", got, second)
+	}
+}
+
+func TestJSONLOutputRoundTrips(t *testing.T) {
+	pages := []*crawler.Page{testPage(t, "https://example.com/"), testPage(t, "https://example.org/")}
+	out := filepath.Join(t.TempDir(), "out.jsonl")
+	writePages(t, formatJSONL, out, true, pages...)
+
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var got []*crawler.Page
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		page, err := crawler.UnmarshalPage(scanner.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, page)
+	}
+	if !reflect.DeepEqual(got, pages) {
+		t.Errorf("read back %+v, want %+v", got, pages)
+	}
+}
+
+func TestTextOutput(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.txt")
+	writePages(t, formatText, out, false, testPage(t, "https://example.com/"))
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"PAGE: https://example.com/", "Title: Title", "  - one"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("text output missing %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if _, err := newPageWriter("xml", "-", false); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
+
+func TestNumberedPath(t *testing.T) {
+	for path, want := range map[string]string{
+		"out.json":          "out-0003.json",
+		"dir.d/out":         "dir.d/out-0003",
+		"/tmp/pages.v1.txt": "/tmp/pages.v1-0003.txt",
+	} {
+		if got := numberedPath(path, 3); got != want {
+			t.Errorf("numberedPath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+)
+
+// SpendDomainBudget counts one more page for domain in the current run and
+// returns the total so far.
+func (rc *CrawlerCache) SpendDomainBudget(ctx context.Context, domain string) (int64, error) {
+	spent, err := rc.rdb.HIncrBy(ctx, "domainbudget", domain, 1).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to spend domain budget: %w", err)
+	}
+	return spent, nil
+}
+
+// RefundDomainBudget gives back a page counted for domain that was not
+// crawled after all.
+func (rc *CrawlerCache) RefundDomainBudget(ctx context.Context, domain string) error {
+	if err := rc.rdb.HIncrBy(ctx, "domainbudget", domain, -1).Err(); err != nil {
+		return fmt.Errorf("failed to refund domain budget: %w", err)
+	}
+	return nil
+}
+
+// ResetDomainBudget starts a new run by forgetting every domain's spend.
+func (rc *CrawlerCache) ResetDomainBudget(ctx context.Context) error {
+	if err := rc.rdb.Del(ctx, "domainbudget").Err(); err != nil {
+		return fmt.Errorf("failed to reset domain budget: %w", err)
+	}
+	return nil
+}
+
+// DomainBudgetSpent returns the pages counted against each domain in the
+// current run.
+func (rc *CrawlerCache) DomainBudgetSpent(ctx context.Context) (map[string]string, error) {
+	spent, err := rc.rdb.HGetAll(ctx, "domainbudget").Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read domain budget: %w", err)
+	}
+	return spent, nil
+}
@@ -0,0 +1,32 @@
+package cache
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDomainBudget(t *testing.T) {
+	rc, _ := newTestCache(t)
+	ctx := context.Background()
+
+	for want := int64(1); want <= 3; want++ {
+		if spent, err := rc.SpendDomainBudget(ctx, "example.com"); err != nil || spent != want {
+			t.Fatalf("SpendDomainBudget = %d, %v, want %d", spent, err, want)
+		}
+	}
+	if err := rc.RefundDomainBudget(ctx, "example.com"); err != nil {
+		t.Fatal(err)
+	}
+	rc.SpendDomainBudget(ctx, "example.org")
+	spent, err := rc.DomainBudgetSpent(ctx)
+	if err != nil || spent["example.com"] != "2" || spent["example.org"] != "1" {
+		t.Errorf("DomainBudgetSpent = %v, %v", spent, err)
+	}
+
+	if err := rc.ResetDomainBudget(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if spent, _ := rc.SpendDomainBudget(ctx, "example.com"); spent != 1 {
+		t.Errorf("spent %d after a reset, want 1", spent)
+	}
+}
@@ -2,22 +2,33 @@ package cache
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/redis/go-redis/v9"
 )
 
+// ErrQueueEmpty is returned by blocking pops that timed out with nothing to
+// pop.
+var ErrQueueEmpty = errors.New("no items available in queue")
+
 type CrawlerCache struct {
-	rdb *redis.Client
+	rdb           *redis.Client
+	visitedShards int
 }
 
 type CrawlerCacheOptions struct {
 	Addr string
 	Pass string
 	DB   int
+	// VisitedShards splits the visited set into this many keys by hash of
+	// the registrable domain. Below two keeps the single "visited" key.
+	// Every process sharing the cache must agree on it; MigrateVisited
+	// moves an existing set when it changes.
+	VisitedShards int
 }
 
 func NewRedisCache(ctx context.Context, options *CrawlerCacheOptions) (*CrawlerCache, error) {
-	var rc CrawlerCache
+	rc := CrawlerCache{visitedShards: options.VisitedShards}
 
 	rc.rdb = redis.NewClient(&redis.Options{
 		Addr:         options.Addr,
@@ -34,3 +45,11 @@ func NewRedisCache(ctx context.Context, options *CrawlerCacheOptions) (*CrawlerC
 
 	return &rc, nil
 }
+
+func (rc *CrawlerCache) Ping(ctx context.Context) error {
+	return rc.rdb.Ping(ctx).Err()
+}
+
+func (rc *CrawlerCache) Close() error {
+	return rc.rdb.Close()
+}
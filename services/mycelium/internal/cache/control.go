@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ControlState returns the fleet control state stored at key, or "" when
+// none is set.
+func (rc *CrawlerCache) ControlState(ctx context.Context, key string) (string, error) {
+	state, err := rc.rdb.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read control state: %w", err)
+	}
+	return state, nil
+}
+
+// SetControlState stores state at key. An empty state clears it.
+func (rc *CrawlerCache) SetControlState(ctx context.Context, key string, state string) error {
+	var err error
+	if state == "" {
+		err = rc.rdb.Del(ctx, key).Err()
+	} else {
+		err = rc.rdb.Set(ctx, key, state, 0).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set control state: %w", err)
+	}
+	return nil
+}
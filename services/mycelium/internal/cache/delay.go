@@ -0,0 +1,32 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DelayItem holds an ingress item until it may be crawled at until.
+func (rc *CrawlerCache) DelayItem(ctx context.Context, itemJSON string, until time.Time) error {
+	err := rc.rdb.ZAdd(ctx, "delayed", redis.Z{Score: float64(until.Unix()), Member: itemJSON}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to delay item: %w", err)
+	}
+	return nil
+}
+
+// DueDelayedItems claims up to limit delayed items that may be crawled at
+// now, like DueRecrawls.
+func (rc *CrawlerCache) DueDelayedItems(ctx context.Context, now time.Time, limit int64) ([]string, error) {
+	due, err := rc.claimDue(ctx, "delayed", now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim delayed items: %w", err)
+	}
+	return due, nil
+}
+
+func (rc *CrawlerCache) DelayedItems(ctx context.Context) (int64, error) {
+	return rc.rdb.ZCard(ctx, "delayed").Result()
+}
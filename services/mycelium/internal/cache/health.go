@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RecordDomainOutcome counts outcome for domain and returns the counts of
+// every outcome over the sliding window ending at now. The window is two
+// fixed buckets, with the previous one weighted by how much of it still
+// overlaps the window.
+func (rc *CrawlerCache) RecordDomainOutcome(ctx context.Context, domain string, outcome string, now time.Time, window time.Duration) (map[string]int64, error) {
+	bucketSeconds := int64(window / time.Second)
+	if bucketSeconds < 1 {
+		return nil, fmt.Errorf("domain health window must be at least a second, got %s", window)
+	}
+	bucket := now.Unix() / bucketSeconds
+	currentKey := "domainhealth:" + domain + ":" + strconv.FormatInt(bucket, 10)
+	previousKey := "domainhealth:" + domain + ":" + strconv.FormatInt(bucket-1, 10)
+
+	var current, previous *redis.MapStringStringCmd
+	_, err := rc.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(ctx, currentKey, outcome, 1)
+		pipe.Expire(ctx, currentKey, 2*window)
+		current = pipe.HGetAll(ctx, currentKey)
+		previous = pipe.HGetAll(ctx, previousKey)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record domain outcome: %w", err)
+	}
+
+	elapsed := float64(now.Unix()%bucketSeconds) / float64(bucketSeconds)
+	counts := map[string]int64{}
+	for name, raw := range previous.Val() {
+		n, _ := strconv.ParseFloat(raw, 64)
+		counts[name] += int64(n * (1 - elapsed))
+	}
+	for name, raw := range current.Val() {
+		n, _ := strconv.ParseInt(raw, 10, 64)
+		counts[name] += n
+	}
+	return counts, nil
+}
+
+// AddToAutoBlacklist blacklists domain until the given time. The set is a
+// sorted set scored by expiry, so entries lapse without a cleanup job.
+func (rc *CrawlerCache) AddToAutoBlacklist(ctx context.Context, key string, domain string, until time.Time) error {
+	err := rc.rdb.ZAdd(ctx, key, redis.Z{Score: float64(until.Unix()), Member: domain}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to add to auto blacklist: %w", err)
+	}
+	return nil
+}
+
+func (rc *CrawlerCache) IsAutoBlacklisted(ctx context.Context, key string, domain string, now time.Time) (bool, error) {
+	until, err := rc.rdb.ZScore(ctx, key, domain).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check auto blacklist: %w", err)
+	}
+	return int64(until) > now.Unix(), nil
+}
+
+// AutoBlacklisted returns every domain still blacklisted at now, with the
+// time it will be allowed again. Expired entries are removed.
+func (rc *CrawlerCache) AutoBlacklisted(ctx context.Context, key string, now time.Time) (map[string]time.Time, error) {
+	if err := rc.rdb.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(now.Unix(), 10)).Err(); err != nil {
+		return nil, fmt.Errorf("failed to prune auto blacklist: %w", err)
+	}
+	entries, err := rc.rdb.ZRangeWithScores(ctx, key, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read auto blacklist: %w", err)
+	}
+	domains := make(map[string]time.Time, len(entries))
+	for _, entry := range entries {
+		domains[fmt.Sprint(entry.Member)] = time.Unix(int64(entry.Score), 0)
+	}
+	return domains, nil
+}
+
+func (rc *CrawlerCache) RemoveFromAutoBlacklist(ctx context.Context, key string, domain string) (bool, error) {
+	removed, err := rc.rdb.ZRem(ctx, key, domain).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to remove from auto blacklist: %w", err)
+	}
+	return removed > 0, nil
+}
@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// SetHostFold records canonical as the "scheme://host" domain folds to for
+// ttl, unless another crawler recorded one first. It returns the one in
+// effect.
+func (rc *CrawlerCache) SetHostFold(ctx context.Context, domain string, canonical string, ttl time.Duration) (string, error) {
+	set, err := rc.rdb.SetNX(ctx, hostFoldKey(domain), canonical, ttl).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to store host fold: %w", err)
+	}
+	if set {
+		return canonical, nil
+	}
+	return rc.HostFold(ctx, domain)
+}
+
+// HostFold returns the "scheme://host" domain folds to, or "" if none is
+// recorded.
+func (rc *CrawlerCache) HostFold(ctx context.Context, domain string) (string, error) {
+	canonical, err := rc.rdb.Get(ctx, hostFoldKey(domain)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read host fold: %w", err)
+	}
+	return canonical, nil
+}
+
+func hostFoldKey(domain string) string {
+	return "hostfold:" + domain
+}
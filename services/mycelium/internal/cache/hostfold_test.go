@@ -0,0 +1,28 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHostFold(t *testing.T) {
+	rc, mr := newTestCache(t)
+	ctx := context.Background()
+
+	if canonical, err := rc.HostFold(ctx, "example.com"); err != nil || canonical != "" {
+		t.Fatalf("HostFold before any = %q, %v", canonical, err)
+	}
+	if canonical, _ := rc.SetHostFold(ctx, "example.com", "https://www.example.com", time.Hour); canonical != "https://www.example.com" {
+		t.Errorf("SetHostFold = %q", canonical)
+	}
+	// the first crawler to record a fold wins
+	if canonical, _ := rc.SetHostFold(ctx, "example.com", "http://example.com", time.Hour); canonical != "https://www.example.com" {
+		t.Errorf("second SetHostFold = %q, want the first one kept", canonical)
+	}
+
+	mr.FastForward(2 * time.Hour)
+	if canonical, _ := rc.HostFold(ctx, "example.com"); canonical != "" {
+		t.Errorf("HostFold after the ttl = %q, want it forgotten", canonical)
+	}
+}
@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// releaseHostSlot only deletes the slot if it still holds our token, so a
+// release after the slot expired (and maybe went to another worker) is a
+// no-op.
+var releaseHostSlot = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// AcquireHostSlot tries to take one of slots concurrent request slots for
+// host, shared by every crawler using this redis. The slot expires after ttl
+// if it is never released. It returns the slot and the token needed to
+// release it, or ok false when every slot is taken.
+func (rc *CrawlerCache) AcquireHostSlot(ctx context.Context, host string, slots int, ttl time.Duration) (slot int, token string, ok bool, err error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return 0, "", false, fmt.Errorf("failed to generate host slot token: %w", err)
+	}
+	token = hex.EncodeToString(raw)
+
+	for slot = 0; slot < slots; slot++ {
+		acquired, err := rc.rdb.SetNX(ctx, hostSlotKey(host, slot), token, ttl).Result()
+		if err != nil {
+			return 0, "", false, fmt.Errorf("failed to acquire host slot: %w", err)
+		}
+		if acquired {
+			return slot, token, true, nil
+		}
+	}
+	return 0, "", false, nil
+}
+
+// ReleaseHostSlot frees slot for host if it still holds token.
+func (rc *CrawlerCache) ReleaseHostSlot(ctx context.Context, host string, slot int, token string) error {
+	if err := releaseHostSlot.Run(ctx, rc.rdb, []string{hostSlotKey(host, slot)}, token).Err(); err != nil {
+		return fmt.Errorf("failed to release host slot: %w", err)
+	}
+	return nil
+}
+
+func hostSlotKey(host string, slot int) string {
+	return "hostslot:" + host + ":" + strconv.Itoa(slot)
+}
@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHostSlots(t *testing.T) {
+	rc, mr := newTestCache(t)
+	ctx := context.Background()
+
+	first, firstToken, ok, err := rc.AcquireHostSlot(ctx, "example.com", 2, time.Minute)
+	if err != nil || !ok {
+		t.Fatalf("first AcquireHostSlot = %t, %v", ok, err)
+	}
+	second, _, ok, _ := rc.AcquireHostSlot(ctx, "example.com", 2, time.Minute)
+	if !ok || second == first {
+		t.Fatalf("second slot %d (ok %t), want the other slot", second, ok)
+	}
+	if _, _, ok, _ := rc.AcquireHostSlot(ctx, "example.com", 2, time.Minute); ok {
+		t.Error("acquired a third of two slots")
+	}
+	if _, _, ok, _ := rc.AcquireHostSlot(ctx, "example.org", 2, time.Minute); !ok {
+		t.Error("slots of another host were shared")
+	}
+
+	// releasing with a stale token leaves the slot alone
+	if err := rc.ReleaseHostSlot(ctx, "example.com", first, "stale"); err != nil {
+		t.Fatal(err)
+	}
+	if !mr.Exists(hostSlotKey("example.com", first)) {
+		t.Fatal("stale token released the slot")
+	}
+	if err := rc.ReleaseHostSlot(ctx, "example.com", first, firstToken); err != nil {
+		t.Fatal(err)
+	}
+	if slot, _, ok, _ := rc.AcquireHostSlot(ctx, "example.com", 2, time.Minute); !ok || slot != first {
+		t.Errorf("AcquireHostSlot = %d, %t after release, want slot %d", slot, ok, first)
+	}
+}
+
+func TestHostSlotExpires(t *testing.T) {
+	rc, mr := newTestCache(t)
+	ctx := context.Background()
+
+	slot, token, _, _ := rc.AcquireHostSlot(ctx, "example.com", 1, time.Second)
+	mr.FastForward(2 * time.Second)
+	if _, _, ok, _ := rc.AcquireHostSlot(ctx, "example.com", 1, time.Second); !ok {
+		t.Fatal("expired slot was not handed out")
+	}
+	// the late release must not free the slot the next worker holds
+	rc.ReleaseHostSlot(ctx, "example.com", slot, token)
+	if _, _, ok, _ := rc.AcquireHostSlot(ctx, "example.com", 1, time.Second); ok {
+		t.Error("a late release freed another worker's slot")
+	}
+}
@@ -0,0 +1,21 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// PopManyFromMyceliumIngress pops up to n items without blocking. It returns
+// an empty slice when the queue is empty.
+func (rc *CrawlerCache) PopManyFromMyceliumIngress(ctx context.Context, queueKey string, n int) ([]string, error) {
+	items, err := rc.rdb.LPopCount(ctx, queueKey, n).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to pop from mycelium ingress: %w", err)
+	}
+	return items, nil
+}
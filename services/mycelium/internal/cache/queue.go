@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/redis/go-redis/v9"
 	"time"
@@ -14,6 +15,21 @@ func (rc *CrawlerCache) PushToFungicide(ctx context.Context, pageJSON string, qu
 	return nil
 }
 
+// PushManyToFungicide pushes pages in a single RPUSH.
+func (rc *CrawlerCache) PushManyToFungicide(ctx context.Context, pages []string, queueKey string) error {
+	if len(pages) == 0 {
+		return nil
+	}
+	values := make([]interface{}, len(pages))
+	for i, page := range pages {
+		values[i] = page
+	}
+	if err := rc.rdb.RPush(ctx, queueKey, values...).Err(); err != nil {
+		return fmt.Errorf("failed to push to fungicide queue: %w", err)
+	}
+	return nil
+}
+
 func (rc *CrawlerCache) PushToMyceliumIngress(ctx context.Context, itemJSON string, queueKey string) error {
 	if err := rc.rdb.RPush(ctx, queueKey, itemJSON).Err(); err != nil {
 		return fmt.Errorf("failed to push to mycelium ingress queue: %w", err)
@@ -21,13 +37,34 @@ func (rc *CrawlerCache) PushToMyceliumIngress(ctx context.Context, itemJSON stri
 	return nil
 }
 
+func (rc *CrawlerCache) PushToDeadLetter(ctx context.Context, itemJSON string, queueKey string) error {
+	if err := rc.rdb.RPush(ctx, queueKey, itemJSON).Err(); err != nil {
+		return fmt.Errorf("failed to push to dead letter queue: %w", err)
+	}
+	return nil
+}
+
+// PushBounded appends itemJSON to queueKey and trims the list to its newest
+// maxLen items. A non-positive maxLen leaves it unbounded.
+func (rc *CrawlerCache) PushBounded(ctx context.Context, itemJSON string, queueKey string, maxLen int64) error {
+	pipe := rc.rdb.TxPipeline()
+	pipe.RPush(ctx, queueKey, itemJSON)
+	if maxLen > 0 {
+		pipe.LTrim(ctx, queueKey, -maxLen, -1)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to push to %s: %w", queueKey, err)
+	}
+	return nil
+}
+
 func (rc *CrawlerCache) PopFromMyceliumIngress(ctx context.Context, queueKey string) (string, error) {
 	// Use a 5-second timeout instead of blocking indefinitely
 	res, err := rc.rdb.BLPop(ctx, 5*time.Second, queueKey).Result()
 	if err != nil {
 		// If it's a timeout (no items available), return a specific error
 		if err == redis.Nil {
-			return "", fmt.Errorf("no items available in queue")
+			return "", ErrQueueEmpty
 		}
 		return "", fmt.Errorf("failed to pop from mycelium ingress: %w", err)
 	}
@@ -46,6 +83,20 @@ func (rc *CrawlerCache) IsBlacklisted(ctx context.Context, domain string, blackl
 	return res, nil
 }
 
+func (rc *CrawlerCache) AddToBlacklist(ctx context.Context, domains []string, blacklistKey string) error {
+	if len(domains) == 0 {
+		return nil
+	}
+	members := make([]interface{}, len(domains))
+	for i, d := range domains {
+		members[i] = d
+	}
+	if err := rc.rdb.SAdd(ctx, blacklistKey, members...).Err(); err != nil {
+		return fmt.Errorf("failed to add to blacklist: %w", err)
+	}
+	return nil
+}
+
 func (rc *CrawlerCache) IngressQueueSize(ctx context.Context, queueKey string) (int32, error) {
 	res, err := rc.rdb.LLen(ctx, queueKey).Result()
 	if err != nil {
@@ -53,3 +104,154 @@ func (rc *CrawlerCache) IngressQueueSize(ctx context.Context, queueKey string) (
 	}
 	return int32(res), nil
 }
+
+// queueScanBatch is how many queue items QueuedLocations fetches per round
+// trip.
+const queueScanBatch = 1000
+
+// QueuedLocations returns the locations of the items waiting in the queue,
+// whatever their other fields hold. It reads the whole queue, so callers
+// checking many urls should fetch it once.
+func (rc *CrawlerCache) QueuedLocations(ctx context.Context, queueKey string) (map[string]bool, error) {
+	locations := map[string]bool{}
+	for start := int64(0); ; start += queueScanBatch {
+		items, err := rc.rdb.LRange(ctx, queueKey, start, start+queueScanBatch-1).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to search queue: %w", err)
+		}
+		for _, itemJSON := range items {
+			var item struct {
+				Location string `json:"location"`
+			}
+			if json.Unmarshal([]byte(itemJSON), &item) == nil && item.Location != "" {
+				locations[item.Location] = true
+			}
+		}
+		if len(items) < queueScanBatch {
+			return locations, nil
+		}
+	}
+}
+
+func (rc *CrawlerCache) ClearQueue(ctx context.Context, queueKey string) error {
+	if err := rc.rdb.Del(ctx, queueKey).Err(); err != nil {
+		return fmt.Errorf("failed to clear queue: %w", err)
+	}
+	return nil
+}
+
+// PeekQueue returns up to n items from the head of the queue without
+// removing them.
+func (rc *CrawlerCache) PeekQueue(ctx context.Context, queueKey string, n int64) ([]string, error) {
+	res, err := rc.rdb.LRange(ctx, queueKey, 0, n-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to peek queue: %w", err)
+	}
+	return res, nil
+}
+
+// RemoveFromQueue deletes every item in the queue for which match returns
+// true and reports how many were removed. The queue is read in batches of
+// queueScanBatch, so only the matching items are held in memory.
+func (rc *CrawlerCache) RemoveFromQueue(ctx context.Context, queueKey string, match func(itemJSON string) bool) (int64, error) {
+	// collect before removing, removals would shift the batches being read
+	var matched []string
+	seen := map[string]bool{}
+	for start := int64(0); ; start += queueScanBatch {
+		items, err := rc.rdb.LRange(ctx, queueKey, start, start+queueScanBatch-1).Result()
+		if err != nil {
+			return 0, fmt.Errorf("failed to read queue: %w", err)
+		}
+		for _, item := range items {
+			if !seen[item] && match(item) {
+				seen[item] = true
+				matched = append(matched, item)
+			}
+		}
+		if len(items) < queueScanBatch {
+			break
+		}
+	}
+
+	var removed int64
+	for _, item := range matched {
+		n, err := rc.rdb.LRem(ctx, queueKey, 0, item).Result()
+		if err != nil {
+			return removed, fmt.Errorf("failed to remove from queue: %w", err)
+		}
+		removed += n
+	}
+	return removed, nil
+}
+
+// moveHead pops the head of KEYS[1] onto the tail of KEYS[2] as ARGV[2],
+// but only if the head is still ARGV[1], the item the rewrite was made from.
+// Another consumer popping in between makes it return 0 instead of dropping
+// or doubling an item.
+var moveHead = redis.NewScript(`
+if redis.call("LINDEX", KEYS[1], 0) ~= ARGV[1] then
+	return 0
+end
+redis.call("LPOP", KEYS[1])
+redis.call("RPUSH", KEYS[2], ARGV[2])
+return 1
+`)
+
+// MoveQueue pops every item from one queue onto the tail of another and
+// reports how many were moved. A non-nil rewrite replaces each item before
+// it is pushed.
+func (rc *CrawlerCache) MoveQueue(ctx context.Context, fromKey string, toKey string, rewrite func(item string) string) (int64, error) {
+	var moved int64
+	for {
+		if rewrite == nil {
+			err := rc.rdb.LMove(ctx, fromKey, toKey, "LEFT", "RIGHT").Err()
+			if err == redis.Nil {
+				return moved, nil
+			}
+			if err != nil {
+				return moved, fmt.Errorf("failed to move queue: %w", err)
+			}
+			moved++
+			continue
+		}
+
+		item, err := rc.rdb.LIndex(ctx, fromKey, 0).Result()
+		if err == redis.Nil {
+			return moved, nil
+		}
+		if err != nil {
+			return moved, fmt.Errorf("failed to read queue: %w", err)
+		}
+		n, err := moveHead.Run(ctx, rc.rdb, []string{fromKey, toKey}, item, rewrite(item)).Int64()
+		if err != nil {
+			return moved, fmt.Errorf("failed to move queue: %w", err)
+		}
+		// 0 when the head was popped meanwhile, then read the new head
+		moved += n
+	}
+}
+
+// MoveItems moves up to n items from the head of fromKey to the tail of
+// toKey and returns how many were moved.
+func (rc *CrawlerCache) MoveItems(ctx context.Context, fromKey string, toKey string, n int64) (int64, error) {
+	var moved int64
+	for moved < n {
+		err := rc.rdb.LMove(ctx, fromKey, toKey, "LEFT", "RIGHT").Err()
+		if err == redis.Nil {
+			break
+		}
+		if err != nil {
+			return moved, fmt.Errorf("failed to move items: %w", err)
+		}
+		moved++
+	}
+	return moved, nil
+}
+
+func (rc *CrawlerCache) BlacklistSize(ctx context.Context, blacklistKey string) (int64, error) {
+	res, err := rc.rdb.SCard(ctx, blacklistKey).Result()
+	if err != nil {
+		return -1, fmt.Errorf("failed to get blacklist size: %w", err)
+	}
+	return res, nil
+}
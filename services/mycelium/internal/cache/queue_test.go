@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestCache(t *testing.T) (*CrawlerCache, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rc, err := NewRedisCache(context.Background(), &CrawlerCacheOptions{Addr: mr.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rc.Close() })
+	return rc, mr
+}
+
+func pushAll(t *testing.T, mr *miniredis.Miniredis, key string, items ...string) {
+	t.Helper()
+	for _, item := range items {
+		if _, err := mr.RPush(key, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func list(mr *miniredis.Miniredis, key string) []string {
+	items, _ := mr.List(key)
+	return items
+}
+
+func TestMoveQueue(t *testing.T) {
+	rc, mr := newTestCache(t)
+	ctx := context.Background()
+	pushAll(t, mr, "from", "a", "b", "c")
+	pushAll(t, mr, "to", "x")
+
+	moved, err := rc.MoveQueue(ctx, "from", "to", nil)
+	if err != nil || moved != 3 {
+		t.Fatalf("MoveQueue = %d, %v, want 3", moved, err)
+	}
+	if got := strings.Join(list(mr, "to"), ","); got != "x,a,b,c" {
+		t.Errorf("to = %s, want the items appended in order", got)
+	}
+	if mr.Exists("from") {
+		t.Error("from was not emptied")
+	}
+}
+
+func TestMoveQueueRewrite(t *testing.T) {
+	rc, mr := newTestCache(t)
+	ctx := context.Background()
+	pushAll(t, mr, "from", "a", "b", "c", "d")
+
+	stolen := false
+	moved, err := rc.MoveQueue(ctx, "from", "to", func(item string) string {
+		if item == "b" && !stolen {
+			// another consumer pops b while it is being rewritten
+			stolen = true
+			if _, err := mr.Lpop("from"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return strings.ToUpper(item)
+	})
+	if err != nil || moved != 3 {
+		t.Fatalf("MoveQueue = %d, %v, want 3", moved, err)
+	}
+	if got := strings.Join(list(mr, "to"), ","); got != "A,C,D" {
+		t.Errorf("to = %s, want the rewritten items without the stolen one", got)
+	}
+	if mr.Exists("from") {
+		t.Errorf("from = %q, want it emptied", list(mr, "from"))
+	}
+}
+
+func TestRemoveFromQueue(t *testing.T) {
+	rc, mr := newTestCache(t)
+	ctx := context.Background()
+	// more than one scan batch, with duplicates across batches
+	for i := range queueScanBatch + 10 {
+		pushAll(t, mr, "queue", fmt.Sprintf(`{"location":"https://example.com/%d"}`, i%(queueScanBatch/2)))
+	}
+	pushAll(t, mr, "queue", `{"location":"https://example.org/"}`)
+
+	calls := 0
+	removed, err := rc.RemoveFromQueue(ctx, "queue", func(itemJSON string) bool {
+		calls++
+		return strings.Contains(itemJSON, "example.com")
+	})
+	if err != nil || removed != queueScanBatch+10 {
+		t.Fatalf("RemoveFromQueue = %d, %v, want %d", removed, err, queueScanBatch+10)
+	}
+	if calls != queueScanBatch/2+1 {
+		t.Errorf("match called %d times, want once per distinct item", calls)
+	}
+	if got := list(mr, "queue"); len(got) != 1 || got[0] != `{"location":"https://example.org/"}` {
+		t.Errorf("queue = %q, want only the unmatched item", got)
+	}
+}
@@ -0,0 +1,150 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ScheduleRecrawl records when location is next due for a crawl, along with
+// the item to queue for it then.
+func (rc *CrawlerCache) ScheduleRecrawl(ctx context.Context, location string, itemJSON string, due time.Time) error {
+	_, err := rc.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, "recrawl", redis.Z{Score: float64(due.Unix()), Member: location})
+		if itemJSON != "" {
+			pipe.HSet(ctx, "recrawl:items", location, itemJSON)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to schedule recrawl: %w", err)
+	}
+	return nil
+}
+
+// DueRecrawls claims up to limit urls whose recrawl is due at now, removing
+// them from the schedule, and returns each with its stored item, or "" if
+// it was scheduled without one. Each url is claimed by one caller only, so
+// several crawlers can promote concurrently.
+func (rc *CrawlerCache) DueRecrawls(ctx context.Context, now time.Time, limit int64) ([]string, []string, error) {
+	claimed, err := rc.claimDue(ctx, "recrawl", now, limit)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to claim recrawls: %w", err)
+	}
+	if len(claimed) == 0 {
+		return nil, nil, nil
+	}
+
+	// only the claimer reads and drops the stored items
+	var stored *redis.SliceCmd
+	_, err = rc.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		stored = pipe.HMGet(ctx, "recrawl:items", claimed...)
+		pipe.HDel(ctx, "recrawl:items", claimed...)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read recrawl items: %w", err)
+	}
+	items := make([]string, len(claimed))
+	for i, value := range stored.Val() {
+		if item, ok := value.(string); ok {
+			items[i] = item
+		}
+	}
+	return claimed, items, nil
+}
+
+// claimDue removes and returns up to limit members of the sorted set at key
+// whose score, a unix time, is at most now. A member removed by another
+// caller in the meantime is left to that caller.
+func (rc *CrawlerCache) claimDue(ctx context.Context, key string, now time.Time, limit int64) ([]string, error) {
+	due, err := rc.rdb.ZRangeArgs(ctx, redis.ZRangeArgs{
+		Key:     key,
+		Start:   "-inf",
+		Stop:    strconv.FormatInt(now.Unix(), 10),
+		ByScore: true,
+		Count:   limit,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(due) == 0 {
+		return nil, nil
+	}
+
+	removed := make([]*redis.IntCmd, len(due))
+	_, err = rc.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, member := range due {
+			removed[i] = pipe.ZRem(ctx, key, member)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var claimed []string
+	for i, member := range due {
+		if removed[i].Val() == 1 {
+			claimed = append(claimed, member)
+		}
+	}
+	return claimed, nil
+}
+
+func (rc *CrawlerCache) RecrawlsScheduled(ctx context.Context) (int64, error) {
+	return rc.rdb.ZCard(ctx, "recrawl").Result()
+}
+
+// SetValidators stores the conditional GET validators of location. Empty
+// validators remove the entry.
+func (rc *CrawlerCache) SetValidators(ctx context.Context, location string, etag string, lastModified string) error {
+	var err error
+	if etag == "" && lastModified == "" {
+		err = rc.rdb.HDel(ctx, "validators", location).Err()
+	} else {
+		err = rc.rdb.HSet(ctx, "validators", location, etag+"\n"+lastModified).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store validators: %w", err)
+	}
+	return nil
+}
+
+// SetContentHash stores the content hash of location next to its
+// validators.
+func (rc *CrawlerCache) SetContentHash(ctx context.Context, location string, hash string) error {
+	if err := rc.rdb.HSet(ctx, "content_hashes", location, hash).Err(); err != nil {
+		return fmt.Errorf("failed to store content hash: %w", err)
+	}
+	return nil
+}
+
+// ContentHash returns the stored content hash of location, or "" if it has
+// none.
+func (rc *CrawlerCache) ContentHash(ctx context.Context, location string) (string, error) {
+	hash, err := rc.rdb.HGet(ctx, "content_hashes", location).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read content hash: %w", err)
+	}
+	return hash, nil
+}
+
+func (rc *CrawlerCache) Validators(ctx context.Context, location string) (etag string, lastModified string, err error) {
+	raw, err := rc.rdb.HGet(ctx, "validators", location).Result()
+	if err == redis.Nil {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read validators: %w", err)
+	}
+	etag, lastModified, _ = strings.Cut(raw, "\n")
+	return etag, lastModified, nil
+}
@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDueRecrawls(t *testing.T) {
+	rc, mr := newTestCache(t)
+	ctx := context.Background()
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	rc.ScheduleRecrawl(ctx, "https://example.com/a", `{"location":"https://example.com/a"}`, now.Add(-time.Hour))
+	rc.ScheduleRecrawl(ctx, "https://example.com/b", "", now)
+	rc.ScheduleRecrawl(ctx, "https://example.com/c", `{"location":"https://example.com/c"}`, now.Add(time.Hour))
+
+	locations, items, err := rc.DueRecrawls(ctx, now, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != 2 || locations[0] != "https://example.com/a" || locations[1] != "https://example.com/b" {
+		t.Fatalf("due = %q, want a and b", locations)
+	}
+	if items[0] != `{"location":"https://example.com/a"}` || items[1] != "" {
+		t.Errorf("items = %q, want a's stored item and none for b", items)
+	}
+	if n, _ := rc.RecrawlsScheduled(ctx); n != 1 {
+		t.Errorf("%d recrawls left scheduled, want c", n)
+	}
+	if stored, _ := mr.HKeys("recrawl:items"); len(stored) != 1 || stored[0] != "https://example.com/c" {
+		t.Errorf("stored items %q, want only c's", stored)
+	}
+
+	// claimed recrawls are not handed out twice
+	if locations, _, _ := rc.DueRecrawls(ctx, now, 10); len(locations) != 0 {
+		t.Errorf("due again = %q", locations)
+	}
+}
+
+func TestClaimDueLimit(t *testing.T) {
+	rc, _ := newTestCache(t)
+	ctx := context.Background()
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	for i, item := range []string{"first", "second", "third"} {
+		rc.DelayItem(ctx, item, now.Add(time.Duration(i-3)*time.Minute))
+	}
+	rc.DelayItem(ctx, "later", now.Add(time.Minute))
+
+	due, err := rc.DueDelayedItems(ctx, now, 2)
+	if err != nil || len(due) != 2 || due[0] != "first" || due[1] != "second" {
+		t.Fatalf("DueDelayedItems = %q, %v, want the two earliest", due, err)
+	}
+	if due, _ := rc.DueDelayedItems(ctx, now, 10); len(due) != 1 || due[0] != "third" {
+		t.Errorf("second claim = %q, want third", due)
+	}
+	if n, _ := rc.DelayedItems(ctx); n != 1 {
+		t.Errorf("%d items still delayed, want the later one", n)
+	}
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RobotsRules returns the cached robots rules of host. found is false when
+// nothing is cached; an empty rules string that was found means the host
+// has no robots.txt.
+func (rc *CrawlerCache) RobotsRules(ctx context.Context, host string) (rules string, found bool, err error) {
+	rules, err = rc.rdb.Get(ctx, "robots:"+host).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read robots rules: %w", err)
+	}
+	return rules, true, nil
+}
+
+// SetRobotsRules caches rules for host until ttl expires. Pass empty rules
+// to remember that the host has no robots.txt.
+func (rc *CrawlerCache) SetRobotsRules(ctx context.Context, host string, rules string, ttl time.Duration) error {
+	if err := rc.rdb.Set(ctx, "robots:"+host, rules, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to cache robots rules: %w", err)
+	}
+	return nil
+}
+
+// ClaimRobotsFetch reports whether the caller won the right to fetch host's
+// robots.txt. The claim lapses after ttl so a crashed worker cannot block
+// the host forever.
+func (rc *CrawlerCache) ClaimRobotsFetch(ctx context.Context, host string, ttl time.Duration) (bool, error) {
+	claimed, err := rc.rdb.SetNX(ctx, "robotsclaim:"+host, 1, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim robots fetch: %w", err)
+	}
+	return claimed, nil
+}
+
+// ClaimSitemapIngest marks host's sitemaps as ingested for ttl and reports
+// whether the caller is the first to do so, and so should ingest them.
+func (rc *CrawlerCache) ClaimSitemapIngest(ctx context.Context, host string, ttl time.Duration) (bool, error) {
+	claimed, err := rc.rdb.SetNX(ctx, "sitemap:"+host, time.Now().Unix(), ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim sitemap ingest: %w", err)
+	}
+	return claimed, nil
+}
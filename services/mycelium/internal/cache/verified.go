@@ -0,0 +1,23 @@
+package cache
+
+import "context"
+
+// verifiedKey is the set of links checked by external link verification.
+// It is kept apart from the visited set so a verified link can still be
+// crawled when it is in scope for another seed.
+const verifiedKey = "verified"
+
+// TryVerify marks location verified and reports whether it was not already,
+// so concurrent crawlers cannot both check it.
+func (rc *CrawlerCache) TryVerify(ctx context.Context, location string) (bool, error) {
+	added, err := rc.rdb.SAdd(ctx, verifiedKey, location).Result()
+	if err != nil {
+		return false, err
+	}
+	return added == 1, nil
+}
+
+// Unverify releases a claim taken by TryVerify so the link is checked again.
+func (rc *CrawlerCache) Unverify(ctx context.Context, location string) error {
+	return rc.rdb.SRem(ctx, verifiedKey, location).Err()
+}
@@ -2,16 +2,183 @@ package cache
 
 import (
 	"context"
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+	"mycelium/internal/filter"
 )
 
+// visitedKey is the monolithic visited set, used when sharding is off.
+const visitedKey = "visited"
+
+// visitedCursorBits is where ScanVisited keeps the shard being scanned in
+// the cursor. Redis set cursors stay far below it.
+const visitedCursorBits = 48
+
+// visitedShard returns which of shards visited sets location belongs to,
+// by hash of its registrable domain so the urls of a site share a shard.
+func visitedShard(location string, shards int) int {
+	host := location
+	if u, err := url.Parse(location); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+	h := fnv.New32a()
+	h.Write([]byte(filter.RegistrableDomain(host)))
+	return int(h.Sum32() % uint32(shards))
+}
+
+// visitedKeys returns the keys of the visited set split into shards keys,
+// or the monolithic key when shards is below two.
+func visitedKeys(shards int) []string {
+	if shards < 2 {
+		return []string{visitedKey}
+	}
+	keys := make([]string, shards)
+	for i := range keys {
+		keys[i] = visitedKey + ":" + strconv.Itoa(i)
+	}
+	return keys
+}
+
+func visitedKeyFor(location string, shards int) string {
+	if shards < 2 {
+		return visitedKey
+	}
+	return visitedKey + ":" + strconv.Itoa(visitedShard(location, shards))
+}
+
 func (rc *CrawlerCache) Visit(ctx context.Context, location string) error {
-	return rc.rdb.SAdd(ctx, "visited", location).Err()
+	return rc.rdb.SAdd(ctx, visitedKeyFor(location, rc.visitedShards), location).Err()
+}
+
+// TryVisit marks location visited and reports whether it was not already,
+// so concurrent crawlers cannot both claim it.
+func (rc *CrawlerCache) TryVisit(ctx context.Context, location string) (bool, error) {
+	added, err := rc.rdb.SAdd(ctx, visitedKeyFor(location, rc.visitedShards), location).Result()
+	if err != nil {
+		return false, err
+	}
+	return added == 1, nil
+}
+
+func (rc *CrawlerCache) Unvisit(ctx context.Context, location string) error {
+	return rc.rdb.SRem(ctx, visitedKeyFor(location, rc.visitedShards), location).Err()
 }
 
 func (rc *CrawlerCache) IsVisited(ctx context.Context, location string) (bool, error) {
-	exists, err := rc.rdb.SIsMember(ctx, "visited", location).Result()
+	exists, err := rc.rdb.SIsMember(ctx, visitedKeyFor(location, rc.visitedShards), location).Result()
 	if err != nil {
 		return false, err
 	}
 	return exists, nil
 }
+
+// VisitedCount sums the sizes of every shard of the visited set.
+func (rc *CrawlerCache) VisitedCount(ctx context.Context) (int64, error) {
+	keys := visitedKeys(rc.visitedShards)
+	sizes := make([]*redis.IntCmd, len(keys))
+	_, err := rc.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			sizes[i] = pipe.SCard(ctx, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, size := range sizes {
+		total += size.Val()
+	}
+	return total, nil
+}
+
+// ScanVisited returns a batch of visited urls starting at cursor, and the
+// cursor for the next batch (0 once the scan is complete). With sharding
+// the shards are scanned one after another.
+func (rc *CrawlerCache) ScanVisited(ctx context.Context, cursor uint64, count int64) ([]string, uint64, error) {
+	keys := visitedKeys(rc.visitedShards)
+	shard := int(cursor >> visitedCursorBits)
+	if shard >= len(keys) {
+		return nil, 0, fmt.Errorf("invalid visited cursor %d", cursor)
+	}
+	members, next, err := rc.rdb.SScan(ctx, keys[shard], cursor&(1<<visitedCursorBits-1), "", count).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	if next>>visitedCursorBits != 0 {
+		return nil, 0, fmt.Errorf("visited cursor %d of %s out of range", next, keys[shard])
+	}
+	if next == 0 {
+		shard++
+		if shard == len(keys) {
+			return members, 0, nil
+		}
+	}
+	return members, uint64(shard)<<visitedCursorBits | next, nil
+}
+
+// MigrateVisited moves the visited urls kept in from shards (0 or 1 for the
+// monolithic set) to the shards this cache is configured with, batch urls
+// at a time, and returns how many moved. Each url is added to its new shard
+// before it is removed from the old one, so none are lost if the migration
+// stops; running it again picks up the rest. Urls not moved yet read as
+// unvisited, so crawlers should be stopped while it runs.
+func (rc *CrawlerCache) MigrateVisited(ctx context.Context, from int, batch int64) (int64, error) {
+	var moved int64
+	for _, src := range visitedKeys(from) {
+		// removing members while scanning may make the scan skip others,
+		// so scan again until a pass finds nothing to move
+		for {
+			n, err := rc.migrateVisitedPass(ctx, src, batch)
+			moved += n
+			if err != nil {
+				return moved, err
+			}
+			if n == 0 {
+				break
+			}
+		}
+	}
+	return moved, nil
+}
+
+// migrateVisitedPass scans src once, moving the urls that belong to another
+// key.
+func (rc *CrawlerCache) migrateVisitedPass(ctx context.Context, src string, batch int64) (int64, error) {
+	var moved int64
+	var cursor uint64
+	for {
+		members, next, err := rc.rdb.SScan(ctx, src, cursor, "", batch).Result()
+		if err != nil {
+			return moved, fmt.Errorf("failed to scan %s: %w", src, err)
+		}
+
+		var removed []*redis.IntCmd
+		_, err = rc.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, member := range members {
+				dst := visitedKeyFor(member, rc.visitedShards)
+				if dst == src {
+					continue
+				}
+				pipe.SAdd(ctx, dst, member)
+				removed = append(removed, pipe.SRem(ctx, src, member))
+			}
+			return nil
+		})
+		if err != nil {
+			return moved, fmt.Errorf("failed to move visited urls from %s: %w", src, err)
+		}
+		for _, r := range removed {
+			moved += r.Val()
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return moved, nil
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package chooser
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	defaultAccept         = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+	defaultAcceptLanguage = "en-US,en;q=0.9"
+	defaultAcceptEncoding = "gzip"
+)
+
+var chromeVersionRegex = regexp.MustCompile(`Chrome/(\d+)`)
+
+// HeaderProfile bundles a user agent with the request headers a real browser
+// sending that user agent would include.
+type HeaderProfile struct {
+	UserAgent string            `json:"ua"`
+	Percent   int               `json:"pct"`
+	Headers   map[string]string `json:"headers,omitempty"`
+}
+
+func (hp *HeaderProfile) String() string {
+	return hp.UserAgent
+}
+
+// Header returns a fresh copy of the profile's headers, including User-Agent.
+func (hp *HeaderProfile) Header() http.Header {
+	h := http.Header{}
+	for k, v := range hp.Headers {
+		h.Set(k, v)
+	}
+	h.Set("User-Agent", hp.UserAgent)
+	return h
+}
+
+func (hp *HeaderProfile) expandEnv(allowEmpty bool) error {
+	userAgent, err := ExpandEnv(hp.UserAgent, allowEmpty)
+	if err != nil {
+		return err
+	}
+	hp.UserAgent = userAgent
+
+	for k, v := range hp.Headers {
+		expanded, err := ExpandEnv(v, allowEmpty)
+		if err != nil {
+			return fmt.Errorf("header %s: %w", k, err)
+		}
+		hp.Headers[k] = expanded
+	}
+	return nil
+}
+
+// withDefaults fills in any headers missing from the profile with values
+// consistent with its user agent, so old agents files without headers
+// still produce a plausible browser fingerprint.
+func (hp HeaderProfile) withDefaults() HeaderProfile {
+	headers := map[string]string{}
+	for k, v := range synthesizeHeaders(hp.UserAgent) {
+		headers[k] = v
+	}
+	for k, v := range hp.Headers {
+		headers[http.CanonicalHeaderKey(k)] = v
+	}
+	hp.Headers = headers
+	return hp
+}
+
+func synthesizeHeaders(userAgent string) map[string]string {
+	headers := map[string]string{
+		"Accept":          defaultAccept,
+		"Accept-Language": defaultAcceptLanguage,
+		"Accept-Encoding": defaultAcceptEncoding,
+	}
+
+	// only chromium based browsers send client hints
+	match := chromeVersionRegex.FindStringSubmatch(userAgent)
+	if match == nil {
+		return headers
+	}
+
+	brand := "Google Chrome"
+	if strings.Contains(userAgent, "Edg/") {
+		brand = "Microsoft Edge"
+	}
+	headers["Sec-Ch-Ua"] = fmt.Sprintf(`"Chromium";v="%s", "%s";v="%s", "Not:A-Brand";v="24"`, match[1], brand, match[1])
+
+	mobile := "?0"
+	if strings.Contains(userAgent, "Mobile") {
+		mobile = "?1"
+	}
+	headers["Sec-Ch-Ua-Mobile"] = mobile
+
+	platform := ""
+	switch {
+	case strings.Contains(userAgent, "Android"):
+		platform = "Android"
+	case strings.Contains(userAgent, "Windows"):
+		platform = "Windows"
+	case strings.Contains(userAgent, "Macintosh"):
+		platform = "macOS"
+	case strings.Contains(userAgent, "CrOS"):
+		platform = "Chrome OS"
+	case strings.Contains(userAgent, "Linux"):
+		platform = "Linux"
+	}
+	if platform != "" {
+		headers["Sec-Ch-Ua-Platform"] = fmt.Sprintf(`"%s"`, platform)
+	}
+
+	return headers
+}
+
+//go:embed defaultAgents.json
+var defaultAgents []byte
+
+// DefaultHeaderProfiles returns the built-in header profiles used when no
+// agents file is provided.
+func DefaultHeaderProfiles() ([]HeaderProfile, error) {
+	var profiles []HeaderProfile
+	if err := json.Unmarshal(defaultAgents, &profiles); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal default agents: %w", err)
+	}
+	return profiles, nil
+}
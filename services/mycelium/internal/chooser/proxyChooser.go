@@ -2,13 +2,38 @@ package chooser
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math/rand/v2"
 	"net/url"
 	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mroth/weightedrand/v2"
+)
+
+type ProxyStrategy string
+
+const (
+	RoundRobin     ProxyStrategy = "roundrobin"
+	UniformRandom  ProxyStrategy = "random"
+	WeightedRandom ProxyStrategy = "weighted"
+	LatencyAware   ProxyStrategy = "latency"
+)
+
+const (
+	defaultEpsilon      = 0.1
+	latencyEwmaAlpha    = 0.3
+	proxyFailurePenalty = 10 * time.Second
 )
 
 type ProxyOption struct {
-	URL url.URL
+	URL    url.URL
+	Weight int
 }
 
 func (po *ProxyOption) String() string {
@@ -16,46 +41,350 @@ func (po *ProxyOption) String() string {
 }
 
 type ProxyChooser struct {
-	options []ProxyOption
-	index   int
+	mu                    sync.Mutex
+	options               []ProxyOption
+	index                 int
+	strategy              ProxyStrategy
+	weightedRandomChooser *weightedrand.Chooser[int, int]
+	loadedAt              time.Time
+	picks                 map[string]int64
+	epsilon               float64
+	latency               map[string]float64
+	loadOptions           []LoadOption
+}
+
+type ProxyChooserOption func(*ProxyChooser)
+
+func WithProxyStrategy(strategy ProxyStrategy) ProxyChooserOption {
+	return func(pc *ProxyChooser) {
+		pc.strategy = strategy
+	}
+}
+
+// WithEpsilon sets how often the latency aware strategy explores a random
+// proxy instead of the fastest one, as a fraction of picks between 0 and 1.
+// NewProxyChooser rejects values outside that range.
+func WithEpsilon(epsilon float64) ProxyChooserOption {
+	return func(pc *ProxyChooser) {
+		pc.epsilon = epsilon
+	}
+}
+
+// WithLoadOptions sets the options Reload loads the proxy file with. Pass the
+// same options the startup load used so a reload parses the file the same way.
+func WithLoadOptions(opt ...LoadOption) ProxyChooserOption {
+	return func(pc *ProxyChooser) {
+		pc.loadOptions = opt
+	}
+}
+
+func NewProxyChooser(options []ProxyOption, opt ...ProxyChooserOption) (*ProxyChooser, error) {
+	pc := &ProxyChooser{
+		strategy: RoundRobin,
+		picks:    map[string]int64{},
+		epsilon:  defaultEpsilon,
+		latency:  map[string]float64{},
+	}
+	for _, o := range opt {
+		o(pc)
+	}
+	if pc.epsilon < 0 || pc.epsilon > 1 {
+		return nil, fmt.Errorf("epsilon must be between 0 and 1, got %g", pc.epsilon)
+	}
+
+	if err := pc.setOptions(options); err != nil {
+		return nil, err
+	}
+
+	return pc, nil
+}
+
+// Reload swaps in the proxies from path. If the file cannot be loaded the
+// current options are retained.
+func (pc *ProxyChooser) Reload(path string) error {
+	options, err := LoadProxyOptions(path, pc.loadOptions...)
+	if err != nil {
+		return err
+	}
+	return pc.setOptions(options)
 }
 
-func NewProxyChooser(options []ProxyOption) *ProxyChooser {
-	return &ProxyChooser{
-		options: options,
-		index:   0,
+func (pc *ProxyChooser) LoadedAt() time.Time {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return pc.loadedAt
+}
+
+func (pc *ProxyChooser) setOptions(options []ProxyOption) error {
+	if len(options) == 0 {
+		return fmt.Errorf("no proxy options provided")
+	}
+
+	var weightedRandomChooser *weightedrand.Chooser[int, int]
+	switch pc.strategy {
+	case RoundRobin, UniformRandom, LatencyAware:
+	case WeightedRandom:
+		var choices []weightedrand.Choice[int, int]
+		for i, opt := range options {
+			weight := opt.Weight
+			if weight == 0 {
+				weight = 1
+			}
+			choices = append(choices, weightedrand.NewChoice(i, weight))
+		}
+
+		chooser, err := weightedrand.NewChooser(choices...)
+		if err != nil {
+			return err
+		}
+		weightedRandomChooser = chooser
+	default:
+		return fmt.Errorf("unknown proxy strategy: %s", pc.strategy)
 	}
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	pc.options = options
+	pc.index = 0
+	pc.weightedRandomChooser = weightedRandomChooser
+	pc.loadedAt = time.Now()
+	pc.pruneLatency()
+
+	return nil
 }
 
-func LoadProxyOptions(path string) ([]ProxyOption, error) {
-	proxyfile, err := os.Open(path)
+func LoadProxyOptions(path string, opt ...LoadOption) ([]ProxyOption, error) {
+	content, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open proxy file %s: %w", path, err)
 	}
-	defer proxyfile.Close()
 
+	lc := newLoadConfig(opt)
+	if bytes.HasPrefix(bytes.TrimSpace(content), []byte("[")) {
+		return parseProxyJSON(content, lc)
+	}
+	return parseProxyLines(content, lc)
+}
+
+func parseProxyJSON(content []byte, lc *loadConfig) ([]ProxyOption, error) {
+	// decode entry by entry so errors can name the line an entry starts on
+	dec := json.NewDecoder(bytes.NewReader(content))
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal proxy file: %w", err)
+	}
+
+	var options []ProxyOption
+	for i := 1; dec.More(); i++ {
+		line := lineAt(content, entryStart(content, dec.InputOffset()))
+		var entry struct {
+			URL    string `json:"url"`
+			User   string `json:"user"`
+			Pass   string `json:"pass"`
+			Weight int    `json:"weight"`
+		}
+		if err := dec.Decode(&entry); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal proxy entry %d on line %d: %w", i, line, err)
+		}
+
+		rawUrl, err := ExpandEnvInURL(entry.URL, lc.allowEmptyEnv)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy entry %d on line %d: %w", i, line, err)
+		}
+		for _, field := range []*string{&entry.User, &entry.Pass} {
+			expanded, err := ExpandEnv(*field, lc.allowEmptyEnv)
+			if err != nil {
+				return nil, fmt.Errorf("invalid proxy entry %d on line %d: %w", i, line, err)
+			}
+			*field = expanded
+		}
+
+		parsedUrl, err := parseProxyURL(rawUrl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy entry %d on line %d: %w", i, line, err)
+		}
+		if entry.Weight < 0 {
+			return nil, fmt.Errorf("invalid proxy entry %d on line %d: negative weight %d", i, line, entry.Weight)
+		}
+		if entry.User != "" {
+			parsedUrl.User = url.UserPassword(entry.User, entry.Pass)
+		}
+		options = append(options, ProxyOption{URL: *parsedUrl, Weight: entry.Weight})
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal proxy file on line %d: %w", lineAt(content, dec.InputOffset()), err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the proxy list on line %d", lineAt(content, dec.InputOffset()))
+	}
+
+	return options, nil
+}
+
+// entryStart skips the separators a decoder stops in front of to the offset
+// where the next array entry begins.
+func entryStart(content []byte, offset int64) int64 {
+	for offset < int64(len(content)) && strings.IndexByte(", \t\r\n", content[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
+
+// lineAt returns the 1-based line of offset in content.
+func lineAt(content []byte, offset int64) int {
+	return bytes.Count(content[:min(offset, int64(len(content)))], []byte("\n")) + 1
+}
+
+func parseProxyLines(content []byte, lc *loadConfig) ([]ProxyOption, error) {
 	var options []ProxyOption
-	scanner := bufio.NewScanner(proxyfile)
-	line := 1
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	line := 0
 
 	for scanner.Scan() {
-		rawUrl := scanner.Text()
-		parsedUrl, err := url.Parse(rawUrl)
+		line++
+		rawUrl := strings.TrimSpace(scanner.Text())
+		if rawUrl == "" || strings.HasPrefix(rawUrl, "#") {
+			continue
+		}
 
+		rawUrl, err := ExpandEnvInURL(rawUrl, lc.allowEmptyEnv)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse proxy file line %d: %s", line, rawUrl)
+			return nil, fmt.Errorf("invalid proxy file line %d: %w", line, err)
+		}
+
+		parsedUrl, err := parseProxyURL(rawUrl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy file line %d: %w", line, err)
 		}
 
 		options = append(options, ProxyOption{URL: *parsedUrl})
-		line++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read proxy file: %w", err)
 	}
 
 	return options, nil
 }
 
+func parseProxyURL(rawUrl string) (*url.URL, error) {
+	if rawUrl == "" {
+		return nil, fmt.Errorf("empty proxy url")
+	}
+	parsedUrl, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse proxy url %s: %w", rawUrl, err)
+	}
+	if parsedUrl.Scheme == "" || parsedUrl.Host == "" {
+		return nil, fmt.Errorf("proxy url %s must include a scheme and host", rawUrl)
+	}
+	return parsedUrl, nil
+}
+
 func (pc *ProxyChooser) Pick() string {
-	choice := pc.options[pc.index]
-	pc.index = (pc.index + 1) % len(pc.options)
-	fmt.Println(choice.String())
-	return choice.String()
+	return pc.PickURL().String()
+}
+
+// PickURL is Pick without the round trip through a string. The returned url
+// is a copy and may be modified.
+func (pc *ProxyChooser) PickURL() *url.URL {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	var option *ProxyOption
+	switch pc.strategy {
+	case UniformRandom:
+		option = &pc.options[rand.IntN(len(pc.options))]
+	case WeightedRandom:
+		option = &pc.options[pc.weightedRandomChooser.Pick()]
+	case LatencyAware:
+		option = pc.pickFastest()
+	default:
+		option = &pc.options[pc.index]
+		pc.index = (pc.index + 1) % len(pc.options)
+	}
+
+	pc.picks[option.URL.Redacted()]++
+	choice := option.URL
+	return &choice
+}
+
+// pickFastest is epsilon-greedy: usually the proxy with the lowest average
+// latency, occasionally a random one so slow proxies get a chance to recover.
+// Proxies with no observations yet are preferred so each gets measured.
+func (pc *ProxyChooser) pickFastest() *ProxyOption {
+	if rand.Float64() < pc.epsilon {
+		return &pc.options[rand.IntN(len(pc.options))]
+	}
+
+	var best *ProxyOption
+	bestLatency := 0.0
+	for i := range pc.options {
+		candidate := &pc.options[i]
+		latency, observed := pc.latency[candidate.URL.Redacted()]
+		if !observed {
+			return candidate
+		}
+		if best == nil || latency < bestLatency {
+			best = candidate
+			bestLatency = latency
+		}
+	}
+	return best
+}
+
+// ReportResult records the outcome of a request made through proxy. Failed
+// requests are counted as at least proxyFailurePenalty of latency.
+func (pc *ProxyChooser) ReportResult(proxy string, success bool, latency time.Duration) {
+	if !success && latency < proxyFailurePenalty {
+		latency = proxyFailurePenalty
+	}
+	observed := float64(latency.Milliseconds())
+
+	// keyed like picks, so no proxy password is kept around in the map
+	key := proxy
+	if u, err := url.Parse(proxy); err == nil {
+		key = u.Redacted()
+	}
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if prev, found := pc.latency[key]; found {
+		pc.latency[key] = latencyEwmaAlpha*observed + (1-latencyEwmaAlpha)*prev
+	} else {
+		pc.latency[key] = observed
+	}
+}
+
+// pruneLatency forgets the latency of proxies no longer loaded, so proxies
+// rotated out on reload do not accumulate. pc.mu must be held.
+func (pc *ProxyChooser) pruneLatency() {
+	loaded := make(map[string]bool, len(pc.options))
+	for i := range pc.options {
+		loaded[pc.options[i].URL.Redacted()] = true
+	}
+	for proxy := range pc.latency {
+		if !loaded[proxy] {
+			delete(pc.latency, proxy)
+		}
+	}
+}
+
+// Stats returns the number of times each proxy has been picked, keyed by the
+// proxy url with any password redacted.
+func (pc *ProxyChooser) Stats() map[string]int64 {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	stats := make(map[string]int64, len(pc.picks))
+	for k, v := range pc.picks {
+		stats[k] = v
+	}
+	return stats
+}
+
+func (pc *ProxyChooser) ResetStats() {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.picks = map[string]int64{}
 }
@@ -3,54 +3,172 @@ package chooser
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/mroth/weightedrand/v2"
 )
 
-type UserAgentOption struct {
-	UserAgent string `json:"ua"`
-	Percent   int    `json:"pct"`
+type UserAgentChooser struct {
+	mu                    sync.RWMutex
+	weightedRandomChooser *weightedrand.Chooser[*HeaderProfile, int]
+	loadedAt              time.Time
+	statsMu               sync.Mutex
+	picks                 map[string]int64
+	loadOptions           []LoadOption
+	noRotate              bool
 }
 
-func (uao *UserAgentOption) String() string {
-	return uao.UserAgent
+type UserAgentChooserOption func(*UserAgentChooser)
+
+// WithAgentLoadOptions sets the options Reload loads the agents file with.
+// Pass the same options the startup load used.
+func WithAgentLoadOptions(opt ...LoadOption) UserAgentChooserOption {
+	return func(uac *UserAgentChooser) {
+		uac.loadOptions = opt
+	}
 }
 
-type UserAgentChooser struct {
-	weightedRandomChooser *weightedrand.Chooser[string, int]
+// WithoutRotation keeps only the first profile, on creation and on every
+// Reload, so the same user agent is always picked.
+func WithoutRotation() UserAgentChooserOption {
+	return func(uac *UserAgentChooser) {
+		uac.noRotate = true
+	}
+}
+
+func NewUserAgentChooser(profiles []HeaderProfile, opt ...UserAgentChooserOption) (*UserAgentChooser, error) {
+	uac := UserAgentChooser{picks: map[string]int64{}}
+	for _, o := range opt {
+		o(&uac)
+	}
+	if err := uac.setProfiles(profiles); err != nil {
+		return nil, err
+	}
+	return &uac, nil
 }
 
-func NewUserAgentChooser(options []UserAgentOption) (*UserAgentChooser, error) {
-	var choices []weightedrand.Choice[string, int]
-	for _, opt := range options {
-		choices = append(choices, weightedrand.NewChoice(opt.UserAgent, opt.Percent))
+// Reload swaps in the header profiles from path. If the file cannot be loaded
+// the current profiles are retained.
+func (uac *UserAgentChooser) Reload(path string) error {
+	profiles, err := LoadHeaderProfiles(path, uac.loadOptions...)
+	if err != nil {
+		return err
+	}
+	return uac.setProfiles(profiles)
+}
+
+func (uac *UserAgentChooser) LoadedAt() time.Time {
+	uac.mu.RLock()
+	defer uac.mu.RUnlock()
+	return uac.loadedAt
+}
+
+func (uac *UserAgentChooser) setProfiles(profiles []HeaderProfile) error {
+	if len(profiles) == 0 {
+		return fmt.Errorf("no user agent options provided")
+	}
+
+	if err := validateHeaderProfiles(profiles); err != nil {
+		return err
+	}
+	if uac.noRotate {
+		profiles = profiles[:1]
+	}
+
+	var choices []weightedrand.Choice[*HeaderProfile, int]
+	for _, profile := range profiles {
+		profile := profile.withDefaults()
+		choices = append(choices, weightedrand.NewChoice(&profile, profile.Percent))
 	}
 
 	chooser, err := weightedrand.NewChooser(choices...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return &UserAgentChooser{weightedRandomChooser: chooser}, nil
+	uac.mu.Lock()
+	defer uac.mu.Unlock()
+
+	uac.weightedRandomChooser = chooser
+	uac.loadedAt = time.Now()
+
+	return nil
 }
 
-func LoadUserAgentOptions(path string) ([]UserAgentOption, error) {
-	var options []UserAgentOption
+func LoadHeaderProfiles(path string, opt ...LoadOption) ([]HeaderProfile, error) {
+	var profiles []HeaderProfile
 
 	content, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load %s: %w", path, err)
 	}
 
-	err = json.Unmarshal(content, &options)
+	err = json.Unmarshal(content, &profiles)
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal %s: %w", path, err)
 	}
 
-	return options, nil
+	lc := newLoadConfig(opt)
+	for i := range profiles {
+		if err := profiles[i].expandEnv(lc.allowEmptyEnv); err != nil {
+			return nil, fmt.Errorf("invalid agents file %s entry %d: %w", path, i+1, err)
+		}
+	}
+
+	if err := validateHeaderProfiles(profiles); err != nil {
+		return nil, fmt.Errorf("invalid agents file %s: %w", path, err)
+	}
+
+	return profiles, nil
+}
+
+func validateHeaderProfiles(profiles []HeaderProfile) error {
+	total := 0
+	for i, profile := range profiles {
+		if strings.TrimSpace(profile.UserAgent) == "" {
+			return fmt.Errorf("entry %d: empty user agent", i+1)
+		}
+		if profile.Percent < 0 {
+			return fmt.Errorf("entry %d: negative pct %d", i+1, profile.Percent)
+		}
+		total += profile.Percent
+	}
+	if total <= 0 {
+		return fmt.Errorf("pct weights must sum to a positive value")
+	}
+	return nil
+}
+
+func (uac *UserAgentChooser) Pick() http.Header {
+	uac.mu.RLock()
+	profile := uac.weightedRandomChooser.Pick()
+	uac.mu.RUnlock()
+
+	uac.statsMu.Lock()
+	uac.picks[profile.UserAgent]++
+	uac.statsMu.Unlock()
+
+	return profile.Header()
+}
+
+// Stats returns the number of times each user agent has been picked.
+func (uac *UserAgentChooser) Stats() map[string]int64 {
+	uac.statsMu.Lock()
+	defer uac.statsMu.Unlock()
+
+	stats := make(map[string]int64, len(uac.picks))
+	for k, v := range uac.picks {
+		stats[k] = v
+	}
+	return stats
 }
 
-func (uac *UserAgentChooser) Pick() string {
-	return uac.weightedRandomChooser.Pick()
+func (uac *UserAgentChooser) ResetStats() {
+	uac.statsMu.Lock()
+	defer uac.statsMu.Unlock()
+	uac.picks = map[string]int64{}
 }
@@ -0,0 +1,150 @@
+package chooser
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestUserAgentPickDuringReload(t *testing.T) {
+	first := writeTestFile(t, "first.json", `[{"ua": "Agent/1", "pct": 50}, {"ua": "Agent/2", "pct": 50}]`)
+	second := writeTestFile(t, "second.json", `[{"ua": "Agent/3", "pct": 100}]`)
+	profiles, err := LoadHeaderProfiles(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uac, err := NewUserAgentChooser(profiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := map[string]bool{"Agent/1": true, "Agent/2": true, "Agent/3": true}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for g := 0; g < 20; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if ua := uac.Pick().Get("User-Agent"); !valid[ua] {
+					t.Errorf("picked %q, not in either agents file", ua)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 200; i++ {
+		path := first
+		if i%2 == 1 {
+			path = second
+		}
+		if err := uac.Reload(path); err != nil {
+			t.Error(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestUserAgentReloadKeepsProfilesOnInvalidFile(t *testing.T) {
+	good := writeTestFile(t, "good.json", `[{"ua": "Agent/1", "pct": 100}]`)
+	bad := writeTestFile(t, "bad.json", `[{"ua": "Agent/2", "pct": 0}]`)
+	profiles, err := LoadHeaderProfiles(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uac, err := NewUserAgentChooser(profiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := uac.Reload(bad); err == nil {
+		t.Fatal("reloading an invalid file succeeded")
+	}
+	if got := uac.Pick().Get("User-Agent"); got != "Agent/1" {
+		t.Errorf("picked %q after a failed reload, want Agent/1", got)
+	}
+}
+
+func TestUserAgentReloadKeepsNoRotation(t *testing.T) {
+	first := writeTestFile(t, "first.json", `[{"ua": "Agent/1", "pct": 10}, {"ua": "Agent/2", "pct": 90}]`)
+	second := writeTestFile(t, "second.json", `[{"ua": "Agent/3", "pct": 10}, {"ua": "Agent/4", "pct": 90}]`)
+	profiles, err := LoadHeaderProfiles(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uac, err := NewUserAgentChooser(profiles, WithoutRotation())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, step := range []struct{ path, want string }{{"", "Agent/1"}, {second, "Agent/3"}} {
+		if step.path != "" {
+			if err := uac.Reload(step.path); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for range 50 {
+			if got := uac.Pick().Get("User-Agent"); got != step.want {
+				t.Fatalf("picked %q, want only the first agent %s", got, step.want)
+			}
+		}
+	}
+}
+
+func TestLoadHeaderProfilesReportsEntry(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"empty user agent", `[{"ua": "Agent/1", "pct": 50}, {"ua": " ", "pct": 50}]`, "entry 2"},
+		{"negative pct", `[{"ua": "Agent/1", "pct": -5}]`, "entry 1"},
+		{"zero total", `[{"ua": "Agent/1", "pct": 0}, {"ua": "Agent/2", "pct": 0}]`, "sum to a positive value"},
+		{"not json", `Agent/1`, "failed to unmarshal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadHeaderProfiles(writeTestFile(t, "agents.json", tt.content))
+			if err == nil {
+				t.Fatal("loaded a malformed agents file")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q does not mention %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserAgentStatsCountScriptedPicks(t *testing.T) {
+	uac, err := NewUserAgentChooser([]HeaderProfile{{UserAgent: "Agent/1", Percent: 100}, {UserAgent: "Agent/2", Percent: 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 10; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				uac.Pick()
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats := uac.Stats()
+	if len(stats) != 1 || stats["Agent/1"] != 500 {
+		t.Errorf("stats = %v, want Agent/1 picked 500 times", stats)
+	}
+
+	uac.ResetStats()
+	if stats := uac.Stats(); len(stats) != 0 {
+		t.Errorf("stats after reset = %v, want none", stats)
+	}
+}
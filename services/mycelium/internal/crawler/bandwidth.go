@@ -0,0 +1,30 @@
+package crawler
+
+import (
+	"mycelium/internal/filter"
+)
+
+// WithBandwidthBudget stops the crawler from starting new fetches once
+// bytesPerRun response bytes have been received on the wire, after which
+// Crawl and CrawlOnce return ErrBandwidthBudgetExhausted. Fetches already in
+// flight finish, so the budget can be overshot by up to one page per worker.
+// A non-positive budget is unlimited.
+func WithBandwidthBudget(bytesPerRun int64) CrawlerOption {
+	return func(c *Crawler) {
+		c.bandwidthBudget = bytesPerRun
+	}
+}
+
+// countBandwidth records the bytes of one response, wire being what was
+// received and decoded what was read after decompression.
+func (c *Crawler) countBandwidth(host string, wire int64, decoded int64) {
+	c.stats.bytesDownloaded.Add(wire)
+	c.stats.bytesDecoded.Add(decoded)
+	c.stats.bytesByDomain.add(filter.RegistrableDomain(host), wire)
+	c.metrics.Incr(MetricBytesDownloaded, wire)
+	c.metrics.Incr(MetricBytesDecoded, decoded)
+}
+
+func (c *Crawler) bandwidthExhausted() bool {
+	return c.bandwidthBudget > 0 && c.stats.bytesDownloaded.Load() >= c.bandwidthBudget
+}
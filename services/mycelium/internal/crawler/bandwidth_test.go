@@ -0,0 +1,98 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixedSizePage is an html page of exactly size bytes.
+func fixedSizePage(size int) string {
+	const head, tail = "<html><body>", "</body></html>"
+	return head + strings.Repeat("x", size-len(head)-len(tail)) + tail
+}
+
+func TestBandwidthAccounting(t *testing.T) {
+	plain := fixedSizePage(1000)
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write([]byte(fixedSizePage(4000)))
+	zw.Close()
+
+	srv := httptest.NewServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gz" {
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(compressed.Bytes())
+			return
+		}
+		fmt.Fprint(w, plain)
+	}))
+	defer srv.Close()
+	localhost := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+
+	metrics := NewCounterMetrics()
+	c := NewCrawler(nil, nil, quiet, WithMetrics(metrics))
+	for _, location := range []string{srv.URL + "/", srv.URL + "/gz", localhost + "/"} {
+		if _, err := getPage(t, c, location); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := c.Stats()
+	wire := int64(2*len(plain) + compressed.Len())
+	if stats.BytesDownloaded != wire || metrics.Get(MetricBytesDownloaded) != wire {
+		t.Errorf("downloaded %d bytes (metric %d), want %d", stats.BytesDownloaded, metrics.Get(MetricBytesDownloaded), wire)
+	}
+	if decoded := int64(2*len(plain) + 4000); stats.BytesDecoded != decoded || metrics.Get(MetricBytesDecoded) != decoded {
+		t.Errorf("decoded %d bytes (metric %d), want %d", stats.BytesDecoded, metrics.Get(MetricBytesDecoded), decoded)
+	}
+	want := map[string]int64{"127.0.0.1": int64(len(plain) + compressed.Len()), "localhost": int64(len(plain))}
+	if !maps.Equal(stats.BytesByDomain, want) {
+		t.Errorf("bytes by domain %v, want %v", stats.BytesByDomain, want)
+	}
+}
+
+func TestBandwidthBudget(t *testing.T) {
+	srv := typedServer(t, "text/html", fixedSizePage(1000))
+
+	newCrawler := func() *Crawler {
+		c := NewCrawler(newMemCache(), nil, quiet, WithMyceliumIngressKey("ingress"), WithBandwidthBudget(1500))
+		for i := range 3 {
+			if err := c.Enqueue(context.Background(), IngressItem{Location: fmt.Sprintf("%s/%d", srv.URL, i)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return c
+	}
+
+	c := newCrawler()
+	for i := range 2 {
+		if _, err := c.CrawlOnce(context.Background()); err != nil {
+			t.Fatalf("fetch %d: %s", i, err)
+		}
+	}
+	if processed, err := c.CrawlOnce(context.Background()); processed || !errors.Is(err, ErrBandwidthBudgetExhausted) {
+		t.Errorf("CrawlOnce over budget = %t, %v, want ErrBandwidthBudgetExhausted", processed, err)
+	}
+	if stats := c.Stats(); stats.PagesFetched != 2 || stats.ItemsPopped != 2 {
+		t.Errorf("fetched %d of %d popped, want 2 and the last item left queued", stats.PagesFetched, stats.ItemsPopped)
+	}
+
+	c = newCrawler()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := c.Crawl(ctx); !errors.Is(err, ErrBandwidthBudgetExhausted) {
+		t.Errorf("Crawl = %v, want ErrBandwidthBudgetExhausted", err)
+	}
+	if n := c.Stats().PagesFetched; n != 2 {
+		t.Errorf("Crawl fetched %d pages, want 2", n)
+	}
+}
@@ -0,0 +1,42 @@
+package crawler
+
+import "io"
+
+// WithMaxBodyBytes fails pages whose decoded body is larger than n bytes
+// with ErrBodyTooLarge. The limit applies after decompression, so a small
+// gzip bomb is cut off once it inflates past n. A non-positive n reads
+// bodies of any size.
+func WithMaxBodyBytes(n int64) CrawlerOption {
+	return func(c *Crawler) {
+		c.maxBodyBytes = n
+	}
+}
+
+// cappedReader returns ErrBodyTooLarge instead of reading past its limit.
+// The parsers stop at the first error without returning it, so exceeded is
+// checked after parsing.
+type cappedReader struct {
+	r         io.Reader
+	remaining int64
+	exceeded  bool
+}
+
+func (cr *cappedReader) Read(p []byte) (int, error) {
+	if cr.exceeded {
+		return 0, ErrBodyTooLarge
+	}
+	// read one byte past the limit to tell a body of exactly the limit
+	// from a larger one
+	if int64(len(p)) > cr.remaining+1 {
+		p = p[:cr.remaining+1]
+	}
+	n, err := cr.r.Read(p)
+	if int64(n) > cr.remaining {
+		cr.exceeded = true
+		n = int(cr.remaining)
+		cr.remaining = 0
+		return n, ErrBodyTooLarge
+	}
+	cr.remaining -= int64(n)
+	return n, err
+}
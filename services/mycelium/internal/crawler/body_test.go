@@ -0,0 +1,95 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// gzipBomb compresses size bytes of repetitive html, which gzip shrinks by
+// two orders of magnitude or more.
+func gzipBomb(t *testing.T, size int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, _ := gzip.NewWriterLevel(&buf, gzip.BestSpeed)
+	w.Write([]byte("<html><body>"))
+	chunk := []byte(strings.Repeat("<p>aaaaaaaaaaaaaaaa</p>", 4096))
+	for written := 0; written < size; written += len(chunk) {
+		w.Write(chunk)
+	}
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestGzipBombIsCutOff(t *testing.T) {
+	const inflated = 64 << 20
+	bomb := gzipBomb(t, inflated)
+	srv := httptest.NewServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(bomb)
+	}))
+	defer srv.Close()
+
+	const limit = 1 << 20
+	c := NewCrawler(nil, nil, quiet, WithMaxBodyBytes(limit))
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	_, err := getPage(t, c, srv.URL+"/")
+	runtime.ReadMemStats(&after)
+
+	if !errors.Is(err, ErrBodyTooLarge) {
+		t.Fatalf("GetPage = %v, want ErrBodyTooLarge", err)
+	}
+	if !strings.Contains(err.Error(), "on the wire") {
+		t.Errorf("error %q does not give the compressed size", err)
+	}
+	// parsing the capped body allocates a few times its size, nowhere near
+	// the inflated size
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 32*limit {
+		t.Errorf("allocated %d MiB for a %d MiB bomb capped at 1 MiB", allocated>>20, inflated>>20)
+	}
+}
+
+func TestGetPageRecordsBodySizes(t *testing.T) {
+	page := "<html><body>" + strings.Repeat("<p>compressible</p>", 100) + "</body></html>"
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	w.Write([]byte(page))
+	w.Close()
+
+	tests := []struct {
+		name           string
+		encoding       string
+		body           []byte
+		wantCompressed int64
+	}{
+		{name: "gzip", encoding: "gzip", body: compressed.Bytes(), wantCompressed: int64(compressed.Len())},
+		{name: "identity", body: []byte(page), wantCompressed: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := httptest.NewServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {
+				if test.encoding != "" {
+					w.Header().Set("Content-Encoding", test.encoding)
+				}
+				w.Write(test.body)
+			}))
+			defer srv.Close()
+
+			got, err := getPage(t, NewCrawler(nil, nil, quiet), srv.URL+"/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Fetch.BodyBytes != int64(len(page)) || got.Fetch.CompressedBytes != test.wantCompressed {
+				t.Errorf("body %d, compressed %d bytes; want %d and %d",
+					got.Fetch.BodyBytes, got.Fetch.CompressedBytes, len(page), test.wantCompressed)
+			}
+		})
+	}
+}
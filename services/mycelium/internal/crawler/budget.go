@@ -0,0 +1,65 @@
+package crawler
+
+import (
+	"context"
+
+	"mycelium/internal/filter"
+)
+
+// DomainBudgetCache is implemented by caches that can count pages per domain
+// across every worker of a run. It is required by WithPerDomainBudget.
+type DomainBudgetCache interface {
+	SpendDomainBudget(ctx context.Context, domain string) (int64, error)
+	RefundDomainBudget(ctx context.Context, domain string) error
+}
+
+// WithPerDomainBudget crawls at most n pages per registrable domain in a run.
+// Items beyond the budget are dead lettered and links to exhausted domains
+// are no longer queued. A non-positive n disables the budget.
+func WithPerDomainBudget(n int) CrawlerOption {
+	return func(c *Crawler) {
+		c.domainBudget = int64(n)
+	}
+}
+
+// spendBudget takes one page from host's budget, reporting false once the
+// budget is exhausted. Failing to reach the cache lets the page through.
+func (c *Crawler) spendBudget(ctx context.Context, host string) bool {
+	if c.domainBudget <= 0 {
+		return true
+	}
+	budgets, ok := c.cache.(DomainBudgetCache)
+	if !ok {
+		return true
+	}
+
+	domain := filter.RegistrableDomain(host)
+	spent, err := budgets.SpendDomainBudget(ctx, domain)
+	if err != nil {
+		c.log(ctx).Error("failed to spend domain budget", "domain", domain, "error", err)
+		return true
+	}
+	if spent > c.domainBudget {
+		c.exhausted.add(domain)
+		return false
+	}
+	return true
+}
+
+// refundBudget gives back the page spendBudget took for host when the item
+// goes back to the queue instead of being crawled, such as on shutdown or a
+// retry, so it is not charged twice.
+func (c *Crawler) refundBudget(ctx context.Context, host string) {
+	if c.domainBudget <= 0 {
+		return
+	}
+	budgets, ok := c.cache.(DomainBudgetCache)
+	if !ok {
+		return
+	}
+
+	domain := filter.RegistrableDomain(host)
+	if err := budgets.RefundDomainBudget(ctx, domain); err != nil {
+		c.log(ctx).Error("failed to refund domain budget", "domain", domain, "error", err)
+	}
+}
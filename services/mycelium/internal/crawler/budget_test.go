@@ -0,0 +1,150 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDomainBudgetAcrossWorkers(t *testing.T) {
+	const (
+		workers = 8
+		budget  = 5
+	)
+	var fetches atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><body>no links</body></html>")
+	}))
+	defer srv.Close()
+
+	cache := newMemCache()
+	metrics := NewCounterMetrics()
+	c := NewCrawler(cache, nil, quiet,
+		WithMyceliumIngressKey("ingress"),
+		WithDeadLetterKey("dead"),
+		WithPerDomainBudget(budget),
+		WithMetrics(metrics),
+		WithMaxIdle(1))
+	// queue more pages than the budget up front so workers race for it
+	for i := 0; i < 2*workers; i++ {
+		if err := c.Enqueue(context.Background(), IngressItem{Location: fmt.Sprintf("%s/%d", srv.URL, i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			if err := c.Crawl(WithWorkerID(context.Background(), id)); err != nil {
+				t.Errorf("Crawl = %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if n := fetches.Load(); n != budget {
+		t.Errorf("server saw %d fetches, want the budget of %d", n, budget)
+	}
+
+	dead := cache.queue("dead")
+	if len(dead) != 2*workers-budget {
+		t.Errorf("dead lettered %d items, want the %d beyond the budget", len(dead), 2*workers-budget)
+	}
+	for _, letterJSON := range dead {
+		var letter DeadLetter
+		if err := json.Unmarshal([]byte(letterJSON), &letter); err != nil {
+			t.Fatal(err)
+		}
+		if letter.Source != "crawl" || letter.Reason != "domain budget exhausted" {
+			t.Errorf("dead letter = %+v", letter)
+		}
+	}
+	if queued := cache.queue("ingress"); len(queued) != 0 {
+		t.Errorf("left %d items queued", len(queued))
+	}
+}
+
+func TestDomainBudgetStopsQueueingLinks(t *testing.T) {
+	cache := newMemCache()
+	c := NewCrawler(cache, nil, quiet, WithMyceliumIngressKey("ingress"), WithPerDomainBudget(1))
+	ctx := context.Background()
+
+	if !c.spendBudget(ctx, "www.example.com") {
+		t.Fatal("first page over budget")
+	}
+	if c.spendBudget(ctx, "blog.example.com") {
+		t.Fatal("second page of the domain within a budget of 1")
+	}
+	if !c.spendBudget(ctx, "example.org") {
+		t.Fatal("another domain shares the budget")
+	}
+
+	for _, location := range []string{"https://example.com/a", "https://example.org/b"} {
+		if err := c.Enqueue(ctx, IngressItem{Location: location}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertQueued(t, cache, "https://example.org/b")
+}
+
+func TestDomainBudgetDisabled(t *testing.T) {
+	c := NewCrawler(newMemCache(), nil, quiet)
+	for i := 0; i < 3; i++ {
+		if !c.spendBudget(context.Background(), "example.com") {
+			t.Fatal("page over a disabled budget")
+		}
+	}
+}
+
+func TestDomainBudgetRefundedOnRetry(t *testing.T) {
+	var fetches atomic.Int64
+	srv := httptest.NewServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {
+		if fetches.Add(1) == 1 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "<html><body>page</body></html>")
+	}))
+	defer srv.Close()
+
+	cache := newMemCache()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	metrics := countUntilFetch{NewCounterMetrics(), cancel}
+	// the failed attempt would use up the whole budget without the refund
+	c := NewCrawler(cache, nil, quiet, WithMyceliumIngressKey("ingress"), WithDeadLetterKey("dead"),
+		WithPerDomainBudget(1), WithMetrics(metrics), WithMaxRetries(2))
+	if err := c.Enqueue(context.Background(), IngressItem{Location: srv.URL + "/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() { done <- c.Crawl(ctx) }()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		cancel()
+		<-done
+		t.Fatal("timed out waiting for the retried page")
+	}
+
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("server saw %d fetches, want the failure and the retry", n)
+	}
+	if dead := cache.queue("dead"); len(dead) != 0 {
+		t.Errorf("dead lettered %q", dead)
+	}
+	if spent := cache.budget["127.0.0.1"]; spent != 1 {
+		t.Errorf("spent %d of the budget, want only the crawled page", spent)
+	}
+}
@@ -0,0 +1,302 @@
+package crawler
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	myceliumv1 "mycelium/proto/mycelium/v1"
+)
+
+type FungicideCodec string
+
+const (
+	CodecJSON  FungicideCodec = "json"
+	CodecProto FungicideCodec = "proto"
+)
+
+// ProtoMagic prefixes proto encoded pages. JSON pages always start with '{',
+// so consumers can sniff the first byte during the migration.
+const ProtoMagic = "\x00mpb1"
+
+// MarshalProto encodes the page as a mycelium.v1.Page message, without the
+// ProtoMagic prefix.
+func (p *Page) MarshalProto() ([]byte, error) {
+	return proto.Marshal(p.toProto())
+}
+
+func (p *Page) toProto() *myceliumv1.Page {
+	return &myceliumv1.Page{
+		Title:          p.Title,
+		Description:    p.Description,
+		Author:         p.Author,
+		Keywords:       p.Keywords,
+		Headings:       p.Headings,
+		Content:        p.Content,
+		Links:          linksToProto(p.Links),
+		ScriptLinks:    linksToProto(p.ScriptLinks),
+		ScriptContent:  p.ScriptContent,
+		Location:       p.Location.String(),
+		CreatedAt:      time.Now().UnixMilli(),
+		Trimmed:        p.Trimmed,
+		Referrer:       p.Referrer,
+		Recrawl:        p.Recrawl,
+		PageType:       string(p.Type),
+		Fetch:          p.Fetch.toProto(),
+		Security:       p.Security.toProto(),
+		Lang:           p.Lang,
+		Dir:            p.Dir,
+		HeadingDirs:    p.HeadingDirs,
+		ContentDirs:    p.ContentDirs,
+		Canonical:      p.Canonical,
+		Alternates:     alternatesToProto(p.Alternates),
+		DownloadLinks:  linksToProto(p.DownloadLinks),
+		Session:        p.Session,
+		SoftError:      p.SoftError,
+		Redirects:      p.Redirects,
+		Scripts:        scriptsToProto(p.Scripts),
+		OutlinkDomains: p.OutlinkDomains.toProto(),
+	}
+}
+
+func linksToProto(links []url.URL) []*myceliumv1.Link {
+	var res []*myceliumv1.Link
+	for _, link := range links {
+		res = append(res, &myceliumv1.Link{Url: link.String()})
+	}
+	return res
+}
+
+// UnmarshalPageProto decodes a mycelium.v1.Page message, with or without the
+// ProtoMagic prefix.
+func UnmarshalPageProto(data []byte) (*Page, error) {
+	var msg myceliumv1.Page
+	if err := proto.Unmarshal(bytes.TrimPrefix(data, []byte(ProtoMagic)), &msg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal page: %w", err)
+	}
+
+	location, err := url.Parse(msg.Location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal page location: %w", err)
+	}
+	links, err := linksFromProto(msg.Links)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal page links: %w", err)
+	}
+	scriptLinks, err := linksFromProto(msg.ScriptLinks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal page script links: %w", err)
+	}
+	downloadLinks, err := linksFromProto(msg.DownloadLinks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal page download links: %w", err)
+	}
+
+	return &Page{
+		Title:          msg.Title,
+		Description:    msg.Description,
+		Author:         msg.Author,
+		Keywords:       msg.Keywords,
+		Headings:       msg.Headings,
+		Content:        msg.Content,
+		Links:          links,
+		ScriptLinks:    scriptLinks,
+		ScriptContent:  msg.ScriptContent,
+		Location:       location,
+		Trimmed:        msg.Trimmed,
+		Referrer:       msg.Referrer,
+		Recrawl:        msg.Recrawl,
+		Type:           PageType(msg.PageType),
+		Fetch:          fetchFromProto(msg.Fetch),
+		Security:       securityFromProto(msg.Security),
+		Lang:           msg.Lang,
+		Dir:            msg.Dir,
+		HeadingDirs:    msg.HeadingDirs,
+		ContentDirs:    msg.ContentDirs,
+		Canonical:      msg.Canonical,
+		Alternates:     alternatesFromProto(msg.Alternates),
+		DownloadLinks:  downloadLinks,
+		Session:        msg.Session,
+		SoftError:      msg.SoftError,
+		Redirects:      msg.Redirects,
+		Scripts:        scriptsFromProto(msg.Scripts),
+		OutlinkDomains: outlinksFromProto(msg.OutlinkDomains),
+	}, nil
+}
+
+func linksFromProto(links []*myceliumv1.Link) ([]url.URL, error) {
+	var res []url.URL
+	for _, link := range links {
+		u, err := url.Parse(link.Url)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *u)
+	}
+	return res, nil
+}
+
+func alternatesToProto(alternates []Alternate) []*myceliumv1.Alternate {
+	var res []*myceliumv1.Alternate
+	for _, alt := range alternates {
+		res = append(res, &myceliumv1.Alternate{Url: alt.URL, Hreflang: alt.HrefLang, Type: alt.Type})
+	}
+	return res
+}
+
+func alternatesFromProto(msgs []*myceliumv1.Alternate) []Alternate {
+	var res []Alternate
+	for _, msg := range msgs {
+		res = append(res, Alternate{URL: msg.Url, HrefLang: msg.Hreflang, Type: msg.Type})
+	}
+	return res
+}
+
+func scriptsToProto(scripts []Script) []*myceliumv1.Script {
+	var res []*myceliumv1.Script
+	for _, s := range scripts {
+		res = append(res, &myceliumv1.Script{Type: string(s.Type), MediaType: s.MediaType, Content: s.Content})
+	}
+	return res
+}
+
+func scriptsFromProto(msgs []*myceliumv1.Script) []Script {
+	var res []Script
+	for _, msg := range msgs {
+		res = append(res, Script{Type: ScriptType(msg.Type), MediaType: msg.MediaType, Content: msg.Content})
+	}
+	return res
+}
+
+func (o *OutlinkDomains) toProto() *myceliumv1.OutlinkDomains {
+	if o == nil {
+		return nil
+	}
+	msg := &myceliumv1.OutlinkDomains{Internal: int32(o.Internal)}
+	if len(o.External) > 0 {
+		msg.External = make(map[string]int32, len(o.External))
+		for domain, n := range o.External {
+			msg.External[domain] = int32(n)
+		}
+	}
+	return msg
+}
+
+func outlinksFromProto(msg *myceliumv1.OutlinkDomains) *OutlinkDomains {
+	if msg == nil {
+		return nil
+	}
+	o := &OutlinkDomains{Internal: int(msg.Internal)}
+	if len(msg.External) > 0 {
+		o.External = make(map[string]int, len(msg.External))
+		for domain, n := range msg.External {
+			o.External[domain] = int(n)
+		}
+	}
+	return o
+}
+
+func (f *FetchInfo) toProto() *myceliumv1.FetchInfo {
+	if f == nil {
+		return nil
+	}
+	return &myceliumv1.FetchInfo{
+		StatusCode:      int32(f.StatusCode),
+		ContentType:     f.ContentType,
+		Charset:         f.Charset,
+		FetchedAtMs:     f.FetchedAt.UnixMilli(),
+		DurationMs:      f.Duration.Milliseconds(),
+		DnsMs:           f.DNSLookup.Milliseconds(),
+		TlsHandshakeMs:  f.TLSHandshake.Milliseconds(),
+		RemoteAddr:      f.RemoteAddr,
+		ViaProxy:        f.ViaProxy,
+		ConnReused:      f.ConnReused,
+		BodyBytes:       f.BodyBytes,
+		CompressedBytes: f.CompressedBytes,
+		CacheStatus:     f.CacheStatus,
+		AgeMs:           f.Age.Milliseconds(),
+	}
+}
+
+func fetchFromProto(msg *myceliumv1.FetchInfo) *FetchInfo {
+	if msg == nil {
+		return nil
+	}
+	return &FetchInfo{
+		StatusCode:      int(msg.StatusCode),
+		ContentType:     msg.ContentType,
+		Charset:         msg.Charset,
+		FetchedAt:       time.UnixMilli(msg.FetchedAtMs),
+		Duration:        time.Duration(msg.DurationMs) * time.Millisecond,
+		DNSLookup:       time.Duration(msg.DnsMs) * time.Millisecond,
+		TLSHandshake:    time.Duration(msg.TlsHandshakeMs) * time.Millisecond,
+		RemoteAddr:      msg.RemoteAddr,
+		ViaProxy:        msg.ViaProxy,
+		ConnReused:      msg.ConnReused,
+		BodyBytes:       msg.BodyBytes,
+		CompressedBytes: msg.CompressedBytes,
+		CacheStatus:     msg.CacheStatus,
+		Age:             time.Duration(msg.AgeMs) * time.Millisecond,
+	}
+}
+
+func (s *Security) toProto() *myceliumv1.Security {
+	if s == nil {
+		return nil
+	}
+	return &myceliumv1.Security{
+		TlsVersion: s.TLSVersion,
+		Alpn:       s.ALPN,
+		Subject:    s.Subject,
+		Issuer:     s.Issuer,
+		Sans:       s.SANs,
+		Server:     s.Server,
+	}
+}
+
+func securityFromProto(msg *myceliumv1.Security) *Security {
+	if msg == nil {
+		return nil
+	}
+	return &Security{
+		TLSVersion: msg.TlsVersion,
+		ALPN:       msg.Alpn,
+		Subject:    msg.Subject,
+		Issuer:     msg.Issuer,
+		SANs:       msg.Sans,
+		Server:     msg.Server,
+	}
+}
+
+// encodePage renders page for the fungicide queue with the configured codec,
+// wrapped in an Envelope when a crawler id is set.
+func (c *Crawler) encodePage(page *Page) ([]byte, error) {
+	codec := c.fungicideCodec
+	if codec == "" {
+		codec = CodecJSON
+	}
+
+	var data []byte
+	var err error
+	switch codec {
+	case CodecProto:
+		data, err = page.MarshalProto()
+	case CodecJSON:
+		data, err = page.Marshal()
+	default:
+		return nil, fmt.Errorf("unknown fungicide codec: %s", codec)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if c.crawlerID != "" {
+		return wrapEnvelope(c.crawlerID, c.sessionID, codec, data)
+	}
+	if codec == CodecProto {
+		return append([]byte(ProtoMagic), data...), nil
+	}
+	return data, nil
+}
@@ -0,0 +1,128 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	myceliumv1 "mycelium/proto/mycelium/v1"
+)
+
+func TestProtoRoundTrip(t *testing.T) {
+	page := testPage(t)
+	data, err := page.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range [][]byte{data, append([]byte(ProtoMagic), data...)} {
+		got, err := UnmarshalPageProto(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, page) {
+			t.Errorf("round trip = %+v, want %+v", got, page)
+		}
+	}
+}
+
+// TestJSONAndProtoCarrySameFields encodes a fixture page both ways and
+// compares the fields by name, so a field added to one encoding but not the
+// other fails here.
+func TestJSONAndProtoCarrySameFields(t *testing.T) {
+	page := testPage(t)
+
+	jsonData, err := page.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonFields := decodeFields(t, jsonData)
+
+	protoData, err := page.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg myceliumv1.Page
+	if err := proto.Unmarshal(protoData, &msg); err != nil {
+		t.Fatal(err)
+	}
+	protoJSON, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(&msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	protoFields := decodeFields(t, protoJSON)
+	// links are messages in proto and plain strings in JSON
+	for _, key := range []string{"links", "script_links", "download_links"} {
+		var urls []any
+		for _, link := range protoFields[key].([]any) {
+			urls = append(urls, link.(map[string]any)["url"])
+		}
+		protoFields[key] = urls
+	}
+	// protojson writes int64 fields as strings
+	fetch := protoFields["fetch"].(map[string]any)
+	for key, v := range fetch {
+		if v, ok := v.(string); ok && strings.HasSuffix(key, "_ms") {
+			fetch[key] = json.Number(v)
+		}
+	}
+
+	// both stamp the encoding time, milliseconds apart at most
+	jsonCreated, _ := strconv.ParseInt(string(jsonFields["created_at"].(json.Number)), 10, 64)
+	protoCreated, _ := strconv.ParseInt(protoFields["created_at"].(string), 10, 64)
+	if d := time.Duration(protoCreated-jsonCreated) * time.Millisecond; d < 0 || d > time.Second {
+		t.Errorf("created_at differs by %s between encodings", d)
+	}
+	delete(jsonFields, "created_at")
+	delete(protoFields, "created_at")
+
+	if !reflect.DeepEqual(jsonFields, protoFields) {
+		t.Errorf("encodings differ:\njson:  %v\nproto: %v", jsonFields, protoFields)
+	}
+}
+
+func decodeFields(t *testing.T, data []byte) map[string]any {
+	t.Helper()
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var fields map[string]any
+	if err := dec.Decode(&fields); err != nil {
+		t.Fatal(err)
+	}
+	return fields
+}
+
+func TestEncodePage(t *testing.T) {
+	page := testPage(t)
+
+	data, err := NewCrawler(nil, nil).encodePage(page)
+	if err != nil || data[0] != '{' {
+		t.Errorf("default codec = %q, %v, want JSON", data, err)
+	}
+
+	data, err = NewCrawler(nil, nil, WithFungicideCodec(CodecProto)).encodePage(page)
+	if err != nil || !bytes.HasPrefix(data, []byte(ProtoMagic)) {
+		t.Fatalf("proto codec = %q, %v, want the magic prefix", data, err)
+	}
+	if got, err := UnmarshalPageProto(data); err != nil || !reflect.DeepEqual(got, page) {
+		t.Errorf("decoded %+v, %v, want %+v", got, err, page)
+	}
+
+	if _, err := NewCrawler(nil, nil, WithFungicideCodec("xml")).encodePage(page); err == nil {
+		t.Error("unknown codec accepted")
+	}
+}
+
+func TestUnmarshalPageProtoErrors(t *testing.T) {
+	bad, _ := proto.Marshal(&myceliumv1.Page{Location: "https://example.com/", Links: []*myceliumv1.Link{{Url: "%zz"}}})
+	for _, data := range [][]byte{[]byte(ProtoMagic + "\xff\xff"), bad} {
+		if _, err := UnmarshalPageProto(data); err == nil {
+			t.Errorf("UnmarshalPageProto(%q) accepted", data)
+		}
+	}
+}
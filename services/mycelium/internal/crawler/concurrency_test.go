@@ -0,0 +1,220 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// linkGraphServer serves pages /0 to /n-1, each linking to a few others, and
+// counts how often each page is fetched.
+func linkGraphServer(t *testing.T, n int) (*httptest.Server, func() map[string]int) {
+	t.Helper()
+	var mu sync.Mutex
+	hits := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+
+		i, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		if err != nil || i < 0 || i >= n {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		var b strings.Builder
+		b.WriteString("<html><body>")
+		for _, next := range []int{(i + 1) % n, (i * 2) % n, (i*7 + 3) % n} {
+			fmt.Fprintf(&b, `<a href="http://%s/%d">%d</a>`, r.Host, next, next)
+		}
+		b.WriteString("</body></html>")
+		fmt.Fprint(w, b.String())
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() map[string]int {
+		mu.Lock()
+		defer mu.Unlock()
+		copied := make(map[string]int, len(hits))
+		for k, v := range hits {
+			copied[k] = v
+		}
+		return copied
+	}
+}
+
+// memStore keeps stored pages in memory.
+type memStore struct {
+	mu    sync.Mutex
+	items map[string][]byte
+}
+
+func newMemStore() *memStore {
+	return &memStore{items: map[string][]byte{}}
+}
+
+func (s *memStore) Store(item StoreItem, extension string) (string, error) {
+	data, err := item.Marshal()
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := fmt.Sprintf("%s%d%s", item.Prefix(), len(s.items), extension)
+	s.items[id] = data
+	return id, nil
+}
+
+func (s *memStore) Retrieve(id string, extension string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, found := s.items[id]
+	if !found {
+		return nil, fmt.Errorf("no item %s", id)
+	}
+	return data, nil
+}
+
+func (s *memStore) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.items)
+}
+
+// TestConcurrentCrawl runs several Crawl calls on one Crawler, as cmd/app
+// does, with every piece of shared state in play. Run it with -race.
+func TestConcurrentCrawl(t *testing.T) {
+	const (
+		pages   = 60
+		workers = 8
+	)
+	srv, hits := linkGraphServer(t, pages)
+
+	cache := newMemCache()
+	store := newMemStore()
+	metrics := NewCounterMetrics()
+	c := NewCrawler(cache, store,
+		WithMyceliumIngressKey("ingress"),
+		WithHeaderChooser(&cyclingChooser{count: 5}),
+		WithStickyUserAgents(true),
+		WithDomainRateLimit(1000),
+		WithMetrics(metrics),
+		WithMaxIdle(1))
+
+	if err := c.Enqueue(context.Background(), IngressItem{Location: srv.URL + "/0"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			errs <- c.Crawl(WithWorkerID(context.Background(), id))
+		}(i)
+	}
+	// read shared state while the workers run
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Millisecond):
+				c.Workers()
+				metrics.Snapshot()
+			}
+		}
+	}()
+	wg.Wait()
+	close(stop)
+	readers.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Crawl = %v", err)
+		}
+	}
+
+	got := hits()
+	fetches := 0
+	for i := 0; i < pages; i++ {
+		n := got[fmt.Sprintf("/%d", i)]
+		if n == 0 {
+			t.Errorf("/%d never fetched", i)
+		}
+		fetches += n
+	}
+	if fetched := metrics.Get(MetricPagesFetched); fetched != int64(fetches) {
+		t.Errorf("metrics count %d pages fetched, server saw %d", fetched, fetches)
+	}
+	if stored := store.len(); stored != fetches {
+		t.Errorf("stored %d pages, want one per fetch (%d)", stored, fetches)
+	}
+	if states := c.Workers(); len(states) != 0 {
+		t.Errorf("workers still registered after Crawl returned: %+v", states)
+	}
+}
+
+// TestCrawlIdleTimersAreIndependent starts two Crawl calls half a second
+// apart on an empty queue; each must time out on its own idle timer.
+func TestCrawlIdleTimersAreIndependent(t *testing.T) {
+	const stagger = 500 * time.Millisecond
+	c := NewCrawler(newMemCache(), nil, quiet, WithMyceliumIngressKey("ingress"), WithMaxIdle(1))
+
+	start := time.Now()
+	exited := make([]time.Duration, 2)
+	var wg sync.WaitGroup
+	run := func(id int) {
+		defer wg.Done()
+		if err := c.Crawl(WithWorkerID(context.Background(), id)); err != nil {
+			t.Errorf("worker %d: %v", id, err)
+		}
+		exited[id-1] = time.Since(start)
+	}
+
+	wg.Add(2)
+	go run(1)
+	time.Sleep(stagger)
+	go run(2)
+
+	time.Sleep(100 * time.Millisecond)
+	if got := idleWorkerIDs(c.Workers()); !slices.Equal(got, []int{1, 2}) {
+		t.Errorf("workers = %v while both run, want [1 2]", got)
+	}
+	// halfway between the two expected exits
+	time.Sleep(650 * time.Millisecond)
+	if got := idleWorkerIDs(c.Workers()); !slices.Equal(got, []int{2}) {
+		t.Errorf("workers = %v after the first idled out, want [2]", got)
+	}
+	wg.Wait()
+
+	if exited[0] < time.Second || exited[0] > time.Second+stagger/2 {
+		t.Errorf("worker 1 exited after %s, want about 1s", exited[0])
+	}
+	if gap := exited[1] - exited[0]; gap < stagger*3/4 {
+		t.Errorf("worker 2 exited %s after worker 1, want about %s", gap, stagger)
+	}
+}
+
+func idleWorkerIDs(states []WorkerState) []int {
+	ids := make([]int, 0, len(states))
+	for _, state := range states {
+		if !state.Idle {
+			continue
+		}
+		ids = append(ids, state.ID)
+	}
+	return ids
+}
@@ -1,7 +1,24 @@
 package crawler
 
+import "time"
+
 const (
 	defaultUserAgent         = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/134.0.0.0 Safari/537.36"
 	userAgentCanonicalHeader = "User-Agent"
-	maxRetries               = 3
+	defaultMaxRetries        = 3
+	defaultRequestTimeout    = 10 * time.Second
+	stickyUserAgentCapacity  = 10000
+	domainLimiterCapacity    = 10000
+	rejectedDomainCapacity   = 100000
+	hostSlotMargin           = 5 * time.Second
+	hostBusyDelay            = 200 * time.Millisecond
+	hostBusyBackoffAfter     = 10
+	cacheErrorDelay          = 500 * time.Millisecond
+	controlCheckInterval     = time.Second
+	maxPausedBackoff         = 10 * time.Second
+	robotsClaimTTL           = 30 * time.Second
+	robotsPollInterval       = 250 * time.Millisecond
+	hostFoldRefresh          = time.Minute
+	maxRequestBodyBytes      = 64 << 10
+	queueLatencySamples      = 1024
 )
@@ -0,0 +1,33 @@
+package crawler
+
+import (
+	"errors"
+	"mime"
+	"strings"
+)
+
+// parseContentType splits a Content-Type header into its lowercased media
+// type and charset. ok is false when the header is missing or has no usable
+// media type, in which case the body should be sniffed instead.
+func parseContentType(header string) (mediaType string, charset string, ok bool) {
+	if strings.TrimSpace(header) == "" {
+		return "", "", false
+	}
+	mediaType, params, err := mime.ParseMediaType(header)
+	if err != nil && !errors.Is(err, mime.ErrInvalidMediaParameter) {
+		return "", "", false
+	}
+	return mediaType, strings.ToLower(params["charset"]), true
+}
+
+const mediaTypeXHTML = "application/xhtml+xml"
+
+// isTextual reports whether mediaType is worth reading. XHTML is served
+// under application/ but is parsed like any other HTML page.
+func isTextual(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "text/") || isHTML(mediaType)
+}
+
+func isHTML(mediaType string) bool {
+	return mediaType == "text/html" || mediaType == mediaTypeXHTML
+}
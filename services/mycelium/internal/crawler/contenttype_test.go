@@ -0,0 +1,82 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseContentType(t *testing.T) {
+	tests := []struct {
+		header    string
+		mediaType string
+		charset   string
+		ok        bool
+	}{
+		{"", "", "", false},
+		{"   ", "", "", false},
+		{"text/html", "text/html", "", true},
+		{"Text/HTML;charset=UTF-8", "text/html", "utf-8", true},
+		{"text/html; charset=\"ISO-8859-1\"; foo=bar", "text/html", "iso-8859-1", true},
+		{"text/html; charset", "text/html", "", true},
+		{"application/xhtml+xml; charset=utf-8", "application/xhtml+xml", "utf-8", true},
+		{"image/png", "image/png", "", true},
+		{";;;", "", "", false},
+	}
+	for _, test := range tests {
+		mediaType, charset, ok := parseContentType(test.header)
+		if mediaType != test.mediaType || charset != test.charset || ok != test.ok {
+			t.Errorf("parseContentType(%q) = %q, %q, %t; want %q, %q, %t",
+				test.header, mediaType, charset, ok, test.mediaType, test.charset, test.ok)
+		}
+	}
+}
+
+func TestGetPageContentTypes(t *testing.T) {
+	const html = "<html><head><title>typed</title></head><body>hi</body></html>"
+	tests := []struct {
+		header  []string
+		body    string
+		wantErr error
+		charset string
+	}{
+		// sniffing reports html as utf-8
+		{header: nil, body: html, charset: "utf-8"},
+		{header: []string{""}, body: html, charset: "utf-8"},
+		{header: []string{"Text/HTML;charset=UTF-8"}, body: html, charset: "utf-8"},
+		{header: []string{"text/html; charset=utf-8; boundary=x"}, body: html, charset: "utf-8"},
+		{header: []string{"application/xhtml+xml"}, body: html},
+		{header: []string{"image/png"}, body: html, wantErr: ErrUnsupportedContentType},
+		{header: nil, body: string(pngHeader), wantErr: ErrUnsupportedContentType},
+		{header: nil, body: "%PDF-1.7 not a page", wantErr: ErrUnsupportedContentType},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprint(test.header), func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// a nil entry stops net/http from sniffing a type of its own
+				w.Header()["Content-Type"] = test.header
+				fmt.Fprint(w, test.body)
+			}))
+			defer srv.Close()
+
+			page, err := getPage(t, NewCrawler(nil, nil, quiet), srv.URL+"/")
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("GetPage = %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if page.Title != "typed" {
+				t.Errorf("title = %q, want the body parsed as html", page.Title)
+			}
+			if page.Fetch.Charset != test.charset {
+				t.Errorf("charset = %q, want %q", page.Fetch.Charset, test.charset)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package crawler
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ControlPaused is the control state that stops every crawler sharing the
+// control key from popping new items.
+const ControlPaused = "paused"
+
+// ControlCache is implemented by caches that store the fleet control state.
+// It is required by WithControlKey.
+type ControlCache interface {
+	ControlState(ctx context.Context, key string) (string, error)
+}
+
+// WithControlKey makes Crawl honour the control state stored at key. The
+// state is read at most once per controlCheckInterval and shared by every
+// worker of the crawler.
+func WithControlKey(key string) CrawlerOption {
+	return func(c *Crawler) {
+		c.control = &controlState{
+			key:        key,
+			interval:   controlCheckInterval,
+			maxBackoff: maxPausedBackoff,
+		}
+	}
+}
+
+type controlState struct {
+	key        string
+	interval   time.Duration
+	maxBackoff time.Duration
+	mu         sync.Mutex
+	paused     bool
+	checkedAt  time.Time
+}
+
+// backoff returns how long a paused worker waits after having waited prev,
+// starting at the check interval and doubling up to maxBackoff.
+func (cs *controlState) backoff(prev time.Duration) time.Duration {
+	if prev == 0 {
+		return cs.interval
+	}
+	return min(prev*2, cs.maxBackoff)
+}
+
+// Paused reports whether the fleet is paused, as of the last check.
+func (c *Crawler) Paused() bool {
+	if c.control == nil {
+		return false
+	}
+	c.control.mu.Lock()
+	defer c.control.mu.Unlock()
+	return c.control.paused
+}
+
+// paused refreshes the control state if it is stale. Failing to read it
+// keeps the last known state.
+func (c *Crawler) paused(ctx context.Context) bool {
+	if c.control == nil {
+		return false
+	}
+	controls, ok := c.cache.(ControlCache)
+	if !ok {
+		return false
+	}
+
+	c.control.mu.Lock()
+	defer c.control.mu.Unlock()
+	if time.Since(c.control.checkedAt) < c.control.interval {
+		return c.control.paused
+	}
+	c.control.checkedAt = time.Now()
+
+	state, err := controls.ControlState(ctx, c.control.key)
+	if err != nil {
+		c.log(ctx).Error("failed to read control state", "error", err)
+		return c.control.paused
+	}
+	paused := state == ControlPaused
+	if paused != c.control.paused {
+		if paused {
+			c.log(ctx).Info("crawling paused by control key", "key", c.control.key)
+		} else {
+			c.log(ctx).Info("crawling resumed by control key", "key", c.control.key)
+		}
+	}
+	c.control.paused = paused
+	return paused
+}
@@ -0,0 +1,75 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestControlBackoff(t *testing.T) {
+	cs := &controlState{interval: time.Second, maxBackoff: 5 * time.Second}
+	var got []time.Duration
+	var backoff time.Duration
+	for range 5 {
+		backoff = cs.backoff(backoff)
+		got = append(got, backoff)
+	}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("backoff = %v, want %v", got, want)
+	}
+}
+
+func TestPauseStopsPopping(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><body>page</body></html>")
+	}))
+	defer srv.Close()
+
+	cache := newMemCache()
+	c := NewCrawler(cache, nil, quiet, WithMyceliumIngressKey("ingress"), WithControlKey("control"))
+	c.control.interval = time.Millisecond
+	c.control.maxBackoff = 5 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.Crawl(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	waitUntil := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// pause mid-run, once the worker is already polling
+	cache.setControl("control", ControlPaused)
+	waitUntil("the pause to be seen", c.Paused)
+	for i := range 3 {
+		if err := c.Enqueue(context.Background(), IngressItem{Location: fmt.Sprintf("%s/%d", srv.URL, i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	if queued := len(cache.queue("ingress")); queued != 3 {
+		t.Fatalf("%d items left while paused, want all 3", queued)
+	}
+
+	cache.setControl("control", "")
+	waitUntil("the queue to drain after resuming", func() bool { return len(cache.queue("ingress")) == 0 })
+	if c.Paused() {
+		t.Error("still paused after the control key was cleared")
+	}
+}
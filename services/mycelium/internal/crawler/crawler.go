@@ -1,13 +1,26 @@
 package crawler
 
 import (
+	"bufio"
+	"cmp"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type StoreItem interface {
@@ -15,6 +28,15 @@ type StoreItem interface {
 	Marshal() ([]byte, error)
 }
 
+// StoreItemMeta is optionally implemented by store items so stores can
+// partition and index them without unmarshaling the payload.
+type StoreItemMeta interface {
+	// Key is a stable id for the item, the same each time it is stored.
+	Key() string
+	CreatedAt() time.Time
+	Labels() map[string]string
+}
+
 type Store interface {
 	Store(item StoreItem, extension string) (id string, err error)
 	Retrieve(id string, extension string) (data []byte, err error)
@@ -24,43 +46,215 @@ type UrlFilter interface {
 	Filter(loc *url.URL) bool
 }
 
+// ReasonedUrlFilter is optionally implemented by filters that can report
+// which of their rules matched.
+type ReasonedUrlFilter interface {
+	Match(loc *url.URL) (blocked bool, rule string)
+}
+
+type UrlRewriter interface {
+	Rewrite(loc *url.URL) *url.URL
+}
+
+// IngressItem is a queued url. Parent is the page that linked to it and
+// SeedOrigin the seed its crawl path started from; both are empty for seeds
+// and for items queued before they were recorded.
 type IngressItem struct {
-	Location string `json:"location"`
-	Retries  int32  `json:"retries"`
+	Location   string `json:"location"`
+	Retries    int32  `json:"retries"`
+	Depth      int32  `json:"depth,omitempty"`
+	Parent     string `json:"parent,omitempty"`
+	SeedOrigin string `json:"seed_origin,omitempty"`
+	Recrawl    bool   `json:"recrawl,omitempty"`
+	// Priority and MaxDepth come from the seed and are inherited by every
+	// page found from it. A MaxDepth of 0 leaves the depth unbounded.
+	Priority int32 `json:"priority,omitempty"`
+	MaxDepth int32 `json:"max_depth,omitempty"`
+	// Session is the id of the run that seeded the item.
+	Session string `json:"session,omitempty"`
+	// EnqueuedAt is when the item was last pushed to the ingress queue, in
+	// unix milliseconds, or 0 from producers that do not set it.
+	EnqueuedAt int64 `json:"enqueued_at,omitempty"`
+}
+
+// SeedItem is a seed url with its optional per-seed settings.
+type SeedItem struct {
+	Location string
+	Priority int32
+	MaxDepth int32
+}
+
+// child returns the item for a link found on the page at item.
+func (item IngressItem) child(location string) IngressItem {
+	origin := item.SeedOrigin
+	if origin == "" {
+		origin = item.Location
+	}
+	return IngressItem{
+		Location:   location,
+		Depth:      item.Depth + 1,
+		Parent:     item.Location,
+		SeedOrigin: origin,
+		Priority:   item.Priority,
+		MaxDepth:   item.MaxDepth,
+		Session:    item.Session,
+	}
+}
+
+// atMaxDepth reports whether links found on item's page are too deep to
+// queue.
+func (item IngressItem) atMaxDepth() bool {
+	return item.MaxDepth > 0 && item.Depth >= item.MaxDepth
 }
 
 type CrawlerCache interface {
 	Visit(context.Context, string) error
+	Unvisit(context.Context, string) error
 	IsVisited(context.Context, string) (bool, error)
 	PushToFungicide(context.Context, string, string) error
 	PushToMyceliumIngress(context.Context, string, string) error
 	PopFromMyceliumIngress(context.Context, string) (string, error)
 	IsBlacklisted(context.Context, string, string) (bool, error)
 	IngressQueueSize(context.Context, string) (int32, error)
+	QueuedLocations(context.Context, string) (map[string]bool, error)
+	ClearQueue(context.Context, string) error
 }
 
+type SeedMode string
+
+const (
+	SeedSkip    SeedMode = "skip"
+	SeedMerge   SeedMode = "merge"
+	SeedReplace SeedMode = "replace"
+)
+
+// LinkQueueingMode controls whether Crawl queues the links of fetched pages
+// itself or leaves frontier expansion to fungicide.
+type LinkQueueingMode string
+
+const (
+	LinkQueueingNone                LinkQueueingMode = "none"
+	LinkQueueingAlways              LinkQueueingMode = "always"
+	LinkQueueingOnlyWhenNoFungicide LinkQueueingMode = "onlyWhenNoFungicide"
+)
+
 type StringChooser interface {
 	Pick() string
 }
 
+// ProxyURLChooser is optionally implemented by proxy choosers that keep their
+// proxies parsed, sparing a url.Parse on every request.
+type ProxyURLChooser interface {
+	PickURL() *url.URL
+}
+
+type HeaderChooser interface {
+	Pick() http.Header
+}
+
+// ProxyReporter is optionally implemented by proxy choosers that want
+// feedback on how requests through each proxy performed.
+type ProxyReporter interface {
+	ReportResult(proxy string, success bool, latency time.Duration)
+}
+
+type proxyUsedKey struct{}
+
+// Crawler is safe for concurrent use: any number of goroutines may call Crawl
+// on the same Crawler. Configuration is read-only after NewCrawler, and state
+// shared between workers (choosers, metrics, limiters) synchronizes itself.
+// Per-worker state such as idle time lives inside each Crawl call.
 type Crawler struct {
-	client               *http.Client
-	userAgentChooser     StringChooser
-	proxyChooser         StringChooser
-	cache                CrawlerCache
-	store                Store
-	urlFilters           []UrlFilter
-	maxIdleSeconds       int
-	idleSeconds          int
-	fungicideQueueKey    string
-	myceliumIngressKey   string
-	myceliumBlacklistKey string
+	client                *http.Client
+	headerChooser         HeaderChooser
+	stickyUserAgents      *stickyUserAgents
+	proxyChooser          StringChooser
+	proxyBypass           []string
+	domainOverrides       map[string]*domainOverride
+	cache                 CrawlerCache
+	store                 Store
+	urlFilters            []UrlFilter
+	urlRewriters          []UrlRewriter
+	pageFilters           []PageFilter
+	queueDroppedLinks     bool
+	linkQueueing          LinkQueueingMode
+	softErrorPolicy       SoftErrorPolicy
+	scriptPolicy          *ScriptPolicy
+	cacheBusting          bool
+	sampler               *SamplingStore
+	hashRoutes            bool
+	feedParsing           bool
+	hooks                 Hooks
+	maxBodyBytes          int64
+	malformedKey          string
+	malformedMax          int64
+	maxIdleSeconds        int
+	fungicideQueueKey     string
+	myceliumIngressKey    string
+	myceliumBlacklistKey  string
+	metrics               Metrics
+	logger                *slog.Logger
+	fungicideCodec        FungicideCodec
+	crawlerID             string
+	sessionID             string
+	failures              *failureCapture
+	verifyExternal        bool
+	maxPayloadBytes       int
+	batchSize             int
+	batchInterval         time.Duration
+	spoolDir              string
+	sink                  *fungicideSink
+	rejected              *domainSet
+	errorBudget           *DomainErrorBudget
+	recrawl               *RecrawlPolicy
+	changeDetection       bool
+	domainBudget          int64
+	bandwidthBudget       int64
+	exhausted             *domainSet
+	deadLetterKey         string
+	hostSlots             int
+	hostSlotTTL           time.Duration
+	tracer                trace.Tracer
+	control               *controlState
+	lookahead             int
+	maxLinksPerPage       int
+	linkSelection         LinkSelection
+	frontierCap           int32
+	overflowKey           string
+	now                   func() time.Time
+	maxRetries            int
+	maxRedirects          int
+	maxCrossHostRedirects int
+	requestTimeout        time.Duration
+	pageTimeout           time.Duration
+	transportTuning       *TransportTuning
+	domainLimiter         *domainLimiter
+	globalLimiter         *globalLimiter
+	workers               *workerRegistry
+	stats                 *crawlStats
+	hostFoldTTL           time.Duration
+	hostFolds             *hostFolds
+	politeness            *Politeness
 }
 
 type CrawlerOption func(*Crawler)
 
+// NewCrawler builds a crawler. cache and store may be nil when the crawler is
+// only used to fetch pages directly with GetPage.
 func NewCrawler(cache CrawlerCache, store Store, opt ...CrawlerOption) *Crawler {
 	c := new(Crawler)
+	c.logger = slog.Default()
+	c.metrics = nopMetrics{}
+	c.tracer = nopTracer()
+	c.workers = &workerRegistry{}
+	c.stats = &crawlStats{}
+	c.rejected = newDomainSet(rejectedDomainCapacity)
+	c.exhausted = newDomainSet(rejectedDomainCapacity)
+	c.now = time.Now
+	c.maxRetries = defaultMaxRetries
+	c.requestTimeout = defaultRequestTimeout
+	c.softErrorPolicy = SoftErrorDrop
+	c.maxRedirects = defaultMaxRedirects
 	for _, o := range opt {
 		o(c)
 	}
@@ -69,26 +263,112 @@ func NewCrawler(cache CrawlerCache, store Store, opt ...CrawlerOption) *Crawler
 		c.client = &http.Client{}
 	}
 
-	if c.proxyChooser != nil {
-		c.client.Transport = &http.Transport{
-			Proxy: proxyURL(c.proxyChooser),
+	c.logger = c.logger.With("component", "crawler")
+	c.configureTransport()
+	c.client.Timeout = c.requestTimeout
+	c.setupRedirects()
+	c.setupOverrides()
+	c.setupPoliteness()
+
+	c.cache = cache
+	c.store = store
+
+	if c.hostFoldTTL > 0 {
+		if _, ok := c.cache.(HostFoldCache); ok {
+			c.hostFolds = newHostFolds(rejectedDomainCapacity)
+		} else {
+			c.logger.Warn("cache cannot share host folds, host folding disabled")
 		}
 	}
 
-	c.client.Timeout = 10 * time.Second
+	if c.errorBudget != nil {
+		if _, ok := c.cache.(DomainHealthCache); !ok {
+			c.logger.Warn("cache cannot track domain health, error budget disabled")
+		}
+	}
 
-	c.cache = cache
-	c.store = store
+	if c.recrawl != nil {
+		if _, ok := c.cache.(RecrawlCache); !ok {
+			c.logger.Warn("cache cannot schedule recrawls, recrawl disabled")
+		}
+	}
+
+	if c.changeDetection {
+		if _, ok := c.cache.(ContentHashCache); !ok {
+			c.logger.Warn("cache cannot store content hashes, change detection disabled")
+		}
+	}
+
+	if c.verifyExternal {
+		if _, ok := c.cache.(VerifiedCache); !ok {
+			c.logger.Warn("cache cannot claim link verifications, external links are not verified")
+		}
+	}
+
+	if c.politeness != nil {
+		if _, ok := c.cache.(HostSlotCache); !ok {
+			c.logger.Warn("cache cannot hand out host slots, politeness concurrency disabled")
+		}
+		if _, ok := c.cache.(DelayCache); !ok {
+			c.logger.Warn("cache cannot delay items, politeness time windows disabled")
+		}
+	}
+
+	if (c.hostSlots > 0 || c.politeness != nil) && c.hostSlotTTL <= 0 {
+		c.hostSlotTTL = c.requestTimeout + hostSlotMargin
+	}
+
+	if c.batchSize > 1 && c.cache != nil && c.fungicideQueueKey != "" {
+		c.sink = newFungicideSink(c.batchSize, c.batchInterval, c.spoolDir, c.pushFungicide, c.logger)
+		c.sink.start()
+	}
 
 	return c
 }
 
+// Close pushes any pages still buffered for fungicide. Crawl must not be
+// called afterwards.
+func (c *Crawler) Close(ctx context.Context) {
+	if c.sink != nil {
+		c.sink.close(ctx)
+	}
+}
+
 func WithUrlFilters(filters []UrlFilter) CrawlerOption {
 	return func(c *Crawler) {
 		c.urlFilters = filters
 	}
 }
 
+func WithUrlRewriters(rewriters []UrlRewriter) CrawlerOption {
+	return func(c *Crawler) {
+		c.urlRewriters = rewriters
+	}
+}
+
+func WithPageFilters(filters []PageFilter) CrawlerOption {
+	return func(c *Crawler) {
+		c.pageFilters = filters
+	}
+}
+
+// WithQueueDroppedLinks queues the links of pages dropped by a PageFilter,
+// since a thin page can still link to rich ones.
+func WithQueueDroppedLinks(queue bool) CrawlerOption {
+	return func(c *Crawler) {
+		c.queueDroppedLinks = queue
+	}
+}
+
+// WithLinkQueueingMode sets when Crawl queues extracted links. The default,
+// LinkQueueingOnlyWhenNoFungicide, leaves expansion to fungicide verdicts
+// whenever pages are pushed to fungicide.
+func WithLinkQueueingMode(mode LinkQueueingMode) CrawlerOption {
+	return func(c *Crawler) {
+		c.linkQueueing = mode
+	}
+}
+
 func WithMaxIdle(maxIdleSeconds int) CrawlerOption {
 	return func(c *Crawler) {
 		c.maxIdleSeconds = maxIdleSeconds
@@ -107,9 +387,19 @@ func WithProxyChooser(proxyChooser StringChooser) CrawlerOption {
 	}
 }
 
-func WithUserAgentChooser(userAgentChooser StringChooser) CrawlerOption {
+func WithHeaderChooser(headerChooser HeaderChooser) CrawlerOption {
+	return func(c *Crawler) {
+		c.headerChooser = headerChooser
+	}
+}
+
+func WithStickyUserAgents(sticky bool) CrawlerOption {
 	return func(c *Crawler) {
-		c.userAgentChooser = userAgentChooser
+		if sticky {
+			c.stickyUserAgents = newStickyUserAgents(stickyUserAgentCapacity)
+		} else {
+			c.stickyUserAgents = nil
+		}
 	}
 }
 
@@ -119,6 +409,43 @@ func WithFungicideQueueKey(key string) CrawlerOption {
 	}
 }
 
+// WithFungicideCodec selects how pages pushed to fungicide are encoded.
+// JSON is the default.
+func WithFungicideCodec(codec FungicideCodec) CrawlerOption {
+	return func(c *Crawler) {
+		c.fungicideCodec = codec
+	}
+}
+
+// WithEnvelope wraps pages pushed to fungicide in an Envelope carrying
+// crawlerID. An empty id pushes bare pages.
+func WithEnvelope(crawlerID string) CrawlerOption {
+	return func(c *Crawler) {
+		c.crawlerID = crawlerID
+	}
+}
+
+// WithFungicideBatching buffers pages pushed to fungicide and sends them in
+// batches of size, or every interval if that comes first. Batches that fail
+// to push are spooled to spoolDir and replayed on the next start. A size of
+// 1 or less pushes every page immediately.
+func WithFungicideBatching(size int, interval time.Duration, spoolDir string) CrawlerOption {
+	return func(c *Crawler) {
+		c.batchSize = size
+		c.batchInterval = interval
+		c.spoolDir = spoolDir
+	}
+}
+
+// WithFungicidePayloadBudget trims pages pushed to fungicide that encode to
+// more than maxBytes. Script content goes first, then content beyond a block
+// cap. A non-positive budget pushes pages whole.
+func WithFungicidePayloadBudget(maxBytes int) CrawlerOption {
+	return func(c *Crawler) {
+		c.maxPayloadBytes = maxBytes
+	}
+}
+
 func WithMyceliumIngressKey(key string) CrawlerOption {
 	return func(c *Crawler) {
 		c.myceliumIngressKey = key
@@ -131,197 +458,1067 @@ func WithMyceliumBlacklistKey(key string) CrawlerOption {
 	}
 }
 
-func (c *Crawler) Seed(ctx context.Context, seed []string) error {
+// WithMaxRetries sets how many times a failing item is retried before it
+// goes to the dead letter queue.
+func WithMaxRetries(maxRetries int) CrawlerOption {
+	return func(c *Crawler) {
+		c.maxRetries = maxRetries
+	}
+}
+
+func WithRequestTimeout(timeout time.Duration) CrawlerOption {
+	return func(c *Crawler) {
+		c.requestTimeout = timeout
+	}
+}
+
+// WithDomainRateLimit caps requests to each registrable domain at rps across
+// all workers. A non-positive rps disables the limit.
+func WithDomainRateLimit(rps float64) CrawlerOption {
+	return func(c *Crawler) {
+		if rps > 0 {
+			c.domainLimiter = newDomainLimiter(rps)
+		} else {
+			c.domainLimiter = nil
+		}
+	}
+}
+
+// WithGlobalRateLimit caps requests across all domains and workers at rps,
+// allowing bursts of up to burst requests. Per domain limits still apply;
+// a request waits for both. A non-positive rps disables the limit.
+func WithGlobalRateLimit(rps float64, burst int) CrawlerOption {
+	return func(c *Crawler) {
+		if rps > 0 {
+			c.globalLimiter = newGlobalLimiter(rps, burst)
+		} else {
+			c.globalLimiter = nil
+		}
+	}
+}
+
+// waitGlobal blocks until the global rate limit allows a request.
+func (c *Crawler) waitGlobal(ctx context.Context) error {
+	if c.globalLimiter == nil {
+		return nil
+	}
+	return c.globalLimiter.wait(ctx)
+}
+
+// WithLogger sets the logger for crawler output. Records from Crawl carry
+// the worker id when one was set with WithWorkerID.
+func WithLogger(logger *slog.Logger) CrawlerOption {
+	return func(c *Crawler) {
+		c.logger = logger
+	}
+}
+
+func WithMetrics(metrics Metrics) CrawlerOption {
+	return func(c *Crawler) {
+		c.metrics = metrics
+	}
+}
+
+// Workers returns the last reported state of each running Crawl call that
+// was started with a worker id.
+func (c *Crawler) Workers() []WorkerState {
+	return c.workers.snapshot()
+}
+
+// RateLimitedDomains returns how many domains are currently waiting on the
+// per-domain rate limit.
+func (c *Crawler) RateLimitedDomains() int {
+	if c.domainLimiter == nil {
+		return 0
+	}
+	return c.domainLimiter.pending()
+}
+
+// Seed pushes seed urls into the ingress queue according to mode. Duplicate
+// seeds are only pushed once. Seeds with a higher priority are pushed first,
+// so they are crawled before the rest. SeedMerge only recognizes queued
+// seeds from the same session; a seed another run still has queued is
+// pushed again and dropped as visited once one copy is crawled.
+func (c *Crawler) Seed(ctx context.Context, seed []SeedItem, mode SeedMode) error {
+	if c.cache == nil {
+		return fmt.Errorf("crawler cache not configured")
+	}
 	if c.myceliumIngressKey == "" {
 		return fmt.Errorf("mycelium ingress queue key not configured")
 	}
 
-	size, err := c.cache.IngressQueueSize(ctx, c.myceliumIngressKey)
-	if err != nil {
-		return fmt.Errorf("failed to get ingress queue size: %w", err)
+	switch mode {
+	case SeedSkip, "":
+		size, err := c.cache.IngressQueueSize(ctx, c.myceliumIngressKey)
+		if err != nil {
+			return fmt.Errorf("failed to get ingress queue size: %w", err)
+		}
+		if size > 0 {
+			c.log(ctx).Info("ingress queue is non-empty, skipping seed stage", "length", size)
+			return nil
+		}
+	case SeedReplace:
+		if err := c.cache.ClearQueue(ctx, c.myceliumIngressKey); err != nil {
+			return fmt.Errorf("failed to clear ingress queue: %w", err)
+		}
+		c.log(ctx).Info("cleared ingress queue before seeding")
+	case SeedMerge:
+	default:
+		return fmt.Errorf("unknown seed mode: %s", mode)
 	}
 
-	if size > 0 {
-		fmt.Printf("Ingress queue is non-empty (length %d), skipping seed stage\n", size)
-		return nil
+	seed = slices.Clone(seed)
+	slices.SortStableFunc(seed, func(a, b SeedItem) int {
+		return cmp.Compare(b.Priority, a.Priority)
+	})
+
+	// merging checks every seed against the queue, so read it once
+	var queued map[string]bool
+	if mode == SeedMerge {
+		var err error
+		if queued, err = c.cache.QueuedLocations(ctx, c.myceliumIngressKey); err != nil {
+			return fmt.Errorf("failed to read ingress queue: %w", err)
+		}
 	}
 
-	for _, seedUrl := range seed {
+	seen := map[string]bool{}
+	seeded := 0
+	for _, s := range seed {
+		seedUrl := s.Location
+		if seen[seedUrl] {
+			continue
+		}
+		seen[seedUrl] = true
+
 		ingressItem := IngressItem{
 			Location: seedUrl,
 			Retries:  0,
+			Priority: s.Priority,
+			MaxDepth: s.MaxDepth,
+			Session:  c.sessionID,
 		}
+		c.stampEnqueued(&ingressItem)
 
 		itemJSON, err := json.Marshal(ingressItem)
 		if err != nil {
 			return fmt.Errorf("failed to marshal seed item: %w", err)
 		}
 
+		if mode == SeedMerge {
+			known, err := c.isKnown(ctx, seedUrl, queued)
+			if err != nil {
+				return fmt.Errorf("failed to check seed %s: %w", seedUrl, err)
+			}
+			if known {
+				continue
+			}
+		}
+
 		err = c.cache.PushToMyceliumIngress(ctx, string(itemJSON), c.myceliumIngressKey)
 		if err != nil {
 			return fmt.Errorf("failed to seed %s: %w", seedUrl, err)
 		}
+		seeded++
 	}
 
-	fmt.Printf("Seeded %d URLs to ingress queue\n", len(seed))
+	c.log(ctx).Info("seeded ingress queue", "count", seeded)
 	return nil
 }
 
+// TryVisitCache is implemented by caches that can check and mark a url
+// visited in one step, so two crawlers popping the same url do not both
+// fetch it.
+type TryVisitCache interface {
+	TryVisit(ctx context.Context, location string) (bool, error)
+}
+
+// tryVisit marks location visited and reports whether it was not already.
+func (c *Crawler) tryVisit(ctx context.Context, location string) (bool, error) {
+	if visits, ok := c.cache.(TryVisitCache); ok {
+		return visits.TryVisit(ctx, location)
+	}
+	visited, err := c.cache.IsVisited(ctx, location)
+	if err != nil || visited {
+		return false, err
+	}
+	c.cache.Visit(ctx, location)
+	return true, nil
+}
+
+// isKnown reports whether location was already crawled or is among the
+// queued locations.
+func (c *Crawler) isKnown(ctx context.Context, location string, queued map[string]bool) (bool, error) {
+	if queued[location] {
+		return true, nil
+	}
+	return c.cache.IsVisited(ctx, location)
+}
+
 func (c *Crawler) Crawl(ctx context.Context) error {
-	if c.myceliumIngressKey == "" {
-		return fmt.Errorf("mycelium ingress queue key not configured")
+	if err := c.checkQueues(); err != nil {
+		return err
 	}
 
-	fmt.Printf("Crawler starting, waiting for items from ingress queue...\n")
+	log := c.log(ctx)
+	log.Info("crawler starting, waiting for items from ingress queue")
 
+	w := c.newCrawlWorker(ctx, c.lookahead)
+	defer w.close(context.WithoutCancel(ctx))
+
+	maxIdle := time.Duration(c.maxIdleSeconds) * time.Second
 	for {
-		incomingJSON, err := c.cache.PopFromMyceliumIngress(ctx, c.myceliumIngressKey)
-		if err != nil {
-			// Handle "no items available" case - continue polling
-			if err.Error() == "no items available in queue" {
-				continue
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if stopRequested(ctx) {
+			return nil
+		}
+
+		w.setState(true, "")
+
+		if c.paused(ctx) {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(w.pauseBackoff()):
 			}
-			// For other errors, log and continue (with brief delay to avoid spam)
-			fmt.Printf("Error popping from ingress queue: %s\n", err.Error())
+			// time spent paused does not count towards maxIdleSeconds
+			w.busy()
+			continue
+		}
+		w.pausedBackoff = 0
+
+		processed, err := c.crawlOnce(ctx, w)
+		if processed {
+			w.busy()
+		}
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrQueueEmpty):
+			if w.idleTooLong(maxIdle) {
+				log.Info("crawler idle, exiting", "maxIdleSeconds", c.maxIdleSeconds)
+				return nil
+			}
+		case errors.Is(err, ErrTransient):
+			// brief delay to avoid spinning on a failing queue
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
 			case <-time.After(time.Second):
-				continue
 			}
+		default:
+			return err
 		}
+	}
+}
 
-		var curr IngressItem
-		if err := json.Unmarshal([]byte(incomingJSON), &curr); err != nil {
-			fmt.Printf("failed to parse incoming JSON: %s\n", err.Error())
-			continue
+// CrawlOnce pops at most one item from the ingress queue and fully handles
+// it, for embedders that schedule crawling themselves. processed reports
+// whether an item was popped. The error wraps ErrQueueEmpty when there was
+// nothing to do and ErrTransient when calling again later may succeed; any
+// other error is fatal. Unlike Crawl, CrawlOnce does not check the pause
+// state and does not use a lookahead buffer.
+func (c *Crawler) CrawlOnce(ctx context.Context) (processed bool, err error) {
+	if err := c.checkQueues(); err != nil {
+		return false, err
+	}
+	w := c.newCrawlWorker(ctx, 1)
+	defer w.close(context.WithoutCancel(ctx))
+	return c.crawlOnce(ctx, w)
+}
+
+func (c *Crawler) checkQueues() error {
+	if c.cache == nil {
+		return fmt.Errorf("crawler cache not configured")
+	}
+	if c.myceliumIngressKey == "" {
+		return fmt.Errorf("mycelium ingress queue key not configured")
+	}
+	return nil
+}
+
+func (c *Crawler) crawlOnce(ctx context.Context, w *crawlWorker) (processed bool, err error) {
+	log := c.log(ctx)
+
+	if c.bandwidthExhausted() {
+		return false, ErrBandwidthBudgetExhausted
+	}
+
+	popStart := time.Now()
+	incomingJSON, err := c.next(ctx, w.buf)
+	if err != nil {
+		if errors.Is(err, ErrQueueEmpty) {
+			return false, ErrQueueEmpty
 		}
+		log.Error("failed to pop from ingress queue", "error", err)
+		return false, transient(err)
+	}
 
-		if curr.Retries > maxRetries {
-			continue
+	c.metrics.Incr(MetricItemsPopped, 1)
+	c.stats.itemsPopped.Add(1)
+	c.stats.inFlight.Add(1)
+	defer c.stats.inFlight.Add(-1)
+
+	// spans start once there is an item so idle polling is not traced,
+	// backdated to cover the wait for it
+	ctx, itemSpan := c.tracer.Start(ctx, SpanCrawlItem, trace.WithTimestamp(popStart))
+	defer itemSpan.End()
+	_, popSpan := c.tracer.Start(ctx, SpanQueuePop, trace.WithTimestamp(popStart))
+	popSpan.End()
+
+	// the popped item is ours now, so cache writes must finish even if we
+	// are shutting down or the item would be lost
+	cacheCtx := context.WithoutCancel(ctx)
+
+	var curr IngressItem
+	if err := json.Unmarshal([]byte(incomingJSON), &curr); err != nil {
+		log.Error("failed to parse incoming JSON", "error", err)
+		c.parkMalformed(cacheCtx, incomingJSON, err)
+		return true, nil
+	}
+	c.observeQueueLatency(curr)
+
+	itemSpan.SetAttributes(
+		attribute.String("url.host", hostOf(curr.Location)),
+		attribute.Int("retries", int(curr.Retries)),
+		attribute.Int("depth", int(curr.Depth)))
+
+	if int(curr.Retries) > c.maxRetries {
+		// pushed by a producer with a higher limit
+		c.exhaust(cacheCtx, curr, fmt.Errorf("arrived with %d retries", curr.Retries))
+		return true, nil
+	}
+
+	parsedUrl, err := url.Parse(curr.Location)
+	if err != nil {
+		log.Warn("malformed url", "url", curr.Location)
+		c.itemDropped(curr, "malformed url")
+		return true, nil
+	}
+	c.loadHostFold(cacheCtx, parsedUrl)
+	parsedUrl = c.rewrite(parsedUrl)
+	curr.Location = parsedUrl.String()
+	w.setState(false, curr.Location)
+
+	firstVisit, err := c.tryVisit(cacheCtx, curr.Location)
+	if err != nil {
+		return c.cacheReadFailed(ctx, cacheCtx, curr, "check if url is visited", err)
+	} else if !firstVisit {
+		c.itemDropped(curr, "visited")
+		return true, nil
+	}
+
+	if err := c.admit(cacheCtx, parsedUrl); err != nil {
+		if errors.Is(err, ErrTransient) {
+			return c.cacheReadFailed(ctx, cacheCtx, curr, "check url", err)
 		}
+		log.Info(errorLabel(err), "url", curr.Location, "reason", err.Error())
+		c.drop(curr, err)
+		return true, nil
+	}
 
-		isVisited, err := c.cache.IsVisited(ctx, curr.Location)
-		if err != nil {
-			fmt.Printf("failed to check if %s is visited: %s\n", curr.Location, err.Error())
-			curr.Retries = curr.Retries + 1
-			retryJSON, _ := json.Marshal(curr)
-			c.cache.PushToMyceliumIngress(ctx, string(retryJSON), c.myceliumIngressKey)
-			continue
-		} else if isVisited {
-			continue
+	if opens := c.outsideWindow(parsedUrl.Hostname()); !opens.IsZero() {
+		log.Info("outside politeness window, delaying", "url", curr.Location, "until", opens)
+		c.delay(cacheCtx, curr, opens)
+		return true, nil
+	}
+
+	// wait for the global limiter before taking a host slot, a long
+	// global queue would otherwise outlast the slot TTL
+	if err := c.waitGlobal(ctx); err != nil {
+		c.requeue(cacheCtx, curr)
+		return true, err
+	}
+
+	releaseSlot, acquired := c.acquireHostSlot(cacheCtx, parsedUrl.Hostname())
+	if !acquired {
+		// another worker is on this host, try again after the rest of
+		// the queue
+		log.Debug("host busy, requeueing", "url", curr.Location)
+		c.requeue(cacheCtx, curr)
+		if wait := w.hostBusy(); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return true, ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+		return true, nil
+	}
+	w.hostsBusy = 0
+
+	if !c.spendBudget(cacheCtx, parsedUrl.Hostname()) {
+		releaseSlot()
+		log.Info("domain budget exhausted", "url", curr.Location)
+		c.DeadLetter(cacheCtx, "crawl", incomingJSON, "domain budget exhausted")
+		c.itemDropped(curr, "domain budget exhausted")
+		return true, nil
+	}
+
+	if c.domainLimiter != nil {
+		if err := c.domainLimiter.wait(ctx, parsedUrl.Hostname()); err != nil {
+			releaseSlot()
+			c.refundBudget(cacheCtx, parsedUrl.Hostname())
+			c.requeue(cacheCtx, curr)
+			return true, err
+		}
+	}
+
+	page, err := c.GetPage(c.withValidators(ctx, cacheCtx, curr), parsedUrl)
+	releaseSlot()
+	if errors.Is(err, errNotModified) {
+		log.Info("not modified", "url", curr.Location)
+		c.recordOutcome(cacheCtx, parsedUrl.Hostname(), OutcomeSuccess)
+		c.scheduleRecrawl(cacheCtx, curr, parsedUrl.Hostname(), nil)
+		return true, nil
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			// interrupted by shutdown, hand the item back for the next run
+			c.refundBudget(cacheCtx, parsedUrl.Hostname())
+			c.requeue(cacheCtx, curr)
+			return true, ctx.Err()
+		}
+		if errors.Is(err, ErrTransient) {
+			// the cache failed while admitting a redirect hop
+			c.refundBudget(cacheCtx, parsedUrl.Hostname())
+			return c.cacheReadFailed(ctx, cacheCtx, curr, "check redirect", err)
+		}
+		itemSpan.RecordError(err)
+		itemSpan.SetStatus(codes.Error, "fetch failed")
+		log.Error("failed to get page", "url", curr.Location, "error", err)
+		c.metrics.Incr(MetricFetchErrors, 1)
+		label := errorLabel(err)
+		c.stats.fetchErrors.Add(1)
+		c.stats.errorClasses.incr(label)
+		outcome := classifyFetchError(err)
+		c.recordOutcome(cacheCtx, parsedUrl.Hostname(), outcome)
+		willRetry := outcome == OutcomeRetryable && c.retry(cacheCtx, curr, err)
+		if willRetry {
+			// the retry spends the budget when it is fetched again
+			c.refundBudget(cacheCtx, parsedUrl.Hostname())
 		} else {
-			c.cache.Visit(ctx, curr.Location)
+			c.metrics.Incr(MetricItemsDroppedPrefix+label, 1)
+		}
+		if outcome != OutcomeRetryable {
+			// exhausted items were already counted by retry
+			c.stats.droppedReasons.incr(label)
 		}
+		c.hooks.fetchError(curr.Location, err, willRetry)
+		return true, nil
+	}
+	c.metrics.Incr(MetricPagesFetched, 1)
+	c.stats.pagesFetched.Add(1)
+	c.stats.linksExtracted.Add(int64(len(page.Links)))
+	c.recordOutcome(cacheCtx, parsedUrl.Hostname(), OutcomeSuccess)
+	c.learnHostFold(cacheCtx, parsedUrl, page)
+	page.Referrer = curr.Parent
+	page.Session = curr.Session
+	if page.Session == "" {
+		page.Session = c.sessionID
+	}
+	page.Recrawl = curr.Recrawl
+	if c.softErrorPolicy != SoftErrorOff {
+		page.SoftError = detectSoftError(page, parsedUrl, page.redirectedTo)
+	}
+	if page.SoftError != "" {
+		c.metrics.Incr(MetricSoftErrors, 1)
+		if c.softErrorPolicy == SoftErrorDrop {
+			// like a 404: nothing to keep and no links to follow
+			log.Info("soft error", "url", curr.Location, "reason", page.SoftError)
+			c.metrics.Incr(MetricItemsDroppedPrefix+softErrorLabel, 1)
+			c.itemDropped(curr, softErrorLabel)
+			return true, nil
+		}
+	}
+	c.hooks.pageFetched(page)
+	c.scheduleRecrawl(cacheCtx, curr, parsedUrl.Hostname(), &conditional{etag: page.etag, lastModified: page.lastModified})
+	if c.unchanged(cacheCtx, curr, page) {
+		log.Info("content unchanged", "url", curr.Location)
+		c.metrics.Incr(MetricPagesUnchanged, 1)
+		return true, nil
+	}
+
+	if drop, reason := c.filterPage(page); drop {
+		log.Info("dropped", "url", curr.Location, "reason", reason)
+		c.metrics.Incr(MetricPagesDropped, 1)
+		c.itemDropped(curr, reason)
+		if c.queueDroppedLinks {
+			c.queueLinks(cacheCtx, page, curr)
+		}
+		return true, nil
+	}
+	c.sample(ctx, page)
 
-		parsedUrl, err := url.Parse(curr.Location)
+	// Send page to fungicide for classification instead of storing to file
+	if c.fungicideQueueKey != "" {
+		pageData, trimmed, err := c.encodeForFungicide(page)
 		if err != nil {
-			fmt.Printf("malformed url: %s", curr.Location)
-			continue
+			log.Error("failed to marshal page", "url", curr.Location, "error", err)
+			c.itemDropped(curr, "failed to marshal page")
+			return true, nil
+		}
+		if trimmed && c.store != nil {
+			// keep the full page since fungicide only gets part of it
+			if _, err := c.store.Store(page, ".json"); err != nil {
+				log.Error("failed to store page", "url", curr.Location, "error", err)
+			}
 		}
 
-		if c.filter(parsedUrl) {
-			fmt.Printf("[BLOCKED] url: %s\n", curr.Location)
-			continue
+		_, pushSpan := c.tracer.Start(ctx, SpanFungicidePush)
+		pushSpan.SetAttributes(attribute.Int("bytes", len(pageData)), attribute.Bool("trimmed", trimmed))
+		if c.sink != nil {
+			c.sink.add(cacheCtx, string(pageData))
+		} else if err := c.cache.PushToFungicide(cacheCtx, string(pageData), c.fungicideQueueKey); err != nil {
+			pushSpan.RecordError(err)
+			pushSpan.SetStatus(codes.Error, "push failed")
+			pushSpan.End()
+			log.Error("failed to push page to fungicide", "url", curr.Location, "error", err)
+			c.retry(cacheCtx, curr, err)
+			return true, nil
 		}
+		pushSpan.End()
 
-		// Check domain blacklist from fungicide
-		if c.myceliumBlacklistKey != "" {
-			isBlacklisted, err := c.cache.IsBlacklisted(ctx, parsedUrl.Hostname(), c.myceliumBlacklistKey)
-			if err != nil {
-				fmt.Printf("failed to check blacklist for %s: %s\n", parsedUrl.Hostname(), err.Error())
-			} else if isBlacklisted {
-				fmt.Printf("[BLACKLISTED] %s\n", curr.Location)
-				continue
+		log.Info("sent to fungicide", "url", curr.Location)
+	} else {
+		// Fallback to file storage if fungicide not configured
+		if c.store != nil {
+			_, storeSpan := c.tracer.Start(ctx, SpanStore)
+			if _, err := c.store.Store(page, ".json"); err != nil {
+				storeSpan.RecordError(err)
+				storeSpan.SetStatus(codes.Error, "store failed")
+				log.Error("failed to store page", "url", curr.Location, "error", err)
 			}
+			storeSpan.End()
 		}
+	}
 
-		page, err := c.GetPage(ctx, parsedUrl)
+	if c.queuesLinks() {
+		if c.verifyExternal {
+			c.verifyExternalLinks(ctx, cacheCtx, page, curr)
+		}
+		c.queueLinks(cacheCtx, page, curr)
+	}
+	return true, nil
+}
+
+// queuesLinks reports whether Crawl queues the links of the pages it keeps.
+func (c *Crawler) queuesLinks() bool {
+	switch c.linkQueueing {
+	case LinkQueueingAlways:
+		return true
+	case LinkQueueingNone:
+		return false
+	default:
+		return c.fungicideQueueKey == ""
+	}
+}
+
+// Enqueue validates, normalizes and filters item before pushing it to the
+// ingress queue. Blocked urls are silently dropped.
+func (c *Crawler) Enqueue(ctx context.Context, item IngressItem) error {
+	_, err := c.enqueue(ctx, item, c.myceliumIngressKey)
+	return err
+}
+
+// enqueue is Enqueue onto queueKey. It reports whether the item was pushed;
+// filtered items and an empty queueKey are dropped without an error.
+func (c *Crawler) enqueue(ctx context.Context, item IngressItem, queueKey string) (bool, error) {
+	parsedUrl, err := url.Parse(strings.TrimSpace(item.Location))
+	if err != nil {
+		return false, fmt.Errorf("malformed url %s: %w", item.Location, err)
+	}
+	if parsedUrl.Scheme == "" || parsedUrl.Host == "" {
+		return false, fmt.Errorf("url %s is not absolute", item.Location)
+	}
+	c.loadHostFold(ctx, parsedUrl)
+	parsedUrl = c.rewrite(parsedUrl)
+	if c.filtered(parsedUrl) {
+		return false, nil
+	}
+
+	item.Location = parsedUrl.String()
+	if item.Session == "" {
+		item.Session = c.sessionID
+	}
+	c.stampEnqueued(&item)
+	itemJSON, err := json.Marshal(item)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal item: %w", err)
+	}
+	if queueKey == "" {
+		return false, nil
+	}
+	if err := c.cache.PushToMyceliumIngress(ctx, string(itemJSON), queueKey); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// filtered reports whether loc would be dropped once popped, counting it
+// in MetricUrlsFiltered, so it is never pushed to the queue. admit repeats
+// the checks when it is popped, as filters and blacklists change while
+// items wait.
+func (c *Crawler) filtered(loc *url.URL) bool {
+	blocked := loc.Scheme == "" || loc.Host == ""
+	if !blocked {
+		var rule string
+		if blocked, rule = c.filter(loc); blocked {
+			c.metrics.Incr(MetricUrlFilterHitsPrefix+metricLabel(rule), 1)
+		}
+	}
+	if !blocked {
+		host := loc.Hostname()
+		blocked = c.rejected.contains(host) || c.exhausted.contains(host)
+	}
+	if blocked {
+		c.metrics.Incr(MetricUrlsFiltered, 1)
+	}
+	return blocked
+}
+
+// admit checks a popped url against the filters and blacklists. Failed
+// lookups are returned as transient errors.
+func (c *Crawler) admit(ctx context.Context, loc *url.URL) error {
+	if blocked, rule := c.filter(loc); blocked {
+		c.metrics.Incr(MetricUrlFilterHitsPrefix+metricLabel(rule), 1)
+		return fmt.Errorf("%w: %s", ErrBlockedByFilter, rule)
+	}
+
+	host := loc.Hostname()
+	if c.rejected.contains(host) {
+		return fmt.Errorf("%w: %s rejected by fungicide", ErrBlacklisted, host)
+	}
+	if c.myceliumBlacklistKey != "" {
+		blacklisted, err := c.cache.IsBlacklisted(ctx, host, c.myceliumBlacklistKey)
 		if err != nil {
-			fmt.Printf("failed to get page %s: %s\n", curr.Location, err.Error())
+			return transient(fmt.Errorf("failed to check blacklist: %w", err))
+		}
+		if blacklisted {
+			return fmt.Errorf("%w: %s", ErrBlacklisted, host)
+		}
+	}
+	blacklisted, err := c.autoBlacklisted(ctx, host)
+	if err != nil {
+		return transient(fmt.Errorf("failed to check auto blacklist: %w", err))
+	}
+	if blacklisted {
+		return fmt.Errorf("%w: %s auto blacklisted", ErrBlacklisted, host)
+	}
+	return nil
+}
+
+// drop gives up on item because of err without retrying.
+func (c *Crawler) drop(item IngressItem, err error) {
+	label := errorLabel(err)
+	if errors.Is(err, ErrBlockedByFilter) {
+		c.metrics.Incr(MetricUrlsBlocked, 1)
+	}
+	c.metrics.Incr(MetricItemsDroppedPrefix+label, 1)
+	c.itemDropped(item, label)
+}
+
+// retry requeues an item that failed with cause, counting the attempt. Once
+// it has used up maxRetries it goes to the dead letter queue instead and
+// retry returns false.
+func (c *Crawler) retry(ctx context.Context, item IngressItem, cause error) bool {
+	item.Retries++
+	if int(item.Retries) > c.maxRetries {
+		c.exhaust(ctx, item, cause)
+		return false
+	}
+	c.metrics.Incr(MetricItemsRetried, 1)
+	c.requeue(ctx, item)
+	return true
+}
+
+func (c *Crawler) exhaust(ctx context.Context, item IngressItem, cause error) {
+	c.metrics.Incr(MetricItemsExhausted, 1)
+	c.log(ctx).Warn("retries exhausted", "url", item.Location, "retries", item.Retries, "error", cause)
+	itemJSON, _ := json.Marshal(item)
+	c.DeadLetter(ctx, "crawl", string(itemJSON), fmt.Sprintf("retries exhausted (%s): %v", errorLabel(cause), cause))
+	c.itemDropped(item, "retries exhausted")
+}
+
+// cacheReadFailed hands item back after a cache read that decides whether
+// to crawl it failed, such as the visited or blacklist check. An unreachable
+// cache says nothing about the url, so unlike retry this does not count
+// against maxRetries; it waits a moment instead so a cache outage is not
+// spun on. Reads that only shape the fetch, like host slots, domain budgets
+// and recrawl validators, fail open and never get here.
+func (c *Crawler) cacheReadFailed(ctx context.Context, cacheCtx context.Context, item IngressItem, what string, err error) (processed bool, _ error) {
+	c.log(ctx).Error("failed to "+what+", requeueing", "url", item.Location, "error", err)
+	c.metrics.Incr(MetricCacheReadErrors, 1)
+	c.requeue(cacheCtx, item)
+	select {
+	case <-ctx.Done():
+		return true, ctx.Err()
+	case <-time.After(cacheErrorDelay):
+	}
+	return true, nil
+}
+
+// requeue hands an item back without counting a retry, for items that were
+// deferred rather than failed. Use retry for failures.
+func (c *Crawler) requeue(ctx context.Context, item IngressItem) {
+	if err := c.cache.Unvisit(ctx, item.Location); err != nil {
+		c.log(ctx).Error("failed to unvisit", "url", item.Location, "error", err)
+	}
+	c.stampEnqueued(&item)
+	itemJSON, _ := json.Marshal(item)
+	if err := c.cache.PushToMyceliumIngress(ctx, string(itemJSON), c.myceliumIngressKey); err != nil {
+		c.log(ctx).Error("failed to requeue", "url", item.Location, "error", err)
+	}
+}
+
+func (c *Crawler) queueLinks(ctx context.Context, page *Page, parent IngressItem) {
+	if parent.atMaxDepth() {
+		return
+	}
+	var candidates []string
+	seen := make(map[string]bool, len(page.Links))
+	for _, link := range page.Links {
+		// like enqueue, so links are filtered and deduped as they are
+		// queued; the fold of a link's domain may not have been loaded when
+		// the page was fetched
+		c.loadHostFold(ctx, &link)
+		neighbor := c.rewrite(&link)
+		if c.verifyExternal && !inScope(parent, neighbor) {
+			continue
+		}
+		location := neighbor.String()
+		if seen[location] {
 			continue
 		}
+		seen[location] = true
+		if c.filtered(neighbor) {
+			continue
+		}
+		candidates = append(candidates, location)
+	}
 
-		// Send page to fungicide for classification instead of storing to file
-		if c.fungicideQueueKey != "" {
-			pageJSON, err := page.Marshal()
-			if err != nil {
-				fmt.Printf("failed to marshal page %s: %s\n", curr.Location, err.Error())
-				continue
-			}
+	queueKey := c.frontierKey(ctx)
+	for _, neighbor := range capLinks(c, candidates) {
+		c.countFrontier(queueKey)
+		if queueKey == "" {
+			continue
+		}
+		child := parent.child(neighbor)
+		c.stampEnqueued(&child)
+		neighborJSON, _ := json.Marshal(child)
+		if err := c.cache.PushToMyceliumIngress(ctx, string(neighborJSON), queueKey); err != nil {
+			continue
+		}
+		c.hooks.linkQueued(parent.Location, neighbor)
+		if queueKey == c.myceliumIngressKey {
+			c.metrics.Incr(MetricLinksQueued, 1)
+			c.stats.linksQueued.Add(1)
+		}
+	}
+}
 
-			err = c.cache.PushToFungicide(ctx, string(pageJSON), c.fungicideQueueKey)
-			if err != nil {
-				fmt.Printf("failed to push page to fungicide %s: %s\n", curr.Location, err.Error())
-				continue
-			}
+// Blocked reports whether loc is rejected by the crawler's url filters and,
+// if so, which rule matched.
+func (c *Crawler) Blocked(loc *url.URL) (bool, string) {
+	return c.filter(loc)
+}
 
-			fmt.Printf("[SENT TO FUNGICIDE] %s\n", curr.Location)
-		} else {
-			// Fallback to file storage if fungicide not configured
-			_, err = c.store.Store(page, ".json")
-			if err != nil {
-				fmt.Printf("failed to store page: %s\n", err.Error())
-			}
+func (c *Crawler) filterPage(page *Page) (bool, string) {
+	for _, filter := range c.pageFilters {
+		if drop, reason := filter.Filter(page); drop {
+			return true, reason
+		}
+	}
+	return false, ""
+}
 
-			// Direct link queuing only if not using fungicide - queue back to ingress
-			for _, neighbor := range page.Links {
-				neighborItem := IngressItem{
-					Location: neighbor.String(),
-					Retries:  0,
-				}
-				neighborJSON, _ := json.Marshal(neighborItem)
-				c.cache.PushToMyceliumIngress(ctx, string(neighborJSON), c.myceliumIngressKey)
+func (c *Crawler) filter(loc *url.URL) (bool, string) {
+	for _, filter := range c.urlFilters {
+		if reasoned, ok := filter.(ReasonedUrlFilter); ok {
+			if blocked, rule := reasoned.Match(loc); blocked {
+				return true, rule
 			}
+		} else if filter.Filter(loc) {
+			return true, fmt.Sprintf("%T", filter)
 		}
 	}
+	return false, ""
 }
 
-func (c *Crawler) filter(loc *url.URL) bool {
-	for _, filter := range c.urlFilters {
-		if filter.Filter(loc) {
-			return true
+func (c *Crawler) log(ctx context.Context) *slog.Logger {
+	if id, ok := ctx.Value(workerIDKey{}).(int); ok {
+		return c.logger.With("worker", id)
+	}
+	return c.logger
+}
+
+// Rewrite returns loc as the crawler would queue and dedupe it: passed
+// through the url rewriters, with its fragment normalized and its host
+// folded to the variant in effect.
+func (c *Crawler) Rewrite(loc *url.URL) *url.URL {
+	return c.rewrite(loc)
+}
+
+func (c *Crawler) rewrite(loc *url.URL) *url.URL {
+	for _, rewriter := range c.urlRewriters {
+		loc = rewriter.Rewrite(loc)
+	}
+	return c.foldHost(c.normalizeFragment(loc))
+}
+
+// setBrowserHeaders sets the user agent and the headers that go with it. A
+// politeness profile's user agent replaces the chosen one.
+func (r *Crawler) setBrowserHeaders(req *http.Request) {
+	if r.headerChooser == nil {
+		req.Header.Set(userAgentCanonicalHeader, defaultUserAgent)
+	} else {
+		var header http.Header
+		if r.stickyUserAgents != nil {
+			header = r.stickyUserAgents.get(req.URL.Hostname(), r.headerChooser.Pick)
+		} else {
+			header = r.headerChooser.Pick()
+		}
+		for k, v := range header {
+			req.Header[k] = v
 		}
 	}
-	return false
+	if profile := r.politeness.profileFor(req.URL.Hostname()); profile != nil && profile.UserAgent != "" {
+		req.Header.Set(userAgentCanonicalHeader, profile.UserAgent)
+	}
+	incrLabeled(r.metrics, MetricUserAgentPicks, LabelUserAgent, req.Header.Get(userAgentCanonicalHeader), 1)
 }
 
-func (r *Crawler) GetPage(ctx context.Context, loc *url.URL) (*Page, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, loc.String(), nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+func (r *Crawler) GetPage(ctx context.Context, loc *url.URL) (page *Page, err error) {
+	tracer := r.tracer
+	if tracer == nil {
+		tracer = nopTracer()
 	}
+	ctx, span := tracer.Start(ctx, SpanFetch, trace.WithAttributes(attribute.String("url.host", loc.Hostname())))
+	defer func() {
+		if err != nil && !errors.Is(err, errNotModified) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "fetch failed")
+		}
+		span.End()
+	}()
 
-	userAgent := defaultUserAgent
-	if r.userAgentChooser != nil {
-		userAgent = r.userAgentChooser.Pick()
+	if r.pageTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, r.pageTimeout, ErrPageTimeout)
+		defer cancel()
+		defer func() {
+			if err != nil && context.Cause(ctx) == ErrPageTimeout && !errors.Is(err, ErrPageTimeout) {
+				err = fmt.Errorf("%s took longer than %s: %w: %w", loc.String(), r.pageTimeout, ErrPageTimeout, err)
+			}
+		}()
 	}
-	req.Header.Set(userAgentCanonicalHeader, userAgent)
 
-	res, err := r.client.Do(req)
+	var redirects []string
+	ctx = withRedirectChain(ctx, &redirects)
+
+	res, fetch, downloaded, err := r.send(ctx, FetchRequest{URL: loc})
 	if err != nil {
-		return nil, fmt.Errorf("failed to request %s: %w", loc.String(), err)
+		return nil, err
 	}
 	defer res.Body.Close()
+	decoded := &countingReader{}
+	defer func() { r.countBandwidth(loc.Hostname(), downloaded.n, decoded.n) }()
+	var capture *captureBuffer
+	bodyDecoded := false
+	if r.failures != nil {
+		capture = &captureBuffer{max: r.failures.maxBytes}
+		defer func() {
+			if err == nil || errors.Is(err, errNotModified) {
+				return
+			}
+			var rest io.Reader
+			if !bodyDecoded && ctx.Err() == nil {
+				// rejected before the body was read
+				if body, err := decodeBody(res, downloaded); err == nil {
+					defer body.Close()
+					rest = body
+				}
+			}
+			r.captureFailure(loc, res, capture, rest, err)
+		}()
+	}
+	span.SetAttributes(attribute.Int("http.status_code", res.StatusCode))
+
+	if res.StatusCode == http.StatusNotModified {
+		return nil, fmt.Errorf("%s: %w", loc.String(), errNotModified)
+	}
+	if res.StatusCode >= 400 {
+		return nil, fmt.Errorf("%s: %w", loc.String(), &StatusError{StatusCode: res.StatusCode})
+	}
 
 	contentType := res.Header.Get("Content-Type")
-	if !strings.HasPrefix(contentType, "text/") {
-		return nil, fmt.Errorf("page content %s was not type 'text', got: %s", loc.String(), contentType)
+	mediaType, charset, declared := parseContentType(contentType)
+	if declared && !r.acceptsType(mediaType) {
+		return nil, fmt.Errorf("page content %s was not type 'text', got: %s: %w", loc.String(), contentType, ErrUnsupportedContentType)
 	}
 
-	page := NewPage(loc)
+	body, err := decodeBody(res, downloaded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode body of %s: %w", loc.String(), err)
+	}
+	defer body.Close()
 
-	if strings.HasPrefix(contentType, "text/html") {
-		page.ParseHtmlPage(res.Body)
-	} else {
-		fmt.Println("Skipping non text/html page.")
+	bodyDecoded = true
+	decoded.r = body
+	if capture != nil {
+		decoded.r = io.TeeReader(body, capture)
+	}
+	var bodyReader io.Reader = decoded
+	capped := &cappedReader{r: decoded, remaining: r.maxBodyBytes}
+	if r.maxBodyBytes > 0 {
+		bodyReader = capped
 	}
 
+	sniffed, head, err := sniffBody(bodyReader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body of %s: %w", loc.String(), err)
+	}
+	if !declared {
+		// no usable header, go by what the body looks like
+		mediaType, charset, _ = parseContentType(http.DetectContentType(head))
+		if looksBinary(head) || !r.acceptsType(mediaType) {
+			return nil, fmt.Errorf("page content %s has no type and sniffed as %s: %w", loc.String(), mediaType, ErrUnsupportedContentType)
+		}
+	}
+	if looksBinary(head) {
+		return nil, fmt.Errorf("page content %s is binary despite type %s: %w", loc.String(), contentType, ErrUnsupportedContentType)
+	}
+	fetch.Charset = charset
+
+	page = NewPage(loc)
+	page.etag = res.Header.Get("ETag")
+	page.lastModified = res.Header.Get("Last-Modified")
+	if res.Request != nil && res.Request.URL.String() != loc.String() {
+		page.redirectedTo = res.Request.URL
+	}
+	page.Redirects = redirects
+	page.Fetch = fetch
+	page.Security = securityOf(res)
+	page.scriptPolicy = r.scriptPolicy
+
+	counted := &countingReader{r: &ctxReader{ctx: ctx, r: sniffed}}
+	defer func() { span.SetAttributes(attribute.Int64("bytes", counted.n)) }()
+
+	_, parseSpan := tracer.Start(ctx, SpanParse)
+	var parseErr error
+	switch {
+	case isHTML(mediaType):
+		page.Type = PageTypeHTML
+		page.ParseHtmlPage(counted)
+	case isFeed(mediaType):
+		parseErr = page.ParseFeed(counted)
+	default:
+		page.Type = PageTypeText
+		r.log(ctx).Debug("skipping non text/html page", "url", loc.String(), "contentType", contentType)
+	}
+	parseSpan.SetAttributes(attribute.Int("links", len(page.Links)))
+	parseSpan.End()
+	page.applyHeaderHints(res.Header)
+	fetch.BodyBytes = decoded.n
+	if contentEncoding(res) != "" {
+		fetch.CompressedBytes = downloaded.n
+	}
+	if context.Cause(ctx) == ErrPageTimeout {
+		return nil, fmt.Errorf("%s took longer than %s: %w", loc.String(), r.pageTimeout, ErrPageTimeout)
+	}
+	if capped.exceeded {
+		return nil, fmt.Errorf("page %s is larger than %d bytes (%d bytes on the wire): %w", loc.String(), r.maxBodyBytes, downloaded.n, ErrBodyTooLarge)
+	}
+	if parseErr != nil {
+		return nil, fmt.Errorf("failed to parse feed %s: %w", loc.String(), parseErr)
+	}
+
+	for i := range page.Links {
+		page.Links[i] = *r.rewrite(&page.Links[i])
+	}
+	page.Links = dedupeLinks(page.Links)
+	page.OutlinkDomains = page.summarizeOutlinks()
+
 	return page, nil
 }
 
-func proxyURL(proxyChooser StringChooser) func(*http.Request) (*url.URL, error) {
-	return func(req *http.Request) (*url.URL, error) {
-		return url.Parse(proxyChooser.Pick())
+// decodableEncodings are the content codings decodeBody can undo.
+var decodableEncodings = map[string]bool{
+	"gzip":     true,
+	"x-gzip":   true,
+	"deflate":  true,
+	"identity": true,
+}
+
+// restrictAcceptEncoding drops the codings decodeBody cannot undo, like the
+// br and zstd of browser header profiles, falling back to gzip when none
+// are left.
+func restrictAcceptEncoding(header http.Header) {
+	value := header.Get("Accept-Encoding")
+	if value == "" {
+		return
+	}
+	var kept []string
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		coding, _, _ := strings.Cut(part, ";")
+		if decodableEncodings[strings.ToLower(strings.TrimSpace(coding))] {
+			kept = append(kept, part)
+		}
+	}
+	if len(kept) == 0 {
+		header.Set("Accept-Encoding", "gzip")
+		return
+	}
+	header.Set("Accept-Encoding", strings.Join(kept, ", "))
+}
+
+// decodeBody undoes the encoding requested by GetPage or a header profile.
+// The transport only decompresses transparently when it set
+// Accept-Encoding itself.
+func decodeBody(res *http.Response, body io.Reader) (io.ReadCloser, error) {
+	switch encoding := contentEncoding(res); encoding {
+	case "":
+		return io.NopCloser(body), nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(body)
+	case "deflate":
+		return newDeflateReader(body)
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+}
+
+// newDeflateReader reads deflate bodies, which servers send both zlib
+// wrapped, as the spec says, and raw.
+func newDeflateReader(body io.Reader) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(body)
+	head, err := buffered.Peek(2)
+	if err == nil && head[0]&0x0f == 8 && (uint16(head[0])<<8|uint16(head[1]))%31 == 0 {
+		return zlib.NewReader(buffered)
+	}
+	return flate.NewReader(buffered), nil
+}
+
+// contentEncoding returns the coding the body still has to be decoded
+// from, or "" for none.
+func contentEncoding(res *http.Response) string {
+	if res.Uncompressed {
+		return ""
+	}
+	encoding := strings.ToLower(strings.TrimSpace(res.Header.Get("Content-Encoding")))
+	if encoding == "identity" {
+		return ""
+	}
+	return encoding
+}
+
+func (r *Crawler) reportProxyResult(proxy *url.URL, success bool, latency time.Duration) {
+	if proxy == nil {
+		return
+	}
+	if reporter, ok := r.proxyChooser.(ProxyReporter); ok {
+		reporter.ReportResult(proxy.String(), success, latency)
 	}
 }
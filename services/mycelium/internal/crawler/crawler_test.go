@@ -0,0 +1,250 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// quiet discards the crawler's logs.
+var quiet = WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+// crawlOnePage crawls location with a fresh crawler and stops once it has
+// been fetched. Everything after the fetch runs to completion.
+func crawlOnePage(t *testing.T, cache *memCache, store Store, location string, opt ...CrawlerOption) {
+	t.Helper()
+	crawlItem(t, cache, store, IngressItem{Location: location}, opt...)
+}
+
+// crawlItem is crawlOnePage for an item carrying more than its location.
+func crawlItem(t *testing.T, cache *memCache, store Store, item IngressItem, opt ...CrawlerOption) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	opt = append([]CrawlerOption{
+		quiet,
+		WithMyceliumIngressKey("ingress"),
+		WithMetrics(stopAfterFetch(cancel)),
+	}, opt...)
+	c := NewCrawler(cache, store, opt...)
+	if err := c.Enqueue(context.Background(), item); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() { done <- c.Crawl(ctx) }()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		cancel()
+		<-done
+		t.Fatalf("timed out waiting for %s", item.Location)
+	}
+}
+
+// stopAfterFetch cancels the crawl as soon as a page has been fetched, so
+// the crawler finishes that page and pops nothing else.
+type stopAfterFetch context.CancelFunc
+
+func (stop stopAfterFetch) Incr(name string, delta int64) {
+	if name == MetricPagesFetched {
+		stop()
+	}
+}
+
+func TestLinkQueueingModes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<html><body><a href="http://%s/next">next</a></body></html>`, r.Host)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		mode      LinkQueueingMode
+		fungicide bool
+		wantLinks bool
+	}{
+		{"", false, true},
+		{"", true, false},
+		{LinkQueueingOnlyWhenNoFungicide, false, true},
+		{LinkQueueingOnlyWhenNoFungicide, true, false},
+		{LinkQueueingAlways, false, true},
+		{LinkQueueingAlways, true, true},
+		{LinkQueueingNone, false, false},
+		{LinkQueueingNone, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/fungicide=%t", tt.mode, tt.fungicide), func(t *testing.T) {
+			cache := newMemCache()
+			opt := []CrawlerOption{WithLinkQueueingMode(tt.mode)}
+			if tt.fungicide {
+				opt = append(opt, WithFungicideQueueKey("fungicide"))
+			}
+			crawlOnePage(t, cache, nil, srv.URL+"/", opt...)
+
+			reached := queuedLocations(t, cache)
+			if tt.wantLinks && (len(reached) != 1 || reached[0] != srv.URL+"/next") {
+				t.Errorf("queued %v, want the extracted link", reached)
+			}
+			if !tt.wantLinks && len(reached) != 0 {
+				t.Errorf("queued %v, want no links", reached)
+			}
+			if pushed := len(cache.fungicide["fungicide"]); tt.fungicide && pushed == 0 {
+				t.Error("no page pushed to fungicide")
+			}
+		})
+	}
+}
+
+func TestLinkQueueingAlwaysFiltersLinks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<html><body><a href="http://%s/a">a</a><a href="https://spam.test/b">b</a></body></html>`, r.Host)
+	}))
+	defer srv.Close()
+
+	cache := newMemCache()
+	crawlOnePage(t, cache, nil, srv.URL+"/",
+		WithLinkQueueingMode(LinkQueueingAlways),
+		WithFungicideQueueKey("fungicide"),
+		WithUrlFilters([]UrlFilter{hostFilter("spam.test")}))
+
+	if reached := queuedLocations(t, cache); len(reached) != 1 || reached[0] != srv.URL+"/a" {
+		t.Errorf("queued %v, want only the unfiltered link", reached)
+	}
+}
+
+func TestIngressItemEncodings(t *testing.T) {
+	var old IngressItem
+	if err := json.Unmarshal([]byte(`{"location":"https://example.com/a","retries":2}`), &old); err != nil {
+		t.Fatal(err)
+	}
+	if old != (IngressItem{Location: "https://example.com/a", Retries: 2}) {
+		t.Errorf("item without parent decoded as %+v", old)
+	}
+
+	item := IngressItem{Location: "https://example.com/b", Depth: 2, Parent: "https://example.com/a", SeedOrigin: "https://example.com/"}
+	data, err := json.Marshal(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"location":"https://example.com/b","retries":0,"depth":2,"parent":"https://example.com/a","seed_origin":"https://example.com/"}`
+	if string(data) != want {
+		t.Errorf("encoded %s, want %s", data, want)
+	}
+	var decoded IngressItem
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded != item {
+		t.Errorf("round trip = %+v, want %+v", decoded, item)
+	}
+
+	// seeds and old items encode as before
+	data, err = json.Marshal(IngressItem{Location: "https://example.com/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"location":"https://example.com/","retries":0}` {
+		t.Errorf("seed encoded as %s", data)
+	}
+}
+
+func TestIngressItemChild(t *testing.T) {
+	seed := IngressItem{Location: "https://example.com/", Retries: 3}
+	child := seed.child("https://example.com/a")
+	want := IngressItem{Location: "https://example.com/a", Depth: 1, Parent: "https://example.com/", SeedOrigin: "https://example.com/"}
+	if child != want {
+		t.Errorf("seed child = %+v, want %+v", child, want)
+	}
+
+	grandchild := child.child("https://example.org/b")
+	want = IngressItem{Location: "https://example.org/b", Depth: 2, Parent: "https://example.com/a", SeedOrigin: "https://example.com/"}
+	if grandchild != want {
+		t.Errorf("grandchild = %+v, want %+v", grandchild, want)
+	}
+}
+
+func TestCrawlRecordsParents(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><body><a href="https://example.org/next">next</a></body></html>`)
+	}))
+	defer srv.Close()
+
+	cache := newMemCache()
+	crawlItem(t, cache, nil,
+		IngressItem{Location: srv.URL + "/a", Depth: 1, Parent: srv.URL + "/", SeedOrigin: "https://seed.example/"},
+		WithFungicideQueueKey("fungicide"),
+		WithLinkQueueingMode(LinkQueueingAlways))
+
+	queued := cache.queue("ingress")
+	if len(queued) != 1 {
+		t.Fatalf("queued %v, want the link", queued)
+	}
+	var item IngressItem
+	if err := json.Unmarshal([]byte(queued[0]), &item); err != nil {
+		t.Fatal(err)
+	}
+	if item.EnqueuedAt == 0 {
+		t.Error("queued link has no enqueue time")
+	}
+	item.EnqueuedAt = 0
+	want := IngressItem{Location: "https://example.org/next", Depth: 2, Parent: srv.URL + "/a", SeedOrigin: "https://seed.example/"}
+	if item != want {
+		t.Errorf("queued %+v, want %+v", item, want)
+	}
+
+	page, err := UnmarshalPage([]byte(cache.fungicide["fungicide"][0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Referrer != srv.URL+"/" {
+		t.Errorf("page referrer = %q, want the parent", page.Referrer)
+	}
+}
+
+func TestCrawlOnce(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><body>page</body></html>")
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	cache := newMemCache()
+	metrics := NewCounterMetrics()
+	c := NewCrawler(cache, nil, quiet, WithMyceliumIngressKey("ingress"), WithMetrics(metrics))
+
+	if processed, err := c.CrawlOnce(ctx); processed || !errors.Is(err, ErrQueueEmpty) {
+		t.Fatalf("CrawlOnce on an empty queue = %t, %v; want ErrQueueEmpty", processed, err)
+	}
+
+	if err := c.Enqueue(ctx, IngressItem{Location: srv.URL + "/"}); err != nil {
+		t.Fatal(err)
+	}
+	if processed, err := c.CrawlOnce(ctx); !processed || err != nil {
+		t.Fatalf("CrawlOnce = %t, %v; want the item processed", processed, err)
+	}
+	if n := metrics.Get(MetricPagesFetched); n != 1 {
+		t.Errorf("fetched %d pages, want 1", n)
+	}
+
+	failing := &failingCache{memCache: newMemCache(), fail: map[string]bool{"PopFromMyceliumIngress": true}}
+	c = NewCrawler(failing, nil, quiet, WithMyceliumIngressKey("ingress"))
+	if _, err := c.CrawlOnce(ctx); !errors.Is(err, ErrTransient) || !errors.Is(err, errInjected) {
+		t.Errorf("CrawlOnce with a failing queue = %v, want a transient error", err)
+	}
+
+	c = NewCrawler(cache, nil, quiet)
+	if _, err := c.CrawlOnce(ctx); err == nil || errors.Is(err, ErrTransient) {
+		t.Errorf("CrawlOnce without an ingress key = %v, want a fatal error", err)
+	}
+}
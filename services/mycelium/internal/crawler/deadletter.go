@@ -0,0 +1,54 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// DeadLetter records a message that could not be processed, along with why
+// and, when the message named one, the page that linked to it.
+type DeadLetter struct {
+	Source  string `json:"source"`
+	Reason  string `json:"reason"`
+	Payload string `json:"payload"`
+	Parent  string `json:"parent,omitempty"`
+	At      int64  `json:"at"`
+}
+
+// DeadLetterCache is implemented by caches that can park failed messages.
+type DeadLetterCache interface {
+	PushToDeadLetter(ctx context.Context, itemJSON string, queueKey string) error
+}
+
+func WithDeadLetterKey(key string) CrawlerOption {
+	return func(c *Crawler) {
+		c.deadLetterKey = key
+	}
+}
+
+// DeadLetter parks payload in the dead letter queue with the reason it was
+// given up on. Without a dead letter queue it is dropped.
+func (c *Crawler) DeadLetter(ctx context.Context, source string, payload string, reason string) {
+	letters, ok := c.cache.(DeadLetterCache)
+	if c.deadLetterKey == "" || !ok {
+		return
+	}
+	// payloads that are ingress items name the page that linked to them
+	var item IngressItem
+	_ = json.Unmarshal([]byte(payload), &item)
+	letter, err := json.Marshal(DeadLetter{
+		Source:  source,
+		Reason:  reason,
+		Payload: payload,
+		Parent:  item.Parent,
+		At:      time.Now().Unix(),
+	})
+	if err != nil {
+		c.log(ctx).Error("failed to marshal dead letter", "error", err)
+		return
+	}
+	if err := letters.PushToDeadLetter(ctx, string(letter), c.deadLetterKey); err != nil {
+		c.log(ctx).Error("failed to push dead letter", "error", err)
+	}
+}
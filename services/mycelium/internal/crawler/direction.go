@@ -0,0 +1,86 @@
+package crawler
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	DirLTR = "ltr"
+	DirRTL = "rtl"
+)
+
+// GuessTextDirection returns DirRTL when most letters in texts belong to a
+// right-to-left script, DirLTR when most belong to another script, and ""
+// when there are no letters.
+func GuessTextDirection(texts ...string) string {
+	var rtl, ltr int
+	for _, text := range texts {
+		for _, r := range text {
+			switch {
+			case unicode.In(r, unicode.Arabic, unicode.Hebrew, unicode.Syriac, unicode.Thaana, unicode.Nko):
+				rtl++
+			case unicode.IsLetter(r):
+				ltr++
+			}
+		}
+	}
+	switch {
+	case rtl == 0 && ltr == 0:
+		return ""
+	case rtl > ltr:
+		return DirRTL
+	default:
+		return DirLTR
+	}
+}
+
+// dirAttr returns the element's dir attribute if it is ltr or rtl. "auto" is
+// treated as missing.
+func dirAttr(t *html.Token) string {
+	for _, a := range t.Attr {
+		if a.Key != "dir" {
+			continue
+		}
+		if dir := strings.ToLower(strings.TrimSpace(a.Val)); dir == DirLTR || dir == DirRTL {
+			return dir
+		}
+	}
+	return ""
+}
+
+// parseHtmlRoot records the document language and direction from <html>.
+func (p *Page) parseHtmlRoot(t *html.Token) {
+	for _, a := range t.Attr {
+		if a.Key == "lang" {
+			p.Lang = strings.TrimSpace(a.Val)
+		}
+	}
+	p.Dir = dirAttr(t)
+}
+
+// finishDirections guesses the document direction when <html> had no dir,
+// and drops the per element directions when no element set one.
+func (p *Page) finishDirections() {
+	if p.Dir == "" {
+		texts := append([]string{p.Title}, p.Headings...)
+		p.Dir = GuessTextDirection(append(texts, p.Content...)...)
+	}
+	if !anyNonEmpty(p.HeadingDirs) {
+		p.HeadingDirs = nil
+	}
+	if !anyNonEmpty(p.ContentDirs) {
+		p.ContentDirs = nil
+	}
+}
+
+func anyNonEmpty(values []string) bool {
+	for _, v := range values {
+		if v != "" {
+			return true
+		}
+	}
+	return false
+}
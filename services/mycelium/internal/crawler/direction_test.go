@@ -0,0 +1,82 @@
+package crawler
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseHtmlPageDirections(t *testing.T) {
+	tests := []struct {
+		name        string
+		html        string
+		lang        string
+		dir         string
+		headingDirs []string
+		contentDirs []string
+	}{
+		{
+			name: "declared rtl",
+			html: `<html lang="ar" dir="rtl"><head><title>مرحبا</title></head>
+				<body><h1>عنوان</h1><p>فقرة أولى</p><p dir="ltr">English aside</p></body></html>`,
+			lang:        "ar",
+			dir:         DirRTL,
+			contentDirs: []string{"", DirLTR},
+		},
+		{
+			name:        "guessed hebrew",
+			html:        `<html lang="he"><body><h2 dir="RTL">כותרת</h2><p>שלום עולם, with some English טקסט</p></body></html>`,
+			lang:        "he",
+			dir:         DirRTL,
+			headingDirs: []string{DirRTL},
+		},
+		{
+			name: "guessed ltr",
+			html: `<html><body><h1>Heading</h1><p>Plain English text.</p></body></html>`,
+			dir:  DirLTR,
+		},
+		{
+			name: "auto is ignored",
+			html: `<html dir="auto"><body><p dir="auto">نص عربي</p></body></html>`,
+			dir:  DirRTL,
+		},
+		{
+			name: "no text",
+			html: `<html><body><img src="x.png"></body></html>`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page := NewPage(mustParse(t, "https://example.com/"))
+			page.ParseHtmlPage(strings.NewReader(test.html))
+			if page.Lang != test.lang || page.Dir != test.dir {
+				t.Errorf("lang %q, dir %q; want %q, %q", page.Lang, page.Dir, test.lang, test.dir)
+			}
+			if !slices.Equal(page.HeadingDirs, test.headingDirs) {
+				t.Errorf("heading dirs %q, want %q", page.HeadingDirs, test.headingDirs)
+			}
+			if !slices.Equal(page.ContentDirs, test.contentDirs) {
+				t.Errorf("content dirs %q, want %q", page.ContentDirs, test.contentDirs)
+			}
+		})
+	}
+}
+
+func TestGuessTextDirection(t *testing.T) {
+	tests := []struct {
+		texts []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{"123 !?"}, ""},
+		{[]string{"hello"}, DirLTR},
+		{[]string{"مرحبا بالعالم"}, DirRTL},
+		{[]string{"שלום", "hi"}, DirRTL},
+		{[]string{"ab", "ש"}, DirLTR},
+	}
+	for _, test := range tests {
+		if got := GuessTextDirection(test.texts...); got != test.want {
+			t.Errorf("GuessTextDirection(%q) = %q, want %q", test.texts, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const encodedPage = "<html><head><title>encoded</title></head><body>hello</body></html>"
+
+// profileChooser picks a browser profile asking for encodings decodeBody
+// cannot undo.
+type profileChooser struct{}
+
+func (profileChooser) Pick() http.Header {
+	return http.Header{
+		"User-Agent":      {"Mozilla/5.0 (X11; Linux x86_64) Chrome/120.0.0.0 Safari/537.36"},
+		"Accept-Encoding": {"gzip, deflate, br, zstd"},
+	}
+}
+
+func encode(t *testing.T, encoding string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	default:
+		t.Fatalf("unknown encoding %s", encoding)
+	}
+	io.WriteString(w, encodedPage)
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestRestrictAcceptEncoding(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br, zstd", "gzip, deflate"},
+		{"br;q=1.0, gzip;q=0.8, *;q=0.1", "gzip;q=0.8"},
+		{"br", "gzip"},
+		{"identity", "identity"},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.in != "" {
+			header.Set("Accept-Encoding", tt.in)
+		}
+		restrictAcceptEncoding(header)
+		if got := header.Get("Accept-Encoding"); got != tt.want {
+			t.Errorf("restrictAcceptEncoding(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestGetPageDecodesProfileEncodings(t *testing.T) {
+	for _, encoding := range []string{"gzip", "deflate", "raw-deflate"} {
+		t.Run(encoding, func(t *testing.T) {
+			var accepted string
+			srv := httptest.NewServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {
+				accepted = r.Header.Get("Accept-Encoding")
+				w.Header().Set("Content-Encoding", strings.TrimPrefix(encoding, "raw-"))
+				w.Write(encode(t, encoding))
+			}))
+			defer srv.Close()
+
+			c := NewCrawler(nil, nil, WithHeaderChooser(profileChooser{}), quiet)
+			page, err := getPage(t, c, srv.URL+"/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if accepted != "gzip, deflate" {
+				t.Errorf("Accept-Encoding = %q, want the profile's decodable codings", accepted)
+			}
+			if page.Title != "encoded" {
+				t.Errorf("title = %q", page.Title)
+			}
+			if page.Fetch.CompressedBytes == 0 || page.Fetch.BodyBytes != int64(len(encodedPage)) {
+				t.Errorf("compressed %d, body %d bytes", page.Fetch.CompressedBytes, page.Fetch.BodyBytes)
+			}
+		})
+	}
+}
+
+func TestGetPageRejectsUnknownEncoding(t *testing.T) {
+	srv := httptest.NewServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {
+		// ignores Accept-Encoding
+		w.Header().Set("Content-Encoding", "br")
+		w.Write([]byte{0x1b, 0x00, 0x00})
+	}))
+	defer srv.Close()
+
+	_, err := getPage(t, NewCrawler(nil, nil, quiet), srv.URL+"/")
+	if err == nil || !strings.Contains(err.Error(), `unsupported content encoding "br"`) {
+		t.Fatalf("GetPage = %v, want an unsupported encoding error", err)
+	}
+}
+
+func TestOverrideHeadersCannotAskForUndecodableEncodings(t *testing.T) {
+	var accepted string
+	srv := httptest.NewServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {
+		accepted = r.Header.Get("Accept-Encoding")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(encode(t, "gzip"))
+	}))
+	defer srv.Close()
+
+	c := NewCrawler(nil, nil, quiet, WithDomainOverrides(map[string]DomainOverride{
+		"127.0.0.1": {Headers: map[string]string{"Accept-Encoding": "br, gzip"}},
+	}))
+	page, err := getPage(t, c, srv.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accepted != "gzip" {
+		t.Errorf("Accept-Encoding = %q, want br dropped from the override", accepted)
+	}
+	if page.Title != "encoded" {
+		t.Errorf("title = %q", page.Title)
+	}
+}
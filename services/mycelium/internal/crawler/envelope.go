@@ -0,0 +1,96 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// PageSchemaVersion must be bumped whenever the page encoding changes in a
+// way consumers need to know about.
+const PageSchemaVersion = 6
+
+// envelopePrefix is how every envelope starts, letting consumers that do not
+// understand envelopes detect and skip them by prefix.
+const envelopePrefix = `{"schema_version":`
+
+// Envelope wraps a page pushed to fungicide with enough metadata to trace it
+// back to the crawler that produced it. Payload holds the page as encoded by
+// Codec: raw JSON for the json codec, a base64 string for proto.
+type Envelope struct {
+	SchemaVersion int             `json:"schema_version"`
+	CrawlerID     string          `json:"crawler_id"`
+	SessionID     string          `json:"session_id,omitempty"`
+	EnqueuedAt    int64           `json:"enqueued_at"`
+	Codec         FungicideCodec  `json:"codec"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+// DefaultCrawlerID identifies this process as hostname-pid.
+func DefaultCrawlerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// IsEnvelope reports whether data is an enveloped message rather than a bare
+// page.
+func IsEnvelope(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(envelopePrefix))
+}
+
+func wrapEnvelope(crawlerID string, sessionID string, codec FungicideCodec, payload []byte) ([]byte, error) {
+	env := Envelope{
+		SchemaVersion: PageSchemaVersion,
+		CrawlerID:     crawlerID,
+		SessionID:     sessionID,
+		EnqueuedAt:    time.Now().UnixMilli(),
+		Codec:         codec,
+		Payload:       payload,
+	}
+	if codec == CodecProto {
+		encoded, err := json.Marshal(base64.StdEncoding.EncodeToString(payload))
+		if err != nil {
+			return nil, err
+		}
+		env.Payload = encoded
+	}
+	return json.Marshal(env)
+}
+
+// DecodeEnvelope parses an enveloped message.
+func DecodeEnvelope(data []byte) (*Envelope, error) {
+	if !IsEnvelope(data) {
+		return nil, fmt.Errorf("not an envelope")
+	}
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal envelope: %w", err)
+	}
+	return &env, nil
+}
+
+// Page decodes the envelope's payload.
+func (e *Envelope) Page() (*Page, error) {
+	switch e.Codec {
+	case CodecProto:
+		var encoded string
+		if err := json.Unmarshal(e.Payload, &encoded); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal proto payload: %w", err)
+		}
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode proto payload: %w", err)
+		}
+		return UnmarshalPageProto(data)
+	case CodecJSON, "":
+		return UnmarshalPage(e.Payload)
+	default:
+		return nil, fmt.Errorf("unknown envelope codec: %s", e.Codec)
+	}
+}
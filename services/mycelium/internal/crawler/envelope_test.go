@@ -0,0 +1,50 @@
+package crawler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	for _, codec := range []FungicideCodec{CodecJSON, CodecProto} {
+		t.Run(string(codec), func(t *testing.T) {
+			page := testPage(t)
+			c := NewCrawler(nil, nil, WithFungicideCodec(codec), WithEnvelope("crawler-1"))
+			data, err := c.encodePage(page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !IsEnvelope(data) {
+				t.Fatalf("message %q is not detected as an envelope", data)
+			}
+
+			env, err := DecodeEnvelope(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if env.SchemaVersion != PageSchemaVersion || env.CrawlerID != "crawler-1" || env.Codec != codec || env.EnqueuedAt == 0 {
+				t.Errorf("envelope = %+v", env)
+			}
+			got, err := env.Page()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, page) {
+				t.Errorf("payload = %+v, want %+v", got, page)
+			}
+		})
+	}
+}
+
+func TestBarePagesAreNotEnvelopes(t *testing.T) {
+	data, err := NewCrawler(nil, nil).encodePage(testPage(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsEnvelope(data) {
+		t.Error("bare page detected as an envelope")
+	}
+	if _, err := DecodeEnvelope(data); err == nil {
+		t.Error("bare page decoded as an envelope")
+	}
+}
@@ -0,0 +1,101 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"mycelium/internal/cache"
+)
+
+var (
+	// ErrQueueEmpty is returned by CrawlOnce when no item arrived in time.
+	// Caches should return it from PopFromMyceliumIngress.
+	ErrQueueEmpty = cache.ErrQueueEmpty
+	// ErrTransient wraps errors that may go away on their own, such as the
+	// cache being unreachable. Items that fail with it are retried.
+	ErrTransient = errors.New("transient")
+
+	ErrBlockedByFilter        = errors.New("blocked by filter")
+	ErrBlacklisted            = errors.New("domain blacklisted")
+	ErrUnsupportedContentType = errors.New("unsupported content type")
+	// ErrHTTPStatus is matched by every *StatusError.
+	ErrHTTPStatus   = errors.New("http error status")
+	ErrBodyTooLarge = errors.New("body too large")
+	// ErrPageTimeout is returned by GetPage when a page runs over the budget
+	// set with WithPageTimeout.
+	ErrPageTimeout = errors.New("page timeout exceeded")
+	// ErrBandwidthBudgetExhausted is returned by Crawl and CrawlOnce once
+	// the budget set with WithBandwidthBudget is spent.
+	ErrBandwidthBudgetExhausted = errors.New("bandwidth budget exhausted")
+	// ErrTooManyRedirects and ErrRedirectLoop fail fetches whose redirects
+	// go past WithMaxRedirects or WithMaxCrossHostRedirects, or come back to
+	// a url already in the chain.
+	ErrTooManyRedirects = errors.New("too many redirects")
+	ErrRedirectLoop     = errors.New("redirect loop")
+)
+
+// StatusError is returned by GetPage for responses with a 4xx or 5xx status.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("http status %d", e.StatusCode)
+}
+
+func (e *StatusError) Is(target error) bool {
+	return target == ErrHTTPStatus
+}
+
+// retryable reports whether the server may answer differently later.
+func (e *StatusError) retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// ProxyError wraps a failed request made through a proxy. Proxy has any
+// password redacted.
+type ProxyError struct {
+	Proxy string
+	Err   error
+}
+
+func (e *ProxyError) Error() string {
+	return fmt.Sprintf("via proxy %s: %v", e.Proxy, e.Err)
+}
+
+func (e *ProxyError) Unwrap() error {
+	return e.Err
+}
+
+// transient marks err as worth retrying.
+func transient(err error) error {
+	return fmt.Errorf("%w: %w", ErrTransient, err)
+}
+
+// errorLabel names the kind of err for metrics, hooks and dead letters.
+func errorLabel(err error) string {
+	var statusErr *StatusError
+	switch {
+	case errors.Is(err, ErrBlockedByFilter):
+		return "blocked"
+	case errors.Is(err, ErrBlacklisted):
+		return "blacklisted"
+	case errors.Is(err, ErrUnsupportedContentType):
+		return "unsupported_content_type"
+	case errors.As(err, &statusErr):
+		return fmt.Sprintf("http_%d", statusErr.StatusCode)
+	case errors.Is(err, ErrBodyTooLarge):
+		return "body_too_large"
+	case errors.Is(err, ErrPageTimeout):
+		return "page_timeout"
+	case errors.Is(err, ErrTooManyRedirects):
+		return "too_many_redirects"
+	case errors.Is(err, ErrRedirectLoop):
+		return "redirect_loop"
+	case errors.Is(err, ErrTransient):
+		return "transient"
+	default:
+		return "error"
+	}
+}
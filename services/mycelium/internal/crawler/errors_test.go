@@ -0,0 +1,143 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAdmitErrors(t *testing.T) {
+	cache := &failingCache{memCache: newMemCache(), fail: map[string]bool{}}
+	cache.blacklist["blacklist"] = map[string]bool{"listed.test": true}
+	c := NewCrawler(cache, nil, quiet,
+		WithUrlFilters([]UrlFilter{hostFilter("spam.test")}),
+		WithMyceliumBlacklistKey("blacklist"))
+	c.rejected.add("rejected.test")
+
+	tests := []struct {
+		location string
+		fail     string
+		want     error
+	}{
+		{location: "https://fine.test/", want: nil},
+		{location: "https://spam.test/", want: ErrBlockedByFilter},
+		{location: "https://rejected.test/", want: ErrBlacklisted},
+		{location: "https://listed.test/", want: ErrBlacklisted},
+		{location: "https://fine.test/", fail: "IsBlacklisted", want: ErrTransient},
+	}
+	for _, test := range tests {
+		cache.fail = map[string]bool{test.fail: true}
+		err := c.admit(context.Background(), mustParse(t, test.location))
+		if test.want == nil {
+			if err != nil {
+				t.Errorf("admit(%s) = %v, want nil", test.location, err)
+			}
+			continue
+		}
+		if !errors.Is(err, test.want) {
+			t.Errorf("admit(%s) with %q failing = %v, want %v", test.location, test.fail, err, test.want)
+		}
+	}
+}
+
+func TestGetPageErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/busy":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(pngHeader)
+		case "/large":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, "<html><body>%s</body></html>", strings.Repeat("x", 4096))
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "<html><body>small</body></html>")
+		}
+	}))
+	defer srv.Close()
+
+	c := NewCrawler(nil, nil, quiet, WithMaxBodyBytes(1024))
+	tests := []struct {
+		path    string
+		want    error
+		label   string
+		outcome string
+	}{
+		{path: "/missing", want: ErrHTTPStatus, label: "http_404", outcome: OutcomePermanent},
+		{path: "/busy", want: ErrHTTPStatus, label: "http_503", outcome: OutcomeRetryable},
+		{path: "/image", want: ErrUnsupportedContentType, label: "unsupported_content_type", outcome: ""},
+		{path: "/large", want: ErrBodyTooLarge, label: "body_too_large", outcome: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			_, err := getPage(t, c, srv.URL+test.path)
+			if !errors.Is(err, test.want) {
+				t.Fatalf("GetPage = %v, want %v", err, test.want)
+			}
+			if label := errorLabel(err); label != test.label {
+				t.Errorf("label = %q, want %q", label, test.label)
+			}
+			if outcome := classifyFetchError(err); outcome != test.outcome {
+				t.Errorf("outcome = %q, want %q", outcome, test.outcome)
+			}
+		})
+	}
+
+	if _, err := getPage(t, c, srv.URL+"/"); err != nil {
+		t.Errorf("GetPage under the size limit = %v", err)
+	}
+}
+
+func TestCappedReader(t *testing.T) {
+	for _, size := range []int{9, 10, 11} {
+		cr := &cappedReader{r: strings.NewReader(strings.Repeat("x", size)), remaining: 10}
+		var got bytes.Buffer
+		_, err := got.ReadFrom(cr)
+		tooLarge := size > 10
+		if tooLarge != errors.Is(err, ErrBodyTooLarge) || tooLarge != cr.exceeded {
+			t.Errorf("%d bytes: err %v, exceeded %t", size, err, cr.exceeded)
+		}
+		if got.Len() != min(size, 10) {
+			t.Errorf("%d bytes: read %d", size, got.Len())
+		}
+	}
+}
+
+func TestDroppedItemsAreCountedByKind(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	cache := newMemCache()
+	metrics := NewCounterMetrics()
+	c := NewCrawler(cache, nil, quiet, WithMyceliumIngressKey("ingress"), WithMetrics(metrics),
+		WithUrlFilters([]UrlFilter{hostFilter("spam.test")}))
+	if err := c.Enqueue(context.Background(), IngressItem{Location: srv.URL + "/gone"}); err != nil {
+		t.Fatal(err)
+	}
+	// Enqueue drops blocked urls itself, so push past it
+	cache.PushToMyceliumIngress(context.Background(), `{"location":"https://spam.test/"}`, "ingress")
+
+	for {
+		if _, err := c.CrawlOnce(context.Background()); err != nil {
+			if !errors.Is(err, ErrQueueEmpty) {
+				t.Fatal(err)
+			}
+			break
+		}
+	}
+	if n := metrics.Get(MetricItemsDroppedPrefix + "blocked"); n != 1 {
+		t.Errorf("counted %d blocked items, want 1", n)
+	}
+	if n := metrics.Get(MetricItemsDroppedPrefix + "http_404"); n != 1 {
+		t.Errorf("counted %d items dropped for a 404, want 1", n)
+	}
+}
@@ -0,0 +1,125 @@
+package crawler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+// FailureCapture is the evidence kept for a response GetPage rejected, e.g.
+// for its status, content type or size. It is written to the Store under
+// the "failures" prefix.
+type FailureCapture struct {
+	URL        string      `json:"url"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Error      string      `json:"error"`
+	// Body is the start of the decoded body, Truncated reporting whether
+	// there was more.
+	Body       string    `json:"body"`
+	Truncated  bool      `json:"truncated"`
+	CapturedAt time.Time `json:"captured_at"`
+}
+
+func (f *FailureCapture) Prefix() string {
+	return "failures"
+}
+
+func (f *FailureCapture) Marshal() ([]byte, error) {
+	return json.Marshal(f)
+}
+
+// Key is the hex SHA-256 of the url, so captures of one url can be found
+// again.
+func (f *FailureCapture) Key() string {
+	sum := sha256.Sum256([]byte(f.URL))
+	return hex.EncodeToString(sum[:])
+}
+
+func (f *FailureCapture) CreatedAt() time.Time {
+	return f.CapturedAt
+}
+
+func (f *FailureCapture) Labels() map[string]string {
+	return map[string]string{"host": hostOf(f.URL), "error": f.Error}
+}
+
+// WithFailureCapture stores a FailureCapture with the first maxBytes of the
+// body whenever GetPage rejects a response, up to maxCaptures in the life of
+// the crawler. The crawler needs a Store. A non-positive maxCaptures
+// disables capturing.
+func WithFailureCapture(maxBytes int, maxCaptures int) CrawlerOption {
+	return func(c *Crawler) {
+		if maxCaptures <= 0 {
+			c.failures = nil
+			return
+		}
+		c.failures = &failureCapture{maxBytes: maxBytes, maxCaptures: int64(maxCaptures)}
+	}
+}
+
+type failureCapture struct {
+	maxBytes    int
+	maxCaptures int64
+	captured    atomic.Int64
+}
+
+// captureBuffer keeps the first max bytes written to it.
+type captureBuffer struct {
+	buf       []byte
+	max       int
+	truncated bool
+}
+
+func (b *captureBuffer) Write(p []byte) (int, error) {
+	room := b.max - len(b.buf)
+	if len(p) > room {
+		b.truncated = true
+		p = p[:max(room, 0)]
+	}
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+// full reports whether the buffer needs no more bytes.
+func (b *captureBuffer) full() bool {
+	return len(b.buf) >= b.max
+}
+
+// captureFailure stores the rejected response res for loc. body, if not
+// nil, is read to fill up capture first.
+func (c *Crawler) captureFailure(loc *url.URL, res *http.Response, capture *captureBuffer, body io.Reader, cause error) {
+	if c.store == nil {
+		return
+	}
+	if c.failures.captured.Add(1) > c.failures.maxCaptures {
+		c.metrics.Incr(MetricFailuresSkipped, 1)
+		return
+	}
+
+	if body != nil && !capture.full() {
+		// read one byte past the cap to learn whether the body went on
+		io.Copy(capture, io.LimitReader(body, int64(capture.max-len(capture.buf)+1)))
+	}
+	header := res.Header.Clone()
+	header.Del("Set-Cookie")
+	failure := &FailureCapture{
+		URL:        loc.String(),
+		StatusCode: res.StatusCode,
+		Header:     header,
+		Error:      cause.Error(),
+		Body:       string(capture.buf),
+		Truncated:  capture.truncated,
+		CapturedAt: c.now(),
+	}
+	if _, err := c.store.Store(failure, ".json"); err != nil {
+		c.logger.Error("failed to store failure capture", "url", failure.URL, "error", err)
+		return
+	}
+	c.metrics.Incr(MetricFailuresCaptured, 1)
+}
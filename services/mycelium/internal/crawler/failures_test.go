@@ -0,0 +1,126 @@
+package crawler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// failures returns the FailureCaptures in store.
+func failures(t *testing.T, store *memStore) []FailureCapture {
+	t.Helper()
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	var captured []FailureCapture
+	for id, data := range store.items {
+		if !strings.HasPrefix(id, "failures") {
+			continue
+		}
+		var failure FailureCapture
+		if err := json.Unmarshal(data, &failure); err != nil {
+			t.Fatalf("capture %s: %s", id, err)
+		}
+		captured = append(captured, failure)
+	}
+	return captured
+}
+
+func TestFailureCapture(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=secret")
+		switch r.URL.Path {
+		case "/missing":
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("<html><body>" + strings.Repeat("gone ", 100) + "</body></html>"))
+		case "/binary":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte("\x00\x01\x02"))
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html><body>fine</body></html>"))
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		path     string
+		wantBody string
+		// wantTruncated is set when the body went past the capture size
+		wantTruncated bool
+	}{
+		{name: "error status", path: "/missing", wantBody: "<html><body>gone ", wantTruncated: true},
+		{name: "rejected content type", path: "/binary", wantBody: "\x00\x01\x02"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newMemStore()
+			metrics := NewCounterMetrics()
+			c := NewCrawler(newMemCache(), store, quiet, WithMetrics(metrics), WithFailureCapture(17, 10))
+			if _, err := getPage(t, c, srv.URL+test.path); err == nil {
+				t.Fatal("the response was not rejected")
+			}
+
+			captured := failures(t, store)
+			if len(captured) != 1 {
+				t.Fatalf("captured %d failures, want 1", len(captured))
+			}
+			failure := captured[0]
+			if failure.URL != srv.URL+test.path || failure.Error == "" || failure.CapturedAt.IsZero() {
+				t.Errorf("captured %+v, want the url, error and time", failure)
+			}
+			if failure.Body != test.wantBody || failure.Truncated != test.wantTruncated {
+				t.Errorf("captured body %q (truncated %t), want %q (truncated %t)", failure.Body, failure.Truncated, test.wantBody, test.wantTruncated)
+			}
+			if failure.Header.Get("Set-Cookie") != "" {
+				t.Error("Set-Cookie was captured")
+			}
+			if failure.Header.Get("Content-Type") == "" {
+				t.Error("the other headers were not captured")
+			}
+			if n := metrics.Get(MetricFailuresCaptured); n != 1 {
+				t.Errorf("counted %d captures, want 1", n)
+			}
+		})
+	}
+
+	t.Run("successful pages are not captured", func(t *testing.T) {
+		store := newMemStore()
+		c := NewCrawler(newMemCache(), store, quiet, WithFailureCapture(17, 10))
+		if _, err := getPage(t, c, srv.URL+"/"); err != nil {
+			t.Fatal(err)
+		}
+		if captured := failures(t, store); len(captured) != 0 {
+			t.Errorf("captured %+v", captured)
+		}
+	})
+
+	t.Run("captures are capped", func(t *testing.T) {
+		store := newMemStore()
+		metrics := NewCounterMetrics()
+		c := NewCrawler(newMemCache(), store, quiet, WithMetrics(metrics), WithFailureCapture(17, 2))
+		for range 3 {
+			getPage(t, c, srv.URL+"/missing")
+		}
+		if captured := failures(t, store); len(captured) != 2 {
+			t.Errorf("captured %d failures, want 2", len(captured))
+		}
+		if n := metrics.Get(MetricFailuresSkipped); n != 1 {
+			t.Errorf("counted %d skipped captures, want 1", n)
+		}
+	})
+
+	t.Run("without a store", func(t *testing.T) {
+		metrics := NewCounterMetrics()
+		c := NewCrawler(newMemCache(), nil, quiet, WithMetrics(metrics), WithFailureCapture(17, 10))
+		if _, err := getPage(t, c, srv.URL+"/missing"); err == nil {
+			t.Fatal("the response was not rejected")
+		}
+		if n := metrics.Get(MetricFailuresCaptured); n != 0 {
+			t.Errorf("counted %d captures without a store", n)
+		}
+	})
+}
@@ -0,0 +1,149 @@
+package crawler
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PageType tells fungicide how a page's fields were extracted.
+type PageType string
+
+const (
+	PageTypeHTML PageType = "html"
+	PageTypeText PageType = "text"
+	// PageTypeFeed pages carry one Content entry per feed entry and link to
+	// the entries.
+	PageTypeFeed PageType = "feed"
+)
+
+const (
+	mediaTypeRSS  = "application/rss+xml"
+	mediaTypeAtom = "application/atom+xml"
+)
+
+// WithFeedParsing accepts RSS and Atom feeds and parses them into pages of
+// type PageTypeFeed. Feeds are skipped like any other non-text type when
+// disabled.
+func WithFeedParsing(enabled bool) CrawlerOption {
+	return func(c *Crawler) {
+		c.feedParsing = enabled
+	}
+}
+
+func isFeed(mediaType string) bool {
+	return mediaType == mediaTypeRSS || mediaType == mediaTypeAtom
+}
+
+// acceptsType reports whether GetPage should read a body of mediaType.
+func (c *Crawler) acceptsType(mediaType string) bool {
+	return isTextual(mediaType) || (c.feedParsing && isFeed(mediaType))
+}
+
+type rssFeed struct {
+	Channel struct {
+		Title       string `xml:"title"`
+		Description string `xml:"description"`
+		Items       []struct {
+			Title       string `xml:"title"`
+			Link        string `xml:"link"`
+			Description string `xml:"description"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+type atomFeed struct {
+	Title    string `xml:"title"`
+	Subtitle string `xml:"subtitle"`
+	Author   struct {
+		Name string `xml:"name"`
+	} `xml:"author"`
+	Entries []struct {
+		Title string `xml:"title"`
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+		Summary string `xml:"summary"`
+		Content string `xml:"content"`
+	} `xml:"entry"`
+}
+
+// ParseFeed fills the page from an RSS or Atom document, telling them apart
+// by the root element. Entries become Content and their links become Links.
+func (p *Page) ParseFeed(r io.Reader) error {
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+	// entries are mostly ASCII, so read other charsets as they are rather
+	// than failing the whole feed
+	decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return fmt.Errorf("failed to find feed root: %w", err)
+		}
+		root, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch root.Name.Local {
+		case "rss":
+			var feed rssFeed
+			if err := decoder.DecodeElement(&feed, &root); err != nil {
+				return fmt.Errorf("failed to parse rss feed: %w", err)
+			}
+			p.Title = strings.TrimSpace(feed.Channel.Title)
+			p.Description = strings.TrimSpace(feed.Channel.Description)
+			for _, item := range feed.Channel.Items {
+				p.addFeedEntry(item.Title, item.Description, item.Link)
+			}
+		case "feed":
+			var feed atomFeed
+			if err := decoder.DecodeElement(&feed, &root); err != nil {
+				return fmt.Errorf("failed to parse atom feed: %w", err)
+			}
+			p.Title = strings.TrimSpace(feed.Title)
+			p.Description = strings.TrimSpace(feed.Subtitle)
+			p.Author = strings.TrimSpace(feed.Author.Name)
+			for _, entry := range feed.Entries {
+				text := entry.Summary
+				if text == "" {
+					text = entry.Content
+				}
+				link := ""
+				for _, l := range entry.Links {
+					if l.Rel == "" || l.Rel == "alternate" {
+						link = l.Href
+						break
+					}
+				}
+				p.addFeedEntry(entry.Title, text, link)
+			}
+		default:
+			return fmt.Errorf("unknown feed root element %q", root.Name.Local)
+		}
+		p.Type = PageTypeFeed
+		return nil
+	}
+}
+
+func (p *Page) addFeedEntry(title string, text string, link string) {
+	title, text = strings.TrimSpace(title), strings.TrimSpace(text)
+	if title != "" {
+		p.Headings = append(p.Headings, title)
+	}
+	if entry := strings.TrimSpace(title + "\n" + text); entry != "" {
+		p.Content = append(p.Content, entry)
+	}
+	if link == "" {
+		return
+	}
+	if u, err := p.NormalizePageURL(link); err == nil {
+		p.Links = append(p.Links, *u)
+	}
+}
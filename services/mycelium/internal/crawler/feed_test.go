@@ -0,0 +1,129 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const xhtmlFixture = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Strict//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-strict.dtd">
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head><title>Strict page</title><meta name="description" content="served as xhtml" /></head>
+<body><h1>Hello</h1><p>Some text.</p><a href="/next">next</a></body>
+</html>`
+
+const atomFixture = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Example blog</title>
+  <subtitle>Posts about things</subtitle>
+  <author><name>Ann Author</name></author>
+  <entry>
+    <title>First post</title>
+    <link rel="alternate" href="https://example.com/posts/1"/>
+    <link rel="edit" href="https://example.com/edit/1"/>
+    <summary>The first summary.</summary>
+  </entry>
+  <entry>
+    <title>Second post</title>
+    <link href="/posts/2"/>
+    <content>Full text of the second.</content>
+  </entry>
+</feed>`
+
+const rssFixture = `<?xml version="1.0"?>
+<rss version="2.0"><channel>
+  <title>News</title>
+  <description>Daily news</description>
+  <item><title>Story</title><link>https://example.com/story</link><description>What happened.</description></item>
+</channel></rss>`
+
+func typedServer(t *testing.T, contentType string, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGetPageXHTML(t *testing.T) {
+	srv := typedServer(t, "application/xhtml+xml; charset=utf-8", xhtmlFixture)
+	page, err := getPage(t, NewCrawler(nil, nil, quiet), srv.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Type != PageTypeHTML {
+		t.Errorf("type = %q, want html", page.Type)
+	}
+	if page.Title != "Strict page" || page.Description != "served as xhtml" {
+		t.Errorf("title %q, description %q", page.Title, page.Description)
+	}
+	if !slices.Contains(page.Headings, "Hello") || !slices.Contains(page.Content, "Some text.") {
+		t.Errorf("headings %v, content %v", page.Headings, page.Content)
+	}
+	if len(page.Links) != 1 || page.Links[0].String() != srv.URL+"/next" {
+		t.Errorf("links = %v", page.Links)
+	}
+}
+
+func TestGetPageAtomFeed(t *testing.T) {
+	srv := typedServer(t, "application/atom+xml", atomFixture)
+	page, err := getPage(t, NewCrawler(nil, nil, quiet, WithFeedParsing(true)), srv.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Type != PageTypeFeed {
+		t.Errorf("type = %q, want feed", page.Type)
+	}
+	if page.Title != "Example blog" || page.Description != "Posts about things" || page.Author != "Ann Author" {
+		t.Errorf("title %q, description %q, author %q", page.Title, page.Description, page.Author)
+	}
+	wantContent := []string{"First post\nThe first summary.", "Second post\nFull text of the second."}
+	if !slices.Equal(page.Content, wantContent) {
+		t.Errorf("content = %q, want %q", page.Content, wantContent)
+	}
+	var links []string
+	for _, link := range page.Links {
+		links = append(links, link.String())
+	}
+	if want := []string{"https://example.com/posts/1", srv.URL + "/posts/2"}; !slices.Equal(links, want) {
+		t.Errorf("links = %v, want %v", links, want)
+	}
+}
+
+func TestGetPageRSSFeed(t *testing.T) {
+	srv := typedServer(t, "application/rss+xml", rssFixture)
+	page, err := getPage(t, NewCrawler(nil, nil, quiet, WithFeedParsing(true)), srv.URL+"/rss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Type != PageTypeFeed || page.Title != "News" {
+		t.Errorf("type %q, title %q", page.Type, page.Title)
+	}
+	if len(page.Content) != 1 || !strings.Contains(page.Content[0], "What happened.") {
+		t.Errorf("content = %q", page.Content)
+	}
+	if len(page.Links) != 1 || page.Links[0].String() != "https://example.com/story" {
+		t.Errorf("links = %v", page.Links)
+	}
+}
+
+func TestGetPageFeedsOffByDefault(t *testing.T) {
+	srv := typedServer(t, "application/atom+xml", atomFixture)
+	if _, err := getPage(t, NewCrawler(nil, nil, quiet), srv.URL+"/feed"); !errors.Is(err, ErrUnsupportedContentType) {
+		t.Fatalf("GetPage = %v, want feeds skipped without feed parsing", err)
+	}
+}
+
+func TestParseFeedUnknownRoot(t *testing.T) {
+	page := NewPage(mustParse(t, "https://example.com/"))
+	if err := page.ParseFeed(strings.NewReader("<html><body/></html>")); err == nil {
+		t.Error("parsed an html document as a feed")
+	}
+}
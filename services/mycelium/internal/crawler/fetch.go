@@ -0,0 +1,352 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// FetchRequest is a request made with Fetch, such as a POST to a JSON API.
+type FetchRequest struct {
+	// Method defaults to GET.
+	Method string
+	URL    *url.URL
+	// Header is set over the browser headers the crawler picks. Domain
+	// overrides still apply on top of it.
+	Header http.Header
+	// Body is sent as is and may be at most 64 KiB.
+	Body []byte
+}
+
+// FetchResult is the response to a FetchRequest.
+type FetchResult struct {
+	StatusCode int
+	Header     http.Header
+	// URL is where the response came from after any redirects.
+	URL *url.URL
+	// Body is the decoded response body.
+	Body  []byte
+	Fetch *FetchInfo
+}
+
+// Fetch makes req with the headers, proxies, timeouts, redirect policy and
+// body cap GetPage uses, and reads the response body. Unlike GetPage it
+// returns responses of any status without an error, does not parse the body
+// and does not admit or mark visited the hops of a redirect. Crawl only
+// fetches pages with GET.
+func (r *Crawler) Fetch(ctx context.Context, req FetchRequest) (result *FetchResult, err error) {
+	if req.URL == nil {
+		return nil, fmt.Errorf("fetch request has no url")
+	}
+	tracer := r.tracer
+	if tracer == nil {
+		tracer = nopTracer()
+	}
+	ctx, span := tracer.Start(ctx, SpanFetch, trace.WithAttributes(attribute.String("url.host", req.URL.Hostname())))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "fetch failed")
+		}
+		span.End()
+	}()
+
+	res, fetch, downloaded, err := r.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	decoded := &countingReader{}
+	defer func() { r.countBandwidth(req.URL.Hostname(), downloaded.n, decoded.n) }()
+	span.SetAttributes(attribute.Int("http.status_code", res.StatusCode))
+
+	body, err := decodeBody(res, downloaded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode body of %s: %w", req.URL.String(), err)
+	}
+	defer body.Close()
+	decoded.r = body
+	var bodyReader io.Reader = decoded
+	if r.maxBodyBytes > 0 {
+		bodyReader = &cappedReader{r: decoded, remaining: r.maxBodyBytes}
+	}
+	data, err := io.ReadAll(bodyReader)
+	if err != nil {
+		if errors.Is(err, ErrBodyTooLarge) {
+			return nil, fmt.Errorf("response %s is larger than %d bytes: %w", req.URL.String(), r.maxBodyBytes, err)
+		}
+		return nil, fmt.Errorf("failed to read body of %s: %w", req.URL.String(), err)
+	}
+	fetch.BodyBytes = decoded.n
+	if contentEncoding(res) != "" {
+		fetch.CompressedBytes = downloaded.n
+	}
+
+	return &FetchResult{
+		StatusCode: res.StatusCode,
+		Header:     res.Header,
+		URL:        res.Request.URL,
+		Body:       data,
+		Fetch:      fetch,
+	}, nil
+}
+
+// send makes req and returns the response with its body counted as it comes
+// off the wire. Closing the body releases the request's timeout.
+func (r *Crawler) send(ctx context.Context, freq FetchRequest) (res *http.Response, fetch *FetchInfo, downloaded *countingReader, err error) {
+	loc := freq.URL
+	method := freq.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	if len(freq.Body) > maxRequestBodyBytes {
+		return nil, nil, nil, fmt.Errorf("request body for %s is %d bytes, over the limit of %d", loc.String(), len(freq.Body), maxRequestBodyBytes)
+	}
+
+	override := r.overrideFor(loc.Hostname())
+	cancel := context.CancelFunc(func() {})
+	if timeout := r.requestTimeoutFor(override); timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer func() {
+		if err != nil {
+			cancel()
+		}
+	}()
+
+	var usedProxy *url.URL
+	ctx = context.WithValue(ctx, proxyUsedKey{}, &usedProxy)
+	conn := &connTrace{}
+	ctx = conn.withClientTrace(ctx)
+
+	var body io.Reader
+	if freq.Body != nil {
+		body = bytes.NewReader(freq.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, loc.String(), body)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	r.setBrowserHeaders(req)
+	setConditionalHeaders(ctx, req)
+	r.setCacheDirectives(req)
+	for k, v := range freq.Header {
+		req.Header[http.CanonicalHeaderKey(k)] = v
+	}
+	req = r.applyOverrideHeaders(req, override)
+	// after the overrides, which may ask for codings decodeBody cannot undo
+	restrictAcceptEncoding(req.Header)
+	if req.Header.Get("Accept-Encoding") == "" {
+		// ask for gzip here instead of leaving it to the transport, so the
+		// compressed size is known and the body cap applies after decoding
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+
+	start := time.Now()
+	res, err = r.client.Do(req)
+	r.reportProxyResult(usedProxy, err == nil, time.Since(start))
+	if usedProxy != nil {
+		r.metrics.Incr(MetricRequestsProxied, 1)
+		incrLabeled(r.metrics, MetricProxyPicks, LabelProxy, usedProxy.Redacted(), 1)
+	} else {
+		r.metrics.Incr(MetricRequestsDirect, 1)
+	}
+	if err != nil {
+		if usedProxy != nil {
+			err = &ProxyError{Proxy: usedProxy.Redacted(), Err: err}
+		}
+		return nil, nil, nil, fmt.Errorf("failed to request %s: %w", loc.String(), err)
+	}
+	res.Body = &cancelOnClose{ReadCloser: res.Body, cancel: cancel}
+	downloaded = &countingReader{r: res.Body}
+
+	fetch = &FetchInfo{
+		StatusCode:  res.StatusCode,
+		ContentType: res.Header.Get("Content-Type"),
+		FetchedAt:   start,
+		Duration:    time.Since(start),
+		ViaProxy:    usedProxy != nil,
+	}
+	conn.fill(fetch, r.metrics)
+	recordCacheHeaders(fetch, res.Header)
+	if fetch.FromCache() {
+		r.metrics.Incr(MetricUpstreamCacheHits, 1)
+	}
+	return res, fetch, downloaded, nil
+}
+
+// cancelOnClose cancels a request's context once its body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// FetchInfo describes how a page was fetched. When ViaProxy is set,
+// RemoteAddr and DNSLookup refer to the proxy, not the origin.
+type FetchInfo struct {
+	StatusCode   int
+	ContentType  string
+	Charset      string
+	FetchedAt    time.Time
+	Duration     time.Duration
+	DNSLookup    time.Duration
+	TLSHandshake time.Duration
+	RemoteAddr   string
+	ViaProxy     bool
+	ConnReused   bool
+	// BodyBytes is how much of the decoded body was read, and
+	// CompressedBytes what that took on the wire when the body was gzipped.
+	// Pages that are not parsed are only read as far as sniffing needs.
+	BodyBytes       int64
+	CompressedBytes int64
+	// CacheStatus is the X-Cache or Cache-Status header of an upstream
+	// cache, and Age how long the response had been cached. See FromCache.
+	CacheStatus string
+	Age         time.Duration
+}
+
+// fetchJSON is the wire format of FetchInfo, in milliseconds like the proto.
+type fetchJSON struct {
+	StatusCode      int    `json:"status_code"`
+	ContentType     string `json:"content_type,omitempty"`
+	Charset         string `json:"charset,omitempty"`
+	FetchedAtMs     int64  `json:"fetched_at_ms"`
+	DurationMs      int64  `json:"duration_ms"`
+	DNSMs           int64  `json:"dns_ms,omitempty"`
+	TLSHandshakeMs  int64  `json:"tls_handshake_ms,omitempty"`
+	RemoteAddr      string `json:"remote_addr,omitempty"`
+	ViaProxy        bool   `json:"via_proxy,omitempty"`
+	ConnReused      bool   `json:"conn_reused,omitempty"`
+	BodyBytes       int64  `json:"body_bytes,omitempty"`
+	CompressedBytes int64  `json:"compressed_bytes,omitempty"`
+	CacheStatus     string `json:"cache_status,omitempty"`
+	AgeMs           int64  `json:"age_ms,omitempty"`
+}
+
+func (f *FetchInfo) toJSON() *fetchJSON {
+	if f == nil {
+		return nil
+	}
+	return &fetchJSON{
+		StatusCode:      f.StatusCode,
+		ContentType:     f.ContentType,
+		Charset:         f.Charset,
+		FetchedAtMs:     f.FetchedAt.UnixMilli(),
+		DurationMs:      f.Duration.Milliseconds(),
+		DNSMs:           f.DNSLookup.Milliseconds(),
+		TLSHandshakeMs:  f.TLSHandshake.Milliseconds(),
+		RemoteAddr:      f.RemoteAddr,
+		ViaProxy:        f.ViaProxy,
+		ConnReused:      f.ConnReused,
+		BodyBytes:       f.BodyBytes,
+		CompressedBytes: f.CompressedBytes,
+		CacheStatus:     f.CacheStatus,
+		AgeMs:           f.Age.Milliseconds(),
+	}
+}
+
+func (f *fetchJSON) fetchInfo() *FetchInfo {
+	if f == nil {
+		return nil
+	}
+	return &FetchInfo{
+		StatusCode:      f.StatusCode,
+		ContentType:     f.ContentType,
+		Charset:         f.Charset,
+		FetchedAt:       time.UnixMilli(f.FetchedAtMs),
+		Duration:        time.Duration(f.DurationMs) * time.Millisecond,
+		DNSLookup:       time.Duration(f.DNSMs) * time.Millisecond,
+		TLSHandshake:    time.Duration(f.TLSHandshakeMs) * time.Millisecond,
+		RemoteAddr:      f.RemoteAddr,
+		ViaProxy:        f.ViaProxy,
+		ConnReused:      f.ConnReused,
+		BodyBytes:       f.BodyBytes,
+		CompressedBytes: f.CompressedBytes,
+		CacheStatus:     f.CacheStatus,
+		Age:             time.Duration(f.AgeMs) * time.Millisecond,
+	}
+}
+
+// connTrace collects connection details through httptrace. Dials can
+// outlive the request that started them, so fields are guarded.
+type connTrace struct {
+	mu           sync.Mutex
+	dnsStart     time.Time
+	dnsLookup    time.Duration
+	tlsStart     time.Time
+	tlsHandshake time.Duration
+	remoteAddr   string
+	reused       bool
+}
+
+func (t *connTrace) withClientTrace(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			t.dnsStart = time.Now()
+			t.mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			t.dnsLookup = time.Since(t.dnsStart)
+			t.mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			t.tlsStart = time.Now()
+			t.mu.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mu.Lock()
+			t.tlsHandshake = time.Since(t.tlsStart)
+			t.mu.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.remoteAddr = info.Conn.RemoteAddr().String()
+			t.reused = info.Reused
+			t.mu.Unlock()
+		},
+	})
+}
+
+// fill copies the traced details into info and feeds the fetch histograms.
+func (t *connTrace) fill(info *FetchInfo, metrics Metrics) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	info.DNSLookup = t.dnsLookup
+	info.TLSHandshake = t.tlsHandshake
+	info.RemoteAddr = t.remoteAddr
+	info.ConnReused = t.reused
+
+	observe(metrics, MetricFetchDuration, info.Duration)
+	if t.reused {
+		metrics.Incr(MetricConnsReused, 1)
+		return
+	}
+	if t.dnsLookup > 0 {
+		observe(metrics, MetricDNSLookup, t.dnsLookup)
+	}
+	if t.tlsHandshake > 0 {
+		observe(metrics, MetricTLSHandshake, t.tlsHandshake)
+	}
+}
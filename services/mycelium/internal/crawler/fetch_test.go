@@ -0,0 +1,239 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// fixedChooser always picks the same string.
+type fixedChooser string
+
+func (f fixedChooser) Pick() string { return string(f) }
+
+func TestFetchInfoTracesTheConnection(t *testing.T) {
+	srv := httptest.NewTLSServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><title>traced</title></html>")
+	}))
+	defer srv.Close()
+
+	// dial by name so the trace sees a DNS lookup; the test certificate is
+	// issued for example.com
+	client := srv.Client()
+	client.Transport.(*http.Transport).TLSClientConfig.ServerName = "example.com"
+	loc := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1) + "/"
+
+	metrics := NewCounterMetrics()
+	c := NewCrawler(nil, nil, WithHttpClient(client), WithMetrics(metrics), quiet)
+
+	first, err := getPage(t, c, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetch := first.Fetch
+	if fetch.RemoteAddr != srv.Listener.Addr().String() {
+		t.Errorf("remote addr = %q, want %q", fetch.RemoteAddr, srv.Listener.Addr())
+	}
+	if fetch.DNSLookup <= 0 || fetch.TLSHandshake <= 0 {
+		t.Errorf("dns lookup %s, tls handshake %s, want both traced", fetch.DNSLookup, fetch.TLSHandshake)
+	}
+	if fetch.ConnReused || fetch.ViaProxy {
+		t.Errorf("first fetch reused %t, via proxy %t", fetch.ConnReused, fetch.ViaProxy)
+	}
+
+	second, err := getPage(t, c, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !second.Fetch.ConnReused {
+		t.Error("second fetch did not reuse the connection")
+	}
+	if second.Fetch.TLSHandshake != 0 {
+		t.Errorf("reused connection reports a %s handshake", second.Fetch.TLSHandshake)
+	}
+
+	hists := metrics.Histograms()
+	for name, want := range map[string]int64{
+		MetricDNSLookup:     1,
+		MetricTLSHandshake:  1,
+		MetricFetchDuration: 2,
+	} {
+		if got := hists[name].Count; got != want {
+			t.Errorf("%s observed %d times, want %d", name, got, want)
+		}
+	}
+	if got := metrics.Get(MetricConnsReused); got != 1 {
+		t.Errorf("%s = %d, want 1", MetricConnsReused, got)
+	}
+}
+
+func TestFetchInfoViaProxy(t *testing.T) {
+	t.Setenv("NO_PROXY", "")
+	t.Setenv("no_proxy", "")
+
+	origin := httptest.NewServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><title>origin</title></html>")
+	}))
+	defer origin.Close()
+	originURL, _ := url.Parse(origin.URL)
+
+	// a forward proxy that sends everything to origin, so the crawled host
+	// never has to resolve
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		out := r.Clone(r.Context())
+		out.RequestURI = ""
+		out.URL.Scheme, out.URL.Host = originURL.Scheme, originURL.Host
+		res, err := http.DefaultTransport.RoundTrip(out)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer res.Body.Close()
+		for k, v := range res.Header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(res.StatusCode)
+		io.Copy(w, res.Body)
+	}))
+	defer proxy.Close()
+
+	metrics := NewCounterMetrics()
+	c := NewCrawler(nil, nil, WithProxyChooser(fixedChooser(proxy.URL)), WithMetrics(metrics), quiet)
+	page, err := getPage(t, c, "http://origin.invalid/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Title != "origin" {
+		t.Errorf("title = %q, want the page served through the proxy", page.Title)
+	}
+	if len(proxied) != 1 || proxied[0] != "http://origin.invalid/page" {
+		t.Errorf("proxy saw %v", proxied)
+	}
+	if !page.Fetch.ViaProxy {
+		t.Error("fetch not marked as proxied")
+	}
+	if page.Fetch.RemoteAddr != proxy.Listener.Addr().String() {
+		t.Errorf("remote addr = %q, want the proxy %q", page.Fetch.RemoteAddr, proxy.Listener.Addr())
+	}
+	if got := metrics.Get(MetricRequestsProxied); got != 1 {
+		t.Errorf("%s = %d, want 1", MetricRequestsProxied, got)
+	}
+	if got := metrics.GetLabeled(MetricProxyPicks, LabelProxy, proxy.URL); got != 1 {
+		t.Errorf("%s{%s=%q} = %d, want 1", MetricProxyPicks, LabelProxy, proxy.URL, got)
+	}
+}
+
+func TestProxyErrorNamesTheProxy(t *testing.T) {
+	t.Setenv("NO_PROXY", "")
+	t.Setenv("no_proxy", "")
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	proxy := "http://user:secret@" + down.Listener.Addr().String()
+
+	c := NewCrawler(nil, nil, WithProxyChooser(fixedChooser(proxy)), quiet)
+	_, err := getPage(t, c, "http://origin.test/")
+	var proxyErr *ProxyError
+	if !errors.As(err, &proxyErr) {
+		t.Fatalf("GetPage = %v, want a ProxyError", err)
+	}
+	if want := "http://user:xxxxx@" + down.Listener.Addr().String(); proxyErr.Proxy != want {
+		t.Errorf("proxy = %q, want %q", proxyErr.Proxy, want)
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("error %q leaks the proxy password", err)
+	}
+	if classifyFetchError(err) != OutcomeRetryable {
+		t.Errorf("outcome = %q, want a proxy failure retried", classifyFetchError(err))
+	}
+}
+
+func TestInvalidProxyFromStringChooser(t *testing.T) {
+	t.Setenv("NO_PROXY", "")
+	t.Setenv("no_proxy", "")
+	c := NewCrawler(nil, nil, WithProxyChooser(fixedChooser("http://%zz")), quiet)
+	if _, err := getPage(t, c, "http://origin.test/"); err == nil || !strings.Contains(err.Error(), "invalid proxy url") {
+		t.Errorf("GetPage = %v, want the bad proxy reported", err)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		fmt.Fprintf(w, `{"method":%q,"body":%q,"type":%q,"token":%q,"agent":%q,"key":%q}`,
+			r.Method, body, r.Header.Get("Content-Type"), r.Header.Get("X-Token"), r.Header.Get("User-Agent"), r.Header.Get("X-Api-Key"))
+	}))
+	defer srv.Close()
+
+	host := mustParse(t, srv.URL).Hostname()
+	c := NewCrawler(nil, nil, quiet, WithDomainOverrides(map[string]DomainOverride{
+		host: {Headers: map[string]string{"X-Api-Key": "override"}},
+	}))
+
+	t.Run("post with body and headers", func(t *testing.T) {
+		res, err := c.Fetch(context.Background(), FetchRequest{
+			Method: http.MethodPost,
+			URL:    mustParse(t, srv.URL+"/api"),
+			Header: http.Header{"Content-Type": {"application/json"}, "X-Token": {"abc"}},
+			Body:   []byte(`{"q":"mycelium"}`),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := fmt.Sprintf(`{"method":"POST","body":"{\"q\":\"mycelium\"}","type":"application/json","token":"abc","agent":%q,"key":"override"}`, defaultUserAgent)
+		if string(res.Body) != want {
+			t.Errorf("body %s\nwant %s", res.Body, want)
+		}
+		if res.StatusCode != http.StatusOK || res.URL.String() != srv.URL+"/api" || res.Fetch == nil || res.Fetch.BodyBytes != int64(len(res.Body)) {
+			t.Errorf("result %+v", res)
+		}
+	})
+
+	t.Run("get by default", func(t *testing.T) {
+		res, err := c.Fetch(context.Background(), FetchRequest{URL: mustParse(t, srv.URL+"/api")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(res.Body), `"method":"GET"`) {
+			t.Errorf("body %s, want a GET", res.Body)
+		}
+	})
+
+	t.Run("error status is not an error", func(t *testing.T) {
+		res, err := c.Fetch(context.Background(), FetchRequest{URL: mustParse(t, srv.URL+"/missing")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusNotFound || len(res.Body) == 0 {
+			t.Errorf("status %d with %d bytes, want the 404 and its body", res.StatusCode, len(res.Body))
+		}
+	})
+
+	t.Run("body over the limit", func(t *testing.T) {
+		_, err := c.Fetch(context.Background(), FetchRequest{
+			Method: http.MethodPost,
+			URL:    mustParse(t, srv.URL+"/api"),
+			Body:   make([]byte, maxRequestBodyBytes+1),
+		})
+		if err == nil {
+			t.Error("oversized request body was sent")
+		}
+	})
+
+	t.Run("no url", func(t *testing.T) {
+		if _, err := c.Fetch(context.Background(), FetchRequest{}); err == nil {
+			t.Error("request without a url was sent")
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"mycelium/internal/filter"
+)
+
+type hostFilter string
+
+func (f hostFilter) Filter(loc *url.URL) bool {
+	return strings.Contains(loc.Hostname(), string(f))
+}
+
+func TestCrawlerFilterReportsRule(t *testing.T) {
+	chain := filter.NewChain(
+		filter.Rule{Name: "ads", Filter: hostFilter("ads")},
+		filter.Rule{Name: "tracker", Filter: hostFilter("tracker")},
+	)
+	c := NewCrawler(nil, nil, WithUrlFilters([]UrlFilter{chain, hostFilter("plain")}))
+
+	tests := []struct {
+		rawUrl  string
+		blocked bool
+		rule    string
+	}{
+		{"https://example.com/", false, ""},
+		{"https://ads.example.com/", true, "ads"},
+		{"https://tracker.example.com/", true, "tracker"},
+		// filters without Match are named by their type
+		{"https://plain.example.com/", true, "crawler.hostFilter"},
+	}
+	for _, tt := range tests {
+		loc, _ := url.Parse(tt.rawUrl)
+		blocked, rule := c.filter(loc)
+		if blocked != tt.blocked || rule != tt.rule {
+			t.Errorf("filter(%s) = (%t, %q), want (%t, %q)", tt.rawUrl, blocked, rule, tt.blocked, tt.rule)
+		}
+	}
+}
+
+func TestLinksAreFilteredBeforeQueueing(t *testing.T) {
+	srv := httptest.NewServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><body>")
+		for i := range 18 {
+			fmt.Fprintf(w, `<a href="https://ads%d.example/">ad</a>`, i)
+		}
+		fmt.Fprint(w, `<a href="https://keep.example/a">a</a><a href="https://keep.example/b">b</a></body></html>`)
+	}))
+	defer srv.Close()
+
+	cache := newMemCache()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	metrics := countUntilFetch{NewCounterMetrics(), cancel}
+	c := NewCrawler(cache, nil, quiet, WithMyceliumIngressKey("ingress"), WithMetrics(metrics),
+		WithUrlFilters([]UrlFilter{hostFilter("ads")}), WithLinkQueueingMode(LinkQueueingAlways))
+	if err := c.Enqueue(context.Background(), IngressItem{Location: srv.URL + "/"}); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() { done <- c.Crawl(ctx) }()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		cancel()
+		<-done
+		t.Fatal("timed out waiting for the page")
+	}
+
+	if got, want := queuedLocations(t, cache), []string{"https://keep.example/a", "https://keep.example/b"}; !slices.Equal(got, want) {
+		t.Errorf("queued %q, want only the survivors %q", got, want)
+	}
+	if n := metrics.Get(MetricUrlsFiltered); n != 18 {
+		t.Errorf("counted %d filtered urls, want 18", n)
+	}
+	if n := metrics.Get(MetricUrlFilterHitsPrefix + "crawler_hostfilter"); n != 18 {
+		t.Errorf("counted %d hits of the host filter, want 18", n)
+	}
+
+	// producers are held to the same filters
+	if err := c.Enqueue(context.Background(), IngressItem{Location: "https://ads.example/"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(cache.queue("ingress")); n != 2 {
+		t.Errorf("%d items queued after enqueueing a filtered url, want 2", n)
+	}
+	if n := metrics.Get(MetricUrlsFiltered); n != 19 {
+		t.Errorf("counted %d filtered urls, want 19", n)
+	}
+}
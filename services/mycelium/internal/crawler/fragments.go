@@ -0,0 +1,45 @@
+package crawler
+
+import (
+	"net/url"
+	"strings"
+)
+
+// WithHashRoutes keeps route fragments, such as the "#/products/42" or
+// "#!/about" of single page apps, on urls of every domain so each route is
+// crawled as a page of its own. DomainOverride.HashRoutes does the same for
+// one domain. Other fragments are always stripped.
+func WithHashRoutes(enabled bool) CrawlerOption {
+	return func(c *Crawler) {
+		c.hashRoutes = enabled
+	}
+}
+
+// isRouteFragment reports whether fragment is a hash route ("/...") or a
+// hash-bang ("!...") rather than an anchor within the page.
+func isRouteFragment(fragment string) bool {
+	return strings.HasPrefix(fragment, "/") || (strings.HasPrefix(fragment, "!") && len(fragment) > 1)
+}
+
+func (c *Crawler) keepsHashRoutes(host string) bool {
+	if c.hashRoutes {
+		return true
+	}
+	o := c.overrideFor(host)
+	return o != nil && o.HashRoutes
+}
+
+// normalizeFragment strips loc's fragment unless it is a route kept for
+// loc's host.
+func (c *Crawler) normalizeFragment(loc *url.URL) *url.URL {
+	if loc == nil || (loc.Fragment == "" && loc.RawFragment == "") {
+		return loc
+	}
+	if isRouteFragment(loc.Fragment) && c.keepsHashRoutes(loc.Hostname()) {
+		return loc
+	}
+	stripped := *loc
+	stripped.Fragment = ""
+	stripped.RawFragment = ""
+	return &stripped
+}
@@ -0,0 +1,85 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestNormalizeFragment(t *testing.T) {
+	tests := []struct {
+		url      string
+		stripped string
+		kept     string
+	}{
+		{url: "https://example.com/#/products/42", stripped: "https://example.com/", kept: "https://example.com/#/products/42"},
+		{url: "https://example.com/#!legacy", stripped: "https://example.com/", kept: "https://example.com/#!legacy"},
+		{url: "https://example.com/docs#anchor", stripped: "https://example.com/docs", kept: "https://example.com/docs"},
+		{url: "https://example.com/docs#!", stripped: "https://example.com/docs", kept: "https://example.com/docs"},
+		{url: "https://example.com/docs#", stripped: "https://example.com/docs", kept: "https://example.com/docs"},
+		{url: "https://example.com/docs", stripped: "https://example.com/docs", kept: "https://example.com/docs"},
+	}
+	global := NewCrawler(nil, nil, quiet, WithHashRoutes(true))
+	perDomain := NewCrawler(nil, nil, quiet, WithDomainOverrides(map[string]DomainOverride{"example.com": {HashRoutes: true}}))
+	off := NewCrawler(nil, nil, quiet)
+	for _, test := range tests {
+		loc := mustParse(t, test.url)
+		if got := off.normalizeFragment(loc).String(); got != test.stripped {
+			t.Errorf("default: %s normalized to %s, want %s", test.url, got, test.stripped)
+		}
+		if got := global.normalizeFragment(loc).String(); got != test.kept {
+			t.Errorf("WithHashRoutes: %s normalized to %s, want %s", test.url, got, test.kept)
+		}
+		if got := perDomain.normalizeFragment(loc).String(); got != test.kept {
+			t.Errorf("override: %s normalized to %s, want %s", test.url, got, test.kept)
+		}
+		if loc.String() != mustParse(t, test.url).String() {
+			t.Errorf("normalizing modified %s", test.url)
+		}
+	}
+
+	other := mustParse(t, "https://example.org/#/route")
+	if got := perDomain.normalizeFragment(other).String(); got != "https://example.org/" {
+		t.Errorf("the override kept the route of another domain: %s", got)
+	}
+}
+
+func TestHashRouteLinks(t *testing.T) {
+	srv := httptest.NewServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><body>
+<a href="#/products/42">product</a>
+<a href="#!legacy">legacy</a>
+<a href="#top">top</a>
+</body></html>`)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name string
+		opts []CrawlerOption
+		want []string
+	}{
+		{name: "default", want: []string{srv.URL + "/app"}},
+		{name: "hash routes", opts: []CrawlerOption{WithHashRoutes(true)}, want: []string{srv.URL + "/app#/products/42", srv.URL + "/app#!legacy", srv.URL + "/app"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := NewCrawler(newMemCache(), nil, append([]CrawlerOption{quiet}, test.opts...)...)
+			page, err := getPage(t, c, srv.URL+"/app")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var links []string
+			for _, link := range page.Links {
+				if !slices.Contains(links, link.String()) {
+					links = append(links, link.String())
+				}
+			}
+			if !slices.Equal(links, test.want) {
+				t.Errorf("links %q, want %q", links, test.want)
+			}
+		})
+	}
+}
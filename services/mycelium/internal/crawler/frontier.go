@@ -0,0 +1,101 @@
+package crawler
+
+import (
+	"context"
+	"math/rand/v2"
+)
+
+// LinkSelection picks which links of a page are kept when it has more than
+// the per page limit.
+type LinkSelection string
+
+const (
+	LinkSelectionDocument LinkSelection = "document"
+	LinkSelectionRandom   LinkSelection = "random"
+)
+
+// QueueMover is implemented by caches that can move items between queues.
+// WithFrontierCap needs it to drain the overflow list.
+type QueueMover interface {
+	MoveItems(ctx context.Context, fromKey string, toKey string, n int64) (int64, error)
+}
+
+// WithMaxLinksPerPage queues at most n links from any one page, chosen by
+// selection. A non-positive n queues every link.
+func WithMaxLinksPerPage(n int, selection LinkSelection) CrawlerOption {
+	return func(c *Crawler) {
+		c.maxLinksPerPage = n
+		c.linkSelection = selection
+	}
+}
+
+// WithFrontierCap stops queueing links once the ingress queue holds maxLen
+// items. Links beyond the cap go to overflowKey, to be moved back by
+// DrainOverflow once there is room, or are dropped when overflowKey is
+// empty. A non-positive maxLen disables the cap.
+func WithFrontierCap(maxLen int, overflowKey string) CrawlerOption {
+	return func(c *Crawler) {
+		c.frontierCap = int32(maxLen)
+		c.overflowKey = overflowKey
+	}
+}
+
+// capLinks applies the per page link limit.
+func capLinks[T any](c *Crawler, links []T) []T {
+	if c.maxLinksPerPage <= 0 || len(links) <= c.maxLinksPerPage {
+		return links
+	}
+	c.metrics.Incr(MetricLinksSuppressed, int64(len(links)-c.maxLinksPerPage))
+	if c.linkSelection == LinkSelectionRandom {
+		sampled := append([]T(nil), links...)
+		rand.Shuffle(len(sampled), func(i, j int) { sampled[i], sampled[j] = sampled[j], sampled[i] })
+		return sampled[:c.maxLinksPerPage]
+	}
+	return links[:c.maxLinksPerPage]
+}
+
+// frontierKey returns the queue new links should go to: ingress while it is
+// under the cap, otherwise the overflow list, or "" to drop them. The queue
+// length is checked once per page rather than per link.
+func (c *Crawler) frontierKey(ctx context.Context) string {
+	if c.frontierCap <= 0 {
+		return c.myceliumIngressKey
+	}
+	size, err := c.cache.IngressQueueSize(ctx, c.myceliumIngressKey)
+	if err != nil || size < c.frontierCap {
+		return c.myceliumIngressKey
+	}
+	return c.overflowKey
+}
+
+// countFrontier records where a link went when the frontier was full.
+func (c *Crawler) countFrontier(key string) {
+	switch key {
+	case c.myceliumIngressKey:
+	case "":
+		c.metrics.Incr(MetricFrontierDropped, 1)
+	default:
+		c.metrics.Incr(MetricFrontierOverflowed, 1)
+	}
+}
+
+// DrainOverflow moves links from the overflow list back to ingress while it
+// is below the frontier cap and returns how many were moved.
+func (c *Crawler) DrainOverflow(ctx context.Context) (int64, error) {
+	if c.frontierCap <= 0 || c.overflowKey == "" {
+		return 0, nil
+	}
+	mover, ok := c.cache.(QueueMover)
+	if !ok {
+		return 0, nil
+	}
+	size, err := c.cache.IngressQueueSize(ctx, c.myceliumIngressKey)
+	if err != nil {
+		return 0, err
+	}
+	room := int64(c.frontierCap - size)
+	if room <= 0 {
+		return 0, nil
+	}
+	return mover.MoveItems(ctx, c.overflowKey, c.myceliumIngressKey, room)
+}
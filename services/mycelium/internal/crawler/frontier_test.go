@@ -0,0 +1,141 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// linksServer serves a page linking to n pages on the same host.
+func linksServer(t *testing.T, n int) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		var body strings.Builder
+		for i := range n {
+			fmt.Fprintf(&body, `<a href="/%d">%d</a>`, i, i)
+		}
+		fmt.Fprintf(w, "<html><body>%s</body></html>", body.String())
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCapLinks(t *testing.T) {
+	links := []string{"a", "b", "c", "d", "e"}
+
+	metrics := NewCounterMetrics()
+	c := NewCrawler(newMemCache(), nil, WithMetrics(metrics), WithMaxLinksPerPage(3, LinkSelectionDocument))
+	if got := capLinks(c, links); !slices.Equal(got, []string{"a", "b", "c"}) {
+		t.Errorf("document selection kept %v, want the first three", got)
+	}
+	if n := metrics.Get(MetricLinksSuppressed); n != 2 {
+		t.Errorf("%d links counted as suppressed, want 2", n)
+	}
+
+	c = NewCrawler(newMemCache(), nil, WithMaxLinksPerPage(3, LinkSelectionRandom))
+	got := capLinks(c, links)
+	if len(got) != 3 {
+		t.Fatalf("random selection kept %d links, want 3", len(got))
+	}
+	for _, link := range got {
+		if !slices.Contains(links, link) {
+			t.Errorf("random selection invented link %q", link)
+		}
+	}
+	if !slices.Equal(links, []string{"a", "b", "c", "d", "e"}) {
+		t.Errorf("random selection reordered the page's links: %v", links)
+	}
+
+	c = NewCrawler(newMemCache(), nil)
+	if got := capLinks(c, links); len(got) != len(links) {
+		t.Errorf("without a limit kept %d links, want all", len(got))
+	}
+}
+
+func TestMaxLinksPerPage(t *testing.T) {
+	srv := linksServer(t, 10)
+	cache := newMemCache()
+	crawlOnePage(t, cache, nil, srv.URL+"/", WithMaxLinksPerPage(4, LinkSelectionDocument))
+
+	want := []string{srv.URL + "/0", srv.URL + "/1", srv.URL + "/2", srv.URL + "/3"}
+	if got := queuedLocations(t, cache); !slices.Equal(got, want) {
+		t.Errorf("queued %v, want the first four links", got)
+	}
+}
+
+// pageLinking returns a page linking to n urls on host.
+func pageLinking(t *testing.T, host string, n int) *Page {
+	t.Helper()
+	page := &Page{}
+	for i := range n {
+		page.Links = append(page.Links, *mustParse(t, fmt.Sprintf("https://%s/%d", host, i)))
+	}
+	return page
+}
+
+func TestFrontierCapSpillsToOverflow(t *testing.T) {
+	ctx := context.Background()
+	cache := newMemCache()
+	metrics := NewCounterMetrics()
+	c := NewCrawler(cache, nil, quiet, WithMyceliumIngressKey("ingress"), WithMetrics(metrics), WithFrontierCap(2, "overflow"))
+	parent := IngressItem{Location: "https://example.com/"}
+
+	c.queueLinks(ctx, pageLinking(t, "a.test", 2), parent)
+	c.queueLinks(ctx, pageLinking(t, "b.test", 3), parent)
+
+	if n := len(cache.queue("ingress")); n != 2 {
+		t.Errorf("%d links in ingress, want the first page's 2", n)
+	}
+	if n := len(cache.queue("overflow")); n != 3 {
+		t.Errorf("%d links in overflow, want the second page's 3", n)
+	}
+	if queued, spilled := metrics.Get(MetricLinksQueued), metrics.Get(MetricFrontierOverflowed); queued != 2 || spilled != 3 {
+		t.Errorf("counted %d queued and %d overflowed, want 2 and 3", queued, spilled)
+	}
+
+	dropping := NewCrawler(cache, nil, quiet, WithMyceliumIngressKey("ingress"), WithMetrics(metrics), WithFrontierCap(2, ""))
+	dropping.queueLinks(ctx, pageLinking(t, "c.test", 4), parent)
+	if n := len(cache.queue("ingress")) + len(cache.queue("overflow")); n != 5 {
+		t.Errorf("%d links queued after dropping, want none added", n)
+	}
+	if dropped := metrics.Get(MetricFrontierDropped); dropped != 4 {
+		t.Errorf("counted %d dropped, want 4", dropped)
+	}
+}
+
+func TestDrainOverflow(t *testing.T) {
+	ctx := context.Background()
+	cache := newMemCache()
+	c := NewCrawler(cache, nil, quiet, WithMyceliumIngressKey("ingress"), WithFrontierCap(3, "overflow"))
+	parent := IngressItem{Location: "https://example.com/"}
+	c.queueLinks(ctx, pageLinking(t, "a.test", 3), parent)
+	c.queueLinks(ctx, pageLinking(t, "b.test", 3), parent)
+
+	// nothing moves while the frontier is full
+	if moved, err := c.DrainOverflow(ctx); err != nil || moved != 0 {
+		t.Fatalf("drained %d, %v with a full frontier; want 0", moved, err)
+	}
+
+	// crawling two items makes room for two overflow links, oldest first
+	cache.PopFromMyceliumIngress(ctx, "ingress")
+	cache.PopFromMyceliumIngress(ctx, "ingress")
+	moved, err := c.DrainOverflow(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != 2 {
+		t.Errorf("drained %d, want 2", moved)
+	}
+	want := []string{"https://a.test/2", "https://b.test/0", "https://b.test/1"}
+	if got := queuedLocations(t, cache); !slices.Equal(got, want) {
+		t.Errorf("ingress holds %v, want %v", got, want)
+	}
+	if n := len(cache.queue("overflow")); n != 1 {
+		t.Errorf("%d links left in overflow, want 1", n)
+	}
+}
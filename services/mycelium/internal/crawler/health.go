@@ -0,0 +1,151 @@
+package crawler
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"time"
+
+	"mycelium/internal/filter"
+)
+
+const (
+	OutcomeSuccess   = "success"
+	OutcomeRetryable = "retryable"
+	OutcomePermanent = "permanent"
+)
+
+// DomainHealthCache is implemented by caches that can track per-domain fetch
+// outcomes and keep an expiring blacklist. It is required by
+// WithDomainErrorBudget.
+type DomainHealthCache interface {
+	RecordDomainOutcome(ctx context.Context, domain string, outcome string, now time.Time, window time.Duration) (map[string]int64, error)
+	AddToAutoBlacklist(ctx context.Context, key string, domain string, until time.Time) error
+	IsAutoBlacklisted(ctx context.Context, key string, domain string, now time.Time) (bool, error)
+}
+
+// DomainErrorBudget auto-blacklists registrable domains whose fetches keep
+// failing. Once a domain has at least MinSamples outcomes within Window and
+// the share of failures reaches Threshold, it is added to the set at Key for
+// TTL.
+type DomainErrorBudget struct {
+	Key        string
+	Threshold  float64
+	MinSamples int64
+	Window     time.Duration
+	TTL        time.Duration
+}
+
+// WithDomainErrorBudget enables the auto blacklist. The crawler cache must
+// implement DomainHealthCache.
+func WithDomainErrorBudget(budget DomainErrorBudget) CrawlerOption {
+	return func(c *Crawler) {
+		c.errorBudget = &budget
+	}
+}
+
+// WithClock replaces time.Now for the domain error budget and recrawl
+// scheduling.
+func WithClock(now func() time.Time) CrawlerOption {
+	return func(c *Crawler) {
+		c.now = now
+	}
+}
+
+// classifyFetchError sorts a GetPage error into a domain outcome. Failures
+// that will not go away on retry are permanent. Pages skipped for their
+// content or size are not failures and report no outcome.
+func classifyFetchError(err error) string {
+	if errors.Is(err, ErrUnsupportedContentType) || errors.Is(err, ErrBodyTooLarge) {
+		return ""
+	}
+	if errors.Is(err, ErrBlockedByFilter) || errors.Is(err, ErrBlacklisted) {
+		// a redirect hop was refused, which is our doing, not the domain's
+		return ""
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		if statusErr.retryable() {
+			return OutcomeRetryable
+		}
+		return OutcomePermanent
+	}
+	if errors.Is(err, ErrPageTimeout) {
+		return OutcomeRetryable
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return OutcomePermanent
+	}
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) {
+		return OutcomePermanent
+	}
+	if errors.Is(err, ErrTooManyRedirects) || errors.Is(err, ErrRedirectLoop) {
+		return OutcomePermanent
+	}
+	return OutcomeRetryable
+}
+
+// recordOutcome feeds the domain error budget and blacklists the domain
+// once it is exhausted.
+func (c *Crawler) recordOutcome(ctx context.Context, host string, outcome string) {
+	if c.errorBudget == nil || outcome == "" {
+		return
+	}
+	health, ok := c.cache.(DomainHealthCache)
+	if !ok {
+		return
+	}
+
+	domain := filter.RegistrableDomain(host)
+	now := c.now()
+	counts, err := health.RecordDomainOutcome(ctx, domain, outcome, now, c.errorBudget.Window)
+	if err != nil {
+		c.log(ctx).Error("failed to record domain outcome", "domain", domain, "error", err)
+		return
+	}
+	if outcome == OutcomeSuccess {
+		return
+	}
+
+	failures := counts[OutcomeRetryable] + counts[OutcomePermanent]
+	total := failures + counts[OutcomeSuccess]
+	if total < c.errorBudget.MinSamples || float64(failures)/float64(total) < c.errorBudget.Threshold {
+		return
+	}
+
+	// failures still in flight when the domain was listed keep arriving;
+	// they must not extend its ttl or count it again
+	listed, err := health.IsAutoBlacklisted(ctx, c.errorBudget.Key, domain, now)
+	if err != nil {
+		c.log(ctx).Error("failed to check auto blacklist", "domain", domain, "error", err)
+		return
+	}
+	if listed {
+		return
+	}
+
+	until := now.Add(c.errorBudget.TTL)
+	if err := health.AddToAutoBlacklist(ctx, c.errorBudget.Key, domain, until); err != nil {
+		c.log(ctx).Error("failed to auto blacklist domain", "domain", domain, "error", err)
+		return
+	}
+	c.metrics.Incr(MetricDomainsAutoBlacklisted, 1)
+	c.log(ctx).Warn("domain exceeded error budget, blacklisted", "domain", domain,
+		"failures", failures, "samples", total, "until", until)
+}
+
+// autoBlacklisted reports whether host's domain is on the auto blacklist.
+func (c *Crawler) autoBlacklisted(ctx context.Context, host string) (bool, error) {
+	if c.errorBudget == nil {
+		return false, nil
+	}
+	health, ok := c.cache.(DomainHealthCache)
+	if !ok {
+		return false, nil
+	}
+	return health.IsAutoBlacklisted(ctx, c.errorBudget.Key, filter.RegistrableDomain(host), c.now())
+}
@@ -0,0 +1,173 @@
+package crawler
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"mycelium/internal/cache"
+)
+
+// fakeClock is a settable time source for WithClock.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+func newFakeClock() *fakeClock               { return &fakeClock{t: time.Unix(1_700_000_040, 0)} }
+
+// newRedisCache connects a cache to a fresh miniredis server.
+func newRedisCache(t *testing.T) (*cache.CrawlerCache, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rc, err := cache.NewRedisCache(context.Background(), &cache.CrawlerCacheOptions{Addr: mr.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rc.Close() })
+	return rc, mr
+}
+
+func healthCrawler(t *testing.T, clock *fakeClock) *Crawler {
+	t.Helper()
+	rc, _ := newRedisCache(t)
+	return NewCrawler(rc, nil, quiet, WithClock(clock.now), WithMetrics(NewCounterMetrics()), WithDomainErrorBudget(DomainErrorBudget{
+		Key:        "autoblacklist",
+		Threshold:  0.5,
+		MinSamples: 4,
+		Window:     time.Minute,
+		TTL:        10 * time.Minute,
+	}))
+}
+
+func assertAutoBlacklisted(t *testing.T, c *Crawler, host string, want bool) {
+	t.Helper()
+	got, err := c.autoBlacklisted(context.Background(), host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("%s auto blacklisted = %t, want %t", host, got, want)
+	}
+}
+
+func TestErrorBudgetNeedsMinimumSamples(t *testing.T) {
+	clock := newFakeClock()
+	c := healthCrawler(t, clock)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		c.recordOutcome(ctx, "www.bad.test", OutcomeRetryable)
+	}
+	assertAutoBlacklisted(t, c, "bad.test", false)
+
+	c.recordOutcome(ctx, "api.bad.test", OutcomePermanent)
+	if n := c.metrics.(*CounterMetrics).Get(MetricDomainsAutoBlacklisted); n != 1 {
+		t.Errorf("%s = %d, want 1", MetricDomainsAutoBlacklisted, n)
+	}
+	// the whole registrable domain is blacklisted
+	assertAutoBlacklisted(t, c, "bad.test", true)
+	assertAutoBlacklisted(t, c, "cdn.bad.test", true)
+	assertAutoBlacklisted(t, c, "good.test", false)
+}
+
+func TestErrorBudgetThreshold(t *testing.T) {
+	clock := newFakeClock()
+	c := healthCrawler(t, clock)
+	ctx := context.Background()
+
+	for _, outcome := range []string{OutcomeSuccess, OutcomeSuccess, OutcomeSuccess, OutcomeRetryable, OutcomeRetryable} {
+		c.recordOutcome(ctx, "flaky.test", outcome)
+	}
+	// 2 of 5 failed, under the threshold
+	assertAutoBlacklisted(t, c, "flaky.test", false)
+
+	c.recordOutcome(ctx, "flaky.test", OutcomeRetryable)
+	assertAutoBlacklisted(t, c, "flaky.test", true)
+}
+
+func TestErrorBudgetTTL(t *testing.T) {
+	clock := newFakeClock()
+	c := healthCrawler(t, clock)
+	ctx := context.Background()
+
+	for i := 0; i < 4; i++ {
+		c.recordOutcome(ctx, "bad.test", OutcomeRetryable)
+	}
+	assertAutoBlacklisted(t, c, "bad.test", true)
+
+	clock.advance(10*time.Minute - time.Second)
+	assertAutoBlacklisted(t, c, "bad.test", true)
+	clock.advance(time.Second)
+	assertAutoBlacklisted(t, c, "bad.test", false)
+}
+
+func TestErrorBudgetListsDomainOnce(t *testing.T) {
+	clock := newFakeClock()
+	c := healthCrawler(t, clock)
+	ctx := context.Background()
+
+	for i := 0; i < 4; i++ {
+		c.recordOutcome(ctx, "bad.test", OutcomeRetryable)
+	}
+	// failures after the domain was listed leave its ttl alone
+	clock.advance(5 * time.Minute)
+	for i := 0; i < 4; i++ {
+		c.recordOutcome(ctx, "bad.test", OutcomeRetryable)
+	}
+	if n := c.metrics.(*CounterMetrics).Get(MetricDomainsAutoBlacklisted); n != 1 {
+		t.Errorf("%s = %d, want 1", MetricDomainsAutoBlacklisted, n)
+	}
+	clock.advance(5 * time.Minute)
+	assertAutoBlacklisted(t, c, "bad.test", false)
+}
+
+func TestErrorBudgetWindowSlides(t *testing.T) {
+	clock := newFakeClock()
+	c := healthCrawler(t, clock)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		c.recordOutcome(ctx, "bad.test", OutcomeRetryable)
+	}
+	// two windows later the old failures no longer count
+	clock.advance(2 * time.Minute)
+	c.recordOutcome(ctx, "bad.test", OutcomeRetryable)
+	assertAutoBlacklisted(t, c, "bad.test", false)
+}
+
+func TestErrorBudgetDisabled(t *testing.T) {
+	c := NewCrawler(newMemCache(), nil, quiet)
+	c.recordOutcome(context.Background(), "bad.test", OutcomePermanent)
+	assertAutoBlacklisted(t, c, "bad.test", false)
+
+	// a cache without domain health support disables the budget
+	c = NewCrawler(newMemCache(), nil, quiet, WithDomainErrorBudget(DomainErrorBudget{Key: "autoblacklist", MinSamples: 1, Threshold: 0.1}))
+	c.recordOutcome(context.Background(), "bad.test", OutcomePermanent)
+	assertAutoBlacklisted(t, c, "bad.test", false)
+}
+
+func TestClassifyFetchError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("page content was not type 'text': %w", ErrUnsupportedContentType), ""},
+		{&net.DNSError{Err: "no such host", Name: "bad.test", IsNotFound: true}, OutcomePermanent},
+		{&net.DNSError{Err: "server misbehaving", Name: "bad.test", IsTemporary: true}, OutcomeRetryable},
+		{fmt.Errorf("failed to get: %w", &tls.CertificateVerificationError{Err: errors.New("expired")}), OutcomePermanent},
+		{fmt.Errorf(`Get "https://loop.test/": %w`, ErrTooManyRedirects), OutcomePermanent},
+		{fmt.Errorf(`Get "https://loop.test/b": %w`, ErrRedirectLoop), OutcomePermanent},
+		{fmt.Errorf("redirect to https://blocked.test/: %w", ErrBlockedByFilter), ""},
+		{errors.New("connection reset by peer"), OutcomeRetryable},
+	}
+	for _, tt := range tests {
+		if got := classifyFetchError(tt.err); got != tt.want {
+			t.Errorf("classifyFetchError(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
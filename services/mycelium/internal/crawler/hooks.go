@@ -0,0 +1,60 @@
+package crawler
+
+// Hooks let embedders react to crawl events without changing the loop. They
+// run synchronously on the crawling goroutine, so they must be fast and safe
+// for concurrent use when several workers share a Crawler. Any field may be
+// nil.
+type Hooks struct {
+	// OnPageFetched is called for every page fetched successfully, before
+	// page filters run.
+	OnPageFetched func(page *Page)
+	// OnFetchError is called when a fetch fails. willRetry reports whether
+	// the item was requeued.
+	OnFetchError func(url string, err error, willRetry bool)
+	// OnLinkQueued is called for every link pushed to a queue, either from
+	// a crawled page or from a fungicide verdict.
+	OnLinkQueued func(parent string, child string)
+	// OnItemDropped is called when an item is given up on, e.g. blocked,
+	// already visited or out of retries, and when its page is dropped by a
+	// page filter.
+	OnItemDropped func(item IngressItem, reason string)
+	// OnLinkVerified is called with the result of every external link
+	// check made with WithExternalLinkVerification.
+	OnLinkVerified func(v *LinkVerification)
+}
+
+func WithHooks(hooks Hooks) CrawlerOption {
+	return func(c *Crawler) {
+		c.hooks = hooks
+	}
+}
+
+func (h *Hooks) pageFetched(page *Page) {
+	if h.OnPageFetched != nil {
+		h.OnPageFetched(page)
+	}
+}
+
+func (h *Hooks) fetchError(url string, err error, willRetry bool) {
+	if h.OnFetchError != nil {
+		h.OnFetchError(url, err, willRetry)
+	}
+}
+
+func (h *Hooks) linkQueued(parent string, child string) {
+	if h.OnLinkQueued != nil {
+		h.OnLinkQueued(parent, child)
+	}
+}
+
+func (h *Hooks) linkVerified(v *LinkVerification) {
+	if h.OnLinkVerified != nil {
+		h.OnLinkVerified(v)
+	}
+}
+
+func (h *Hooks) itemDropped(item IngressItem, reason string) {
+	if h.OnItemDropped != nil {
+		h.OnItemDropped(item, reason)
+	}
+}
@@ -0,0 +1,87 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHooksOrdering(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<html><body><a href="http://%s/next">next</a></body></html>`, r.Host)
+	}))
+	defer srv.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var mu sync.Mutex
+	var events []string
+	record := func(format string, args ...any) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, fmt.Sprintf(format, args...))
+	}
+	hooks := Hooks{
+		OnPageFetched: func(page *Page) { record("fetched %s", page.Location) },
+		OnFetchError: func(url string, err error, willRetry bool) {
+			record("fetch error %s retry=%t", url, willRetry)
+			// the last item has been dealt with
+			cancel()
+		},
+		OnLinkQueued:  func(parent string, child string) { record("queued %s -> %s", parent, child) },
+		OnItemDropped: func(item IngressItem, reason string) { record("dropped %s: %s", item.Location, reason) },
+	}
+
+	cache := newMemCache()
+	c := NewCrawler(cache, nil, quiet, WithMyceliumIngressKey("ingress"), WithMaxRetries(0), WithHooks(hooks))
+	visited := srv.URL + "/visited"
+	cache.Visit(context.Background(), visited)
+	for _, location := range []string{visited, srv.URL + "/", down.URL + "/"} {
+		if err := c.Enqueue(context.Background(), IngressItem{Location: location}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := make(chan error)
+	go func() { done <- c.Crawl(ctx) }()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		cancel()
+		<-done
+		t.Fatal("timed out waiting for the crawl")
+	}
+
+	want := []string{
+		"dropped " + visited + ": visited",
+		"fetched " + srv.URL + "/",
+		"queued " + srv.URL + "/ -> " + srv.URL + "/next",
+		"dropped " + down.URL + "/: retries exhausted",
+		"fetch error " + down.URL + "/ retry=false",
+	}
+	if !slices.Equal(events, want) {
+		t.Errorf("events:\n%q\nwant:\n%q", events, want)
+	}
+}
+
+func TestNilHooksAreSkipped(t *testing.T) {
+	var fetched int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><body>page</body></html>")
+	}))
+	defer srv.Close()
+
+	crawlOnePage(t, newMemCache(), nil, srv.URL+"/", WithHooks(Hooks{OnPageFetched: func(*Page) { fetched++ }}))
+	if fetched != 1 {
+		t.Errorf("OnPageFetched called %d times, want 1", fetched)
+	}
+}
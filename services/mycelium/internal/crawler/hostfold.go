@@ -0,0 +1,185 @@
+package crawler
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"mycelium/internal/filter"
+)
+
+// HostFoldCache is implemented by caches that can share which variant of a
+// domain, such as https://www.example.com or http://example.com, the domain
+// canonicalizes to. It is required by WithHostFolding.
+type HostFoldCache interface {
+	HostFold(ctx context.Context, domain string) (string, error)
+	SetHostFold(ctx context.Context, domain string, canonical string, ttl time.Duration) (string, error)
+}
+
+// WithHostFolding rewrites urls on the apex and www hosts of a registrable
+// domain to the scheme and host the domain canonicalizes to, so sites
+// serving the same pages on both are crawled once. The variant is learned on
+// first contact from the redirect or rel=canonical of the first page fetched
+// and shared through the cache for ttl. A non-positive ttl disables folding.
+func WithHostFolding(ttl time.Duration) CrawlerOption {
+	return func(c *Crawler) {
+		c.hostFoldTTL = ttl
+	}
+}
+
+// hostFolds holds the variants read from or written to the cache. Entries
+// are reread after hostFoldRefresh so expiries and variants learned by other
+// crawlers are picked up; an empty canonical records that none was set.
+type hostFolds struct {
+	mu       sync.Mutex
+	entries  map[string]hostFoldEntry
+	capacity int
+}
+
+type hostFoldEntry struct {
+	scheme  string
+	host    string
+	expires time.Time
+}
+
+func newHostFolds(capacity int) *hostFolds {
+	return &hostFolds{entries: map[string]hostFoldEntry{}, capacity: capacity}
+}
+
+func (h *hostFolds) get(domain string, now time.Time) (hostFoldEntry, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	entry, ok := h.entries[domain]
+	if !ok || now.After(entry.expires) {
+		return hostFoldEntry{}, false
+	}
+	return entry, true
+}
+
+func (h *hostFolds) set(domain string, entry hostFoldEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.entries) >= h.capacity {
+		clear(h.entries)
+	}
+	h.entries[domain] = entry
+}
+
+// foldDomain returns the registrable domain of loc if loc is on its apex or
+// www host over http(s) without an explicit port, the only urls folded.
+func foldDomain(loc *url.URL) (string, bool) {
+	if loc == nil || (loc.Scheme != "http" && loc.Scheme != "https") || loc.Port() != "" {
+		return "", false
+	}
+	host := strings.ToLower(loc.Hostname())
+	domain := filter.RegistrableDomain(host)
+	if domain == "" || (host != domain && host != "www."+domain) {
+		return "", false
+	}
+	return domain, true
+}
+
+func (c *Crawler) hostFoldCache() (HostFoldCache, bool) {
+	if c.hostFolds == nil {
+		return nil, false
+	}
+	folds, ok := c.cache.(HostFoldCache)
+	return folds, ok
+}
+
+// foldHost rewrites loc to the variant its domain canonicalizes to, going by
+// the variants loaded so far.
+func (c *Crawler) foldHost(loc *url.URL) *url.URL {
+	if c.hostFolds == nil {
+		return loc
+	}
+	domain, ok := foldDomain(loc)
+	if !ok {
+		return loc
+	}
+	entry, ok := c.hostFolds.get(domain, c.now())
+	if !ok || entry.host == "" || (entry.scheme == loc.Scheme && entry.host == loc.Host) {
+		return loc
+	}
+	folded := *loc
+	folded.Scheme = entry.scheme
+	folded.Host = entry.host
+	return &folded
+}
+
+// loadHostFold makes the variant of loc's domain available to foldHost,
+// reading it from the cache unless it was read recently. Failing to reach
+// the cache leaves urls unfolded.
+func (c *Crawler) loadHostFold(ctx context.Context, loc *url.URL) {
+	folds, ok := c.hostFoldCache()
+	if !ok {
+		return
+	}
+	domain, ok := foldDomain(loc)
+	if !ok {
+		return
+	}
+	if _, ok := c.hostFolds.get(domain, c.now()); ok {
+		return
+	}
+	canonical, err := folds.HostFold(ctx, domain)
+	if err != nil {
+		c.log(ctx).Error("failed to read host fold", "domain", domain, "error", err)
+		return
+	}
+	c.storeHostFold(domain, canonical)
+}
+
+// learnHostFold records the variant the domain of requested canonicalizes
+// to when none is known yet, preferring where the page redirected to, then
+// its rel=canonical, then requested itself. Links of the page are folded to
+// the variant in effect.
+func (c *Crawler) learnHostFold(ctx context.Context, requested *url.URL, page *Page) {
+	folds, ok := c.hostFoldCache()
+	if !ok {
+		return
+	}
+	domain, ok := foldDomain(requested)
+	if !ok {
+		return
+	}
+	if entry, ok := c.hostFolds.get(domain, c.now()); ok && entry.host != "" {
+		return
+	}
+
+	variant := requested
+	if redirected, ok := foldDomain(page.redirectedTo); ok && redirected == domain {
+		variant = page.redirectedTo
+	} else if canonical, err := page.Location.Parse(page.Canonical); err == nil && page.Canonical != "" {
+		if d, ok := foldDomain(canonical); ok && d == domain {
+			variant = canonical
+		}
+	}
+
+	learned := variant.Scheme + "://" + strings.ToLower(variant.Host)
+	inEffect, err := folds.SetHostFold(ctx, domain, learned, c.hostFoldTTL)
+	if err != nil {
+		c.log(ctx).Error("failed to store host fold", "domain", domain, "error", err)
+		return
+	}
+	if inEffect == learned {
+		c.log(ctx).Info("learned host fold", "domain", domain, "canonical", learned)
+		c.metrics.Incr(MetricHostFoldsLearned, 1)
+	}
+	c.storeHostFold(domain, inEffect)
+
+	for i := range page.Links {
+		page.Links[i] = *c.foldHost(&page.Links[i])
+	}
+}
+
+func (c *Crawler) storeHostFold(domain string, canonical string) {
+	entry := hostFoldEntry{expires: c.now().Add(min(c.hostFoldTTL, hostFoldRefresh))}
+	if u, err := url.Parse(canonical); err == nil && canonical != "" {
+		entry.scheme = u.Scheme
+		entry.host = u.Host
+	}
+	c.hostFolds.set(domain, entry)
+}
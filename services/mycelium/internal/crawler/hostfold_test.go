@@ -0,0 +1,175 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"mycelium/internal/filter"
+)
+
+// foldingSites serves example.com, which redirects www to the apex,
+// example.org, which redirects the apex to www, and example.net, which
+// serves both but names https://www.example.net as canonical. Every page
+// links to /a on www and /b on the apex. The returned client connects to it
+// whatever the host.
+func foldingSites(t *testing.T) *http.Client {
+	t.Helper()
+	srv := httptest.NewServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Host {
+		case "www.example.com":
+			http.Redirect(w, r, "http://example.com"+r.URL.Path, http.StatusMovedPermanently)
+			return
+		case "example.org":
+			http.Redirect(w, r, "http://www.example.org"+r.URL.Path, http.StatusMovedPermanently)
+			return
+		}
+		domain := strings.TrimPrefix(r.Host, "www.")
+		fmt.Fprintf(w, `<html><head>`)
+		if domain == "example.net" {
+			fmt.Fprint(w, `<link rel="canonical" href="https://www.example.net/">`)
+		}
+		fmt.Fprintf(w, `</head><body><a href="http://www.%[1]s/a">a</a><a href="http://%[1]s/b">b</a></body></html>`, domain)
+	}))
+	t.Cleanup(srv.Close)
+	dialer := &net.Dialer{}
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network string, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, srv.Listener.Addr().String())
+		},
+	}}
+}
+
+func TestHostFolding(t *testing.T) {
+	tests := []struct {
+		name      string
+		start     string
+		other     string
+		wantFold  string
+		wantLinks []string
+	}{
+		{name: "www redirects to apex", start: "http://www.example.com/", other: "http://www.example.com/c",
+			wantFold: "http://example.com", wantLinks: []string{"http://example.com/a", "http://example.com/b"}},
+		{name: "apex redirects to www", start: "http://example.org/", other: "http://example.org/c",
+			wantFold: "http://www.example.org", wantLinks: []string{"http://www.example.org/a", "http://www.example.org/b"}},
+		{name: "rel canonical", start: "http://example.net/", other: "http://example.net/c",
+			wantFold: "https://www.example.net", wantLinks: []string{"https://www.example.net/a", "https://www.example.net/b"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rc, mr := newRedisCache(t)
+			clock := newFakeClock()
+			c := NewCrawler(rc, nil, quiet, WithHttpClient(foldingSites(t)), WithClock(clock.now),
+				WithMyceliumIngressKey("ingress"), WithLinkQueueingMode(LinkQueueingAlways), WithHostFolding(time.Hour))
+			ctx := context.Background()
+			if err := c.Enqueue(ctx, IngressItem{Location: test.start}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := c.CrawlOnce(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			domain, _ := foldDomain(mustParse(t, test.start))
+			if got, _ := mr.Get("hostfold:" + domain); got != test.wantFold {
+				t.Errorf("recorded fold %q, want %q", got, test.wantFold)
+			}
+			if ttl := mr.TTL("hostfold:" + domain); ttl != time.Hour {
+				t.Errorf("fold expires in %s, want 1h", ttl)
+			}
+			if got := ingressLocations(t, mr); !slices.Equal(got, test.wantLinks) {
+				t.Errorf("queued %q, want %q", got, test.wantLinks)
+			}
+
+			// later urls of the domain are folded before they are queued
+			mr.Del("ingress")
+			if err := c.Enqueue(ctx, IngressItem{Location: test.other}); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := ingressLocations(t, mr), []string{test.wantFold + "/c"}; !slices.Equal(got, want) {
+				t.Errorf("queued %q, want %q", got, want)
+			}
+
+			// another crawler picks up the fold from the cache
+			fresh := NewCrawler(rc, nil, quiet, WithClock(clock.now), WithMyceliumIngressKey("ingress"), WithHostFolding(time.Hour))
+			mr.Del("ingress")
+			if err := fresh.Enqueue(ctx, IngressItem{Location: test.other}); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := ingressLocations(t, mr), []string{test.wantFold + "/c"}; !slices.Equal(got, want) {
+				t.Errorf("another crawler queued %q, want %q", got, want)
+			}
+
+			// once the fold expires urls are left alone until it is learned again
+			mr.FastForward(time.Hour + time.Second)
+			clock.advance(hostFoldRefresh + time.Second)
+			mr.Del("ingress")
+			if err := c.Enqueue(ctx, IngressItem{Location: test.other}); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := ingressLocations(t, mr), []string{test.other}; !slices.Equal(got, want) {
+				t.Errorf("after expiry queued %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestFoldDomain(t *testing.T) {
+	for raw, want := range map[string]string{
+		"https://example.com/":         "example.com",
+		"http://WWW.Example.com/a":     "example.com",
+		"https://shop.example.com/":    "",
+		"https://example.com:8443/":    "",
+		"ftp://example.com/":           "",
+		"https://www.example.co.uk/":   "example.co.uk",
+		"https://www.www.example.com/": "",
+	} {
+		got, ok := foldDomain(mustParse(t, raw))
+		if got != want || ok != (want != "") {
+			t.Errorf("foldDomain(%s) = %q, %t, want %q", raw, got, ok, want)
+		}
+	}
+}
+
+// ingressLocations returns the locations queued under "ingress".
+func ingressLocations(t *testing.T, mr *miniredis.Miniredis) []string {
+	t.Helper()
+	items, _ := mr.List("ingress")
+	var locations []string
+	for _, itemJSON := range items {
+		var item IngressItem
+		if err := json.Unmarshal([]byte(itemJSON), &item); err != nil {
+			t.Fatal(err)
+		}
+		locations = append(locations, item.Location)
+	}
+	return locations
+}
+
+func TestQueueLinksFoldsAndRewrites(t *testing.T) {
+	rc, mr := newRedisCache(t)
+	// learned by another crawler after this page was fetched
+	mr.Set("hostfold:example.org", "http://www.example.org")
+	c := NewCrawler(rc, nil, quiet, WithMyceliumIngressKey("ingress"), WithHostFolding(time.Hour),
+		WithUrlRewriters([]UrlRewriter{filter.NewQueryParamStripper(filter.DefaultStrippedParams)}))
+	page := &Page{Links: []url.URL{
+		*mustParse(t, "http://example.org/a"),
+		*mustParse(t, "http://www.example.org/a?utm_source=x"),
+		*mustParse(t, "http://example.org/b"),
+	}}
+
+	c.queueLinks(context.Background(), page, IngressItem{Location: "http://example.org/"})
+
+	want := []string{"http://www.example.org/a", "http://www.example.org/b"}
+	if got := ingressLocations(t, mr); !slices.Equal(got, want) {
+		t.Errorf("queued %q, want %q", got, want)
+	}
+}
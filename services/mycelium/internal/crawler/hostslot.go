@@ -0,0 +1,68 @@
+package crawler
+
+import (
+	"context"
+	"time"
+
+	"mycelium/internal/filter"
+)
+
+// HostSlotCache is implemented by caches that can hand out a fleet wide
+// limited number of concurrent request slots per host. It is required by
+// WithHostSlots.
+type HostSlotCache interface {
+	AcquireHostSlot(ctx context.Context, host string, slots int, ttl time.Duration) (slot int, token string, ok bool, err error)
+	ReleaseHostSlot(ctx context.Context, host string, slot int, token string) error
+}
+
+// WithHostSlots allows at most slots requests in flight to any host across
+// every crawler sharing the cache. Items whose host is busy are requeued. A
+// slot that is never released expires after ttl, which must outlast the
+// slowest fetch; zero uses the request timeout plus a margin.
+func WithHostSlots(slots int, ttl time.Duration) CrawlerOption {
+	return func(c *Crawler) {
+		c.hostSlots = slots
+		c.hostSlotTTL = ttl
+	}
+}
+
+// acquireHostSlot returns false when the host has no free slot. Domains
+// with a politeness profile concurrency share that many slots across their
+// hosts instead. The returned release func is always safe to call,
+// including more than once. Failing to reach the cache lets the fetch
+// through.
+func (c *Crawler) acquireHostSlot(ctx context.Context, host string) (release func(), ok bool) {
+	noop := func() {}
+	limit := c.hostSlots
+	if profile := c.politeness.profileFor(host); profile != nil && profile.Concurrency > 0 {
+		host = filter.RegistrableDomain(host)
+		limit = profile.Concurrency
+	}
+	if limit <= 0 {
+		return noop, true
+	}
+	slots, supported := c.cache.(HostSlotCache)
+	if !supported {
+		return noop, true
+	}
+
+	slot, token, acquired, err := slots.AcquireHostSlot(ctx, host, limit, c.hostSlotTTL)
+	if err != nil {
+		c.log(ctx).Error("failed to acquire host slot", "host", host, "error", err)
+		return noop, true
+	}
+	if !acquired {
+		return noop, false
+	}
+
+	released := false
+	return func() {
+		if released {
+			return
+		}
+		released = true
+		if err := slots.ReleaseHostSlot(ctx, host, slot, token); err != nil {
+			c.log(ctx).Error("failed to release host slot", "host", host, "error", err)
+		}
+	}, true
+}
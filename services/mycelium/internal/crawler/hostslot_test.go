@@ -0,0 +1,151 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAcquireHostSlotConcurrently(t *testing.T) {
+	const (
+		workers = 32
+		slots   = 3
+	)
+	rc, _ := newRedisCache(t)
+
+	var acquired atomic.Int64
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, _, ok, err := rc.AcquireHostSlot(context.Background(), "busy.test", slots, time.Minute)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if ok {
+				acquired.Add(1)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if n := acquired.Load(); n != slots {
+		t.Errorf("%d workers acquired a slot, want %d", n, slots)
+	}
+}
+
+func TestReleaseHostSlotFreesSlot(t *testing.T) {
+	rc, _ := newRedisCache(t)
+	ctx := context.Background()
+
+	slot, token, ok, err := rc.AcquireHostSlot(ctx, "busy.test", 1, time.Minute)
+	if err != nil || !ok {
+		t.Fatalf("acquire = %v, %v", ok, err)
+	}
+	if _, _, ok, _ := rc.AcquireHostSlot(ctx, "busy.test", 1, time.Minute); ok {
+		t.Fatal("acquired a slot that was taken")
+	}
+	if err := rc.ReleaseHostSlot(ctx, "busy.test", slot, token); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok, _ := rc.AcquireHostSlot(ctx, "busy.test", 1, time.Minute); !ok {
+		t.Error("released slot was not free")
+	}
+}
+
+func TestReleaseExpiredHostSlot(t *testing.T) {
+	rc, mr := newRedisCache(t)
+	ctx := context.Background()
+
+	slot, stale, ok, err := rc.AcquireHostSlot(ctx, "busy.test", 1, time.Second)
+	if err != nil || !ok {
+		t.Fatalf("acquire = %v, %v", ok, err)
+	}
+	mr.FastForward(2 * time.Second)
+
+	_, token, ok, err := rc.AcquireHostSlot(ctx, "busy.test", 1, time.Minute)
+	if err != nil || !ok {
+		t.Fatalf("acquire after expiry = %v, %v", ok, err)
+	}
+	// the first holder finishes late, its release must not free the slot
+	// that now belongs to someone else
+	if err := rc.ReleaseHostSlot(ctx, "busy.test", slot, stale); err != nil {
+		t.Fatal(err)
+	}
+	if held, _ := mr.Get("hostslot:busy.test:0"); held != token {
+		t.Errorf("slot holds %q after a stale release, want %q", held, token)
+	}
+	if _, _, ok, _ := rc.AcquireHostSlot(ctx, "busy.test", 1, time.Minute); ok {
+		t.Error("stale release freed the slot")
+	}
+}
+
+func TestCrawlRequeuesBusyHost(t *testing.T) {
+	var fetches atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	rc, mr := newRedisCache(t)
+	// another crawler holds the only slot for the host
+	mr.Set("hostslot:"+u.Hostname()+":0", "elsewhere")
+	itemJSON, _ := json.Marshal(IngressItem{Location: srv.URL + "/"})
+	mr.RPush("ingress", string(itemJSON))
+
+	c := NewCrawler(rc, newMemStore(), quiet, WithMyceliumIngressKey("ingress"), WithHostSlots(1, time.Minute))
+	ctx, cancel := context.WithTimeout(context.Background(), 3*hostBusyDelay)
+	defer cancel()
+	c.Crawl(ctx)
+
+	if n := fetches.Load(); n != 0 {
+		t.Errorf("fetched a busy host %d times", n)
+	}
+	if queued := ingressItems(t, mr); len(queued) != 1 || queued[0].Location != srv.URL+"/" {
+		t.Errorf("ingress = %v, want the busy item requeued", queued)
+	}
+}
+
+func TestBusyHostDoesNotHoldUpOtherHosts(t *testing.T) {
+	srv := httptest.NewServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	busy := srv.URL + "/"
+	free := "http://localhost:" + u.Port() + "/"
+
+	rc, mr := newRedisCache(t)
+	mr.Set("hostslot:127.0.0.1:0", "elsewhere")
+	for _, location := range []string{busy, free} {
+		itemJSON, _ := json.Marshal(IngressItem{Location: location})
+		mr.RPush("ingress", string(itemJSON))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	metrics := countUntilFetch{NewCounterMetrics(), cancel}
+	c := NewCrawler(rc, newMemStore(), quiet, WithMyceliumIngressKey("ingress"), WithHostSlots(1, time.Minute), WithMetrics(metrics))
+	start := time.Now()
+	c.Crawl(ctx)
+
+	if n := metrics.Get(MetricPagesFetched); n != 1 {
+		t.Fatalf("fetched %d pages, want the free host's", n)
+	}
+	if elapsed := time.Since(start); elapsed >= hostBusyDelay {
+		t.Errorf("free host fetched after %s, want no wait for the busy one", elapsed)
+	}
+	if queued := ingressItems(t, mr); len(queued) != 1 || queued[0].Location != busy {
+		t.Errorf("ingress = %v, want the busy item requeued", queued)
+	}
+}
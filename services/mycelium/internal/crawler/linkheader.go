@@ -0,0 +1,208 @@
+package crawler
+
+import (
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Alternate is a rel="alternate" link, such as a translation of the page.
+type Alternate struct {
+	URL      string `json:"url"`
+	HrefLang string `json:"hreflang,omitempty"`
+	Type     string `json:"type,omitempty"`
+}
+
+// headerLink is one value of an HTTP Link header (RFC 8288). Parameter names
+// are lowercased; only the first occurrence of each is kept.
+type headerLink struct {
+	URL    string
+	Params map[string]string
+}
+
+// rels returns the link's relation types, lowercased.
+func (l *headerLink) rels() []string {
+	return strings.Fields(strings.ToLower(l.Params["rel"]))
+}
+
+// parseLinkHeader parses a Link header value holding any number of
+// comma-separated links. Malformed links are skipped.
+func parseLinkHeader(header string) []headerLink {
+	var links []headerLink
+	s := header
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return links
+		}
+		if s[0] != '<' {
+			s = skipLinkValue(s)
+			continue
+		}
+		end := strings.IndexByte(s, '>')
+		if end < 0 {
+			return links
+		}
+		link := headerLink{URL: strings.TrimSpace(s[1:end]), Params: map[string]string{}}
+		s = parseLinkParams(s[end+1:], link.Params)
+		links = append(links, link)
+	}
+}
+
+// parseLinkParams reads ";name=value" pairs into params and returns what is
+// left after them, starting at the comma before the next link if any.
+func parseLinkParams(s string, params map[string]string) string {
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" || s[0] == ',' {
+			return s
+		}
+		if s[0] != ';' {
+			return skipLinkValue(s)
+		}
+		s = s[1:]
+
+		i := strings.IndexAny(s, "=;,")
+		if i < 0 {
+			i = len(s)
+		}
+		name := strings.ToLower(strings.TrimSpace(s[:i]))
+		s = s[i:]
+		value := ""
+		if s != "" && s[0] == '=' {
+			s = strings.TrimLeft(s[1:], " \t")
+			if s != "" && s[0] == '"' {
+				value, s = consumeQuoted(s)
+			} else {
+				j := strings.IndexAny(s, ";,")
+				if j < 0 {
+					j = len(s)
+				}
+				value, s = strings.TrimSpace(s[:j]), s[j:]
+			}
+		}
+		if _, seen := params[name]; name != "" && !seen {
+			params[name] = value
+		}
+	}
+}
+
+// consumeQuoted reads the quoted string at the start of s, undoing
+// backslash escapes, and returns it with the rest of s.
+func consumeQuoted(s string) (string, string) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			}
+		case '"':
+			return b.String(), s[i+1:]
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), ""
+}
+
+// skipLinkValue drops everything up to the next comma outside of quotes and
+// angle brackets.
+func skipLinkValue(s string) string {
+	quoted, bracketed := false, false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"' && !bracketed:
+			quoted = !quoted
+		case c == '<' && !quoted:
+			bracketed = true
+		case c == '>' && !quoted:
+			bracketed = false
+		case c == ',' && !quoted && !bracketed:
+			return s[i:]
+		}
+	}
+	return ""
+}
+
+// parseHtmlLinkTag records <link rel="canonical"> and <link rel="alternate">.
+func (p *Page) parseHtmlLinkTag(t *html.Token) {
+	var rel, href, hreflang, mediaType string
+	for _, a := range t.Attr {
+		switch a.Key {
+		case "rel":
+			rel = a.Val
+		case "href":
+			href = strings.TrimSpace(a.Val)
+		case "hreflang":
+			hreflang = strings.TrimSpace(a.Val)
+		case "type":
+			mediaType = strings.TrimSpace(a.Val)
+		}
+	}
+	p.addLinkRel(strings.Fields(strings.ToLower(rel)), href, hreflang, mediaType)
+}
+
+func (p *Page) addLinkRel(rels []string, href string, hreflang string, mediaType string) {
+	if href == "" {
+		return
+	}
+	for _, rel := range rels {
+		switch rel {
+		case "canonical":
+			if p.Canonical != "" {
+				continue
+			}
+			if u, err := p.NormalizePageURL(href); err == nil {
+				p.Canonical = u.String()
+			}
+		case "alternate":
+			u, err := p.NormalizePageURL(href)
+			if err != nil {
+				continue
+			}
+			alt := Alternate{URL: u.String(), HrefLang: hreflang, Type: mediaType}
+			if !p.hasAlternate(alt) {
+				p.Alternates = append(p.Alternates, alt)
+			}
+		}
+	}
+}
+
+// hasAlternate reports whether the page already has an alternate for the
+// same language and type, or the same url when neither is set.
+func (p *Page) hasAlternate(alt Alternate) bool {
+	for _, existing := range p.Alternates {
+		if alt.HrefLang == "" && alt.Type == "" {
+			if existing.URL == alt.URL {
+				return true
+			}
+			continue
+		}
+		if strings.EqualFold(existing.HrefLang, alt.HrefLang) && strings.EqualFold(existing.Type, alt.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyHeaderHints fills the canonical url, alternates and language from the
+// Link and Content-Language headers. Values taken from the HTML are parsed
+// first and win on conflict.
+func (p *Page) applyHeaderHints(header http.Header) {
+	for _, value := range header.Values("Link") {
+		for _, link := range parseLinkHeader(value) {
+			p.addLinkRel(link.rels(), link.URL, link.Params["hreflang"], link.Params["type"])
+		}
+	}
+	if p.Lang == "" {
+		// a list means the content is meant for several audiences; the
+		// first is the best single guess
+		lang, _, _ := strings.Cut(header.Get("Content-Language"), ",")
+		p.Lang = strings.TrimSpace(lang)
+	}
+}
@@ -0,0 +1,117 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestParseLinkHeader(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []headerLink
+	}{
+		{"", nil},
+		{`<https://example.com/>; rel="canonical"`, []headerLink{
+			{URL: "https://example.com/", Params: map[string]string{"rel": "canonical"}},
+		}},
+		{`<https://example.com/de>; rel=alternate; hreflang=de, <https://example.com/fr>;rel="alternate";hreflang="fr"`, []headerLink{
+			{URL: "https://example.com/de", Params: map[string]string{"rel": "alternate", "hreflang": "de"}},
+			{URL: "https://example.com/fr", Params: map[string]string{"rel": "alternate", "hreflang": "fr"}},
+		}},
+		// commas and semicolons inside quotes and urls
+		{`<https://example.com/a,b;c>; title="x, \"y\"; z"; REL="Canonical Alternate"`, []headerLink{
+			{URL: "https://example.com/a,b;c", Params: map[string]string{"title": `x, "y"; z`, "rel": "Canonical Alternate"}},
+		}},
+		// the first of a repeated parameter wins, bare parameters are empty
+		{`</x>; rel=a; rel=b; crossorigin`, []headerLink{
+			{URL: "/x", Params: map[string]string{"rel": "a", "crossorigin": ""}},
+		}},
+		// malformed values are skipped up to the next link
+		{`garbage; rel="x,y", <https://example.com/ok>; rel=next`, []headerLink{
+			{URL: "https://example.com/ok", Params: map[string]string{"rel": "next"}},
+		}},
+		{`<https://example.com/unterminated`, nil},
+	}
+	for _, test := range tests {
+		if got := parseLinkHeader(test.header); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseLinkHeader(%q) = %+v, want %+v", test.header, got, test.want)
+		}
+	}
+}
+
+func TestHeaderLinkRels(t *testing.T) {
+	link := headerLink{Params: map[string]string{"rel": " Canonical  alternate "}}
+	if got := link.rels(); !slices.Equal(got, []string{"canonical", "alternate"}) {
+		t.Errorf("rels = %q", got)
+	}
+}
+
+func TestGetPageHeaderHints(t *testing.T) {
+	tests := []struct {
+		name       string
+		html       string
+		link       []string
+		language   string
+		canonical  string
+		lang       string
+		alternates []Alternate
+	}{
+		{
+			name:      "headers only",
+			html:      `<html><body>page</body></html>`,
+			link:      []string{`</canonical>; rel="canonical", </de/>; rel="alternate"; hreflang="de"`},
+			language:  "de-DE, en",
+			canonical: "/canonical",
+			lang:      "de-DE",
+			alternates: []Alternate{
+				{URL: "/de/", HrefLang: "de"},
+			},
+		},
+		{
+			name: "html wins",
+			html: `<html lang="en"><head><link rel="canonical" href="/from-html">
+				<link rel="alternate" hreflang="de" href="/html-de/"></head><body>page</body></html>`,
+			link:      []string{`</from-header>; rel=canonical`, `</header-de/>; rel=alternate; hreflang=de, </fr/>; rel=alternate; hreflang=fr`},
+			language:  "fr",
+			canonical: "/from-html",
+			lang:      "en",
+			alternates: []Alternate{
+				{URL: "/html-de/", HrefLang: "de"},
+				{URL: "/fr/", HrefLang: "fr"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := httptest.NewServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {
+				w.Header()["Link"] = test.link
+				w.Header().Set("Content-Language", test.language)
+				fmt.Fprint(w, test.html)
+			}))
+			defer srv.Close()
+
+			page, err := getPage(t, NewCrawler(nil, nil, quiet), srv.URL+"/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if page.Canonical != srv.URL+test.canonical {
+				t.Errorf("canonical = %q, want %q", page.Canonical, srv.URL+test.canonical)
+			}
+			if page.Lang != test.lang {
+				t.Errorf("lang = %q, want %q", page.Lang, test.lang)
+			}
+			var want []Alternate
+			for _, alt := range test.alternates {
+				alt.URL = srv.URL + alt.URL
+				want = append(want, alt)
+			}
+			if !slices.Equal(page.Alternates, want) {
+				t.Errorf("alternates = %+v, want %+v", page.Alternates, want)
+			}
+		})
+	}
+}
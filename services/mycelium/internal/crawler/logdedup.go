@@ -0,0 +1,205 @@
+package crawler
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DedupHandler is a slog.Handler that collapses repeated errors, such as
+// one "failed to get page" per url while a site is down. Warnings and
+// errors with an "error" attribute are keyed by message, error class and
+// host: the first is logged and repeats within the window are only
+// counted. Once the window has closed the count is logged as "repeated 412
+// times in the last 60s", either when the key is logged again or by Flush.
+// Handlers derived with WithAttrs and WithGroup share the counts; their
+// attrs count towards the key and records in different groups are kept
+// apart.
+type DedupHandler struct {
+	inner slog.Handler
+	state *dedupState
+	// attrs were added with WithAttrs, so records do not carry them
+	attrs []slog.Attr
+	group string
+}
+
+type dedupState struct {
+	mu      sync.Mutex
+	window  time.Duration
+	now     func() time.Time
+	entries map[dedupKey]*dedupEntry
+}
+
+type dedupKey struct {
+	group string
+	msg   string
+	class string
+	host  string
+}
+
+type dedupEntry struct {
+	// handler logged the first record, so the summary carries its attrs
+	handler  slog.Handler
+	level    slog.Level
+	start    time.Time
+	repeated int
+}
+
+// NewDedupHandler wraps inner, collapsing repeats within window. A nil now
+// uses time.Now; a non-positive window passes every record through.
+func NewDedupHandler(inner slog.Handler, window time.Duration, now func() time.Time) *DedupHandler {
+	if now == nil {
+		now = time.Now
+	}
+	return &DedupHandler{
+		inner: inner,
+		state: &dedupState{window: window, now: now, entries: map[dedupKey]*dedupEntry{}},
+	}
+}
+
+func (h *DedupHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *DedupHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &DedupHandler{
+		inner: h.inner.WithAttrs(attrs),
+		state: h.state,
+		attrs: append(slices.Clip(h.attrs), attrs...),
+		group: h.group,
+	}
+}
+
+func (h *DedupHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	group := name
+	if h.group != "" {
+		group = h.group + "." + name
+	}
+	return &DedupHandler{inner: h.inner.WithGroup(name), state: h.state, attrs: h.attrs, group: group}
+}
+
+func (h *DedupHandler) Handle(ctx context.Context, r slog.Record) error {
+	s := h.state
+	key, ok := dedupKeyOf(r, h.attrs, h.group)
+	if !ok || s.window <= 0 {
+		return h.inner.Handle(ctx, r)
+	}
+
+	now := s.now()
+	s.mu.Lock()
+	entry, found := s.entries[key]
+	if found && now.Sub(entry.start) < s.window {
+		entry.repeated++
+		s.mu.Unlock()
+		return nil
+	}
+	s.entries[key] = &dedupEntry{handler: h.inner, level: r.Level, start: now}
+	s.mu.Unlock()
+
+	var err error
+	if found && entry.repeated > 0 {
+		err = s.summarize(ctx, key, entry, now)
+	}
+	return errors.Join(err, h.inner.Handle(ctx, r))
+}
+
+// Flush logs the counts of windows that have closed. Call it periodically
+// so keys that stop repeating are summarized too.
+func (h *DedupHandler) Flush(ctx context.Context) error {
+	return h.state.flush(ctx, false)
+}
+
+// Close logs the counts of every window, closed or not, for shutdown.
+func (h *DedupHandler) Close(ctx context.Context) error {
+	return h.state.flush(ctx, true)
+}
+
+func (s *dedupState) flush(ctx context.Context, all bool) error {
+	now := s.now()
+	s.mu.Lock()
+	closed := map[dedupKey]*dedupEntry{}
+	for key, entry := range s.entries {
+		if !all && now.Sub(entry.start) < s.window {
+			continue
+		}
+		delete(s.entries, key)
+		if entry.repeated > 0 {
+			closed[key] = entry
+		}
+	}
+	s.mu.Unlock()
+
+	var errs []error
+	for key, entry := range closed {
+		errs = append(errs, s.summarize(ctx, key, entry, now))
+	}
+	return errors.Join(errs...)
+}
+
+func (s *dedupState) summarize(ctx context.Context, key dedupKey, entry *dedupEntry, now time.Time) error {
+	elapsed := min(now.Sub(entry.start), s.window).Round(time.Millisecond)
+	r := slog.NewRecord(now, entry.level, fmt.Sprintf("%s: repeated %d times in the last %gs", key.msg, entry.repeated, elapsed.Seconds()), 0)
+	r.AddAttrs(slog.String("error_class", key.class), slog.Int("repeated", entry.repeated))
+	if key.host != "" {
+		r.AddAttrs(slog.String("host", key.host))
+	}
+	return entry.handler.Handle(ctx, r)
+}
+
+// dedupKeyOf keys warnings and errors by group, message, the class of their
+// "error" attribute and the host of their "url", "host" or "domain"
+// attribute. The attributes are looked up in attrs, then in the record,
+// including inside groups. Records without an error are not deduplicated.
+func dedupKeyOf(r slog.Record, attrs []slog.Attr, group string) (dedupKey, bool) {
+	if r.Level < slog.LevelWarn {
+		return dedupKey{}, false
+	}
+	key := dedupKey{group: group, msg: r.Message}
+	hasError := false
+	var urlHost, host string
+	var visit func(a slog.Attr) bool
+	visit = func(a slog.Attr) bool {
+		value := a.Value.Resolve()
+		if value.Kind() == slog.KindGroup {
+			for _, member := range value.Group() {
+				visit(member)
+			}
+			return true
+		}
+		switch a.Key {
+		case "error":
+			hasError = true
+			if err, ok := value.Any().(error); ok {
+				key.class = errorLabel(err)
+			} else {
+				key.class = value.String()
+			}
+		case "url":
+			if u, err := url.Parse(value.String()); err == nil {
+				urlHost = u.Hostname()
+			}
+		case "host", "domain":
+			host = value.String()
+		}
+		return true
+	}
+	for _, a := range attrs {
+		visit(a)
+	}
+	r.Attrs(visit)
+
+	key.host = cmp.Or(urlHost, host)
+	return key, hasError
+}
@@ -0,0 +1,224 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func dedupLogger(t *testing.T) (*slog.Logger, *DedupHandler, *fakeClock, func() []map[string]any) {
+	t.Helper()
+	var buf bytes.Buffer
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	h := NewDedupHandler(slog.NewJSONHandler(&buf, nil), time.Minute, clock.now)
+	return slog.New(h), h, clock, func() []map[string]any {
+		var records []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			if line == "" {
+				continue
+			}
+			var record map[string]any
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatal(err)
+			}
+			records = append(records, record)
+		}
+		buf.Reset()
+		return records
+	}
+}
+
+func messages(records []map[string]any) []string {
+	msgs := make([]string, len(records))
+	for i, record := range records {
+		msgs[i] = record["msg"].(string)
+	}
+	return msgs
+}
+
+var errDown = errors.New("connection refused")
+
+func TestDedupSuppressesWithinWindow(t *testing.T) {
+	logger, _, clock, records := dedupLogger(t)
+
+	for i := 0; i < 5; i++ {
+		logger.Error("failed to get page", "url", "https://down.example.com/"+string(rune('a'+i)), "error", errDown)
+		clock.advance(time.Second)
+	}
+	// another host and a record without an error are their own keys
+	logger.Error("failed to get page", "url", "https://up.example.com/", "error", errDown)
+	logger.Warn("slow response", "url", "https://down.example.com/")
+	logger.Warn("slow response", "url", "https://down.example.com/")
+
+	got := messages(records())
+	want := []string{"failed to get page", "failed to get page", "slow response", "slow response"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("logged %q, want %q", got, want)
+	}
+}
+
+func TestDedupSummaryOnNextRecord(t *testing.T) {
+	logger, _, clock, records := dedupLogger(t)
+
+	for i := 0; i < 4; i++ {
+		logger.Error("failed to get page", "host", "down.example.com", "error", errDown)
+		clock.advance(10 * time.Second)
+	}
+	records()
+
+	clock.advance(time.Minute)
+	logger.Error("failed to get page", "host", "down.example.com", "error", errDown)
+	got := records()
+	if len(got) != 2 {
+		t.Fatalf("logged %v, want the summary and the record", messages(got))
+	}
+	summary := got[0]
+	if summary["msg"] != "failed to get page: repeated 3 times in the last 60s" {
+		t.Errorf("summary = %q", summary["msg"])
+	}
+	if summary["repeated"] != 3.0 || summary["host"] != "down.example.com" || summary["level"] != "ERROR" {
+		t.Errorf("summary attrs = %v", summary)
+	}
+	if got[1]["msg"] != "failed to get page" {
+		t.Errorf("record after the summary = %q", got[1]["msg"])
+	}
+}
+
+func TestDedupFlush(t *testing.T) {
+	logger, h, clock, records := dedupLogger(t)
+	ctx := context.Background()
+
+	logger.Warn("robots fetch failed", "domain", "a.example.com", "error", errDown)
+	logger.Warn("robots fetch failed", "domain", "a.example.com", "error", errDown)
+	logger.Warn("robots fetch failed", "domain", "b.example.com", "error", errDown)
+	records()
+
+	clock.advance(30 * time.Second)
+	if err := h.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := records(); len(got) != 0 {
+		t.Errorf("flush inside the window logged %v", messages(got))
+	}
+
+	clock.advance(time.Minute)
+	if err := h.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	got := records()
+	if len(got) != 1 || got[0]["msg"] != "robots fetch failed: repeated 1 times in the last 60s" {
+		t.Fatalf("flush logged %v, want one summary", messages(got))
+	}
+
+	// the window closed, so the next one is logged again
+	logger.Warn("robots fetch failed", "domain", "a.example.com", "error", errDown)
+	if got := records(); len(got) != 1 {
+		t.Errorf("logged %v after the window, want the record", messages(got))
+	}
+}
+
+func TestDedupClose(t *testing.T) {
+	logger, h, clock, records := dedupLogger(t)
+
+	logger.Error("failed to store page", "error", errDown)
+	clock.advance(5 * time.Second)
+	logger.Error("failed to store page", "error", errDown)
+	records()
+
+	clock.advance(5 * time.Second)
+	if err := h.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got := records()
+	if len(got) != 1 || got[0]["msg"] != "failed to store page: repeated 1 times in the last 10s" {
+		t.Errorf("close logged %v, want the open window summarized", messages(got))
+	}
+}
+
+func TestDedupWithAttrs(t *testing.T) {
+	logger, _, _, records := dedupLogger(t)
+
+	down := logger.With("url", "https://down.example.com/")
+	up := logger.With("url", "https://up.example.com/")
+	down.Error("failed to get page", "error", errDown)
+	down.Error("failed to get page", "error", errDown)
+	up.Error("failed to get page", "error", errDown)
+	// the record's own url wins over the logger's
+	down.Error("failed to get page", "url", "https://other.example.com/", "error", errDown)
+
+	got := records()
+	if len(got) != 3 {
+		t.Fatalf("logged %d records, want one per host: %v", len(got), got)
+	}
+	for i, want := range []string{"https://down.example.com/", "https://up.example.com/", "https://other.example.com/"} {
+		if got[i]["url"] != want {
+			t.Errorf("record %d url = %v, want %s", i, got[i]["url"], want)
+		}
+	}
+
+	// an error attached to the logger makes its warnings deduplicated too
+	failing := logger.With("error", errDown)
+	failing.Warn("retrying")
+	failing.Warn("retrying")
+	if got := records(); len(got) != 1 {
+		t.Errorf("logged %v, want the repeat suppressed", messages(got))
+	}
+}
+
+func TestDedupGroups(t *testing.T) {
+	logger, h, clock, records := dedupLogger(t)
+
+	fetch := logger.WithGroup("fetch")
+	store := logger.WithGroup("store")
+	fetch.Error("failed", "url", "https://down.example.com/", "error", errDown)
+	fetch.Error("failed", "url", "https://down.example.com/", "error", errDown)
+	store.Error("failed", "url", "https://down.example.com/", "error", errDown)
+	// attrs inside a group attr count as well
+	logger.Error("failed", slog.Group("req", "url", "https://down.example.com/", "error", errDown))
+	logger.Error("failed", slog.Group("req", "url", "https://up.example.com/", "error", errDown))
+	logger.Error("failed", slog.Group("req", "url", "https://up.example.com/", "error", errDown))
+
+	if got := records(); len(got) != 4 {
+		t.Fatalf("logged %d records, want one per group and host: %v", len(got), got)
+	}
+
+	clock.advance(2 * time.Minute)
+	if err := h.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got := records()
+	if len(got) != 2 {
+		t.Fatalf("flush logged %v, want two summaries", messages(got))
+	}
+	for _, summary := range got {
+		if fetchGroup, ok := summary["fetch"].(map[string]any); ok {
+			if fetchGroup["host"] != "down.example.com" {
+				t.Errorf("fetch summary = %v", summary)
+			}
+		} else if summary["host"] != "up.example.com" {
+			t.Errorf("summary = %v, want the group record's host", summary)
+		}
+	}
+}
+
+func TestDedupPassesInfoAndZeroWindow(t *testing.T) {
+	logger, _, _, records := dedupLogger(t)
+	logger.Info("fetched", "error", errDown)
+	logger.Info("fetched", "error", errDown)
+	if got := records(); len(got) != 2 {
+		t.Errorf("info records were deduplicated: %v", messages(got))
+	}
+
+	var buf bytes.Buffer
+	passthrough := slog.New(NewDedupHandler(slog.NewJSONHandler(&buf, nil), 0, nil))
+	passthrough.Error("failed", "error", errDown)
+	passthrough.Error("failed", "error", errDown)
+	if n := strings.Count(buf.String(), "\n"); n != 2 {
+		t.Errorf("zero window logged %d records, want 2", n)
+	}
+}
@@ -0,0 +1,102 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// IngressBatchPopper is optionally implemented by caches that can pop
+// several ingress items at once without blocking. WithLookahead needs it to
+// fill its buffer beyond a single item.
+type IngressBatchPopper interface {
+	PopManyFromMyceliumIngress(ctx context.Context, queueKey string, n int) ([]string, error)
+}
+
+// WithLookahead lets each worker hold up to n popped items and pick among
+// them, so consecutive fetches rotate across hosts and items whose domain
+// is rate limited wait in the buffer instead of stalling the worker. The
+// default of 1 processes items strictly in queue order.
+func WithLookahead(n int) CrawlerOption {
+	return func(c *Crawler) {
+		c.lookahead = n
+	}
+}
+
+type bufferedItem struct {
+	raw  string
+	host string
+}
+
+// lookahead is a worker's buffer of popped but unprocessed items.
+type lookahead struct {
+	size     int
+	items    []bufferedItem
+	lastHost string
+}
+
+// next returns the next item to process. It blocks on the queue only when
+// the buffer is empty, tops the buffer up without blocking, then prefers
+// the oldest item whose domain is not rate limited, for a host other than
+// the previous one where possible.
+func (c *Crawler) next(ctx context.Context, buf *lookahead) (string, error) {
+	if len(buf.items) == 0 {
+		raw, err := c.cache.PopFromMyceliumIngress(ctx, c.myceliumIngressKey)
+		if err != nil {
+			return "", err
+		}
+		buf.items = append(buf.items, bufferItem(raw))
+	}
+
+	if popper, ok := c.cache.(IngressBatchPopper); ok && len(buf.items) < buf.size {
+		more, err := popper.PopManyFromMyceliumIngress(ctx, c.myceliumIngressKey, buf.size-len(buf.items))
+		if err != nil {
+			c.log(ctx).Error("failed to fill lookahead buffer", "error", err)
+		}
+		for _, raw := range more {
+			buf.items = append(buf.items, bufferItem(raw))
+		}
+	}
+
+	// the first ready item wins unless a ready item for another host
+	// follows; with nothing ready the oldest item waits on its limiter
+	pick := -1
+	for i, item := range buf.items {
+		if c.domainLimiter != nil && !c.domainLimiter.ready(item.host) {
+			continue
+		}
+		if pick < 0 {
+			pick = i
+		}
+		if item.host != buf.lastHost {
+			pick = i
+			break
+		}
+	}
+	if pick < 0 {
+		pick = 0
+	}
+
+	item := buf.items[pick]
+	buf.items = append(buf.items[:pick], buf.items[pick+1:]...)
+	buf.lastHost = item.host
+	return item.raw, nil
+}
+
+// release hands buffered items back to the ingress queue when the worker
+// stops.
+func (c *Crawler) release(ctx context.Context, buf *lookahead) {
+	for _, item := range buf.items {
+		if err := c.cache.PushToMyceliumIngress(ctx, item.raw, c.myceliumIngressKey); err != nil {
+			c.log(ctx).Error("failed to return buffered item", "item", item.raw, "error", err)
+		}
+	}
+	buf.items = nil
+}
+
+func bufferItem(raw string) bufferedItem {
+	var item IngressItem
+	if err := json.Unmarshal([]byte(raw), &item); err != nil {
+		return bufferedItem{raw: raw}
+	}
+	return bufferedItem{raw: raw, host: hostOf(item.Location)}
+}
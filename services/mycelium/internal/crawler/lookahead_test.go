@@ -0,0 +1,87 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// nextHosts takes n items through the lookahead buffer and returns the host
+// of each.
+func nextHosts(t *testing.T, c *Crawler, buf *lookahead, n int) []string {
+	t.Helper()
+	var hosts []string
+	for range n {
+		raw, err := c.next(context.Background(), buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hosts = append(hosts, bufferItem(raw).host)
+	}
+	return hosts
+}
+
+func enqueueHosts(t *testing.T, c *Crawler, hosts ...string) {
+	t.Helper()
+	for i, host := range hosts {
+		if err := c.Enqueue(context.Background(), IngressItem{Location: fmt.Sprintf("https://%s/%d", host, i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLookaheadInterleavesHosts(t *testing.T) {
+	cache := newMemCache()
+	c := NewCrawler(cache, nil, quiet, WithMyceliumIngressKey("ingress"), WithLookahead(8))
+	enqueueHosts(t, c, "a.test", "a.test", "a.test", "a.test", "b.test", "b.test", "b.test", "b.test")
+
+	got := nextHosts(t, c, &lookahead{size: c.lookahead}, 8)
+	want := []string{"a.test", "b.test", "a.test", "b.test", "a.test", "b.test", "a.test", "b.test"}
+	if !slices.Equal(got, want) {
+		t.Errorf("processed hosts %v, want %v", got, want)
+	}
+}
+
+func TestLookaheadDefaultKeepsQueueOrder(t *testing.T) {
+	cache := newMemCache()
+	c := NewCrawler(cache, nil, quiet, WithMyceliumIngressKey("ingress"))
+	enqueueHosts(t, c, "a.test", "a.test", "b.test")
+
+	got := nextHosts(t, c, &lookahead{size: c.lookahead}, 3)
+	if want := []string{"a.test", "a.test", "b.test"}; !slices.Equal(got, want) {
+		t.Errorf("processed hosts %v, want %v", got, want)
+	}
+}
+
+func TestLookaheadSkipsRateLimitedDomains(t *testing.T) {
+	cache := newMemCache()
+	c := NewCrawler(cache, nil, quiet, WithMyceliumIngressKey("ingress"), WithLookahead(8), WithDomainRateLimit(0.1))
+	// a.test just had a request, so its next slot is ten seconds away
+	if err := c.domainLimiter.wait(context.Background(), "a.test"); err != nil {
+		t.Fatal(err)
+	}
+	enqueueHosts(t, c, "a.test", "a.test", "b.test", "c.test")
+
+	buf := &lookahead{size: c.lookahead}
+	start := time.Now()
+	got := nextHosts(t, c, buf, 2)
+	if want := []string{"b.test", "c.test"}; !slices.Equal(got, want) {
+		t.Errorf("processed hosts %v, want the ready domains first", got)
+	}
+	if len(buf.items) != 2 {
+		t.Errorf("%d items buffered, want the two rate limited ones held back", len(buf.items))
+	}
+	if queued := len(cache.queue("ingress")); queued != 0 {
+		t.Errorf("%d items requeued, want them kept in the buffer", queued)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("picking took %s, want no waiting on the limited domain", elapsed)
+	}
+
+	c.release(context.Background(), buf)
+	if queued := len(cache.queue("ingress")); queued != 2 {
+		t.Errorf("%d items returned to the queue on release, want 2", queued)
+	}
+}
@@ -0,0 +1,45 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// MalformedCache is implemented by caches that can keep a capped list of
+// payloads for inspection. It is required by WithMalformedKey.
+type MalformedCache interface {
+	PushBounded(ctx context.Context, itemJSON string, queueKey string, maxLen int64) error
+}
+
+// WithMalformedKey parks ingress payloads that fail to parse in the list at
+// key, as DeadLetter records, instead of dropping them. Only the newest
+// maxLen entries are kept.
+func WithMalformedKey(key string, maxLen int) CrawlerOption {
+	return func(c *Crawler) {
+		c.malformedKey = key
+		c.malformedMax = int64(maxLen)
+	}
+}
+
+// parkMalformed saves a payload that could not be parsed as an IngressItem.
+func (c *Crawler) parkMalformed(ctx context.Context, payload string, parseErr error) {
+	c.metrics.Incr(MetricItemsMalformed, 1)
+	list, ok := c.cache.(MalformedCache)
+	if c.malformedKey == "" || !ok {
+		return
+	}
+	record, err := json.Marshal(DeadLetter{
+		Source:  "ingress",
+		Reason:  parseErr.Error(),
+		Payload: payload,
+		At:      time.Now().Unix(),
+	})
+	if err != nil {
+		c.log(ctx).Error("failed to marshal malformed item", "error", err)
+		return
+	}
+	if err := list.PushBounded(ctx, string(record), c.malformedKey, c.malformedMax); err != nil {
+		c.log(ctx).Error("failed to park malformed item", "error", err)
+	}
+}
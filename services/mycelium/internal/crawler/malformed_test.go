@@ -0,0 +1,89 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// countUntilFetch counts like CounterMetrics and cancels the crawl once a
+// page has been fetched.
+type countUntilFetch struct {
+	*CounterMetrics
+	stop context.CancelFunc
+}
+
+func (m countUntilFetch) Incr(name string, delta int64) {
+	m.CounterMetrics.Incr(name, delta)
+	if name == MetricPagesFetched {
+		m.stop()
+	}
+}
+
+func TestMalformedIngressItemsAreParked(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><body>fine</body></html>")
+	}))
+	defer srv.Close()
+
+	rc, mr := newRedisCache(t)
+	truncated := `{"location":"https://exa`
+	garbage := "not json at all"
+	mr.RPush("ingress", truncated, garbage, fmt.Sprintf(`{"location":%q}`, srv.URL+"/"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	metrics := countUntilFetch{NewCounterMetrics(), cancel}
+	c := NewCrawler(rc, nil, quiet, WithMyceliumIngressKey("ingress"), WithMetrics(metrics), WithMalformedKey("malformed", 10))
+	done := make(chan error)
+	go func() { done <- c.Crawl(ctx) }()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		cancel()
+		<-done
+		t.Fatal("timed out waiting for the valid item to be crawled")
+	}
+
+	parked, _ := mr.List("malformed")
+	if len(parked) != 2 {
+		t.Fatalf("parked %d items, want the 2 malformed ones", len(parked))
+	}
+	for i, payload := range []string{truncated, garbage} {
+		var letter DeadLetter
+		if err := json.Unmarshal([]byte(parked[i]), &letter); err != nil {
+			t.Fatalf("parked record %q: %s", parked[i], err)
+		}
+		if letter.Payload != payload || letter.Source != "ingress" || letter.Reason == "" || letter.At == 0 {
+			t.Errorf("parked %+v, want payload %q with the parse error", letter, payload)
+		}
+	}
+	if n := metrics.Get(MetricItemsMalformed); n != 2 {
+		t.Errorf("counted %d malformed items, want 2", n)
+	}
+}
+
+func TestMalformedListIsCapped(t *testing.T) {
+	rc, mr := newRedisCache(t)
+	c := NewCrawler(rc, nil, quiet, WithMalformedKey("malformed", 2))
+	for i := range 3 {
+		c.parkMalformed(context.Background(), fmt.Sprint(i), errors.New("bad"))
+	}
+
+	parked, _ := mr.List("malformed")
+	var payloads []string
+	for _, record := range parked {
+		var letter DeadLetter
+		json.Unmarshal([]byte(record), &letter)
+		payloads = append(payloads, letter.Payload)
+	}
+	if fmt.Sprint(payloads) != "[1 2]" {
+		t.Errorf("kept %v, want the newest two", payloads)
+	}
+}
@@ -0,0 +1,199 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// memCache is an in-memory CrawlerCache for tests. Pops never block; an
+// empty queue reports no items at once.
+type memCache struct {
+	mu        sync.Mutex
+	visited   map[string]bool
+	verified  map[string]bool
+	queues    map[string][]string
+	fungicide map[string][]string
+	blacklist map[string]map[string]bool
+	budget    map[string]int64
+	control   map[string]string
+	hashes    map[string]string
+}
+
+func newMemCache() *memCache {
+	return &memCache{
+		visited:   map[string]bool{},
+		verified:  map[string]bool{},
+		queues:    map[string][]string{},
+		fungicide: map[string][]string{},
+		blacklist: map[string]map[string]bool{},
+		budget:    map[string]int64{},
+		control:   map[string]string{},
+		hashes:    map[string]string{},
+	}
+}
+
+func (m *memCache) Visit(_ context.Context, location string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.visited[location] = true
+	return nil
+}
+
+func (m *memCache) Unvisit(_ context.Context, location string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.visited, location)
+	return nil
+}
+
+func (m *memCache) IsVisited(_ context.Context, location string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.visited[location], nil
+}
+
+func (m *memCache) TryVerify(_ context.Context, location string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.verified[location] {
+		return false, nil
+	}
+	m.verified[location] = true
+	return true, nil
+}
+
+func (m *memCache) Unverify(_ context.Context, location string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.verified, location)
+	return nil
+}
+
+func (m *memCache) PushToFungicide(_ context.Context, item string, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fungicide[key] = append(m.fungicide[key], item)
+	return nil
+}
+
+func (m *memCache) PushToMyceliumIngress(_ context.Context, item string, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queues[key] = append(m.queues[key], item)
+	return nil
+}
+
+func (m *memCache) PopFromMyceliumIngress(_ context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.queues[key]) == 0 {
+		return "", ErrQueueEmpty
+	}
+	item := m.queues[key][0]
+	m.queues[key] = m.queues[key][1:]
+	return item, nil
+}
+
+func (m *memCache) PopManyFromMyceliumIngress(_ context.Context, key string, n int) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n = min(n, len(m.queues[key]))
+	items := m.queues[key][:n:n]
+	m.queues[key] = m.queues[key][n:]
+	return items, nil
+}
+
+func (m *memCache) MoveItems(_ context.Context, fromKey string, toKey string, n int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n = min(n, int64(len(m.queues[fromKey])))
+	m.queues[toKey] = append(m.queues[toKey], m.queues[fromKey][:n]...)
+	m.queues[fromKey] = m.queues[fromKey][n:]
+	return n, nil
+}
+
+func (m *memCache) IsBlacklisted(_ context.Context, host string, key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.blacklist[key][host], nil
+}
+
+func (m *memCache) IngressQueueSize(_ context.Context, key string) (int32, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return int32(len(m.queues[key])), nil
+}
+
+func (m *memCache) QueuedLocations(_ context.Context, key string) (map[string]bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	locations := map[string]bool{}
+	for _, queued := range m.queues[key] {
+		var item IngressItem
+		if json.Unmarshal([]byte(queued), &item) == nil {
+			locations[item.Location] = true
+		}
+	}
+	return locations, nil
+}
+
+func (m *memCache) ClearQueue(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.queues, key)
+	return nil
+}
+
+func (m *memCache) PushToDeadLetter(_ context.Context, item string, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queues[key] = append(m.queues[key], item)
+	return nil
+}
+
+func (m *memCache) SpendDomainBudget(_ context.Context, domain string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.budget[domain]++
+	return m.budget[domain], nil
+}
+
+func (m *memCache) RefundDomainBudget(_ context.Context, domain string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.budget[domain]--
+	return nil
+}
+
+func (m *memCache) ControlState(_ context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.control[key], nil
+}
+
+func (m *memCache) SetContentHash(_ context.Context, location string, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hashes[location] = hash
+	return nil
+}
+
+func (m *memCache) ContentHash(_ context.Context, location string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.hashes[location], nil
+}
+
+func (m *memCache) setControl(key string, state string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.control[key] = state
+}
+
+// queue returns a copy of the items waiting in key.
+func (m *memCache) queue(key string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.queues[key]...)
+}
@@ -0,0 +1,250 @@
+package crawler
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	MetricItemsPopped  = "items_popped"
+	MetricPagesFetched = "pages_fetched"
+	MetricFetchErrors  = "fetch_errors"
+	MetricPagesDropped = "pages_dropped"
+	MetricLinksQueued  = "links_queued"
+	MetricUrlsBlocked  = "urls_blocked"
+	MetricUrlsFiltered = "urls_filtered"
+
+	MetricDomainsAutoBlacklisted = "domains_auto_blacklisted"
+	MetricLinksSuppressed        = "links_suppressed"
+	MetricFrontierOverflowed     = "frontier_overflowed"
+	MetricFrontierDropped        = "frontier_dropped"
+	MetricConnsReused            = "conns_reused"
+	MetricItemsMalformed         = "items_malformed"
+	MetricItemsRetried           = "items_retried"
+	MetricItemsExhausted         = "items_exhausted"
+	MetricRequestsProxied        = "requests_proxied"
+	MetricRequestsDirect         = "requests_direct"
+	MetricBytesDownloaded        = "bytes_downloaded"
+	MetricBytesDecoded           = "bytes_decoded"
+	MetricPagesUnchanged         = "pages_unchanged"
+	MetricLinksVerified          = "links_verified"
+	MetricLinksBroken            = "links_broken"
+	MetricFailuresCaptured       = "failures_captured"
+	MetricFailuresSkipped        = "failures_skipped"
+	MetricSoftErrors             = "soft_errors"
+	MetricRedirectsFollowed      = "redirects_followed"
+	MetricCacheReadErrors        = "cache_read_errors"
+	MetricUpstreamCacheHits      = "upstream_cache_hits"
+	MetricPagesSampled           = "pages_sampled"
+	MetricPagesNotSampled        = "pages_not_sampled"
+	MetricHostFoldsLearned       = "host_folds_learned"
+	MetricItemsDelayed           = "items_delayed"
+
+	// MetricItemsDroppedPrefix is followed by the kind of error, e.g.
+	// items_dropped_blacklisted.
+	MetricItemsDroppedPrefix = "items_dropped_"
+	// MetricUrlFilterHitsPrefix is followed by the url filter rule that
+	// blocked a url, e.g. url_filter_hits_extension.
+	MetricUrlFilterHitsPrefix = "url_filter_hits_"
+	// MetricProxyPicks counts requests per proxy under the LabelProxy label,
+	// and MetricUserAgentPicks per user agent under LabelUserAgent. They are
+	// only kept by Metrics implementing LabeledMetrics.
+	MetricProxyPicks     = "proxy_picks"
+	MetricUserAgentPicks = "user_agent_picks"
+
+	MetricFetchDuration = "fetch_duration"
+	MetricDNSLookup     = "dns_lookup"
+	MetricTLSHandshake  = "tls_handshake"
+	// MetricQueueLatency is how long items waited in the ingress queue.
+	MetricQueueLatency = "queue_latency"
+)
+
+const (
+	// LabelProxy holds the redacted url of a proxy.
+	LabelProxy = "proxy"
+	// LabelUserAgent holds a user agent string.
+	LabelUserAgent = "user_agent"
+)
+
+// Metrics receives counters from the crawl loop. Implementations must be
+// safe for concurrent use.
+type Metrics interface {
+	Incr(name string, delta int64)
+}
+
+// metricLabel turns s, e.g. a rule name, into the lowercase
+// letters, digits and underscores a metric name may hold.
+func metricLabel(s string) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range strings.ToLower(s) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			b.WriteRune(r)
+			underscore = false
+		} else if !underscore && b.Len() > 0 {
+			b.WriteByte('_')
+			underscore = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "_")
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) Incr(string, int64) {}
+
+// CounterMetrics is an in-process Metrics implementation that can be read
+// back with Snapshot.
+type CounterMetrics struct {
+	counters   sync.Map
+	labeled    sync.Map
+	histograms sync.Map
+}
+
+func NewCounterMetrics() *CounterMetrics {
+	return &CounterMetrics{}
+}
+
+func (m *CounterMetrics) Incr(name string, delta int64) {
+	counter, _ := m.counters.LoadOrStore(name, new(atomic.Int64))
+	counter.(*atomic.Int64).Add(delta)
+}
+
+func (m *CounterMetrics) Get(name string) int64 {
+	if counter, found := m.counters.Load(name); found {
+		return counter.(*atomic.Int64).Load()
+	}
+	return 0
+}
+
+func (m *CounterMetrics) Snapshot() map[string]int64 {
+	snapshot := map[string]int64{}
+	m.counters.Range(func(k, v any) bool {
+		snapshot[k.(string)] = v.(*atomic.Int64).Load()
+		return true
+	})
+	return snapshot
+}
+
+// DurationObserver is optionally implemented by Metrics that aggregate
+// timings, such as DNS lookups and TLS handshakes.
+type DurationObserver interface {
+	Observe(name string, d time.Duration)
+}
+
+func observe(metrics Metrics, name string, d time.Duration) {
+	if observer, ok := metrics.(DurationObserver); ok {
+		observer.Observe(name, d)
+	}
+}
+
+// LabeledMetrics is optionally implemented by Metrics that keep counters
+// split by the value of a label, such as requests per proxy. Values are
+// unbounded strings, so they are kept out of metric names.
+type LabeledMetrics interface {
+	IncrLabeled(name string, label string, value string, delta int64)
+}
+
+func incrLabeled(metrics Metrics, name string, label string, value string, delta int64) {
+	if labeled, ok := metrics.(LabeledMetrics); ok {
+		labeled.IncrLabeled(name, label, value, delta)
+	}
+}
+
+// LabeledCounter names a counter kept by IncrLabeled.
+type LabeledCounter struct {
+	Name  string
+	Label string
+	Value string
+}
+
+func (m *CounterMetrics) IncrLabeled(name string, label string, value string, delta int64) {
+	counter, _ := m.labeled.LoadOrStore(LabeledCounter{Name: name, Label: label, Value: value}, new(atomic.Int64))
+	counter.(*atomic.Int64).Add(delta)
+}
+
+// GetLabeled returns the counter name kept for the given label value.
+func (m *CounterMetrics) GetLabeled(name string, label string, value string) int64 {
+	if counter, found := m.labeled.Load(LabeledCounter{Name: name, Label: label, Value: value}); found {
+		return counter.(*atomic.Int64).Load()
+	}
+	return 0
+}
+
+// LabeledSnapshot returns the counters kept by IncrLabeled.
+func (m *CounterMetrics) LabeledSnapshot() map[LabeledCounter]int64 {
+	snapshot := map[LabeledCounter]int64{}
+	m.labeled.Range(func(k, v any) bool {
+		snapshot[k.(LabeledCounter)] = v.(*atomic.Int64).Load()
+		return true
+	})
+	return snapshot
+}
+
+// HistogramBounds are the upper bounds of the CounterMetrics histogram
+// buckets. A final bucket catches everything slower.
+var HistogramBounds = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+}
+
+// Histogram is a snapshot of observed durations. Buckets has one more entry
+// than HistogramBounds.
+type Histogram struct {
+	Count   int64         `json:"count"`
+	Sum     time.Duration `json:"sum"`
+	Buckets []int64       `json:"buckets"`
+}
+
+type histogram struct {
+	count   atomic.Int64
+	sum     atomic.Int64
+	buckets []atomic.Int64
+}
+
+func (m *CounterMetrics) Observe(name string, d time.Duration) {
+	h, found := m.histograms.Load(name)
+	if !found {
+		h, _ = m.histograms.LoadOrStore(name, &histogram{buckets: make([]atomic.Int64, len(HistogramBounds)+1)})
+	}
+	hist := h.(*histogram)
+	hist.count.Add(1)
+	hist.sum.Add(int64(d))
+	bucket := len(HistogramBounds)
+	for i, bound := range HistogramBounds {
+		if d <= bound {
+			bucket = i
+			break
+		}
+	}
+	hist.buckets[bucket].Add(1)
+}
+
+func (m *CounterMetrics) Histograms() map[string]Histogram {
+	snapshot := map[string]Histogram{}
+	m.histograms.Range(func(k, v any) bool {
+		hist := v.(*histogram)
+		buckets := make([]int64, len(hist.buckets))
+		for i := range hist.buckets {
+			buckets[i] = hist.buckets[i].Load()
+		}
+		snapshot[k.(string)] = Histogram{
+			Count:   hist.count.Load(),
+			Sum:     time.Duration(hist.sum.Load()),
+			Buckets: buckets,
+		}
+		return true
+	})
+	return snapshot
+}
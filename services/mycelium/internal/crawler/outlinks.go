@@ -0,0 +1,43 @@
+package crawler
+
+import (
+	"mycelium/internal/filter"
+)
+
+// OutlinkDomains summarizes the links of a page by registrable domain, so
+// consumers can weigh where a page links to without walking Links.
+type OutlinkDomains struct {
+	// Internal counts the links to the page's own registrable domain.
+	Internal int `json:"internal"`
+	// External counts the links to each other registrable domain.
+	External map[string]int `json:"external,omitempty"`
+}
+
+// summarizeOutlinks counts Links by registrable domain, relative to the
+// domain that served the page. Subdomains count towards their registrable
+// domain. Links must already be deduplicated.
+func (p *Page) summarizeOutlinks() *OutlinkDomains {
+	served := p.Location
+	if p.redirectedTo != nil {
+		served = p.redirectedTo
+	}
+	own := filter.RegistrableDomain(served.Hostname())
+
+	summary := &OutlinkDomains{}
+	for i := range p.Links {
+		host := p.Links[i].Hostname()
+		if host == "" {
+			continue
+		}
+		domain := filter.RegistrableDomain(host)
+		if domain == own {
+			summary.Internal++
+			continue
+		}
+		if summary.External == nil {
+			summary.External = map[string]int{}
+		}
+		summary.External[domain]++
+	}
+	return summary
+}
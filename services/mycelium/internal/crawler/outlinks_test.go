@@ -0,0 +1,61 @@
+package crawler
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestSummarizeOutlinks(t *testing.T) {
+	var links []url.URL
+	for _, link := range []string{
+		"https://www.example.com/",
+		"http://example.com/about",
+		"https://blog.example.com/post",
+		"https://a.example.co.uk/",
+		"https://b.example.co.uk/x",
+		"https://example.co.uk/",
+		"https://other.org/",
+		"mailto:someone@example.com",
+	} {
+		links = append(links, *mustParse(t, link))
+	}
+
+	page := &Page{Location: mustParse(t, "https://shop.example.com/"), Links: links}
+	got := page.summarizeOutlinks()
+	if got.Internal != 3 {
+		t.Errorf("counted %d internal links, want the 3 on example.com", got.Internal)
+	}
+	if want := map[string]int{"example.co.uk": 3, "other.org": 1}; !maps.Equal(got.External, want) {
+		t.Errorf("external = %v, want %v", got.External, want)
+	}
+
+	// relative to the domain that served the page
+	page.redirectedTo = mustParse(t, "https://other.org/")
+	got = page.summarizeOutlinks()
+	if want := map[string]int{"example.com": 3, "example.co.uk": 3}; got.Internal != 1 || !maps.Equal(got.External, want) {
+		t.Errorf("after a redirect counted %d internal and %v external", got.Internal, got.External)
+	}
+}
+
+func TestGetPageSummarizesDistinctOutlinks(t *testing.T) {
+	srv := httptest.NewServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><body>
+			<a href="/a">a</a><a href="/a">a again</a><a href="http://%s/b">b</a>
+			<a href="https://example.com/">x</a><a href="https://www.example.com/">y</a><a href="https://example.com/">x again</a>
+			</body></html>`, r.Host)
+	}))
+	defer srv.Close()
+
+	page, err := getPage(t, NewCrawler(nil, nil, quiet), srv.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := page.OutlinkDomains
+	if got == nil || got.Internal != 2 || !maps.Equal(got.External, map[string]int{"example.com": 2}) {
+		t.Errorf("summary = %+v, want 2 internal and 2 distinct links to example.com", got)
+	}
+}
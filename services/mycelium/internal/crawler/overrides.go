@@ -0,0 +1,177 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"mycelium/internal/filter"
+)
+
+// DomainOverride changes how pages on one domain are fetched. Zero fields
+// keep the crawler's settings.
+type DomainOverride struct {
+	// Headers are set on every request to the domain, replacing any header
+	// of the same name from the header chooser.
+	Headers map[string]string
+	// Timeout replaces the request timeout. It is still bounded by
+	// WithPageTimeout.
+	Timeout time.Duration
+	// RateLimit replaces the WithDomainRateLimit requests per second.
+	RateLimit float64
+	// Proxy is used for every request to the domain instead of the proxy
+	// chooser and the bypass list.
+	Proxy string
+	// HashRoutes keeps route fragments on the domain's urls, as
+	// WithHashRoutes does for all domains.
+	HashRoutes bool
+}
+
+// WithDomainOverrides applies overrides to requests whose host or registrable
+// domain is a key of overrides, an exact host taking precedence. Headers and
+// proxies follow redirects: a redirect to another domain drops them and
+// picks up that domain's overrides instead.
+func WithDomainOverrides(overrides map[string]DomainOverride) CrawlerOption {
+	return func(c *Crawler) {
+		c.domainOverrides = map[string]*domainOverride{}
+		for domain, override := range overrides {
+			c.domainOverrides[strings.ToLower(strings.TrimSpace(domain))] = &domainOverride{DomainOverride: override}
+		}
+	}
+}
+
+type domainOverride struct {
+	DomainOverride
+	proxy *url.URL
+}
+
+type overrideBaseKey struct{}
+
+// overrideFor returns the override for host, or nil.
+func (c *Crawler) overrideFor(host string) *domainOverride {
+	if len(c.domainOverrides) == 0 {
+		return nil
+	}
+	host = strings.ToLower(host)
+	if o, found := c.domainOverrides[host]; found {
+		return o
+	}
+	return c.domainOverrides[filter.RegistrableDomain(host)]
+}
+
+// setupOverrides parses override proxies, registers rate limits and makes
+// sure the client timeout leaves room for the longest override timeout.
+func (c *Crawler) setupOverrides() {
+	for domain, o := range c.domainOverrides {
+		if o.Proxy != "" {
+			proxy, err := url.Parse(o.Proxy)
+			if err != nil || proxy.Scheme == "" || proxy.Host == "" {
+				c.logger.Error("invalid override proxy, ignoring it", "domain", domain)
+			} else {
+				o.proxy = proxy
+			}
+		}
+		if o.RateLimit > 0 {
+			if c.domainLimiter == nil {
+				c.domainLimiter = newDomainLimiter(0)
+			}
+			c.domainLimiter.setRate(filter.RegistrableDomain(domain), o.RateLimit)
+		}
+		if o.Timeout > c.client.Timeout {
+			c.client.Timeout = o.Timeout
+		}
+	}
+
+	if len(c.domainOverrides) == 0 {
+		return
+	}
+	next := c.client.CheckRedirect
+	c.client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		c.redirectOverrides(req, via)
+		if next != nil {
+			return next(req, via)
+		}
+		// the client's default policy
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+}
+
+// hasOverrideProxies reports whether any override sets a proxy.
+func (c *Crawler) hasOverrideProxies() bool {
+	for _, o := range c.domainOverrides {
+		if o.Proxy != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// applyHeaders sets the override's headers, replacing existing values.
+func (o *domainOverride) applyHeaders(header http.Header) {
+	for k, v := range o.Headers {
+		header.Set(k, v)
+	}
+}
+
+// applyOverrideHeaders sets the headers of override, which may be nil, and
+// returns req with a context remembering the headers it had before.
+func (c *Crawler) applyOverrideHeaders(req *http.Request, override *domainOverride) *http.Request {
+	if len(c.domainOverrides) == 0 {
+		return req
+	}
+	req = req.WithContext(withOverrideBase(req.Context(), req.Header))
+	if override != nil {
+		override.applyHeaders(req.Header)
+	}
+	return req
+}
+
+// withOverrideBase remembers the request headers before any override so a
+// redirect away from the domain can restore them.
+func withOverrideBase(ctx context.Context, header http.Header) context.Context {
+	return context.WithValue(ctx, overrideBaseKey{}, header.Clone())
+}
+
+// redirectOverrides swaps the headers of the domain being left for those of
+// the domain being redirected to.
+func (c *Crawler) redirectOverrides(req *http.Request, via []*http.Request) {
+	from := c.overrideFor(via[len(via)-1].URL.Hostname())
+	to := c.overrideFor(req.URL.Hostname())
+	if from == to {
+		return
+	}
+	if from != nil {
+		base, _ := req.Context().Value(overrideBaseKey{}).(http.Header)
+		for k := range from.Headers {
+			if v, found := base[http.CanonicalHeaderKey(k)]; found {
+				req.Header[http.CanonicalHeaderKey(k)] = v
+			} else {
+				req.Header.Del(k)
+			}
+		}
+	}
+	if to != nil {
+		to.applyHeaders(req.Header)
+		restrictAcceptEncoding(req.Header)
+	}
+}
+
+// requestTimeoutFor returns the timeout GetPage should set on the request
+// context for a host with override o, or 0 when the client timeout already
+// is the right one.
+func (c *Crawler) requestTimeoutFor(o *domainOverride) time.Duration {
+	timeout := c.requestTimeout
+	if o != nil && o.Timeout > 0 {
+		timeout = o.Timeout
+	}
+	if timeout >= c.client.Timeout {
+		return 0
+	}
+	return timeout
+}
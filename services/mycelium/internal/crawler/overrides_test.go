@@ -0,0 +1,125 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDomainOverrideHeadersAndProxy(t *testing.T) {
+	var mu sync.Mutex
+	seen := map[string]http.Header{}
+	record := func(r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		seen[r.Host+r.URL.Path] = r.Header.Clone()
+	}
+	direct := httptest.NewServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		fmt.Fprint(w, "<html><body>direct</body></html>")
+	}))
+	defer direct.Close()
+	// the partner domain only exists behind its proxy, which redirects
+	// elsewhere for /away
+	partner := httptest.NewServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		if r.URL.Path == "/away" {
+			http.Redirect(w, r, direct.URL+"/landed", http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, "<html><body>partner</body></html>")
+	}))
+	defer partner.Close()
+
+	c := NewCrawler(nil, nil, quiet, WithDomainOverrides(map[string]DomainOverride{
+		"partner.test": {Headers: map[string]string{"X-Api-Key": "s3cret", "Accept": "application/xhtml+xml"}, Proxy: partner.URL},
+	}))
+	for _, location := range []string{"http://www.partner.test/", "http://partner.test/away", direct.URL + "/other"} {
+		if _, err := getPage(t, c, location); err != nil {
+			t.Fatalf("%s: %s", location, err)
+		}
+	}
+
+	for _, key := range []string{"www.partner.test/", "partner.test/away"} {
+		if got := seen[key].Get("X-Api-Key"); got != "s3cret" {
+			t.Errorf("%s: X-Api-Key = %q, want the override", key, got)
+		}
+		if got := seen[key].Get("Accept"); got != "application/xhtml+xml" {
+			t.Errorf("%s: Accept = %q, want the override", key, got)
+		}
+	}
+	directHost := strings.TrimPrefix(direct.URL, "http://")
+	for _, key := range []string{directHost + "/landed", directHost + "/other"} {
+		header, found := seen[key]
+		if !found {
+			t.Errorf("%s was not fetched directly", key)
+			continue
+		}
+		if got := header.Get("X-Api-Key"); got != "" {
+			t.Errorf("%s: X-Api-Key leaked as %q", key, got)
+		}
+		if got := header.Get("Accept"); got == "application/xhtml+xml" {
+			t.Errorf("%s: Accept override leaked", key)
+		}
+	}
+}
+
+func TestDomainOverrideTimeout(t *testing.T) {
+	srv := httptest.NewServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(300 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+		fmt.Fprint(w, "<html><body>slow</body></html>")
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+	localhost := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+
+	tests := []struct {
+		name      string
+		timeout   time.Duration
+		overrides map[string]DomainOverride
+		location  string
+		wantErr   bool
+	}{
+		{"shorter override", time.Second, map[string]DomainOverride{"127.0.0.1": {Timeout: 50 * time.Millisecond}}, srv.URL + "/", true},
+		{"other host keeps the default", time.Second, map[string]DomainOverride{"127.0.0.1": {Timeout: 50 * time.Millisecond}}, localhost + "/", false},
+		{"longer override", 50 * time.Millisecond, map[string]DomainOverride{"127.0.0.1": {Timeout: time.Second}}, srv.URL + "/", false},
+		{"longer override elsewhere", 50 * time.Millisecond, map[string]DomainOverride{"localhost": {Timeout: time.Second}}, srv.URL + "/", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := NewCrawler(nil, nil, quiet, WithRequestTimeout(test.timeout), WithDomainOverrides(test.overrides))
+			_, err := getPage(t, c, test.location)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Errorf("fetching %s via %s: err = %v, want error %t", test.location, host, err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestDomainOverrideRateLimit(t *testing.T) {
+	c := NewCrawler(nil, nil, quiet, WithDomainRateLimit(1000), WithDomainOverrides(map[string]DomainOverride{
+		"slow.example": {RateLimit: 10},
+	}))
+	measure := func(host string) time.Duration {
+		start := time.Now()
+		for range 3 {
+			if err := c.domainLimiter.wait(t.Context(), host); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return time.Since(start)
+	}
+	if elapsed := measure("www.slow.example"); elapsed < 150*time.Millisecond {
+		t.Errorf("3 requests to the overridden domain took %s, want at least 200ms", elapsed)
+	}
+	if elapsed := measure("fast.example"); elapsed > 100*time.Millisecond {
+		t.Errorf("3 requests to another domain took %s, want the shared rate", elapsed)
+	}
+}
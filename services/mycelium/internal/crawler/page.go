@@ -1,15 +1,19 @@
 package crawler
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/url"
 	"strings"
 	"time"
 
 	"golang.org/x/net/html"
 	"golang.org/x/net/html/atom"
+	"mycelium/internal/filter"
 )
 
 type Page struct {
@@ -22,7 +26,62 @@ type Page struct {
 	Links         []url.URL
 	ScriptLinks   []url.URL
 	ScriptContent []string
+	// Scripts are the inline scripts kept under the page's ScriptPolicy.
+	// ScriptContent holds the content of each, for consumers of the older
+	// format.
+	Scripts []Script
+	// DownloadLinks are links with a download attribute or a binary file
+	// extension. They are kept out of Links so they are never queued.
+	DownloadLinks []url.URL
 	Location      *url.URL
+	// Type is how the fields were extracted; empty on pages from older
+	// producers.
+	Type PageType
+	// Session is the id of the run that fetched the page.
+	Session string
+	// Referrer is the page that linked here, if known.
+	Referrer string
+	// Recrawl is set when the page was fetched again after going stale.
+	Recrawl bool
+	// Trimmed lists what was cut to fit the fungicide payload budget.
+	Trimmed []string
+	// Fetch describes the request that produced the page.
+	Fetch *FetchInfo
+	// Security is the TLS and server fingerprint, nil for plain HTTP.
+	Security *Security
+	// Lang is the lang attribute of <html>.
+	Lang string
+	// Dir is the dir attribute of <html>, or guessed from the text with
+	// GuessTextDirection when it has none.
+	Dir string
+	// HeadingDirs and ContentDirs line up with Headings and Content and hold
+	// the dir attribute of the element each came from, "" where it was
+	// inherited. They are nil when no element set one.
+	HeadingDirs []string
+	ContentDirs []string
+	// Canonical and Alternates come from <link> tags and the Link header.
+	Canonical  string
+	Alternates []Alternate
+	// Redirects are the urls the request was redirected through, ending
+	// with the one that served the page. Empty when it was not redirected.
+	Redirects []string
+	// SoftError lists why the page looks like an error page served with a
+	// success status, such as a "page not found" answered with 200. It is
+	// empty for normal pages and when detection is off.
+	SoftError string
+	// OutlinkDomains counts Links by registrable domain. It is computed when
+	// the page is fetched, after links are rewritten.
+	OutlinkDomains *OutlinkDomains
+
+	// validators from the response, kept for the next conditional recrawl
+	etag         string
+	lastModified string
+	// redirectedTo is where the request ended up, nil when not redirected
+	redirectedTo *url.URL
+	// scriptPolicy overrides DefaultScriptPolicy while parsing, and
+	// scriptBytes counts the script content kept so far
+	scriptPolicy *ScriptPolicy
+	scriptBytes  int
 }
 
 func NewPage(loc *url.URL) *Page {
@@ -37,24 +96,100 @@ func urlsToStrings(urls []url.URL) []string {
 	return res
 }
 
+// dedupeLinks drops repeated links, keeping the first of each in order.
+// Rewriting can collapse distinct hrefs into one canonical url.
+func dedupeLinks(links []url.URL) []url.URL {
+	seen := make(map[string]bool, len(links))
+	kept := links[:0]
+	for _, link := range links {
+		key := link.String()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		kept = append(kept, link)
+	}
+	return kept
+}
+
 func (p *Page) Prefix() string {
 	return p.Location.Hostname()
 }
 
+var _ StoreItemMeta = (*Page)(nil)
+
+// Key is the hex SHA-256 of the page's url.
+func (p *Page) Key() string {
+	sum := sha256.Sum256([]byte(p.Location.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreatedAt is when the page was fetched, or the zero time if unknown.
+func (p *Page) CreatedAt() time.Time {
+	if p.Fetch == nil {
+		return time.Time{}
+	}
+	return p.Fetch.FetchedAt
+}
+
+// Labels holds the page's host, registrable domain, type, session and, when
+// fetched, media type.
+func (p *Page) Labels() map[string]string {
+	host := p.Location.Hostname()
+	labels := map[string]string{
+		"host":   host,
+		"domain": filter.RegistrableDomain(host),
+	}
+	if p.Type != "" {
+		labels["type"] = string(p.Type)
+	}
+	if p.Session != "" {
+		labels["session"] = p.Session
+	}
+	if p.Fetch != nil {
+		if mediaType, _, ok := parseContentType(p.Fetch.ContentType); ok {
+			labels["content_type"] = mediaType
+		}
+	}
+	return labels
+}
+
+// pageJSON is the wire format shared with fungicide.
+type pageJSON struct {
+	Title         string      `json:"title"`
+	Description   string      `json:"description"`
+	Author        string      `json:"author"`
+	Keywords      []string    `json:"keywords"`
+	Headings      []string    `json:"headings"`
+	Content       []string    `json:"content"`
+	Links         []string    `json:"links"`
+	ScriptLinks   []string    `json:"script_links"`
+	ScriptContent []string    `json:"script_content"`
+	Location      string      `json:"location"`
+	CreatedAt     int64       `json:"created_at"`
+	PageType      PageType    `json:"page_type,omitempty"`
+	Referrer      string      `json:"referrer,omitempty"`
+	Recrawl       bool        `json:"recrawl,omitempty"`
+	Trimmed       []string    `json:"trimmed,omitempty"`
+	Fetch         *fetchJSON  `json:"fetch,omitempty"`
+	Security      *Security   `json:"security,omitempty"`
+	Lang          string      `json:"lang,omitempty"`
+	Dir           string      `json:"dir,omitempty"`
+	HeadingDirs   []string    `json:"heading_dirs,omitempty"`
+	ContentDirs   []string    `json:"content_dirs,omitempty"`
+	Canonical     string      `json:"canonical,omitempty"`
+	Alternates    []Alternate `json:"alternates,omitempty"`
+	DownloadLinks []string    `json:"download_links,omitempty"`
+	Session       string      `json:"session,omitempty"`
+	SoftError     string      `json:"soft_error,omitempty"`
+	Redirects     []string    `json:"redirects,omitempty"`
+	Scripts       []Script    `json:"scripts,omitempty"`
+
+	OutlinkDomains *OutlinkDomains `json:"outlink_domains,omitempty"`
+}
+
 func (p *Page) Marshal() ([]byte, error) {
-	return json.Marshal(struct {
-		Title         string   `json:"title"`
-		Description   string   `json:"description"`
-		Author        string   `json:"author"`
-		Keywords      []string `json:"keywords"`
-		Headings      []string `json:"headings"`
-		Content       []string `json:"content"`
-		Links         []string `json:"links"`
-		ScriptLinks   []string `json:"script_links"`
-		ScriptContent []string `json:"script_content"`
-		Location      string   `json:"location"`
-		CreatedAt     int64    `json:"created_at"`
-	}{
+	return json.Marshal(pageJSON{
 		Title:         p.Title,
 		Description:   p.Description,
 		Author:        p.Author,
@@ -66,15 +201,99 @@ func (p *Page) Marshal() ([]byte, error) {
 		ScriptContent: p.ScriptContent,
 		Location:      p.Location.String(),
 		CreatedAt:     time.Now().UnixMilli(),
+		PageType:      p.Type,
+		Referrer:      p.Referrer,
+		Recrawl:       p.Recrawl,
+		Trimmed:       p.Trimmed,
+		Fetch:         p.Fetch.toJSON(),
+		Security:      p.Security,
+		Lang:          p.Lang,
+		Dir:           p.Dir,
+		HeadingDirs:   p.HeadingDirs,
+		ContentDirs:   p.ContentDirs,
+		Canonical:     p.Canonical,
+		Alternates:    p.Alternates,
+		DownloadLinks: urlsToStrings(p.DownloadLinks),
+		Session:       p.Session,
+		SoftError:     p.SoftError,
+		Redirects:     p.Redirects,
+		Scripts:       p.Scripts,
+
+		OutlinkDomains: p.OutlinkDomains,
 	})
 }
 
 func (p *Page) Unmarshal(data []byte) (*Page, error) {
-	var page Page
-	if err := json.Unmarshal(data, &page); err != nil {
+	return UnmarshalPage(data)
+}
+
+// UnmarshalPage is the inverse of Marshal.
+func UnmarshalPage(data []byte) (*Page, error) {
+	var raw pageJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal page: %w", err)
 	}
-	return &page, nil
+
+	location, err := url.Parse(raw.Location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal page location: %w", err)
+	}
+	links, err := stringsToUrls(raw.Links)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal page links: %w", err)
+	}
+	scriptLinks, err := stringsToUrls(raw.ScriptLinks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal page script links: %w", err)
+	}
+	downloadLinks, err := stringsToUrls(raw.DownloadLinks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal page download links: %w", err)
+	}
+
+	return &Page{
+		Title:         raw.Title,
+		Description:   raw.Description,
+		Author:        raw.Author,
+		Keywords:      raw.Keywords,
+		Headings:      raw.Headings,
+		Content:       raw.Content,
+		Links:         links,
+		ScriptLinks:   scriptLinks,
+		ScriptContent: raw.ScriptContent,
+		Location:      location,
+		Type:          raw.PageType,
+		Referrer:      raw.Referrer,
+		Recrawl:       raw.Recrawl,
+		Trimmed:       raw.Trimmed,
+		Fetch:         raw.Fetch.fetchInfo(),
+		Security:      raw.Security,
+		Lang:          raw.Lang,
+		Dir:           raw.Dir,
+		HeadingDirs:   raw.HeadingDirs,
+		ContentDirs:   raw.ContentDirs,
+		Canonical:     raw.Canonical,
+		Alternates:    raw.Alternates,
+		DownloadLinks: downloadLinks,
+		Session:       raw.Session,
+		SoftError:     raw.SoftError,
+		Redirects:     raw.Redirects,
+		Scripts:       raw.Scripts,
+
+		OutlinkDomains: raw.OutlinkDomains,
+	}, nil
+}
+
+func stringsToUrls(raw []string) ([]url.URL, error) {
+	var res []url.URL
+	for _, r := range raw {
+		u, err := url.Parse(r)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *u)
+	}
+	return res, nil
 }
 
 func (p *Page) String() string {
@@ -86,6 +305,12 @@ func (p *Page) String() string {
 	fmt.Fprintf(&b, "Title: %s\n", p.Title)
 	fmt.Fprintf(&b, "Description: %s\n", p.Description)
 	fmt.Fprintf(&b, "Author: %s\n", p.Author)
+	if p.Lang != "" || p.Dir != "" {
+		fmt.Fprintf(&b, "Lang: %s Dir: %s\n", p.Lang, p.Dir)
+	}
+	if p.SoftError != "" {
+		fmt.Fprintf(&b, "Soft error: %s\n", p.SoftError)
+	}
 
 	if len(p.Keywords) > 0 {
 		b.WriteString("Keywords:\n")
@@ -122,10 +347,24 @@ func (p *Page) String() string {
 		}
 	}
 
-	if len(p.ScriptContent) > 0 {
-		b.WriteString("Script Content:\n")
-		for i, sc := range p.ScriptContent {
-			fmt.Fprintf(&b, "  [%d] %s\n", i+1, sc)
+	if len(p.Redirects) > 0 {
+		b.WriteString("Redirects:\n")
+		for _, r := range p.Redirects {
+			fmt.Fprintf(&b, "  - %s\n", r)
+		}
+	}
+
+	if len(p.DownloadLinks) > 0 {
+		b.WriteString("Download Links:\n")
+		for _, dl := range p.DownloadLinks {
+			fmt.Fprintf(&b, "  - %s\n", dl.String())
+		}
+	}
+
+	if len(p.Scripts) > 0 {
+		b.WriteString("Scripts:\n")
+		for i, s := range p.Scripts {
+			fmt.Fprintf(&b, "  [%d] (%s) %s\n", i+1, s.Type, s.Content)
 		}
 	}
 
@@ -143,6 +382,13 @@ func (p *Page) NormalizePageURL(loc string) (*url.URL, error) {
 	if parsedUrl.Hostname() != "" {
 		return parsedUrl, nil
 	}
+	if strings.HasPrefix(trimmed, "#") {
+		// a fragment of this page, such as a hash route
+		withFragment := *p.Location
+		withFragment.Fragment = parsedUrl.Fragment
+		withFragment.RawFragment = parsedUrl.RawFragment
+		return &withFragment, nil
+	}
 
 	joined, err := url.JoinPath(p.Location.String(), parsedUrl.String())
 	if err != nil {
@@ -161,6 +407,8 @@ func (p *Page) ParseHtmlPage(r io.Reader) {
 	tokenizer := html.NewTokenizer(r)
 
 	var tag atom.Atom
+	var dir string
+	var scriptType string
 	for tokenizer.Err() == nil {
 		tt := tokenizer.Next()
 		switch tt {
@@ -169,18 +417,36 @@ func (p *Page) ParseHtmlPage(r io.Reader) {
 		case html.StartTagToken:
 			t := tokenizer.Token()
 			tag = t.DataAtom
+			dir = dirAttr(&t)
+			if tag == atom.Script {
+				scriptType = scriptTypeAttr(&t)
+			}
 			p.parseHtmlTagToken(&t, tag)
+		case html.SelfClosingTagToken:
+			// XHTML closes void elements like <meta />; they hold no text,
+			// so the enclosing tag stays current
+			t := tokenizer.Token()
+			p.parseHtmlTagToken(&t, t.DataAtom)
 		case html.TextToken:
 			t := tokenizer.Token()
-			p.parseHtmlTextToken(&t, tag)
+			if tag == atom.Script {
+				p.parseHtmlScriptContent(&t, scriptType)
+				continue
+			}
+			p.parseHtmlTextToken(&t, tag, dir)
 		}
 	}
+	p.finishDirections()
 }
 
 func (p *Page) parseHtmlTagToken(token *html.Token, tag atom.Atom) {
 	switch tag {
+	case atom.Html:
+		p.parseHtmlRoot(token)
 	case atom.A:
 		p.parseHtmlLink(token)
+	case atom.Link:
+		p.parseHtmlLinkTag(token)
 	case atom.Script:
 		p.parseHtmlScriptAttributes(token)
 	case atom.Meta:
@@ -188,26 +454,25 @@ func (p *Page) parseHtmlTagToken(token *html.Token, tag atom.Atom) {
 	}
 }
 
-func (p *Page) parseHtmlTextToken(token *html.Token, tag atom.Atom) {
+func (p *Page) parseHtmlTextToken(token *html.Token, tag atom.Atom, dir string) {
 	switch tag {
 	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
-		p.parseHtmlHeadings(token)
+		p.parseHtmlHeadings(token, dir)
 	case atom.Title:
 		p.parseHtmlTitle(token)
-	case atom.Script:
-		p.parseHtmlScriptContent(token)
 	case atom.P, atom.Span, atom.Pre, atom.Code,
 		atom.Em, atom.Strong, atom.B, atom.I, atom.Mark, atom.Small,
 		atom.Abbr, atom.Cite, atom.Q, atom.Blockquote, atom.Kbd, atom.Samp,
 		atom.Var, atom.Li, atom.Dt, atom.Dd, atom.Th, atom.Td, atom.Caption:
-		p.parseContent(token)
+		p.parseContent(token, dir)
 	}
 }
 
-func (p *Page) parseContent(t *html.Token) {
+func (p *Page) parseContent(t *html.Token, dir string) {
 	trimmed := strings.TrimSpace(t.Data)
 	if trimmed != "" {
 		p.Content = append(p.Content, trimmed)
+		p.ContentDirs = append(p.ContentDirs, dir)
 	}
 }
 
@@ -218,26 +483,42 @@ func (p *Page) parseHtmlTitle(t *html.Token) {
 	}
 }
 
-func (p *Page) parseHtmlHeadings(t *html.Token) {
+func (p *Page) parseHtmlHeadings(t *html.Token, dir string) {
 	trimmed := strings.TrimSpace(t.Data)
 	if trimmed != "" {
 		p.Headings = append(p.Headings, trimmed)
+		p.HeadingDirs = append(p.HeadingDirs, dir)
 	}
 }
 
+// downloadExtensions matches links to files the crawler would not fetch
+// anyway, using the same extensions the url filter blocks by default.
+var downloadExtensions = filter.NewExtensionFilter(filter.DefaultBlockedExtensions)
+
 func (p *Page) parseHtmlLink(t *html.Token) {
+	var hrefs []string
+	download := false
 	for _, a := range t.Attr {
-		if a.Key != "href" {
-			continue
+		switch a.Key {
+		case "href":
+			hrefs = append(hrefs, a.Val)
+		case "download":
+			download = true
 		}
+	}
 
-		normalizedUrl, err := p.NormalizePageURL(a.Val)
+	for _, href := range hrefs {
+		normalizedUrl, err := p.NormalizePageURL(href)
 		if err != nil {
-			fmt.Printf("error normalizing url: %v", err)
+			slog.Debug("error normalizing url", "error", err)
 			continue
 		}
 
-		p.Links = append(p.Links, *normalizedUrl)
+		if download || downloadExtensions.Filter(normalizedUrl) {
+			p.DownloadLinks = append(p.DownloadLinks, *normalizedUrl)
+		} else {
+			p.Links = append(p.Links, *normalizedUrl)
+		}
 	}
 }
 
@@ -268,10 +549,10 @@ func (p *Page) parseHtmlMeta(t *html.Token) {
 	}
 }
 
-func (p *Page) parseHtmlScriptContent(t *html.Token) {
+func (p *Page) parseHtmlScriptContent(t *html.Token, mediaType string) {
 	trimmed := strings.TrimSpace(t.Data)
 	if trimmed != "" {
-		p.ScriptContent = append(p.ScriptContent, trimmed)
+		p.addScript(mediaType, trimmed)
 	}
 }
 
@@ -283,7 +564,7 @@ func (p *Page) parseHtmlScriptAttributes(t *html.Token) {
 
 		normalizedUrl, err := p.NormalizePageURL(a.Val)
 		if err != nil {
-			fmt.Printf("error normalizing url: %v", err)
+			slog.Debug("error normalizing url", "error", err)
 			continue
 		}
 
@@ -0,0 +1,72 @@
+package crawler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type PageFilter interface {
+	Filter(page *Page) (drop bool, reason string)
+}
+
+type MinWordCountFilter struct {
+	minWords int
+}
+
+func NewMinWordCountFilter(minWords int) *MinWordCountFilter {
+	return &MinWordCountFilter{minWords: minWords}
+}
+
+func (f *MinWordCountFilter) Filter(page *Page) (bool, string) {
+	words := 0
+	for _, c := range page.Content {
+		words += len(strings.Fields(c))
+		if words >= f.minWords {
+			return false, ""
+		}
+	}
+	return true, fmt.Sprintf("word count %d below minimum %d", words, f.minWords)
+}
+
+type RegexPageFilter struct {
+	titlePatterns   []*regexp.Regexp
+	contentPatterns []*regexp.Regexp
+}
+
+// NewRegexPageFilter drops pages whose title matches any of titlePatterns or
+// whose content blocks match any of contentPatterns.
+func NewRegexPageFilter(titlePatterns, contentPatterns []string) (*RegexPageFilter, error) {
+	var f RegexPageFilter
+	for _, p := range titlePatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid title pattern %s: %w", p, err)
+		}
+		f.titlePatterns = append(f.titlePatterns, re)
+	}
+	for _, p := range contentPatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid content pattern %s: %w", p, err)
+		}
+		f.contentPatterns = append(f.contentPatterns, re)
+	}
+	return &f, nil
+}
+
+func (f *RegexPageFilter) Filter(page *Page) (bool, string) {
+	for _, re := range f.titlePatterns {
+		if re.MatchString(page.Title) {
+			return true, fmt.Sprintf("title matched %s", re.String())
+		}
+	}
+	for _, re := range f.contentPatterns {
+		for _, c := range page.Content {
+			if re.MatchString(c) {
+				return true, fmt.Sprintf("content matched %s", re.String())
+			}
+		}
+	}
+	return false, ""
+}
@@ -0,0 +1,89 @@
+package crawler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMinWordCountFilter(t *testing.T) {
+	f := NewMinWordCountFilter(5)
+
+	tests := []struct {
+		content []string
+		drop    bool
+	}{
+		{nil, true},
+		{[]string{"one two three four"}, true},
+		{[]string{"one two", "three four five"}, false},
+		{[]string{"  one   two\tthree\nfour five six "}, false},
+		{[]string{"", "   "}, true},
+	}
+	for _, tt := range tests {
+		drop, reason := f.Filter(&Page{Content: tt.content})
+		if drop != tt.drop {
+			t.Errorf("Filter(%q) drop = %t, want %t", tt.content, drop, tt.drop)
+		}
+		if drop && !strings.Contains(reason, "below minimum 5") {
+			t.Errorf("Filter(%q) reason = %q", tt.content, reason)
+		}
+		if !drop && reason != "" {
+			t.Errorf("Filter(%q) kept the page with reason %q", tt.content, reason)
+		}
+	}
+}
+
+func TestRegexPageFilter(t *testing.T) {
+	f, err := NewRegexPageFilter([]string{`(?i)cheap pills`, `^Casino`}, []string{`(?i)buy now!+`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		page   Page
+		drop   bool
+		reason string
+	}{
+		{Page{Title: "A history of bread", Content: []string{"flour and water"}}, false, ""},
+		{Page{Title: "CHEAP PILLS online"}, true, "title matched (?i)cheap pills"},
+		{Page{Title: "Casino bonus"}, true, "title matched ^Casino"},
+		{Page{Title: "Best Casino"}, false, ""},
+		{Page{Title: "News", Content: []string{"intro", "Buy Now!!!"}}, true, "content matched (?i)buy now!+"},
+		// title patterns are checked first
+		{Page{Title: "cheap pills", Content: []string{"buy now!"}}, true, "title matched (?i)cheap pills"},
+		// content patterns do not apply to the title
+		{Page{Title: "buy now!"}, false, ""},
+	}
+	for _, tt := range tests {
+		drop, reason := f.Filter(&tt.page)
+		if drop != tt.drop || reason != tt.reason {
+			t.Errorf("Filter(%q) = (%t, %q), want (%t, %q)", tt.page.Title, drop, reason, tt.drop, tt.reason)
+		}
+	}
+}
+
+func TestNewRegexPageFilterInvalidPattern(t *testing.T) {
+	if _, err := NewRegexPageFilter([]string{"("}, nil); err == nil {
+		t.Error("invalid title pattern accepted")
+	}
+	if _, err := NewRegexPageFilter(nil, []string{"[a-"}); err == nil {
+		t.Error("invalid content pattern accepted")
+	}
+}
+
+func TestFilterPageFirstDropWins(t *testing.T) {
+	spam, err := NewRegexPageFilter([]string{"spam"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewCrawler(nil, nil, WithPageFilters([]PageFilter{spam, NewMinWordCountFilter(3)}))
+
+	if drop, reason := c.filterPage(&Page{Title: "spam", Content: []string{"x"}}); !drop || reason != "title matched spam" {
+		t.Errorf("filterPage = (%t, %q), want the first filter's reason", drop, reason)
+	}
+	if drop, reason := c.filterPage(&Page{Title: "ok", Content: []string{"x"}}); !drop || !strings.HasPrefix(reason, "word count 1") {
+		t.Errorf("filterPage = (%t, %q), want the word count reason", drop, reason)
+	}
+	if drop, _ := c.filterPage(&Page{Title: "ok", Content: []string{"a b c"}}); drop {
+		t.Error("filterPage dropped a page no filter matched")
+	}
+}
@@ -0,0 +1,182 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustParse(t testing.TB, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// testPage has every field that goes over the wire set.
+func testPage(t *testing.T) *Page {
+	return &Page{
+		Title:          "Title",
+		Description:    "A page",
+		Author:         "Someone",
+		Keywords:       []string{"one", "two"},
+		Headings:       []string{"Heading"},
+		Content:        []string{"First paragraph", "Second paragraph"},
+		Links:          []url.URL{*mustParse(t, "https://example.com/a"), *mustParse(t, "https://example.org/b?c=d")},
+		ScriptLinks:    []url.URL{*mustParse(t, "https://cdn.example.com/app.js")},
+		ScriptContent:  []string{"console.log(1)", "{}"},
+		Scripts:        []Script{{Type: ScriptJavaScript, Content: "console.log(1)"}, {Type: ScriptJSON, MediaType: "application/ld+json", Content: "{}"}},
+		DownloadLinks:  []url.URL{*mustParse(t, "https://example.com/report.pdf")},
+		Location:       mustParse(t, "https://example.com/"),
+		Type:           PageTypeHTML,
+		Session:        "20240102T150405Z-1a2b3c4d",
+		SoftError:      "title contains \"page not found\"",
+		Redirects:      []string{"https://example.com/"},
+		OutlinkDomains: &OutlinkDomains{Internal: 2, External: map[string]int{"example.org": 1}},
+		Trimmed:        []string{"script_content"},
+		Referrer:       "https://example.org/",
+		Recrawl:        true,
+		Lang:           "en",
+		Dir:            DirLTR,
+		HeadingDirs:    []string{DirRTL},
+		ContentDirs:    []string{"", DirRTL},
+		Canonical:      "https://example.com/canonical",
+		Alternates:     []Alternate{{URL: "https://example.com/de/", HrefLang: "de"}, {URL: "https://example.com/feed", Type: "application/rss+xml"}},
+		Fetch: &FetchInfo{
+			StatusCode:   200,
+			ContentType:  "text/html",
+			FetchedAt:    time.UnixMilli(1700000000000),
+			Duration:     120 * time.Millisecond,
+			DNSLookup:    4 * time.Millisecond,
+			TLSHandshake: 30 * time.Millisecond,
+			RemoteAddr:   "93.184.216.34:443",
+			ConnReused:   true,
+			CacheStatus:  "HIT from squid",
+			Age:          42 * time.Second,
+		},
+		Security: &Security{
+			TLSVersion: "TLS 1.3",
+			ALPN:       "h2",
+			Subject:    "CN=example.com",
+			Issuer:     "CN=Example CA",
+			SANs:       []string{"example.com", "www.example.com"},
+			Server:     "nginx",
+		},
+	}
+}
+
+func TestUnmarshalPageRoundTrip(t *testing.T) {
+	page := testPage(t)
+	data, err := page.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := UnmarshalPage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, page) {
+		t.Errorf("round trip = %+v, want %+v", got, page)
+	}
+}
+
+func TestUnmarshalPageErrors(t *testing.T) {
+	for _, data := range []string{
+		`not json`,
+		`{"location": "%zz"}`,
+		`{"location": "https://example.com/", "links": ["%zz"]}`,
+		`{"location": "https://example.com/", "script_links": ["%zz"]}`,
+	} {
+		if _, err := UnmarshalPage([]byte(data)); err == nil {
+			t.Errorf("UnmarshalPage(%s) accepted", data)
+		}
+	}
+}
+
+func TestPageStoreItemMeta(t *testing.T) {
+	var item StoreItem = testPage(t)
+	meta, ok := item.(StoreItemMeta)
+	if !ok {
+		t.Fatal("Page does not implement StoreItemMeta")
+	}
+
+	if key := meta.Key(); len(key) != 64 || key != testPage(t).Key() {
+		t.Errorf("key %q is not a stable sha-256 hex digest", key)
+	}
+	other := testPage(t)
+	other.Location = mustParse(t, "https://example.com/other")
+	if other.Key() == meta.Key() {
+		t.Error("pages at different urls share a key")
+	}
+
+	if got := meta.CreatedAt(); !got.Equal(time.UnixMilli(1700000000000)) {
+		t.Errorf("created at %s, want the fetch time", got)
+	}
+	want := map[string]string{"host": "example.com", "domain": "example.com", "type": "html", "session": "20240102T150405Z-1a2b3c4d", "content_type": "text/html"}
+	if got := meta.Labels(); !reflect.DeepEqual(got, want) {
+		t.Errorf("labels %v, want %v", got, want)
+	}
+
+	// a page that was parsed but not fetched has no fetch metadata
+	parsed := NewPage(mustParse(t, "https://www.example.co.uk/"))
+	if !parsed.CreatedAt().IsZero() {
+		t.Errorf("unfetched page created at %s, want the zero time", parsed.CreatedAt())
+	}
+	want = map[string]string{"host": "www.example.co.uk", "domain": "example.co.uk"}
+	if got := parsed.Labels(); !reflect.DeepEqual(got, want) {
+		t.Errorf("labels %v, want %v", got, want)
+	}
+}
+
+func TestParseHtmlPageDownloadLinks(t *testing.T) {
+	page := NewPage(mustParse(t, "https://example.com/docs/"))
+	page.ParseHtmlPage(strings.NewReader(`<html><body>
+		<a href="guide">guide</a>
+		<a href="export" download>export</a>
+		<a href="notes.html" download="notes.html">notes</a>
+		<a href="https://example.com/files/Report.PDF">report</a>
+		<a href="https://dl.example.com/setup.EXE?v=2">installer</a>
+		<a href="https://example.com/pdf/latest">not a file</a>
+	</body></html>`))
+
+	var links, downloads []string
+	for _, link := range page.Links {
+		links = append(links, link.String())
+	}
+	for _, link := range page.DownloadLinks {
+		downloads = append(downloads, link.String())
+	}
+	if want := []string{"https://example.com/docs/guide", "https://example.com/pdf/latest"}; !slices.Equal(links, want) {
+		t.Errorf("links %q, want %q", links, want)
+	}
+	wantDownloads := []string{
+		"https://example.com/docs/export",
+		"https://example.com/docs/notes.html",
+		"https://example.com/files/Report.PDF",
+		"https://dl.example.com/setup.EXE?v=2",
+	}
+	if !slices.Equal(downloads, wantDownloads) {
+		t.Errorf("download links %q, want %q", downloads, wantDownloads)
+	}
+}
+
+func TestDownloadLinksAreNotQueued(t *testing.T) {
+	srv := httptest.NewServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><body><a href="/next">next</a><a href="/get" download>get</a><a href="/a.ZIP">zip</a></body></html>`)
+	}))
+	defer srv.Close()
+
+	cache := newMemCache()
+	crawlOnePage(t, cache, nil, srv.URL+"/")
+	if queued := queuedLocations(t, cache); !slices.Equal(queued, []string{srv.URL + "/next"}) {
+		t.Errorf("queued %q, want only the page link", queued)
+	}
+}
@@ -0,0 +1,207 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"mycelium/internal/filter"
+)
+
+// DelayCache is implemented by caches that can hold items until a later
+// time. It is required for the time windows of WithPoliteness.
+type DelayCache interface {
+	DelayItem(ctx context.Context, itemJSON string, until time.Time) error
+	DueDelayedItems(ctx context.Context, now time.Time, limit int64) ([]string, error)
+}
+
+// PolitenessProfile is the crawl budget agreed with the owner of a
+// registrable domain. Zero fields leave the crawler's settings in place.
+type PolitenessProfile struct {
+	// RPS replaces the WithDomainRateLimit and DomainOverride rate.
+	RPS float64
+	// Concurrency caps the requests in flight to the domain across every
+	// crawler sharing the cache, like WithHostSlots does per host.
+	Concurrency int
+	// Windows are the times of day the domain may be crawled, in Location.
+	// Items arriving outside every window are delayed until the next one
+	// opens. No windows allow crawling at any time.
+	Windows  []TimeWindow
+	Location *time.Location
+	// UserAgent replaces the user agent picked by the header chooser.
+	UserAgent string
+}
+
+// TimeWindow is a daily span between two offsets from midnight. A window
+// whose End is before its Start runs past midnight.
+type TimeWindow struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+func (w TimeWindow) contains(offset time.Duration) bool {
+	if w.Start <= w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// nextOpen returns now if the profile allows crawling at now, or else when
+// its next window opens.
+func (p *PolitenessProfile) nextOpen(now time.Time) time.Time {
+	if len(p.Windows) == 0 {
+		return now
+	}
+	loc := p.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	local := now.In(loc)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	offset := local.Sub(midnight)
+
+	var next time.Time
+	for _, w := range p.Windows {
+		if w.contains(offset) {
+			return now
+		}
+		opens := midnight.Add(w.Start)
+		if !opens.After(local) {
+			opens = midnight.AddDate(0, 0, 1).Add(w.Start)
+		}
+		if next.IsZero() || opens.Before(next) {
+			next = opens
+		}
+	}
+	return next
+}
+
+// Politeness holds the profiles used by WithPoliteness, keyed by registrable
+// domain. Reload swaps them while crawling.
+type Politeness struct {
+	profiles atomic.Pointer[map[string]PolitenessProfile]
+}
+
+func NewPoliteness(profiles map[string]PolitenessProfile) *Politeness {
+	p := &Politeness{}
+	p.Reload(profiles)
+	return p
+}
+
+// Reload atomically replaces the profiles.
+func (p *Politeness) Reload(profiles map[string]PolitenessProfile) {
+	normalized := make(map[string]PolitenessProfile, len(profiles))
+	for domain, profile := range profiles {
+		normalized[strings.ToLower(strings.TrimSpace(domain))] = profile
+	}
+	p.profiles.Store(&normalized)
+}
+
+// profileFor returns the profile of host's registrable domain, or nil. It is
+// safe to call on a nil Politeness.
+func (p *Politeness) profileFor(host string) *PolitenessProfile {
+	if p == nil {
+		return nil
+	}
+	profile, found := (*p.profiles.Load())[filter.RegistrableDomain(strings.ToLower(host))]
+	if !found {
+		return nil
+	}
+	return &profile
+}
+
+// WithPoliteness applies the profiles of p to the rate limiter, host slots
+// and user agent of requests to their domains, and holds items for domains
+// outside their time windows in the cache until the window opens.
+// PromoteDelayed moves them back to the ingress queue.
+func WithPoliteness(p *Politeness) CrawlerOption {
+	return func(c *Crawler) {
+		c.politeness = p
+	}
+}
+
+// setupPoliteness hands the profiles to the rate limiter.
+func (c *Crawler) setupPoliteness() {
+	if c.politeness == nil {
+		return
+	}
+	if c.domainLimiter == nil {
+		c.domainLimiter = newDomainLimiter(0)
+	}
+	c.domainLimiter.politeness = c.politeness
+}
+
+// outsideWindow returns when host's window next opens, or the zero time
+// when it may be crawled now. Without a cache that can delay items windows
+// are not enforced.
+func (c *Crawler) outsideWindow(host string) time.Time {
+	profile := c.politeness.profileFor(host)
+	if profile == nil {
+		return time.Time{}
+	}
+	if _, ok := c.cache.(DelayCache); !ok {
+		return time.Time{}
+	}
+	now := c.now()
+	if opens := profile.nextOpen(now); opens.After(now) {
+		return opens
+	}
+	return time.Time{}
+}
+
+// delay holds item in the cache until opens. It is unvisited so it is not
+// dropped as visited when it comes back, and requeued if the cache fails.
+func (c *Crawler) delay(ctx context.Context, item IngressItem, opens time.Time) {
+	if err := c.cache.Unvisit(ctx, item.Location); err != nil {
+		c.log(ctx).Error("failed to unvisit", "url", item.Location, "error", err)
+	}
+	itemJSON, _ := json.Marshal(item)
+	if err := c.cache.(DelayCache).DelayItem(ctx, string(itemJSON), opens); err != nil {
+		c.log(ctx).Error("failed to delay item, requeueing", "url", item.Location, "error", err)
+		c.requeue(ctx, item)
+		return
+	}
+	c.metrics.Incr(MetricItemsDelayed, 1)
+}
+
+// PromoteDelayed moves up to limit items whose time window has opened back
+// to the ingress queue and returns how many were queued.
+func (c *Crawler) PromoteDelayed(ctx context.Context, limit int64) (int, error) {
+	delayed, ok := c.cache.(DelayCache)
+	if !ok {
+		return 0, fmt.Errorf("cache cannot delay items")
+	}
+	if err := c.checkQueues(); err != nil {
+		return 0, err
+	}
+
+	now := c.now()
+	due, err := delayed.DueDelayedItems(ctx, now, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	promoted := 0
+	for _, itemJSON := range due {
+		var item IngressItem
+		if err := json.Unmarshal([]byte(itemJSON), &item); err == nil {
+			// the wait for the window is not queue latency
+			c.stampEnqueued(&item)
+			restamped, _ := json.Marshal(item)
+			itemJSON = string(restamped)
+		}
+		if err := c.cache.PushToMyceliumIngress(ctx, itemJSON, c.myceliumIngressKey); err != nil {
+			// claiming removed it, so hold it again for the next promotion
+			c.log(ctx).Error("failed to queue delayed item", "item", itemJSON, "error", err)
+			if err := delayed.DelayItem(ctx, itemJSON, now); err != nil {
+				c.log(ctx).Error("failed to delay unqueued item", "item", itemJSON, "error", err)
+			}
+			continue
+		}
+		promoted++
+	}
+	return promoted, nil
+}
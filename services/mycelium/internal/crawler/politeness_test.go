@@ -0,0 +1,264 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNextOpen(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no tz database:", err)
+	}
+	at := func(s string) time.Time {
+		t.Helper()
+		when, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return when
+	}
+	nightly := []TimeWindow{{Start: 22 * time.Hour, End: 6 * time.Hour}}
+	tests := []struct {
+		name    string
+		windows []TimeWindow
+		loc     *time.Location
+		now     string
+		want    string
+	}{
+		{name: "no windows", now: "2024-03-01T12:00:00Z", want: "2024-03-01T12:00:00Z"},
+		{name: "inside", windows: []TimeWindow{{Start: 9 * time.Hour, End: 17 * time.Hour}}, now: "2024-03-01T12:00:00Z", want: "2024-03-01T12:00:00Z"},
+		{name: "before today's window", windows: []TimeWindow{{Start: 9 * time.Hour, End: 17 * time.Hour}}, now: "2024-03-01T08:30:00Z", want: "2024-03-01T09:00:00Z"},
+		{name: "after today's window", windows: []TimeWindow{{Start: 9 * time.Hour, End: 17 * time.Hour}}, now: "2024-03-01T17:00:00Z", want: "2024-03-02T09:00:00Z"},
+		{name: "past midnight, late", windows: nightly, now: "2024-03-01T23:00:00Z", want: "2024-03-01T23:00:00Z"},
+		{name: "past midnight, early", windows: nightly, now: "2024-03-01T05:59:00Z", want: "2024-03-01T05:59:00Z"},
+		{name: "past midnight, closed", windows: nightly, now: "2024-03-01T12:00:00Z", want: "2024-03-01T22:00:00Z"},
+		{name: "earliest of several", windows: []TimeWindow{{Start: 20 * time.Hour, End: 21 * time.Hour}, {Start: 14 * time.Hour, End: 15 * time.Hour}}, now: "2024-03-01T12:00:00Z", want: "2024-03-01T14:00:00Z"},
+		// 22:00 in Berlin is 21:00 UTC in winter
+		{name: "time zone", windows: nightly, loc: berlin, now: "2024-03-01T20:00:00Z", want: "2024-03-01T21:00:00Z"},
+		{name: "time zone, open", windows: nightly, loc: berlin, now: "2024-03-01T21:30:00Z", want: "2024-03-01T21:30:00Z"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			profile := &PolitenessProfile{Windows: test.windows, Location: test.loc}
+			if got := profile.nextOpen(at(test.now)); !got.Equal(at(test.want)) {
+				t.Errorf("nextOpen(%s) = %s, want %s", test.now, got.UTC().Format(time.RFC3339), test.want)
+			}
+		})
+	}
+}
+
+func TestProfileForMatchesRegistrableDomain(t *testing.T) {
+	p := NewPoliteness(map[string]PolitenessProfile{" Example.com ": {RPS: 1}})
+	for host, want := range map[string]bool{
+		"example.com":     true,
+		"www.example.com": true,
+		"A.EXAMPLE.COM":   true,
+		"example.org":     false,
+		"notexample.com":  false,
+	} {
+		if got := p.profileFor(host) != nil; got != want {
+			t.Errorf("profileFor(%q) found = %t, want %t", host, got, want)
+		}
+	}
+
+	p.Reload(map[string]PolitenessProfile{"example.org": {RPS: 2}})
+	if p.profileFor("example.com") != nil {
+		t.Error("reload kept the old profile")
+	}
+	if profile := p.profileFor("www.example.org"); profile == nil || profile.RPS != 2 {
+		t.Errorf("reloaded profile = %+v", profile)
+	}
+
+	var none *Politeness
+	if none.profileFor("example.com") != nil {
+		t.Error("nil Politeness returned a profile")
+	}
+}
+
+// countUntilDelayed counts like CounterMetrics and cancels the crawl once an
+// item has been delayed.
+type countUntilDelayed struct {
+	*CounterMetrics
+	stop context.CancelFunc
+}
+
+func (m countUntilDelayed) Incr(name string, delta int64) {
+	m.CounterMetrics.Incr(name, delta)
+	if name == MetricItemsDelayed {
+		m.stop()
+	}
+}
+
+func TestPolitenessWindowDelaysItems(t *testing.T) {
+	fetched := 0
+	srv := httptest.NewServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {
+		fetched++
+		fmt.Fprint(w, "<html><body>page</body></html>")
+	}))
+	defer srv.Close()
+
+	// the fake clock starts at 22:14 UTC
+	clock := newFakeClock()
+	rc, mr := newRedisCache(t)
+	politeness := NewPoliteness(map[string]PolitenessProfile{
+		"127.0.0.1": {Windows: []TimeWindow{{Start: 2 * time.Hour, End: 4 * time.Hour}}},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	metrics := countUntilDelayed{NewCounterMetrics(), cancel}
+	c := NewCrawler(rc, nil, quiet, WithClock(clock.now), WithMyceliumIngressKey("ingress"),
+		WithMetrics(metrics), WithPoliteness(politeness))
+	item := IngressItem{Location: srv.URL + "/"}
+	if err := c.Enqueue(context.Background(), item); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() { done <- c.Crawl(ctx) }()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		cancel()
+		<-done
+		t.Fatal("timed out waiting for the item to be delayed")
+	}
+	if fetched != 0 {
+		t.Errorf("fetched %d times outside the window", fetched)
+	}
+
+	members, err := mr.ZMembers("delayed")
+	if err != nil || len(members) != 1 {
+		t.Fatalf("delayed = %q, %v, want the item", members, err)
+	}
+	score, _ := mr.ZScore("delayed", members[0])
+	opens := time.Date(2023, 11, 15, 2, 0, 0, 0, time.UTC)
+	if int64(score) != opens.Unix() {
+		t.Errorf("delayed until %s, want %s", time.Unix(int64(score), 0).UTC(), opens)
+	}
+
+	if n, err := c.PromoteDelayed(context.Background(), 10); err != nil || n != 0 {
+		t.Errorf("promoted %d, %v before the window opened", n, err)
+	}
+	clock.advance(4 * time.Hour)
+	if n, err := c.PromoteDelayed(context.Background(), 10); err != nil || n != 1 {
+		t.Fatalf("promoted %d, %v, want 1", n, err)
+	}
+	queued, _ := mr.List("ingress")
+	if len(queued) != 1 {
+		t.Fatalf("ingress = %q, want the promoted item", queued)
+	}
+	var back IngressItem
+	if err := json.Unmarshal([]byte(queued[0]), &back); err != nil || back.Location != item.Location {
+		t.Errorf("promoted %q, want %s", queued[0], item.Location)
+	}
+	if visited, _ := rc.IsVisited(context.Background(), item.Location); visited {
+		t.Error("delayed item is still marked visited, it would be dropped when it comes back")
+	}
+}
+
+func TestPromoteDelayedKeepsUnqueuedItems(t *testing.T) {
+	clock := newFakeClock()
+	rc, mr := newRedisCache(t)
+	c := NewCrawler(rc, nil, quiet, WithClock(clock.now), WithMyceliumIngressKey("ingress"))
+	ctx := context.Background()
+
+	itemJSON := `{"location":"https://example.com/"}`
+	if err := rc.DelayItem(ctx, itemJSON, clock.now()); err != nil {
+		t.Fatal(err)
+	}
+	// a string where the ingress list should be makes every push fail
+	mr.Set("ingress", "not a list")
+	if n, err := c.PromoteDelayed(ctx, 10); err != nil || n != 0 {
+		t.Fatalf("PromoteDelayed = %d, %v; want 0, nil", n, err)
+	}
+	if members, _ := mr.ZMembers("delayed"); len(members) != 1 {
+		t.Fatalf("delayed = %q, want the unqueued item held again", members)
+	}
+
+	mr.Del("ingress")
+	if n, err := c.PromoteDelayed(ctx, 10); err != nil || n != 1 {
+		t.Fatalf("retry PromoteDelayed = %d, %v; want 1, nil", n, err)
+	}
+	if queued := ingressItems(t, mr); len(queued) != 1 || queued[0].Location != "https://example.com/" {
+		t.Errorf("ingress = %+v, want the item", queued)
+	}
+}
+
+func TestPolitenessUserAgent(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {
+		got = r.UserAgent()
+		fmt.Fprint(w, "<html><body>page</body></html>")
+	}))
+	defer srv.Close()
+
+	politeness := NewPoliteness(map[string]PolitenessProfile{"127.0.0.1": {UserAgent: "ExampleBot/1.0"}})
+	c := NewCrawler(nil, nil, quiet, WithPoliteness(politeness))
+	if _, err := getPage(t, c, srv.URL+"/"); err != nil {
+		t.Fatal(err)
+	}
+	if got != "ExampleBot/1.0" {
+		t.Errorf("user agent %q, want the profile's", got)
+	}
+
+	politeness.Reload(nil)
+	if _, err := getPage(t, c, srv.URL+"/"); err != nil {
+		t.Fatal(err)
+	}
+	if got != defaultUserAgent {
+		t.Errorf("user agent %q after reload, want the default", got)
+	}
+}
+
+func TestPolitenessConcurrencySharesDomainSlots(t *testing.T) {
+	rc, _ := newRedisCache(t)
+	politeness := NewPoliteness(map[string]PolitenessProfile{"example.com": {Concurrency: 1}})
+	c := NewCrawler(rc, nil, quiet, WithPoliteness(politeness), WithHostSlots(0, time.Minute))
+	ctx := context.Background()
+
+	release, ok := c.acquireHostSlot(ctx, "a.example.com")
+	if !ok {
+		t.Fatal("no slot for the first host")
+	}
+	if _, ok := c.acquireHostSlot(ctx, "b.example.com"); ok {
+		t.Error("second host of the domain got a slot beyond the profile concurrency")
+	}
+	if _, ok := c.acquireHostSlot(ctx, "example.org"); !ok {
+		t.Error("domain without a profile was limited")
+	}
+	release()
+	if _, ok := c.acquireHostSlot(ctx, "b.example.com"); !ok {
+		t.Error("released slot was not handed out")
+	}
+}
+
+func TestPolitenessRateLimit(t *testing.T) {
+	l := newDomainLimiter(0)
+	l.politeness = NewPoliteness(map[string]PolitenessProfile{"example.com": {RPS: 20}})
+
+	start := time.Now()
+	for _, host := range []string{"example.com", "www.example.com", "a.example.com"} {
+		if err := l.wait(context.Background(), host); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("three requests at 20 rps took %s, want at least 100ms", elapsed)
+	}
+
+	start = time.Now()
+	for range 3 {
+		if err := l.wait(context.Background(), "example.org"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Errorf("unlimited domain waited %s", elapsed)
+	}
+}
@@ -0,0 +1,120 @@
+package crawler
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"mycelium/internal/filter"
+)
+
+// WithProxyBypass fetches hosts under domains directly instead of through
+// the proxy chooser. Entries match like the domain blacklist: a registrable
+// domain covers its subdomains. A nil list defaults to NO_PROXY.
+func WithProxyBypass(domains []string) CrawlerOption {
+	return func(c *Crawler) {
+		c.proxyBypass = domains
+	}
+}
+
+// noProxyDomains reads NO_PROXY as domain entries. Ports and leading dots are
+// dropped, and entries a DomainFilter cannot express, such as CIDR ranges,
+// are skipped.
+func noProxyDomains() (domains []string, all bool) {
+	noProxy := os.Getenv("NO_PROXY")
+	if noProxy == "" {
+		noProxy = os.Getenv("no_proxy")
+	}
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "*" {
+			return nil, true
+		}
+		if host, _, err := net.SplitHostPort(entry); err == nil {
+			entry = host
+		}
+		entry = strings.TrimPrefix(strings.TrimPrefix(entry, "*"), ".")
+		if entry == "" || filter.ValidateDomainEntry(entry) != nil {
+			continue
+		}
+		domains = append(domains, entry)
+	}
+	return domains, false
+}
+
+// proxyFunc picks a proxy for each request: the domain override's, none
+// for bypassed hosts, else one from the proxy chooser. Without a chooser it
+// falls back to the transport's own proxy function, which may be nil.
+func (c *Crawler) proxyFunc(fallback func(*http.Request) (*url.URL, error)) func(*http.Request) (*url.URL, error) {
+	pick := fallback
+	if c.proxyChooser != nil {
+		pick = c.chooserProxyFunc()
+	}
+	if !c.hasOverrideProxies() {
+		return pick
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		if o := c.overrideFor(req.URL.Hostname()); o != nil && o.proxy != nil {
+			recordProxy(req, o.proxy)
+			return o.proxy, nil
+		}
+		if pick == nil {
+			return nil, nil
+		}
+		return pick(req)
+	}
+}
+
+// chooserProxyFunc picks from the proxy chooser, or none for bypassed hosts.
+func (c *Crawler) chooserProxyFunc() func(*http.Request) (*url.URL, error) {
+	domains, bypassAll := c.proxyBypass, false
+	if domains == nil {
+		domains, bypassAll = noProxyDomains()
+	}
+	var bypass *filter.DomainFilter
+	if len(domains) > 0 {
+		var err error
+		if bypass, err = filter.NewDomainFilter(domains); err != nil {
+			c.logger.Error("invalid proxy bypass list, proxying every request", "error", err)
+			bypass = nil
+		}
+	}
+	if bypassAll {
+		c.logger.Warn("NO_PROXY is *, proxy chooser disabled")
+	}
+
+	pick := proxyURL(c.proxyChooser)
+	return func(req *http.Request) (*url.URL, error) {
+		if bypassAll || (bypass != nil && bypass.Filter(req.URL)) {
+			return nil, nil
+		}
+		return pick(req)
+	}
+}
+
+func proxyURL(proxyChooser StringChooser) func(*http.Request) (*url.URL, error) {
+	urlChooser, parsed := proxyChooser.(ProxyURLChooser)
+	return func(req *http.Request) (*url.URL, error) {
+		var proxy *url.URL
+		if parsed {
+			proxy = urlChooser.PickURL()
+		} else {
+			var err error
+			if proxy, err = url.Parse(proxyChooser.Pick()); err != nil {
+				return nil, fmt.Errorf("invalid proxy url: %w", err)
+			}
+		}
+		recordProxy(req, proxy)
+		return proxy, nil
+	}
+}
+
+// recordProxy tells GetPage which proxy req went through.
+func recordProxy(req *http.Request, proxy *url.URL) {
+	if used, ok := req.Context().Value(proxyUsedKey{}).(**url.URL); ok {
+		*used = proxy
+	}
+}
@@ -0,0 +1,92 @@
+package crawler
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestProxyBypass(t *testing.T) {
+	t.Setenv("NO_PROXY", "")
+	t.Setenv("no_proxy", "")
+	tests := []struct {
+		name    string
+		bypass  []string
+		noProxy string
+		direct  []string
+		proxied []string
+	}{
+		{
+			name:    "bypass list",
+			bypass:  []string{"internal.example", "partner.test"},
+			direct:  []string{"https://internal.example/", "https://api.internal.example/v1", "http://partner.test:8080/"},
+			proxied: []string{"https://example.com/", "https://notinternal.example/"},
+		},
+		{
+			name:    "no proxy default",
+			noProxy: "internal.example, .partner.test:443,10.0.0.0/8",
+			direct:  []string{"https://a.internal.example/", "https://partner.test/"},
+			proxied: []string{"https://example.com/", "http://10.1.2.3/"},
+		},
+		{
+			name:    "explicit list overrides no proxy",
+			bypass:  []string{"partner.test"},
+			noProxy: "internal.example",
+			direct:  []string{"https://partner.test/"},
+			proxied: []string{"https://internal.example/"},
+		},
+		{
+			name:    "no proxy wildcard",
+			noProxy: "*",
+			direct:  []string{"https://example.com/", "https://internal.example/"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("NO_PROXY", test.noProxy)
+			opts := []CrawlerOption{quiet, WithProxyChooser(fixedChooser("http://proxy.test:3128"))}
+			if test.bypass != nil {
+				opts = append(opts, WithProxyBypass(test.bypass))
+			}
+			proxy := NewCrawler(nil, nil, opts...).proxyFunc(nil)
+
+			check := func(location string, wantDirect bool) {
+				req, err := http.NewRequest(http.MethodGet, location, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := proxy(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if wantDirect && got != nil {
+					t.Errorf("%s went through %s, want a direct connection", location, got)
+				}
+				if !wantDirect && (got == nil || got.Host != "proxy.test:3128") {
+					t.Errorf("%s used proxy %v, want proxy.test:3128", location, got)
+				}
+			}
+			for _, location := range test.direct {
+				check(location, true)
+			}
+			for _, location := range test.proxied {
+				check(location, false)
+			}
+		})
+	}
+}
+
+func TestDirectRequestsAreCounted(t *testing.T) {
+	t.Setenv("NO_PROXY", "")
+	t.Setenv("no_proxy", "")
+	srv := typedServer(t, "text/html", "<html><body>direct</body></html>")
+	metrics := NewCounterMetrics()
+	c := NewCrawler(nil, nil, quiet, WithMetrics(metrics),
+		WithProxyChooser(fixedChooser("http://proxy.test:3128")),
+		WithProxyBypass([]string{"127.0.0.1"}))
+	if _, err := getPage(t, c, srv.URL+"/"); err != nil {
+		t.Fatal(err)
+	}
+	if direct, proxied := metrics.Get(MetricRequestsDirect), metrics.Get(MetricRequestsProxied); direct != 1 || proxied != 0 {
+		t.Errorf("direct %d, proxied %d; want the bypassed request counted as direct", direct, proxied)
+	}
+}
@@ -0,0 +1,64 @@
+package crawler
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// stampEnqueued records on item that it is being pushed to the ingress queue
+// now, so the crawler that pops it can tell how long it waited.
+func (c *Crawler) stampEnqueued(item *IngressItem) {
+	item.EnqueuedAt = c.now().UnixMilli()
+}
+
+// observeQueueLatency records how long a popped item waited since it was
+// last pushed. Items from producers that do not stamp them are skipped.
+func (c *Crawler) observeQueueLatency(item IngressItem) {
+	if item.EnqueuedAt <= 0 {
+		return
+	}
+	// clocks of different producers may disagree
+	latency := max(c.now().Sub(time.UnixMilli(item.EnqueuedAt)), 0)
+	observe(c.metrics, MetricQueueLatency, latency)
+	c.stats.queueLatency.add(latency)
+}
+
+// latencySamples keeps the most recent queue latencies for the quantiles in
+// Stats.
+type latencySamples struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+func (l *latencySamples) add(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.samples) < queueLatencySamples {
+		l.samples = append(l.samples, d)
+		return
+	}
+	l.samples[l.next] = d
+	l.next = (l.next + 1) % queueLatencySamples
+}
+
+// quantiles returns the nearest rank quantile of the samples for each q in
+// qs, or zeros when there are none.
+func (l *latencySamples) quantiles(qs ...float64) []time.Duration {
+	l.mu.Lock()
+	sorted := slices.Clone(l.samples)
+	l.mu.Unlock()
+	slices.Sort(sorted)
+
+	result := make([]time.Duration, len(qs))
+	if len(sorted) == 0 {
+		return result
+	}
+	for i, q := range qs {
+		rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+		result[i] = sorted[min(max(rank, 0), len(sorted)-1)]
+	}
+	return result
+}
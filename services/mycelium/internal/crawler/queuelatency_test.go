@@ -0,0 +1,86 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestLatencySamplesQuantiles(t *testing.T) {
+	var l latencySamples
+	if got := l.quantiles(0.5, 0.95); got[0] != 0 || got[1] != 0 {
+		t.Errorf("quantiles without samples = %v, want zeros", got)
+	}
+
+	// added out of order to check they are sorted
+	for i := 100; i > 0; i-- {
+		l.add(time.Duration(i) * time.Millisecond)
+	}
+	got := l.quantiles(0.5, 0.95, 1)
+	if want := []time.Duration{50 * time.Millisecond, 95 * time.Millisecond, 100 * time.Millisecond}; got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("quantiles = %v, want %v", got, want)
+	}
+
+	// the oldest samples give way to new ones
+	for range queueLatencySamples {
+		l.add(time.Second)
+	}
+	if got := l.quantiles(0); got[0] != time.Second {
+		t.Errorf("minimum after a full ring of 1s samples = %s", got[0])
+	}
+}
+
+func TestObserveQueueLatency(t *testing.T) {
+	clock := newFakeClock()
+	metrics := NewCounterMetrics()
+	c := NewCrawler(newMemCache(), nil, quiet, WithClock(clock.now), WithMetrics(metrics))
+
+	now := clock.now()
+	for _, item := range []IngressItem{
+		{Location: "https://example.com/a", EnqueuedAt: now.Add(-3 * time.Second).UnixMilli()},
+		{Location: "https://example.com/b", EnqueuedAt: now.Add(-1 * time.Second).UnixMilli()},
+		// from a producer that does not stamp items
+		{Location: "https://example.com/c"},
+		// from a producer whose clock runs ahead
+		{Location: "https://example.com/d", EnqueuedAt: now.Add(time.Minute).UnixMilli()},
+	} {
+		c.observeQueueLatency(item)
+	}
+
+	hist := metrics.Histograms()[MetricQueueLatency]
+	if hist.Count != 3 || hist.Sum != 4*time.Second {
+		t.Errorf("histogram counted %d items waiting %s, want 3 waiting 4s", hist.Count, hist.Sum)
+	}
+	stats := c.Stats()
+	if stats.QueueLatencyP50 != time.Second || stats.QueueLatencyP95 != 3*time.Second {
+		t.Errorf("p50 %s p95 %s, want 1s and 3s", stats.QueueLatencyP50, stats.QueueLatencyP95)
+	}
+}
+
+func TestRetryRestampsEnqueueTime(t *testing.T) {
+	clock := newFakeClock()
+	cache := newMemCache()
+	c := NewCrawler(cache, nil, quiet, WithClock(clock.now), WithMyceliumIngressKey("ingress"), WithMaxRetries(3))
+	if err := c.Enqueue(context.Background(), IngressItem{Location: "https://example.com/"}); err != nil {
+		t.Fatal(err)
+	}
+	var item IngressItem
+	if err := json.Unmarshal([]byte(cache.queue("ingress")[0]), &item); err != nil {
+		t.Fatal(err)
+	}
+	if item.EnqueuedAt != clock.now().UnixMilli() {
+		t.Fatalf("enqueued at %d, want %d", item.EnqueuedAt, clock.now().UnixMilli())
+	}
+
+	cache.PopFromMyceliumIngress(context.Background(), "ingress")
+	clock.advance(time.Hour)
+	c.retry(context.Background(), item, errInjected)
+	var retried IngressItem
+	if err := json.Unmarshal([]byte(cache.queue("ingress")[0]), &retried); err != nil {
+		t.Fatal(err)
+	}
+	if retried.EnqueuedAt != clock.now().UnixMilli() {
+		t.Errorf("retry enqueued at %d, want the retry time %d, not the original", retried.EnqueuedAt, clock.now().UnixMilli())
+	}
+}
@@ -0,0 +1,168 @@
+package crawler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"mycelium/internal/filter"
+)
+
+// domainLimiter spaces requests to the same registrable domain at least
+// interval apart, across every worker sharing the crawler.
+type domainLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	// intervals override interval for single domains
+	intervals map[string]time.Duration
+	next      map[string]time.Time
+	// politeness profile rates take precedence over intervals
+	politeness *Politeness
+}
+
+// newDomainLimiter limits every domain to rps. A non-positive rps only
+// limits domains given a rate with setRate.
+func newDomainLimiter(rps float64) *domainLimiter {
+	l := &domainLimiter{
+		intervals: map[string]time.Duration{},
+		next:      map[string]time.Time{},
+	}
+	if rps > 0 {
+		l.interval = time.Duration(float64(time.Second) / rps)
+	}
+	return l
+}
+
+// setRate limits domain to rps instead of the shared rate. It must be called
+// before the limiter is used.
+func (l *domainLimiter) setRate(domain string, rps float64) {
+	l.intervals[domain] = time.Duration(float64(time.Second) / rps)
+}
+
+// wait blocks until a request to host may be made or ctx is done.
+func (l *domainLimiter) wait(ctx context.Context, host string) error {
+	domain := filter.RegistrableDomain(host)
+	now := time.Now()
+
+	l.mu.Lock()
+	if len(l.next) >= domainLimiterCapacity {
+		l.prune(now)
+	}
+	slot := l.next[domain]
+	if slot.Before(now) {
+		slot = now
+	}
+	interval, found := l.intervals[domain]
+	if !found {
+		interval = l.interval
+	}
+	if profile := l.politeness.profileFor(domain); profile != nil && profile.RPS > 0 {
+		interval = time.Duration(float64(time.Second) / profile.RPS)
+	}
+	l.next[domain] = slot.Add(interval)
+	l.mu.Unlock()
+
+	delay := slot.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// prune drops domains whose next slot has already passed, since they would
+// be allowed immediately anyway.
+func (l *domainLimiter) prune(now time.Time) {
+	for domain, slot := range l.next {
+		if slot.Before(now) {
+			delete(l.next, domain)
+		}
+	}
+}
+
+// pending returns the number of domains whose next request slot is still in
+// the future.
+func (l *domainLimiter) pending() int {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := 0
+	for _, slot := range l.next {
+		if slot.After(now) {
+			n++
+		}
+	}
+	return n
+}
+
+// ready reports whether a request to host would go out without waiting.
+func (l *domainLimiter) ready(host string) bool {
+	domain := filter.RegistrableDomain(host)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return !l.next[domain].After(time.Now())
+}
+
+// globalLimiter caps requests across every domain and worker at a steady
+// rate, letting up to burst through at once after a quiet spell.
+type globalLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	// tolerance is how far ahead of the steady rate a burst may run
+	tolerance time.Duration
+	// next is when the next request would be due at the steady rate
+	next time.Time
+}
+
+func newGlobalLimiter(rps float64, burst int) *globalLimiter {
+	interval := time.Duration(float64(time.Second) / rps)
+	return &globalLimiter{interval: interval, tolerance: interval * time.Duration(max(burst, 1)-1)}
+}
+
+// wait blocks until a request may be made or ctx is done. The slot is
+// reserved under the lock, so concurrent callers never overshoot the rate.
+func (l *globalLimiter) wait(ctx context.Context) error {
+	now := time.Now()
+
+	l.mu.Lock()
+	due := l.next
+	if due.Before(now) {
+		due = now
+	}
+	reserved := due.Add(l.interval)
+	l.next = reserved
+	l.mu.Unlock()
+
+	delay := due.Sub(now) - l.tolerance
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		l.cancel(due, reserved)
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// cancel hands back a slot reserved by a wait that gave up. Only the latest
+// reservation can be returned: later callers have already scheduled around
+// an earlier one, and moving next back under them would let two requests
+// share a slot.
+func (l *globalLimiter) cancel(due, reserved time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.next.Equal(reserved) {
+		l.next = due
+	}
+}
@@ -0,0 +1,230 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDomainLimiterSpacesRequests(t *testing.T) {
+	l := newDomainLimiter(20) // one request every 50ms per domain
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, host := range []string{"a.example.com", "b.example.com", "example.com", "www.example.com"} {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			if err := l.wait(context.Background(), host); err != nil {
+				t.Error(err)
+			}
+		}(host)
+	}
+	wg.Wait()
+
+	// four hosts on one registrable domain share its budget
+	if elapsed := time.Since(start); elapsed < 140*time.Millisecond {
+		t.Errorf("four requests to one domain took %s, want at least 150ms", elapsed)
+	}
+
+	// another domain is not held up
+	start = time.Now()
+	if err := l.wait(context.Background(), "other.example.org"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Errorf("first request to a new domain waited %s", elapsed)
+	}
+}
+
+func TestDomainLimiterWaitCancelled(t *testing.T) {
+	l := newDomainLimiter(0.1) // one request every 10s
+	if err := l.wait(context.Background(), "example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.wait(ctx, "example.com"); err != context.DeadlineExceeded {
+		t.Errorf("wait = %v, want the context error", err)
+	}
+}
+
+func TestDomainLimiterPrunesPassedSlots(t *testing.T) {
+	l := newDomainLimiter(1000)
+	now := time.Now()
+	l.next["stale.example"] = now.Add(-time.Second)
+	l.next["pending.example"] = now.Add(time.Second)
+
+	l.prune(now)
+	if _, found := l.next["stale.example"]; found {
+		t.Error("passed slot kept")
+	}
+	if _, found := l.next["pending.example"]; !found {
+		t.Error("pending slot pruned")
+	}
+}
+
+func TestWithDomainRateLimitDisabled(t *testing.T) {
+	if c := NewCrawler(nil, nil, WithDomainRateLimit(0)); c.domainLimiter != nil {
+		t.Error("rate limit of 0 did not disable the limiter")
+	}
+	if c := NewCrawler(nil, nil, WithDomainRateLimit(2), WithDomainRateLimit(-1)); c.domainLimiter != nil {
+		t.Error("a later non-positive rate limit did not disable the limiter")
+	}
+}
+
+func TestGlobalLimiterAggregateRate(t *testing.T) {
+	const (
+		rps      = 100
+		workers  = 8
+		requests = 60
+	)
+	l := newGlobalLimiter(rps, 1)
+
+	var wg sync.WaitGroup
+	jobs := make(chan struct{}, requests)
+	for i := 0; i < requests; i++ {
+		jobs <- struct{}{}
+	}
+	close(jobs)
+
+	start := time.Now()
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				if err := l.wait(context.Background()); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	// the first request goes out at once, every later one a full interval
+	// after the previous
+	want := time.Duration(requests-1) * time.Second / rps
+	if elapsed < want*9/10 || elapsed > want+250*time.Millisecond {
+		t.Errorf("%d requests at %d rps took %s, want about %s", requests, rps, elapsed, want)
+	}
+}
+
+func TestGlobalLimiterBurst(t *testing.T) {
+	l := newGlobalLimiter(10, 5)
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := l.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("burst of 5 took %s, want immediate", elapsed)
+	}
+
+	start = time.Now()
+	if err := l.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("request after the burst took %s, want about 100ms", elapsed)
+	}
+}
+
+func TestGlobalLimiterCancelReturnsSlot(t *testing.T) {
+	l := newGlobalLimiter(1, 1)
+	if err := l.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	l.mu.Lock()
+	before := l.next
+	l.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wait = %v, want deadline exceeded", err)
+	}
+
+	l.mu.Lock()
+	after := l.next
+	l.mu.Unlock()
+	if !after.Equal(before) {
+		t.Errorf("next = %s after a cancelled wait, want %s", after, before)
+	}
+}
+
+func TestGlobalLimiterCancelKeepsLaterReservations(t *testing.T) {
+	l := newGlobalLimiter(10, 1)
+	if err := l.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- l.wait(ctx) }()
+	// let the doomed wait reserve its slot before a later caller queues
+	// behind it
+	time.Sleep(10 * time.Millisecond)
+	later := make(chan error)
+	go func() { later <- l.wait(context.Background()) }()
+	time.Sleep(10 * time.Millisecond)
+
+	l.mu.Lock()
+	before := l.next
+	l.mu.Unlock()
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("wait = %v, want canceled", err)
+	}
+	l.mu.Lock()
+	after := l.next
+	l.mu.Unlock()
+	if !after.Equal(before) {
+		t.Errorf("next moved from %s to %s under a later reservation", before, after)
+	}
+	if err := <-later; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGlobalAndDomainLimitsCompose(t *testing.T) {
+	global := newGlobalLimiter(100, 1)
+	domain := newDomainLimiter(10)
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := global.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if err := domain.wait(context.Background(), "www.example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the stricter per domain limit sets the pace
+	want := 400 * time.Millisecond
+	if elapsed := time.Since(start); elapsed < want*9/10 || elapsed > want+200*time.Millisecond {
+		t.Errorf("5 requests to one domain took %s, want about %s", elapsed, want)
+	}
+}
+
+func TestDomainLimiterPending(t *testing.T) {
+	l := newDomainLimiter(1)
+	if n := l.pending(); n != 0 {
+		t.Errorf("pending = %d before any request, want 0", n)
+	}
+	for _, host := range []string{"a.example.com", "b.example.com", "example.org"} {
+		if err := l.wait(context.Background(), host); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the two example.com hosts share a domain, and so a slot
+	if n := l.pending(); n != 2 {
+		t.Errorf("pending = %d, want 2 domains", n)
+	}
+}
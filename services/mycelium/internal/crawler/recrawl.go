@@ -0,0 +1,248 @@
+package crawler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"mycelium/internal/filter"
+)
+
+// errNotModified marks a conditional recrawl answered with 304.
+var errNotModified = errors.New("not modified")
+
+// RecrawlCache is implemented by caches that can keep a recrawl schedule and
+// conditional GET validators. It is required by WithRecrawl.
+type RecrawlCache interface {
+	ScheduleRecrawl(ctx context.Context, location string, itemJSON string, due time.Time) error
+	DueRecrawls(ctx context.Context, now time.Time, limit int64) (locations []string, items []string, err error)
+	SetValidators(ctx context.Context, location string, etag string, lastModified string) error
+	Validators(ctx context.Context, location string) (etag string, lastModified string, err error)
+}
+
+// ContentHashCache is implemented by caches that can keep the content hash
+// of each crawled page next to its validators. It is required by
+// WithChangeDetection.
+type ContentHashCache interface {
+	SetContentHash(ctx context.Context, location string, hash string) error
+	ContentHash(ctx context.Context, location string) (string, error)
+}
+
+// RecrawlPolicy sets how long a crawled page stays fresh. Domains overrides
+// After per registrable domain; a zero or missing entry falls back to After.
+type RecrawlPolicy struct {
+	After   time.Duration
+	Domains map[string]time.Duration
+}
+
+func (p *RecrawlPolicy) freshFor(host string) time.Duration {
+	if ttl := p.Domains[filter.RegistrableDomain(host)]; ttl > 0 {
+		return ttl
+	}
+	return p.After
+}
+
+// WithRecrawl schedules every fetched page to be crawled again once it is
+// no longer fresh. PromoteRecrawls moves due pages back to the ingress
+// queue. The crawler cache must implement RecrawlCache.
+func WithRecrawl(policy RecrawlPolicy) CrawlerOption {
+	return func(c *Crawler) {
+		c.recrawl = &policy
+	}
+}
+
+// WithChangeDetection hashes the content of every fetched page. A recrawl
+// whose content hashes the same as last time is handled like a 304: it is
+// rescheduled but neither stored nor sent to fungicide. This catches
+// unchanged pages from servers that ignore conditional requests. The crawler
+// cache must implement ContentHashCache.
+func WithChangeDetection(enabled bool) CrawlerOption {
+	return func(c *Crawler) {
+		c.changeDetection = enabled
+	}
+}
+
+// conditional holds the validators sent with a recrawl.
+type conditional struct {
+	etag         string
+	lastModified string
+}
+
+type conditionalKey struct{}
+
+func (c *Crawler) recrawlCache() (RecrawlCache, bool) {
+	if c.recrawl == nil {
+		return nil, false
+	}
+	recrawls, ok := c.cache.(RecrawlCache)
+	return recrawls, ok
+}
+
+// withValidators attaches the stored validators of a recrawled item so
+// GetPage sends a conditional request.
+func (c *Crawler) withValidators(ctx context.Context, cacheCtx context.Context, item IngressItem) context.Context {
+	recrawls, ok := c.recrawlCache()
+	if !ok || !item.Recrawl {
+		return ctx
+	}
+	etag, lastModified, err := recrawls.Validators(cacheCtx, item.Location)
+	if err != nil {
+		c.log(ctx).Error("failed to read validators", "url", item.Location, "error", err)
+		return ctx
+	}
+	if etag == "" && lastModified == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, conditionalKey{}, conditional{etag: etag, lastModified: lastModified})
+}
+
+func setConditionalHeaders(ctx context.Context, req *http.Request) {
+	cond, ok := ctx.Value(conditionalKey{}).(conditional)
+	if !ok {
+		return
+	}
+	if cond.etag != "" {
+		req.Header.Set("If-None-Match", cond.etag)
+	}
+	if cond.lastModified != "" {
+		req.Header.Set("If-Modified-Since", cond.lastModified)
+	}
+}
+
+// scheduleRecrawl records when item is due again, along with its validators
+// unless they are nil (e.g. after a 304, which keeps the old ones). The item
+// is stored whole so the recrawl keeps its depth and origin.
+func (c *Crawler) scheduleRecrawl(ctx context.Context, item IngressItem, host string, validators *conditional) {
+	recrawls, ok := c.recrawlCache()
+	if !ok {
+		return
+	}
+	if validators != nil {
+		if err := recrawls.SetValidators(ctx, item.Location, validators.etag, validators.lastModified); err != nil {
+			c.log(ctx).Error("failed to store validators", "url", item.Location, "error", err)
+		}
+	}
+
+	item.Retries = 0
+	item.Recrawl = true
+	itemJSON, err := json.Marshal(item)
+	if err != nil {
+		c.log(ctx).Error("failed to marshal recrawl", "url", item.Location, "error", err)
+		return
+	}
+	due := c.now().Add(c.recrawl.freshFor(host))
+	if err := recrawls.ScheduleRecrawl(ctx, item.Location, string(itemJSON), due); err != nil {
+		c.log(ctx).Error("failed to schedule recrawl", "url", item.Location, "error", err)
+	}
+}
+
+// contentHash returns the SHA-256 of the page's extracted text and links,
+// with whitespace collapsed so reformatting alone is not a change.
+func contentHash(page *Page) string {
+	h := sha256.New()
+	write := func(s string) {
+		h.Write([]byte(strings.Join(strings.Fields(s), " ")))
+		h.Write([]byte{0})
+	}
+	write(page.Title)
+	write(page.Description)
+	for _, heading := range page.Headings {
+		write(heading)
+	}
+	h.Write([]byte{0})
+	for _, content := range page.Content {
+		write(content)
+	}
+	h.Write([]byte{0})
+	for _, link := range page.Links {
+		write(link.String())
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// unchanged records the content hash of page and reports whether a recrawl
+// found the same content as the previous crawl. Cache errors count as a
+// change so the page is processed.
+func (c *Crawler) unchanged(ctx context.Context, item IngressItem, page *Page) bool {
+	if !c.changeDetection {
+		return false
+	}
+	hashes, ok := c.cache.(ContentHashCache)
+	if !ok {
+		return false
+	}
+
+	hash := contentHash(page)
+	if item.Recrawl {
+		previous, err := hashes.ContentHash(ctx, item.Location)
+		if err != nil {
+			c.log(ctx).Error("failed to read content hash", "url", item.Location, "error", err)
+		} else if previous == hash {
+			return true
+		}
+	}
+	if err := hashes.SetContentHash(ctx, item.Location, hash); err != nil {
+		c.log(ctx).Error("failed to store content hash", "url", item.Location, "error", err)
+	}
+	return false
+}
+
+// PromoteRecrawls moves up to limit pages that are due for a recrawl back to
+// the ingress queue and returns how many were queued. A page that cannot be
+// queued is scheduled again for now, so the next promotion retries it.
+func (c *Crawler) PromoteRecrawls(ctx context.Context, limit int64) (int, error) {
+	recrawls, ok := c.recrawlCache()
+	if !ok {
+		return 0, fmt.Errorf("recrawl not configured")
+	}
+
+	now := c.now()
+	locations, items, err := recrawls.DueRecrawls(ctx, now, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	promoted := 0
+	for i, location := range locations {
+		item := IngressItem{Location: location, Recrawl: true}
+		if items[i] != "" {
+			if err := json.Unmarshal([]byte(items[i]), &item); err != nil {
+				c.log(ctx).Error("malformed recrawl, queueing its url only", "url", location, "error", err)
+				item = IngressItem{Location: location, Recrawl: true}
+			}
+		}
+
+		// unvisit before queueing, a worker popping the recrawl in between
+		// would otherwise drop it as visited. If either step fails the page
+		// is marked visited again and stays on the schedule.
+		if err := c.cache.Unvisit(ctx, location); err != nil {
+			c.log(ctx).Error("failed to unvisit recrawl", "url", location, "error", err)
+			c.reschedule(ctx, recrawls, location, items[i], now)
+			continue
+		}
+		if err := c.Enqueue(ctx, item); err != nil {
+			c.log(ctx).Error("failed to queue recrawl", "url", location, "error", err)
+			if err := c.cache.Visit(ctx, location); err != nil {
+				c.log(ctx).Error("failed to mark unqueued recrawl visited", "url", location, "error", err)
+			}
+			c.reschedule(ctx, recrawls, location, items[i], now)
+			continue
+		}
+		promoted++
+	}
+	return promoted, nil
+}
+
+// reschedule puts a claimed recrawl that could not be queued back on the
+// schedule, due at once.
+func (c *Crawler) reschedule(ctx context.Context, recrawls RecrawlCache, location string, itemJSON string, due time.Time) {
+	if err := recrawls.ScheduleRecrawl(ctx, location, itemJSON, due); err != nil {
+		c.log(ctx).Error("failed to reschedule recrawl", "url", location, "error", err)
+	}
+}
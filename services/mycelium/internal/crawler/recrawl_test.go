@@ -0,0 +1,287 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"mycelium/internal/cache"
+)
+
+func recrawlCrawler(t *testing.T, clock *fakeClock) (*Crawler, *miniredis.Miniredis) {
+	t.Helper()
+	rc, mr := newRedisCache(t)
+	c := NewCrawler(rc, nil, quiet,
+		WithMyceliumIngressKey("ingress"),
+		WithClock(clock.now),
+		WithRecrawl(RecrawlPolicy{After: time.Hour, Domains: map[string]time.Duration{"news.test": 10 * time.Minute}}))
+	return c, mr
+}
+
+// ingressItems decodes the items waiting in the ingress queue.
+func ingressItems(t *testing.T, mr *miniredis.Miniredis) []IngressItem {
+	t.Helper()
+	queued, _ := mr.List("ingress")
+	items := make([]IngressItem, len(queued))
+	for i, itemJSON := range queued {
+		if err := json.Unmarshal([]byte(itemJSON), &items[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return items
+}
+
+func TestPromoteRecrawlsWhenDue(t *testing.T) {
+	clock := newFakeClock()
+	c, mr := recrawlCrawler(t, clock)
+	ctx := context.Background()
+
+	news := IngressItem{Location: "https://www.news.test/today", Retries: 2, Depth: 3, Parent: "https://www.news.test/", SeedOrigin: "https://seed.test/"}
+	blog := IngressItem{Location: "https://blog.test/post", Depth: 1}
+	for _, item := range []IngressItem{news, blog} {
+		if err := c.cache.Visit(ctx, item.Location); err != nil {
+			t.Fatal(err)
+		}
+		c.scheduleRecrawl(ctx, item, mustParse(t, item.Location).Hostname(), nil)
+	}
+
+	promote := func(want int) {
+		t.Helper()
+		promoted, err := c.PromoteRecrawls(ctx, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if promoted != want {
+			t.Fatalf("promoted %d recrawls at %s, want %d", promoted, clock.now().Format(time.TimeOnly), want)
+		}
+	}
+
+	promote(0)
+	clock.advance(10*time.Minute - time.Second)
+	promote(0)
+	clock.advance(time.Second)
+	promote(1)
+
+	queued := ingressItems(t, mr)
+	want := IngressItem{Location: news.Location, Depth: 3, Parent: news.Parent, SeedOrigin: news.SeedOrigin, Recrawl: true,
+		EnqueuedAt: clock.now().UnixMilli()}
+	if len(queued) != 1 || queued[0] != want {
+		t.Fatalf("queued %+v, want %+v", queued, want)
+	}
+	if visited, _ := c.cache.IsVisited(ctx, news.Location); visited {
+		t.Error("promoted recrawl still marked visited")
+	}
+	if visited, _ := c.cache.IsVisited(ctx, blog.Location); !visited {
+		t.Error("recrawl not yet due was unvisited")
+	}
+
+	// a promoted page is claimed once
+	promote(0)
+	clock.advance(50 * time.Minute)
+	promote(1)
+	if queued := ingressItems(t, mr); len(queued) != 2 || queued[1].Location != blog.Location || queued[1].Depth != 1 {
+		t.Errorf("queued %+v, want the blog post after the news page", queued)
+	}
+}
+
+func TestPromoteRecrawlsKeepsUnqueuedPages(t *testing.T) {
+	clock := newFakeClock()
+	c, mr := recrawlCrawler(t, clock)
+	ctx := context.Background()
+
+	item := IngressItem{Location: "https://blog.test/post", Depth: 2}
+	if err := c.cache.Visit(ctx, item.Location); err != nil {
+		t.Fatal(err)
+	}
+	c.scheduleRecrawl(ctx, item, "blog.test", nil)
+	clock.advance(time.Hour)
+
+	// a string where the ingress list should be makes every push fail
+	mr.Set("ingress", "not a list")
+	if promoted, err := c.PromoteRecrawls(ctx, 10); err != nil || promoted != 0 {
+		t.Fatalf("PromoteRecrawls = %d, %v; want 0, nil", promoted, err)
+	}
+	if visited, _ := c.cache.IsVisited(ctx, item.Location); !visited {
+		t.Error("page unvisited although it was not queued")
+	}
+
+	mr.Del("ingress")
+	if promoted, err := c.PromoteRecrawls(ctx, 10); err != nil || promoted != 1 {
+		t.Fatalf("retry PromoteRecrawls = %d, %v; want 1, nil", promoted, err)
+	}
+	if queued := ingressItems(t, mr); len(queued) != 1 || queued[0].Depth != 2 {
+		t.Errorf("queued %+v, want the rescheduled page with its depth", queued)
+	}
+}
+
+// visitedAtPush records whether each item pushed to ingress was still
+// marked visited at that moment.
+type visitedAtPush struct {
+	*cache.CrawlerCache
+	visited []bool
+}
+
+func (v *visitedAtPush) PushToMyceliumIngress(ctx context.Context, itemJSON string, key string) error {
+	var item IngressItem
+	json.Unmarshal([]byte(itemJSON), &item)
+	visited, _ := v.IsVisited(ctx, item.Location)
+	v.visited = append(v.visited, visited)
+	return v.CrawlerCache.PushToMyceliumIngress(ctx, itemJSON, key)
+}
+
+func TestPromoteRecrawlsUnvisitsBeforeQueueing(t *testing.T) {
+	clock := newFakeClock()
+	rc, _ := newRedisCache(t)
+	recorder := &visitedAtPush{CrawlerCache: rc}
+	c := NewCrawler(recorder, nil, quiet, WithMyceliumIngressKey("ingress"), WithClock(clock.now),
+		WithRecrawl(RecrawlPolicy{After: time.Hour}))
+	ctx := context.Background()
+
+	item := IngressItem{Location: "https://blog.test/post"}
+	c.cache.Visit(ctx, item.Location)
+	c.scheduleRecrawl(ctx, item, "blog.test", nil)
+	clock.advance(time.Hour)
+
+	if promoted, err := c.PromoteRecrawls(ctx, 10); err != nil || promoted != 1 {
+		t.Fatalf("PromoteRecrawls = %d, %v; want 1, nil", promoted, err)
+	}
+	// a worker popping the item right away must not find it visited
+	if len(recorder.visited) != 1 || recorder.visited[0] {
+		t.Errorf("visited when pushed = %v, want the page unvisited first", recorder.visited)
+	}
+}
+
+func TestPromoteRecrawlsWithoutRecrawl(t *testing.T) {
+	c := NewCrawler(newMemCache(), nil, quiet, WithRecrawl(RecrawlPolicy{After: time.Hour}))
+	if _, err := c.PromoteRecrawls(context.Background(), 10); err == nil {
+		t.Error("PromoteRecrawls succeeded on a cache without a schedule")
+	}
+}
+
+func TestConditionalRecrawl(t *testing.T) {
+	var ifNoneMatch, ifModifiedSince string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ifNoneMatch, ifModifiedSince = r.Header.Get("If-None-Match"), r.Header.Get("If-Modified-Since")
+		if ifNoneMatch == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.Write([]byte("<html><body>hello</body></html>"))
+	}))
+	defer srv.Close()
+
+	clock := newFakeClock()
+	c, _ := recrawlCrawler(t, clock)
+	ctx := context.Background()
+	loc := mustParse(t, srv.URL+"/")
+
+	page, err := c.GetPage(ctx, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ifNoneMatch != "" || ifModifiedSince != "" {
+		t.Errorf("first crawl sent validators %q, %q", ifNoneMatch, ifModifiedSince)
+	}
+	item := IngressItem{Location: loc.String()}
+	c.scheduleRecrawl(ctx, item, loc.Hostname(), &conditional{etag: page.etag, lastModified: page.lastModified})
+
+	// only recrawls are conditional
+	if _, err := c.GetPage(c.withValidators(ctx, ctx, item), loc); err != nil {
+		t.Fatal(err)
+	}
+	if ifNoneMatch != "" {
+		t.Errorf("first crawl of the item sent If-None-Match %q", ifNoneMatch)
+	}
+
+	item.Recrawl = true
+	_, err = c.GetPage(c.withValidators(ctx, ctx, item), loc)
+	if !errors.Is(err, errNotModified) {
+		t.Fatalf("recrawl error = %v, want not modified", err)
+	}
+	if ifNoneMatch != `"v1"` || ifModifiedSince != "Mon, 02 Jan 2006 15:04:05 GMT" {
+		t.Errorf("recrawl sent validators %q, %q", ifNoneMatch, ifModifiedSince)
+	}
+}
+
+func TestChangeDetection(t *testing.T) {
+	body := "<html><body><p>hello</p></body></html>"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	cache := newMemCache()
+	metrics := NewCounterMetrics()
+	c := NewCrawler(cache, nil, quiet, WithMyceliumIngressKey("ingress"), WithFungicideQueueKey("fungicide"),
+		WithMetrics(metrics), WithChangeDetection(true))
+	ctx := context.Background()
+	location := srv.URL + "/"
+
+	crawl := func(recrawl bool) {
+		t.Helper()
+		cache.Unvisit(ctx, location)
+		itemJSON, _ := json.Marshal(IngressItem{Location: location, Recrawl: recrawl})
+		cache.PushToMyceliumIngress(ctx, string(itemJSON), "ingress")
+		if _, err := c.CrawlOnce(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	steps := []struct {
+		name      string
+		body      string
+		recrawl   bool
+		pushed    int
+		unchanged int64
+	}{
+		{"first crawl", body, false, 1, 0},
+		{"unchanged recrawl", body, true, 1, 1},
+		{"reformatted recrawl", "<html>\n<body>\n  <p>hello</p>\n</body>\n</html>", true, 1, 2},
+		{"changed recrawl", "<html><body><p>hello again</p></body></html>", true, 2, 2},
+		{"same as the change", "<html><body><p>hello again</p></body></html>", true, 2, 3},
+		// only recrawls are skipped, a fresh crawl is always processed
+		{"fresh crawl", "<html><body><p>hello again</p></body></html>", false, 3, 3},
+	}
+	for _, step := range steps {
+		body = step.body
+		crawl(step.recrawl)
+		if n := len(cache.fungicide["fungicide"]); n != step.pushed {
+			t.Errorf("%s: %d pages pushed to fungicide, want %d", step.name, n, step.pushed)
+		}
+		if n := metrics.Get(MetricPagesUnchanged); n != step.unchanged {
+			t.Errorf("%s: %d unchanged pages, want %d", step.name, n, step.unchanged)
+		}
+		if visited, _ := cache.IsVisited(ctx, location); !visited {
+			t.Errorf("%s: page not marked visited", step.name)
+		}
+	}
+}
+
+func TestChangeDetectionDisabled(t *testing.T) {
+	srv := typedServer(t, "text/html", "<html><body>same</body></html>")
+	cache := newMemCache()
+	c := NewCrawler(cache, nil, quiet, WithMyceliumIngressKey("ingress"), WithFungicideQueueKey("fungicide"))
+	for range 2 {
+		cache.Unvisit(context.Background(), srv.URL+"/")
+		itemJSON, _ := json.Marshal(IngressItem{Location: srv.URL + "/", Recrawl: true})
+		cache.PushToMyceliumIngress(context.Background(), string(itemJSON), "ingress")
+		if _, err := c.CrawlOnce(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(cache.fungicide["fungicide"]); n != 2 {
+		t.Errorf("%d pages pushed, want both recrawls without change detection", n)
+	}
+	if len(cache.hashes) != 0 {
+		t.Errorf("stored hashes %v with change detection off", cache.hashes)
+	}
+}
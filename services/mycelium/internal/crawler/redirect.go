@@ -0,0 +1,97 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// defaultMaxRedirects matches the net/http default.
+const defaultMaxRedirects = 10
+
+// WithMaxRedirects sets how many redirects a request may follow, 0 for none.
+// The default is 10.
+func WithMaxRedirects(n int) CrawlerOption {
+	return func(c *Crawler) {
+		c.maxRedirects = n
+	}
+}
+
+// WithMaxCrossHostRedirects caps how many redirects in a chain may move to
+// another host, such as tracker to shortener to destination. 0, the default,
+// only applies WithMaxRedirects.
+func WithMaxCrossHostRedirects(n int) CrawlerOption {
+	return func(c *Crawler) {
+		c.maxCrossHostRedirects = n
+	}
+}
+
+type redirectChainKey struct{}
+
+// withRedirectChain makes the crawler's redirect policy treat the request as
+// a page fetch: every hop is admitted like a queued url, marked visited and
+// appended to chain.
+func withRedirectChain(ctx context.Context, chain *[]string) context.Context {
+	return context.WithValue(ctx, redirectChainKey{}, chain)
+}
+
+// setupRedirects installs the redirect policy on the client, ahead of any
+// CheckRedirect the client came with.
+func (c *Crawler) setupRedirects() {
+	next := c.client.CheckRedirect
+	c.client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if err := c.checkRedirect(req, via); err != nil {
+			return err
+		}
+		if next != nil {
+			return next(req, via)
+		}
+		return nil
+	}
+}
+
+func (c *Crawler) checkRedirect(req *http.Request, via []*http.Request) error {
+	target := req.URL.String()
+	if len(via) > c.maxRedirects {
+		return fmt.Errorf("%w: more than %d redirects", ErrTooManyRedirects, c.maxRedirects)
+	}
+	for _, prev := range via {
+		if prev.URL.String() == target {
+			return fmt.Errorf("%w: back to %s after %d redirects", ErrRedirectLoop, target, len(via))
+		}
+	}
+	if c.maxCrossHostRedirects > 0 {
+		changes := 0
+		for i := 1; i <= len(via); i++ {
+			next := req
+			if i < len(via) {
+				next = via[i]
+			}
+			if next.URL.Hostname() != via[i-1].URL.Hostname() {
+				changes++
+			}
+		}
+		if changes > c.maxCrossHostRedirects {
+			return fmt.Errorf("%w: more than %d redirects to another host", ErrTooManyRedirects, c.maxCrossHostRedirects)
+		}
+	}
+
+	chain, ok := req.Context().Value(redirectChainKey{}).(*[]string)
+	if !ok {
+		return nil
+	}
+	// a filtered or blacklisted hop fails the fetch, as if it had been
+	// queued
+	if err := c.admit(req.Context(), req.URL); err != nil {
+		return fmt.Errorf("redirect to %s: %w", target, err)
+	}
+	*chain = append(*chain, target)
+	c.metrics.Incr(MetricRedirectsFollowed, 1)
+	if c.cache != nil {
+		// links to a shortener or its destination need not be fetched again
+		if err := c.cache.Visit(context.WithoutCancel(req.Context()), target); err != nil {
+			c.log(req.Context()).Warn("failed to mark redirect visited", "url", target, "error", err)
+		}
+	}
+	return nil
+}
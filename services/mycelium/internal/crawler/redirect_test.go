@@ -0,0 +1,101 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// redirectServer serves /chain/N, which takes N redirects to reach a page,
+// /loop/a and /loop/b, which redirect to each other, and /hop/host/..., which
+// redirects through each listed host in turn.
+func redirectServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {
+		_, port, _ := strings.Cut(srv.Listener.Addr().String(), ":")
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/chain/"):
+			n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/chain/"))
+			if n > 0 {
+				http.Redirect(w, r, fmt.Sprintf("/chain/%d", n-1), http.StatusFound)
+				return
+			}
+		case r.URL.Path == "/loop/a":
+			http.Redirect(w, r, "/loop/b", http.StatusFound)
+			return
+		case r.URL.Path == "/loop/b":
+			http.Redirect(w, r, "/loop/a", http.StatusFound)
+			return
+		case strings.HasPrefix(r.URL.Path, "/hop/"):
+			host, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/hop/"), "/")
+			http.Redirect(w, r, fmt.Sprintf("http://%s:%s/%s", host, port, rest), http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, "<html><body>landed</body></html>")
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRedirectLimits(t *testing.T) {
+	srv := redirectServer(t)
+	_, port, _ := strings.Cut(srv.Listener.Addr().String(), ":")
+
+	tests := []struct {
+		name    string
+		path    string
+		opts    []CrawlerOption
+		wantErr error
+	}{
+		{name: "within the limit", path: "/chain/3", opts: []CrawlerOption{WithMaxRedirects(3)}},
+		{name: "past the limit", path: "/chain/4", opts: []CrawlerOption{WithMaxRedirects(3)}, wantErr: ErrTooManyRedirects},
+		{name: "none allowed", path: "/chain/1", opts: []CrawlerOption{WithMaxRedirects(0)}, wantErr: ErrTooManyRedirects},
+		{name: "loop", path: "/loop/a", wantErr: ErrRedirectLoop},
+		{name: "host changes within the limit", path: "/hop/localhost/hop/127.0.0.1/chain/0", opts: []CrawlerOption{WithMaxCrossHostRedirects(2)}},
+		{name: "host changes past the limit", path: "/hop/localhost/hop/127.0.0.1/chain/0", opts: []CrawlerOption{WithMaxCrossHostRedirects(1)}, wantErr: ErrTooManyRedirects},
+		{name: "hop blocked by a filter", path: "/hop/localhost/chain/0", opts: []CrawlerOption{WithUrlFilters([]UrlFilter{hostFilter("localhost")})}, wantErr: ErrBlockedByFilter},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := NewCrawler(newMemCache(), nil, append([]CrawlerOption{quiet}, test.opts...)...)
+			_, err := getPage(t, c, srv.URL+test.path)
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("GetPage(%s) = %v, want %v", test.path, err, test.wantErr)
+			}
+			if test.wantErr != nil && classifyFetchError(err) == OutcomeRetryable {
+				t.Errorf("%v would be retried", err)
+			}
+		})
+	}
+
+	t.Run("chain is recorded and visited", func(t *testing.T) {
+		cache := newMemCache()
+		metrics := NewCounterMetrics()
+		c := NewCrawler(cache, nil, quiet, WithMetrics(metrics))
+		page, err := getPage(t, c, srv.URL+"/hop/localhost/chain/1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{
+			"http://localhost:" + port + "/chain/1",
+			"http://localhost:" + port + "/chain/0",
+		}
+		if !slices.Equal(page.Redirects, want) {
+			t.Errorf("Redirects = %q, want %q", page.Redirects, want)
+		}
+		for _, hop := range want {
+			if !cache.visited[hop] {
+				t.Errorf("%s was not marked visited", hop)
+			}
+		}
+		if n := metrics.Get(MetricRedirectsFollowed); n != 2 {
+			t.Errorf("counted %d redirects, want 2", n)
+		}
+	})
+}
@@ -0,0 +1,234 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var errInjected = errors.New("injected failure")
+
+// failingCache fails the named calls with errInjected.
+type failingCache struct {
+	*memCache
+	fail map[string]bool
+}
+
+func (f *failingCache) IsVisited(ctx context.Context, location string) (bool, error) {
+	if f.fail["IsVisited"] {
+		return false, errInjected
+	}
+	return f.memCache.IsVisited(ctx, location)
+}
+
+func (f *failingCache) IsBlacklisted(ctx context.Context, host string, key string) (bool, error) {
+	if f.fail["IsBlacklisted"] {
+		return false, errInjected
+	}
+	return f.memCache.IsBlacklisted(ctx, host, key)
+}
+
+func (f *failingCache) PushToFungicide(ctx context.Context, item string, key string) error {
+	if f.fail["PushToFungicide"] {
+		return errInjected
+	}
+	return f.memCache.PushToFungicide(ctx, item, key)
+}
+
+func (f *failingCache) PopFromMyceliumIngress(ctx context.Context, key string) (string, error) {
+	if f.fail["PopFromMyceliumIngress"] {
+		return "", errInjected
+	}
+	return f.memCache.PopFromMyceliumIngress(ctx, key)
+}
+
+// countUntilExhausted counts like CounterMetrics and cancels the crawl once
+// an item has used up its retries.
+type countUntilExhausted struct {
+	*CounterMetrics
+	stop context.CancelFunc
+}
+
+func (m countUntilExhausted) Incr(name string, delta int64) {
+	m.CounterMetrics.Incr(name, delta)
+	if name == MetricItemsExhausted {
+		m.stop()
+	}
+}
+
+func TestRetryAccounting(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><body>page</body></html>")
+	}))
+	defer srv.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	const maxRetries = 2
+	tests := []struct {
+		name     string
+		fail     string
+		location string
+		retries  int32
+		opts     []CrawlerOption
+		// wantRetried is how often the item went back to ingress before it
+		// was dead lettered
+		wantRetried int64
+		wantReason  string
+	}{
+		{name: "fetch", location: down.URL + "/", wantRetried: maxRetries, wantReason: "connection refused"},
+		{name: "fungicide push", fail: "PushToFungicide", location: srv.URL + "/", opts: []CrawlerOption{WithFungicideQueueKey("fungicide")}, wantRetried: maxRetries, wantReason: errInjected.Error()},
+		{name: "resumed with one retry left", location: down.URL + "/", retries: maxRetries - 1, wantRetried: 1, wantReason: "connection refused"},
+		{name: "arrived exhausted", location: srv.URL + "/", retries: maxRetries + 1, wantRetried: 0, wantReason: "arrived with"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cache := &failingCache{memCache: newMemCache(), fail: map[string]bool{test.fail: true}}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			metrics := countUntilExhausted{NewCounterMetrics(), cancel}
+			opts := append([]CrawlerOption{quiet, WithMyceliumIngressKey("ingress"), WithDeadLetterKey("dead"),
+				WithMetrics(metrics), WithMaxRetries(maxRetries)}, test.opts...)
+			c := NewCrawler(cache, nil, opts...)
+			if err := c.Enqueue(context.Background(), IngressItem{Location: test.location, Retries: test.retries}); err != nil {
+				t.Fatal(err)
+			}
+
+			done := make(chan error)
+			go func() { done <- c.Crawl(ctx) }()
+			select {
+			case <-done:
+			case <-time.After(2 * time.Second):
+				cancel()
+				<-done
+				t.Fatal("timed out waiting for the item to be dead lettered")
+			}
+
+			if n := metrics.Get(MetricItemsRetried); n != test.wantRetried {
+				t.Errorf("retried %d times, want %d", n, test.wantRetried)
+			}
+			if n := len(cache.queue("ingress")); n != 0 {
+				t.Errorf("%d items left in ingress, want none", n)
+			}
+			dead := cache.queue("dead")
+			if len(dead) != 1 {
+				t.Fatalf("%d dead letters, want 1", len(dead))
+			}
+			var letter DeadLetter
+			var item IngressItem
+			if err := json.Unmarshal([]byte(dead[0]), &letter); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(letter.Payload), &item); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(letter.Reason, test.wantReason) {
+				t.Errorf("reason %q does not carry the last error %q", letter.Reason, test.wantReason)
+			}
+			if want := max(test.retries, maxRetries+1); item.Retries != want {
+				t.Errorf("dead lettered with %d retries, want %d", item.Retries, want)
+			}
+		})
+	}
+}
+
+// flakyCache fails the calls of one method whose position in calls is true,
+// counting from 0.
+type flakyCache struct {
+	*memCache
+	method string
+	calls  []bool
+	n      int
+}
+
+func (f *flakyCache) fails(method string) bool {
+	if method != f.method {
+		return false
+	}
+	f.n++
+	return f.n <= len(f.calls) && f.calls[f.n-1]
+}
+
+func (f *flakyCache) IsVisited(ctx context.Context, location string) (bool, error) {
+	if f.fails("IsVisited") {
+		return false, errInjected
+	}
+	return f.memCache.IsVisited(ctx, location)
+}
+
+func (f *flakyCache) IsBlacklisted(ctx context.Context, host string, key string) (bool, error) {
+	if f.fails("IsBlacklisted") {
+		return false, errInjected
+	}
+	return f.memCache.IsBlacklisted(ctx, host, key)
+}
+
+func TestCacheReadFailuresDoNotCountAsRetries(t *testing.T) {
+	srv := httptest.NewServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/moved" {
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, "<html><body>page</body></html>")
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		method   string
+		calls    []bool
+		location string
+	}{
+		{name: "visited check", method: "IsVisited", calls: []bool{true, true}, location: srv.URL + "/"},
+		{name: "blacklist check", method: "IsBlacklisted", calls: []bool{true, true}, location: srv.URL + "/"},
+		// the first check admits the item, the second the redirect hop
+		{name: "redirect hop", method: "IsBlacklisted", calls: []bool{false, true}, location: srv.URL + "/moved"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cache := &flakyCache{memCache: newMemCache(), method: test.method, calls: test.calls}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			metrics := countUntilFetch{NewCounterMetrics(), cancel}
+			// no retries at all, so counting one would dead letter the item
+			c := NewCrawler(cache, nil, quiet, WithMyceliumIngressKey("ingress"), WithDeadLetterKey("dead"),
+				WithMyceliumBlacklistKey("blacklist"), WithMetrics(metrics), WithMaxRetries(0))
+			if err := c.Enqueue(context.Background(), IngressItem{Location: test.location}); err != nil {
+				t.Fatal(err)
+			}
+
+			done := make(chan error)
+			go func() { done <- c.Crawl(ctx) }()
+			select {
+			case <-done:
+			case <-time.After(3 * time.Second):
+				cancel()
+				<-done
+				t.Fatal("timed out waiting for the item to be fetched")
+			}
+
+			failed := int64(0)
+			for _, fail := range test.calls {
+				if fail {
+					failed++
+				}
+			}
+			if n := metrics.Get(MetricCacheReadErrors); n != failed {
+				t.Errorf("counted %d cache read errors, want %d", n, failed)
+			}
+			if n := metrics.Get(MetricItemsRetried); n != 0 {
+				t.Errorf("counted %d retries, want none", n)
+			}
+			if dead := cache.queue("dead"); len(dead) != 0 {
+				t.Errorf("dead lettered %q", dead)
+			}
+		})
+	}
+}
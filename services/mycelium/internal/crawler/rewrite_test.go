@@ -0,0 +1,57 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"mycelium/internal/filter"
+)
+
+func TestTrackingParamsCollapseToOneLink(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		base := "http://" + r.Host
+		fmt.Fprintf(w, `<html><body>
+			<a href="%[1]s/article?id=7">clean</a>
+			<a href="%[1]s/article?utm_source=news&id=7">utm</a>
+			<a href="%[1]s/article?id=7&fbclid=abc&utm_medium=social">fbclid</a>
+			<a href="%[1]s/other">other</a>
+			<a href="%[1]s/article?gclid=1&id=7">gclid</a>
+		</body></html>`, base)
+	}))
+	defer srv.Close()
+
+	c := NewCrawler(nil, nil, WithUrlRewriters([]UrlRewriter{filter.NewQueryParamStripper(filter.DefaultStrippedParams)}))
+	loc, _ := url.Parse(srv.URL + "/")
+	page, err := c.GetPage(context.Background(), loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{srv.URL + "/article?id=7", srv.URL + "/other"}
+	if got := urlsToStrings(page.Links); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("links = %v, want the variants collapsed in order: %v", got, want)
+	}
+
+	// a tracking variant seeded separately maps to the same visited key
+	seeded, _ := url.Parse(srv.URL + "/article?utm_campaign=x&id=7")
+	if got := c.rewrite(seeded).String(); got != want[0] {
+		t.Errorf("seeded variant rewritten to %s, want %s", got, want[0])
+	}
+}
+
+func TestDedupeLinksKeepsFirst(t *testing.T) {
+	var links []url.URL
+	for _, rawUrl := range []string{"https://a.example/", "https://b.example/", "https://a.example/", "https://c.example/", "https://b.example/"} {
+		u, _ := url.Parse(rawUrl)
+		links = append(links, *u)
+	}
+	got := urlsToStrings(dedupeLinks(links))
+	if want := "[https://a.example/ https://b.example/ https://c.example/]"; fmt.Sprint(got) != want {
+		t.Errorf("dedupeLinks = %v, want %s", got, want)
+	}
+}
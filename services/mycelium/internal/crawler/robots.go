@@ -0,0 +1,81 @@
+package crawler
+
+import (
+	"context"
+	"time"
+)
+
+// RobotsCache is implemented by caches that share robots.txt rules and
+// sitemap ingestion markers across the fleet, so each host is fetched once
+// per TTL rather than once per process.
+type RobotsCache interface {
+	RobotsRules(ctx context.Context, host string) (rules string, found bool, err error)
+	SetRobotsRules(ctx context.Context, host string, rules string, ttl time.Duration) error
+	ClaimRobotsFetch(ctx context.Context, host string, ttl time.Duration) (bool, error)
+	ClaimSitemapIngest(ctx context.Context, host string, ttl time.Duration) (bool, error)
+}
+
+// RobotsFetcher fetches and serializes the robots rules of host. found is
+// false when the host has no robots.txt, which is cached like any other
+// result.
+type RobotsFetcher func(ctx context.Context, host string) (rules string, found bool, err error)
+
+// SharedRobotsRules returns host's robots rules from the cache, fetching
+// them on first contact. When several workers race, one claims the fetch
+// and the rest wait for its result, fetching themselves only if it never
+// shows up. Entries expire after ttl; negative entries after negativeTTL.
+func (c *Crawler) SharedRobotsRules(ctx context.Context, host string, ttl time.Duration, negativeTTL time.Duration, fetch RobotsFetcher) (string, error) {
+	robots, ok := c.cache.(RobotsCache)
+	if !ok {
+		rules, _, err := fetch(ctx, host)
+		return rules, err
+	}
+
+	rules, found, err := robots.RobotsRules(ctx, host)
+	if err != nil || found {
+		return rules, err
+	}
+
+	claimed, err := robots.ClaimRobotsFetch(ctx, host, robotsClaimTTL)
+	if err != nil {
+		return "", err
+	}
+	if !claimed {
+		deadline := time.Now().Add(robotsClaimTTL)
+		for time.Now().Before(deadline) {
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(robotsPollInterval):
+			}
+			rules, found, err := robots.RobotsRules(ctx, host)
+			if err != nil || found {
+				return rules, err
+			}
+		}
+		c.log(ctx).Warn("robots fetch claimed but never cached, fetching", "host", host)
+	}
+
+	rules, found, err = fetch(ctx, host)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		rules, ttl = "", negativeTTL
+	}
+	if err := robots.SetRobotsRules(ctx, host, rules, ttl); err != nil {
+		c.log(ctx).Error("failed to cache robots rules", "host", host, "error", err)
+	}
+	return rules, nil
+}
+
+// ClaimSitemapIngest reports whether this worker should ingest host's
+// sitemaps, i.e. nobody in the fleet has within ttl. Without a shared cache
+// every caller is told to ingest.
+func (c *Crawler) ClaimSitemapIngest(ctx context.Context, host string, ttl time.Duration) (bool, error) {
+	robots, ok := c.cache.(RobotsCache)
+	if !ok {
+		return true, nil
+	}
+	return robots.ClaimSitemapIngest(ctx, host, ttl)
+}
@@ -0,0 +1,103 @@
+package crawler
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSharedRobotsRulesFetchesOnceAcrossWorkers(t *testing.T) {
+	rc, _ := newRedisCache(t)
+	// separate crawlers stand in for separate processes sharing redis
+	a := NewCrawler(rc, nil, quiet)
+	b := NewCrawler(rc, nil, quiet)
+
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	fetch := func(ctx context.Context, host string) (string, bool, error) {
+		fetches.Add(1)
+		<-release
+		return "User-agent: *\nDisallow: /private", true, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]string, 2)
+	errs := make([]error, 2)
+	for i, c := range []*Crawler{a, b} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = c.SharedRobotsRules(context.Background(), "example.com", time.Hour, time.Minute, fetch)
+		}()
+	}
+	// let both workers reach the claim before the winner's fetch finishes
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("robots.txt fetched %d times, want once", n)
+	}
+	for i := range results {
+		if errs[i] != nil {
+			t.Errorf("worker %d: %s", i, errs[i])
+		}
+		if results[i] != "User-agent: *\nDisallow: /private" {
+			t.Errorf("worker %d got rules %q", i, results[i])
+		}
+	}
+}
+
+func TestSharedRobotsRulesNegativeCaching(t *testing.T) {
+	rc, mr := newRedisCache(t)
+	c := NewCrawler(rc, nil, quiet)
+
+	var fetches int
+	fetch := func(ctx context.Context, host string) (string, bool, error) {
+		fetches++
+		return "", false, nil
+	}
+	for range 2 {
+		rules, err := c.SharedRobotsRules(context.Background(), "norobots.example", time.Hour, time.Minute, fetch)
+		if err != nil || rules != "" {
+			t.Fatalf("rules = %q, %v; want none", rules, err)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("missing robots.txt fetched %d times, want once", fetches)
+	}
+	if ttl := mr.TTL("robots:norobots.example"); ttl != time.Minute {
+		t.Errorf("negative entry ttl = %s, want the negative ttl", ttl)
+	}
+
+	mr.FastForward(time.Minute)
+	if _, err := c.SharedRobotsRules(context.Background(), "norobots.example", time.Hour, time.Minute, fetch); err != nil {
+		t.Fatal(err)
+	}
+	if fetches != 2 {
+		t.Errorf("fetched %d times after the entry expired, want a refetch", fetches)
+	}
+}
+
+func TestClaimSitemapIngest(t *testing.T) {
+	rc, mr := newRedisCache(t)
+	c := NewCrawler(rc, nil, quiet)
+	ctx := context.Background()
+
+	if first, err := c.ClaimSitemapIngest(ctx, "example.com", time.Hour); err != nil || !first {
+		t.Fatalf("first claim = %t, %v; want it won", first, err)
+	}
+	if again, _ := c.ClaimSitemapIngest(ctx, "example.com", time.Hour); again {
+		t.Error("second claim won while the marker is live")
+	}
+	mr.FastForward(time.Hour)
+	if expired, _ := c.ClaimSitemapIngest(ctx, "example.com", time.Hour); !expired {
+		t.Error("claim lost after the marker expired")
+	}
+
+	if uncached, _ := NewCrawler(newMemCache(), nil, quiet).ClaimSitemapIngest(ctx, "example.com", time.Hour); !uncached {
+		t.Error("claim without a shared cache should always ingest")
+	}
+}
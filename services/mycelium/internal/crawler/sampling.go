@@ -0,0 +1,83 @@
+package crawler
+
+import (
+	"context"
+	"hash/fnv"
+)
+
+// SamplingStore keeps a 1 in rate sample of the items stored through it in
+// a destination store. Items are chosen by a hash of their key, so every
+// run samples the same pages.
+type SamplingStore struct {
+	dest Store
+	rate uint64
+}
+
+// NewSamplingStore samples into dest. A rate of 1 keeps every item and a
+// rate below 1 none.
+func NewSamplingStore(dest Store, rate int) *SamplingStore {
+	return &SamplingStore{dest: dest, rate: uint64(max(rate, 0))}
+}
+
+// Sampled reports whether the item with key belongs to the sample.
+func (s *SamplingStore) Sampled(key string) bool {
+	if s.rate == 0 {
+		return false
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()%s.rate == 0
+}
+
+// Store stores item in the destination if it is sampled, returning an empty
+// id otherwise. Items are keyed by StoreItemMeta.Key when they have it and
+// by their marshaled form when not, which only samples deterministically if
+// Marshal is deterministic.
+func (s *SamplingStore) Store(item StoreItem, extension string) (string, error) {
+	key, err := sampleKey(item)
+	if err != nil {
+		return "", err
+	}
+	if !s.Sampled(key) {
+		return "", nil
+	}
+	return s.dest.Store(item, extension)
+}
+
+func (s *SamplingStore) Retrieve(id string, extension string) ([]byte, error) {
+	return s.dest.Retrieve(id, extension)
+}
+
+func sampleKey(item StoreItem) (string, error) {
+	if meta, ok := item.(StoreItemMeta); ok {
+		return meta.Key(), nil
+	}
+	data, err := item.Marshal()
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// WithSampling copies the pages Crawl keeps to sampler for review, alongside
+// sending them to fungicide or the store.
+func WithSampling(sampler *SamplingStore) CrawlerOption {
+	return func(c *Crawler) {
+		c.sampler = sampler
+	}
+}
+
+// sample offers a kept page to the sampler.
+func (c *Crawler) sample(ctx context.Context, page *Page) {
+	if c.sampler == nil {
+		return
+	}
+	if !c.sampler.Sampled(page.Key()) {
+		c.metrics.Incr(MetricPagesNotSampled, 1)
+		return
+	}
+	c.metrics.Incr(MetricPagesSampled, 1)
+	if _, err := c.sampler.dest.Store(page, ".json"); err != nil {
+		c.log(ctx).Error("failed to store sampled page", "url", page.Location.String(), "error", err)
+	}
+}
@@ -0,0 +1,97 @@
+package crawler
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSamplingStoreRate(t *testing.T) {
+	const keys = 20000
+	for _, rate := range []int{2, 10, 100} {
+		s := NewSamplingStore(newMemStore(), rate)
+		sampled := 0
+		for i := range keys {
+			if s.Sampled(fmt.Sprintf("https://example.com/page/%d", i)) {
+				sampled++
+			}
+		}
+		// five standard deviations of the binomial
+		want := float64(keys) / float64(rate)
+		tolerance := 5 * math.Sqrt(want*(1-1/float64(rate)))
+		if math.Abs(float64(sampled)-want) > tolerance {
+			t.Errorf("rate %d sampled %d of %d keys, want %.0f ± %.0f", rate, sampled, keys, want, tolerance)
+		}
+	}
+}
+
+func TestSamplingStoreIsDeterministic(t *testing.T) {
+	first := NewSamplingStore(newMemStore(), 7)
+	second := NewSamplingStore(newMemStore(), 7)
+	for i := range 1000 {
+		key := fmt.Sprintf("https://example.com/page/%d", i)
+		if first.Sampled(key) != second.Sampled(key) || first.Sampled(key) != first.Sampled(key) {
+			t.Fatalf("%s sampled inconsistently", key)
+		}
+	}
+}
+
+func TestSamplingStoreBounds(t *testing.T) {
+	for _, test := range []struct {
+		rate int
+		want bool
+	}{{1, true}, {0, false}, {-3, false}} {
+		s := NewSamplingStore(newMemStore(), test.rate)
+		for i := range 100 {
+			if got := s.Sampled(fmt.Sprint(i)); got != test.want {
+				t.Fatalf("rate %d: Sampled = %t, want %t", test.rate, got, test.want)
+			}
+		}
+	}
+}
+
+func TestSamplingStoreStore(t *testing.T) {
+	dest := newMemStore()
+	s := NewSamplingStore(dest, 3)
+	stored := 0
+	for i := range 300 {
+		page := NewPage(mustParse(t, fmt.Sprintf("https://example.com/%d", i)))
+		id, err := s.Store(page, ".json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (id != "") != s.Sampled(page.Key()) {
+			t.Fatalf("stored %s with id %q against its sampling decision", page.Location, id)
+		}
+		if id != "" {
+			stored++
+			if _, err := s.Retrieve(id, ".json"); err != nil {
+				t.Errorf("retrieve %s: %s", id, err)
+			}
+		}
+	}
+	if dest.len() != stored {
+		t.Errorf("destination holds %d items, want %d", dest.len(), stored)
+	}
+}
+
+func TestCrawlSamplesKeptPages(t *testing.T) {
+	srv := httptest.NewServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><body>page</body></html>")
+	}))
+	defer srv.Close()
+
+	for _, rate := range []int{1, 0} {
+		samples := newMemStore()
+		store := newMemStore()
+		crawlOnePage(t, newMemCache(), store, srv.URL+"/", WithSampling(NewSamplingStore(samples, rate)))
+		if store.len() != 1 {
+			t.Errorf("rate %d: the main store holds %d pages, want 1", rate, store.len())
+		}
+		if want := rate; samples.len() != want {
+			t.Errorf("rate %d: sampled %d pages, want %d", rate, samples.len(), want)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package crawler
+
+import (
+	"mime"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// ScriptType classifies an inline script by its type attribute.
+type ScriptType string
+
+const (
+	ScriptJavaScript ScriptType = "javascript"
+	ScriptModule     ScriptType = "module"
+	// ScriptJSON covers application/json and its variants such as
+	// application/ld+json and importmap.
+	ScriptJSON  ScriptType = "json"
+	ScriptOther ScriptType = "other"
+)
+
+// Script is an inline script kept by the parser.
+type Script struct {
+	Type ScriptType `json:"type"`
+	// MediaType is the type attribute as written, empty when absent.
+	MediaType string `json:"media_type,omitempty"`
+	Content   string `json:"content"`
+}
+
+// ScriptPolicy limits which inline scripts a parsed page keeps. Scripts over
+// MaxBytes are skipped, as is every script once MaxTotalBytes would be
+// exceeded. Zero limits are unlimited.
+type ScriptPolicy struct {
+	MaxBytes      int
+	MaxTotalBytes int
+	// KeepMinified keeps scripts that look like minified bundles, which are
+	// skipped by default.
+	KeepMinified bool
+}
+
+// DefaultScriptPolicy applies to pages parsed without WithScriptPolicy.
+var DefaultScriptPolicy = ScriptPolicy{MaxBytes: 16 << 10, MaxTotalBytes: 64 << 10}
+
+// WithScriptPolicy sets which inline scripts fetched pages keep.
+func WithScriptPolicy(policy ScriptPolicy) CrawlerOption {
+	return func(c *Crawler) {
+		c.scriptPolicy = &policy
+	}
+}
+
+const (
+	// scripts shorter than this are never taken for bundles, so small
+	// configs written on one line are kept
+	minifiedMinBytes = 512
+	// average line length and whitespace ratio past which a script looks
+	// minified
+	minifiedLineLength     = 300
+	minifiedWhitespaceRate = 0.05
+)
+
+// classifyScript maps a script's type attribute to a ScriptType.
+func classifyScript(mediaType string) ScriptType {
+	if mediaType == "" {
+		return ScriptJavaScript
+	}
+	parsed, _, err := mime.ParseMediaType(mediaType)
+	if err != nil {
+		parsed = strings.ToLower(strings.TrimSpace(mediaType))
+	}
+	switch {
+	case parsed == "module":
+		return ScriptModule
+	case parsed == "importmap" || parsed == "speculationrules",
+		parsed == "application/json" || parsed == "text/json",
+		strings.HasSuffix(parsed, "+json"):
+		return ScriptJSON
+	case parsed == "text/javascript" || parsed == "application/javascript",
+		parsed == "application/ecmascript" || parsed == "text/ecmascript",
+		parsed == "application/x-javascript":
+		return ScriptJavaScript
+	default:
+		return ScriptOther
+	}
+}
+
+// looksMinified reports whether content has the very long lines or the
+// lack of whitespace of a minified bundle.
+func looksMinified(content string) bool {
+	if len(content) < minifiedMinBytes {
+		return false
+	}
+	lines := strings.Count(content, "\n") + 1
+	if len(content)/lines > minifiedLineLength {
+		return true
+	}
+	space := 0
+	for _, r := range content {
+		if unicode.IsSpace(r) {
+			space++
+		}
+	}
+	return float64(space)/float64(len(content)) < minifiedWhitespaceRate
+}
+
+// scriptTypeAttr returns the type attribute of a <script> tag.
+func scriptTypeAttr(t *html.Token) string {
+	for _, a := range t.Attr {
+		if a.Key == "type" {
+			return strings.TrimSpace(a.Val)
+		}
+	}
+	return ""
+}
+
+// addScript keeps an inline script if the page's script policy allows it.
+func (p *Page) addScript(mediaType string, content string) {
+	policy := DefaultScriptPolicy
+	if p.scriptPolicy != nil {
+		policy = *p.scriptPolicy
+	}
+
+	script := Script{Type: classifyScript(mediaType), MediaType: mediaType, Content: content}
+	if policy.MaxBytes > 0 && len(content) > policy.MaxBytes {
+		return
+	}
+	if policy.MaxTotalBytes > 0 && p.scriptBytes+len(content) > policy.MaxTotalBytes {
+		return
+	}
+	if !policy.KeepMinified && (script.Type == ScriptJavaScript || script.Type == ScriptModule) && looksMinified(content) {
+		return
+	}
+	p.scriptBytes += len(content)
+	p.Scripts = append(p.Scripts, script)
+	p.ScriptContent = append(p.ScriptContent, content)
+}
@@ -0,0 +1,106 @@
+package crawler
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// minifiedBundle is a single line of dense code, as shipped by bundlers.
+var minifiedBundle = "!function(e){" + strings.Repeat("var a=e.b||{};a.c=function(d){return d+1};", 100) + "}(window);"
+
+const inlineConfig = `window.config = {
+  apiBase: "/api",
+  locale: "en"
+};`
+
+func TestParseHtmlPageScripts(t *testing.T) {
+	doc := fmt.Sprintf(`<html><head>
+<script>%s</script>
+<script>%s</script>
+<script type="module">import { start } from "/app.js"; start();</script>
+<script type="application/ld+json">{"@type": "Article"}</script>
+<script type="text/template"><p>{{name}}</p></script>
+<script type="importmap">{"imports": {}}</script>
+</head><body></body></html>`, minifiedBundle, inlineConfig)
+
+	tests := []struct {
+		name   string
+		policy *ScriptPolicy
+		want   []ScriptType
+	}{
+		{name: "default", want: []ScriptType{ScriptJavaScript, ScriptModule, ScriptJSON, ScriptOther, ScriptJSON}},
+		{name: "keep minified", policy: &ScriptPolicy{KeepMinified: true}, want: []ScriptType{ScriptJavaScript, ScriptJavaScript, ScriptModule, ScriptJSON, ScriptOther, ScriptJSON}},
+		{name: "per script cap", policy: &ScriptPolicy{MaxBytes: 40, KeepMinified: true}, want: []ScriptType{ScriptJSON, ScriptOther, ScriptJSON}},
+		{name: "total cap", policy: &ScriptPolicy{MaxTotalBytes: len(inlineConfig) + 10}, want: []ScriptType{ScriptJavaScript}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page := NewPage(mustParse(t, "https://example.com/"))
+			page.scriptPolicy = test.policy
+			page.ParseHtmlPage(strings.NewReader(doc))
+
+			var types []ScriptType
+			for _, s := range page.Scripts {
+				types = append(types, s.Type)
+			}
+			if !slices.Equal(types, test.want) {
+				t.Errorf("kept %v, want %v", types, test.want)
+			}
+			if len(page.ScriptContent) != len(page.Scripts) {
+				t.Fatalf("ScriptContent has %d scripts, Scripts %d", len(page.ScriptContent), len(page.Scripts))
+			}
+			for i, s := range page.Scripts {
+				if page.ScriptContent[i] != s.Content {
+					t.Errorf("ScriptContent[%d] = %q, want %q", i, page.ScriptContent[i], s.Content)
+				}
+			}
+		})
+	}
+
+	page := NewPage(mustParse(t, "https://example.com/"))
+	page.ParseHtmlPage(strings.NewReader(doc))
+	if config := page.Scripts[0]; config.Content != inlineConfig || config.MediaType != "" {
+		t.Errorf("first script %+v, want the inline config", config)
+	}
+	if ld := page.Scripts[2]; ld.MediaType != "application/ld+json" {
+		t.Errorf("MediaType = %q, want the type attribute as written", ld.MediaType)
+	}
+}
+
+func TestClassifyScript(t *testing.T) {
+	for mediaType, want := range map[string]ScriptType{
+		"":                                      ScriptJavaScript,
+		"text/javascript":                       ScriptJavaScript,
+		"application/javascript; charset=utf-8": ScriptJavaScript,
+		"module":                                ScriptModule,
+		"application/json":                      ScriptJSON,
+		"application/ld+json":                   ScriptJSON,
+		"importmap":                             ScriptJSON,
+		"text/x-handlebars-template":            ScriptOther,
+	} {
+		if got := classifyScript(mediaType); got != want {
+			t.Errorf("classifyScript(%q) = %s, want %s", mediaType, got, want)
+		}
+	}
+}
+
+func TestLooksMinified(t *testing.T) {
+	readable := strings.Repeat("function add(a, b) {\n  return a + b;\n}\n\n", 30)
+	dense := strings.Repeat("var a=b;", 40) + "\n" + strings.Repeat("var c=d;", 40)
+	for _, test := range []struct {
+		content string
+		want    bool
+	}{
+		{minifiedBundle, true},
+		{dense, true},
+		{readable, false},
+		// short scripts are never taken for bundles
+		{"var a=1;var b=2;", false},
+	} {
+		if got := looksMinified(test.content); got != test.want {
+			t.Errorf("looksMinified(%.40q...) = %t, want %t", test.content, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package crawler
+
+import (
+	"crypto/tls"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+const (
+	maxSecurityFieldLen = 256
+	maxSecuritySANs     = 32
+)
+
+// Security describes the TLS session and server of an HTTPS fetch, used by
+// fungicide to cluster pages served from the same infrastructure. Fields
+// taken from the certificate are sanitized and truncated.
+type Security struct {
+	TLSVersion string   `json:"tls_version,omitempty"`
+	ALPN       string   `json:"alpn,omitempty"`
+	Subject    string   `json:"subject,omitempty"`
+	Issuer     string   `json:"issuer,omitempty"`
+	SANs       []string `json:"sans,omitempty"`
+	Server     string   `json:"server,omitempty"`
+}
+
+// securityOf captures the fingerprint of res, or nil for plain HTTP.
+func securityOf(res *http.Response) *Security {
+	if res.TLS == nil {
+		return nil
+	}
+	sec := &Security{
+		TLSVersion: tls.VersionName(res.TLS.Version),
+		ALPN:       sanitizeSecurityField(res.TLS.NegotiatedProtocol),
+		Server:     sanitizeSecurityField(res.Header.Get("Server")),
+	}
+	if len(res.TLS.PeerCertificates) == 0 {
+		return sec
+	}
+
+	leaf := res.TLS.PeerCertificates[0]
+	sec.Subject = sanitizeSecurityField(leaf.Subject.String())
+	sec.Issuer = sanitizeSecurityField(leaf.Issuer.String())
+	for _, name := range leaf.DNSNames {
+		if len(sec.SANs) == maxSecuritySANs {
+			break
+		}
+		sec.SANs = append(sec.SANs, sanitizeSecurityField(name))
+	}
+	for _, ip := range leaf.IPAddresses {
+		if len(sec.SANs) == maxSecuritySANs {
+			break
+		}
+		sec.SANs = append(sec.SANs, ip.String())
+	}
+	return sec
+}
+
+// sanitizeSecurityField drops control characters, which certificates and
+// headers can carry, and caps the length.
+func sanitizeSecurityField(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+	return truncateUTF8(s, maxSecurityFieldLen)
+}
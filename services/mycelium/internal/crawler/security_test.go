@@ -0,0 +1,76 @@
+package crawler
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func htmlServer(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		handler(w, r)
+	}
+}
+
+func TestGetPageRecordsSecurity(t *testing.T) {
+	srv := httptest.NewTLSServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "cozy/1.0")
+		fmt.Fprint(w, "<html><title>secure</title></html>")
+	}))
+	defer srv.Close()
+
+	c := NewCrawler(nil, nil, WithHttpClient(srv.Client()), quiet)
+	page, err := getPage(t, c, srv.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec := page.Security
+	if sec == nil {
+		t.Fatal("no security info for an HTTPS fetch")
+	}
+	if sec.TLSVersion != tls.VersionName(tls.VersionTLS13) {
+		t.Errorf("TLS version = %q", sec.TLSVersion)
+	}
+	if !strings.Contains(sec.Subject, "Acme Co") || !strings.Contains(sec.Issuer, "Acme Co") {
+		t.Errorf("subject %q, issuer %q, want the test certificate", sec.Subject, sec.Issuer)
+	}
+	for _, san := range []string{"example.com", "127.0.0.1"} {
+		if !slices.Contains(sec.SANs, san) {
+			t.Errorf("SANs %v lack %s", sec.SANs, san)
+		}
+	}
+	if sec.Server != "cozy/1.0" {
+		t.Errorf("server = %q", sec.Server)
+	}
+}
+
+func TestGetPagePlainHTTPHasNoSecurity(t *testing.T) {
+	srv := httptest.NewServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><title>plain</title></html>")
+	}))
+	defer srv.Close()
+
+	page, err := getPage(t, NewCrawler(nil, nil, quiet), srv.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Security != nil {
+		t.Errorf("security = %+v for plain HTTP, want nil", page.Security)
+	}
+}
+
+func TestSanitizeSecurityField(t *testing.T) {
+	if got := sanitizeSecurityField("CN=a\r\nb\x00c"); got != "CN=abc" {
+		t.Errorf("got %q, want control characters dropped", got)
+	}
+
+	got := sanitizeSecurityField(strings.Repeat("é", maxSecurityFieldLen))
+	if len(got) > maxSecurityFieldLen || !strings.HasPrefix(strings.Repeat("é", maxSecurityFieldLen), got) {
+		t.Errorf("got %d bytes, want at most %d whole runes", len(got), maxSecurityFieldLen)
+	}
+}
@@ -0,0 +1,198 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+// queuedLocations decodes the locations waiting in the ingress queue.
+func queuedLocations(t *testing.T, cache *memCache) []string {
+	t.Helper()
+	var locations []string
+	for _, itemJSON := range cache.queue("ingress") {
+		var item IngressItem
+		if err := json.Unmarshal([]byte(itemJSON), &item); err != nil {
+			t.Fatal(err)
+		}
+		locations = append(locations, item.Location)
+	}
+	return locations
+}
+
+func seedItems(locations ...string) []SeedItem {
+	var seeds []SeedItem
+	for _, location := range locations {
+		seeds = append(seeds, SeedItem{Location: location})
+	}
+	return seeds
+}
+
+func seedCrawler(t *testing.T) (*Crawler, *memCache) {
+	t.Helper()
+	cache := newMemCache()
+	return NewCrawler(cache, nil, WithMyceliumIngressKey("ingress")), cache
+}
+
+func assertQueued(t *testing.T, cache *memCache, want ...string) {
+	t.Helper()
+	got := queuedLocations(t, cache)
+	if len(got) != len(want) {
+		t.Fatalf("queued %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("queued %v, want %v", got, want)
+		}
+	}
+}
+
+func TestSeedSkip(t *testing.T) {
+	c, cache := seedCrawler(t)
+	seeds := seedItems("https://a.example/", "https://b.example/", "https://a.example/")
+
+	if err := c.Seed(context.Background(), seeds, SeedSkip); err != nil {
+		t.Fatal(err)
+	}
+	assertQueued(t, cache, "https://a.example/", "https://b.example/")
+
+	// a non-empty queue is left alone
+	if err := c.Seed(context.Background(), seedItems("https://c.example/"), SeedSkip); err != nil {
+		t.Fatal(err)
+	}
+	assertQueued(t, cache, "https://a.example/", "https://b.example/")
+
+	// the empty mode behaves like skip
+	if err := c.Seed(context.Background(), seedItems("https://c.example/"), ""); err != nil {
+		t.Fatal(err)
+	}
+	assertQueued(t, cache, "https://a.example/", "https://b.example/")
+}
+
+func TestSeedMerge(t *testing.T) {
+	c, cache := seedCrawler(t)
+	ctx := context.Background()
+
+	// queued items carry more than a location, merging must still see them
+	cache.PushToMyceliumIngress(ctx, `{"location":"https://queued.example/","retries":2}`, "ingress")
+	cache.Visit(ctx, "https://visited.example/")
+
+	seeds := seedItems(
+		"https://queued.example/",
+		"https://visited.example/",
+		"https://new.example/",
+		"https://new.example/",
+		"https://other.example/",
+	)
+	if err := c.Seed(ctx, seeds, SeedMerge); err != nil {
+		t.Fatal(err)
+	}
+	assertQueued(t, cache, "https://queued.example/", "https://new.example/", "https://other.example/")
+
+	// merging again adds nothing
+	if err := c.Seed(ctx, seeds, SeedMerge); err != nil {
+		t.Fatal(err)
+	}
+	assertQueued(t, cache, "https://queued.example/", "https://new.example/", "https://other.example/")
+}
+
+// countingQueueCache counts how often the queue is read.
+type countingQueueCache struct {
+	*memCache
+	reads int
+}
+
+func (c *countingQueueCache) QueuedLocations(ctx context.Context, key string) (map[string]bool, error) {
+	c.reads++
+	return c.memCache.QueuedLocations(ctx, key)
+}
+
+func TestSeedMergeReadsQueueOnce(t *testing.T) {
+	cache := &countingQueueCache{memCache: newMemCache()}
+	c := NewCrawler(cache, nil, quiet, WithMyceliumIngressKey("ingress"))
+	var locations []string
+	for i := range 50 {
+		locations = append(locations, fmt.Sprintf("https://site%d.example/", i))
+	}
+	if err := c.Seed(context.Background(), seedItems(locations...), SeedMerge); err != nil {
+		t.Fatal(err)
+	}
+	if cache.reads != 1 {
+		t.Errorf("read the queue %d times for 50 seeds, want once", cache.reads)
+	}
+}
+
+func TestQueuedLocationsReadsEveryBatch(t *testing.T) {
+	rc, mr := newRedisCache(t)
+	// more than one LRANGE batch, with a malformed item in between
+	for i := range 2500 {
+		mr.RPush("ingress", fmt.Sprintf(`{"location":"https://example.com/%d","retries":1}`, i))
+		if i == 1200 {
+			mr.RPush("ingress", "not json")
+		}
+	}
+
+	locations, err := rc.QueuedLocations(context.Background(), "ingress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != 2500 || !locations["https://example.com/0"] || !locations["https://example.com/2499"] {
+		t.Errorf("found %d queued locations, want all 2500", len(locations))
+	}
+}
+
+func TestSeedReplace(t *testing.T) {
+	c, cache := seedCrawler(t)
+	ctx := context.Background()
+	cache.PushToMyceliumIngress(ctx, `{"location":"https://stale.example/","retries":0}`, "ingress")
+	cache.Visit(ctx, "https://visited.example/")
+
+	seeds := seedItems("https://visited.example/", "https://fresh.example/", "https://fresh.example/")
+	if err := c.Seed(ctx, seeds, SeedReplace); err != nil {
+		t.Fatal(err)
+	}
+	// the queue is cleared; visited urls are still seeded and dropped later
+	// by the crawl loop, like in skip mode
+	assertQueued(t, cache, "https://visited.example/", "https://fresh.example/")
+}
+
+func TestSeedPriorityAndMaxDepth(t *testing.T) {
+	c, cache := seedCrawler(t)
+	seeds := []SeedItem{
+		{Location: "https://tail.example/"},
+		{Location: "https://home.example/", Priority: 10, MaxDepth: 2},
+		{Location: "https://low.example/", Priority: -1},
+		{Location: "https://other.example/"},
+		{Location: "https://news.example/", Priority: 10},
+	}
+	if err := c.Seed(context.Background(), seeds, SeedSkip); err != nil {
+		t.Fatal(err)
+	}
+	// higher priorities first, ties in file order
+	assertQueued(t, cache, "https://home.example/", "https://news.example/", "https://tail.example/", "https://other.example/", "https://low.example/")
+
+	var home IngressItem
+	if err := json.Unmarshal([]byte(cache.queue("ingress")[0]), &home); err != nil {
+		t.Fatal(err)
+	}
+	if home.Priority != 10 || home.MaxDepth != 2 {
+		t.Errorf("seeded %+v, want priority 10 and max depth 2", home)
+	}
+	child := home.child("https://home.example/a").child("https://home.example/b")
+	if child.Priority != 10 || child.MaxDepth != 2 || !child.atMaxDepth() {
+		t.Errorf("grandchild %+v, want the seed's settings and to be at max depth", child)
+	}
+}
+
+func TestSeedErrors(t *testing.T) {
+	c, _ := seedCrawler(t)
+	if err := c.Seed(context.Background(), nil, SeedMode("append")); err == nil {
+		t.Error("unknown seed mode accepted")
+	}
+
+	unconfigured := NewCrawler(newMemCache(), nil)
+	if err := unconfigured.Seed(context.Background(), nil, SeedSkip); err == nil {
+		t.Error("seeding without an ingress key succeeded")
+	}
+}
@@ -0,0 +1,25 @@
+package crawler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// WithSessionID stamps items this crawler queues without a session, and
+// the pages it fetches from them, with id so the output of runs sharing a
+// cache and store can be told apart. Items keep the session they were
+// seeded with as they move through the frontier.
+func WithSessionID(id string) CrawlerOption {
+	return func(c *Crawler) {
+		c.sessionID = id
+	}
+}
+
+// NewSessionID returns a sortable, practically unique run id such as
+// 20240102T150405Z-1a2b3c4d.
+func NewSessionID() string {
+	var suffix [4]byte
+	rand.Read(suffix[:])
+	return time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix[:])
+}
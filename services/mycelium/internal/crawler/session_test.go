@@ -0,0 +1,94 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestSessionPropagation(t *testing.T) {
+	srv := httptest.NewServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><body><a href="http://%s/child">child</a></body></html>`, r.Host)
+	}))
+	defer srv.Close()
+
+	cache := newMemCache()
+	ctx := context.Background()
+	newCrawler := func(session string) *Crawler {
+		return NewCrawler(cache, nil, quiet, WithMyceliumIngressKey("ingress"), WithFungicideQueueKey("fungicide"),
+			WithLinkQueueingMode(LinkQueueingAlways), WithEnvelope("crawler-1"), WithSessionID(session))
+	}
+	first := newCrawler("run-1")
+	if err := first.Seed(ctx, seedItems(srv.URL+"/"), SeedSkip); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := first.CrawlOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var child IngressItem
+	if err := json.Unmarshal([]byte(cache.queue("ingress")[0]), &child); err != nil {
+		t.Fatal(err)
+	}
+	if child.Location != srv.URL+"/child" || child.Session != "run-1" {
+		t.Fatalf("queued %+v, want the child in the seed's session", child)
+	}
+
+	// a later run keeps the session the item was seeded with
+	if _, err := newCrawler("run-2").CrawlOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	pushed := cache.fungicide["fungicide"]
+	if len(pushed) != 2 {
+		t.Fatalf("%d pages pushed, want 2", len(pushed))
+	}
+	for i, wantEnvelope := range []string{"run-1", "run-2"} {
+		env, err := DecodeEnvelope([]byte(pushed[i]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		page, err := env.Page()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Session != "run-1" || env.SessionID != wantEnvelope {
+			t.Errorf("page %s has session %q in an envelope from %q, want run-1 from %q",
+				page.Location, page.Session, env.SessionID, wantEnvelope)
+		}
+	}
+}
+
+func TestEnqueueStampsSession(t *testing.T) {
+	cache := newMemCache()
+	c := NewCrawler(cache, nil, quiet, WithMyceliumIngressKey("ingress"), WithSessionID("run-1"))
+	ctx := context.Background()
+	for _, item := range []IngressItem{{Location: "https://a.example/"}, {Location: "https://b.example/", Session: "run-0"}} {
+		if err := c.Enqueue(ctx, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, want := range []string{"run-1", "run-0"} {
+		var item IngressItem
+		if err := json.Unmarshal([]byte(cache.queue("ingress")[i]), &item); err != nil {
+			t.Fatal(err)
+		}
+		if item.Session != want {
+			t.Errorf("%s queued in session %q, want %q", item.Location, item.Session, want)
+		}
+	}
+}
+
+func TestNewSessionID(t *testing.T) {
+	id := NewSessionID()
+	if !regexp.MustCompile(`^\d{8}T\d{6}Z-[0-9a-f]{8}$`).MatchString(id) {
+		t.Errorf("session id %q does not look like 20240102T150405Z-1a2b3c4d", id)
+	}
+	if NewSessionID() == id {
+		t.Error("two session ids are the same")
+	}
+}
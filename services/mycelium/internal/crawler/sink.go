@@ -0,0 +1,214 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const spoolExtension = ".spool"
+
+// FungicideBatchPusher is optionally implemented by caches that can push
+// several pages to fungicide in one round trip.
+type FungicideBatchPusher interface {
+	PushManyToFungicide(ctx context.Context, pages []string, queueKey string) error
+}
+
+// fungicideSink buffers pages bound for fungicide and pushes them in batches
+// of up to size pages, or every interval, whichever comes first. A batch that
+// fails to push is written to spoolDir and replayed when the sink starts.
+type fungicideSink struct {
+	mu       sync.Mutex
+	pending  []string
+	size     int
+	interval time.Duration
+	spoolDir string
+	push     func(ctx context.Context, batch []string) error
+	logger   *slog.Logger
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func newFungicideSink(size int, interval time.Duration, spoolDir string, push func(context.Context, []string) error, logger *slog.Logger) *fungicideSink {
+	return &fungicideSink{
+		size:     size,
+		interval: interval,
+		spoolDir: spoolDir,
+		push:     push,
+		logger:   logger,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// start replays any spooled batches and then flushes on the interval until
+// close is called.
+func (s *fungicideSink) start() {
+	go func() {
+		defer close(s.done)
+
+		if n, err := s.replay(context.Background()); err != nil {
+			s.logger.Error("failed to replay fungicide spool", "error", err)
+		} else if n > 0 {
+			s.logger.Info("replayed fungicide spool", "pages", n)
+		}
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				s.flush(context.Background())
+			}
+		}
+	}()
+}
+
+// add buffers page, flushing in the caller's goroutine once the batch is
+// full.
+func (s *fungicideSink) add(ctx context.Context, page string) {
+	s.mu.Lock()
+	s.pending = append(s.pending, page)
+	full := len(s.pending) >= s.size
+	s.mu.Unlock()
+
+	if full {
+		s.flush(ctx)
+	}
+}
+
+func (s *fungicideSink) flush(ctx context.Context) {
+	s.mu.Lock()
+	batch := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+	if err := s.push(ctx, batch); err != nil {
+		var partial *partialPushError
+		if errors.As(err, &partial) {
+			batch = batch[partial.pushed:]
+		}
+		s.logger.Error("failed to push batch to fungicide, spooling", "pages", len(batch), "error", err)
+		if err := s.spool(batch); err != nil {
+			s.logger.Error("failed to spool fungicide batch, pages lost", "pages", len(batch), "error", err)
+		}
+	}
+}
+
+// close stops the interval flush and pushes whatever is still buffered.
+func (s *fungicideSink) close(ctx context.Context) {
+	close(s.stop)
+	<-s.done
+	s.flush(ctx)
+}
+
+func (s *fungicideSink) spool(batch []string) error {
+	if s.spoolDir == "" {
+		return fmt.Errorf("no spool directory configured")
+	}
+	if err := os.MkdirAll(s.spoolDir, 0755); err != nil {
+		return fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	// pages may be binary, so spool them as base64 via []byte
+	pages := make([][]byte, len(batch))
+	for i, page := range batch {
+		pages[i] = []byte(page)
+	}
+	data, err := json.Marshal(pages)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.spoolDir, fmt.Sprintf("fungicide-%d%s", time.Now().UnixNano(), spoolExtension))
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write spool file: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// replay pushes every spooled batch, oldest first, removing each file once
+// it has been pushed. It stops at the first failure so the remaining files
+// are kept for the next start.
+func (s *fungicideSink) replay(ctx context.Context) (int, error) {
+	if s.spoolDir == "" {
+		return 0, nil
+	}
+	entries, err := os.ReadDir(s.spoolDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read spool directory: %w", err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), spoolExtension) {
+			files = append(files, filepath.Join(s.spoolDir, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+
+	replayed := 0
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return replayed, fmt.Errorf("failed to read spool file %s: %w", path, err)
+		}
+		var pages [][]byte
+		if err := json.Unmarshal(data, &pages); err != nil {
+			return replayed, fmt.Errorf("failed to parse spool file %s: %w", path, err)
+		}
+
+		batch := make([]string, len(pages))
+		for i, page := range pages {
+			batch[i] = string(page)
+		}
+		if err := s.push(ctx, batch); err != nil {
+			return replayed, fmt.Errorf("failed to push spool file %s: %w", path, err)
+		}
+		if err := os.Remove(path); err != nil {
+			return replayed, fmt.Errorf("failed to remove spool file %s: %w", path, err)
+		}
+		replayed += len(batch)
+	}
+	return replayed, nil
+}
+
+// pushFungicide pushes pages in a single call when the cache supports it.
+func (c *Crawler) pushFungicide(ctx context.Context, pages []string) error {
+	if batcher, ok := c.cache.(FungicideBatchPusher); ok {
+		return batcher.PushManyToFungicide(ctx, pages, c.fungicideQueueKey)
+	}
+	for i, page := range pages {
+		if err := c.cache.PushToFungicide(ctx, page, c.fungicideQueueKey); err != nil {
+			// only spool what was not pushed yet
+			return &partialPushError{err: err, pushed: i}
+		}
+	}
+	return nil
+}
+
+type partialPushError struct {
+	err    error
+	pushed int
+}
+
+func (e *partialPushError) Error() string { return e.err.Error() }
+func (e *partialPushError) Unwrap() error { return e.err }
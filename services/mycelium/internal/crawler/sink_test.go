@@ -0,0 +1,197 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingPusher collects pushed batches and fails while failing is set.
+type recordingPusher struct {
+	mu      sync.Mutex
+	batches [][]string
+	failing bool
+}
+
+func (p *recordingPusher) push(_ context.Context, batch []string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failing {
+		return errors.New("fungicide unavailable")
+	}
+	p.batches = append(p.batches, append([]string(nil), batch...))
+	return nil
+}
+
+func (p *recordingPusher) pushed() [][]string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([][]string(nil), p.batches...)
+}
+
+func (p *recordingPusher) setFailing(failing bool) {
+	p.mu.Lock()
+	p.failing = failing
+	p.mu.Unlock()
+}
+
+func testSink(pusher *recordingPusher, size int, interval time.Duration, spoolDir string) *fungicideSink {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return newFungicideSink(size, interval, spoolDir, pusher.push, logger)
+}
+
+func spoolFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*"+spoolExtension))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestSinkFlushesFullBatch(t *testing.T) {
+	pusher := &recordingPusher{}
+	sink := testSink(pusher, 3, time.Hour, t.TempDir())
+	sink.start()
+	defer sink.close(context.Background())
+
+	ctx := context.Background()
+	for _, page := range []string{"a", "b", "c", "d"} {
+		sink.add(ctx, page)
+	}
+
+	want := [][]string{{"a", "b", "c"}}
+	if got := pusher.pushed(); !reflect.DeepEqual(got, want) {
+		t.Errorf("pushed = %v, want %v", got, want)
+	}
+}
+
+func TestSinkFlushesOnInterval(t *testing.T) {
+	pusher := &recordingPusher{}
+	sink := testSink(pusher, 100, 20*time.Millisecond, t.TempDir())
+	sink.start()
+	defer sink.close(context.Background())
+
+	sink.add(context.Background(), "a")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(pusher.pushed()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("partial batch was not flushed on the interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := pusher.pushed(); !reflect.DeepEqual(got, [][]string{{"a"}}) {
+		t.Errorf("pushed = %v, want [[a]]", got)
+	}
+}
+
+func TestSinkFlushesOnClose(t *testing.T) {
+	pusher := &recordingPusher{}
+	sink := testSink(pusher, 100, time.Hour, t.TempDir())
+	sink.start()
+
+	sink.add(context.Background(), "a")
+	sink.add(context.Background(), "b")
+	sink.close(context.Background())
+
+	if got := pusher.pushed(); !reflect.DeepEqual(got, [][]string{{"a", "b"}}) {
+		t.Errorf("pushed = %v, want [[a b]]", got)
+	}
+}
+
+func TestSinkSpoolsAndReplaysFailedBatch(t *testing.T) {
+	dir := t.TempDir()
+	pusher := &recordingPusher{failing: true}
+	sink := testSink(pusher, 2, time.Hour, dir)
+	sink.start()
+
+	// binary pages must survive the spool unchanged
+	pages := []string{"\x00proto\xff", "b"}
+	for _, page := range pages {
+		sink.add(context.Background(), page)
+	}
+	sink.close(context.Background())
+
+	if got := pusher.pushed(); len(got) != 0 {
+		t.Fatalf("pushed = %v while fungicide was failing", got)
+	}
+	if files := spoolFiles(t, dir); len(files) != 1 {
+		t.Fatalf("spool files = %v, want 1", files)
+	}
+
+	pusher.setFailing(false)
+	n, err := testSink(pusher, 2, time.Hour, dir).replay(context.Background())
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if n != len(pages) {
+		t.Errorf("replayed %d pages, want %d", n, len(pages))
+	}
+	if got := pusher.pushed(); !reflect.DeepEqual(got, [][]string{pages}) {
+		t.Errorf("pushed = %q, want %q", got, pages)
+	}
+	if files := spoolFiles(t, dir); len(files) != 0 {
+		t.Errorf("spool files left after replay: %v", files)
+	}
+}
+
+func TestSinkReplayKeepsFilesOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	pusher := &recordingPusher{failing: true}
+	sink := testSink(pusher, 1, time.Hour, dir)
+	if err := sink.spool([]string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sink.replay(context.Background()); err == nil {
+		t.Fatal("replay succeeded while fungicide was failing")
+	}
+	if files := spoolFiles(t, dir); len(files) != 1 {
+		t.Errorf("spool files = %v, want the batch kept", files)
+	}
+}
+
+func TestSinkReplayWithoutSpoolDir(t *testing.T) {
+	pusher := &recordingPusher{}
+	missing := filepath.Join(t.TempDir(), "missing")
+	n, err := testSink(pusher, 1, time.Hour, missing).replay(context.Background())
+	if err != nil || n != 0 {
+		t.Errorf("replay = %d, %v; want 0, nil", n, err)
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Errorf("replay created %s", missing)
+	}
+}
+
+func TestPushFungicideSpoolsOnlyUnpushedPages(t *testing.T) {
+	cache := &failingFungicideCache{memCache: newMemCache(), failAfter: 1}
+	c := NewCrawler(cache, nil, WithFungicideQueueKey("fungicide"))
+
+	err := c.pushFungicide(context.Background(), []string{"a", "b", "c"})
+	var partial *partialPushError
+	if !errors.As(err, &partial) || partial.pushed != 1 {
+		t.Fatalf("pushFungicide error = %v, want partial push after 1 page", err)
+	}
+}
+
+// failingFungicideCache accepts failAfter fungicide pushes and then fails.
+type failingFungicideCache struct {
+	*memCache
+	failAfter int
+}
+
+func (f *failingFungicideCache) PushToFungicide(ctx context.Context, item string, key string) error {
+	if f.failAfter == 0 {
+		return errors.New("fungicide unavailable")
+	}
+	f.failAfter--
+	return f.memCache.PushToFungicide(ctx, item, key)
+}
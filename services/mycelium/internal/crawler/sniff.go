@@ -0,0 +1,36 @@
+package crawler
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// sniffLen is how much of a body http.DetectContentType looks at.
+const sniffLen = 512
+
+// sniffBody reads the start of body and returns it along with a reader that
+// replays it followed by the rest. Nothing past the sniffed bytes is read, so
+// a rejected body costs at most sniffLen.
+func sniffBody(body io.Reader) (io.Reader, []byte, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(body, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, nil, err
+	}
+	head = head[:n]
+	return io.MultiReader(bytes.NewReader(head), body), head, nil
+}
+
+// looksBinary trusts a null byte over anything DetectContentType says, since
+// text never contains one but some binary formats sniff as text/plain.
+func looksBinary(head []byte) bool {
+	if len(head) == 0 {
+		return false
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return true
+	}
+	return !strings.HasPrefix(http.DetectContentType(head), "text/")
+}
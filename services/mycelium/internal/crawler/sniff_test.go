@@ -0,0 +1,126 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// pngHeader is the start of a real PNG file.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x10\x00\x00\x00\x10\x08\x06\x00\x00\x00\x1f\xf3\xffa")
+
+func getPage(t *testing.T, c *Crawler, rawUrl string) (*Page, error) {
+	t.Helper()
+	loc, err := url.Parse(rawUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.GetPage(context.Background(), loc)
+}
+
+func TestGetPageRejectsBinaryLabelledAsHTML(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(pngHeader)
+		w.Write(bytes.Repeat([]byte{0xAB}, 64*1024))
+	}))
+	defer srv.Close()
+
+	c := NewCrawler(nil, nil, quiet)
+	page, err := getPage(t, c, srv.URL+"/image.html")
+	if !errors.Is(err, ErrUnsupportedContentType) {
+		t.Fatalf("GetPage = %v, %v, want ErrUnsupportedContentType", page, err)
+	}
+	if !strings.Contains(err.Error(), "binary") {
+		t.Errorf("error %q does not say the body is binary", err)
+	}
+}
+
+func TestGetPageRejectsNullBytes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		// sniffs as text/plain but no text holds a null byte
+		fmt.Fprint(w, "plain looking\x00data")
+	}))
+	defer srv.Close()
+
+	if _, err := getPage(t, NewCrawler(nil, nil, quiet), srv.URL+"/"); !errors.Is(err, ErrUnsupportedContentType) {
+		t.Fatalf("GetPage = %v, want ErrUnsupportedContentType", err)
+	}
+}
+
+func TestGetPageAcceptsHTML(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		// the title sits in the sniffed bytes and the link well past them
+		fmt.Fprintf(w, "<html><head><title>Sniffed</title></head><body><p>%s</p><a href=\"http://%s/after\">after</a></body></html>",
+			strings.Repeat("filler ", 200), r.Host)
+	}))
+	defer srv.Close()
+
+	page, err := getPage(t, NewCrawler(nil, nil, quiet), srv.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Title != "Sniffed" {
+		t.Errorf("title = %q, want the sniffed bytes parsed too", page.Title)
+	}
+	if len(page.Links) != 1 || page.Links[0].Path != "/after" {
+		t.Errorf("links = %v, want the link after the sniffed bytes", page.Links)
+	}
+}
+
+// countingSource is an endless reader that counts what was read from it.
+type countingSource struct {
+	n int
+}
+
+func (s *countingSource) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	s.n += len(p)
+	return len(p), nil
+}
+
+func TestSniffBodyReadsOnlyTheHead(t *testing.T) {
+	src := &countingSource{}
+	replay, head, err := sniffBody(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(head) != sniffLen || src.n != sniffLen {
+		t.Errorf("sniffed %d bytes and read %d, want %d", len(head), src.n, sniffLen)
+	}
+	if !looksBinary(head) {
+		t.Error("null bytes not seen as binary")
+	}
+
+	all, err := io.ReadAll(io.LimitReader(replay, 2*sniffLen))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2*sniffLen {
+		t.Errorf("replay returned %d bytes, want the head followed by the rest", len(all))
+	}
+}
+
+func TestSniffBodyShortBody(t *testing.T) {
+	replay, head, err := sniffBody(strings.NewReader("<p>hi</p>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(head) != "<p>hi</p>" || looksBinary(head) {
+		t.Errorf("head = %q, binary %t", head, looksBinary(head))
+	}
+	if all, _ := io.ReadAll(replay); string(all) != "<p>hi</p>" {
+		t.Errorf("replay = %q", all)
+	}
+}
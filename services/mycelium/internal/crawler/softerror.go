@@ -0,0 +1,170 @@
+package crawler
+
+import (
+	_ "embed"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"mycelium/internal/filter"
+)
+
+// SoftErrorPolicy controls what Crawl does with pages that answer with a
+// success status but look like an error page, such as a "page not found"
+// served with 200.
+type SoftErrorPolicy string
+
+const (
+	// SoftErrorOff skips detection.
+	SoftErrorOff SoftErrorPolicy = "off"
+	// SoftErrorMark sets Page.SoftError and otherwise handles the page as
+	// usual.
+	SoftErrorMark SoftErrorPolicy = "mark"
+	// SoftErrorDrop handles soft errors like a 404: the page is neither
+	// sent to fungicide nor stored and its links are not queued.
+	SoftErrorDrop SoftErrorPolicy = "drop"
+)
+
+// WithSoftErrorPolicy sets how Crawl handles soft errors. The default is
+// SoftErrorDrop.
+func WithSoftErrorPolicy(policy SoftErrorPolicy) CrawlerOption {
+	return func(c *Crawler) {
+		c.softErrorPolicy = policy
+	}
+}
+
+// softErrorLabel is the drop reason and metric suffix of dropped soft errors.
+const softErrorLabel = "soft_404"
+
+//go:embed softerror_phrases.txt
+var notFoundPhraseData string
+
+var notFoundPhrases = parsePhrases(notFoundPhraseData)
+
+var status404Regex = regexp.MustCompile(`\b404\b`)
+
+// parsePhrases reads one lower cased phrase per line, skipping blank lines
+// and "#" comments.
+func parsePhrases(data string) []string {
+	var phrases []string
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		phrases = append(phrases, strings.ToLower(line))
+	}
+	return phrases
+}
+
+const (
+	// softErrorThreshold is the score at which a page counts as a soft error.
+	// No single weak signal reaches it.
+	softErrorThreshold = 3
+	// softErrorThinWords is the word count under which a page is thin
+	// enough for its content to say something about it.
+	softErrorThinWords = 150
+	// softErrorLongWords is the word count from which only a redirect to
+	// the home page can mark a page; long pages are rarely error templates
+	// but often write about errors.
+	softErrorLongWords = 1000
+	// softErrorScanBlocks is how many leading headings and content blocks
+	// are searched for phrases.
+	softErrorScanBlocks = 5
+)
+
+// detectSoftError scores page against the soft 404 heuristics and returns
+// the signals that fired, or "" when the page looks fine. requested is the
+// url that was asked for, which differs from finalURL after redirects.
+func detectSoftError(page *Page, requested *url.URL, finalURL *url.URL) string {
+	score := 0
+	var signals []string
+	add := func(weight int, signal string) {
+		score += weight
+		signals = append(signals, signal)
+	}
+
+	if redirectedHome(requested, finalURL) {
+		// one level down it may just be /index.html or /en
+		if pathDepth(requested) >= 2 {
+			add(3, "redirected to home page")
+		} else {
+			add(2, "redirected to home page")
+		}
+	}
+
+	words := 0
+	for _, c := range page.Content {
+		words += len(strings.Fields(c))
+	}
+	if words >= softErrorLongWords {
+		if score >= softErrorThreshold {
+			return strings.Join(signals, "; ")
+		}
+		return ""
+	}
+
+	title := normalizeSpace(page.Title)
+	if phrase, found := matchPhrase(title); found {
+		add(3, fmt.Sprintf("title contains %q", phrase))
+	} else if status404Regex.MatchString(title) {
+		add(2, "title contains 404")
+	}
+	for _, heading := range page.Headings[:min(len(page.Headings), softErrorScanBlocks)] {
+		if phrase, found := matchPhrase(normalizeSpace(heading)); found {
+			add(2, fmt.Sprintf("heading contains %q", phrase))
+			break
+		}
+	}
+	if words < softErrorThinWords {
+		for _, c := range page.Content[:min(len(page.Content), softErrorScanBlocks)] {
+			if phrase, found := matchPhrase(normalizeSpace(c)); found {
+				add(1, fmt.Sprintf("content contains %q", phrase))
+				break
+			}
+		}
+		if pathDepth(requested) >= 2 && words < softErrorThinWords/3 {
+			add(1, fmt.Sprintf("%d words at path depth %d", words, pathDepth(requested)))
+		}
+	}
+
+	if score < softErrorThreshold {
+		return ""
+	}
+	return strings.Join(signals, "; ")
+}
+
+func matchPhrase(text string) (string, bool) {
+	text = strings.ToLower(text)
+	for _, phrase := range notFoundPhrases {
+		if strings.Contains(text, phrase) {
+			return phrase, true
+		}
+	}
+	return "", false
+}
+
+func normalizeSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// pathDepth counts the non-empty segments of u's path.
+func pathDepth(u *url.URL) int {
+	depth := 0
+	for _, segment := range strings.Split(u.Path, "/") {
+		if segment != "" {
+			depth++
+		}
+	}
+	return depth
+}
+
+// redirectedHome reports whether a request for a page below the root ended
+// on the root of the same site, the usual way of hiding a missing page.
+func redirectedHome(requested *url.URL, finalURL *url.URL) bool {
+	if finalURL == nil || pathDepth(requested) == 0 || pathDepth(finalURL) != 0 || finalURL.RawQuery != "" {
+		return false
+	}
+	return filter.RegistrableDomain(requested.Hostname()) == filter.RegistrableDomain(finalURL.Hostname())
+}
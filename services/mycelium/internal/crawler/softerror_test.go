@@ -0,0 +1,110 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestDetectSoftError(t *testing.T) {
+	long := strings.Repeat("The history of the printing press is long and varied. ", 200)
+	tests := []struct {
+		name      string
+		requested string
+		final     string
+		title     string
+		headings  []string
+		content   []string
+		want      bool
+	}{
+		{name: "normal page", requested: "https://example.com/blog/post", title: "Printing presses", content: []string{"An article about printing."}},
+		{name: "not found title", requested: "https://example.com/blog/post", title: "Page Not Found | Example", want: true},
+		{name: "404 title alone", requested: "https://example.com/post", title: "404", content: []string{"A short page about the number."}},
+		{name: "404 title on a thin deep page", requested: "https://example.com/blog/2024/post", title: "Error 404", content: []string{"Sorry."}, want: true},
+		{name: "heading and content", requested: "https://example.com/post", title: "Example", headings: []string{"Oops! Page not found"}, content: []string{"The page you are looking for has moved."}, want: true},
+		{name: "heading alone", requested: "https://example.com/post", title: "Example", headings: []string{"Page not found"}, content: []string{strings.Repeat("word ", 200)}},
+		{name: "redirected home from deep", requested: "https://example.com/shop/item/42", final: "https://www.example.com/", title: "Example shop", content: []string{strings.Repeat("word ", 200)}, want: true},
+		{name: "redirected home from one level down", requested: "https://example.com/en", final: "https://example.com/", title: "Example", content: []string{strings.Repeat("word ", 200)}},
+		{name: "redirected to another site", requested: "https://example.com/shop/item/42", final: "https://example.org/", title: "Example", content: []string{strings.Repeat("word ", 200)}},
+		{name: "long article about errors", requested: "https://example.com/blog/post", title: "Why your page not found errors matter", content: []string{long}},
+		{name: "long page redirected home", requested: "https://example.com/shop/item/42", final: "https://example.com/", title: "Example shop", content: []string{long}, want: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page := &Page{Title: test.title, Headings: test.headings, Content: test.content}
+			var final *url.URL
+			if test.final != "" {
+				final = mustParse(t, test.final)
+			}
+			got := detectSoftError(page, mustParse(t, test.requested), final)
+			if (got != "") != test.want {
+				t.Errorf("detectSoftError = %q, want a soft error: %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSoftErrorPolicy(t *testing.T) {
+	srv := httptest.NewServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><head><title>Page not found</title></head><body><h1>Page not found</h1><a href="http://%s/next">home</a></body></html>`, r.Host)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		policy     SoftErrorPolicy
+		wantStored bool
+		wantMarked bool
+		wantQueued bool
+	}{
+		{policy: SoftErrorOff, wantStored: true, wantQueued: true},
+		{policy: SoftErrorMark, wantStored: true, wantMarked: true, wantQueued: true},
+		{policy: SoftErrorDrop},
+	}
+	for _, test := range tests {
+		t.Run(string(test.policy), func(t *testing.T) {
+			cache := newMemCache()
+			store := newMemStore()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			metrics := countUntilFetch{NewCounterMetrics(), cancel}
+			c := NewCrawler(cache, store, quiet, WithMyceliumIngressKey("ingress"), WithMetrics(metrics),
+				WithLinkQueueingMode(LinkQueueingAlways), WithSoftErrorPolicy(test.policy))
+			if err := c.Enqueue(context.Background(), IngressItem{Location: srv.URL + "/missing/page"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Crawl(ctx); !errors.Is(err, context.Canceled) {
+				t.Fatalf("Crawl = %v, want it canceled after the fetch", err)
+			}
+
+			var stored []*Page
+			for _, data := range store.items {
+				page, err := UnmarshalPage(data)
+				if err != nil {
+					t.Fatal(err)
+				}
+				stored = append(stored, page)
+			}
+			if (len(stored) == 1) != test.wantStored {
+				t.Fatalf("stored %d pages, want stored: %t", len(stored), test.wantStored)
+			}
+			if test.wantStored && (stored[0].SoftError != "") != test.wantMarked {
+				t.Errorf("SoftError = %q, want marked: %t", stored[0].SoftError, test.wantMarked)
+			}
+			if queued := len(queuedLocations(t, cache)) > 0; queued != test.wantQueued {
+				t.Errorf("links queued: %t, want %t", queued, test.wantQueued)
+			}
+			wantCounted := int64(0)
+			if test.policy != SoftErrorOff {
+				wantCounted = 1
+			}
+			if n := metrics.Get(MetricSoftErrors); n != wantCounted {
+				t.Errorf("counted %d soft errors, want %d", n, wantCounted)
+			}
+		})
+	}
+}
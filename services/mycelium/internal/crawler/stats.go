@@ -0,0 +1,101 @@
+package crawler
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of what a Crawler has done since it was created. It is
+// kept whether or not a Metrics sink is configured.
+type Stats struct {
+	ItemsPopped  int64 `json:"itemsPopped"`
+	PagesFetched int64 `json:"pagesFetched"`
+	// BytesDownloaded counts response body bytes as received, before
+	// decompression. Bodies are only read as far as needed.
+	BytesDownloaded int64 `json:"bytesDownloaded"`
+	// BytesDecoded counts the same bodies after decompression.
+	BytesDecoded int64 `json:"bytesDecoded"`
+	// BytesByDomain splits BytesDownloaded by registrable domain.
+	BytesByDomain map[string]int64 `json:"bytesByDomain"`
+	FetchErrors   int64            `json:"fetchErrors"`
+	// FetchErrorsByClass is keyed by the same labels as the
+	// items_dropped_ metrics, e.g. http_503 or page_timeout.
+	FetchErrorsByClass map[string]int64 `json:"fetchErrorsByClass"`
+	LinksExtracted     int64            `json:"linksExtracted"`
+	LinksQueued        int64            `json:"linksQueued"`
+	// DroppedByReason uses the reasons passed to Hooks.OnItemDropped.
+	DroppedByReason map[string]int64 `json:"droppedByReason"`
+	InFlight        int64            `json:"inFlight"`
+	// QueueLatencyP50 and QueueLatencyP95 are quantiles of how long the
+	// most recently popped items waited in the ingress queue.
+	QueueLatencyP50 time.Duration `json:"queueLatencyP50"`
+	QueueLatencyP95 time.Duration `json:"queueLatencyP95"`
+}
+
+type crawlStats struct {
+	itemsPopped     atomic.Int64
+	pagesFetched    atomic.Int64
+	bytesDownloaded atomic.Int64
+	bytesDecoded    atomic.Int64
+	fetchErrors     atomic.Int64
+	linksExtracted  atomic.Int64
+	linksQueued     atomic.Int64
+	inFlight        atomic.Int64
+	errorClasses    labelCounts
+	droppedReasons  labelCounts
+	bytesByDomain   labelCounts
+	queueLatency    latencySamples
+}
+
+type labelCounts struct {
+	counts sync.Map
+}
+
+func (l *labelCounts) incr(label string) {
+	l.add(label, 1)
+}
+
+func (l *labelCounts) add(label string, n int64) {
+	counter, found := l.counts.Load(label)
+	if !found {
+		counter, _ = l.counts.LoadOrStore(label, new(atomic.Int64))
+	}
+	counter.(*atomic.Int64).Add(n)
+}
+
+func (l *labelCounts) snapshot() map[string]int64 {
+	snapshot := map[string]int64{}
+	l.counts.Range(func(k, v any) bool {
+		snapshot[k.(string)] = v.(*atomic.Int64).Load()
+		return true
+	})
+	return snapshot
+}
+
+// Stats returns the crawler's counters. It is safe to call concurrently with
+// crawling and cheap enough to poll every second.
+func (c *Crawler) Stats() Stats {
+	latency := c.stats.queueLatency.quantiles(0.5, 0.95)
+	return Stats{
+		ItemsPopped:        c.stats.itemsPopped.Load(),
+		PagesFetched:       c.stats.pagesFetched.Load(),
+		BytesDownloaded:    c.stats.bytesDownloaded.Load(),
+		BytesDecoded:       c.stats.bytesDecoded.Load(),
+		BytesByDomain:      c.stats.bytesByDomain.snapshot(),
+		FetchErrors:        c.stats.fetchErrors.Load(),
+		FetchErrorsByClass: c.stats.errorClasses.snapshot(),
+		LinksExtracted:     c.stats.linksExtracted.Load(),
+		LinksQueued:        c.stats.linksQueued.Load(),
+		DroppedByReason:    c.stats.droppedReasons.snapshot(),
+		InFlight:           c.stats.inFlight.Load(),
+		QueueLatencyP50:    latency[0],
+		QueueLatencyP95:    latency[1],
+	}
+}
+
+// itemDropped counts a dropped item and tells the hook.
+func (c *Crawler) itemDropped(item IngressItem, reason string) {
+	c.stats.droppedReasons.incr(reason)
+	c.hooks.itemDropped(item, reason)
+}
@@ -0,0 +1,105 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestStatsScriptedCrawl(t *testing.T) {
+	const body = `<html><body><a href="/a">a</a><a href="/b">b</a><a href="/missing">missing</a></body></html>`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, body)
+		case "/missing":
+			http.NotFound(w, r)
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "<html><body>leaf</body></html>")
+		}
+	}))
+	defer srv.Close()
+
+	cache := newMemCache()
+	c := NewCrawler(cache, nil, quiet, WithMyceliumIngressKey("ingress"),
+		WithUrlFilters([]UrlFilter{hostFilter("spam.test")}))
+	if err := c.Enqueue(context.Background(), IngressItem{Location: srv.URL + "/"}); err != nil {
+		t.Fatal(err)
+	}
+	// a repeat of the root and a blocked url pushed past Enqueue's checks
+	cache.PushToMyceliumIngress(context.Background(), fmt.Sprintf(`{"location":%q}`, srv.URL+"/"), "ingress")
+	cache.PushToMyceliumIngress(context.Background(), `{"location":"https://spam.test/"}`, "ingress")
+
+	for {
+		if _, err := c.CrawlOnce(context.Background()); err != nil {
+			if !errors.Is(err, ErrQueueEmpty) {
+				t.Fatal(err)
+			}
+			break
+		}
+	}
+
+	stats := c.Stats()
+	// the root, its repeat, the blocked url and the three links
+	if stats.ItemsPopped != 6 {
+		t.Errorf("popped %d, want 6", stats.ItemsPopped)
+	}
+	if stats.PagesFetched != 3 || stats.FetchErrors != 1 {
+		t.Errorf("fetched %d with %d errors, want 3 and 1", stats.PagesFetched, stats.FetchErrors)
+	}
+	if want := int64(len(body) + 2*len("<html><body>leaf</body></html>")); stats.BytesDownloaded != want {
+		t.Errorf("downloaded %d bytes, want %d", stats.BytesDownloaded, want)
+	}
+	if stats.LinksExtracted != 3 || stats.LinksQueued != 3 {
+		t.Errorf("extracted %d links and queued %d, want 3 and 3", stats.LinksExtracted, stats.LinksQueued)
+	}
+	if want := map[string]int64{"http_404": 1}; !maps.Equal(stats.FetchErrorsByClass, want) {
+		t.Errorf("errors by class %v, want %v", stats.FetchErrorsByClass, want)
+	}
+	if want := map[string]int64{"visited": 1, "blocked": 1, "http_404": 1}; !maps.Equal(stats.DroppedByReason, want) {
+		t.Errorf("dropped by reason %v, want %v", stats.DroppedByReason, want)
+	}
+	if stats.InFlight != 0 {
+		t.Errorf("%d in flight after the crawl, want 0", stats.InFlight)
+	}
+}
+
+func TestStatsWithoutMetricsSink(t *testing.T) {
+	srv := typedServer(t, "text/html", "<html><body>page</body></html>")
+	c := NewCrawler(newMemCache(), nil, quiet, WithMyceliumIngressKey("ingress"))
+	if err := c.Enqueue(context.Background(), IngressItem{Location: srv.URL + "/"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CrawlOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := c.Stats().PagesFetched; n != 1 {
+		t.Errorf("fetched %d pages with no Metrics configured, want 1", n)
+	}
+}
+
+func TestStatsConcurrentReads(t *testing.T) {
+	c := NewCrawler(nil, nil, quiet)
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				c.itemDropped(IngressItem{}, fmt.Sprint("reason", i%2))
+				c.Stats()
+			}
+		}()
+	}
+	wg.Wait()
+	if got := c.Stats().DroppedByReason; got["reason0"] != 400 || got["reason1"] != 400 {
+		t.Errorf("dropped by reason %v, want 400 each", got)
+	}
+}
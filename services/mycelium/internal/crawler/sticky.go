@@ -0,0 +1,54 @@
+package crawler
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+
+	"mycelium/internal/filter"
+)
+
+type stickyEntry struct {
+	domain string
+	header http.Header
+}
+
+// stickyUserAgents remembers the header profile first picked for each
+// registrable domain so repeat visits look like the same browser.
+type stickyUserAgents struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+func newStickyUserAgents(capacity int) *stickyUserAgents {
+	return &stickyUserAgents{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  map[string]*list.Element{},
+	}
+}
+
+func (s *stickyUserAgents) get(host string, pick func() http.Header) http.Header {
+	domain := filter.RegistrableDomain(host)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, found := s.entries[domain]; found {
+		s.order.MoveToFront(elem)
+		return elem.Value.(*stickyEntry).header.Clone()
+	}
+
+	header := pick()
+	s.entries[domain] = s.order.PushFront(&stickyEntry{domain: domain, header: header.Clone()})
+
+	if s.order.Len() > s.capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*stickyEntry).domain)
+	}
+
+	return header
+}
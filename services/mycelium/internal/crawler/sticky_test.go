@@ -0,0 +1,148 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// cyclingChooser hands out a different user agent on every pick.
+type cyclingChooser struct {
+	mu    sync.Mutex
+	next  int
+	count int
+}
+
+func (c *cyclingChooser) Pick() http.Header {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h := http.Header{}
+	h.Set(userAgentCanonicalHeader, fmt.Sprintf("Agent/%d", c.next%c.count))
+	c.next++
+	return h
+}
+
+// headerRecorder is a RoundTripper answering every request with an empty
+// html page and remembering the headers it was sent, so tests can fetch
+// from any host without a network.
+type headerRecorder struct {
+	mu   sync.Mutex
+	last http.Header
+}
+
+func (rec *headerRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec.mu.Lock()
+	rec.last = req.Header.Clone()
+	rec.mu.Unlock()
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"text/html"}},
+		Body:       io.NopCloser(strings.NewReader("<html></html>")),
+		Request:    req,
+	}, nil
+}
+
+// recordingCrawler returns a crawler whose requests all go to a
+// headerRecorder.
+func recordingCrawler(opt ...CrawlerOption) (*Crawler, *headerRecorder) {
+	rec := &headerRecorder{}
+	opt = append([]CrawlerOption{WithHttpClient(&http.Client{Transport: rec})}, opt...)
+	return NewCrawler(nil, nil, opt...), rec
+}
+
+// browserUserAgent fetches rawUrl and returns the user agent sent for it.
+func browserUserAgent(t *testing.T, c *Crawler, rec *headerRecorder, rawUrl string) string {
+	t.Helper()
+	loc, err := url.Parse(rawUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetPage(context.Background(), loc); err != nil {
+		t.Fatal(err)
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.last.Get(userAgentCanonicalHeader)
+}
+
+func TestStickyUserAgentConsistentPerDomain(t *testing.T) {
+	c, rec := recordingCrawler(WithHeaderChooser(&cyclingChooser{count: 10}), WithStickyUserAgents(true))
+
+	first := browserUserAgent(t, c, rec, "https://www.example.com/")
+	for _, rawUrl := range []string{
+		"https://www.example.com/about",
+		"https://shop.example.com/cart",
+		"http://example.com/?page=2",
+	} {
+		if got := browserUserAgent(t, c, rec, rawUrl); got != first {
+			t.Errorf("%s sent %q, want %q as for the rest of example.com", rawUrl, got, first)
+		}
+	}
+}
+
+func TestStickyUserAgentDiverseAcrossDomains(t *testing.T) {
+	c, rec := recordingCrawler(WithHeaderChooser(&cyclingChooser{count: 5}), WithStickyUserAgents(true))
+
+	seen := map[string]bool{}
+	for i := 0; i < 20; i++ {
+		seen[browserUserAgent(t, c, rec, fmt.Sprintf("https://site%d.com/", i))] = true
+	}
+	if len(seen) != 5 {
+		t.Errorf("20 domains got %d distinct user agents, want all 5", len(seen))
+	}
+}
+
+func TestUserAgentRotatesWithoutSticky(t *testing.T) {
+	c, rec := recordingCrawler(WithHeaderChooser(&cyclingChooser{count: 5}), WithStickyUserAgents(false))
+
+	if browserUserAgent(t, c, rec, "https://example.com/a") == browserUserAgent(t, c, rec, "https://example.com/b") {
+		t.Error("user agent did not rotate between requests with sticky mode off")
+	}
+}
+
+func TestUserAgentPicksAreCounted(t *testing.T) {
+	metrics := NewCounterMetrics()
+	c, rec := recordingCrawler(WithHeaderChooser(&cyclingChooser{count: 2}), WithMetrics(metrics))
+
+	for i := range 5 {
+		browserUserAgent(t, c, rec, fmt.Sprintf("https://example.com/%d", i))
+	}
+	if a, b := metrics.GetLabeled(MetricUserAgentPicks, LabelUserAgent, "Agent/0"), metrics.GetLabeled(MetricUserAgentPicks, LabelUserAgent, "Agent/1"); a != 3 || b != 2 {
+		t.Errorf("counted %d and %d requests per user agent, want 3 and 2", a, b)
+	}
+}
+
+func TestStickyUserAgentsEvictsLeastRecentlyUsed(t *testing.T) {
+	s := newStickyUserAgents(2)
+	chooser := &cyclingChooser{count: 100}
+
+	a := s.get("a.com", chooser.Pick).Get(userAgentCanonicalHeader)
+	s.get("b.com", chooser.Pick)
+	// touching a.com makes b.com the oldest
+	s.get("a.com", chooser.Pick)
+	s.get("c.com", chooser.Pick)
+
+	if got := s.get("a.com", chooser.Pick).Get(userAgentCanonicalHeader); got != a {
+		t.Errorf("a.com got %q after eviction, want %q", got, a)
+	}
+	if _, found := s.entries["b.com"]; found {
+		t.Error("b.com still remembered, want it evicted")
+	}
+}
+
+func TestStickyUserAgentsReturnsCopies(t *testing.T) {
+	s := newStickyUserAgents(10)
+	chooser := &cyclingChooser{count: 100}
+
+	h := s.get("example.com", chooser.Pick)
+	want := h.Get(userAgentCanonicalHeader)
+	h.Set(userAgentCanonicalHeader, "changed")
+	if got := s.get("example.com", chooser.Pick).Get(userAgentCanonicalHeader); got != want {
+		t.Errorf("remembered user agent = %q after the caller changed its copy, want %q", got, want)
+	}
+}
@@ -0,0 +1,46 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestCrawlWithoutStoreOrFungicide checks a crawler with neither a store
+// nor a fungicide queue still fetches pages and queues their links.
+func TestCrawlWithoutStoreOrFungicide(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<html><body><a href="http://%s/next">next</a></body></html>`, r.Host)
+	}))
+	defer srv.Close()
+
+	cache := newMemCache()
+	metrics := NewCounterMetrics()
+	c := NewCrawler(cache, nil,
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithMyceliumIngressKey("ingress"),
+		WithMetrics(metrics))
+	if err := c.Enqueue(context.Background(), IngressItem{Location: srv.URL + "/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.Crawl(ctx) }()
+	// the second page is only reached through the link queued from the first
+	deadline := time.Now().Add(time.Second)
+	for metrics.Get(MetricPagesFetched) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the linked page, metrics %v", metrics.Snapshot())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+}
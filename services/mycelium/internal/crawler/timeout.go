@@ -0,0 +1,31 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// WithPageTimeout bounds the whole of GetPage, from connecting through
+// reading and parsing the body, to d. Pages that run over fail with
+// ErrPageTimeout and are retried. Unlike WithRequestTimeout it also covers
+// parsing. A non-positive d disables it.
+func WithPageTimeout(d time.Duration) CrawlerOption {
+	return func(c *Crawler) {
+		c.pageTimeout = d
+	}
+}
+
+// ctxReader stops a parser at its next read once ctx is done, even if the
+// rest of the body is already buffered.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *ctxReader) Read(p []byte) (int, error) {
+	if err := context.Cause(cr.ctx); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
@@ -0,0 +1,92 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// trickleServer sends the head of a page at once, then a byte every interval
+// until the client goes away.
+func trickleServer(t *testing.T, interval time.Duration) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><body>")
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(interval):
+			}
+			if _, err := fmt.Fprint(w, "x"); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestPageTimeoutBoundsSlowBodies(t *testing.T) {
+	srv := trickleServer(t, 10*time.Millisecond)
+	c := NewCrawler(nil, nil, quiet, WithPageTimeout(200*time.Millisecond))
+
+	start := time.Now()
+	_, err := getPage(t, c, srv.URL+"/")
+	if !errors.Is(err, ErrPageTimeout) {
+		t.Fatalf("GetPage = %v, want ErrPageTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("GetPage took %s, want it cut off near the budget", elapsed)
+	}
+	if outcome := classifyFetchError(err); outcome != OutcomeRetryable {
+		t.Errorf("outcome = %q, want retryable", outcome)
+	}
+}
+
+func TestPageTimeoutStopsParsing(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(ErrPageTimeout)
+	r := &ctxReader{ctx: ctx, r: strings.NewReader("<html><body>buffered</body></html>")}
+	if n, err := r.Read(make([]byte, 64)); n != 0 || err != ErrPageTimeout {
+		t.Errorf("Read = %d, %v; want the timeout before any bytes", n, err)
+	}
+}
+
+func TestPageTimeoutRequeuesItem(t *testing.T) {
+	srv := trickleServer(t, 10*time.Millisecond)
+	cache := newMemCache()
+	metrics := NewCounterMetrics()
+	c := NewCrawler(cache, nil, quiet, WithMyceliumIngressKey("ingress"), WithMetrics(metrics),
+		WithPageTimeout(100*time.Millisecond), WithMaxRetries(1))
+	if err := c.Enqueue(context.Background(), IngressItem{Location: srv.URL + "/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.CrawlOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := metrics.Get(MetricItemsRetried); n != 1 {
+		t.Fatalf("retried %d times, want 1", n)
+	}
+	queued := cache.queue("ingress")
+	if len(queued) != 1 {
+		t.Fatalf("queued %v, want the item back in ingress", queued)
+	}
+	var item IngressItem
+	if err := json.Unmarshal([]byte(queued[0]), &item); err != nil {
+		t.Fatal(err)
+	}
+	if item.Retries != 1 {
+		t.Errorf("requeued with %d retries, want 1", item.Retries)
+	}
+}
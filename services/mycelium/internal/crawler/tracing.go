@@ -0,0 +1,53 @@
+package crawler
+
+import (
+	"io"
+	"net/url"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// tracerName identifies the crawler's spans to the tracer provider.
+const tracerName = "mycelium/internal/crawler"
+
+const (
+	SpanCrawlItem     = "crawl.item"
+	SpanQueuePop      = "queue.pop"
+	SpanFetch         = "fetch"
+	SpanParse         = "parse"
+	SpanStore         = "store"
+	SpanFungicidePush = "fungicide.push"
+)
+
+// WithTracerProvider traces every crawled item with spans for its stages
+// (queue.pop, fetch, parse, store and fungicide.push) under a crawl.item
+// root. Without it tracing is a no-op.
+func WithTracerProvider(tp trace.TracerProvider) CrawlerOption {
+	return func(c *Crawler) {
+		c.tracer = tp.Tracer(tracerName)
+	}
+}
+
+func nopTracer() trace.Tracer {
+	return noop.NewTracerProvider().Tracer(tracerName)
+}
+
+// countingReader counts the body bytes read for the fetch span.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+func hostOf(location string) string {
+	if u, err := url.Parse(location); err == nil {
+		return u.Hostname()
+	}
+	return ""
+}
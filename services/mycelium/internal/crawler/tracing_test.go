@@ -0,0 +1,166 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// stopAfterAttempt cancels the crawl once a fetch has succeeded or failed.
+type stopAfterAttempt context.CancelFunc
+
+func (stop stopAfterAttempt) Incr(name string, delta int64) {
+	if name == MetricPagesFetched || name == MetricFetchErrors {
+		stop()
+	}
+}
+
+// traceOneItem crawls location with a recording tracer provider and returns
+// the ended spans by name.
+func traceOneItem(t *testing.T, location string) map[string]sdktrace.ReadOnlySpan {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := NewCrawler(newMemCache(), newMemStore(),
+		quiet,
+		WithMyceliumIngressKey("ingress"),
+		WithMetrics(stopAfterAttempt(cancel)),
+		WithTracerProvider(tp))
+	if err := c.Enqueue(context.Background(), IngressItem{Location: location}); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() { done <- c.Crawl(ctx) }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		cancel()
+		<-done
+		t.Fatalf("timed out crawling %s", location)
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		if _, ok := spans[span.Name()]; ok {
+			t.Fatalf("span %s recorded twice", span.Name())
+		}
+		spans[span.Name()] = span
+	}
+	return spans
+}
+
+func spanAttr(span sdktrace.ReadOnlySpan, key string) (attribute.Value, bool) {
+	for _, kv := range span.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func assertChild(t *testing.T, spans map[string]sdktrace.ReadOnlySpan, child, parent string) {
+	t.Helper()
+	c, ok := spans[child]
+	if !ok {
+		t.Fatalf("no %s span, got %v", child, spanNames(spans))
+	}
+	if got, want := c.Parent().SpanID(), spans[parent].SpanContext().SpanID(); got != want {
+		t.Errorf("%s span parent = %s, want %s", child, got, parent)
+	}
+	if c.SpanContext().TraceID() != spans[parent].SpanContext().TraceID() {
+		t.Errorf("%s span is not in the %s trace", child, parent)
+	}
+}
+
+func spanNames(spans map[string]sdktrace.ReadOnlySpan) []string {
+	var names []string
+	for name := range spans {
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestTracingSuccessfulFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><body><a href="/next">next</a></body></html>`)
+	}))
+	defer srv.Close()
+	host := mustParse(t, srv.URL).Hostname()
+
+	spans := traceOneItem(t, srv.URL+"/")
+
+	root, ok := spans[SpanCrawlItem]
+	if !ok {
+		t.Fatalf("no %s span, got %v", SpanCrawlItem, spanNames(spans))
+	}
+	if root.Parent().IsValid() {
+		t.Errorf("%s span has a parent", SpanCrawlItem)
+	}
+	if v, _ := spanAttr(root, "url.host"); v.AsString() != host {
+		t.Errorf("%s url.host = %q, want %q", SpanCrawlItem, v.AsString(), host)
+	}
+	if v, ok := spanAttr(root, "retries"); !ok || v.AsInt64() != 0 {
+		t.Errorf("%s retries = %v, want 0", SpanCrawlItem, v.Emit())
+	}
+
+	assertChild(t, spans, SpanQueuePop, SpanCrawlItem)
+	assertChild(t, spans, SpanFetch, SpanCrawlItem)
+	assertChild(t, spans, SpanParse, SpanFetch)
+	assertChild(t, spans, SpanStore, SpanCrawlItem)
+
+	fetch := spans[SpanFetch]
+	if v, _ := spanAttr(fetch, "http.status_code"); v.AsInt64() != http.StatusOK {
+		t.Errorf("%s http.status_code = %d, want 200", SpanFetch, v.AsInt64())
+	}
+	if v, _ := spanAttr(fetch, "bytes"); v.AsInt64() == 0 {
+		t.Errorf("%s bytes not recorded", SpanFetch)
+	}
+	if v, _ := spanAttr(spans[SpanParse], "links"); v.AsInt64() != 1 {
+		t.Errorf("%s links = %d, want 1", SpanParse, v.AsInt64())
+	}
+	for name, span := range spans {
+		if span.Status().Code == codes.Error {
+			t.Errorf("%s span has error status", name)
+		}
+	}
+}
+
+func TestTracingFailedFetch(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	location := srv.URL + "/"
+	srv.Close()
+
+	spans := traceOneItem(t, location)
+
+	assertChild(t, spans, SpanFetch, SpanCrawlItem)
+	for _, name := range []string{SpanCrawlItem, SpanFetch} {
+		span := spans[name]
+		if span.Status().Code != codes.Error {
+			t.Errorf("%s span status = %v, want error", name, span.Status().Code)
+		}
+		if len(span.Events()) == 0 || span.Events()[0].Name != "exception" {
+			t.Errorf("%s span has no recorded error", name)
+		}
+	}
+	if _, ok := spanAttr(spans[SpanFetch], "http.status_code"); ok {
+		t.Errorf("%s span has a status code without a response", SpanFetch)
+	}
+	for _, name := range []string{SpanParse, SpanStore, SpanFungicidePush} {
+		if _, ok := spans[name]; ok {
+			t.Errorf("unexpected %s span after a failed fetch", name)
+		}
+	}
+}
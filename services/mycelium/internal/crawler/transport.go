@@ -0,0 +1,82 @@
+package crawler
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+)
+
+// TransportTuning adjusts connection reuse on the crawler's transport. Zero
+// fields keep the transport's own setting.
+type TransportTuning struct {
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	// ForceAttemptHTTP2 negotiates HTTP/2 even when the transport has a
+	// custom dialer or TLS config, as it does once TLSSessionCacheSize is set.
+	ForceAttemptHTTP2   bool
+	TLSSessionCacheSize int
+}
+
+// WithTransportTuning applies tuning to whichever transport the crawler ends
+// up with: the default one, the one of the client passed to WithHttpClient,
+// or the one built for WithProxyChooser. Custom RoundTrippers that are not an
+// *http.Transport are left alone.
+func WithTransportTuning(tuning TransportTuning) CrawlerOption {
+	return func(c *Crawler) {
+		c.transportTuning = &tuning
+	}
+}
+
+func (t *TransportTuning) apply(transport *http.Transport) {
+	if t.MaxIdleConns > 0 {
+		transport.MaxIdleConns = t.MaxIdleConns
+	}
+	if t.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = t.MaxIdleConnsPerHost
+	}
+	if t.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = t.IdleConnTimeout
+	}
+	if t.ForceAttemptHTTP2 {
+		transport.ForceAttemptHTTP2 = true
+	}
+	if t.TLSSessionCacheSize > 0 {
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		} else {
+			transport.TLSClientConfig = transport.TLSClientConfig.Clone()
+		}
+		transport.TLSClientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(t.TLSSessionCacheSize)
+	}
+}
+
+// configureTransport sets the proxy and tuning on a copy of the client's
+// transport so a shared http.DefaultTransport is never modified.
+func (c *Crawler) configureTransport() {
+	if c.proxyChooser == nil && c.transportTuning == nil && !c.hasOverrideProxies() {
+		return
+	}
+
+	var transport *http.Transport
+	switch base := c.client.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = base.Clone()
+	default:
+		if c.proxyChooser == nil && !c.hasOverrideProxies() {
+			c.logger.Warn("client transport is not an *http.Transport, transport tuning disabled")
+			return
+		}
+		transport = &http.Transport{}
+	}
+
+	if c.proxyChooser != nil || c.hasOverrideProxies() {
+		transport.Proxy = c.proxyFunc(transport.Proxy)
+	}
+	if c.transportTuning != nil {
+		c.transportTuning.apply(transport)
+	}
+	c.client.Transport = transport
+}
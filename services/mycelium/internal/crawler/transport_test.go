@@ -0,0 +1,127 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// h2Server serves html over TLS with HTTP/2 enabled and records the protocol
+// of each request.
+func h2Server(t *testing.T) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var protos []string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		protos = append(protos, r.Proto)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><body>page</body></html>")
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), protos...)
+	}
+}
+
+// trustingClient trusts srv without opting into HTTP/2, like a transport
+// built with custom TLS settings.
+func trustingClient(srv *httptest.Server) *http.Client {
+	tls := srv.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+	tls.NextProtos = nil
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: tls}}
+}
+
+func TestTransportTuningReusesConnections(t *testing.T) {
+	tests := []struct {
+		name       string
+		tuning     *TransportTuning
+		wantProto  string
+		wantReused int
+	}{
+		{name: "untuned", wantProto: "HTTP/1.1", wantReused: 4},
+		{name: "http2", tuning: &TransportTuning{ForceAttemptHTTP2: true, MaxIdleConnsPerHost: 8, IdleConnTimeout: time.Minute, TLSSessionCacheSize: 16}, wantProto: "HTTP/2.0", wantReused: 4},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv, protos := h2Server(t)
+			opts := []CrawlerOption{quiet, WithHttpClient(trustingClient(srv))}
+			if test.tuning != nil {
+				opts = append(opts, WithTransportTuning(*test.tuning))
+			}
+			c := NewCrawler(nil, nil, opts...)
+
+			reused := 0
+			for i := range 5 {
+				page, err := getPage(t, c, fmt.Sprintf("%s/%d", srv.URL, i))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if page.Fetch.ConnReused {
+					reused++
+				}
+			}
+			if reused != test.wantReused {
+				t.Errorf("reused a connection for %d of 5 requests, want %d", reused, test.wantReused)
+			}
+			for _, proto := range protos() {
+				if proto != test.wantProto {
+					t.Fatalf("requests used %v, want %s", protos(), test.wantProto)
+				}
+			}
+		})
+	}
+}
+
+func TestTransportTuningLeavesSharedTransportAlone(t *testing.T) {
+	before := http.DefaultTransport.(*http.Transport).MaxIdleConnsPerHost
+	c := NewCrawler(nil, nil, quiet, WithTransportTuning(TransportTuning{MaxIdleConnsPerHost: 64}))
+
+	transport, ok := c.client.Transport.(*http.Transport)
+	if !ok || transport == http.DefaultTransport {
+		t.Fatalf("crawler transport %T, want a tuned copy", c.client.Transport)
+	}
+	if transport.MaxIdleConnsPerHost != 64 {
+		t.Errorf("MaxIdleConnsPerHost = %d, want 64", transport.MaxIdleConnsPerHost)
+	}
+	if http.DefaultTransport.(*http.Transport).MaxIdleConnsPerHost != before {
+		t.Error("tuning changed http.DefaultTransport")
+	}
+}
+
+func BenchmarkTransportTuning(b *testing.B) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><body>page</body></html>")
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	for _, forceHTTP2 := range []bool{false, true} {
+		b.Run(fmt.Sprintf("http2=%t", forceHTTP2), func(b *testing.B) {
+			c := NewCrawler(nil, nil, quiet, WithHttpClient(trustingClient(srv)),
+				WithTransportTuning(TransportTuning{ForceAttemptHTTP2: forceHTTP2}))
+			loc := srv.URL + "/"
+			reused := 0
+			for b.Loop() {
+				page, err := c.GetPage(b.Context(), mustParse(b, loc))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if page.Fetch.ConnReused {
+					reused++
+				}
+			}
+			b.ReportMetric(float64(reused)/float64(b.N), "reused/op")
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package crawler
+
+const (
+	trimmedContentBlocks   = 200
+	trimmedContentBlockLen = 2000
+)
+
+// trimStep cuts one kind of field from a copy of the page, returning the
+// name recorded in Page.Trimmed.
+type trimStep struct {
+	name  string
+	apply func(p *Page)
+}
+
+// trimSteps run in order until the payload fits. Script content is the
+// least useful to fungicide and usually the largest, so it goes first.
+var trimSteps = []trimStep{
+	{"script_content", func(p *Page) {
+		p.Scripts = nil
+		p.ScriptContent = nil
+	}},
+	{"content_blocks", func(p *Page) {
+		if len(p.Content) > trimmedContentBlocks {
+			p.Content = p.Content[:trimmedContentBlocks]
+		}
+		if len(p.ContentDirs) > trimmedContentBlocks {
+			p.ContentDirs = p.ContentDirs[:trimmedContentBlocks]
+		}
+	}},
+	{"content_text", func(p *Page) {
+		content := make([]string, len(p.Content))
+		for i, block := range p.Content {
+			content[i] = truncateUTF8(block, trimmedContentBlockLen)
+		}
+		p.Content = content
+	}},
+	{"content", func(p *Page) {
+		p.Content = nil
+		p.ContentDirs = nil
+	}},
+}
+
+// encodeForFungicide encodes page, trimming fields in the order of trimSteps
+// until it fits in the payload budget. The page itself is never modified;
+// trimmed reports whether the payload lost anything. A page that is still
+// too large after every step is sent anyway.
+func (c *Crawler) encodeForFungicide(page *Page) (data []byte, trimmed bool, err error) {
+	data, err = c.encodePage(page)
+	if err != nil || c.maxPayloadBytes <= 0 || len(data) <= c.maxPayloadBytes {
+		return data, false, err
+	}
+
+	cut := *page
+	cut.Trimmed = append([]string(nil), page.Trimmed...)
+	for _, step := range trimSteps {
+		step.apply(&cut)
+		cut.Trimmed = append(cut.Trimmed, step.name)
+
+		data, err = c.encodePage(&cut)
+		if err != nil || len(data) <= c.maxPayloadBytes {
+			return data, true, err
+		}
+	}
+	return data, true, nil
+}
+
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	// back up to the start of a rune so the result stays valid UTF-8
+	for n > 0 && s[n]&0xC0 == 0x80 {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,165 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// bigPage builds a page whose scripts and content are both well over a
+// few kilobytes.
+func bigPage(t *testing.T) *Page {
+	t.Helper()
+	loc, err := url.Parse("https://example.com/big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := NewPage(loc)
+	page.Title = "big"
+	for i := 0; i < 20; i++ {
+		page.ScriptContent = append(page.ScriptContent, strings.Repeat("var x = 1;", 500))
+	}
+	for i := 0; i < 400; i++ {
+		page.Content = append(page.Content, strings.Repeat("é", 1500))
+	}
+	return page
+}
+
+func encodeTrimmed(t *testing.T, budget int, page *Page) ([]byte, *Page) {
+	t.Helper()
+	c := NewCrawler(nil, nil, quiet, WithFungicidePayloadBudget(budget))
+	data, trimmed, err := c.encodeForFungicide(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := UnmarshalPage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trimmed != (len(decoded.Trimmed) > 0) {
+		t.Errorf("trimmed = %t but payload records %v", trimmed, decoded.Trimmed)
+	}
+	return data, decoded
+}
+
+func TestTrimRespectsBudget(t *testing.T) {
+	full, err := NewCrawler(nil, nil, quiet).encodePage(bigPage(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, budget := range []int{len(full) - 1, len(full) / 2, 600 * 1024, 100 * 1024, 4096} {
+		data, decoded := encodeTrimmed(t, budget, bigPage(t))
+		if len(data) > budget {
+			t.Errorf("budget %d: payload is %d bytes after trimming %v", budget, len(data), decoded.Trimmed)
+		}
+		if decoded.Title != "big" || decoded.Location.String() != "https://example.com/big" {
+			t.Errorf("budget %d: trimming lost the title or location", budget)
+		}
+	}
+}
+
+func TestTrimOrder(t *testing.T) {
+	// payload size after each step, measured by applying them by hand
+	c := NewCrawler(nil, nil, quiet)
+	cut := *bigPage(t)
+	full, err := c.encodePage(&cut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizes := []int{len(full)}
+	for _, step := range trimSteps {
+		step.apply(&cut)
+		data, err := c.encodePage(&cut)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, len(data))
+	}
+
+	want := []string{"script_content", "content_blocks", "content_text", "content"}
+	for i := range want {
+		// a budget just under the size before step i stops after it
+		budget := sizes[i] - 1
+		if budget < sizes[i+1] {
+			t.Fatalf("step %s does not shrink the payload", want[i])
+		}
+		_, decoded := encodeTrimmed(t, budget, bigPage(t))
+		if !reflect.DeepEqual(decoded.Trimmed, want[:i+1]) {
+			t.Errorf("budget %d: trimmed %v, want %v", budget, decoded.Trimmed, want[:i+1])
+		}
+		// the same page always trims the same way
+		_, again := encodeTrimmed(t, budget, bigPage(t))
+		if !reflect.DeepEqual(again.Trimmed, decoded.Trimmed) {
+			t.Errorf("budget %d: trimmed %v then %v", budget, decoded.Trimmed, again.Trimmed)
+		}
+	}
+
+	if _, decoded := encodeTrimmed(t, sizes[0], bigPage(t)); len(decoded.Trimmed) != 0 {
+		t.Errorf("page within budget trimmed %v", decoded.Trimmed)
+	}
+}
+
+func TestTrimKeepsTextValid(t *testing.T) {
+	// a budget the cut and truncated blocks fit in, but not the cut ones
+	_, decoded := encodeTrimmed(t, 550*1024, bigPage(t))
+	if !reflect.DeepEqual(decoded.Trimmed, []string{"script_content", "content_blocks", "content_text"}) {
+		t.Fatalf("trimmed %v, want content truncated", decoded.Trimmed)
+	}
+	if len(decoded.Content) != trimmedContentBlocks {
+		t.Fatalf("kept %d content blocks, want %d", len(decoded.Content), trimmedContentBlocks)
+	}
+	for _, block := range decoded.Content {
+		if len(block) > trimmedContentBlockLen || !utf8.ValidString(block) {
+			t.Fatalf("content block of %d bytes, valid utf-8 %t", len(block), utf8.ValidString(block))
+		}
+	}
+}
+
+func TestTrimLeavesPageWhole(t *testing.T) {
+	page := bigPage(t)
+	encodeTrimmed(t, 4096, page)
+	if len(page.ScriptContent) != 20 || len(page.Content) != 400 || len(page.Trimmed) != 0 {
+		t.Error("trimming modified the page kept for the store")
+	}
+}
+
+func TestTrimmedPagesStoredWhole(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><body>")
+		for i := 0; i < 50; i++ {
+			fmt.Fprintf(w, "<script>%s</script><p>%s</p>", strings.Repeat("var x = 1;", 200), strings.Repeat("text ", 200))
+		}
+		fmt.Fprint(w, "</body></html>")
+	}))
+	defer srv.Close()
+
+	cache := newMemCache()
+	store := newMemStore()
+	crawlOnePage(t, cache, store, srv.URL+"/",
+		WithFungicideQueueKey("fungicide"),
+		WithFungicidePayloadBudget(16*1024))
+
+	pushed := cache.fungicide["fungicide"]
+	if len(pushed) != 1 || len(pushed[0]) > 16*1024 {
+		t.Fatalf("pushed %d payloads, want 1 within the budget", len(pushed))
+	}
+	if store.len() != 1 {
+		t.Fatalf("stored %d pages, want the full page", store.len())
+	}
+	var stored *Page
+	for _, data := range store.items {
+		var err error
+		if stored, err = UnmarshalPage(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(stored.Trimmed) != 0 || len(stored.Content) != 50 {
+		t.Errorf("stored page was trimmed: %v, %d content blocks", stored.Trimmed, len(stored.Content))
+	}
+}
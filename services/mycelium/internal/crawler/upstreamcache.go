@@ -0,0 +1,51 @@
+package crawler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WithCacheBusting asks caching proxies between the crawler and origins to
+// revalidate every page instead of serving a stored copy, for runs that must
+// see fresh content such as recrawls.
+func WithCacheBusting(enabled bool) CrawlerOption {
+	return func(c *Crawler) {
+		c.cacheBusting = enabled
+	}
+}
+
+// setCacheDirectives sets the request's cache directives. Without cache
+// busting the request is left to the header chooser and overrides.
+func (c *Crawler) setCacheDirectives(req *http.Request) {
+	if !c.cacheBusting {
+		return
+	}
+	req.Header.Set("Cache-Control", "no-cache")
+	// for HTTP/1.0 caches
+	req.Header.Set("Pragma", "no-cache")
+}
+
+// recordCacheHeaders copies what an upstream cache said about the response
+// into f. Responses without cache headers leave f unchanged.
+func recordCacheHeaders(f *FetchInfo, header http.Header) {
+	f.CacheStatus = header.Get("X-Cache")
+	if f.CacheStatus == "" {
+		f.CacheStatus = header.Get("Cache-Status")
+	}
+	if age, err := strconv.ParseInt(strings.TrimSpace(header.Get("Age")), 10, 64); err == nil && age > 0 {
+		f.Age = time.Duration(age) * time.Second
+	}
+}
+
+// FromCache reports whether the response was served by a cache rather than
+// the origin, going by its X-Cache or Cache-Status and Age headers.
+func (f *FetchInfo) FromCache() bool {
+	if f.Age > 0 {
+		return true
+	}
+	status := strings.ToLower(f.CacheStatus)
+	// X-Cache: HIT from proxy; Cache-Status: proxy; hit
+	return strings.HasPrefix(status, "hit") || strings.Contains(status, "; hit")
+}
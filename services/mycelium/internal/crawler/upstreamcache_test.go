@@ -0,0 +1,86 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// cachingProxy answers like a shared cache would: with X-Cache, Cache-Status
+// and Age set from the query, and echoing the request's Cache-Control.
+func cachingProxy(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {
+		for _, name := range []string{"X-Cache", "Cache-Status", "Age"} {
+			if v := r.URL.Query().Get(name); v != "" {
+				w.Header().Set(name, v)
+			}
+		}
+		fmt.Fprintf(w, "<html><head><title>%s</title></head><body>page</body></html>", r.Header.Get("Cache-Control"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestUpstreamCacheHeaders(t *testing.T) {
+	srv := cachingProxy(t)
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus string
+		wantAge    time.Duration
+		wantHit    bool
+	}{
+		{name: "no cache headers"},
+		{name: "x-cache hit", query: "X-Cache=HIT+from+squid&Age=42", wantStatus: "HIT from squid", wantAge: 42 * time.Second, wantHit: true},
+		{name: "x-cache miss", query: "X-Cache=MISS+from+squid", wantStatus: "MISS from squid"},
+		{name: "cache-status hit", query: "Cache-Status=squid%3B+hit", wantStatus: "squid; hit", wantHit: true},
+		{name: "cache-status forward", query: "Cache-Status=squid%3B+fwd%3Dmiss", wantStatus: "squid; fwd=miss"},
+		{name: "age alone", query: "Age=5", wantAge: 5 * time.Second, wantHit: true},
+		{name: "malformed age", query: "Age=soon"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			metrics := NewCounterMetrics()
+			c := NewCrawler(newMemCache(), nil, quiet, WithMetrics(metrics))
+			page, err := getPage(t, c, srv.URL+"/?"+test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if page.Fetch.CacheStatus != test.wantStatus || page.Fetch.Age != test.wantAge {
+				t.Errorf("CacheStatus %q, Age %s, want %q, %s", page.Fetch.CacheStatus, page.Fetch.Age, test.wantStatus, test.wantAge)
+			}
+			if page.Fetch.FromCache() != test.wantHit {
+				t.Errorf("FromCache() = %t, want %t", page.Fetch.FromCache(), test.wantHit)
+			}
+			wantHits := int64(0)
+			if test.wantHit {
+				wantHits = 1
+			}
+			if n := metrics.Get(MetricUpstreamCacheHits); n != wantHits {
+				t.Errorf("counted %d cache hits, want %d", n, wantHits)
+			}
+		})
+	}
+}
+
+func TestCacheBusting(t *testing.T) {
+	srv := cachingProxy(t)
+	for _, busting := range []bool{false, true} {
+		c := NewCrawler(newMemCache(), nil, quiet, WithCacheBusting(busting))
+		page, err := getPage(t, c, srv.URL+"/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := ""
+		if busting {
+			want = "no-cache"
+		}
+		// the title echoes the Cache-Control the cache received
+		if page.Title != want {
+			t.Errorf("busting %t: sent Cache-Control %q, want %q", busting, page.Title, want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"mycelium/internal/filter"
+)
+
+const (
+	VerdictApproved = "approved"
+	VerdictRejected = "rejected"
+)
+
+// Verdict is the feedback fungicide pushes after classifying a page. Depth,
+// SeedOrigin, Priority, MaxDepth and Session echo the classified page;
+// approved links are queued one deeper with the page as their parent.
+type Verdict struct {
+	Location      string   `json:"location"`
+	Verdict       string   `json:"verdict"`
+	ApprovedLinks []string `json:"approved_links"`
+	Depth         int32    `json:"depth,omitempty"`
+	SeedOrigin    string   `json:"seed_origin,omitempty"`
+	Priority      int32    `json:"priority,omitempty"`
+	MaxDepth      int32    `json:"max_depth,omitempty"`
+	Session       string   `json:"session,omitempty"`
+}
+
+// ParseVerdict decodes and validates a verdict message.
+func ParseVerdict(data []byte) (*Verdict, error) {
+	var v Verdict
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal verdict: %w", err)
+	}
+	if v.Location == "" {
+		return nil, fmt.Errorf("verdict has no location")
+	}
+	switch v.Verdict {
+	case VerdictApproved, VerdictRejected:
+	default:
+		return nil, fmt.Errorf("unknown verdict %q for %s", v.Verdict, v.Location)
+	}
+	return &v, nil
+}
+
+// ApplyVerdict queues the approved links of v one level deeper than the
+// classified page and returns how many were queued. Links that fail to
+// parse or are blocked are skipped.
+func (c *Crawler) ApplyVerdict(ctx context.Context, v *Verdict) (int, error) {
+	if v.Verdict != VerdictApproved {
+		return 0, nil
+	}
+
+	parent := IngressItem{
+		Location:   v.Location,
+		Depth:      v.Depth,
+		SeedOrigin: v.SeedOrigin,
+		Priority:   v.Priority,
+		MaxDepth:   v.MaxDepth,
+		Session:    v.Session,
+	}
+	if parent.atMaxDepth() {
+		return 0, nil
+	}
+	queueKey := c.frontierKey(ctx)
+	queued := 0
+	for _, link := range capLinks(c, v.ApprovedLinks) {
+		pushed, err := c.enqueue(ctx, parent.child(link), queueKey)
+		if err != nil {
+			c.log(ctx).Debug("skipping approved link", "url", link, "error", err)
+			continue
+		}
+		if !pushed {
+			// dropped links still count when the frontier turned them away
+			if queueKey == "" {
+				c.countFrontier(queueKey)
+			}
+			continue
+		}
+		c.countFrontier(queueKey)
+		c.hooks.linkQueued(parent.Location, link)
+		if queueKey == c.myceliumIngressKey {
+			queued++
+		}
+	}
+	c.metrics.Incr(MetricLinksQueued, int64(queued))
+	c.stats.linksQueued.Add(int64(queued))
+	return queued, nil
+}
+
+// RejectDomain remembers the registrable domain of location as rejected, so
+// later urls on it are dropped without asking redis.
+func (c *Crawler) RejectDomain(location string) {
+	parsedUrl, err := url.Parse(location)
+	if err != nil || parsedUrl.Hostname() == "" {
+		return
+	}
+	c.rejected.add(filter.RegistrableDomain(parsedUrl.Hostname()))
+}
+
+// domainSet is a bounded set of registrable domains. Once full it is cleared
+// rather than evicting, which is fine for a cache that only saves lookups.
+type domainSet struct {
+	mu       sync.RWMutex
+	domains  map[string]struct{}
+	capacity int
+}
+
+func newDomainSet(capacity int) *domainSet {
+	return &domainSet{domains: map[string]struct{}{}, capacity: capacity}
+}
+
+func (s *domainSet) add(domain string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.domains) >= s.capacity {
+		clear(s.domains)
+	}
+	s.domains[domain] = struct{}{}
+}
+
+func (s *domainSet) contains(host string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.domains) == 0 {
+		return false
+	}
+	_, found := s.domains[filter.RegistrableDomain(strings.ToLower(host))]
+	return found
+}
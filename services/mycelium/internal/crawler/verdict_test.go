@@ -0,0 +1,136 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestParseVerdict(t *testing.T) {
+	v, err := ParseVerdict([]byte(`{"location": "https://example.com/", "verdict": "approved", "approved_links": ["https://example.com/a"], "depth": 2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Location != "https://example.com/" || v.Verdict != VerdictApproved || len(v.ApprovedLinks) != 1 || v.Depth != 2 {
+		t.Errorf("ParseVerdict = %+v", v)
+	}
+
+	for _, message := range []string{
+		`not json`,
+		`{"verdict": "approved"}`,
+		`{"location": "https://example.com/", "verdict": "maybe"}`,
+		`{"location": "https://example.com/"}`,
+	} {
+		if _, err := ParseVerdict([]byte(message)); err == nil {
+			t.Errorf("ParseVerdict(%s) succeeded, want an error", message)
+		}
+	}
+}
+
+func TestApplyVerdictQueuesApprovedLinksOneDeeper(t *testing.T) {
+	cache := newMemCache()
+	c := NewCrawler(cache, nil, WithMyceliumIngressKey("ingress"))
+
+	queued, err := c.ApplyVerdict(context.Background(), &Verdict{
+		Location:      "https://example.com/",
+		Verdict:       VerdictApproved,
+		ApprovedLinks: []string{"https://example.com/a", "not a url", "https://example.org/b"},
+		Depth:         1,
+		SeedOrigin:    "https://seed.example/",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queued != 2 {
+		t.Errorf("queued = %d, want 2", queued)
+	}
+
+	var items []IngressItem
+	for _, itemJSON := range cache.queue("ingress") {
+		var item IngressItem
+		if err := json.Unmarshal([]byte(itemJSON), &item); err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, item)
+	}
+	if len(items) != 2 || items[0].Location != "https://example.com/a" || items[1].Location != "https://example.org/b" {
+		t.Fatalf("queued %+v, want the two valid links", items)
+	}
+	for _, item := range items {
+		if item.Depth != 2 || item.Parent != "https://example.com/" || item.SeedOrigin != "https://seed.example/" {
+			t.Errorf("queued %+v, want depth 2 under the classified page", item)
+		}
+	}
+}
+
+func TestApplyVerdictStopsAtMaxDepth(t *testing.T) {
+	cache := newMemCache()
+	c := NewCrawler(cache, nil, WithMyceliumIngressKey("ingress"))
+
+	for _, depth := range []int32{1, 2} {
+		queued, err := c.ApplyVerdict(context.Background(), &Verdict{
+			Location:      "https://example.com/",
+			Verdict:       VerdictApproved,
+			ApprovedLinks: []string{fmt.Sprintf("https://example.com/%d", depth)},
+			Depth:         depth,
+			Priority:      5,
+			MaxDepth:      2,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := int(2 - depth); queued != want {
+			t.Errorf("depth %d: queued %d, want %d", depth, queued, want)
+		}
+	}
+
+	var item IngressItem
+	if err := json.Unmarshal([]byte(cache.queue("ingress")[0]), &item); err != nil {
+		t.Fatal(err)
+	}
+	if item.Priority != 5 || item.MaxDepth != 2 {
+		t.Errorf("queued %+v, want the seed's priority and max depth", item)
+	}
+}
+
+func TestApplyVerdictIgnoresRejected(t *testing.T) {
+	cache := newMemCache()
+	c := NewCrawler(cache, nil, WithMyceliumIngressKey("ingress"))
+
+	queued, err := c.ApplyVerdict(context.Background(), &Verdict{
+		Location:      "https://example.com/",
+		Verdict:       VerdictRejected,
+		ApprovedLinks: []string{"https://example.com/a"},
+	})
+	if err != nil || queued != 0 {
+		t.Errorf("ApplyVerdict = %d, %v; want 0, nil", queued, err)
+	}
+	if got := cache.queue("ingress"); len(got) != 0 {
+		t.Errorf("queued %v for a rejected verdict", got)
+	}
+}
+
+func TestRejectDomainDropsLinks(t *testing.T) {
+	cache := newMemCache()
+	c := NewCrawler(cache, nil, WithMyceliumIngressKey("ingress"))
+	c.RejectDomain("https://www.spam.test/page")
+
+	ctx := context.Background()
+	for _, location := range []string{"https://spam.test/a", "https://cdn.spam.test/b", "https://example.org/c"} {
+		if err := c.Enqueue(ctx, IngressItem{Location: location}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertQueued(t, cache, "https://example.org/c")
+}
+
+func TestDomainSetClearsWhenFull(t *testing.T) {
+	s := newDomainSet(2)
+	s.add("a.com")
+	s.add("b.com")
+	s.add("c.com")
+	if s.contains("a.com") || !s.contains("www.c.com") {
+		t.Errorf("domains = %v, want only c.com after overflowing", s.domains)
+	}
+}
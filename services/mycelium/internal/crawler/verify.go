@@ -0,0 +1,200 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"mycelium/internal/filter"
+)
+
+// LinkVerification is the result of checking a link that leaves the crawl
+// scope. It is passed to the Store and to Hooks.OnLinkVerified.
+type LinkVerification struct {
+	URL    string `json:"url"`
+	Parent string `json:"parent"`
+	// Method is HEAD, or GET when the server rejected HEAD and a ranged GET
+	// was sent instead.
+	Method     string    `json:"method"`
+	StatusCode int       `json:"status_code,omitempty"`
+	FinalURL   string    `json:"final_url,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	CheckedAt  time.Time `json:"checked_at"`
+	Session    string    `json:"session,omitempty"`
+}
+
+func (v *LinkVerification) Prefix() string {
+	return hostOf(v.URL)
+}
+
+func (v *LinkVerification) Marshal() ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Broken reports whether the link failed or answered with a 4xx or 5xx
+// status.
+func (v *LinkVerification) Broken() bool {
+	return v.Error != "" || v.StatusCode >= 400
+}
+
+// WithExternalLinkVerification turns the crawler into a link checker for
+// links that leave the registrable domain of their seed. Those links are not
+// queued; when Crawl would queue the links of a page, each external link is
+// checked once per verified set with a HEAD request instead, and the result
+// is stored as a LinkVerification. Url filters, blacklists, host slots and
+// the global and domain rate limits apply to these requests like to any
+// fetch. The cache must implement VerifiedCache; external links are dropped
+// unchecked otherwise.
+func WithExternalLinkVerification(enabled bool) CrawlerOption {
+	return func(c *Crawler) {
+		c.verifyExternal = enabled
+	}
+}
+
+// VerifiedCache is implemented by caches that can claim a link for
+// verification in one step. Verified links are kept apart from the visited
+// set, so checking a link does not stop it being crawled for a seed it is in
+// scope for.
+type VerifiedCache interface {
+	TryVerify(ctx context.Context, location string) (bool, error)
+	Unverify(ctx context.Context, location string) error
+}
+
+// inScope reports whether link is on the registrable domain of the seed
+// item was found from.
+func inScope(item IngressItem, link *url.URL) bool {
+	origin := item.SeedOrigin
+	if origin == "" {
+		origin = item.Location
+	}
+	return filter.RegistrableDomain(hostOf(origin)) == filter.RegistrableDomain(link.Hostname())
+}
+
+// verifyExternalLinks checks the links of page that leave the crawl scope.
+// Requests use ctx; cache writes use cacheCtx.
+func (c *Crawler) verifyExternalLinks(ctx context.Context, cacheCtx context.Context, page *Page, parent IngressItem) {
+	for _, link := range capLinks(c, page.Links) {
+		if ctx.Err() != nil {
+			return
+		}
+		if inScope(parent, &link) {
+			continue
+		}
+		c.verifyLink(ctx, cacheCtx, &link, parent)
+	}
+}
+
+func (c *Crawler) verifyLink(ctx context.Context, cacheCtx context.Context, link *url.URL, parent IngressItem) {
+	verifier, ok := c.cache.(VerifiedCache)
+	if !ok {
+		return
+	}
+	log := c.log(ctx)
+	location := link.String()
+	if err := c.admit(cacheCtx, link); err != nil {
+		log.Debug("not verifying link", "url", location, "reason", err.Error())
+		return
+	}
+	// like crawlOnce, wait for the global limiter before taking a host slot
+	if err := c.waitGlobal(ctx); err != nil {
+		return
+	}
+
+	release, acquired := c.acquireHostSlot(cacheCtx, link.Hostname())
+	if !acquired {
+		// another worker is on the host; the link is checked if it turns
+		// up again
+		log.Debug("host busy, not verifying link", "url", location)
+		return
+	}
+	defer release()
+
+	claimed, err := verifier.TryVerify(cacheCtx, location)
+	if err != nil {
+		log.Error("failed to claim link verification", "url", location, "error", err)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	if c.domainLimiter != nil {
+		if err := c.domainLimiter.wait(ctx, link.Hostname()); err != nil {
+			verifier.Unverify(cacheCtx, location)
+			return
+		}
+	}
+
+	session := parent.Session
+	if session == "" {
+		session = c.sessionID
+	}
+	v := &LinkVerification{URL: location, Parent: parent.Location, CheckedAt: c.now(), Session: session}
+	res, method, err := c.checkLink(ctx, link)
+	v.Method = method
+	if err != nil {
+		if ctx.Err() != nil {
+			// shutting down, check it next run
+			verifier.Unverify(cacheCtx, location)
+			return
+		}
+		v.Error = err.Error()
+	} else {
+		v.StatusCode = res.StatusCode
+		v.FinalURL = res.Request.URL.String()
+	}
+
+	c.metrics.Incr(MetricLinksVerified, 1)
+	if v.Broken() {
+		c.metrics.Incr(MetricLinksBroken, 1)
+	}
+	log.Debug("verified link", "url", location, "status", v.StatusCode, "error", v.Error)
+	if c.store != nil {
+		if _, err := c.store.Store(v, ".json"); err != nil {
+			log.Error("failed to store link verification", "url", location, "error", err)
+		}
+	}
+	c.hooks.linkVerified(v)
+}
+
+// checkLink sends a HEAD request for link, retrying as a GET for the first
+// byte when the server does not support HEAD. The response body is closed.
+func (c *Crawler) checkLink(ctx context.Context, link *url.URL) (*http.Response, string, error) {
+	res, err := c.sendCheck(ctx, link, http.MethodHead)
+	if err != nil {
+		return nil, http.MethodHead, err
+	}
+	if res.StatusCode != http.StatusMethodNotAllowed && res.StatusCode != http.StatusNotImplemented {
+		return res, http.MethodHead, nil
+	}
+	res, err = c.sendCheck(ctx, link, http.MethodGet)
+	return res, http.MethodGet, err
+}
+
+func (c *Crawler) sendCheck(ctx context.Context, link *url.URL, method string) (*http.Response, error) {
+	override := c.overrideFor(link.Hostname())
+	if timeout := c.requestTimeoutFor(override); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, link.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	c.setBrowserHeaders(req)
+	if method == http.MethodGet {
+		req.Header.Set("Range", "bytes=0-0")
+	}
+	req = c.applyOverrideHeaders(req, override)
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+	return res, nil
+}
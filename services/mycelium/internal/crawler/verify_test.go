@@ -0,0 +1,134 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestExternalLinkVerification(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+r.Header.Get("Range"))
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/ok":
+		case "/nohead":
+			// a server that only knows GET
+			if r.Method != http.MethodGet {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.WriteHeader(http.StatusPartialContent)
+			fmt.Fprint(w, "x")
+		case "/moved":
+			http.Redirect(w, r, "/ok", http.StatusMovedPermanently)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer external.Close()
+	// the same server under a different registrable domain
+	other := strings.Replace(external.URL, "127.0.0.1", "localhost", 1)
+
+	site := httptest.NewServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><body>
+			<a href="http://%s/inside">inside</a>
+			<a href="%s/ok">ok</a>
+			<a href="%s/nohead">nohead</a>
+			<a href="%s/moved">moved</a>
+			<a href="%s/gone">gone</a>
+			<a href="%s/ok">again</a>
+		</body></html>`, r.Host, other, other, other, other, other)
+	}))
+	defer site.Close()
+
+	var verified []*LinkVerification
+	cache := newMemCache()
+	store := newMemStore()
+	metrics := NewCounterMetrics()
+	c := NewCrawler(cache, store, quiet, WithMyceliumIngressKey("ingress"), WithMetrics(metrics),
+		WithExternalLinkVerification(true), WithSessionID("run-1"),
+		WithHooks(Hooks{OnLinkVerified: func(v *LinkVerification) { verified = append(verified, v) }}))
+	if err := c.Enqueue(context.Background(), IngressItem{Location: site.URL + "/"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CrawlOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if queued := queuedLocations(t, cache); !slices.Equal(queued, []string{site.URL + "/inside"}) {
+		t.Errorf("queued %q, want only the in-scope link", queued)
+	}
+
+	type result struct {
+		url, method string
+		status      int
+		final       string
+	}
+	var got []result
+	for _, v := range verified {
+		if v.Parent != site.URL+"/" || v.Session != "run-1" || v.Error != "" || v.CheckedAt.IsZero() {
+			t.Errorf("verification %+v", v)
+		}
+		got = append(got, result{v.URL, v.Method, v.StatusCode, v.FinalURL})
+	}
+	want := []result{
+		{other + "/ok", http.MethodHead, http.StatusOK, other + "/ok"},
+		{other + "/nohead", http.MethodGet, http.StatusPartialContent, other + "/nohead"},
+		{other + "/moved", http.MethodHead, http.StatusOK, other + "/ok"},
+		{other + "/gone", http.MethodHead, http.StatusNotFound, other + "/gone"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("verified\n%+v\nwant\n%+v", got, want)
+	}
+	wantRequests := []string{"HEAD /ok ", "HEAD /nohead ", "GET /nohead bytes=0-0", "HEAD /moved ", "HEAD /ok ", "HEAD /gone "}
+	if !slices.Equal(requests, wantRequests) {
+		t.Errorf("external server saw %q, want %q", requests, wantRequests)
+	}
+
+	// verifications are claimed apart from the crawl
+	if visited, _ := cache.IsVisited(context.Background(), other+"/ok"); visited {
+		t.Error("verified link marked visited, want it left crawlable")
+	}
+
+	if n := metrics.Get(MetricLinksVerified); n != 4 {
+		t.Errorf("verified %d links, want 4", n)
+	}
+	if n := metrics.Get(MetricLinksBroken); n != 1 {
+		t.Errorf("%d broken links, want 1", n)
+	}
+	// the page and the four verifications
+	if n := store.len(); n != 5 {
+		t.Errorf("stored %d items, want 5", n)
+	}
+}
+
+func TestExternalLinkVerificationUnreachable(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	site := httptest.NewServer(htmlServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><body><a href="%s/">down</a></body></html>`, strings.Replace(down.URL, "127.0.0.1", "localhost", 1))
+	}))
+	defer site.Close()
+
+	var verified []*LinkVerification
+	c := NewCrawler(newMemCache(), nil, quiet, WithMyceliumIngressKey("ingress"), WithExternalLinkVerification(true),
+		WithHooks(Hooks{OnLinkVerified: func(v *LinkVerification) { verified = append(verified, v) }}))
+	if err := c.Enqueue(context.Background(), IngressItem{Location: site.URL + "/"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CrawlOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(verified) != 1 || verified[0].Error == "" || !verified[0].Broken() {
+		t.Errorf("verified %+v, want one broken link with an error", verified)
+	}
+}
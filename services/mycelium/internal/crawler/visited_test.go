@@ -0,0 +1,178 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"mycelium/internal/cache"
+)
+
+// shardedCache connects a cache splitting the visited set into shards keys
+// to mr.
+func shardedCache(t *testing.T, mr *miniredis.Miniredis, shards int) *cache.CrawlerCache {
+	t.Helper()
+	rc, err := cache.NewRedisCache(context.Background(), &cache.CrawlerCacheOptions{Addr: mr.Addr(), VisitedShards: shards})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rc.Close() })
+	return rc
+}
+
+// visitedShardOf returns the key of mr holding location.
+func visitedShardOf(t *testing.T, mr *miniredis.Miniredis, location string) string {
+	t.Helper()
+	for _, key := range mr.Keys() {
+		if key != "visited" && !strings.HasPrefix(key, "visited:") {
+			continue
+		}
+		if found, _ := mr.SIsMember(key, location); found {
+			return key
+		}
+	}
+	return ""
+}
+
+var shardedLocations = []string{
+	"https://example.com/",
+	"https://www.example.com/a",
+	"http://blog.example.com/b",
+	"https://example.org/",
+	"https://news.example.co.uk/today",
+	"https://other.test/x",
+	"https://another.test/y",
+	"https://127.0.0.1:8080/",
+	"not a url",
+}
+
+func TestVisitedShardsByRegistrableDomain(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rc := shardedCache(t, mr, 4)
+	for _, location := range shardedLocations {
+		if first, err := rc.TryVisit(ctx, location); err != nil || !first {
+			t.Fatalf("TryVisit(%s) = %t, %v on the first visit", location, first, err)
+		}
+	}
+
+	if mr.Exists("visited") {
+		t.Error("sharded cache wrote the monolithic key")
+	}
+	// the hosts of one site share a shard
+	shard := visitedShardOf(t, mr, "https://example.com/")
+	for _, location := range []string{"https://www.example.com/a", "http://blog.example.com/b"} {
+		if got := visitedShardOf(t, mr, location); got != shard {
+			t.Errorf("%s is in %s, want %s with its registrable domain", location, got, shard)
+		}
+	}
+
+	// another process with the same shard count agrees on every url
+	other := shardedCache(t, mr, 4)
+	for _, location := range shardedLocations {
+		if visited, err := other.IsVisited(ctx, location); err != nil || !visited {
+			t.Errorf("IsVisited(%s) = %t, %v from a second cache", location, visited, err)
+		}
+		if first, _ := other.TryVisit(ctx, location); first {
+			t.Errorf("TryVisit(%s) claimed a visited url", location)
+		}
+	}
+	if n, err := other.VisitedCount(ctx); err != nil || n != int64(len(shardedLocations)) {
+		t.Errorf("VisitedCount = %d, %v, want %d across shards", n, err, len(shardedLocations))
+	}
+
+	if err := other.Unvisit(ctx, "https://example.org/"); err != nil {
+		t.Fatal(err)
+	}
+	if visited, _ := rc.IsVisited(ctx, "https://example.org/"); visited {
+		t.Error("unvisited url still visited")
+	}
+}
+
+func TestScanVisitedAcrossShards(t *testing.T) {
+	for _, shards := range []int{0, 1, 3, 7} {
+		t.Run(fmt.Sprint(shards), func(t *testing.T) {
+			ctx := context.Background()
+			rc := shardedCache(t, miniredis.RunT(t), shards)
+			var want []string
+			for i := range 50 {
+				location := fmt.Sprintf("https://site%d.test/page", i)
+				rc.Visit(ctx, location)
+				want = append(want, location)
+			}
+
+			var got []string
+			var cursor uint64
+			for {
+				batch, next, err := rc.ScanVisited(ctx, cursor, 4)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, batch...)
+				if next == 0 {
+					break
+				}
+				cursor = next
+			}
+			slices.Sort(got)
+			got = slices.Compact(got)
+			slices.Sort(want)
+			if !slices.Equal(got, want) {
+				t.Errorf("scanned %d urls, want all %d", len(got), len(want))
+			}
+		})
+	}
+}
+
+func TestMigrateVisited(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	monolithic := shardedCache(t, mr, 0)
+	for _, location := range shardedLocations {
+		monolithic.Visit(ctx, location)
+	}
+
+	for _, step := range []struct{ from, to int }{{0, 4}, {4, 3}, {3, 0}} {
+		rc := shardedCache(t, mr, step.to)
+		moved, err := rc.MigrateVisited(ctx, step.from, 2)
+		if err != nil {
+			t.Fatalf("%d to %d shards: %v", step.from, step.to, err)
+		}
+		if moved == 0 {
+			t.Errorf("%d to %d shards moved nothing", step.from, step.to)
+		}
+		for _, location := range shardedLocations {
+			if visited, _ := rc.IsVisited(ctx, location); !visited {
+				t.Errorf("%s lost going from %d to %d shards", location, step.from, step.to)
+			}
+		}
+		if n, _ := rc.VisitedCount(ctx); n != int64(len(shardedLocations)) {
+			t.Errorf("%d visited after going from %d to %d shards, want %d", n, step.from, step.to, len(shardedLocations))
+		}
+		// running it again has nothing left to move
+		if moved, _ := rc.MigrateVisited(ctx, step.from, 2); moved != 0 {
+			t.Errorf("second migration from %d to %d shards moved %d", step.from, step.to, moved)
+		}
+	}
+	for _, key := range mr.Keys() {
+		if strings.HasPrefix(key, "visited:") {
+			t.Errorf("%s left after migrating back to the single key", key)
+		}
+	}
+}
+
+func TestCrawlVisitsOnceAcrossShardedCaches(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	a := NewCrawler(shardedCache(t, mr, 4), nil, quiet)
+	b := NewCrawler(shardedCache(t, mr, 4), nil, quiet)
+	if first, err := a.tryVisit(ctx, "https://example.com/"); err != nil || !first {
+		t.Fatalf("first crawler tryVisit = %t, %v", first, err)
+	}
+	if first, err := b.tryVisit(ctx, "https://example.com/"); err != nil || first {
+		t.Errorf("second crawler tryVisit = %t, %v, want it already claimed", first, err)
+	}
+}
@@ -0,0 +1,155 @@
+package crawler
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+type WorkerState struct {
+	ID       int
+	Idle     bool
+	Location string
+	Since    time.Time
+}
+
+type workerIDKey struct{}
+
+// WithWorkerID tags ctx so a Crawl call running under it reports its state
+// under id.
+func WithWorkerID(ctx context.Context, id int) context.Context {
+	return context.WithValue(ctx, workerIDKey{}, id)
+}
+
+type workerStopKey struct{}
+
+// WithWorkerStop tags ctx with a channel that, once closed, asks a Crawl call
+// running under it to return after finishing its current item. Unlike
+// cancelling ctx, in-flight work is not interrupted.
+func WithWorkerStop(ctx context.Context, stop <-chan struct{}) context.Context {
+	return context.WithValue(ctx, workerStopKey{}, stop)
+}
+
+func stopRequested(ctx context.Context) bool {
+	stop, ok := ctx.Value(workerStopKey{}).(<-chan struct{})
+	if !ok {
+		return false
+	}
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// crawlWorker is the state a Crawl or CrawlOnce call keeps between items.
+// Each call has its own, so concurrent calls on one Crawler share nothing
+// but the Crawler's concurrency safe components.
+type crawlWorker struct {
+	c       *Crawler
+	id      int
+	tracked bool
+	buf     *lookahead
+	// current is the item being crawled, "" while waiting for one
+	current string
+	// idleSince is when the worker last had something to do
+	idleSince     time.Time
+	pausedBackoff time.Duration
+	// hostsBusy counts the items in a row requeued because their host had
+	// no free slot
+	hostsBusy int
+}
+
+func (c *Crawler) newCrawlWorker(ctx context.Context, lookaheadSize int) *crawlWorker {
+	id, tracked := ctx.Value(workerIDKey{}).(int)
+	return &crawlWorker{
+		c:         c,
+		id:        id,
+		tracked:   tracked,
+		buf:       &lookahead{size: lookaheadSize},
+		idleSince: time.Now(),
+	}
+}
+
+func (w *crawlWorker) setState(idle bool, location string) {
+	w.current = location
+	if w.tracked {
+		w.c.workers.set(w.id, idle, location)
+	}
+}
+
+// busy restarts the idle timer.
+func (w *crawlWorker) busy() {
+	w.idleSince = time.Now()
+}
+
+// hostBusy counts an item requeued for a busy host and returns how long to
+// wait before the next one. Other hosts' items go ahead at once; only a run
+// of busy hosts, a queue with little else in it, backs off instead of
+// spinning on the same items.
+func (w *crawlWorker) hostBusy() time.Duration {
+	w.hostsBusy++
+	if w.hostsBusy < hostBusyBackoffAfter {
+		return 0
+	}
+	return hostBusyDelay
+}
+
+// idleTooLong reports whether the worker has waited longer than maxIdle.
+// A non-positive maxIdle never expires.
+func (w *crawlWorker) idleTooLong(maxIdle time.Duration) bool {
+	return maxIdle > 0 && time.Since(w.idleSince) > maxIdle
+}
+
+// pauseBackoff returns how long to wait before checking the pause state
+// again, doubling the wait on every call while paused.
+func (w *crawlWorker) pauseBackoff() time.Duration {
+	w.pausedBackoff = w.c.control.backoff(w.pausedBackoff)
+	return w.pausedBackoff
+}
+
+// close returns buffered items to the queue and stops reporting state.
+func (w *crawlWorker) close(ctx context.Context) {
+	w.c.release(ctx, w.buf)
+	if w.tracked {
+		w.c.workers.remove(w.id)
+	}
+}
+
+type workerRegistry struct {
+	mu      sync.Mutex
+	workers map[int]*WorkerState
+}
+
+func (r *workerRegistry) set(id int, idle bool, location string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.workers == nil {
+		r.workers = map[int]*WorkerState{}
+	}
+	state, found := r.workers[id]
+	if !found || state.Idle != idle || state.Location != location {
+		r.workers[id] = &WorkerState{ID: id, Idle: idle, Location: location, Since: time.Now()}
+	}
+}
+
+func (r *workerRegistry) remove(id int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.workers, id)
+}
+
+func (r *workerRegistry) snapshot() []WorkerState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	states := make([]WorkerState, 0, len(r.workers))
+	for _, state := range r.workers {
+		states = append(states, *state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].ID < states[j].ID })
+	return states
+}
@@ -0,0 +1,115 @@
+package filter
+
+import (
+	"net/url"
+	"sync/atomic"
+)
+
+type UrlFilter interface {
+	Filter(u *url.URL) bool
+}
+
+type Rule struct {
+	Name   string
+	Filter UrlFilter
+}
+
+// Chain evaluates rules in order and reports the first one that matched,
+// counting hits per rule.
+type Chain struct {
+	rules []Rule
+	hits  []atomic.Int64
+}
+
+func NewChain(rules ...Rule) *Chain {
+	return &Chain{
+		rules: rules,
+		hits:  make([]atomic.Int64, len(rules)),
+	}
+}
+
+func (c *Chain) Match(u *url.URL) (bool, string) {
+	for i, rule := range c.rules {
+		if rule.Filter.Filter(u) {
+			c.hits[i].Add(1)
+			return true, rule.Name
+		}
+	}
+	return false, ""
+}
+
+func (c *Chain) Filter(u *url.URL) bool {
+	blocked, _ := c.Match(u)
+	return blocked
+}
+
+// Hits returns the number of urls each rule has blocked.
+func (c *Chain) Hits() map[string]int64 {
+	hits := make(map[string]int64, len(c.rules))
+	for i, rule := range c.rules {
+		hits[rule.Name] += c.hits[i].Load()
+	}
+	return hits
+}
+
+// ChainConfig selects the rules of a chain built by NewConfiguredChain.
+// Empty lists leave their rule out, except AllowedPorts: the port rule is
+// always applied and allows only default ports when it is empty.
+type ChainConfig struct {
+	// Domains blocks blacklisted domains; nil leaves the rule out.
+	Domains             *DomainFilter
+	BlockedExtensions   []string
+	BlockedPathPrefixes []string
+	AllowedSchemes      []string
+	AllowedPorts        []int
+	BlockIPLiterals     bool
+	TrapFilter          bool
+	MaxUrlLength        int
+	MaxSegmentRepeats   int
+	MaxQueryParams      int
+}
+
+// DefaultChainConfig returns the rules the crawler applies when run with its
+// default flags, minus the domain blacklist.
+func DefaultChainConfig() ChainConfig {
+	return ChainConfig{
+		BlockedExtensions: DefaultBlockedExtensions,
+		AllowedSchemes:    DefaultAllowedSchemes,
+		BlockIPLiterals:   true,
+		TrapFilter:        true,
+		MaxUrlLength:      DefaultMaxUrlLength,
+		MaxSegmentRepeats: DefaultMaxSegmentRepeats,
+		MaxQueryParams:    DefaultMaxQueryParams,
+	}
+}
+
+// NewConfiguredChain returns a chain of the rules conf selects, in the order
+// domain, extension, path, scheme, port, ip and trap.
+func NewConfiguredChain(conf ChainConfig) *Chain {
+	var rules []Rule
+	if conf.Domains != nil {
+		rules = append(rules, Rule{Name: "domain", Filter: conf.Domains})
+	}
+	if len(conf.BlockedExtensions) > 0 {
+		rules = append(rules, Rule{Name: "extension", Filter: NewExtensionFilter(conf.BlockedExtensions)})
+	}
+	if len(conf.BlockedPathPrefixes) > 0 {
+		rules = append(rules, Rule{Name: "path", Filter: NewPathPrefixFilter(conf.BlockedPathPrefixes)})
+	}
+	if len(conf.AllowedSchemes) > 0 {
+		rules = append(rules, Rule{Name: "scheme", Filter: NewSchemeFilter(conf.AllowedSchemes)})
+	}
+	rules = append(rules, Rule{Name: "port", Filter: NewPortFilter(conf.AllowedPorts, true)})
+	if conf.BlockIPLiterals {
+		rules = append(rules, Rule{Name: "ip", Filter: NewIPLiteralFilter(true, true)})
+	}
+	if conf.TrapFilter {
+		rules = append(rules, Rule{Name: "trap", Filter: NewTrapFilter(conf.MaxUrlLength, conf.MaxSegmentRepeats, conf.MaxQueryParams)})
+	}
+	return NewChain(rules...)
+}
+
+// NewDefaultChain returns the chain of DefaultChainConfig.
+func NewDefaultChain() *Chain {
+	return NewConfiguredChain(DefaultChainConfig())
+}
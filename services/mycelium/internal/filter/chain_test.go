@@ -0,0 +1,101 @@
+package filter
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type hostFilter string
+
+func (f hostFilter) Filter(u *url.URL) bool {
+	return strings.Contains(u.Hostname(), string(f))
+}
+
+func TestChainFirstMatchWins(t *testing.T) {
+	c := NewChain(
+		Rule{Name: "scheme", Filter: NewSchemeFilter(DefaultAllowedSchemes)},
+		Rule{Name: "ads", Filter: hostFilter("ads")},
+		Rule{Name: "tracker", Filter: hostFilter("tracker")},
+	)
+
+	tests := []struct {
+		rawUrl  string
+		blocked bool
+		rule    string
+	}{
+		{"https://example.com/", false, ""},
+		{"https://ads.example.com/", true, "ads"},
+		{"https://tracker.example.com/", true, "tracker"},
+		{"https://ads.tracker.example.com/", true, "ads"},
+		{"ftp://ads.example.com/", true, "scheme"},
+	}
+	for _, tt := range tests {
+		blocked, rule := c.Match(mustParse(t, tt.rawUrl))
+		if blocked != tt.blocked || rule != tt.rule {
+			t.Errorf("Match(%s) = (%t, %q), want (%t, %q)", tt.rawUrl, blocked, rule, tt.blocked, tt.rule)
+		}
+		if got := c.Filter(mustParse(t, tt.rawUrl)); got != tt.blocked {
+			t.Errorf("Filter(%s) = %t, want %t", tt.rawUrl, got, tt.blocked)
+		}
+	}
+}
+
+func TestChainHits(t *testing.T) {
+	c := NewChain(
+		Rule{Name: "ads", Filter: hostFilter("ads")},
+		Rule{Name: "tracker", Filter: hostFilter("tracker")},
+		Rule{Name: "unused", Filter: hostFilter("never")},
+	)
+	for _, rawUrl := range []string{
+		"https://ads.example.com/",
+		"https://ads.tracker.example.com/",
+		"https://tracker.example.com/",
+		"https://example.com/",
+	} {
+		c.Match(mustParse(t, rawUrl))
+	}
+
+	hits := c.Hits()
+	want := map[string]int64{"ads": 2, "tracker": 1, "unused": 0}
+	for name, n := range want {
+		if hits[name] != n {
+			t.Errorf("hits[%s] = %d, want %d", name, hits[name], n)
+		}
+	}
+}
+
+func TestConfiguredChainRules(t *testing.T) {
+	domains, err := NewDomainFilter([]string{"blocked.example"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := DefaultChainConfig()
+	conf.Domains = domains
+	conf.BlockedPathPrefixes = []string{"/admin"}
+	c := NewConfiguredChain(conf)
+
+	tests := []struct {
+		rawUrl string
+		rule   string
+	}{
+		{"https://example.com/", ""},
+		{"https://blocked.example/", "domain"},
+		{"https://example.com/file.zip", "extension"},
+		{"https://example.com/admin/users", "path"},
+		{"ftp://example.com/", "scheme"},
+		{"https://example.com:8080/", "port"},
+		{"https://10.0.0.1/", "ip"},
+		{"https://example.com/a/a/a/a/a", "trap"},
+	}
+	for _, tt := range tests {
+		if _, rule := c.Match(mustParse(t, tt.rawUrl)); rule != tt.rule {
+			t.Errorf("Match(%s) matched %q, want %q", tt.rawUrl, rule, tt.rule)
+		}
+	}
+
+	// the default chain leaves out the rules without defaults
+	if _, rule := NewDefaultChain().Match(mustParse(t, "https://example.com/admin/users")); rule != "" {
+		t.Errorf("default chain matched %q, want no path rule", rule)
+	}
+}
@@ -1,20 +1,111 @@
 package filter
 
 import (
+	"fmt"
+	"net"
 	"net/url"
+	"regexp"
 	"strings"
+	"sync/atomic"
+
+	"golang.org/x/net/publicsuffix"
 )
 
+var domainPatternRegex = regexp.MustCompile(`^[a-z0-9.*-]+$`)
+
 type DomainFilter struct {
-	domains map[string]bool
+	rules atomic.Pointer[domainRules]
+}
+
+type domainRules struct {
+	domains  map[string]bool
+	suffixes []string
+	patterns []*regexp.Regexp
+}
+
+// NewDomainFilter builds a filter from plain domains and glob entries. A
+// leading "*." matches any subdomain, and any other "*" matches within a
+// single label (e.g. "tracker-*.example.net").
+func NewDomainFilter(domains []string) (*DomainFilter, error) {
+	var f DomainFilter
+	if err := f.Reload(domains); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// Reload atomically replaces the filter's entries. On error the previous
+// entries are kept.
+func (f *DomainFilter) Reload(domains []string) error {
+	rules, err := compileDomainRules(domains)
+	if err != nil {
+		return err
+	}
+	f.rules.Store(rules)
+	return nil
 }
 
-func NewDomainFilter(domains []string) *DomainFilter {
-	domainsMap := map[string]bool{}
+func compileDomainRules(domains []string) (*domainRules, error) {
+	r := &domainRules{domains: map[string]bool{}}
 	for _, d := range domains {
-		domainsMap[strings.ToLower(d)] = true
+		d = strings.ToLower(strings.TrimSpace(d))
+		if err := ValidateDomainEntry(d); err != nil {
+			return nil, err
+		}
+
+		switch {
+		case !strings.Contains(d, "*"):
+			r.domains[d] = true
+		case strings.HasPrefix(d, "*.") && !strings.Contains(d[2:], "*"):
+			r.suffixes = append(r.suffixes, d[1:])
+		default:
+			r.patterns = append(r.patterns, compileDomainPattern(d))
+		}
 	}
-	return &DomainFilter{domains: domainsMap}
+	return r, nil
+}
+
+func ValidateDomainEntry(entry string) error {
+	entry = strings.ToLower(strings.TrimSpace(entry))
+	if !domainPatternRegex.MatchString(entry) {
+		return fmt.Errorf("invalid domain entry %q", entry)
+	}
+	if strings.Contains(entry, "**") || strings.Contains(entry, "..") {
+		return fmt.Errorf("invalid domain entry %q: empty label or repeated wildcard", entry)
+	}
+	if strings.Contains(entry, "*") {
+		// the labels after the last wildcard must reach a registrable
+		// domain, or "*.co.uk" would block a whole public suffix
+		labels := strings.Split(entry, ".")
+		last := 0
+		for i, label := range labels {
+			if strings.Contains(label, "*") {
+				last = i
+			}
+		}
+		base := strings.Join(labels[last+1:], ".")
+		if _, err := publicsuffix.EffectiveTLDPlusOne(base); err != nil {
+			return fmt.Errorf("invalid domain entry %q: wildcard must be below a registrable domain", entry)
+		}
+	}
+	return nil
+}
+
+func compileDomainPattern(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	if strings.HasPrefix(pattern, "*.") {
+		b.WriteString(`(?:[a-z0-9-]{1,63}\.)+`)
+		pattern = pattern[2:]
+	}
+	for i, part := range strings.Split(pattern, "*") {
+		if i > 0 {
+			b.WriteString(`[a-z0-9-]{0,63}`)
+		}
+		b.WriteString(regexp.QuoteMeta(part))
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
 }
 
 func (f *DomainFilter) Filter(u *url.URL) bool {
@@ -25,20 +116,55 @@ func (f *DomainFilter) Filter(u *url.URL) bool {
 	if host == "" {
 		return false
 	}
+	rules := f.rules.Load()
 
 	// direct match
-	if _, found := f.domains[host]; found {
+	if _, found := rules.domains[host]; found {
 		return true
 	}
 
-	// check parent domains (e.g., sub.example.com -> example.com)
-	parts := strings.Split(host, ".")
-	for i := 1; i < len(parts)-1; i++ {
-		parent := strings.Join(parts[i:], ".")
-		if _, found := f.domains[parent]; found {
+	// check parent domains (e.g., sub.example.com -> example.com), stopping at
+	// the registrable domain so public suffixes like co.uk never match
+	registrable := RegistrableDomain(host)
+	if registrable != host {
+		parts := strings.Split(host, ".")
+		for i := 1; i < len(parts)-1; i++ {
+			parent := strings.Join(parts[i:], ".")
+			if _, found := rules.domains[parent]; found {
+				return true
+			}
+			if parent == registrable {
+				break
+			}
+		}
+	}
+
+	// wildcard entries are only consulted after the map lookups
+	for _, suffix := range rules.suffixes {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	for _, pattern := range rules.patterns {
+		if pattern.MatchString(host) {
 			return true
 		}
 	}
 
 	return false
 }
+
+// RegistrableDomain returns the eTLD+1 for host (e.g. "a.b.example.co.uk" ->
+// "example.co.uk"). IP literals and hosts that are themselves public suffixes
+// are returned unchanged.
+func RegistrableDomain(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if net.ParseIP(strings.Trim(host, "[]")) != nil {
+		return host
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
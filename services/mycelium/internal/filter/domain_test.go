@@ -0,0 +1,204 @@
+package filter
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+)
+
+func TestValidateDomainEntry(t *testing.T) {
+	tests := []struct {
+		entry string
+		valid bool
+	}{
+		{"example.com", true},
+		{"*.ads.example.com", true},
+		{"*.example.com", true},
+		{"*.example.co.uk", true},
+		{"tracker-*.example.net", true},
+		{"cdn*.img.example.com.au", true},
+		{"*.com", false},
+		{"*.co.uk", false},
+		{"*.com.au", false},
+		{"*.github.io", false},
+		{"tracker-*.co.uk", false},
+		{"*.example.*", false},
+		{"**.example.com", false},
+		{"a..example.com", false},
+		{"exa mple.com", false},
+	}
+	for _, tt := range tests {
+		err := ValidateDomainEntry(tt.entry)
+		if tt.valid && err != nil {
+			t.Errorf("ValidateDomainEntry(%q) = %v, want ok", tt.entry, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("ValidateDomainEntry(%q) accepted, want an error", tt.entry)
+		}
+	}
+}
+
+func TestDomainFilterMatching(t *testing.T) {
+	f, err := NewDomainFilter([]string{"example.com", "*.ads.example.org", "tracker-*.example.net", "blocked.co.uk"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"example.com", true},
+		{"www.example.com", true},
+		{"notexample.com", false},
+		{"x.ads.example.org", true},
+		{"a.b.ads.example.org", true},
+		{"ads.example.org", false},
+		{"tracker-1.example.net", true},
+		{"tracker-.example.net", true},
+		{"a.tracker-1.example.net", false},
+		{"www.blocked.co.uk", true},
+		{"other.co.uk", false},
+	}
+	for _, tt := range tests {
+		if got := f.Filter(&url.URL{Scheme: "https", Host: tt.host}); got != tt.want {
+			t.Errorf("Filter(%s) = %t, want %t", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestDomainFilterReload(t *testing.T) {
+	f, err := NewDomainFilter([]string{"old.example"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	added := &url.URL{Host: "www.new.example"}
+	removed := &url.URL{Host: "old.example"}
+	if f.Filter(added) {
+		t.Fatal("url blocked before the reload that adds it")
+	}
+
+	if err := f.Reload([]string{"new.example"}); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Filter(added) {
+		t.Error("url not blocked after the reload that adds it")
+	}
+	if f.Filter(removed) {
+		t.Error("removed entry still blocks after reload")
+	}
+}
+
+func TestDomainFilterConcurrentReload(t *testing.T) {
+	f, err := NewDomainFilter([]string{"a.example"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			entries := []string{"a.example"}
+			if i%2 == 0 {
+				entries = append(entries, "*.b.example", "c-*.b.example")
+			}
+			if err := f.Reload(entries); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+			if !f.Filter(&url.URL{Host: "www.a.example"}) {
+				t.Fatal("entry present in every reload was not matched")
+			}
+			f.Filter(&url.URL{Host: "x.b.example"})
+			f.Filter(&url.URL{Host: "c-1.b.example"})
+		}
+	}
+}
+
+func TestDomainFilterReloadKeepsRulesOnError(t *testing.T) {
+	f, err := NewDomainFilter([]string{"example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Reload([]string{"other.com", "*.co.uk"}); err == nil {
+		t.Fatal("reload with a public suffix wildcard succeeded")
+	}
+	if !f.Filter(&url.URL{Host: "example.com"}) {
+		t.Error("previous entries lost after a failed reload")
+	}
+}
+
+func benchmarkDomainFilter(b *testing.B, entries []string, host string) {
+	f, err := NewDomainFilter(entries)
+	if err != nil {
+		b.Fatal(err)
+	}
+	u := &url.URL{Scheme: "https", Host: host}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.Filter(u)
+	}
+}
+
+// benchmarkEntries is a blacklist of n plain domains plus the given extras.
+func benchmarkEntries(n int, extra ...string) []string {
+	entries := make([]string, 0, n+len(extra))
+	for i := 0; i < n; i++ {
+		entries = append(entries, fmt.Sprintf("blocked%d.com", i))
+	}
+	return append(entries, extra...)
+}
+
+func BenchmarkDomainFilterExact(b *testing.B) {
+	benchmarkDomainFilter(b, benchmarkEntries(10000), "blocked5000.com")
+}
+
+func BenchmarkDomainFilterParent(b *testing.B) {
+	benchmarkDomainFilter(b, benchmarkEntries(10000), "a.b.blocked5000.com")
+}
+
+func BenchmarkDomainFilterMiss(b *testing.B) {
+	benchmarkDomainFilter(b, benchmarkEntries(10000), "www.allowed.com")
+}
+
+func BenchmarkDomainFilterMissWithWildcards(b *testing.B) {
+	benchmarkDomainFilter(b, benchmarkEntries(10000, "*.ads.example.com", "tracker-*.example.net"), "www.allowed.com")
+}
+
+func BenchmarkDomainFilterSuffix(b *testing.B) {
+	benchmarkDomainFilter(b, benchmarkEntries(10000, "*.ads.example.com"), "x.ads.example.com")
+}
+
+func BenchmarkDomainFilterPattern(b *testing.B) {
+	benchmarkDomainFilter(b, benchmarkEntries(10000, "tracker-*.example.net"), "tracker-42.example.net")
+}
+
+func TestRegistrableDomain(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"www.example.com", "example.com"},
+		{"a.b.example.co.uk", "example.co.uk"},
+		{"WWW.Example.COM.", "example.com"},
+		{"co.uk", "co.uk"},
+		{"com", "com"},
+		{"192.168.0.1", "192.168.0.1"},
+		{"::1", "::1"},
+		{"[2001:db8::1]", "[2001:db8::1]"},
+	}
+	for _, tt := range tests {
+		if got := RegistrableDomain(tt.host); got != tt.want {
+			t.Errorf("RegistrableDomain(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package filter
+
+import (
+	"encoding/binary"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type IPLiteralFilter struct {
+	blockPrivate bool
+	blockPublic  bool
+}
+
+func NewIPLiteralFilter(blockPrivate, blockPublic bool) *IPLiteralFilter {
+	return &IPLiteralFilter{blockPrivate: blockPrivate, blockPublic: blockPublic}
+}
+
+func (f *IPLiteralFilter) Filter(u *url.URL) bool {
+	if u == nil {
+		return false
+	}
+	ip, ok := ParseIPLiteral(u.Hostname())
+	if !ok {
+		return false
+	}
+	if isPrivateIP(ip) {
+		return f.blockPrivate
+	}
+	return f.blockPublic
+}
+
+// ParseIPLiteral reports whether host is an IP address, including the
+// integer, hex, octal and shortened IPv4 forms browsers accept
+// (e.g. "2130706433", "0x7f.1", "0177.0.0.1").
+func ParseIPLiteral(host string) (net.IP, bool) {
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+	if host == "" {
+		return nil, false
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip, true
+	}
+
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return nil, false
+	}
+
+	values := make([]uint64, len(parts))
+	for i, part := range parts {
+		// base 0 understands the 0x and leading zero octal prefixes
+		v, err := strconv.ParseUint(part, 0, 32)
+		if err != nil {
+			return nil, false
+		}
+		values[i] = v
+	}
+
+	// every part but the last is a single byte, the last fills the rest
+	var addr uint64
+	for i, v := range values[:len(values)-1] {
+		if v > 0xff {
+			return nil, false
+		}
+		addr |= v << (8 * (3 - i))
+	}
+	last := values[len(values)-1]
+	if last >= 1<<(8*(5-len(values))) {
+		return nil, false
+	}
+	addr |= last
+
+	ip := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(ip, uint32(addr))
+	return ip, true
+}
+
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast()
+}
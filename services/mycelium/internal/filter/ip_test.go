@@ -0,0 +1,77 @@
+package filter
+
+import "testing"
+
+func TestParseIPLiteral(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"93.184.216.34", "93.184.216.34"},
+		{"127.0.0.1", "127.0.0.1"},
+		{"2130706433", "127.0.0.1"},
+		{"0x7f000001", "127.0.0.1"},
+		{"0x7f.1", "127.0.0.1"},
+		{"0177.0.0.1", "127.0.0.1"},
+		{"0x7f.0.0.0x1", "127.0.0.1"},
+		{"127.1", "127.0.0.1"},
+		{"10.0.258", "10.0.1.2"},
+		{"1572395042", "93.184.216.34"},
+		{"[::1]", "::1"},
+		{"[2001:db8::1]", "2001:db8::1"},
+		{"::ffff:127.0.0.1", "127.0.0.1"},
+		{"127.0.0.1.", "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		ip, ok := ParseIPLiteral(tt.host)
+		if !ok {
+			t.Errorf("ParseIPLiteral(%s) not recognised as an ip", tt.host)
+			continue
+		}
+		if ip.String() != tt.want {
+			t.Errorf("ParseIPLiteral(%s) = %s, want %s", tt.host, ip, tt.want)
+		}
+	}
+
+	for _, host := range []string{
+		"", "example.com", "1.2.3.4.5", "256.1.1.1", "1.2.3.256", "4294967296", "0x100000000", "1.2.65536", "a.b.c.d", "123.example",
+	} {
+		if ip, ok := ParseIPLiteral(host); ok {
+			t.Errorf("ParseIPLiteral(%s) = %s, want not an ip", host, ip)
+		}
+	}
+}
+
+func TestIPLiteralFilter(t *testing.T) {
+	urls := map[string]bool{ // url -> private
+		"http://93.184.216.34/path":      false,
+		"http://1572395042/":             false,
+		"http://[2001:4860::8888]:8080/": false,
+		"http://2130706433/":             true,
+		"http://0x7f.1/admin":            true,
+		"http://192.168.1.1/":            true,
+		"http://[::1]/":                  true,
+		"http://169.254.169.254/":        true,
+		"http://0.0.0.0/":                true,
+	}
+
+	for _, tt := range []struct {
+		blockPrivate, blockPublic bool
+	}{
+		{true, true}, {true, false}, {false, true}, {false, false},
+	} {
+		f := NewIPLiteralFilter(tt.blockPrivate, tt.blockPublic)
+		for rawUrl, private := range urls {
+			want := tt.blockPublic
+			if private {
+				want = tt.blockPrivate
+			}
+			if got := f.Filter(mustParse(t, rawUrl)); got != want {
+				t.Errorf("NewIPLiteralFilter(%t, %t).Filter(%s) = %t, want %t", tt.blockPrivate, tt.blockPublic, rawUrl, got, want)
+			}
+		}
+		if f.Filter(mustParse(t, "https://example.com/")) {
+			t.Errorf("NewIPLiteralFilter(%t, %t) blocks a named host", tt.blockPrivate, tt.blockPublic)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package filter
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+var DefaultBlockedExtensions = []string{
+	".7z", ".apk", ".avi", ".bin", ".bmp", ".bz2", ".dmg", ".doc", ".docx",
+	".eot", ".exe", ".flac", ".flv", ".gif", ".gz", ".ico", ".iso", ".jar",
+	".jpeg", ".jpg", ".m4a", ".m4v", ".mkv", ".mov", ".mp3", ".mp4", ".mpeg",
+	".msi", ".ogg", ".otf", ".pdf", ".png", ".ppt", ".pptx", ".rar", ".svg",
+	".tar", ".tgz", ".tif", ".tiff", ".ttf", ".wav", ".webm", ".webp", ".wmv",
+	".woff", ".woff2", ".xls", ".xlsx", ".xz", ".zip",
+}
+
+type ExtensionFilter struct {
+	extensions map[string]bool
+}
+
+func NewExtensionFilter(blockedExts []string) *ExtensionFilter {
+	extensionsMap := map[string]bool{}
+	for _, ext := range blockedExts {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		extensionsMap[ext] = true
+	}
+	return &ExtensionFilter{extensions: extensionsMap}
+}
+
+func (f *ExtensionFilter) Filter(u *url.URL) bool {
+	if u == nil {
+		return false
+	}
+	// u.Path excludes the query string, so "/file.pdf?dl=1" still matches
+	ext := strings.ToLower(path.Ext(u.Path))
+	if ext == "" {
+		return false
+	}
+	_, found := f.extensions[ext]
+	return found
+}
+
+type PathPrefixFilter struct {
+	prefixes []string
+}
+
+func NewPathPrefixFilter(prefixes []string) *PathPrefixFilter {
+	var cleaned []string
+	for _, p := range prefixes {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+		if !strings.HasPrefix(p, "/") {
+			p = "/" + p
+		}
+		cleaned = append(cleaned, p)
+	}
+	return &PathPrefixFilter{prefixes: cleaned}
+}
+
+func (f *PathPrefixFilter) Filter(u *url.URL) bool {
+	if u == nil {
+		return false
+	}
+	p := strings.ToLower(u.Path)
+	for _, prefix := range f.prefixes {
+		if strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
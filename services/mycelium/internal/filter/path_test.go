@@ -0,0 +1,84 @@
+package filter
+
+import (
+	"net/url"
+	"testing"
+)
+
+func mustParse(t testing.TB, rawUrl string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestExtensionFilter(t *testing.T) {
+	f := NewExtensionFilter([]string{".pdf", "ZIP", " .Mp4 ", ""})
+
+	tests := []struct {
+		rawUrl string
+		want   bool
+	}{
+		{"https://example.com/report.pdf", true},
+		{"https://example.com/REPORT.PDF", true},
+		{"https://example.com/archive.zip", true},
+		{"https://example.com/video.mp4", true},
+		{"https://example.com/report.pdf?dl=1", true},
+		{"https://example.com/report.pdf#page=2", true},
+		{"https://example.com/view?file=report.pdf", false},
+		{"https://example.com/report.pdf/", false},
+		{"https://example.com/index.html", false},
+		{"https://example.com/", false},
+		{"https://example.com/pdf", false},
+		{"https://example.com/v1.2/docs", false},
+	}
+	for _, tt := range tests {
+		if got := f.Filter(mustParse(t, tt.rawUrl)); got != tt.want {
+			t.Errorf("Filter(%s) = %t, want %t", tt.rawUrl, got, tt.want)
+		}
+	}
+	if f.Filter(nil) {
+		t.Error("Filter(nil) = true")
+	}
+}
+
+func TestDefaultBlockedExtensions(t *testing.T) {
+	f := NewExtensionFilter(DefaultBlockedExtensions)
+	for _, rawUrl := range []string{
+		"https://example.com/a.JPG",
+		"https://example.com/setup.exe?v=2",
+		"https://example.com/font.woff2",
+	} {
+		if !f.Filter(mustParse(t, rawUrl)) {
+			t.Errorf("default extensions let %s through", rawUrl)
+		}
+	}
+	if f.Filter(mustParse(t, "https://example.com/page.html")) {
+		t.Error("default extensions block html")
+	}
+}
+
+func TestPathPrefixFilter(t *testing.T) {
+	f := NewPathPrefixFilter([]string{"/wp-admin", "Cart", "  ", "/tag/"})
+
+	tests := []struct {
+		rawUrl string
+		want   bool
+	}{
+		{"https://example.com/wp-admin/edit.php", true},
+		{"https://example.com/WP-Admin/", true},
+		{"https://example.com/cart?item=1", true},
+		{"https://example.com/tag/go", true},
+		{"https://example.com/tags", false},
+		{"https://example.com/blog/wp-admin", false},
+		{"https://example.com/?path=/wp-admin", false},
+		{"https://example.com/", false},
+	}
+	for _, tt := range tests {
+		if got := f.Filter(mustParse(t, tt.rawUrl)); got != tt.want {
+			t.Errorf("Filter(%s) = %t, want %t", tt.rawUrl, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package filter
+
+import (
+	"net/url"
+	"strings"
+)
+
+// DefaultStrippedParams lists tracking parameters that never change page
+// content. Entries ending in "*" match any parameter with that prefix.
+var DefaultStrippedParams = []string{
+	"utm_*", "fbclid", "gclid", "dclid", "msclkid", "yclid", "mc_cid", "mc_eid",
+	"_ga", "_gl", "igshid", "ref", "ref_src",
+}
+
+type QueryParamStripper struct {
+	params   map[string]bool
+	prefixes []string
+}
+
+func NewQueryParamStripper(params []string) *QueryParamStripper {
+	s := &QueryParamStripper{params: map[string]bool{}}
+	for _, p := range params {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+		if strings.HasSuffix(p, "*") {
+			s.prefixes = append(s.prefixes, strings.TrimSuffix(p, "*"))
+		} else {
+			s.params[p] = true
+		}
+	}
+	return s
+}
+
+// Rewrite removes the configured parameters and sorts the remaining ones so
+// equivalent urls share one canonical form.
+func (s *QueryParamStripper) Rewrite(u *url.URL) *url.URL {
+	if u == nil || u.RawQuery == "" {
+		return u
+	}
+
+	query := u.Query()
+	for key := range query {
+		if s.stripped(key) {
+			query.Del(key)
+		}
+	}
+
+	rewritten := *u
+	// Encode sorts by key
+	rewritten.RawQuery = query.Encode()
+	return &rewritten
+}
+
+func (s *QueryParamStripper) stripped(key string) bool {
+	key = strings.ToLower(key)
+	if s.params[key] {
+		return true
+	}
+	for _, prefix := range s.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,29 @@
+package filter
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestQueryParamStripper(t *testing.T) {
+	s := NewQueryParamStripper(DefaultStrippedParams)
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"https://example.com/a?utm_source=x&utm_medium=y", "https://example.com/a"},
+		{"https://example.com/a?b=2&a=1", "https://example.com/a?a=1&b=2"},
+		{"https://example.com/a?FBCLID=1&id=7&gclid=2", "https://example.com/a?id=7"},
+		{"https://example.com/a?reference=1", "https://example.com/a?reference=1"},
+		{"https://example.com/a", "https://example.com/a"},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.Rewrite(u).String(); got != tt.want {
+			t.Errorf("Rewrite(%s) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package filter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// RewriteRule replaces the first match of Pattern in a url's
+// "scheme://host/path" with Template, which may refer to capture groups as
+// in regexp.Expand. The query and fragment are kept as they are.
+type RewriteRule struct {
+	Pattern  *regexp.Regexp
+	Template string
+}
+
+// RewriteFilter applies rewrite rules in order. A rule set that would rewrite
+// its own output again for some url leaves that url alone, so rewriting is
+// always idempotent.
+type RewriteFilter struct {
+	rules atomic.Pointer[[]RewriteRule]
+}
+
+func NewRewriteFilter(rules []RewriteRule) *RewriteFilter {
+	f := &RewriteFilter{}
+	f.Reload(rules)
+	return f
+}
+
+// Reload atomically replaces the filter's rules.
+func (f *RewriteFilter) Reload(rules []RewriteRule) {
+	f.rules.Store(&rules)
+}
+
+func (f *RewriteFilter) Rewrite(u *url.URL) *url.URL {
+	if u == nil {
+		return u
+	}
+	rules := *f.rules.Load()
+	rewritten, changed := applyRewriteRules(rules, u)
+	if !changed {
+		return u
+	}
+	if again, changed := applyRewriteRules(rules, rewritten); changed && again.String() != rewritten.String() {
+		return u
+	}
+	return rewritten
+}
+
+func applyRewriteRules(rules []RewriteRule, u *url.URL) (*url.URL, bool) {
+	target := u.Scheme + "://" + u.Host + u.EscapedPath()
+	original := target
+	for _, rule := range rules {
+		match := rule.Pattern.FindStringSubmatchIndex(target)
+		if match == nil {
+			continue
+		}
+		expanded := rule.Pattern.ExpandString(nil, rule.Template, target, match)
+		target = target[:match[0]] + string(expanded) + target[match[1]:]
+	}
+	if target == original {
+		return u, false
+	}
+
+	parsed, err := url.Parse(target)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return u, false
+	}
+	rewritten := *u
+	rewritten.Scheme = parsed.Scheme
+	rewritten.Host = parsed.Host
+	rewritten.Path = parsed.Path
+	rewritten.RawPath = parsed.RawPath
+	return &rewritten, true
+}
+
+// LoadRewriteRules reads a rules file. Each line holds a pattern and a
+// template separated by whitespace, e.g.
+//
+//	^http://(www\.)?example\.com(/|$)  https://${1}example.com$2
+//
+// Lines of the form "test <url> <expected>" check that the rules rewrite url
+// to expected and leave expected unchanged. Blank lines and lines starting
+// with "#" are ignored.
+func LoadRewriteRules(path string) ([]RewriteRule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open rewrite file %s: %w", path, err)
+	}
+	defer file.Close()
+	return ParseRewriteRules(file)
+}
+
+func ParseRewriteRules(r io.Reader) ([]RewriteRule, error) {
+	type rewriteTest struct {
+		line     int
+		input    string
+		expected string
+	}
+	var rules []RewriteRule
+	var tests []rewriteTest
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if fields[0] == "test" {
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("invalid rewrite file line %d: test needs a url and the expected rewrite", line)
+			}
+			tests = append(tests, rewriteTest{line: line, input: fields[1], expected: fields[2]})
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid rewrite file line %d: expected a pattern and a template", line)
+		}
+		rule, err := compileRewriteRule(fields[0], fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid rewrite file line %d: %w", line, err)
+		}
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rewrite file: %w", err)
+	}
+
+	for _, test := range tests {
+		input, err := url.Parse(test.input)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rewrite file line %d: %w", test.line, err)
+		}
+		got, _ := applyRewriteRules(rules, input)
+		if got.String() != test.expected {
+			return nil, fmt.Errorf("rewrite test on line %d failed: %s rewrote to %s, expected %s", test.line, test.input, got, test.expected)
+		}
+		if again, changed := applyRewriteRules(rules, got); changed && again.String() != got.String() {
+			return nil, fmt.Errorf("rewrite test on line %d failed: rules are not idempotent, %s rewrote again to %s", test.line, got, again)
+		}
+	}
+	return rules, nil
+}
+
+var templateRefRegex = regexp.MustCompile(`\$(\$|\{([^}]*)\}|[a-zA-Z0-9_]+)`)
+
+func compileRewriteRule(pattern string, template string) (RewriteRule, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return RewriteRule{}, fmt.Errorf("bad pattern %q: %w", pattern, err)
+	}
+
+	// regexp.Expand quietly drops unknown groups, so check them here
+	for _, ref := range templateRefRegex.FindAllStringSubmatch(template, -1) {
+		name := ref[1]
+		if name == "$" {
+			continue
+		}
+		if ref[2] != "" || strings.HasPrefix(name, "{") {
+			name = ref[2]
+		}
+		if n, err := strconv.Atoi(name); err == nil {
+			if n > re.NumSubexp() {
+				return RewriteRule{}, fmt.Errorf("template %q refers to group %d, pattern has %d", template, n, re.NumSubexp())
+			}
+			continue
+		}
+		if re.SubexpIndex(name) < 0 {
+			return RewriteRule{}, fmt.Errorf("template %q refers to unknown group %q", template, name)
+		}
+	}
+	return RewriteRule{Pattern: re, Template: template}, nil
+}
@@ -0,0 +1,113 @@
+package filter
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const realisticRules = `
+# force https for hosts known to serve it
+^http://(docs\.example\.com|blog\.example\.org)(/|$)   https://$1$2
+
+# mobile subdomains point at the desktop site
+^(https?)://m\.(example\.com)(/|$)   ${1}://www.$2$3
+
+# drop the session path segment
+^(https?://shop\.example\.net)/;jsessionid=[^/]+(/|$)   $1$2
+
+test http://docs.example.com/guide   https://docs.example.com/guide
+test https://m.example.com/news?id=3   https://www.example.com/news?id=3
+test https://shop.example.net/;jsessionid=ab12/cart   https://shop.example.net/cart
+test https://other.example.com/   https://other.example.com/
+`
+
+func TestRewriteFilter(t *testing.T) {
+	rules, err := ParseRewriteRules(strings.NewReader(realisticRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := NewRewriteFilter(rules)
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"http://blog.example.org", "https://blog.example.org"},
+		{"http://blog.example.org/post#comments", "https://blog.example.org/post#comments"},
+		{"http://m.example.com/", "http://www.example.com/"},
+		{"https://m.example.community/", "https://m.example.community/"},
+		{"https://shop.example.net/;jsessionid=x", "https://shop.example.net"},
+		{"https://docs.example.com/guide", "https://docs.example.com/guide"},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := f.Rewrite(u)
+		if got.String() != tt.want {
+			t.Errorf("Rewrite(%s) = %s, want %s", tt.in, got, tt.want)
+		}
+		if again := f.Rewrite(got); again.String() != got.String() {
+			t.Errorf("Rewrite(%s) is not idempotent: %s then %s", tt.in, got, again)
+		}
+	}
+}
+
+func TestRewriteFilterSkipsUnstableRewrites(t *testing.T) {
+	// every pass appends another segment, so the url is left alone
+	rules, err := ParseRewriteRules(strings.NewReader(`^(https://example\.com/a)   $1/a`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse("https://example.com/a")
+	if got := NewRewriteFilter(rules).Rewrite(u); got.String() != "https://example.com/a" {
+		t.Errorf("Rewrite = %s, want the url unchanged", got)
+	}
+}
+
+func TestParseRewriteRulesErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+		want  string
+	}{
+		{"bad pattern", "# comment\n^http://(foo  https://foo", "line 2: bad pattern"},
+		{"missing template", "^http://foo", "line 1: expected a pattern and a template"},
+		{"unknown group", "^http://(foo)  https://$2", "line 1: template"},
+		{"unknown named group", "^http://(?P<host>foo)  https://${hots}", `unknown group "hots"`},
+		{"short test", "^http://foo  https://foo\ntest http://foo", "line 2: test needs"},
+		{"failed test", "^http://foo  https://foo\n\ntest http://foo/ https://bar/", "rewrite test on line 3 failed"},
+		{"not idempotent", "^(https://example\\.com/a)  $1/a\ntest https://example.com/a https://example.com/a/a", "not idempotent"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRewriteRules(strings.NewReader(tt.rules))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriteFilterReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rewrite.rules")
+	if err := os.WriteFile(path, []byte(`^http://(example\.com)  https://$1`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := LoadRewriteRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := NewRewriteFilter(rules)
+	u, _ := url.Parse("http://example.com/a")
+	if got := f.Rewrite(u).String(); got != "https://example.com/a" {
+		t.Errorf("Rewrite = %s", got)
+	}
+	f.Reload(nil)
+	if got := f.Rewrite(u).String(); got != "http://example.com/a" {
+		t.Errorf("Rewrite after reload = %s, want it unchanged", got)
+	}
+}
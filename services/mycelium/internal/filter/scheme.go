@@ -0,0 +1,71 @@
+package filter
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var DefaultAllowedSchemes = []string{"http", "https"}
+
+var defaultPorts = map[string]int{
+	"http":  80,
+	"https": 443,
+}
+
+type SchemeFilter struct {
+	allowed map[string]bool
+}
+
+func NewSchemeFilter(allowed []string) *SchemeFilter {
+	allowedMap := map[string]bool{}
+	for _, scheme := range allowed {
+		allowedMap[strings.ToLower(strings.TrimSpace(scheme))] = true
+	}
+	return &SchemeFilter{allowed: allowedMap}
+}
+
+func (f *SchemeFilter) Filter(u *url.URL) bool {
+	if u == nil {
+		return false
+	}
+	_, found := f.allowed[strings.ToLower(u.Scheme)]
+	return !found
+}
+
+type PortFilter struct {
+	allowed      map[int]bool
+	allowDefault bool
+}
+
+// NewPortFilter blocks urls with explicit ports outside allowedPorts. An
+// explicit port that matches the scheme default (e.g. https on :443) is
+// treated the same as no port.
+func NewPortFilter(allowedPorts []int, allowDefault bool) *PortFilter {
+	allowedMap := map[int]bool{}
+	for _, port := range allowedPorts {
+		allowedMap[port] = true
+	}
+	return &PortFilter{allowed: allowedMap, allowDefault: allowDefault}
+}
+
+func (f *PortFilter) Filter(u *url.URL) bool {
+	if u == nil {
+		return false
+	}
+
+	rawPort := u.Port()
+	if rawPort == "" {
+		return !f.allowDefault
+	}
+
+	port, err := strconv.Atoi(rawPort)
+	if err != nil {
+		return true
+	}
+	if defaultPort, found := defaultPorts[strings.ToLower(u.Scheme)]; found && port == defaultPort && f.allowDefault {
+		return false
+	}
+	_, found := f.allowed[port]
+	return !found
+}
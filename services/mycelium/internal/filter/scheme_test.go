@@ -0,0 +1,69 @@
+package filter
+
+import "testing"
+
+func TestSchemeFilter(t *testing.T) {
+	f := NewSchemeFilter(DefaultAllowedSchemes)
+
+	for rawUrl, want := range map[string]bool{
+		"https://example.com/":       false,
+		"http://example.com/":        false,
+		"HTTPS://example.com/":       false,
+		"ftp://example.com/file.txt": true,
+		"ws://example.com/socket":    true,
+		"mailto:someone@example.com": true,
+		"javascript:void(0)":         true,
+	} {
+		if got := f.Filter(mustParse(t, rawUrl)); got != want {
+			t.Errorf("Filter(%s) = %t, want %t", rawUrl, got, want)
+		}
+	}
+
+	widened := NewSchemeFilter([]string{"http", "https", " FTP "})
+	if widened.Filter(mustParse(t, "ftp://example.com/")) {
+		t.Error("widened scheme filter blocks ftp")
+	}
+}
+
+func TestPortFilter(t *testing.T) {
+	f := NewPortFilter(nil, true)
+
+	tests := []struct {
+		rawUrl string
+		want   bool
+	}{
+		{"https://example.com/", false},
+		{"https://example.com:443/", false},
+		{"http://example.com:80/", false},
+		{"http://example.com:443/", true},
+		{"https://example.com:80/", true},
+		{"https://example.com:8443/", true},
+		{"http://example.com:3000/", true},
+		{"https://[2001:db8::1]/", false},
+		{"https://[2001:db8::1]:443/", false},
+		{"https://[2001:db8::1]:8443/", true},
+	}
+	for _, tt := range tests {
+		if got := f.Filter(mustParse(t, tt.rawUrl)); got != tt.want {
+			t.Errorf("Filter(%s) = %t, want %t", tt.rawUrl, got, tt.want)
+		}
+	}
+}
+
+func TestPortFilterAllowedPorts(t *testing.T) {
+	f := NewPortFilter([]int{8080, 443}, false)
+
+	for rawUrl, want := range map[string]bool{
+		"http://example.com:8080/":    false,
+		"https://[::1]:8080/":         false,
+		"https://example.com:443/":    false,
+		"http://example.com:80/":      true,
+		"https://example.com/":        true,
+		"https://example.com:9090/":   true,
+		"http://[2001:db8::1]:3000/x": true,
+	} {
+		if got := f.Filter(mustParse(t, rawUrl)); got != want {
+			t.Errorf("Filter(%s) = %t, want %t", rawUrl, got, want)
+		}
+	}
+}
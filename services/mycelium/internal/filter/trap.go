@@ -0,0 +1,67 @@
+package filter
+
+import (
+	"net/url"
+	"strings"
+)
+
+const (
+	DefaultMaxUrlLength      = 512
+	DefaultMaxSegmentRepeats = 3
+	DefaultMaxQueryParams    = 10
+)
+
+// TrapFilter blocks urls typical of crawler traps: ever growing urls,
+// recursive path loops like /a/b/a/b/a/b/a/b, and faceted search
+// permutations. A segment may repeat up to the limit, 3 by default.
+type TrapFilter struct {
+	maxLength         int
+	maxSegmentRepeats int
+	maxQueryParams    int
+}
+
+// NewTrapFilter creates a TrapFilter. Non-positive thresholds use the
+// package defaults.
+func NewTrapFilter(maxLength, maxSegmentRepeats, maxQueryParams int) *TrapFilter {
+	if maxLength <= 0 {
+		maxLength = DefaultMaxUrlLength
+	}
+	if maxSegmentRepeats <= 0 {
+		maxSegmentRepeats = DefaultMaxSegmentRepeats
+	}
+	if maxQueryParams <= 0 {
+		maxQueryParams = DefaultMaxQueryParams
+	}
+	return &TrapFilter{
+		maxLength:         maxLength,
+		maxSegmentRepeats: maxSegmentRepeats,
+		maxQueryParams:    maxQueryParams,
+	}
+}
+
+func (f *TrapFilter) Filter(u *url.URL) bool {
+	if u == nil {
+		return false
+	}
+
+	if len(u.String()) > f.maxLength {
+		return true
+	}
+
+	segments := map[string]int{}
+	for _, segment := range strings.Split(u.Path, "/") {
+		if segment == "" {
+			continue
+		}
+		segments[segment]++
+		if segments[segment] > f.maxSegmentRepeats {
+			return true
+		}
+	}
+
+	if u.RawQuery != "" && len(strings.Split(u.RawQuery, "&")) > f.maxQueryParams {
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,63 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTrapFilter(t *testing.T) {
+	f := NewTrapFilter(0, 0, 0)
+
+	tests := []struct {
+		name   string
+		rawUrl string
+		want   bool
+	}{
+		{"recursive loop", "https://example.com/a/a/a/a/page", true},
+		{"alternating loop", "https://example.com/a/b/a/b/a/b/a/b", true},
+		{"calendar", "https://example.com/calendar/2024/01/next/next/next/next", true},
+		{"too long", "https://example.com/" + strings.Repeat("x", DefaultMaxUrlLength), true},
+		{"faceted search", "https://example.com/search?" + facets(DefaultMaxQueryParams+1), true},
+		{"deep docs", "https://example.com/docs/v2/guides/networking/tls/certificates/rotation", false},
+		{"repeated up to the limit", "https://example.com/a/a/a", false},
+		{"alternating up to the limit", "https://example.com/a/b/a/b/a/b", false},
+		{"repeats in query", "https://example.com/list?a=1&a=2&a=3&a=4", false},
+		{"params at the limit", "https://example.com/search?" + facets(DefaultMaxQueryParams), false},
+		{"root", "https://example.com/", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := f.Filter(mustParse(t, tt.rawUrl)); got != tt.want {
+				t.Errorf("Filter(%s) = %t, want %t", tt.rawUrl, got, tt.want)
+			}
+		})
+	}
+	if f.Filter(nil) {
+		t.Error("Filter(nil) = true")
+	}
+}
+
+func TestTrapFilterThresholds(t *testing.T) {
+	f := NewTrapFilter(40, 1, 2)
+
+	for rawUrl, want := range map[string]bool{
+		"https://example.com/a/b":                      false,
+		"https://example.com/a/a":                      true,
+		"https://example.com/?x=1&y=2":                 false,
+		"https://example.com/?x=1&y=2&z=3":             true,
+		"https://example.com/abcdefghijklmnopqrstuvwx": true,
+	} {
+		if got := f.Filter(mustParse(t, rawUrl)); got != want {
+			t.Errorf("Filter(%s) = %t, want %t", rawUrl, got, want)
+		}
+	}
+}
+
+func facets(n int) string {
+	params := make([]string, n)
+	for i := range params {
+		params[i] = fmt.Sprintf("f%d=%d", i, i)
+	}
+	return strings.Join(params, "&")
+}
@@ -0,0 +1,16 @@
+package version
+
+import "fmt"
+
+// Set at build time with
+//
+//	-ldflags "-X mycelium/internal/version.Version=... -X mycelium/internal/version.Commit=... -X mycelium/internal/version.Date=..."
+var (
+	Version = "dev"
+	Commit  = "unknown"
+	Date    = "unknown"
+)
+
+func String() string {
+	return fmt.Sprintf("%s (commit %s, built %s)", Version, Commit, Date)
+}
@@ -0,0 +1,33 @@
+package mycelium
+
+import (
+	"context"
+
+	"mycelium/internal/cache"
+	"mycelium/internal/crawler"
+	"mycelium/internal/store"
+)
+
+type (
+	RedisCache    = cache.CrawlerCache
+	RedisOptions  = cache.CrawlerCacheOptions
+	FileStore     = store.FileStore
+	SamplingStore = crawler.SamplingStore
+)
+
+// NewRedisCache connects to redis. Close the cache when done.
+func NewRedisCache(ctx context.Context, options *RedisOptions) (*RedisCache, error) {
+	return cache.NewRedisCache(ctx, options)
+}
+
+// NewFileStore writes pages as json files below outDirectory, one directory
+// per host.
+func NewFileStore(outDirectory string) *FileStore {
+	return store.NewFileStore(outDirectory)
+}
+
+// NewSamplingStore keeps a 1 in rate sample of the items stored through it
+// in dest, chosen by a hash of their key so reruns pick the same pages.
+func NewSamplingStore(dest Store, rate int) *SamplingStore {
+	return crawler.NewSamplingStore(dest, rate)
+}
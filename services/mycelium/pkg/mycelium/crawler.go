@@ -0,0 +1,234 @@
+package mycelium
+
+import (
+	"io"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"mycelium/internal/chooser"
+	"mycelium/internal/crawler"
+)
+
+type (
+	Crawler     = crawler.Crawler
+	Option      = crawler.CrawlerOption
+	IngressItem = crawler.IngressItem
+	SeedItem    = crawler.SeedItem
+	SeedMode    = crawler.SeedMode
+	Stats       = crawler.Stats
+	Hooks       = crawler.Hooks
+	Metrics     = crawler.Metrics
+
+	// Cache is what a Crawler needs to share its queue and visited set
+	// across workers. RedisCache implements it along with every optional
+	// cache capability.
+	Cache = crawler.CrawlerCache
+	// Store receives fetched pages when no fungicide queue is configured.
+	Store         = crawler.Store
+	StoreItem     = crawler.StoreItem
+	StoreItemMeta = crawler.StoreItemMeta
+
+	UrlFilter     = crawler.UrlFilter
+	UrlRewriter   = crawler.UrlRewriter
+	PageFilter    = crawler.PageFilter
+	HeaderChooser = crawler.HeaderChooser
+
+	DomainOverride  = crawler.DomainOverride
+	RecrawlPolicy   = crawler.RecrawlPolicy
+	SoftErrorPolicy = crawler.SoftErrorPolicy
+	StatusError     = crawler.StatusError
+	ProxyError      = crawler.ProxyError
+
+	// FetchRequest and FetchResult are the request and response of
+	// Crawler.Fetch, for API endpoints that need a method other than GET or
+	// a body.
+	FetchRequest = crawler.FetchRequest
+	FetchResult  = crawler.FetchResult
+
+	// Politeness holds per domain PolitenessProfiles and can be reloaded
+	// while crawling.
+	Politeness        = crawler.Politeness
+	PolitenessProfile = crawler.PolitenessProfile
+	TimeWindow        = crawler.TimeWindow
+
+	// DedupHandler collapses repeated errors of a class and host into one
+	// record with a count per window. Wrap the handler of WithLogger in it.
+	DedupHandler = crawler.DedupHandler
+)
+
+const (
+	SeedSkip    = crawler.SeedSkip
+	SeedMerge   = crawler.SeedMerge
+	SeedReplace = crawler.SeedReplace
+
+	SoftErrorOff  = crawler.SoftErrorOff
+	SoftErrorMark = crawler.SoftErrorMark
+	SoftErrorDrop = crawler.SoftErrorDrop
+)
+
+var (
+	ErrQueueEmpty               = crawler.ErrQueueEmpty
+	ErrTransient                = crawler.ErrTransient
+	ErrBlockedByFilter          = crawler.ErrBlockedByFilter
+	ErrBlacklisted              = crawler.ErrBlacklisted
+	ErrUnsupportedContentType   = crawler.ErrUnsupportedContentType
+	ErrHTTPStatus               = crawler.ErrHTTPStatus
+	ErrBodyTooLarge             = crawler.ErrBodyTooLarge
+	ErrPageTimeout              = crawler.ErrPageTimeout
+	ErrBandwidthBudgetExhausted = crawler.ErrBandwidthBudgetExhausted
+	ErrTooManyRedirects         = crawler.ErrTooManyRedirects
+	ErrRedirectLoop             = crawler.ErrRedirectLoop
+)
+
+// NewCrawler returns a crawler using cache for its queues and store for
+// fetched pages. Both may be nil when only GetPage and Fetch are used.
+func NewCrawler(cache Cache, store Store, opts ...Option) *Crawler {
+	return crawler.NewCrawler(cache, store, opts...)
+}
+
+// WithIngressKey sets the redis key of the queue Crawl pops items from.
+func WithIngressKey(key string) Option {
+	return crawler.WithMyceliumIngressKey(key)
+}
+
+// WithFungicideQueueKey sends fetched pages to this queue for
+// classification instead of the store.
+func WithFungicideQueueKey(key string) Option {
+	return crawler.WithFungicideQueueKey(key)
+}
+
+func WithUrlFilters(filters ...UrlFilter) Option {
+	return crawler.WithUrlFilters(filters)
+}
+
+// WithUrlRewriters normalizes urls before they are filtered and fetched.
+func WithUrlRewriters(rewriters ...UrlRewriter) Option {
+	return crawler.WithUrlRewriters(rewriters)
+}
+
+func WithPageFilters(filters ...PageFilter) Option {
+	return crawler.WithPageFilters(filters)
+}
+
+func WithHeaderChooser(chooser HeaderChooser) Option {
+	return crawler.WithHeaderChooser(chooser)
+}
+
+func WithRequestTimeout(timeout time.Duration) Option {
+	return crawler.WithRequestTimeout(timeout)
+}
+
+// WithPageTimeout bounds fetching and parsing a page as a whole.
+func WithPageTimeout(timeout time.Duration) Option {
+	return crawler.WithPageTimeout(timeout)
+}
+
+func WithMaxRetries(maxRetries int) Option {
+	return crawler.WithMaxRetries(maxRetries)
+}
+
+// WithMaxRedirects sets how many redirects a request may follow.
+func WithMaxRedirects(n int) Option {
+	return crawler.WithMaxRedirects(n)
+}
+
+// WithMaxBodyBytes fails pages whose decoded body is larger than n bytes.
+func WithMaxBodyBytes(n int64) Option {
+	return crawler.WithMaxBodyBytes(n)
+}
+
+// WithDomainRateLimit caps requests per second to each registrable domain.
+func WithDomainRateLimit(rps float64) Option {
+	return crawler.WithDomainRateLimit(rps)
+}
+
+func WithDomainOverrides(overrides map[string]DomainOverride) Option {
+	return crawler.WithDomainOverrides(overrides)
+}
+
+func WithBandwidthBudget(bytesPerRun int64) Option {
+	return crawler.WithBandwidthBudget(bytesPerRun)
+}
+
+// WithSoftErrorPolicy sets what Crawl does with pages that look like a 404
+// despite a success status.
+func WithSoftErrorPolicy(policy SoftErrorPolicy) Option {
+	return crawler.WithSoftErrorPolicy(policy)
+}
+
+// WithHashRoutes crawls single page app routes such as "#/products/42" as
+// pages of their own. Other fragments are stripped.
+func WithHashRoutes(enabled bool) Option {
+	return crawler.WithHashRoutes(enabled)
+}
+
+// WithHostFolding crawls the apex and www hosts of a domain as the one the
+// domain canonicalizes to, remembering it for ttl.
+func WithHostFolding(ttl time.Duration) Option {
+	return crawler.WithHostFolding(ttl)
+}
+
+func NewPoliteness(profiles map[string]PolitenessProfile) *Politeness {
+	return crawler.NewPoliteness(profiles)
+}
+
+// WithPoliteness applies agreed crawl budgets per domain: rate, concurrency,
+// time windows and user agent.
+func WithPoliteness(p *Politeness) Option {
+	return crawler.WithPoliteness(p)
+}
+
+// WithSampling copies the pages Crawl keeps to sampler for review.
+func WithSampling(sampler *SamplingStore) Option {
+	return crawler.WithSampling(sampler)
+}
+
+func WithRecrawl(policy RecrawlPolicy) Option {
+	return crawler.WithRecrawl(policy)
+}
+
+// WithMaxIdle makes Crawl return after the queue has been empty for this
+// many seconds.
+func WithMaxIdle(seconds int) Option {
+	return crawler.WithMaxIdle(seconds)
+}
+
+func WithHooks(hooks Hooks) Option {
+	return crawler.WithHooks(hooks)
+}
+
+func WithLogger(logger *slog.Logger) Option {
+	return crawler.WithLogger(logger)
+}
+
+func NewDedupHandler(inner slog.Handler, window time.Duration) *DedupHandler {
+	return crawler.NewDedupHandler(inner, window, nil)
+}
+
+func WithMetrics(metrics Metrics) Option {
+	return crawler.WithMetrics(metrics)
+}
+
+// NewDefaultHeaderChooser rotates through the browser header profiles built
+// into the crawler.
+func NewDefaultHeaderChooser() (HeaderChooser, error) {
+	profiles, err := chooser.DefaultHeaderProfiles()
+	if err != nil {
+		return nil, err
+	}
+	uaChooser, err := chooser.NewUserAgentChooser(profiles)
+	if err != nil {
+		return nil, err
+	}
+	return uaChooser, nil
+}
+
+// ParseHTML extracts a page from the html in r as if it had been fetched
+// from loc.
+func ParseHTML(loc *url.URL, r io.Reader) *Page {
+	page := crawler.NewPage(loc)
+	page.Type = crawler.PageTypeHTML
+	page.ParseHtmlPage(r)
+	return page
+}
@@ -0,0 +1,29 @@
+// Package mycelium is the importable api of the crawler. It re-exports the
+// parts of the internal packages that other services may rely on: the
+// Crawler and its options, pages, url filters, and the redis cache and file
+// store. The internal packages may change freely; this package only changes
+// in backward compatible ways.
+//
+// Fetching a single page needs neither a cache nor a store:
+//
+//	c := mycelium.NewCrawler(nil, nil,
+//		mycelium.WithUrlFilters(mycelium.NewDefaultFilterChain()),
+//		mycelium.WithRequestTimeout(10*time.Second),
+//	)
+//	page, err := c.GetPage(ctx, loc)
+//
+// Crawling a queue needs a cache, and a store or a fungicide queue for the
+// fetched pages:
+//
+//	rc, err := mycelium.NewRedisCache(ctx, &mycelium.RedisOptions{Addr: "localhost:6379"})
+//	if err != nil {
+//		return err
+//	}
+//	defer rc.Close()
+//	c := mycelium.NewCrawler(rc, mycelium.NewFileStore("out"),
+//		mycelium.WithIngressKey("mycelium:ingress"),
+//	)
+//	err = c.Seed(ctx, []mycelium.SeedItem{{Location: "https://example.com/"}}, mycelium.SeedMerge)
+//	...
+//	err = c.Crawl(ctx)
+package mycelium
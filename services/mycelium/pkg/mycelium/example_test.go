@@ -0,0 +1,71 @@
+package mycelium_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"mycelium/pkg/mycelium"
+)
+
+// Fetching a single page needs neither a cache nor a store.
+func ExampleNewCrawler() {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<html><head><title>Example</title></head><body><a href="http://%s/about">about</a></body></html>`, r.Host)
+	}))
+	defer srv.Close()
+
+	c := mycelium.NewCrawler(nil, nil,
+		mycelium.WithRequestTimeout(10*time.Second),
+		mycelium.WithMaxBodyBytes(1<<20),
+	)
+	loc, _ := url.Parse(srv.URL + "/")
+	page, err := c.GetPage(context.Background(), loc)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(page.Title)
+	for _, link := range page.Links {
+		fmt.Println(link.Path)
+	}
+	// Output:
+	// Example
+	// /about
+}
+
+// Crawling a queue needs a cache, and a store or a fungicide queue for the
+// fetched pages.
+func ExampleNewCrawler_crawl() {
+	ctx := context.Background()
+	rc, err := mycelium.NewRedisCache(ctx, &mycelium.RedisOptions{Addr: "localhost:6379"})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rc.Close()
+
+	c := mycelium.NewCrawler(rc, mycelium.NewFileStore("out"),
+		mycelium.WithIngressKey("mycelium:ingress"),
+		mycelium.WithUrlFilters(mycelium.NewDefaultFilterChain()),
+		mycelium.WithMaxIdle(30),
+	)
+	seeds := []mycelium.SeedItem{{Location: "https://example.com/"}}
+	if err := c.Seed(ctx, seeds, mycelium.SeedMerge); err != nil {
+		log.Fatal(err)
+	}
+	if err := c.Crawl(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func ExampleParseHTML() {
+	loc, _ := url.Parse("https://example.com/blog/")
+	page := mycelium.ParseHTML(loc, strings.NewReader(`<title>Blog</title><a href="https://example.com/blog/first">first</a>`))
+	fmt.Println(page.Title, len(page.Links))
+	// Output: Blog 1
+}
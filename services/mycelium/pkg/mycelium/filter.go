@@ -0,0 +1,46 @@
+package mycelium
+
+import (
+	"mycelium/internal/filter"
+)
+
+// DefaultStrippedParams are tracking parameters such as utm_source.
+var DefaultStrippedParams = filter.DefaultStrippedParams
+
+// NewDefaultFilterChain returns the url filters the crawler applies with its
+// default flags: binary file extensions, non http schemes, unusual ports, ip
+// literals and crawler traps are blocked.
+func NewDefaultFilterChain() UrlFilter {
+	return filter.NewDefaultChain()
+}
+
+// NewDomainFilter blocks urls on the given domains. A leading "*." matches
+// any subdomain, and any other "*" matches within a single label.
+func NewDomainFilter(domains []string) (UrlFilter, error) {
+	f, err := filter.NewDomainFilter(domains)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// NewQueryParamStripper removes the given query parameters from urls.
+func NewQueryParamStripper(params []string) UrlRewriter {
+	return filter.NewQueryParamStripper(params)
+}
+
+// LoadRewriter reads regexp rewrite rules from a file, see the -rewritefile
+// flag of the crawler for the format.
+func LoadRewriter(path string) (UrlRewriter, error) {
+	rules, err := filter.LoadRewriteRules(path)
+	if err != nil {
+		return nil, err
+	}
+	return filter.NewRewriteFilter(rules), nil
+}
+
+// RegistrableDomain returns the part of host a registrar sells, e.g.
+// example.co.uk for www.example.co.uk.
+func RegistrableDomain(host string) string {
+	return filter.RegistrableDomain(host)
+}
@@ -0,0 +1,25 @@
+package mycelium
+
+import (
+	"mycelium/internal/crawler"
+)
+
+type (
+	Page           = crawler.Page
+	PageType       = crawler.PageType
+	FetchInfo      = crawler.FetchInfo
+	Alternate      = crawler.Alternate
+	Script         = crawler.Script
+	OutlinkDomains = crawler.OutlinkDomains
+)
+
+const (
+	PageTypeHTML = crawler.PageTypeHTML
+	PageTypeText = crawler.PageTypeText
+	PageTypeFeed = crawler.PageTypeFeed
+)
+
+// UnmarshalPage decodes a page in the JSON format sent to fungicide.
+func UnmarshalPage(data []byte) (*Page, error) {
+	return crawler.UnmarshalPage(data)
+}
@@ -0,0 +1,5 @@
+// Package myceliumv1 holds the Go types generated from page.proto. Run
+// go generate after editing the schema; protoc must be on the path.
+package myceliumv1
+
+//go:generate sh -c "protoc -I ../.. --plugin=protoc-gen-go=$(go tool -n protoc-gen-go) --go_out=../.. --go_opt=paths=source_relative mycelium/v1/page.proto"
@@ -0,0 +1,933 @@
+// Pages pushed from mycelium to fungicide when -fungicideCodec=proto.
+//
+// Messages on the queue are prefixed with the bytes "\x00mpb1" so consumers
+// can tell them apart from the JSON encoding during migration. Field numbers
+// must never be reused; bump the package version for incompatible changes.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.7
+// 	protoc        (unknown)
+// source: mycelium/v1/page.proto
+
+package myceliumv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Link struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Url           string                 `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Link) Reset() {
+	*x = Link{}
+	mi := &file_mycelium_v1_page_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Link) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Link) ProtoMessage() {}
+
+func (x *Link) ProtoReflect() protoreflect.Message {
+	mi := &file_mycelium_v1_page_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Link.ProtoReflect.Descriptor instead.
+func (*Link) Descriptor() ([]byte, []int) {
+	return file_mycelium_v1_page_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Link) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+type FetchInfo struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	StatusCode     int32                  `protobuf:"varint,1,opt,name=status_code,json=statusCode,proto3" json:"status_code,omitempty"`
+	ContentType    string                 `protobuf:"bytes,2,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	FetchedAtMs    int64                  `protobuf:"varint,3,opt,name=fetched_at_ms,json=fetchedAtMs,proto3" json:"fetched_at_ms,omitempty"`
+	DurationMs     int64                  `protobuf:"varint,4,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`
+	DnsMs          int64                  `protobuf:"varint,5,opt,name=dns_ms,json=dnsMs,proto3" json:"dns_ms,omitempty"`
+	TlsHandshakeMs int64                  `protobuf:"varint,6,opt,name=tls_handshake_ms,json=tlsHandshakeMs,proto3" json:"tls_handshake_ms,omitempty"`
+	// address the response came from; the proxy when via_proxy is set
+	RemoteAddr string `protobuf:"bytes,7,opt,name=remote_addr,json=remoteAddr,proto3" json:"remote_addr,omitempty"`
+	ViaProxy   bool   `protobuf:"varint,8,opt,name=via_proxy,json=viaProxy,proto3" json:"via_proxy,omitempty"`
+	ConnReused bool   `protobuf:"varint,9,opt,name=conn_reused,json=connReused,proto3" json:"conn_reused,omitempty"`
+	// lowercased charset parameter of the content type, if any
+	Charset string `protobuf:"bytes,10,opt,name=charset,proto3" json:"charset,omitempty"`
+	// decoded body bytes read, and the bytes that took on the wire when the
+	// body was gzipped; unparsed pages are only read as far as sniffing needs
+	BodyBytes       int64 `protobuf:"varint,11,opt,name=body_bytes,json=bodyBytes,proto3" json:"body_bytes,omitempty"`
+	CompressedBytes int64 `protobuf:"varint,12,opt,name=compressed_bytes,json=compressedBytes,proto3" json:"compressed_bytes,omitempty"`
+	// X-Cache or Cache-Status of an upstream cache, and the Age it reported
+	CacheStatus   string `protobuf:"bytes,13,opt,name=cache_status,json=cacheStatus,proto3" json:"cache_status,omitempty"`
+	AgeMs         int64  `protobuf:"varint,14,opt,name=age_ms,json=ageMs,proto3" json:"age_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FetchInfo) Reset() {
+	*x = FetchInfo{}
+	mi := &file_mycelium_v1_page_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FetchInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetchInfo) ProtoMessage() {}
+
+func (x *FetchInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_mycelium_v1_page_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetchInfo.ProtoReflect.Descriptor instead.
+func (*FetchInfo) Descriptor() ([]byte, []int) {
+	return file_mycelium_v1_page_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *FetchInfo) GetStatusCode() int32 {
+	if x != nil {
+		return x.StatusCode
+	}
+	return 0
+}
+
+func (x *FetchInfo) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *FetchInfo) GetFetchedAtMs() int64 {
+	if x != nil {
+		return x.FetchedAtMs
+	}
+	return 0
+}
+
+func (x *FetchInfo) GetDurationMs() int64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
+func (x *FetchInfo) GetDnsMs() int64 {
+	if x != nil {
+		return x.DnsMs
+	}
+	return 0
+}
+
+func (x *FetchInfo) GetTlsHandshakeMs() int64 {
+	if x != nil {
+		return x.TlsHandshakeMs
+	}
+	return 0
+}
+
+func (x *FetchInfo) GetRemoteAddr() string {
+	if x != nil {
+		return x.RemoteAddr
+	}
+	return ""
+}
+
+func (x *FetchInfo) GetViaProxy() bool {
+	if x != nil {
+		return x.ViaProxy
+	}
+	return false
+}
+
+func (x *FetchInfo) GetConnReused() bool {
+	if x != nil {
+		return x.ConnReused
+	}
+	return false
+}
+
+func (x *FetchInfo) GetCharset() string {
+	if x != nil {
+		return x.Charset
+	}
+	return ""
+}
+
+func (x *FetchInfo) GetBodyBytes() int64 {
+	if x != nil {
+		return x.BodyBytes
+	}
+	return 0
+}
+
+func (x *FetchInfo) GetCompressedBytes() int64 {
+	if x != nil {
+		return x.CompressedBytes
+	}
+	return 0
+}
+
+func (x *FetchInfo) GetCacheStatus() string {
+	if x != nil {
+		return x.CacheStatus
+	}
+	return ""
+}
+
+func (x *FetchInfo) GetAgeMs() int64 {
+	if x != nil {
+		return x.AgeMs
+	}
+	return 0
+}
+
+// TLS and server fingerprint of an HTTPS fetch; certificate fields are
+// sanitized and truncated
+type Security struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TlsVersion    string                 `protobuf:"bytes,1,opt,name=tls_version,json=tlsVersion,proto3" json:"tls_version,omitempty"`
+	Alpn          string                 `protobuf:"bytes,2,opt,name=alpn,proto3" json:"alpn,omitempty"`
+	Subject       string                 `protobuf:"bytes,3,opt,name=subject,proto3" json:"subject,omitempty"`
+	Issuer        string                 `protobuf:"bytes,4,opt,name=issuer,proto3" json:"issuer,omitempty"`
+	Sans          []string               `protobuf:"bytes,5,rep,name=sans,proto3" json:"sans,omitempty"`
+	Server        string                 `protobuf:"bytes,6,opt,name=server,proto3" json:"server,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Security) Reset() {
+	*x = Security{}
+	mi := &file_mycelium_v1_page_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Security) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Security) ProtoMessage() {}
+
+func (x *Security) ProtoReflect() protoreflect.Message {
+	mi := &file_mycelium_v1_page_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Security.ProtoReflect.Descriptor instead.
+func (*Security) Descriptor() ([]byte, []int) {
+	return file_mycelium_v1_page_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Security) GetTlsVersion() string {
+	if x != nil {
+		return x.TlsVersion
+	}
+	return ""
+}
+
+func (x *Security) GetAlpn() string {
+	if x != nil {
+		return x.Alpn
+	}
+	return ""
+}
+
+func (x *Security) GetSubject() string {
+	if x != nil {
+		return x.Subject
+	}
+	return ""
+}
+
+func (x *Security) GetIssuer() string {
+	if x != nil {
+		return x.Issuer
+	}
+	return ""
+}
+
+func (x *Security) GetSans() []string {
+	if x != nil {
+		return x.Sans
+	}
+	return nil
+}
+
+func (x *Security) GetServer() string {
+	if x != nil {
+		return x.Server
+	}
+	return ""
+}
+
+// a rel="alternate" link from the HTML or the Link header
+type Alternate struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Url           string                 `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
+	Hreflang      string                 `protobuf:"bytes,2,opt,name=hreflang,proto3" json:"hreflang,omitempty"`
+	Type          string                 `protobuf:"bytes,3,opt,name=type,proto3" json:"type,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Alternate) Reset() {
+	*x = Alternate{}
+	mi := &file_mycelium_v1_page_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Alternate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Alternate) ProtoMessage() {}
+
+func (x *Alternate) ProtoReflect() protoreflect.Message {
+	mi := &file_mycelium_v1_page_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Alternate.ProtoReflect.Descriptor instead.
+func (*Alternate) Descriptor() ([]byte, []int) {
+	return file_mycelium_v1_page_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Alternate) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *Alternate) GetHreflang() string {
+	if x != nil {
+		return x.Hreflang
+	}
+	return ""
+}
+
+func (x *Alternate) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+type Script struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// javascript, module, json or other
+	Type string `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	// the type attribute as written
+	MediaType     string `protobuf:"bytes,2,opt,name=media_type,json=mediaType,proto3" json:"media_type,omitempty"`
+	Content       string `protobuf:"bytes,3,opt,name=content,proto3" json:"content,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Script) Reset() {
+	*x = Script{}
+	mi := &file_mycelium_v1_page_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Script) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Script) ProtoMessage() {}
+
+func (x *Script) ProtoReflect() protoreflect.Message {
+	mi := &file_mycelium_v1_page_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Script.ProtoReflect.Descriptor instead.
+func (*Script) Descriptor() ([]byte, []int) {
+	return file_mycelium_v1_page_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Script) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Script) GetMediaType() string {
+	if x != nil {
+		return x.MediaType
+	}
+	return ""
+}
+
+func (x *Script) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+// the links of a page counted by registrable domain
+type OutlinkDomains struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// links to the page's own registrable domain
+	Internal int32 `protobuf:"varint,1,opt,name=internal,proto3" json:"internal,omitempty"`
+	// links to each other registrable domain
+	External      map[string]int32 `protobuf:"bytes,2,rep,name=external,proto3" json:"external,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OutlinkDomains) Reset() {
+	*x = OutlinkDomains{}
+	mi := &file_mycelium_v1_page_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OutlinkDomains) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OutlinkDomains) ProtoMessage() {}
+
+func (x *OutlinkDomains) ProtoReflect() protoreflect.Message {
+	mi := &file_mycelium_v1_page_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OutlinkDomains.ProtoReflect.Descriptor instead.
+func (*OutlinkDomains) Descriptor() ([]byte, []int) {
+	return file_mycelium_v1_page_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *OutlinkDomains) GetInternal() int32 {
+	if x != nil {
+		return x.Internal
+	}
+	return 0
+}
+
+func (x *OutlinkDomains) GetExternal() map[string]int32 {
+	if x != nil {
+		return x.External
+	}
+	return nil
+}
+
+type Page struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Title       string                 `protobuf:"bytes,1,opt,name=title,proto3" json:"title,omitempty"`
+	Description string                 `protobuf:"bytes,2,opt,name=description,proto3" json:"description,omitempty"`
+	Author      string                 `protobuf:"bytes,3,opt,name=author,proto3" json:"author,omitempty"`
+	Keywords    []string               `protobuf:"bytes,4,rep,name=keywords,proto3" json:"keywords,omitempty"`
+	Headings    []string               `protobuf:"bytes,5,rep,name=headings,proto3" json:"headings,omitempty"`
+	Content     []string               `protobuf:"bytes,6,rep,name=content,proto3" json:"content,omitempty"`
+	Links       []*Link                `protobuf:"bytes,7,rep,name=links,proto3" json:"links,omitempty"`
+	ScriptLinks []*Link                `protobuf:"bytes,8,rep,name=script_links,json=scriptLinks,proto3" json:"script_links,omitempty"`
+	// content of each of scripts, for consumers of the older format; since
+	// schema version 6 it holds only the inline scripts kept under the
+	// script caps, where it used to hold every inline script
+	ScriptContent []string   `protobuf:"bytes,9,rep,name=script_content,json=scriptContent,proto3" json:"script_content,omitempty"`
+	Location      string     `protobuf:"bytes,10,opt,name=location,proto3" json:"location,omitempty"`
+	CreatedAt     int64      `protobuf:"varint,11,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	Fetch         *FetchInfo `protobuf:"bytes,12,opt,name=fetch,proto3" json:"fetch,omitempty"`
+	// what was cut to fit the payload budget, e.g. "script_content"
+	Trimmed []string `protobuf:"bytes,13,rep,name=trimmed,proto3" json:"trimmed,omitempty"`
+	// the page that linked here, if known
+	Referrer string `protobuf:"bytes,14,opt,name=referrer,proto3" json:"referrer,omitempty"`
+	// set when the page was fetched again after going stale
+	Recrawl bool `protobuf:"varint,15,opt,name=recrawl,proto3" json:"recrawl,omitempty"`
+	// unset for plain HTTP fetches
+	Security *Security `protobuf:"bytes,16,opt,name=security,proto3" json:"security,omitempty"`
+	// how the fields were extracted: "html", "text" or "feed"
+	PageType string `protobuf:"bytes,17,opt,name=page_type,json=pageType,proto3" json:"page_type,omitempty"`
+	// lang attribute of <html>
+	Lang string `protobuf:"bytes,18,opt,name=lang,proto3" json:"lang,omitempty"`
+	// "ltr" or "rtl": the dir attribute of <html>, else guessed from the text
+	Dir string `protobuf:"bytes,19,opt,name=dir,proto3" json:"dir,omitempty"`
+	// parallel to headings and content: the dir attribute of each element,
+	// empty where inherited; omitted when no element set one
+	HeadingDirs []string `protobuf:"bytes,20,rep,name=heading_dirs,json=headingDirs,proto3" json:"heading_dirs,omitempty"`
+	ContentDirs []string `protobuf:"bytes,21,rep,name=content_dirs,json=contentDirs,proto3" json:"content_dirs,omitempty"`
+	// from <link> tags, else the Link header
+	Canonical  string       `protobuf:"bytes,22,opt,name=canonical,proto3" json:"canonical,omitempty"`
+	Alternates []*Alternate `protobuf:"bytes,23,rep,name=alternates,proto3" json:"alternates,omitempty"`
+	// links with a download attribute or a binary file extension, which are
+	// not in links and never crawled; before schema version 5 they were in
+	// links
+	DownloadLinks []*Link `protobuf:"bytes,24,rep,name=download_links,json=downloadLinks,proto3" json:"download_links,omitempty"`
+	// id of the crawl run that fetched the page
+	Session string `protobuf:"bytes,25,opt,name=session,proto3" json:"session,omitempty"`
+	// why the page looks like an error page despite a success status, such as
+	// a "page not found" served with 200
+	SoftError string `protobuf:"bytes,26,opt,name=soft_error,json=softError,proto3" json:"soft_error,omitempty"`
+	// urls the request was redirected through, ending with the one that
+	// served the page
+	Redirects []string `protobuf:"bytes,27,rep,name=redirects,proto3" json:"redirects,omitempty"`
+	// inline scripts kept under the crawler's script caps, with their type;
+	// added in schema version 6
+	Scripts []*Script `protobuf:"bytes,28,rep,name=scripts,proto3" json:"scripts,omitempty"`
+	// distinct links counted by registrable domain, relative to the domain
+	// that served the page
+	OutlinkDomains *OutlinkDomains `protobuf:"bytes,29,opt,name=outlink_domains,json=outlinkDomains,proto3" json:"outlink_domains,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *Page) Reset() {
+	*x = Page{}
+	mi := &file_mycelium_v1_page_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Page) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Page) ProtoMessage() {}
+
+func (x *Page) ProtoReflect() protoreflect.Message {
+	mi := &file_mycelium_v1_page_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Page.ProtoReflect.Descriptor instead.
+func (*Page) Descriptor() ([]byte, []int) {
+	return file_mycelium_v1_page_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Page) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *Page) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *Page) GetAuthor() string {
+	if x != nil {
+		return x.Author
+	}
+	return ""
+}
+
+func (x *Page) GetKeywords() []string {
+	if x != nil {
+		return x.Keywords
+	}
+	return nil
+}
+
+func (x *Page) GetHeadings() []string {
+	if x != nil {
+		return x.Headings
+	}
+	return nil
+}
+
+func (x *Page) GetContent() []string {
+	if x != nil {
+		return x.Content
+	}
+	return nil
+}
+
+func (x *Page) GetLinks() []*Link {
+	if x != nil {
+		return x.Links
+	}
+	return nil
+}
+
+func (x *Page) GetScriptLinks() []*Link {
+	if x != nil {
+		return x.ScriptLinks
+	}
+	return nil
+}
+
+func (x *Page) GetScriptContent() []string {
+	if x != nil {
+		return x.ScriptContent
+	}
+	return nil
+}
+
+func (x *Page) GetLocation() string {
+	if x != nil {
+		return x.Location
+	}
+	return ""
+}
+
+func (x *Page) GetCreatedAt() int64 {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return 0
+}
+
+func (x *Page) GetFetch() *FetchInfo {
+	if x != nil {
+		return x.Fetch
+	}
+	return nil
+}
+
+func (x *Page) GetTrimmed() []string {
+	if x != nil {
+		return x.Trimmed
+	}
+	return nil
+}
+
+func (x *Page) GetReferrer() string {
+	if x != nil {
+		return x.Referrer
+	}
+	return ""
+}
+
+func (x *Page) GetRecrawl() bool {
+	if x != nil {
+		return x.Recrawl
+	}
+	return false
+}
+
+func (x *Page) GetSecurity() *Security {
+	if x != nil {
+		return x.Security
+	}
+	return nil
+}
+
+func (x *Page) GetPageType() string {
+	if x != nil {
+		return x.PageType
+	}
+	return ""
+}
+
+func (x *Page) GetLang() string {
+	if x != nil {
+		return x.Lang
+	}
+	return ""
+}
+
+func (x *Page) GetDir() string {
+	if x != nil {
+		return x.Dir
+	}
+	return ""
+}
+
+func (x *Page) GetHeadingDirs() []string {
+	if x != nil {
+		return x.HeadingDirs
+	}
+	return nil
+}
+
+func (x *Page) GetContentDirs() []string {
+	if x != nil {
+		return x.ContentDirs
+	}
+	return nil
+}
+
+func (x *Page) GetCanonical() string {
+	if x != nil {
+		return x.Canonical
+	}
+	return ""
+}
+
+func (x *Page) GetAlternates() []*Alternate {
+	if x != nil {
+		return x.Alternates
+	}
+	return nil
+}
+
+func (x *Page) GetDownloadLinks() []*Link {
+	if x != nil {
+		return x.DownloadLinks
+	}
+	return nil
+}
+
+func (x *Page) GetSession() string {
+	if x != nil {
+		return x.Session
+	}
+	return ""
+}
+
+func (x *Page) GetSoftError() string {
+	if x != nil {
+		return x.SoftError
+	}
+	return ""
+}
+
+func (x *Page) GetRedirects() []string {
+	if x != nil {
+		return x.Redirects
+	}
+	return nil
+}
+
+func (x *Page) GetScripts() []*Script {
+	if x != nil {
+		return x.Scripts
+	}
+	return nil
+}
+
+func (x *Page) GetOutlinkDomains() *OutlinkDomains {
+	if x != nil {
+		return x.OutlinkDomains
+	}
+	return nil
+}
+
+var File_mycelium_v1_page_proto protoreflect.FileDescriptor
+
+const file_mycelium_v1_page_proto_rawDesc = "" +
+	"\n" +
+	"\x16mycelium/v1/page.proto\x12\vmycelium.v1\"\x18\n" +
+	"\x04Link\x12\x10\n" +
+	"\x03url\x18\x01 \x01(\tR\x03url\"\xd2\x03\n" +
+	"\tFetchInfo\x12\x1f\n" +
+	"\vstatus_code\x18\x01 \x01(\x05R\n" +
+	"statusCode\x12!\n" +
+	"\fcontent_type\x18\x02 \x01(\tR\vcontentType\x12\"\n" +
+	"\rfetched_at_ms\x18\x03 \x01(\x03R\vfetchedAtMs\x12\x1f\n" +
+	"\vduration_ms\x18\x04 \x01(\x03R\n" +
+	"durationMs\x12\x15\n" +
+	"\x06dns_ms\x18\x05 \x01(\x03R\x05dnsMs\x12(\n" +
+	"\x10tls_handshake_ms\x18\x06 \x01(\x03R\x0etlsHandshakeMs\x12\x1f\n" +
+	"\vremote_addr\x18\a \x01(\tR\n" +
+	"remoteAddr\x12\x1b\n" +
+	"\tvia_proxy\x18\b \x01(\bR\bviaProxy\x12\x1f\n" +
+	"\vconn_reused\x18\t \x01(\bR\n" +
+	"connReused\x12\x18\n" +
+	"\acharset\x18\n" +
+	" \x01(\tR\acharset\x12\x1d\n" +
+	"\n" +
+	"body_bytes\x18\v \x01(\x03R\tbodyBytes\x12)\n" +
+	"\x10compressed_bytes\x18\f \x01(\x03R\x0fcompressedBytes\x12!\n" +
+	"\fcache_status\x18\r \x01(\tR\vcacheStatus\x12\x15\n" +
+	"\x06age_ms\x18\x0e \x01(\x03R\x05ageMs\"\x9d\x01\n" +
+	"\bSecurity\x12\x1f\n" +
+	"\vtls_version\x18\x01 \x01(\tR\n" +
+	"tlsVersion\x12\x12\n" +
+	"\x04alpn\x18\x02 \x01(\tR\x04alpn\x12\x18\n" +
+	"\asubject\x18\x03 \x01(\tR\asubject\x12\x16\n" +
+	"\x06issuer\x18\x04 \x01(\tR\x06issuer\x12\x12\n" +
+	"\x04sans\x18\x05 \x03(\tR\x04sans\x12\x16\n" +
+	"\x06server\x18\x06 \x01(\tR\x06server\"M\n" +
+	"\tAlternate\x12\x10\n" +
+	"\x03url\x18\x01 \x01(\tR\x03url\x12\x1a\n" +
+	"\bhreflang\x18\x02 \x01(\tR\bhreflang\x12\x12\n" +
+	"\x04type\x18\x03 \x01(\tR\x04type\"U\n" +
+	"\x06Script\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x1d\n" +
+	"\n" +
+	"media_type\x18\x02 \x01(\tR\tmediaType\x12\x18\n" +
+	"\acontent\x18\x03 \x01(\tR\acontent\"\xb0\x01\n" +
+	"\x0eOutlinkDomains\x12\x1a\n" +
+	"\binternal\x18\x01 \x01(\x05R\binternal\x12E\n" +
+	"\bexternal\x18\x02 \x03(\v2).mycelium.v1.OutlinkDomains.ExternalEntryR\bexternal\x1a;\n" +
+	"\rExternalEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x05R\x05value:\x028\x01\"\xff\a\n" +
+	"\x04Page\x12\x14\n" +
+	"\x05title\x18\x01 \x01(\tR\x05title\x12 \n" +
+	"\vdescription\x18\x02 \x01(\tR\vdescription\x12\x16\n" +
+	"\x06author\x18\x03 \x01(\tR\x06author\x12\x1a\n" +
+	"\bkeywords\x18\x04 \x03(\tR\bkeywords\x12\x1a\n" +
+	"\bheadings\x18\x05 \x03(\tR\bheadings\x12\x18\n" +
+	"\acontent\x18\x06 \x03(\tR\acontent\x12'\n" +
+	"\x05links\x18\a \x03(\v2\x11.mycelium.v1.LinkR\x05links\x124\n" +
+	"\fscript_links\x18\b \x03(\v2\x11.mycelium.v1.LinkR\vscriptLinks\x12%\n" +
+	"\x0escript_content\x18\t \x03(\tR\rscriptContent\x12\x1a\n" +
+	"\blocation\x18\n" +
+	" \x01(\tR\blocation\x12\x1d\n" +
+	"\n" +
+	"created_at\x18\v \x01(\x03R\tcreatedAt\x12,\n" +
+	"\x05fetch\x18\f \x01(\v2\x16.mycelium.v1.FetchInfoR\x05fetch\x12\x18\n" +
+	"\atrimmed\x18\r \x03(\tR\atrimmed\x12\x1a\n" +
+	"\breferrer\x18\x0e \x01(\tR\breferrer\x12\x18\n" +
+	"\arecrawl\x18\x0f \x01(\bR\arecrawl\x121\n" +
+	"\bsecurity\x18\x10 \x01(\v2\x15.mycelium.v1.SecurityR\bsecurity\x12\x1b\n" +
+	"\tpage_type\x18\x11 \x01(\tR\bpageType\x12\x12\n" +
+	"\x04lang\x18\x12 \x01(\tR\x04lang\x12\x10\n" +
+	"\x03dir\x18\x13 \x01(\tR\x03dir\x12!\n" +
+	"\fheading_dirs\x18\x14 \x03(\tR\vheadingDirs\x12!\n" +
+	"\fcontent_dirs\x18\x15 \x03(\tR\vcontentDirs\x12\x1c\n" +
+	"\tcanonical\x18\x16 \x01(\tR\tcanonical\x126\n" +
+	"\n" +
+	"alternates\x18\x17 \x03(\v2\x16.mycelium.v1.AlternateR\n" +
+	"alternates\x128\n" +
+	"\x0edownload_links\x18\x18 \x03(\v2\x11.mycelium.v1.LinkR\rdownloadLinks\x12\x18\n" +
+	"\asession\x18\x19 \x01(\tR\asession\x12\x1d\n" +
+	"\n" +
+	"soft_error\x18\x1a \x01(\tR\tsoftError\x12\x1c\n" +
+	"\tredirects\x18\x1b \x03(\tR\tredirects\x12-\n" +
+	"\ascripts\x18\x1c \x03(\v2\x13.mycelium.v1.ScriptR\ascripts\x12D\n" +
+	"\x0foutlink_domains\x18\x1d \x01(\v2\x1b.mycelium.v1.OutlinkDomainsR\x0eoutlinkDomainsB'Z%mycelium/proto/mycelium/v1;myceliumv1b\x06proto3"
+
+var (
+	file_mycelium_v1_page_proto_rawDescOnce sync.Once
+	file_mycelium_v1_page_proto_rawDescData []byte
+)
+
+func file_mycelium_v1_page_proto_rawDescGZIP() []byte {
+	file_mycelium_v1_page_proto_rawDescOnce.Do(func() {
+		file_mycelium_v1_page_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_mycelium_v1_page_proto_rawDesc), len(file_mycelium_v1_page_proto_rawDesc)))
+	})
+	return file_mycelium_v1_page_proto_rawDescData
+}
+
+var file_mycelium_v1_page_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_mycelium_v1_page_proto_goTypes = []any{
+	(*Link)(nil),           // 0: mycelium.v1.Link
+	(*FetchInfo)(nil),      // 1: mycelium.v1.FetchInfo
+	(*Security)(nil),       // 2: mycelium.v1.Security
+	(*Alternate)(nil),      // 3: mycelium.v1.Alternate
+	(*Script)(nil),         // 4: mycelium.v1.Script
+	(*OutlinkDomains)(nil), // 5: mycelium.v1.OutlinkDomains
+	(*Page)(nil),           // 6: mycelium.v1.Page
+	nil,                    // 7: mycelium.v1.OutlinkDomains.ExternalEntry
+}
+var file_mycelium_v1_page_proto_depIdxs = []int32{
+	7, // 0: mycelium.v1.OutlinkDomains.external:type_name -> mycelium.v1.OutlinkDomains.ExternalEntry
+	0, // 1: mycelium.v1.Page.links:type_name -> mycelium.v1.Link
+	0, // 2: mycelium.v1.Page.script_links:type_name -> mycelium.v1.Link
+	1, // 3: mycelium.v1.Page.fetch:type_name -> mycelium.v1.FetchInfo
+	2, // 4: mycelium.v1.Page.security:type_name -> mycelium.v1.Security
+	3, // 5: mycelium.v1.Page.alternates:type_name -> mycelium.v1.Alternate
+	0, // 6: mycelium.v1.Page.download_links:type_name -> mycelium.v1.Link
+	4, // 7: mycelium.v1.Page.scripts:type_name -> mycelium.v1.Script
+	5, // 8: mycelium.v1.Page.outlink_domains:type_name -> mycelium.v1.OutlinkDomains
+	9, // [9:9] is the sub-list for method output_type
+	9, // [9:9] is the sub-list for method input_type
+	9, // [9:9] is the sub-list for extension type_name
+	9, // [9:9] is the sub-list for extension extendee
+	0, // [0:9] is the sub-list for field type_name
+}
+
+func init() { file_mycelium_v1_page_proto_init() }
+func file_mycelium_v1_page_proto_init() {
+	if File_mycelium_v1_page_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_mycelium_v1_page_proto_rawDesc), len(file_mycelium_v1_page_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   8,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_mycelium_v1_page_proto_goTypes,
+		DependencyIndexes: file_mycelium_v1_page_proto_depIdxs,
+		MessageInfos:      file_mycelium_v1_page_proto_msgTypes,
+	}.Build()
+	File_mycelium_v1_page_proto = out.File
+	file_mycelium_v1_page_proto_goTypes = nil
+	file_mycelium_v1_page_proto_depIdxs = nil
+}